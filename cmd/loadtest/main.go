@@ -0,0 +1,364 @@
+// loadtest 对代理发起并发流式请求，统计吞吐、首包延迟（TTFB）、SSE 事件间隔与内存分配。
+//
+// 不指定 -target 时会在进程内启动网关，并用 stub 上游替代 Vertex，
+// 这样测到的就是代理自身的开销（适合验证缓冲池、零拷贝透传等性能改动）。
+//
+//	go run ./cmd/loadtest -n 500 -c 50 -chunks 100
+//	go run ./cmd/loadtest -target http://localhost:8045 -key sk-xxx -api claude
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"anti2api-golang/refactor/internal/config"
+	"anti2api-golang/refactor/internal/credential"
+	"anti2api-golang/refactor/internal/gateway"
+	"anti2api-golang/refactor/internal/logger"
+	"anti2api-golang/refactor/internal/vertex"
+)
+
+type options struct {
+	target     string
+	api        string
+	model      string
+	key        string
+	total      int
+	concurrent int
+	stream     bool
+	chunks     int
+	chunkText  string
+	chunkDelay time.Duration
+	timeout    time.Duration
+}
+
+type result struct {
+	ttfb     time.Duration
+	duration time.Duration
+	events   int
+	bytes    int64
+	maxGap   time.Duration
+	err      error
+}
+
+func main() {
+	var opts options
+	flag.StringVar(&opts.target, "target", "", "代理地址（例如 http://localhost:8045）；为空则进程内启动网关 + stub 上游")
+	flag.StringVar(&opts.api, "api", "openai", "请求格式：openai | claude | gemini")
+	flag.StringVar(&opts.model, "model", "gemini-2.5-flash", "请求的模型名")
+	flag.StringVar(&opts.key, "key", "", "API Key（仅 -target 模式需要）")
+	flag.IntVar(&opts.total, "n", 200, "请求总数")
+	flag.IntVar(&opts.concurrent, "c", 20, "并发数")
+	flag.BoolVar(&opts.stream, "stream", true, "是否使用流式请求")
+	flag.IntVar(&opts.chunks, "chunks", 50, "stub 上游每个响应的 SSE 分片数")
+	flag.StringVar(&opts.chunkText, "chunk-text", "hello world ", "stub 上游每个分片的文本")
+	flag.DurationVar(&opts.chunkDelay, "chunk-delay", 0, "stub 上游分片间隔")
+	flag.DurationVar(&opts.timeout, "timeout", 60*time.Second, "单个请求超时")
+	flag.Parse()
+
+	if opts.total < 1 {
+		opts.total = 1
+	}
+	if opts.concurrent < 1 {
+		opts.concurrent = 1
+	}
+	if opts.concurrent > opts.total {
+		opts.concurrent = opts.total
+	}
+
+	baseURL := strings.TrimRight(opts.target, "/")
+	inProcess := baseURL == ""
+	if inProcess {
+		url, shutdown, err := startInProcess(&opts)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "启动进程内网关失败: %v\n", err)
+			os.Exit(1)
+		}
+		defer shutdown()
+		baseURL = url
+	}
+
+	path, body, err := buildRequest(&opts)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+
+	client := &http.Client{
+		Transport: &http.Transport{
+			MaxIdleConns:        opts.concurrent * 2,
+			MaxIdleConnsPerHost: opts.concurrent * 2,
+			IdleConnTimeout:     90 * time.Second,
+		},
+	}
+
+	fmt.Printf("目标: %s%s | 格式: %s | 模型: %s | 流式: %v | 总数: %d | 并发: %d\n",
+		baseURL, path, opts.api, opts.model, opts.stream, opts.total, opts.concurrent)
+
+	runtime.GC()
+	var before runtime.MemStats
+	runtime.ReadMemStats(&before)
+
+	results := make([]result, opts.total)
+	var next atomic.Int64
+	var wg sync.WaitGroup
+	start := time.Now()
+	for w := 0; w < opts.concurrent; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				i := int(next.Add(1)) - 1
+				if i >= opts.total {
+					return
+				}
+				results[i] = doRequest(client, baseURL+path, body, &opts)
+			}
+		}()
+	}
+	wg.Wait()
+	elapsed := time.Since(start)
+
+	var after runtime.MemStats
+	runtime.ReadMemStats(&after)
+
+	report(results, elapsed, &before, &after, inProcess)
+}
+
+// startInProcess 在本进程内启动网关，并将上游替换为 stub，返回监听地址。
+func startInProcess(opts *options) (string, func(), error) {
+	dataDir, err := os.MkdirTemp("", "ant2api-loadtest-")
+	if err != nil {
+		return "", nil, err
+	}
+
+	cfg := config.Get()
+	cfg.DataDir = dataDir
+	cfg.APIKey = ""
+	cfg.Debug = "off"
+	cfg.RetryMaxAttempts = 1
+	logger.Init()
+
+	vertex.SetTransport(&stubTransport{
+		chunks:     opts.chunks,
+		chunkText:  opts.chunkText,
+		chunkDelay: opts.chunkDelay,
+	})
+
+	store := credential.GetStore()
+	if err := store.Add(credential.Account{
+		AccessToken:  "loadtest-token",
+		RefreshToken: "loadtest-refresh",
+		ExpiresIn:    24 * 3600,
+		Timestamp:    time.Now().UnixMilli(),
+		ProjectID:    "loadtest-project",
+		Email:        "loadtest@example.com",
+		Enable:       true,
+	}); err != nil {
+		_ = os.RemoveAll(dataDir)
+		return "", nil, err
+	}
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		_ = os.RemoveAll(dataDir)
+		return "", nil, err
+	}
+	srv := &http.Server{
+		Handler:           gateway.NewRouter(),
+		ReadHeaderTimeout: 15 * time.Second,
+	}
+	go func() {
+		if err := srv.Serve(ln); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			fmt.Fprintln(os.Stderr, err)
+		}
+	}()
+
+	shutdown := func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		_ = srv.Shutdown(ctx)
+		_ = os.RemoveAll(dataDir)
+	}
+	return "http://" + ln.Addr().String(), shutdown, nil
+}
+
+func buildRequest(opts *options) (string, []byte, error) {
+	const prompt = "Say hello."
+	model := opts.model
+	switch opts.api {
+	case "openai":
+		body := fmt.Sprintf(`{"model":%q,"stream":%v,"messages":[{"role":"user","content":%q}]}`, model, opts.stream, prompt)
+		return "/v1/chat/completions", []byte(body), nil
+	case "claude":
+		body := fmt.Sprintf(`{"model":%q,"stream":%v,"max_tokens":1024,"messages":[{"role":"user","content":%q}]}`, model, opts.stream, prompt)
+		return "/v1/messages", []byte(body), nil
+	case "gemini":
+		body := fmt.Sprintf(`{"contents":[{"role":"user","parts":[{"text":%q}]}]}`, prompt)
+		if opts.stream {
+			return "/v1beta/models/" + model + ":streamGenerateContent?alt=sse", []byte(body), nil
+		}
+		return "/v1beta/models/" + model + ":generateContent", []byte(body), nil
+	default:
+		return "", nil, fmt.Errorf("未知的 -api 取值: %s（可选 openai | claude | gemini）", opts.api)
+	}
+}
+
+func doRequest(client *http.Client, url string, body []byte, opts *options) result {
+	ctx, cancel := context.WithTimeout(context.Background(), opts.timeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return result{err: err}
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if opts.key != "" {
+		req.Header.Set("Authorization", "Bearer "+opts.key)
+	}
+
+	start := time.Now()
+	resp, err := client.Do(req)
+	if err != nil {
+		return result{err: err, duration: time.Since(start)}
+	}
+	defer resp.Body.Close()
+
+	var res result
+	if resp.StatusCode != http.StatusOK {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		res.duration = time.Since(start)
+		res.err = fmt.Errorf("HTTP %d: %s", resp.StatusCode, strings.TrimSpace(string(msg)))
+		return res
+	}
+
+	if !opts.stream {
+		n, err := io.Copy(io.Discard, resp.Body)
+		res.bytes = n
+		res.ttfb = time.Since(start)
+		res.duration = res.ttfb
+		res.err = err
+		return res
+	}
+
+	reader := bufio.NewReaderSize(resp.Body, 32*1024)
+	last := start
+	for {
+		line, err := reader.ReadSlice('\n')
+		res.bytes += int64(len(line))
+		if bytes.HasPrefix(line, []byte("data:")) {
+			now := time.Now()
+			if res.events == 0 {
+				res.ttfb = now.Sub(start)
+			} else if gap := now.Sub(last); gap > res.maxGap {
+				res.maxGap = gap
+			}
+			last = now
+			res.events++
+		}
+		if err != nil {
+			if errors.Is(err, bufio.ErrBufferFull) {
+				continue
+			}
+			if !errors.Is(err, io.EOF) {
+				res.err = err
+			}
+			break
+		}
+	}
+	res.duration = time.Since(start)
+	if res.events == 0 && res.err == nil {
+		res.err = errors.New("未收到任何 SSE 事件")
+	}
+	return res
+}
+
+func report(results []result, elapsed time.Duration, before, after *runtime.MemStats, inProcess bool) {
+	var ok, failed, events int
+	var totalBytes int64
+	ttfbs := make([]time.Duration, 0, len(results))
+	durations := make([]time.Duration, 0, len(results))
+	gaps := make([]time.Duration, 0, len(results))
+	errCounts := make(map[string]int)
+
+	for _, r := range results {
+		if r.err != nil {
+			failed++
+			errCounts[r.err.Error()]++
+			continue
+		}
+		ok++
+		events += r.events
+		totalBytes += r.bytes
+		ttfbs = append(ttfbs, r.ttfb)
+		durations = append(durations, r.duration)
+		gaps = append(gaps, r.maxGap)
+	}
+
+	secs := elapsed.Seconds()
+	fmt.Println()
+	fmt.Printf("总耗时: %v | 成功: %d | 失败: %d\n", elapsed.Round(time.Millisecond), ok, failed)
+	if secs > 0 {
+		fmt.Printf("吞吐: %.1f req/s | %.1f events/s | %.2f MB/s\n",
+			float64(ok)/secs, float64(events)/secs, float64(totalBytes)/secs/1024/1024)
+	}
+	printPercentiles("TTFB", ttfbs)
+	printPercentiles("请求耗时", durations)
+	printPercentiles("最大事件间隔", gaps)
+
+	n := uint64(len(results))
+	allocBytes := after.TotalAlloc - before.TotalAlloc
+	mallocs := after.Mallocs - before.Mallocs
+	label := "客户端"
+	if inProcess {
+		label = "进程内（网关 + stub + 客户端）"
+	}
+	fmt.Printf("内存分配[%s]: 共 %.2f MB / %d 次 | 每请求 %.1f KB / %d 次 | GC %d 次 | HeapInuse %.2f MB\n",
+		label,
+		float64(allocBytes)/1024/1024, mallocs,
+		float64(allocBytes)/float64(n)/1024, mallocs/n,
+		after.NumGC-before.NumGC,
+		float64(after.HeapInuse)/1024/1024)
+
+	if len(errCounts) > 0 {
+		fmt.Println("错误:")
+		msgs := make([]string, 0, len(errCounts))
+		for msg := range errCounts {
+			msgs = append(msgs, msg)
+		}
+		sort.Strings(msgs)
+		for _, msg := range msgs {
+			fmt.Printf("  [%d] %s\n", errCounts[msg], msg)
+		}
+	}
+}
+
+func printPercentiles(name string, values []time.Duration) {
+	if len(values) == 0 {
+		return
+	}
+	sort.Slice(values, func(i, j int) bool { return values[i] < values[j] })
+	pick := func(p float64) time.Duration {
+		idx := int(float64(len(values)-1) * p)
+		return values[idx]
+	}
+	fmt.Printf("%s: p50 %v | p90 %v | p99 %v | max %v\n", name,
+		pick(0.50).Round(time.Microsecond),
+		pick(0.90).Round(time.Microsecond),
+		pick(0.99).Round(time.Microsecond),
+		values[len(values)-1].Round(time.Microsecond))
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// stubTransport 在进程内模拟 Vertex 上游，不经过网络，便于单独测量代理自身的开销。
+type stubTransport struct {
+	chunks     int
+	chunkText  string
+	chunkDelay time.Duration
+}
+
+func (t *stubTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.Body != nil {
+		_, _ = io.Copy(io.Discard, req.Body)
+		_ = req.Body.Close()
+	}
+
+	path := req.URL.Path
+	switch {
+	case strings.HasSuffix(path, ":streamGenerateContent"):
+		return t.streamResponse(req), nil
+	case strings.HasSuffix(path, ":generateContent"):
+		return jsonResponse(req, t.fullResponse()), nil
+	case strings.HasSuffix(path, ":fetchAvailableModels"):
+		return jsonResponse(req, []byte(`{"models":{"stub-model":{}}}`)), nil
+	default:
+		return jsonResponse(req, []byte(`{}`)), nil
+	}
+}
+
+func (t *stubTransport) streamResponse(req *http.Request) *http.Response {
+	pr, pw := io.Pipe()
+	ctx := req.Context()
+
+	go func() {
+		defer pw.Close()
+		chunk := t.textChunk()
+		for i := 0; i < t.chunks; i++ {
+			if t.chunkDelay > 0 {
+				select {
+				case <-ctx.Done():
+					return
+				case <-time.After(t.chunkDelay):
+				}
+			}
+			if _, err := pw.Write(chunk); err != nil {
+				return
+			}
+		}
+		_, _ = pw.Write(t.finishChunk())
+	}()
+
+	h := make(http.Header)
+	h.Set("Content-Type", "text/event-stream")
+	return &http.Response{
+		StatusCode: http.StatusOK,
+		Status:     "200 OK",
+		Proto:      "HTTP/1.1",
+		ProtoMajor: 1,
+		ProtoMinor: 1,
+		Header:     h,
+		Body:       pr,
+		Request:    req,
+	}
+}
+
+func (t *stubTransport) textChunk() []byte {
+	var b bytes.Buffer
+	b.WriteString(`data: {"response":{"candidates":[{"content":{"role":"model","parts":[{"text":`)
+	b.WriteString(strconv.Quote(t.chunkText))
+	b.WriteString(`}]}}]}}`)
+	b.WriteString("\n\n")
+	return b.Bytes()
+}
+
+func (t *stubTransport) finishChunk() []byte {
+	var b bytes.Buffer
+	b.WriteString(`data: {"response":{"candidates":[{"content":{"role":"model","parts":[{"text":""}]},"finishReason":"STOP"}],`)
+	b.WriteString(`"usageMetadata":{"promptTokenCount":8,"candidatesTokenCount":`)
+	b.WriteString(strconv.Itoa(t.chunks))
+	b.WriteString(`,"totalTokenCount":`)
+	b.WriteString(strconv.Itoa(t.chunks + 8))
+	b.WriteString(`}}}`)
+	b.WriteString("\n\n")
+	return b.Bytes()
+}
+
+func (t *stubTransport) fullResponse() []byte {
+	var b bytes.Buffer
+	b.WriteString(`{"response":{"candidates":[{"content":{"role":"model","parts":[{"text":`)
+	b.WriteString(strconv.Quote(strings.Repeat(t.chunkText, t.chunks)))
+	b.WriteString(`}]},"finishReason":"STOP"}],"usageMetadata":{"promptTokenCount":8,"candidatesTokenCount":`)
+	b.WriteString(strconv.Itoa(t.chunks))
+	b.WriteString(`,"totalTokenCount":`)
+	b.WriteString(strconv.Itoa(t.chunks + 8))
+	b.WriteString(`}}}`)
+	return b.Bytes()
+}
+
+func jsonResponse(req *http.Request, body []byte) *http.Response {
+	h := make(http.Header)
+	h.Set("Content-Type", "application/json")
+	return &http.Response{
+		StatusCode:    http.StatusOK,
+		Status:        "200 OK",
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        h,
+		Body:          io.NopCloser(bytes.NewReader(body)),
+		ContentLength: int64(len(body)),
+		Request:       req,
+	}
+}
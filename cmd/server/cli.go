@@ -0,0 +1,358 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"anti2api-golang/refactor/internal/config"
+	"anti2api-golang/refactor/internal/credential"
+	gwcommon "anti2api-golang/refactor/internal/gateway/common"
+	"anti2api-golang/refactor/internal/pkg/modelutil"
+	"anti2api-golang/refactor/internal/storage"
+)
+
+// 子命令直接读写数据目录中的账号文件，便于在无 WebUI 的服务器上通过 SSH 管理。
+// 注意：服务运行中账号保存在内存里，修改账号后需重启服务才会生效（服务保存时也会覆盖文件）。
+const cliUsage = `用法:
+  server                              启动代理服务
+  server accounts list                列出账号
+  server accounts add [-refresh-token T] [-project-id P] [-allow-random-project-id]
+                                      添加账号（不指定 refresh token 时走 OAuth：打开链接授权后粘贴回调 URL）
+  server accounts remove <序号|邮箱>  删除账号（移入回收站）
+  server accounts refresh [序号|邮箱] 刷新指定账号或全部账号的 access token
+  server config check                 检查配置与数据目录
+  server models list                  使用已有账号获取上游模型列表
+  server -service install|uninstall|run
+                                      安装 / 卸载 / 运行系统服务（systemd 或 Windows 服务）
+`
+
+// runCommand 执行子命令；args[0] 不是已知子命令时 handled 为 false，按服务模式启动。
+func runCommand(args []string, stdin io.Reader, stdout io.Writer) (handled bool, code int) {
+	if len(args) == 0 {
+		return false, 0
+	}
+
+	var err error
+	switch args[0] {
+	case "accounts":
+		err = runAccounts(args[1:], stdin, stdout)
+	case "config":
+		err = runConfig(args[1:], stdout)
+	case "models":
+		err = runModels(args[1:], stdout)
+	case "help", "-h", "--help":
+		fmt.Fprint(stdout, cliUsage)
+		return true, 0
+	default:
+		return false, 0
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "错误:", err)
+		return true, 1
+	}
+	return true, 0
+}
+
+var errUsage = errors.New("参数错误，运行 server help 查看用法")
+
+func runAccounts(args []string, stdin io.Reader, stdout io.Writer) error {
+	if len(args) == 0 {
+		return errUsage
+	}
+	store := credential.GetStore()
+
+	switch args[0] {
+	case "list":
+		printAccounts(stdout, store.GetAll())
+		return nil
+
+	case "add":
+		fs := flag.NewFlagSet("accounts add", flag.ContinueOnError)
+		refreshToken := fs.String("refresh-token", "", "已有的 refresh token")
+		projectID := fs.String("project-id", "", "自定义 Google 项目 ID")
+		allowRandom := fs.Bool("allow-random-project-id", false, "无法自动获取项目 ID 时使用随机项目 ID")
+		if err := fs.Parse(args[1:]); err != nil {
+			return errUsage
+		}
+		account, err := cliNewAccount(strings.TrimSpace(*refreshToken), stdin, stdout)
+		if err != nil {
+			return err
+		}
+		account.ProjectID = strings.TrimSpace(*projectID)
+		if account.ProjectID == "" {
+			if pid, err := credential.FetchProjectID(account.AccessToken); err == nil {
+				account.ProjectID = strings.TrimSpace(pid)
+			}
+		}
+		if account.ProjectID == "" && !*allowRandom {
+			return errors.New("无法自动获取 Google 项目 ID，请使用 -project-id 指定，或加上 -allow-random-project-id")
+		}
+		if err := store.Add(*account); err != nil {
+			return fmt.Errorf("保存账号失败: %w", err)
+		}
+		fmt.Fprintf(stdout, "已添加账号 %s\n", orDash(account.Email))
+		return nil
+
+	case "remove":
+		if len(args) != 2 {
+			return errUsage
+		}
+		idx, err := resolveAccount(store.GetAll(), args[1])
+		if err != nil {
+			return err
+		}
+		email := store.GetAll()[idx].Email
+		if err := store.Delete(idx); err != nil {
+			return err
+		}
+		fmt.Fprintf(stdout, "已将账号 %s 移入回收站\n", orDash(email))
+		return nil
+
+	case "refresh":
+		if len(args) == 1 {
+			success, failed := store.RefreshAll()
+			fmt.Fprintf(stdout, "刷新完成：成功 %d，失败 %d\n", success, failed)
+			if failed > 0 {
+				return fmt.Errorf("%d 个账号刷新失败", failed)
+			}
+			return nil
+		}
+		idx, err := resolveAccount(store.GetAll(), args[1])
+		if err != nil {
+			return err
+		}
+		if err := store.RefreshAccount(idx); err != nil {
+			return err
+		}
+		fmt.Fprintf(stdout, "已刷新账号 %s\n", orDash(store.GetAll()[idx].Email))
+		return nil
+	}
+	return errUsage
+}
+
+// cliNewAccount 使用 refresh token 或交互式 OAuth 获取新账号的 token 与邮箱。
+func cliNewAccount(refreshToken string, stdin io.Reader, stdout io.Writer) (*credential.Account, error) {
+	now := time.Now()
+	account := &credential.Account{Enable: true, CreatedAt: now}
+
+	if refreshToken != "" {
+		account.RefreshToken = refreshToken
+		if err := credential.RefreshToken(account); err != nil {
+			return nil, err
+		}
+	} else {
+		state, err := credential.GenerateState()
+		if err != nil {
+			return nil, err
+		}
+		redirectURI := fmt.Sprintf("http://localhost:%d/oauth-callback", config.Get().Port)
+		fmt.Fprintln(stdout, "请在浏览器中打开以下链接完成 Google 授权：")
+		fmt.Fprintln(stdout, credential.BuildAuthURL(redirectURI, state))
+		fmt.Fprint(stdout, "授权后将浏览器地址栏中的完整回调 URL 粘贴到这里: ")
+
+		line, err := bufio.NewReader(stdin).ReadString('\n')
+		if err != nil && strings.TrimSpace(line) == "" {
+			return nil, errors.New("未读取到回调 URL")
+		}
+		code, gotState, err := credential.ParseOAuthURL(strings.TrimSpace(line))
+		if err != nil {
+			return nil, err
+		}
+		if !credential.ValidateState(gotState) {
+			return nil, errors.New("state 校验失败或已过期，请重新执行")
+		}
+		tokenResp, err := credential.ExchangeCodeForToken(code, redirectURI)
+		if err != nil {
+			return nil, err
+		}
+		account.AccessToken = tokenResp.AccessToken
+		account.RefreshToken = tokenResp.RefreshToken
+		account.ExpiresIn = tokenResp.ExpiresIn
+		account.Timestamp = now.UnixMilli()
+	}
+
+	if ui, err := credential.GetUserInfo(account.AccessToken); err == nil && ui != nil {
+		account.Email = strings.TrimSpace(ui.Email)
+	}
+	return account, nil
+}
+
+// resolveAccount 按 list 输出的序号（从 1 开始）或邮箱查找账号。
+func resolveAccount(accounts []credential.Account, ref string) (int, error) {
+	ref = strings.TrimSpace(ref)
+	if n, err := strconv.Atoi(ref); err == nil {
+		if n < 1 || n > len(accounts) {
+			return -1, fmt.Errorf("序号 %d 超出范围（共 %d 个账号）", n, len(accounts))
+		}
+		return n - 1, nil
+	}
+	for i, acc := range accounts {
+		if strings.EqualFold(acc.Email, ref) {
+			return i, nil
+		}
+	}
+	return -1, fmt.Errorf("未找到账号: %s", ref)
+}
+
+func printAccounts(w io.Writer, accounts []credential.Account) {
+	if len(accounts) == 0 {
+		fmt.Fprintln(w, "没有账号")
+		return
+	}
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "#\t邮箱\t项目ID\t状态\t添加时间")
+	now := time.Now().UnixMilli()
+	for i, acc := range accounts {
+		status := "正常"
+		if !acc.Enable {
+			status = "已禁用"
+		} else if acc.IsExpired(now) {
+			status = "已过期"
+		}
+		created := "-"
+		if !acc.CreatedAt.IsZero() {
+			created = acc.CreatedAt.Local().Format("2006-01-02 15:04")
+		}
+		fmt.Fprintf(tw, "%d\t%s\t%s\t%s\t%s\n", i+1, orDash(acc.Email), orDash(acc.ProjectID), status, created)
+	}
+	_ = tw.Flush()
+}
+
+func runConfig(args []string, stdout io.Writer) error {
+	if len(args) != 1 || args[0] != "check" {
+		return errUsage
+	}
+
+	problems := 0
+	report := func(ok bool, format string, a ...any) {
+		mark := "OK  "
+		if !ok {
+			mark = "WARN"
+			problems++
+		}
+		fmt.Fprintf(stdout, "[%s] %s\n", mark, fmt.Sprintf(format, a...))
+	}
+
+	cfg := config.Get()
+	if path, ok := config.DotEnvPath(); ok {
+		report(true, ".env: %s", path)
+	} else {
+		report(true, ".env: 未找到，仅使用环境变量")
+	}
+	report(true, "settings.json: %s", config.SettingsPath())
+	report(cfg.Port > 0 && cfg.Port < 65536, "PORT=%d", cfg.Port)
+	report(isValidEndpointMode(cfg.EndpointMode), "ENDPOINT_MODE=%s", cfg.EndpointMode)
+	report(cfg.AdminPassword != "", "WEBUI_PASSWORD %s", setOrNot(cfg.AdminPassword))
+	report(cfg.APIKey != "", "API_KEY %s", setOrNot(cfg.APIKey))
+
+	if err := checkWritableDir(cfg.DataDir); err != nil {
+		report(false, "DATA_DIR=%s 不可写: %v", cfg.DataDir, err)
+	} else {
+		report(true, "DATA_DIR=%s 可写", cfg.DataDir)
+	}
+
+	if problem := storage.ConfigProblem(); problem != "" {
+		report(false, "%s", problem)
+	} else {
+		report(true, "STORAGE_BACKEND=%s", cfg.StorageBackend)
+	}
+
+	accounts := credential.GetStore().GetAll()
+	enabled := 0
+	for _, acc := range accounts {
+		if acc.Enable {
+			enabled++
+		}
+	}
+	report(enabled > 0, "账号：共 %d 个，启用 %d 个", len(accounts), enabled)
+
+	for _, problem := range modelutil.ValidateVirtualModels() {
+		report(false, "VIRTUAL_MODELS: %s", problem)
+	}
+	if n := len(cfg.VirtualModels); n > 0 {
+		report(true, "VIRTUAL_MODELS: 共 %d 个自定义虚拟模型", n)
+	}
+	for _, problem := range modelutil.ValidateAPIKeyPresets() {
+		report(false, "API_KEY_PRESETS: %s", problem)
+	}
+
+	if problems > 0 {
+		return fmt.Errorf("发现 %d 个问题", problems)
+	}
+	return nil
+}
+
+func runModels(args []string, stdout io.Writer) error {
+	if len(args) != 1 || args[0] != "list" {
+		return errUsage
+	}
+	if credential.GetStore().EnabledCount() == 0 {
+		return errors.New("没有可用账号，请先执行 server accounts add")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 60*time.Second)
+	defer cancel()
+	vm, err := gwcommon.FetchAvailableModels(ctx)
+	if err != nil {
+		return fmt.Errorf("获取模型列表失败: %w", err)
+	}
+
+	tw := tabwriter.NewWriter(stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "模型\t上下文\t最大输出\tthinking")
+	for _, mid := range modelutil.BuildSortedModelIDs(vm.Models) {
+		caps := modelutil.CapabilitiesFor(mid, modelutil.UpstreamModelInfo(vm.Models, mid))
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%v\n", mid, intOrDash(caps.ContextWindow), intOrDash(caps.MaxOutputTokens), caps.SupportsThinking)
+	}
+	return tw.Flush()
+}
+
+func isValidEndpointMode(mode string) bool {
+	if _, ok := config.APIEndpoints[mode]; ok {
+		return true
+	}
+	return mode == "round-robin" || mode == "round-robin-dp"
+}
+
+func checkWritableDir(dir string) error {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return err
+	}
+	f, err := os.CreateTemp(dir, ".check-*")
+	if err != nil {
+		return err
+	}
+	name := f.Name()
+	_ = f.Close()
+	return os.Remove(filepath.Clean(name))
+}
+
+func setOrNot(v string) string {
+	if v == "" {
+		return "未设置"
+	}
+	return "已设置"
+}
+
+func orDash(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
+
+func intOrDash(n int) string {
+	if n <= 0 {
+		return "-"
+	}
+	return strconv.Itoa(n)
+}
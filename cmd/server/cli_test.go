@@ -0,0 +1,50 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"anti2api-golang/refactor/internal/credential"
+)
+
+func TestRunCommand_NotHandled(t *testing.T) {
+	for _, args := range [][]string{nil, {"-debug", "high"}} {
+		if handled, _ := runCommand(args, nil, &bytes.Buffer{}); handled {
+			t.Fatalf("expected %v to start the server", args)
+		}
+	}
+}
+
+func TestRunCommand_Help(t *testing.T) {
+	var out bytes.Buffer
+	handled, code := runCommand([]string{"help"}, nil, &out)
+	if !handled || code != 0 || !strings.Contains(out.String(), "accounts list") {
+		t.Fatalf("unexpected help result: handled=%v code=%d out=%q", handled, code, out.String())
+	}
+}
+
+func TestResolveAccount(t *testing.T) {
+	accounts := []credential.Account{{Email: "a@example.com"}, {Email: "B@example.com"}}
+
+	if idx, err := resolveAccount(accounts, "2"); err != nil || idx != 1 {
+		t.Fatalf("index lookup: idx=%d err=%v", idx, err)
+	}
+	if idx, err := resolveAccount(accounts, "b@example.com"); err != nil || idx != 1 {
+		t.Fatalf("email lookup: idx=%d err=%v", idx, err)
+	}
+	if _, err := resolveAccount(accounts, "3"); err == nil {
+		t.Fatalf("expected out of range error")
+	}
+	if _, err := resolveAccount(accounts, "c@example.com"); err == nil {
+		t.Fatalf("expected not found error")
+	}
+}
+
+func TestPrintAccounts(t *testing.T) {
+	var out bytes.Buffer
+	printAccounts(&out, []credential.Account{{Email: "a@example.com", Enable: false}})
+	if !strings.Contains(out.String(), "a@example.com") || !strings.Contains(out.String(), "已禁用") {
+		t.Fatalf("unexpected output: %q", out.String())
+	}
+}
@@ -15,7 +15,14 @@ import (
 	"anti2api-golang/refactor/internal/config"
 	"anti2api-golang/refactor/internal/credential"
 	"anti2api-golang/refactor/internal/gateway"
+	"anti2api-golang/refactor/internal/gateway/manager"
+	"anti2api-golang/refactor/internal/journal"
 	"anti2api-golang/refactor/internal/logger"
+	"anti2api-golang/refactor/internal/pkg/modelutil"
+	"anti2api-golang/refactor/internal/reaper"
+	"anti2api-golang/refactor/internal/session"
+	"anti2api-golang/refactor/internal/signature"
+	"anti2api-golang/refactor/internal/storage"
 )
 
 func init() {
@@ -25,6 +32,21 @@ func init() {
 }
 
 func main() {
+	// -service 需在加载配置之前处理：以服务方式运行时先切换工作目录并重定向日志。
+	if len(os.Args) > 1 && os.Args[1] == "-service" {
+		os.Exit(runService(os.Args[2:]))
+	}
+	if handled, code := runCommand(os.Args[1:], os.Stdin, os.Stdout); handled {
+		os.Exit(code)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+	serve(ctx)
+}
+
+// serve 启动代理服务，阻塞直到 ctx 结束后优雅关闭。
+func serve(ctx context.Context) {
 	cfg := config.Get()
 
 	// 启动内存归还协程：每 30 秒将空闲内存归还给操作系统
@@ -37,9 +59,36 @@ func main() {
 	}()
 
 	logger.Init()
+	if err := config.CheckDataDirWritable(); err != nil {
+		logger.Warn("数据目录 %s 不可写（%v），以只读模式运行：签名仅保存在内存中，管理面板的设置修改重启后丢失", cfg.DataDir, err)
+	}
+	if problem := storage.ConfigProblem(); problem != "" {
+		logger.Warn("%s", problem)
+	}
+	if migrated, err := config.MigrateDotEnvSettings(); err != nil {
+		logger.Warn("迁移 .env 中的 WebUI 设置失败: %v", err)
+	} else if migrated {
+		logger.Info("已将 .env 中的 WebUI 设置迁移到 %s，之后以该文件为准（.env 未修改）", config.SettingsPath())
+	}
+	journal.Boot()
 	_ = credential.GetStore()
 	credential.StartAutoRefresh()
+	manager.StartQuotaScheduler()
+	reaper.Register("sessions", session.GetStore().Prune)
+	reaper.Register("signatureHot", signature.ReapStale)
+	reaper.Register("signatureTenants", signature.ReapIdleTenants)
+	reaper.Register("loginAttempts", manager.ReapLoginAttempts)
+	reaper.Start(time.Duration(cfg.ReaperIntervalSeconds) * time.Second)
 	logger.Banner(cfg.Port, cfg.EndpointMode)
+	if manager.SetupRequired() {
+		logger.Warn("首次运行：请在浏览器打开 http://localhost:%d/setup 设置管理密码并添加账号", cfg.Port)
+	}
+	for _, problem := range modelutil.ValidateVirtualModels() {
+		logger.Warn("%s", problem)
+	}
+	for _, problem := range modelutil.ValidateAPIKeyPresets() {
+		logger.Warn("%s", problem)
+	}
 
 	mux := gateway.NewRouter()
 
@@ -68,14 +117,12 @@ func main() {
 		}
 	}()
 
-	stop := make(chan os.Signal, 1)
-	signal.Notify(stop, syscall.SIGINT, syscall.SIGTERM)
-	<-stop
+	<-ctx.Done()
 	logger.Info("Shutting down server...")
 
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
-	if err := srv.Shutdown(ctx); err != nil && !errors.Is(err, context.Canceled) {
+	if err := srv.Shutdown(shutdownCtx); err != nil && !errors.Is(err, context.Canceled) {
 		_, _ = fmt.Fprintln(os.Stderr, err)
 	}
 	logger.Info("Server stopped")
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"anti2api-golang/refactor/internal/service"
+)
+
+const serviceUsage = `用法:
+  server -service install    安装为系统服务（开机自启并立即启动，需要 root / 管理员权限）
+  server -service uninstall  停止并卸载系统服务（保留数据目录）
+  server -service run        以服务方式运行（由 systemd / Windows 服务管理器调用）
+`
+
+// runService 处理 -service 参数，返回进程退出码。
+func runService(args []string) int {
+	if len(args) != 1 {
+		fmt.Fprint(os.Stderr, serviceUsage)
+		return 2
+	}
+
+	var err error
+	switch args[0] {
+	case "install":
+		if err = service.Install(); err == nil {
+			dataDir := service.DataDir
+			if dataDir == "" {
+				dataDir = "可执行文件所在目录下的 data"
+			}
+			fmt.Printf("服务 %s 已安装并启动\n数据目录: %s\n日志: %s\n", service.Name, dataDir, service.LogHint)
+		}
+	case "uninstall":
+		if err = service.Uninstall(); err == nil {
+			fmt.Printf("服务 %s 已卸载\n", service.Name)
+		}
+	case "run":
+		err = service.Run(serve)
+	default:
+		fmt.Fprint(os.Stderr, serviceUsage)
+		return 2
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "错误:", err)
+		return 1
+	}
+	return 0
+}
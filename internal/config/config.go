@@ -1,12 +1,16 @@
 package config
 
 import (
+	"net"
 	"os"
 	"strconv"
 	"strings"
 	"sync"
 )
 
+// DefaultOAuthTokenURL 为 Google 官方的 OAuth token 端点。
+const DefaultOAuthTokenURL = "https://oauth2.googleapis.com/token"
+
 type Config struct {
 	Host string
 	Port int
@@ -14,8 +18,61 @@ type Config struct {
 	UserAgent string
 	TimeoutMs int
 	Proxy     string
+	// UpstreamTLSProfile 为上游连接的 TLS 参数预设（go / h2 / h2-p521 / tls13，见 vertex/tls_profile.go），空为 Go 默认。
+	UpstreamTLSProfile string
+	// HostOverrides 为上游主机名到固定 IP 的静态映射（主机名小写），优先于 DNSOverHTTPS。
+	HostOverrides map[string][]string
+	// DNSOverHTTPS 为解析上游主机名使用的 DoH 地址（JSON 格式，例如 https://1.1.1.1/dns-query），为空使用系统 DNS。
+	DNSOverHTTPS string
+	// ReaperIntervalSeconds 为后台资源回收（过期会话、不可达的签名热条目、空闲的租户签名管理器等，见 internal/reaper）的间隔（秒），0 表示关闭。
+	ReaperIntervalSeconds int
+	// ChaosErrorPercent / ChaosLatencyPercent / ChaosTruncatePercent 为故障注入概率（0-100，见 vertex/chaos.go）：
+	// 上游请求直接返回 429 / 500、先等待随机时长（不超过 ChaosLatencyMs）、流式响应中途断开；均为 0 时关闭。
+	ChaosErrorPercent    int
+	ChaosLatencyPercent  int
+	ChaosLatencyMs       int
+	ChaosTruncatePercent int
+	// VertexWireFormat 为 Cloud Code 请求/响应的外层格式（见 vertex/wire_format.go），默认 v1internal。
+	VertexWireFormat string
+	// OAuthTokenURLs 为 OAuth token 端点（交换 / 刷新），按顺序尝试，端点不可用时切换到下一个。
+	OAuthTokenURLs []string
+	// OAuthProxy 为凭证相关请求（token、用户信息、项目发现）使用的代理，为空沿用 Proxy，"direct" 表示直连。
+	OAuthProxy string
+	// SettingsWriteDotEnv 开启后管理面板保存设置时除 settings.json 外同时写回 .env（旧版行为）。
+	SettingsWriteDotEnv bool
+	// SSEFlushIntervalMs 为流式响应的最短刷新间隔（毫秒）：间隔内的多次刷新合并为一次，0 表示每个分片都立即刷新。
+	SSEFlushIntervalMs int
+	// ClaudePingSeconds 为 Claude 流式响应等待上游期间发送 ping 事件的间隔（秒），0 表示不发送。
+	ClaudePingSeconds int
+	// MaxInFlightStream / MaxInFlightNonStream 为同时处理的流式 / 非流式生成请求上限，超出时返回 503 与 Retry-After；<=0 表示不限制。
+	MaxInFlightStream    int
+	MaxInFlightNonStream int
+	// ShedRetryAfterSeconds 为拒绝请求时 Retry-After 头的秒数。
+	ShedRetryAfterSeconds int
+	// MaxGzipBodyBytes 限制 Content-Encoding: gzip 请求体解压后的最大字节数（防止压缩炸弹），<=0 表示不限制。
+	MaxGzipBodyBytes int
+	// SpoolBodyBytes 为请求体落盘阈值：超过该字节数的请求体写入临时文件并以 mmap 读取，不占用 Go 堆；<=0 表示不落盘。
+	SpoolBodyBytes int
+	// SpoolDir 为请求体临时文件目录，为空时使用 DataDir/spool（避免写入可能位于内存中的 /tmp；DataDir 只读时退回系统临时目录）。
+	SpoolDir string
 
 	APIKey string
+	// HMACSecret 非空时允许客户端用 HMAC 请求签名代替 API Key（见 middleware/hmac.go），HMACMaxSkewSeconds 为允许的时间偏差。
+	HMACSecret         string
+	HMACMaxSkewSeconds int
+	// HMACKeyIDs 为签名 key ID（X-Signature-Key 请求头）到 API Key 的映射：此类请求以该 API Key 为签名密钥，并按该 Key 的
+	// 接口族、租户与预设处理。仅用 HMAC_SECRET 签名的请求不限接口族、属于默认租户。
+	HMACKeyIDs map[string]string
+	// HMACMaxBodyBytes 为 HMAC 签名请求的请求体上限：签名校验前需读取整个请求体，超过后直接返回 413，<=0 表示不限制。
+	HMACMaxBodyBytes int
+	// APIKeyScopes 为限定访问范围的附加 API Key（key -> 允许的接口族，如 openai / claude / gemini / models / sessions / *）。
+	APIKeyScopes map[string][]string
+	// APIKeyPresets 为按 API Key 配置的默认模型与生成参数（API_KEY_PRESETS，key 为客户端 API Key）。
+	APIKeyPresets map[string]APIKeyPreset
+	// Tenants 为 API Key 到租户名的映射（TENANTS）：签名缓存、会话记录与用量统计按租户隔离，未列出的 Key 属于默认租户。
+	Tenants map[string]string
+	// StatusPage 开启后公开 /status（无需鉴权），只展示整体可用性与模型列表的更新时间，不含账号信息。
+	StatusPage bool
 
 	RetryStatusCodes []int
 	RetryMaxAttempts int
@@ -30,6 +87,149 @@ type Config struct {
 	DataDir                string
 	AdminPassword          string
 	Gemini3MediaResolution string
+
+	// StorageBackend 为存储后端：file（默认，JSON / JSONL 文件）或 sqlite（DataDir/data.db，需以 -tags sqlite 构建）。
+	StorageBackend string
+
+	// ToolResultMaxBytes 限制单个工具结果（OpenAI tool 消息 / Claude tool_result）的最大字节数，0 表示不限制。
+	ToolResultMaxBytes int
+	// StructuredToolResults 为 true 时，内容为 JSON 对象 / 数组的工具结果以结构化数据发送给上游，而不是包成 {"output": "<文本>"}。
+	StructuredToolResults bool
+	// ToolResultRefBytes 大于 0 时，超过该字节数的工具结果保存在服务端，上游提示中只保留引用与摘要，
+	// 并自动注入 fetch_tool_result 工具供模型按需读取（见 gwcommon.ReferenceToolResults）；0 表示关闭。
+	ToolResultRefBytes int
+
+	// ImageDownscale 开启后转发前缩小并重新压缩请求中的 PNG / JPEG 图片（见 pkg/imagescale）。
+	ImageDownscale bool
+	// ImageMaxDimension 为图片最长边的像素上限，0 表示按模型与 mediaResolution 自动选择。
+	ImageMaxDimension int
+	// ImageJPEGQuality 为重新压缩时的 JPEG 质量（1-100）。
+	ImageJPEGQuality int
+
+	// ModelFallbacks 为模型降级链（key 为小写模型名），主模型返回 404/429 或上游容量不足时依次尝试。
+	ModelFallbacks map[string][]string
+
+	// VirtualModels 为运维自定义的虚拟模型（VIRTUAL_MODELS），映射到后端模型并强制覆盖部分 generationConfig。
+	VirtualModels []VirtualModel
+	// EchoBackendModel 开启后响应体中的 model 字段回显后端模型 id 而非客户端请求的（虚拟）模型名；
+	// 后端模型 id 总是通过 X-Backend-Model 响应头返回。
+	EchoBackendModel bool
+
+	// TranscriptEnabled 开启后将完整会话（客户端请求 + Vertex 请求/响应）写入 data/transcripts。
+	TranscriptEnabled bool
+	// TranscriptRetentionDays 为会话记录的保留天数，TranscriptMaxBytes 为会话记录的总大小上限（JSONL 按天文件、SQLite 按记录从最旧的开始删除）；默认 0（不限制、不删除）。
+	TranscriptRetentionDays int
+	TranscriptMaxBytes      int
+	// JournalEnabled 开启后将每个请求的开始/结束（模型、账号、状态）逐行追加到 data/journal，用于崩溃/OOM 后排查；
+	// 文件超过 JournalMaxBytes 后轮转为 .1。
+	JournalEnabled  bool
+	JournalMaxBytes int
+
+	// PIIScrub 为转发前需要脱敏的内置类别（email / phone），响应中的占位符会被还原。
+	PIIScrub []string
+	// PIIScrubPatterns 为自定义脱敏正则（PII_SCRUB_PATTERNS 中用 ;; 分隔）。
+	PIIScrubPatterns []string
+
+	// HookWebhookURL 为请求钩子 Webhook 地址，为空表示不启用（参见 internal/hooks）。
+	HookWebhookURL        string
+	HookWebhookTimeoutMs  int
+	HookWebhookFailClosed bool
+
+	// ClaudeThinkingLenient 为兼容开关：开启后不校验 Claude thinking.budget_tokens，并沿用旧的预算静默修正行为。
+	ClaudeThinkingLenient bool
+	// ClaudeServerToolBlocks 控制 Claude 服务端工具（code_execution、web_search 等）的处理方式：
+	// text（默认，历史中的结果块转为带标记的文本，工具定义忽略）、reject（返回 400 并说明不支持的块类型）。
+	ClaudeServerToolBlocks string
+	// ClaudeWebSearch 开启 Claude web_search 服务端工具的模拟（见 claude.webSearchTool）：空或 off（默认，按 ClaudeServerToolBlocks 处理）、
+	// google（用 Gemini googleSearch grounding 检索）或 http(s) 地址（SearXNG 兼容的 JSON 搜索接口）。
+	ClaudeWebSearch string
+	// WebSearchAPIKey 非空时作为 Bearer 令牌发送给 ClaudeWebSearch 配置的搜索接口。
+	WebSearchAPIKey string
+	// WebSearchModel 为 google 模式下执行 grounding 检索的模型。
+	WebSearchModel string
+	// ModerationModel 为 /v1/moderations 用于安全分类的模型（请求中的 model 为 OpenAI 审核模型名时使用）。
+	ModerationModel string
+	// ClineCompatKeys 为启用 Cline / Roo-Code 兼容模式的 API Key（也可按请求发送 X-Compat-Mode: cline）。
+	ClineCompatKeys []string
+	// NoSystemInjectionKeys 为默认跳过 Antigravity agent 系统提示词注入的 API Key（也可按请求发送 X-No-System-Injection: 1）。
+	NoSystemInjectionKeys []string
+	// ClaudeCodeCompat 控制 Claude Code 兼容模式：auto（按 User-Agent / anthropic-beta 识别）、on、off。
+	ClaudeCodeCompat string
+	// AnthropicVersionStrict 开启后拒绝未知的 anthropic-version（返回 400 并列出支持的版本）；默认按最接近的已知版本处理。
+	AnthropicVersionStrict bool
+	// OpenAIPredictionHint 开启后将 OpenAI prediction（Predicted Outputs）内容作为参考写入系统指令；默认接受但忽略。
+	OpenAIPredictionHint bool
+	// MaxThinkingSeconds / MaxThinkingTokens 为流式请求在没有任何可见输出时允许的最长思考时间（秒）与思考 token 数，
+	// 超过后中止生成并返回错误；<=0 表示不限制。
+	MaxThinkingSeconds int
+	MaxThinkingTokens  int
+	// MaxStreamOutputBytes / MaxStreamOutputTokens 为单个流式请求允许的最大输出（字节数 / token 数），
+	// 超过后截断流并以 length / max_tokens 结束；<=0 表示不限制。字节上限同时约束合并日志的累积大小。
+	MaxStreamOutputBytes  int
+	MaxStreamOutputTokens int
+	// MaxTools 为单个请求去重后允许的工具声明数量上限，<=0 表示不限制。
+	MaxTools int
+	// MaxTurns 为单个请求允许的对话轮次（转换后的 contents 条目数）上限，超过时返回 400；<=0 表示不限制。
+	MaxTurns int
+	// MergeToolDeclarations 开启后将所有 functionDeclarations 合并到一个 tools 条目中发送。
+	MergeToolDeclarations bool
+	// Gemini3ThinkingLevels 为 Gemini 3（非 Flash）后端支持的 thinkingLevel（小写），reasoning_effort 映射到其中不低于请求强度的最低等级。
+	Gemini3ThinkingLevels []string
+
+	// SystemInstructionRole 控制 systemInstruction.role：user（默认）、keep（保留客户端 role）、none（不写出）。
+	SystemInstructionRole string
+
+	// SecondaryBackendURL 为备用 OpenAI 兼容后端（例如本地 vLLM）的 base URL，Cloud Code 不可用时按模型前缀降级到该后端。
+	SecondaryBackendURL    string
+	SecondaryBackendAPIKey string
+	// SecondaryBackendModels 为模型前缀（小写）到备用后端模型名的映射，目标为空表示沿用请求的模型名。
+	SecondaryBackendModels map[string]string
+
+	// StreamTeeEnabled 在 DEBUG=high 时把上游原始 SSE 字节按请求写入 data/stream_tee（单文件上限 StreamTeeMaxBytes，最多保留 StreamTeeMaxFiles 个）。
+	StreamTeeEnabled  bool
+	StreamTeeMaxBytes int
+	StreamTeeMaxFiles int
+	// UpstreamHeaders 为透传给客户端（加 X-Upstream- 前缀）并写入日志的上游响应头（小写），为空表示不透传。
+	UpstreamHeaders []string
+	// LogRedactParams 为写入日志前替换为 *** 的查询参数名（小写），用于隐藏 ?key= 等随 URL 传递的密钥。
+	LogRedactParams []string
+
+	// SessionTTLSeconds 为通过 /v1/sessions 创建的会话的默认有效期（每次使用后顺延）。
+	SessionTTLSeconds int
+	// SessionStrict 开启后 X-Session-ID 必须是已创建且未过期的会话。
+	SessionStrict bool
+
+	// QuotaRefreshIntervalMinutes 为后台定时刷新各账号配额的间隔（分钟），<=0 表示关闭。
+	QuotaRefreshIntervalMinutes int
+	// QuotaLowThresholdPercent 为配额剩余百分比阈值：账号所有模型组的剩余配额都不高于该值时，轮询中排到最后使用（<=0 表示不调整顺序）。
+	QuotaLowThresholdPercent int
+	// QuotaHeaders 开启后在生成响应中返回服务账号的剩余配额（X-RateLimit-Remaining-Fraction / X-Quota-Group / X-Quota-Reset）。
+	QuotaHeaders bool
+	// QuotaFetchConcurrency / QuotaFetchTimeoutSeconds 为获取账号配额的全局并发上限与单个账号的超时；
+	// QuotaCacheTTLSeconds 为配额缓存有效期；QuotaPageWaitSeconds 为「刷新全部配额」最多等待的时间，超时的账号先返回「获取中」，后台完成后写入缓存。
+	QuotaFetchConcurrency    int
+	QuotaFetchTimeoutSeconds int
+	QuotaCacheTTLSeconds     int
+	QuotaPageWaitSeconds     int
+	// ModelAvailabilityMinutes 为账号模型可用性（取自配额快照中的模型列表）的有效期：期内选择账号时跳过不提供所请求模型的账号，0 表示不过滤。
+	ModelAvailabilityMinutes int
+	// ImageAccounts 为专用于图像模型的账号（邮箱或 projectId，小写）：非空时图像请求只使用这些账号，文本请求不会使用它们；
+	// 这些账号当天都达到每日用量上限时，图像请求回退到普通账号。
+	ImageAccounts []string
+	// AccountDailyRequestCap / AccountDailyTokenCap 为每个账号每天（UTC+8 自然日）的请求数 / token 数上限，
+	// 达到后该账号在次日 0 点前不再被轮询使用；账号可在管理面板单独设置。<=0 表示不限制。
+	AccountDailyRequestCap int
+	AccountDailyTokenCap   int
+
+	// LoginMaxFailures 为同一 IP 连续登录失败多少次后开始锁定；锁定时长从 LoginLockoutSeconds 起每次失败翻倍（最长 1 小时）。
+	LoginMaxFailures    int
+	LoginLockoutSeconds int
+	// LoginAlertWebhookURL 非空时，登录锁定触发后向该地址 POST JSON 告警。
+	LoginAlertWebhookURL string
+	// AccountAlertWebhookURL 非空时，账号被自动禁用后向该地址 POST JSON 告警；未设置时沿用 LoginAlertWebhookURL。
+	AccountAlertWebhookURL string
+	// TrustProxyHeaders 开启后从 X-Forwarded-For（最右侧，即可信代理追加的地址）/ X-Real-IP 获取客户端 IP（仅在可信反向代理之后开启）。
+	TrustProxyHeaders bool
 }
 
 var (
@@ -53,8 +253,36 @@ func Load() *Config {
 			Port:                   port,
 			UserAgent:              getEnv("API_USER_AGENT", "antigravity/1.11.3 windows/amd64"),
 			TimeoutMs:              getEnvInt("TIMEOUT", 180000),
+			UpstreamTLSProfile:     getEnv("UPSTREAM_TLS_PROFILE", ""),
+			HostOverrides:          parseHostOverrides(getEnv("HOST_OVERRIDES", "")),
+			DNSOverHTTPS:           getEnv("DNS_OVER_HTTPS", ""),
+			VertexWireFormat:       getEnv("VERTEX_WIRE_FORMAT", "v1internal"),
+			ReaperIntervalSeconds:  getEnvInt("REAPER_INTERVAL_SECONDS", 300),
+			ChaosErrorPercent:      getEnvInt("CHAOS_ERROR_PERCENT", 0),
+			ChaosLatencyPercent:    getEnvInt("CHAOS_LATENCY_PERCENT", 0),
+			ChaosLatencyMs:         getEnvInt("CHAOS_LATENCY_MS", 3000),
+			ChaosTruncatePercent:   getEnvInt("CHAOS_TRUNCATE_PERCENT", 0),
+			OAuthTokenURLs:         splitNonEmpty(getEnv("OAUTH_TOKEN_URLS", DefaultOAuthTokenURL), ","),
+			OAuthProxy:             getEnv("OAUTH_PROXY", ""),
+			SettingsWriteDotEnv:    getEnvBool("SETTINGS_WRITE_DOTENV", false),
+			SSEFlushIntervalMs:     getEnvInt("SSE_FLUSH_INTERVAL_MS", 0),
+			ClaudePingSeconds:      getEnvInt("CLAUDE_PING_INTERVAL_SECONDS", 10),
+			MaxInFlightStream:      getEnvInt("MAX_INFLIGHT_STREAM", 0),
+			MaxInFlightNonStream:   getEnvInt("MAX_INFLIGHT_NONSTREAM", 0),
+			ShedRetryAfterSeconds:  getEnvInt("SHED_RETRY_AFTER_SECONDS", 5),
+			MaxGzipBodyBytes:       getEnvInt("MAX_DECOMPRESSED_BODY_BYTES", 100*1024*1024),
+			SpoolBodyBytes:         getEnvInt("REQUEST_SPOOL_BYTES", 20*1024*1024),
+			SpoolDir:               getEnv("REQUEST_SPOOL_DIR", ""),
 			Proxy:                  getEnv("PROXY", ""),
 			APIKey:                 getEnv("API_KEY", ""),
+			APIKeyScopes:           parseAPIKeyScopes(getEnv("API_KEYS", "")),
+			APIKeyPresets:          parseAPIKeyPresets(getEnv("API_KEY_PRESETS", "")),
+			Tenants:                parseTenants(getEnv("TENANTS", "")),
+			HMACSecret:             getEnv("HMAC_SECRET", ""),
+			HMACMaxSkewSeconds:     getEnvInt("HMAC_MAX_SKEW_SECONDS", 300),
+			HMACKeyIDs:             parseHMACKeyIDs(getEnv("HMAC_KEY_IDS", "")),
+			HMACMaxBodyBytes:       getEnvInt("HMAC_MAX_BODY_BYTES", 64*1024*1024),
+			StatusPage:             getEnvBool("STATUS_PAGE", false),
 			RetryStatusCodes:       getEnvIntSlice("RETRY_STATUS_CODES", []int{429, 500}),
 			RetryMaxAttempts:       getEnvInt("RETRY_MAX_ATTEMPTS", 3),
 			Debug:                  getEnv("DEBUG", "off"),
@@ -62,10 +290,82 @@ func Load() *Config {
 			GoogleClientID:         getEnv("GOOGLE_CLIENT_ID", ""),
 			GoogleClientSecret:     getEnv("GOOGLE_CLIENT_SECRET", ""),
 			DataDir:                getEnv("DATA_DIR", "./data"),
+			StorageBackend:         strings.ToLower(strings.TrimSpace(getEnv("STORAGE_BACKEND", "file"))),
 			AdminPassword:          getEnv("WEBUI_PASSWORD", ""),
 			Gemini3MediaResolution: getEnv("GEMINI3_MEDIA_RESOLUTION", ""),
+			ToolResultMaxBytes:     getEnvInt("TOOL_RESULT_MAX_BYTES", 0),
+			StructuredToolResults:  getEnvBool("STRUCTURED_TOOL_RESULTS", true),
+			ToolResultRefBytes:     getEnvInt("TOOL_RESULT_REF_BYTES", 0),
+			ImageDownscale:         getEnvBool("IMAGE_DOWNSCALE", false),
+			ImageMaxDimension:      getEnvInt("IMAGE_MAX_DIMENSION", 0),
+			ImageJPEGQuality:       getEnvInt("IMAGE_JPEG_QUALITY", 85),
+			ModelFallbacks:         parseModelFallbacks(getEnv("MODEL_FALLBACKS", "")),
+			VirtualModels:          parseVirtualModels(getEnv("VIRTUAL_MODELS", "")),
+			EchoBackendModel:       getEnvBool("ECHO_BACKEND_MODEL", false),
+			TranscriptEnabled:      getEnvBool("TRANSCRIPT_ENABLED", false),
+
+			TranscriptRetentionDays: getEnvInt("TRANSCRIPT_RETENTION_DAYS", 0),
+			TranscriptMaxBytes:      getEnvInt("TRANSCRIPT_MAX_BYTES", 0),
+
+			JournalEnabled:         getEnvBool("JOURNAL_ENABLED", false),
+			JournalMaxBytes:        getEnvInt("JOURNAL_MAX_BYTES", 4*1024*1024),
+			PIIScrub:               splitNonEmpty(strings.ToLower(getEnv("PII_SCRUB", "")), ","),
+			PIIScrubPatterns:       splitNonEmpty(getEnv("PII_SCRUB_PATTERNS", ""), ";;"),
+			HookWebhookURL:         getEnv("HOOK_WEBHOOK_URL", ""),
+			HookWebhookTimeoutMs:   getEnvInt("HOOK_WEBHOOK_TIMEOUT", 5000),
+			HookWebhookFailClosed:  getEnvBool("HOOK_WEBHOOK_FAIL_CLOSED", false),
+			ClaudeThinkingLenient:  getEnvBool("CLAUDE_THINKING_LENIENT", false),
+			ClaudeServerToolBlocks: strings.ToLower(strings.TrimSpace(getEnv("CLAUDE_SERVER_TOOL_BLOCKS", "text"))),
+			ClaudeWebSearch:        strings.TrimSpace(getEnv("CLAUDE_WEB_SEARCH", "")),
+			WebSearchAPIKey:        getEnv("WEB_SEARCH_API_KEY", ""),
+			WebSearchModel:         getEnv("WEB_SEARCH_MODEL", "gemini-2.5-flash"),
+			ModerationModel:        getEnv("MODERATION_MODEL", "gemini-2.5-flash"),
+			ClineCompatKeys:        splitNonEmpty(getEnv("CLINE_COMPAT_KEYS", ""), ","),
+			NoSystemInjectionKeys:  splitNonEmpty(getEnv("NO_SYSTEM_INJECTION_KEYS", ""), ","),
+			ClaudeCodeCompat:       strings.ToLower(strings.TrimSpace(getEnv("CLAUDE_CODE_COMPAT", "auto"))),
+			AnthropicVersionStrict: getEnvBool("ANTHROPIC_VERSION_STRICT", false),
+			OpenAIPredictionHint:   getEnvBool("OPENAI_PREDICTION_HINT", false),
+			MaxThinkingSeconds:     getEnvInt("MAX_THINKING_SECONDS", 0),
+			MaxThinkingTokens:      getEnvInt("MAX_THINKING_TOKENS", 0),
+			MaxStreamOutputBytes:   getEnvInt("MAX_STREAM_OUTPUT_BYTES", 0),
+			MaxStreamOutputTokens:  getEnvInt("MAX_STREAM_OUTPUT_TOKENS", 0),
+			MaxTools:               getEnvInt("MAX_TOOLS", 0),
+			MaxTurns:               getEnvInt("MAX_TURNS", 0),
+			MergeToolDeclarations:  getEnvBool("MERGE_TOOL_DECLARATIONS", false),
+			Gemini3ThinkingLevels:  splitNonEmpty(strings.ToLower(getEnv("GEMINI3_THINKING_LEVELS", "low,high")), ","),
+			SystemInstructionRole:  getEnv("SYSTEM_INSTRUCTION_ROLE", "user"),
+			SecondaryBackendURL:    strings.TrimRight(getEnv("SECONDARY_BACKEND_URL", ""), "/"),
+			SecondaryBackendAPIKey: getEnv("SECONDARY_BACKEND_API_KEY", ""),
+			SecondaryBackendModels: parseSecondaryBackendModels(getEnv("SECONDARY_BACKEND_MODELS", "")),
+			StreamTeeEnabled:       getEnvBool("STREAM_TEE_ENABLED", false),
+			StreamTeeMaxBytes:      getEnvInt("STREAM_TEE_MAX_BYTES", 8*1024*1024),
+			StreamTeeMaxFiles:      getEnvInt("STREAM_TEE_MAX_FILES", 100),
+			UpstreamHeaders:        splitNonEmpty(strings.ToLower(getEnv("UPSTREAM_HEADERS", "")), ","),
+			LogRedactParams:        splitNonEmpty(strings.ToLower(getEnv("LOG_REDACT_PARAMS", "key,api_key,apikey,access_token,token,password,secret")), ","),
+			SessionTTLSeconds:      getEnvInt("SESSION_TTL_SECONDS", 86400),
+			SessionStrict:          getEnvBool("SESSION_STRICT", false),
+
+			QuotaRefreshIntervalMinutes: getEnvInt("QUOTA_REFRESH_INTERVAL_MINUTES", 10),
+			QuotaLowThresholdPercent:    getEnvInt("QUOTA_LOW_THRESHOLD_PERCENT", 10),
+			QuotaHeaders:                getEnvBool("QUOTA_HEADERS", false),
+			QuotaFetchConcurrency:       getEnvInt("QUOTA_FETCH_CONCURRENCY", 8),
+			QuotaFetchTimeoutSeconds:    getEnvInt("QUOTA_FETCH_TIMEOUT_SECONDS", 20),
+			QuotaCacheTTLSeconds:        getEnvInt("QUOTA_CACHE_TTL_SECONDS", 120),
+			QuotaPageWaitSeconds:        getEnvInt("QUOTA_PAGE_WAIT_SECONDS", 10),
+			ModelAvailabilityMinutes:    getEnvInt("MODEL_AVAILABILITY_TTL_MINUTES", 60),
+			ImageAccounts:               splitNonEmpty(strings.ToLower(getEnv("IMAGE_ACCOUNTS", "")), ","),
+			AccountDailyRequestCap:      getEnvInt("ACCOUNT_DAILY_REQUEST_CAP", 0),
+			AccountDailyTokenCap:        getEnvInt("ACCOUNT_DAILY_TOKEN_CAP", 0),
+
+			LoginMaxFailures:       getEnvInt("LOGIN_MAX_FAILURES", 5),
+			LoginLockoutSeconds:    getEnvInt("LOGIN_LOCKOUT_SECONDS", 60),
+			LoginAlertWebhookURL:   getEnv("LOGIN_ALERT_WEBHOOK_URL", ""),
+			AccountAlertWebhookURL: getEnv("ACCOUNT_ALERT_WEBHOOK_URL", getEnv("LOGIN_ALERT_WEBHOOK_URL", "")),
+			TrustProxyHeaders:      getEnvBool("TRUST_PROXY_HEADERS", false),
 		}
 
+		applySettingsFile(cfg)
+
 		for i, arg := range os.Args[1:] {
 			if arg == "-debug" && i+1 < len(os.Args[1:]) {
 				cfg.Debug = os.Args[i+2]
@@ -113,6 +413,17 @@ func getEnvInt(key string, defaultValue int) int {
 	return defaultValue
 }
 
+func getEnvBool(key string, defaultValue bool) bool {
+	switch strings.ToLower(strings.TrimSpace(os.Getenv(key))) {
+	case "1", "true", "yes", "on":
+		return true
+	case "0", "false", "no", "off":
+		return false
+	default:
+		return defaultValue
+	}
+}
+
 func getEnvIntSlice(key string, defaultValue []int) []int {
 	if value := os.Getenv(key); value != "" {
 		parts := strings.Split(value, ",")
@@ -128,3 +439,216 @@ func getEnvIntSlice(key string, defaultValue []int) []int {
 	}
 	return defaultValue
 }
+
+// splitNonEmpty 按 sep 切分并去掉空白项。
+func splitNonEmpty(value, sep string) []string {
+	var out []string
+	for _, p := range strings.Split(value, sep) {
+		if p = strings.TrimSpace(p); p != "" {
+			out = append(out, p)
+		}
+	}
+	return out
+}
+
+// parseModelFallbacks 解析 MODEL_FALLBACKS，例如：
+// "gemini-3-pro-high->gemini-2.5-pro; claude-opus-4-5-thinking->claude-sonnet-4-5-thinking"
+// 每条链用 ; 或 , 分隔，链内用 -> 连接；a->b->c 表示 a 失败后依次尝试 b、c，b 失败后尝试 c。
+func parseModelFallbacks(value string) map[string][]string {
+	chains := strings.FieldsFunc(value, func(r rune) bool { return r == ';' || r == ',' })
+	if len(chains) == 0 {
+		return nil
+	}
+
+	out := make(map[string][]string)
+	for _, chain := range chains {
+		var models []string
+		for _, m := range strings.Split(chain, "->") {
+			if m = strings.TrimSpace(m); m != "" {
+				models = append(models, m)
+			}
+		}
+		for i := 0; i+1 < len(models); i++ {
+			key := strings.ToLower(models[i])
+			if _, exists := out[key]; exists {
+				continue
+			}
+			out[key] = models[i+1:]
+		}
+	}
+	if len(out) == 0 {
+		return nil
+	}
+	return out
+}
+
+// VirtualModel 为一个自定义虚拟模型：对外名称 Name 映射到后端模型 Backend（可以是内置虚拟模型），
+// Overrides 为强制覆盖的 generationConfig 字段（key 为小写字段名，值在 modelutil 中解析校验）。
+type VirtualModel struct {
+	Name      string
+	Backend   string
+	Overrides map[string]string
+}
+
+// parseVirtualModels 解析 VIRTUAL_MODELS，例如：
+// "gemini-3-pro-creative=gemini-3-pro-high:temperature=1.4,topP=0.98; banana-4k=gemini-3-pro-image-4k:aspectRatio=16:9"
+// 每条用 ; 分隔，格式为 名称=后端模型[:字段=值,字段=值]；同名只保留第一条。
+func parseVirtualModels(value string) []VirtualModel {
+	var out []VirtualModel
+	seen := make(map[string]bool)
+	for _, entry := range strings.Split(value, ";") {
+		name, rest, ok := strings.Cut(entry, "=")
+		name = strings.TrimSpace(name)
+		if !ok || name == "" || seen[strings.ToLower(name)] {
+			continue
+		}
+		backend, overrides, _ := strings.Cut(rest, ":")
+		backend = strings.TrimSpace(backend)
+		if backend == "" {
+			continue
+		}
+		seen[strings.ToLower(name)] = true
+		out = append(out, VirtualModel{Name: name, Backend: backend, Overrides: parseOverrides(overrides)})
+	}
+	return out
+}
+
+// parseOverrides 解析 "字段=值,字段=值" 形式的 generationConfig 覆盖（字段名转为小写）。
+func parseOverrides(value string) map[string]string {
+	out := make(map[string]string)
+	for _, kv := range strings.Split(value, ",") {
+		k, v, _ := strings.Cut(kv, "=")
+		if k = strings.ToLower(strings.TrimSpace(k)); k != "" {
+			out[k] = strings.TrimSpace(v)
+		}
+	}
+	return out
+}
+
+// APIKeyPreset 为某个客户端 API Key 的默认配置：Model 为默认模型（为空表示不指定），
+// Overrides 为默认 generationConfig 字段（格式同 VirtualModel.Overrides）。
+// Override 为 false 时仅在请求未指定模型 / 参数时生效；为 true 时总是覆盖请求中的值。
+type APIKeyPreset struct {
+	Model     string
+	Override  bool
+	Overrides map[string]string
+}
+
+// parseAPIKeyPresets 解析 API_KEY_PRESETS，例如：
+// "sk-simple=gemini-3-flash:temperature=0.3,maxOutputTokens=4096; sk-kiosk=!claude-sonnet-4-5:temperature=0.2; sk-cold=:temperature=0"
+// 每条用 ; 分隔，格式为 key=[!]默认模型[:字段=值,...]；模型前的 ! 表示覆盖模式，模型可以留空仅设置参数；同一 key 只保留第一条。
+func parseAPIKeyPresets(value string) map[string]APIKeyPreset {
+	out := make(map[string]APIKeyPreset)
+	for _, entry := range strings.Split(value, ";") {
+		key, rest, ok := strings.Cut(entry, "=")
+		key = strings.TrimSpace(key)
+		if !ok || key == "" {
+			continue
+		}
+		if _, exists := out[key]; exists {
+			continue
+		}
+		model, overrides, _ := strings.Cut(rest, ":")
+		model = strings.TrimSpace(model)
+		preset := APIKeyPreset{Overrides: parseOverrides(overrides)}
+		if strings.HasPrefix(model, "!") {
+			preset.Override = true
+			model = strings.TrimSpace(model[1:])
+		}
+		preset.Model = model
+		if preset.Model == "" && len(preset.Overrides) == 0 {
+			continue
+		}
+		out[key] = preset
+	}
+	if len(out) == 0 {
+		return nil
+	}
+	return out
+}
+
+// parseHMACKeyIDs 解析 HMAC_KEY_IDS，例如："ci=sk-ci-xxx; bot=sk-bot-yyy"（key ID=API Key）。
+// 未配置时返回 nil。
+func parseHMACKeyIDs(value string) map[string]string {
+	out := make(map[string]string)
+	for _, entry := range strings.Split(value, ";") {
+		id, key, _ := strings.Cut(entry, "=")
+		id, key = strings.TrimSpace(id), strings.TrimSpace(key)
+		if id == "" || key == "" {
+			continue
+		}
+		out[id] = key
+	}
+	if len(out) == 0 {
+		return nil
+	}
+	return out
+}
+
+// parseAPIKeyScopes 解析 API_KEYS，例如："sk-chat=openai+models; sk-cc=claude; sk-ro=models"。
+// 每条用 ; 或 , 分隔，格式为 key=接口族，多个接口族用 + 连接；接口族为空时视为 *（不限制）。
+func parseAPIKeyScopes(value string) map[string][]string {
+	out := make(map[string][]string)
+	for _, entry := range strings.FieldsFunc(value, func(r rune) bool { return r == ';' || r == ',' }) {
+		key, scopes, _ := strings.Cut(entry, "=")
+		key = strings.TrimSpace(key)
+		if key == "" {
+			continue
+		}
+		list := splitNonEmpty(strings.ToLower(scopes), "+")
+		if len(list) == 0 {
+			list = []string{"*"}
+		}
+		out[key] = list
+	}
+	if len(out) == 0 {
+		return nil
+	}
+	return out
+}
+
+// parseHostOverrides 解析 HOST_OVERRIDES，例如：
+// "daily-cloudcode-pa.sandbox.googleapis.com=142.250.1.95|142.250.1.96; cloudcode-pa.googleapis.com=142.250.1.95"
+// 每条用 ; 或 , 分隔，格式为 主机名=IP，多个 IP 用 | 连接并按顺序尝试；非法 IP 会被忽略。
+func parseHostOverrides(value string) map[string][]string {
+	out := make(map[string][]string)
+	for _, entry := range strings.FieldsFunc(value, func(r rune) bool { return r == ';' || r == ',' }) {
+		host, ips, _ := strings.Cut(entry, "=")
+		host = strings.ToLower(strings.TrimSuffix(strings.TrimSpace(host), "."))
+		if host == "" {
+			continue
+		}
+		var list []string
+		for _, ip := range splitNonEmpty(ips, "|") {
+			if net.ParseIP(ip) != nil {
+				list = append(list, ip)
+			}
+		}
+		if len(list) > 0 {
+			out[host] = list
+		}
+	}
+	if len(out) == 0 {
+		return nil
+	}
+	return out
+}
+
+// parseSecondaryBackendModels 解析 SECONDARY_BACKEND_MODELS，例如：
+// "gemini-=qwen2.5-72b-instruct; claude-=llama-3.3-70b; *="
+// 每条用 ; 或 , 分隔，格式为 前缀=备用模型名；前缀 * 匹配所有模型，备用模型名为空时沿用请求的模型名。
+func parseSecondaryBackendModels(value string) map[string]string {
+	out := make(map[string]string)
+	for _, entry := range strings.FieldsFunc(value, func(r rune) bool { return r == ';' || r == ',' }) {
+		prefix, target, _ := strings.Cut(entry, "=")
+		prefix = strings.ToLower(strings.TrimSpace(prefix))
+		if prefix == "" {
+			continue
+		}
+		out[prefix] = strings.TrimSpace(target)
+	}
+	if len(out) == 0 {
+		return nil
+	}
+	return out
+}
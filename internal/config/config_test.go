@@ -0,0 +1,119 @@
+package config
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseModelFallbacks(t *testing.T) {
+	got := parseModelFallbacks(" Gemini-3-Pro-High -> gemini-2.5-pro -> gemini-2.5-flash ; claude-opus-4-5-thinking->claude-sonnet-4-5-thinking,broken")
+	want := map[string][]string{
+		"gemini-3-pro-high":        {"gemini-2.5-pro", "gemini-2.5-flash"},
+		"gemini-2.5-pro":           {"gemini-2.5-flash"},
+		"claude-opus-4-5-thinking": {"claude-sonnet-4-5-thinking"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("fallbacks mismatch:\ngot  %#v\nwant %#v", got, want)
+	}
+
+	if parseModelFallbacks("") != nil {
+		t.Fatalf("expected nil for empty value")
+	}
+}
+
+func TestParseSecondaryBackendModels(t *testing.T) {
+	got := parseSecondaryBackendModels(" Gemini- = qwen2.5-72b ; claude-=,*=")
+	want := map[string]string{
+		"gemini-": "qwen2.5-72b",
+		"claude-": "",
+		"*":       "",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("secondary models mismatch:\ngot  %#v\nwant %#v", got, want)
+	}
+
+	if parseSecondaryBackendModels("") != nil {
+		t.Fatalf("expected nil for empty value")
+	}
+}
+
+func TestParseAPIKeyScopes(t *testing.T) {
+	got := parseAPIKeyScopes(" sk-chat = OpenAI+models ; sk-cc=claude,sk-all=,=gemini")
+	want := map[string][]string{
+		"sk-chat": {"openai", "models"},
+		"sk-cc":   {"claude"},
+		"sk-all":  {"*"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("api key scopes mismatch:\ngot  %#v\nwant %#v", got, want)
+	}
+
+	if parseAPIKeyScopes("") != nil {
+		t.Fatalf("expected nil for empty value")
+	}
+}
+
+func TestParseVirtualModels(t *testing.T) {
+	got := parseVirtualModels(" gemini-3-pro-creative = gemini-3-pro-high : Temperature=1.4, topP=0.98 ;" +
+		"banana-wide=gemini-3-pro-image-4k:aspectRatio=16:9; plain=gemini-2.5-pro; GEMINI-3-PRO-CREATIVE=x; broken=")
+	want := []VirtualModel{
+		{Name: "gemini-3-pro-creative", Backend: "gemini-3-pro-high", Overrides: map[string]string{"temperature": "1.4", "topp": "0.98"}},
+		{Name: "banana-wide", Backend: "gemini-3-pro-image-4k", Overrides: map[string]string{"aspectratio": "16:9"}},
+		{Name: "plain", Backend: "gemini-2.5-pro", Overrides: map[string]string{}},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("virtual models mismatch:\ngot  %#v\nwant %#v", got, want)
+	}
+}
+
+func TestParseAPIKeyPresets(t *testing.T) {
+	got := parseAPIKeyPresets(" sk-simple = gemini-3-flash : Temperature=0.3, maxOutputTokens=4096 ;" +
+		"sk-kiosk=!claude-sonnet-4-5; sk-cold=:temperature=0; sk-simple=other; sk-empty=; =gemini-2.5-pro")
+	want := map[string]APIKeyPreset{
+		"sk-simple": {Model: "gemini-3-flash", Overrides: map[string]string{"temperature": "0.3", "maxoutputtokens": "4096"}},
+		"sk-kiosk":  {Model: "claude-sonnet-4-5", Override: true, Overrides: map[string]string{}},
+		"sk-cold":   {Overrides: map[string]string{"temperature": "0"}},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("api key presets mismatch:\ngot  %#v\nwant %#v", got, want)
+	}
+	if parseAPIKeyPresets("") != nil {
+		t.Fatal("empty value should yield nil")
+	}
+}
+
+func TestParseTenants(t *testing.T) {
+	got := parseTenants(" sk-alice = alice ; sk-bob=bob, sk-bob-ci=bob; sk-bad=../etc; sk-empty=; =carol")
+	want := map[string]string{"sk-alice": "alice", "sk-bob": "bob", "sk-bob-ci": "bob"}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("tenants mismatch:\ngot  %#v\nwant %#v", got, want)
+	}
+	if parseTenants("") != nil {
+		t.Fatal("empty value should yield nil")
+	}
+}
+
+func TestParseHostOverrides(t *testing.T) {
+	got := parseHostOverrides(" Daily.Example.COM. = 10.0.0.1 | bad | ::1 ; other.example.com=; skip=nope")
+	want := map[string][]string{
+		"daily.example.com": {"10.0.0.1", "::1"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("host overrides mismatch:\ngot  %#v\nwant %#v", got, want)
+	}
+
+	if parseHostOverrides("") != nil {
+		t.Fatalf("expected nil for empty value")
+	}
+}
+
+func TestParseHMACKeyIDs(t *testing.T) {
+	got := parseHMACKeyIDs(" ci = sk-chat ; bot=sk-cc;empty=; =sk-x")
+	want := map[string]string{"ci": "sk-chat", "bot": "sk-cc"}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("key IDs mismatch:\ngot  %#v\nwant %#v", got, want)
+	}
+	if parseHMACKeyIDs("") != nil {
+		t.Fatal("empty value should yield nil")
+	}
+}
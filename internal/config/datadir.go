@@ -0,0 +1,37 @@
+package config
+
+import (
+	"os"
+	"sync/atomic"
+)
+
+// dataDirReadOnly 在启动时由 CheckDataDirWritable 设置。
+var dataDirReadOnly atomic.Bool
+
+// CheckDataDirWritable 在启动时调用一次：在 DATA_DIR 中创建并删除一个探测文件，失败时进入只读模式并返回原因。
+// 只读模式下不再写入数据目录：签名只保存在内存中，settings.json、账号/回收站/每日用量文档不再写入
+// （管理面板与令牌刷新的修改仅在本次运行中生效），会话记录、请求日志（journal）、SQLite 用量记录、
+// stream tee 与端点探测结果不再落盘，备份恢复被拒绝；未配置 REQUEST_SPOOL_DIR 时大请求体改写到系统临时目录，
+// 避免每个请求都因写入失败而报错。
+func CheckDataDirWritable() error {
+	dir := Get().DataDir
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		dataDirReadOnly.Store(true)
+		return err
+	}
+	f, err := os.CreateTemp(dir, ".write-probe-*")
+	if err != nil {
+		dataDirReadOnly.Store(true)
+		return err
+	}
+	name := f.Name()
+	_ = f.Close()
+	_ = os.Remove(name)
+	dataDirReadOnly.Store(false)
+	return nil
+}
+
+// DataDirReadOnly 报告启动时是否检测到 DATA_DIR 不可写（见 CheckDataDirWritable）。
+func DataDirReadOnly() bool {
+	return dataDirReadOnly.Load()
+}
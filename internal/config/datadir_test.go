@@ -0,0 +1,37 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestCheckDataDirWritable(t *testing.T) {
+	c := Get()
+	old := c.DataDir
+	t.Cleanup(func() {
+		c.DataDir = old
+		dataDirReadOnly.Store(false)
+	})
+
+	c.DataDir = t.TempDir()
+	if err := CheckDataDirWritable(); err != nil || DataDirReadOnly() {
+		t.Fatalf("temp dir should be writable: %v", err)
+	}
+	if entries, _ := os.ReadDir(c.DataDir); len(entries) != 0 {
+		t.Fatalf("probe file should be removed, got %v", entries)
+	}
+
+	// 以普通文件作为父目录，无论是否以 root 运行都无法创建数据目录。
+	file := filepath.Join(t.TempDir(), "file")
+	if err := os.WriteFile(file, nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	c.DataDir = filepath.Join(file, "data")
+	if err := CheckDataDirWritable(); err == nil || !DataDirReadOnly() {
+		t.Fatal("expected read-only mode for an unwritable data dir")
+	}
+	if err := updateSettingsFile(settingsPath(c.DataDir), func(s *Settings) { s.EndpointMode = "daily" }); err != nil {
+		t.Fatalf("settings writes should be skipped in read-only mode, got %v", err)
+	}
+}
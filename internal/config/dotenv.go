@@ -40,6 +40,11 @@ func loadDotEnv() {
 	}
 }
 
+// DotEnvPath 返回当前使用的 .env 文件路径（从工作目录向上查找），未找到时 ok 为 false。
+func DotEnvPath() (string, bool) {
+	return findDotEnvPath()
+}
+
 func findDotEnvPath() (string, bool) {
 	cwd, err := os.Getwd()
 	if err != nil {
@@ -66,35 +71,10 @@ func findDotEnvPath() (string, bool) {
 	return "", false
 }
 
+// parseDotEnvLine 返回一行赋值的键与值（规则见 splitDotEnvAssignment），注释与空行返回 ok=false。
 func parseDotEnvLine(line string) (string, string, bool) {
-	line = strings.TrimSpace(line)
-	if line == "" || strings.HasPrefix(line, "#") {
-		return "", "", false
-	}
-
-	line = strings.TrimPrefix(line, "export ")
-
-	eqIdx := strings.IndexByte(line, '=')
-	if eqIdx <= 0 {
-		return "", "", false
-	}
-
-	key := strings.TrimSpace(line[:eqIdx])
-	if key == "" {
-		return "", "", false
-	}
-
-	raw := strings.TrimSpace(line[eqIdx+1:])
-	if raw == "" {
-		return key, "", true
-	}
-
-	if len(raw) >= 2 && ((raw[0] == '\'' && raw[len(raw)-1] == '\'') || (raw[0] == '"' && raw[len(raw)-1] == '"')) {
-		return key, raw[1 : len(raw)-1], true
-	}
-
-	raw = stripInlineComment(raw)
-	return key, strings.TrimSpace(raw), true
+	a, ok := splitDotEnvAssignment(line)
+	return a.key, a.value, ok
 }
 
 func stripInlineComment(value string) string {
@@ -0,0 +1,162 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+)
+
+// dotEnvMu 串行化本进程内对 .env 的改写；跨进程由 <path>.lock 文件锁保护（见 lockDotEnv）。
+var dotEnvMu sync.Mutex
+
+// dotEnvAssignment 为 .env 中一行赋值的各个部分，改写时只替换 value，其余部分（缩进、export 前缀、
+// 引号风格、行尾注释）原样保留。
+type dotEnvAssignment struct {
+	prefix  string // 行首空白与 "export "
+	key     string
+	sep     string // "=" 及其两侧空白
+	quote   byte   // 原值的引号：'"'、'\'' 或 0
+	value   string // 去掉引号后的值
+	comment string // 值之后的空白与行内注释
+}
+
+// splitDotEnvAssignment 将一行拆分为 dotEnvAssignment；注释、空行与无法识别的行返回 ok=false。
+// 取值规则与 loadDotEnv 一致：整体被同一种引号包围时去掉引号，引号后可跟行内注释；未加引号时
+// 以空白后的 # 开始行内注释。
+func splitDotEnvAssignment(line string) (a dotEnvAssignment, ok bool) {
+	rest := strings.TrimLeft(line, " \t")
+	if rest == "" || strings.HasPrefix(rest, "#") {
+		return a, false
+	}
+	if strings.HasPrefix(rest, "export ") {
+		rest = strings.TrimLeft(strings.TrimPrefix(rest, "export "), " \t")
+	}
+	a.prefix = line[:len(line)-len(rest)]
+
+	eqIdx := strings.IndexByte(rest, '=')
+	if eqIdx <= 0 {
+		return a, false
+	}
+	a.key = strings.TrimSpace(rest[:eqIdx])
+	if a.key == "" {
+		return a, false
+	}
+	raw := strings.TrimLeft(rest[eqIdx+1:], " \t")
+	a.sep = rest[len(strings.TrimRight(rest[:eqIdx], " \t")) : len(rest)-len(raw)]
+
+	body := strings.TrimRight(raw, " \t\r")
+	if len(body) >= 2 && (body[0] == '"' || body[0] == '\'') {
+		q := body[0]
+		if body[len(body)-1] == q {
+			a.quote, a.value, a.comment = q, body[1:len(body)-1], raw[len(body):]
+			return a, true
+		}
+		if end := strings.LastIndexByte(body, q); end > 0 {
+			tail := body[end+1:]
+			if trimmed := strings.TrimLeft(tail, " \t"); trimmed != tail && strings.HasPrefix(trimmed, "#") {
+				a.quote, a.value, a.comment = q, body[1:end], raw[end+1:]
+				return a, true
+			}
+		}
+	}
+
+	value := stripInlineComment(body)
+	a.value = strings.TrimSpace(value)
+	a.comment = raw[len(a.value):]
+	return a, true
+}
+
+// format 以原有格式写出新值：原值带引号时沿用同一种引号（单引号无法表示含 ' 的值，改用双引号），
+// 原值未加引号而新值含空白、引号或 # 时加双引号。
+func (a dotEnvAssignment) format(value string) string {
+	quote := a.quote
+	switch {
+	case quote == '\'' && strings.ContainsRune(value, '\''):
+		quote = '"'
+	case quote == 0 && strings.ContainsAny(value, " \t\"'#"):
+		quote = '"'
+	}
+	if quote != 0 {
+		value = string(quote) + value + string(quote)
+	}
+	return a.prefix + a.key + a.sep + value + a.comment
+}
+
+// editDotEnvFile 在 path 中更新 updates 中的键：已有的赋值行（同一个键出现多次时全部）按原格式替换值，
+// 其他行（注释、空行、其他键）与换行风格保持不变，文件中没有的键按键名顺序追加到末尾。
+// 写入临时文件后重命名替换，并加文件锁，避免两次保存同时进行时损坏文件。
+func editDotEnvFile(path string, updates map[string]string) error {
+	if resolved, err := filepath.EvalSymlinks(path); err == nil {
+		path = resolved
+	}
+
+	dotEnvMu.Lock()
+	defer dotEnvMu.Unlock()
+	unlock, err := lockDotEnv(path + ".lock")
+	if err != nil {
+		return fmt.Errorf("无法锁定 .env 文件: %w", err)
+	}
+	defer unlock()
+
+	mode := os.FileMode(0o600)
+	data, err := os.ReadFile(path)
+	if err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("无法读取 .env 文件: %w", err)
+	}
+	if st, err := os.Stat(path); err == nil {
+		mode = st.Mode().Perm()
+	}
+
+	content := string(data)
+	newline := "\n"
+	if strings.Contains(content, "\r\n") {
+		newline = "\r\n"
+	}
+	lines := strings.Split(strings.ReplaceAll(content, "\r\n", "\n"), "\n")
+	trailingNewline := content == "" || strings.HasSuffix(content, "\n")
+	if trailingNewline {
+		lines = lines[:len(lines)-1]
+	}
+
+	seen := make(map[string]bool, len(updates))
+	for i, line := range lines {
+		a, ok := splitDotEnvAssignment(line)
+		if !ok {
+			continue
+		}
+		if value, exists := updates[a.key]; exists {
+			lines[i] = a.format(value)
+			seen[a.key] = true
+		}
+	}
+	keys := make([]string, 0, len(updates))
+	for key := range updates {
+		if !seen[key] {
+			keys = append(keys, key)
+		}
+	}
+	slices.Sort(keys)
+	for _, key := range keys {
+		lines = append(lines, formatEnvLine(key, updates[key]))
+	}
+	if len(keys) > 0 {
+		trailingNewline = true
+	}
+
+	out := strings.Join(lines, newline)
+	if trailingNewline && len(lines) > 0 {
+		out += newline
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, []byte(out), mode); err != nil {
+		return fmt.Errorf("无法写入 .env 文件: %w", err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		_ = os.Remove(tmp)
+		return fmt.Errorf("无法写入 .env 文件: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,90 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestEditDotEnvFile_PreservesFormatting(t *testing.T) {
+	path := filepath.Join(t.TempDir(), ".env")
+	original := strings.Join([]string{
+		"# 认证",
+		"export API_KEY='sk-old'   # 客户端使用",
+		"",
+		"  DEBUG = off",
+		`API_USER_AGENT="ua 1" # 上游 UA`,
+		"# WEBUI_PASSWORD=commented",
+		"WEBUI_PASSWORD=old",
+		"PORT=8045",
+	}, "\r\n") + "\r\n"
+	if err := os.WriteFile(path, []byte(original), 0o640); err != nil {
+		t.Fatal(err)
+	}
+
+	err := editDotEnvFile(path, map[string]string{
+		"API_KEY":        "it's",
+		"DEBUG":          "all",
+		"API_USER_AGENT": "ua 2",
+		"WEBUI_PASSWORD": "new pass",
+		"QUOTA_X":        "5",
+	})
+	if err != nil {
+		t.Fatalf("editDotEnvFile: %v", err)
+	}
+
+	want := strings.Join([]string{
+		"# 认证",
+		`export API_KEY="it's"   # 客户端使用`,
+		"",
+		"  DEBUG = all",
+		`API_USER_AGENT="ua 2" # 上游 UA`,
+		"# WEBUI_PASSWORD=commented",
+		`WEBUI_PASSWORD="new pass"`,
+		"PORT=8045",
+		"QUOTA_X=5",
+	}, "\r\n") + "\r\n"
+	got, _ := os.ReadFile(path)
+	if string(got) != want {
+		t.Fatalf("unexpected content:\n%q\nwant:\n%q", got, want)
+	}
+	if st, _ := os.Stat(path); st.Mode().Perm() != 0o640 {
+		t.Fatalf("file mode changed to %v", st.Mode().Perm())
+	}
+
+	for line, value := range map[string]string{
+		`export API_KEY="it's"   # 客户端使用`: "it's",
+		`API_USER_AGENT="ua 2" # 上游 UA`:   "ua 2",
+		"  DEBUG = all":                   "all",
+	} {
+		if _, v, ok := parseDotEnvLine(line); !ok || v != value {
+			t.Errorf("parseDotEnvLine(%q) = %q, want %q", line, v, value)
+		}
+	}
+}
+
+func TestEditDotEnvFile_ConcurrentSaves(t *testing.T) {
+	path := filepath.Join(t.TempDir(), ".env")
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			if err := editDotEnvFile(path, map[string]string{fmt.Sprintf("KEY_%02d", i): "v"}); err != nil {
+				t.Error(err)
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	lines, err := readDotEnvLines(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(lines) != 20 {
+		t.Fatalf("expected 20 keys after concurrent saves, got %d: %v", len(lines), lines)
+	}
+}
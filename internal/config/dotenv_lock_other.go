@@ -0,0 +1,8 @@
+//go:build !unix && !windows
+
+package config
+
+// lockDotEnv 在既不支持 flock 也不支持 LockFileEx 的平台上不加跨进程锁，只依赖 dotEnvMu 串行化本进程内的改写。
+func lockDotEnv(string) (func(), error) {
+	return func() {}, nil
+}
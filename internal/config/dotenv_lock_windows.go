@@ -0,0 +1,28 @@
+//go:build windows
+
+package config
+
+import (
+	"os"
+
+	"golang.org/x/sys/windows"
+)
+
+// lockDotEnv 对锁文件 path 加排他的 LockFileEx 锁（阻塞直到获得），返回释放函数；锁文件保留，不在释放时删除。
+func lockDotEnv(path string) (func(), error) {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_RDWR, 0o600)
+	if err != nil {
+		return nil, err
+	}
+	// 锁定整个文件范围（长度取最大值），与文件实际大小无关。
+	h := windows.Handle(f.Fd())
+	ol := new(windows.Overlapped)
+	if err := windows.LockFileEx(h, windows.LOCKFILE_EXCLUSIVE_LOCK, 0, ^uint32(0), ^uint32(0), ol); err != nil {
+		_ = f.Close()
+		return nil, err
+	}
+	return func() {
+		_ = windows.UnlockFileEx(h, 0, ^uint32(0), ^uint32(0), ol)
+		_ = f.Close()
+	}, nil
+}
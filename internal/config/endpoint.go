@@ -1,12 +1,11 @@
 package config
 
 import (
+	"fmt"
 	"os"
-	"path/filepath"
+	"slices"
+	"strings"
 	"sync"
-	"time"
-
-	jsonpkg "anti2api-golang/refactor/internal/pkg/json"
 )
 
 type Endpoint struct {
@@ -38,18 +37,14 @@ var (
 
 	RoundRobinEndpoints   = []string{"daily", "autopush", "production"}
 	RoundRobinDpEndpoints = []string{"daily", "production"}
-)
-
-func (e Endpoint) StreamURL() string {
-	return "https://" + e.Host + "/v1internal:streamGenerateContent?alt=sse"
-}
 
-func (e Endpoint) NoStreamURL() string {
-	return "https://" + e.Host + "/v1internal:generateContent"
-}
+	// EndpointModes 为 ENDPOINT_MODE 的全部可选值：固定单个端点，或在多个端点间轮询。
+	EndpointModes = []string{"daily", "autopush", "production", "round-robin", "round-robin-dp"}
+)
 
-func (e Endpoint) FetchAvailableModelsURL() string {
-	return "https://" + e.Host + "/v1internal:fetchAvailableModels"
+// ValidEndpointMode 判断 mode 是否为可用的端点模式。
+func ValidEndpointMode(mode string) bool {
+	return slices.Contains(EndpointModes, mode)
 }
 
 type EndpointManager struct {
@@ -60,12 +55,6 @@ type EndpointManager struct {
 	settingsPath      string
 }
 
-type Settings struct {
-	EndpointMode    string    `json:"endpointMode"`
-	CurrentEndpoint string    `json:"currentEndpoint"`
-	UpdatedAt       time.Time `json:"updatedAt"`
-}
-
 var (
 	endpointMgr     *EndpointManager
 	endpointMgrOnce sync.Once
@@ -76,7 +65,7 @@ func GetEndpointManager() *EndpointManager {
 		cfg := Get()
 		endpointMgr = &EndpointManager{
 			mode:         cfg.EndpointMode,
-			settingsPath: filepath.Join(cfg.DataDir, "settings.json"),
+			settingsPath: settingsPath(cfg.DataDir),
 		}
 		endpointMgr.loadSettings()
 	})
@@ -84,39 +73,22 @@ func GetEndpointManager() *EndpointManager {
 }
 
 func (m *EndpointManager) loadSettings() {
-	data, err := os.ReadFile(m.settingsPath)
+	settings, err := readSettingsFile(m.settingsPath)
 	if err != nil {
 		return
 	}
 
-	var settings Settings
-	if err := jsonpkg.Unmarshal(data, &settings); err != nil {
-		return
-	}
-
 	if os.Getenv("ENDPOINT_MODE") == "" && settings.EndpointMode != "" {
 		m.mode = settings.EndpointMode
 	}
 }
 
 func (m *EndpointManager) saveSettings() error {
-	settings := Settings{
-		EndpointMode:    m.mode,
-		CurrentEndpoint: m.getCurrentEndpointKey(),
-		UpdatedAt:       time.Now(),
-	}
-
-	data, err := jsonpkg.MarshalIndent(settings, "", "  ")
-	if err != nil {
-		return err
-	}
-
-	dir := filepath.Dir(m.settingsPath)
-	if err := os.MkdirAll(dir, 0o755); err != nil {
-		return err
-	}
-
-	return os.WriteFile(m.settingsPath, data, 0o644)
+	mode, current := m.mode, m.getCurrentEndpointKey()
+	return updateSettingsFile(m.settingsPath, func(s *Settings) {
+		s.EndpointMode = mode
+		s.CurrentEndpoint = current
+	})
 }
 
 func (m *EndpointManager) getCurrentEndpointKey() string {
@@ -165,18 +137,27 @@ func (m *EndpointManager) GetMode() string {
 	return m.mode
 }
 
-func (m *EndpointManager) SetMode(mode string) error {
+// CurrentEndpointKey 返回下一次请求将使用的端点 key（轮询模式下不推进轮询位置）。
+func (m *EndpointManager) CurrentEndpointKey() string {
 	m.mu.Lock()
 	defer m.mu.Unlock()
-
-	validModes := map[string]bool{
-		"daily": true, "autopush": true, "production": true,
-		"round-robin": true, "round-robin-dp": true,
+	if key := m.getCurrentEndpointKey(); key != "" {
+		if _, ok := APIEndpoints[key]; ok {
+			return key
+		}
 	}
-	if !validModes[mode] {
-		return nil
+	return "daily"
+}
+
+// SetMode 切换端点模式并写入 settings.json，立即对后续请求生效；未知模式返回错误。
+func (m *EndpointManager) SetMode(mode string) error {
+	if !ValidEndpointMode(mode) {
+		return fmt.Errorf("未知的端点模式：%s（可选 %s）", mode, strings.Join(EndpointModes, " / "))
 	}
 
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
 	m.mode = mode
 	return m.saveSettings()
 }
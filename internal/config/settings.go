@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"strconv"
 	"strings"
 	"sync"
 )
@@ -16,6 +17,9 @@ type WebUISettings struct {
 	Debug                  string `json:"debug"`
 	UserAgent              string `json:"userAgent"`
 	Gemini3MediaResolution string `json:"gemini3MediaResolution"`
+	// QuotaRefreshIntervalMinutes / QuotaLowThresholdPercent 控制后台配额刷新与低配额账号轮询排序。
+	QuotaRefreshIntervalMinutes int `json:"quotaRefreshIntervalMinutes"`
+	QuotaLowThresholdPercent    int `json:"quotaLowThresholdPercent"`
 }
 
 var settingsMu sync.RWMutex
@@ -33,10 +37,14 @@ func GetWebUISettings() WebUISettings {
 		Debug:                  cfg.Debug,
 		UserAgent:              cfg.UserAgent,
 		Gemini3MediaResolution: mr,
+
+		QuotaRefreshIntervalMinutes: cfg.QuotaRefreshIntervalMinutes,
+		QuotaLowThresholdPercent:    cfg.QuotaLowThresholdPercent,
 	}
 }
 
-// UpdateWebUISettings updates both the in-memory config and the .env file
+// UpdateWebUISettings updates the in-memory config and persists it to settings.json
+// (also mirrored to .env when SETTINGS_WRITE_DOTENV=true)
 func UpdateWebUISettings(s WebUISettings) error {
 	settingsMu.Lock()
 	defer settingsMu.Unlock()
@@ -49,11 +57,7 @@ func UpdateWebUISettings(s WebUISettings) error {
 
 	// Update in-memory config
 	cfg := Get()
-	cfg.APIKey = s.APIKey
-	cfg.AdminPassword = s.WebUIPassword
-	cfg.Debug = s.Debug
-	cfg.UserAgent = s.UserAgent
-	cfg.Gemini3MediaResolution = s.Gemini3MediaResolution
+	applyWebUISettings(cfg, s)
 
 	// Also update environment variables so they persist in the current process
 	_ = os.Setenv("API_KEY", s.APIKey)
@@ -61,18 +65,41 @@ func UpdateWebUISettings(s WebUISettings) error {
 	_ = os.Setenv("DEBUG", s.Debug)
 	_ = os.Setenv("API_USER_AGENT", s.UserAgent)
 	_ = os.Setenv("GEMINI3_MEDIA_RESOLUTION", s.Gemini3MediaResolution)
+	_ = os.Setenv("QUOTA_REFRESH_INTERVAL_MINUTES", strconv.Itoa(s.QuotaRefreshIntervalMinutes))
+	_ = os.Setenv("QUOTA_LOW_THRESHOLD_PERCENT", strconv.Itoa(s.QuotaLowThresholdPercent))
+
+	if err := updateSettingsFile(settingsPath(cfg.DataDir), func(f *Settings) { f.WebUI = &s }); err != nil {
+		return fmt.Errorf("无法写入 settings.json: %w", err)
+	}
+	if !cfg.SettingsWriteDotEnv {
+		return nil
+	}
 
-	// Write to .env file
+	// Mirror to .env file
 	return updateDotEnvFile(map[string]string{
 		"API_KEY":                  s.APIKey,
 		"WEBUI_PASSWORD":           s.WebUIPassword,
 		"DEBUG":                    s.Debug,
 		"API_USER_AGENT":           s.UserAgent,
 		"GEMINI3_MEDIA_RESOLUTION": s.Gemini3MediaResolution,
+
+		"QUOTA_REFRESH_INTERVAL_MINUTES": strconv.Itoa(s.QuotaRefreshIntervalMinutes),
+		"QUOTA_LOW_THRESHOLD_PERCENT":    strconv.Itoa(s.QuotaLowThresholdPercent),
 	})
 }
 
-// updateDotEnvFile updates specific keys in the .env file
+// applyWebUISettings copies the WebUI settings into cfg
+func applyWebUISettings(cfg *Config, s WebUISettings) {
+	cfg.APIKey = s.APIKey
+	cfg.AdminPassword = s.WebUIPassword
+	cfg.Debug = s.Debug
+	cfg.UserAgent = s.UserAgent
+	cfg.Gemini3MediaResolution = s.Gemini3MediaResolution
+	cfg.QuotaRefreshIntervalMinutes = s.QuotaRefreshIntervalMinutes
+	cfg.QuotaLowThresholdPercent = s.QuotaLowThresholdPercent
+}
+
+// updateDotEnvFile updates specific keys in the .env file, keeping comments and formatting (see editDotEnvFile)
 func updateDotEnvFile(updates map[string]string) error {
 	dotEnvPath, ok := findDotEnvPath()
 	if !ok {
@@ -84,37 +111,7 @@ func updateDotEnvFile(updates map[string]string) error {
 		dotEnvPath = filepath.Join(cwd, ".env")
 	}
 
-	// Read existing file content
-	lines, err := readDotEnvLines(dotEnvPath)
-	if err != nil && !os.IsNotExist(err) {
-		return fmt.Errorf("无法读取 .env 文件: %w", err)
-	}
-
-	// Track which keys we've updated
-	updatedKeys := make(map[string]bool)
-
-	// Update existing lines
-	for i, line := range lines {
-		key, _, ok := parseDotEnvLine(line)
-		if !ok {
-			continue
-		}
-		if newValue, exists := updates[key]; exists {
-			// Update this line
-			lines[i] = formatEnvLine(key, newValue)
-			updatedKeys[key] = true
-		}
-	}
-
-	// Add any new keys that weren't found
-	for key, value := range updates {
-		if !updatedKeys[key] {
-			lines = append(lines, formatEnvLine(key, value))
-		}
-	}
-
-	// Write back to file
-	return writeDotEnvFile(dotEnvPath, lines)
+	return editDotEnvFile(dotEnvPath, updates)
 }
 
 // readDotEnvLines reads all lines from a .env file
@@ -134,28 +131,10 @@ func readDotEnvLines(path string) ([]string, error) {
 }
 
 // formatEnvLine formats a key-value pair for .env file
-// Wraps values containing spaces in quotes
+// Wraps values containing spaces, quotes or # in quotes
 func formatEnvLine(key, value string) string {
-	if strings.ContainsAny(value, " \t\"'") || value == "" {
+	if strings.ContainsAny(value, " \t\"'#") || value == "" {
 		return fmt.Sprintf("%s=\"%s\"", key, value)
 	}
 	return fmt.Sprintf("%s=%s", key, value)
 }
-
-// writeDotEnvFile writes lines to a .env file
-func writeDotEnvFile(path string, lines []string) error {
-	file, err := os.Create(path)
-	if err != nil {
-		return fmt.Errorf("无法写入 .env 文件: %w", err)
-	}
-	defer file.Close()
-
-	writer := bufio.NewWriter(file)
-	for _, line := range lines {
-		_, err := writer.WriteString(line + "\n")
-		if err != nil {
-			return err
-		}
-	}
-	return writer.Flush()
-}
@@ -0,0 +1,144 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+	"time"
+
+	jsonpkg "anti2api-golang/refactor/internal/pkg/json"
+)
+
+// settingsFileVersion 为 settings.json 的格式版本（1：合并端点模式与 WebUI 设置）。
+const settingsFileVersion = 1
+
+// Settings 为持久化在 DATA_DIR/settings.json 中的运行时设置。管理面板的修改都写在这里，不再改写 .env；
+// 启动时 WebUI 中的值优先于 .env 与环境变量，端点模式则以 ENDPOINT_MODE 环境变量优先。
+type Settings struct {
+	Version         int            `json:"version"`
+	EndpointMode    string         `json:"endpointMode"`
+	CurrentEndpoint string         `json:"currentEndpoint"`
+	WebUI           *WebUISettings `json:"webui,omitempty"`
+	UpdatedAt       time.Time      `json:"updatedAt"`
+}
+
+// settingsFileMu 串行化 settings.json 的读-改-写，避免端点管理与 WebUI 设置的并发保存互相覆盖。
+var settingsFileMu sync.Mutex
+
+func settingsPath(dataDir string) string {
+	return filepath.Join(dataDir, "settings.json")
+}
+
+// SettingsPath 返回 settings.json 的路径。
+func SettingsPath() string {
+	return settingsPath(Get().DataDir)
+}
+
+// readSettingsFile 读取 settings.json；文件不存在时返回零值与 nil。
+func readSettingsFile(path string) (Settings, error) {
+	var s Settings
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return s, nil
+		}
+		return s, err
+	}
+	if err := jsonpkg.Unmarshal(data, &s); err != nil {
+		return s, fmt.Errorf("解析 %s 失败: %w", path, err)
+	}
+	return s, nil
+}
+
+// updateSettingsFile 读取 settings.json、交给 update 修改后原子地写回（先写临时文件再重命名）。
+// 文件无法解析时返回错误且不覆盖，避免丢失其中的其他设置。数据目录只读时（见 DataDirReadOnly）不写入，修改仅在内存中生效。
+func updateSettingsFile(path string, update func(*Settings)) error {
+	if DataDirReadOnly() {
+		return nil
+	}
+	settingsFileMu.Lock()
+	defer settingsFileMu.Unlock()
+
+	s, err := readSettingsFile(path)
+	if err != nil {
+		return err
+	}
+	update(&s)
+	s.Version = settingsFileVersion
+	s.UpdatedAt = time.Now()
+
+	data, err := jsonpkg.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	// settings.json 中包含管理密码与 API Key，仅允许属主读写。
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// applySettingsFile 在 Load 中调用：用 settings.json 中的 WebUI 设置覆盖 .env / 环境变量中的对应值。
+// 文件不存在或无法解析时保持原值（解析错误会在 MigrateDotEnvSettings 中报告）。
+func applySettingsFile(cfg *Config) {
+	s, err := readSettingsFile(settingsPath(cfg.DataDir))
+	if err != nil || s.WebUI == nil {
+		return
+	}
+	applyWebUISettings(cfg, *s.WebUI)
+}
+
+// dotEnvWebUIKeys 为 WebUI 设置在 .env 中对应的键。
+var dotEnvWebUIKeys = []string{
+	"API_KEY", "WEBUI_PASSWORD", "DEBUG", "API_USER_AGENT", "GEMINI3_MEDIA_RESOLUTION",
+	"QUOTA_REFRESH_INTERVAL_MINUTES", "QUOTA_LOW_THRESHOLD_PERCENT",
+}
+
+// MigrateDotEnvSettings 在启动时调用一次：settings.json 中还没有 WebUI 设置、而 .env 中设置了其中任意一项时，
+// 将当前生效的 WebUI 设置写入 settings.json（.env 保持不变）。返回是否发生了迁移。
+// 迁移后这些键以 settings.json 为准，之后修改 .env 中的对应项不再生效。
+func MigrateDotEnvSettings() (bool, error) {
+	path := SettingsPath()
+	s, err := readSettingsFile(path)
+	if err != nil {
+		return false, err
+	}
+	if s.WebUI != nil {
+		return false, nil
+	}
+	dotEnvPath, ok := findDotEnvPath()
+	if !ok {
+		return false, nil
+	}
+	lines, err := readDotEnvLines(dotEnvPath)
+	if err != nil {
+		return false, fmt.Errorf("无法读取 .env 文件: %w", err)
+	}
+	found := false
+	for _, line := range lines {
+		key, _, ok := parseDotEnvLine(line)
+		if ok && slices.Contains(dotEnvWebUIKeys, key) {
+			found = true
+			break
+		}
+	}
+	if !found {
+		return false, nil
+	}
+
+	current := GetWebUISettings()
+	if err := updateSettingsFile(path, func(s *Settings) {
+		if s.WebUI == nil {
+			s.WebUI = &current
+		}
+	}); err != nil {
+		return false, err
+	}
+	return true, nil
+}
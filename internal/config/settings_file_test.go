@@ -0,0 +1,79 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestUpdateSettingsFileKeepsOtherSections(t *testing.T) {
+	dir := t.TempDir()
+	path := settingsPath(dir)
+
+	// 旧版 settings.json 只有端点字段。
+	if err := os.WriteFile(path, []byte(`{"endpointMode":"production","currentEndpoint":"production"}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	webui := WebUISettings{APIKey: "sk-new", WebUIPassword: "pw", Debug: "low", QuotaLowThresholdPercent: 20}
+	if err := updateSettingsFile(path, func(s *Settings) { s.WebUI = &webui }); err != nil {
+		t.Fatalf("update: %v", err)
+	}
+	if err := updateSettingsFile(path, func(s *Settings) { s.EndpointMode = "daily" }); err != nil {
+		t.Fatalf("update: %v", err)
+	}
+
+	s, err := readSettingsFile(path)
+	if err != nil {
+		t.Fatalf("read: %v", err)
+	}
+	if s.Version != settingsFileVersion || s.EndpointMode != "daily" || s.CurrentEndpoint != "production" {
+		t.Fatalf("endpoint fields mismatch: %+v", s)
+	}
+	if s.WebUI == nil || *s.WebUI != webui {
+		t.Fatalf("webui section lost: %+v", s.WebUI)
+	}
+	if st, err := os.Stat(path); err != nil || st.Mode().Perm() != 0o600 {
+		t.Fatalf("expected 0600 settings file, got %v (%v)", st.Mode().Perm(), err)
+	}
+
+	cfg := &Config{DataDir: dir, APIKey: "sk-env", AdminPassword: "env"}
+	applySettingsFile(cfg)
+	if cfg.APIKey != "sk-new" || cfg.AdminPassword != "pw" || cfg.Debug != "low" || cfg.QuotaLowThresholdPercent != 20 {
+		t.Fatalf("settings.json should override env values: %+v", cfg)
+	}
+}
+
+func TestUpdateSettingsFileRefusesCorruptFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "settings.json")
+	if err := os.WriteFile(path, []byte("{broken"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := updateSettingsFile(path, func(s *Settings) { s.EndpointMode = "daily" }); err == nil {
+		t.Fatalf("expected error for corrupt settings.json")
+	}
+	if data, _ := os.ReadFile(path); string(data) != "{broken" {
+		t.Fatalf("corrupt file should be left untouched, got %q", data)
+	}
+}
+
+func TestEndpointManagerSetMode(t *testing.T) {
+	m := &EndpointManager{mode: "daily", settingsPath: settingsPath(t.TempDir())}
+	if err := m.SetMode("staging"); err == nil || m.GetMode() != "daily" {
+		t.Fatalf("unknown mode should be rejected: err=%v mode=%s", err, m.GetMode())
+	}
+	if err := m.SetMode("round-robin-dp"); err != nil {
+		t.Fatalf("set mode: %v", err)
+	}
+	if m.CurrentEndpointKey() != "daily" {
+		t.Fatalf("current = %s", m.CurrentEndpointKey())
+	}
+	m.GetActiveEndpoint()
+	if m.CurrentEndpointKey() != "production" {
+		t.Fatalf("current after one request = %s", m.CurrentEndpointKey())
+	}
+
+	s, err := readSettingsFile(m.settingsPath)
+	if err != nil || s.EndpointMode != "round-robin-dp" {
+		t.Fatalf("settings not persisted: %+v (%v)", s, err)
+	}
+}
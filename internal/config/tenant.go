@@ -0,0 +1,53 @@
+package config
+
+import (
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// tenantNameRe 限定租户名只含字母、数字、- 与 _，保证可以安全地用作目录名。
+var tenantNameRe = regexp.MustCompile(`^[A-Za-z0-9_-]{1,64}$`)
+
+// ValidTenantName 报告 name 是否为合法的租户名。
+func ValidTenantName(name string) bool { return tenantNameRe.MatchString(name) }
+
+// parseTenants 解析 TENANTS，例如："sk-alice=alice; sk-bob=bob; sk-bob-ci=bob"。
+// 每条用 ; 或 , 分隔，格式为 key=租户名；多个 key 可以属于同一租户，非法租户名会被忽略。
+func parseTenants(value string) map[string]string {
+	out := make(map[string]string)
+	for _, entry := range strings.FieldsFunc(value, func(r rune) bool { return r == ';' || r == ',' }) {
+		key, name, _ := strings.Cut(entry, "=")
+		key, name = strings.TrimSpace(key), strings.TrimSpace(name)
+		if key == "" || !ValidTenantName(name) {
+			continue
+		}
+		out[key] = name
+	}
+	if len(out) == 0 {
+		return nil
+	}
+	return out
+}
+
+// TenantDataDir 返回租户的数据目录：默认租户（空字符串）为 DATA_DIR，其他租户为 DATA_DIR/tenants/<租户名>。
+func TenantDataDir(tenant string) string {
+	dir := Get().DataDir
+	if tenant == "" {
+		return dir
+	}
+	return filepath.Join(dir, "tenants", tenant)
+}
+
+// TenantNames 返回配置中的全部租户名（去重，顺序不定）。
+func TenantNames() []string {
+	seen := make(map[string]bool)
+	var out []string
+	for _, name := range Get().Tenants {
+		if !seen[name] {
+			seen[name] = true
+			out = append(out, name)
+		}
+	}
+	return out
+}
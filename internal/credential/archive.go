@@ -0,0 +1,135 @@
+package credential
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/google/uuid"
+
+	"anti2api-golang/refactor/internal/logger"
+	"anti2api-golang/refactor/internal/pkg/id"
+	jsonpkg "anti2api-golang/refactor/internal/pkg/json"
+)
+
+// ArchivedAccount 是回收站中的账号：管理面板删除账号时不会直接丢弃 refresh_token，
+// 而是禁用后移入 accounts_archive.json，可恢复或彻底删除。
+type ArchivedAccount struct {
+	Account
+	ArchiveID string    `json:"archive_id"`
+	DeletedAt time.Time `json:"deleted_at"`
+}
+
+var ErrArchivedAccountNotFound = errors.New("回收站中未找到该账号")
+
+func archivePathFor(accountsPath string) string {
+	return filepath.Join(filepath.Dir(accountsPath), "accounts_archive.json")
+}
+
+func (s *Store) loadArchiveUnlocked() error {
+	s.archived = []ArchivedAccount{}
+	data, err := s.readDocument(archivePathFor(s.filePath))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	if err := jsonpkg.Unmarshal(data, &s.archived); err != nil {
+		s.archived = []ArchivedAccount{}
+		return err
+	}
+	return nil
+}
+
+func (s *Store) saveArchiveUnlocked() error {
+	data, err := jsonpkg.MarshalIndent(s.archived, "", "  ")
+	if err != nil {
+		return err
+	}
+	return s.writeDocument(archivePathFor(s.filePath), data)
+}
+
+// Archived 返回回收站中的账号（按删除时间倒序）。
+func (s *Store) Archived() []ArchivedAccount {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	result := make([]ArchivedAccount, len(s.archived))
+	copy(result, s.archived)
+	sort.SliceStable(result, func(i, j int) bool { return result[i].DeletedAt.After(result[j].DeletedAt) })
+	return result
+}
+
+// Restore 将回收站中的账号恢复到账号列表（保持禁用状态，由用户确认后再启用）。
+// 若账号列表中已存在相同邮箱或 refresh_token 的账号则拒绝恢复，避免覆盖更新的凭证。
+func (s *Store) Restore(archiveID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	idx := s.archiveIndexUnlocked(archiveID)
+	if idx < 0 {
+		return ErrArchivedAccountNotFound
+	}
+	account := s.archived[idx].Account
+	for _, a := range s.accounts {
+		if (account.Email != "" && a.Email == account.Email) ||
+			(account.RefreshToken != "" && a.RefreshToken == account.RefreshToken) {
+			return errors.New("账号列表中已存在相同账号，无法恢复")
+		}
+	}
+
+	account.Enable = false
+	account.SessionID = id.SessionID()
+	s.accounts = append(s.accounts, account)
+	if err := s.saveUnlocked(); err != nil {
+		s.accounts = s.accounts[:len(s.accounts)-1]
+		return err
+	}
+	s.archived = append(s.archived[:idx], s.archived[idx+1:]...)
+	if err := s.saveArchiveUnlocked(); err != nil {
+		logger.Warn("保存回收站失败: %v", err)
+	}
+	return nil
+}
+
+// Purge 从回收站彻底删除账号（refresh_token 将无法找回）。
+func (s *Store) Purge(archiveID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	idx := s.archiveIndexUnlocked(archiveID)
+	if idx < 0 {
+		return ErrArchivedAccountNotFound
+	}
+	s.archived = append(s.archived[:idx], s.archived[idx+1:]...)
+	return s.saveArchiveUnlocked()
+}
+
+func (s *Store) archiveIndexUnlocked(archiveID string) int {
+	if archiveID == "" {
+		return -1
+	}
+	for i, a := range s.archived {
+		if a.ArchiveID == archiveID {
+			return i
+		}
+	}
+	return -1
+}
+
+// archiveUnlocked 将账号禁用后放入回收站并持久化。
+func (s *Store) archiveUnlocked(account Account) error {
+	account.Enable = false
+	s.archived = append(s.archived, ArchivedAccount{
+		Account:   account,
+		ArchiveID: uuid.New().String(),
+		DeletedAt: time.Now(),
+	})
+	if err := s.saveArchiveUnlocked(); err != nil {
+		s.archived = s.archived[:len(s.archived)-1]
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,78 @@
+package credential
+
+import (
+	"bytes"
+	"net/http"
+	"time"
+
+	"anti2api-golang/refactor/internal/config"
+	"anti2api-golang/refactor/internal/logger"
+	jsonpkg "anti2api-golang/refactor/internal/pkg/json"
+)
+
+// DisableBySessionID 自动禁用 sessionID 对应的账号并记录原因，用于上游已明确拒绝该账号凭据的情况
+// （UNAUTHENTICATED 且强制刷新后仍被拒绝，或 refresh_token 已失效）。
+// 账号原本处于启用状态时返回 true，并通过 ACCOUNT_ALERT_WEBHOOK_URL 发送告警；重复调用不会重复告警。
+func (s *Store) DisableBySessionID(sessionID, reason string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for i := range s.accounts {
+		account := &s.accounts[i]
+		if account.SessionID != sessionID {
+			continue
+		}
+		if !account.Enable {
+			return false
+		}
+		account.Enable = false
+		account.DisabledReason = reason
+		account.DisabledAt = time.Now().UnixMilli()
+		if err := s.saveUnlocked(); err != nil {
+			logger.Warn("保存账号禁用状态失败: %v", err)
+		}
+		logger.Warn("账号 %s 已被自动禁用：%s，请在管理面板重新授权", account.Email, reason)
+		sendAccountDisabledAlert(*account)
+		return true
+	}
+	return false
+}
+
+type accountAlert struct {
+	Event     string    `json:"event"`
+	Email     string    `json:"email,omitempty"`
+	ProjectID string    `json:"projectId,omitempty"`
+	Reason    string    `json:"reason"`
+	Time      time.Time `json:"time"`
+}
+
+var accountAlertClient = &http.Client{Timeout: 5 * time.Second}
+
+// sendAccountDisabledAlert 在配置了 ACCOUNT_ALERT_WEBHOOK_URL（或 LOGIN_ALERT_WEBHOOK_URL）时异步发送账号禁用告警。
+func sendAccountDisabledAlert(account Account) {
+	url := config.Get().AccountAlertWebhookURL
+	if url == "" {
+		return
+	}
+	body, err := jsonpkg.Marshal(accountAlert{
+		Event:     "account_disabled",
+		Email:     account.Email,
+		ProjectID: account.ProjectID,
+		Reason:    account.DisabledReason,
+		Time:      time.UnixMilli(account.DisabledAt),
+	})
+	if err != nil {
+		return
+	}
+	go func() {
+		resp, err := accountAlertClient.Post(url, "application/json", bytes.NewReader(body))
+		if err != nil {
+			logger.Warn("账号告警 Webhook 调用失败: %v", err)
+			return
+		}
+		_ = resp.Body.Close()
+		if resp.StatusCode < 200 || resp.StatusCode > 299 {
+			logger.Warn("账号告警 Webhook 返回 HTTP %d", resp.StatusCode)
+		}
+	}()
+}
@@ -65,28 +65,12 @@ func ExchangeCodeForToken(code, redirectURI string) (*TokenResponse, error) {
 		"grant_type":    {"authorization_code"},
 	}
 
-	req, err := http.NewRequest(http.MethodPost, "https://oauth2.googleapis.com/token", strings.NewReader(data.Encode()))
+	status, body, err := postToken(data)
 	if err != nil {
 		return nil, err
 	}
-
-	cfg := config.Get()
-	req.Host = "oauth2.googleapis.com"
-	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
-	req.Header.Set("User-Agent", cfg.UserAgent)
-
-	resp, err := getOAuthHTTPClient().Do(req)
-	if err != nil {
-		return nil, err
-	}
-	defer resp.Body.Close()
-
-	body, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
-	if err != nil {
-		return nil, err
-	}
-	if resp.StatusCode != http.StatusOK {
-		logger.Warn("OAuth 交换 token 失败（HTTP %d）：%s", resp.StatusCode, string(body))
+	if status != http.StatusOK {
+		logger.Warn("OAuth 交换 token 失败（HTTP %d）：%s", status, string(body))
 		return nil, errors.New("交换 Token 失败：请确认授权码未过期，且 redirect_uri 与发起授权时一致")
 	}
 
@@ -98,6 +82,10 @@ func ExchangeCodeForToken(code, redirectURI string) (*TokenResponse, error) {
 	return &tokenResp, nil
 }
 
+// ErrRefreshRejected 表示 token 端点明确拒绝了 refresh_token（invalid_grant 等 400 / 401），
+// 通常意味着授权已被撤销，需要重新进行 OAuth 授权，与网络错误、端点不可用区分开。
+var ErrRefreshRejected = errors.New("刷新 Token 失败：refresh_token 已失效，需要重新授权")
+
 func RefreshToken(account *Account) error {
 	if account.RefreshToken == "" {
 		return errors.New("缺少 refresh_token")
@@ -110,28 +98,15 @@ func RefreshToken(account *Account) error {
 		"refresh_token": {account.RefreshToken},
 	}
 
-	req, err := http.NewRequest(http.MethodPost, "https://oauth2.googleapis.com/token", strings.NewReader(data.Encode()))
-	if err != nil {
-		return err
-	}
-
-	cfg := config.Get()
-	req.Host = "oauth2.googleapis.com"
-	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
-	req.Header.Set("User-Agent", cfg.UserAgent)
-
-	resp, err := getOAuthHTTPClient().Do(req)
-	if err != nil {
-		return err
-	}
-	defer resp.Body.Close()
-
-	body, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	status, body, err := postToken(data)
 	if err != nil {
 		return err
 	}
-	if resp.StatusCode != http.StatusOK {
-		logger.Warn("OAuth 刷新 token 失败（HTTP %d）：%s", resp.StatusCode, string(body))
+	if status != http.StatusOK {
+		logger.Warn("OAuth 刷新 token 失败（HTTP %d）：%s", status, string(body))
+		if status == http.StatusBadRequest || status == http.StatusUnauthorized {
+			return ErrRefreshRejected
+		}
 		return errors.New("刷新 Token 失败")
 	}
 
@@ -152,6 +127,54 @@ func RefreshToken(account *Account) error {
 	return nil
 }
 
+// postToken 向 OAUTH_TOKEN_URLS 中的 token 端点依次提交表单：网络错误、403、429 与 5xx 视为端点不可用，
+// 切换到下一个端点；其余响应（包括 invalid_grant 等 4xx）直接返回，由调用方处理。
+func postToken(data url.Values) (status int, body []byte, err error) {
+	endpoints := config.Get().OAuthTokenURLs
+	if len(endpoints) == 0 {
+		endpoints = []string{config.DefaultOAuthTokenURL}
+	}
+	for i, endpoint := range endpoints {
+		status, body, err = postTokenTo(endpoint, data)
+		if err == nil && !tokenEndpointUnavailable(status) {
+			return status, body, nil
+		}
+		if i < len(endpoints)-1 {
+			if err != nil {
+				logger.Warn("OAuth token 端点 %s 请求失败，切换到下一个端点：%v", endpoint, err)
+			} else {
+				logger.Warn("OAuth token 端点 %s 返回 HTTP %d，切换到下一个端点", endpoint, status)
+			}
+		}
+	}
+	return status, body, err
+}
+
+func tokenEndpointUnavailable(status int) bool {
+	return status == http.StatusForbidden || status == http.StatusTooManyRequests || status >= 500
+}
+
+func postTokenTo(endpoint string, data url.Values) (int, []byte, error) {
+	req, err := http.NewRequest(http.MethodPost, endpoint, strings.NewReader(data.Encode()))
+	if err != nil {
+		return 0, nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("User-Agent", config.Get().UserAgent)
+
+	resp, err := getOAuthHTTPClient().Do(req)
+	if err != nil {
+		return 0, nil, err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return 0, nil, err
+	}
+	return resp.StatusCode, body, nil
+}
+
 func GetUserInfo(accessToken string) (*UserInfo, error) {
 	accessToken = strings.TrimSpace(accessToken)
 	if accessToken == "" {
@@ -31,8 +31,13 @@ func getOAuthHTTPClient() *http.Client {
 			ForceAttemptHTTP2:     false,
 		}
 
-		if cfg.Proxy != "" {
-			if proxyURL, err := url.Parse(cfg.Proxy); err == nil {
+		// OAUTH_PROXY 单独控制凭证相关请求的代理：为空沿用 PROXY，direct 表示直连。
+		proxy := cfg.Proxy
+		if cfg.OAuthProxy != "" {
+			proxy = cfg.OAuthProxy
+		}
+		if proxy != "" && proxy != "direct" {
+			if proxyURL, err := url.Parse(proxy); err == nil {
 				transport.Proxy = http.ProxyURL(proxyURL)
 			}
 		}
@@ -1,6 +1,14 @@
 package credential
 
-import "testing"
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"anti2api-golang/refactor/internal/config"
+)
 
 func TestParseOAuthURL_AllowsMissingScheme(t *testing.T) {
 	code, state, err := ParseOAuthURL("localhost:8045/oauth-callback?state=s1&code=c1")
@@ -28,3 +36,52 @@ func TestParseOAuthURL_MissingCode(t *testing.T) {
 		t.Fatalf("expected error, got nil")
 	}
 }
+
+func TestRefreshTokenFailsOverToNextEndpoint(t *testing.T) {
+	var hits []string
+	down := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits = append(hits, "down")
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+	defer down.Close()
+	mirror := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits = append(hits, "mirror")
+		if err := r.ParseForm(); err != nil || r.PostForm.Get("refresh_token") != "rt" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		fmt.Fprint(w, `{"access_token":"at2","expires_in":3599}`)
+	}))
+	defer mirror.Close()
+
+	c := config.Get()
+	old := c.OAuthTokenURLs
+	c.OAuthTokenURLs = []string{down.URL, "http://127.0.0.1:1/token", mirror.URL}
+	t.Cleanup(func() { c.OAuthTokenURLs = old })
+
+	account := &Account{Email: "a@example.com", RefreshToken: "rt"}
+	if err := RefreshToken(account); err != nil {
+		t.Fatalf("RefreshToken: %v", err)
+	}
+	if account.AccessToken != "at2" || account.ExpiresIn != 3599 {
+		t.Fatalf("account not updated: %+v", account)
+	}
+	if strings.Join(hits, ",") != "down,mirror" {
+		t.Fatalf("unexpected endpoint order: %v", hits)
+	}
+
+	// invalid_grant 等 4xx 不切换端点。
+	bad := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits = append(hits, "bad")
+		w.WriteHeader(http.StatusBadRequest)
+	}))
+	defer bad.Close()
+	hits = nil
+	c.OAuthTokenURLs = []string{bad.URL, mirror.URL}
+	if err := RefreshToken(account); err == nil {
+		t.Fatalf("expected invalid_grant error")
+	}
+	if strings.Join(hits, ",") != "bad" {
+		t.Fatalf("4xx should not fail over: %v", hits)
+	}
+}
@@ -2,8 +2,10 @@ package credential
 
 import (
 	"errors"
+	"fmt"
 	"os"
 	"path/filepath"
+	"strings"
 	"sync"
 	"time"
 
@@ -11,13 +13,25 @@ import (
 	"anti2api-golang/refactor/internal/logger"
 	"anti2api-golang/refactor/internal/pkg/id"
 	jsonpkg "anti2api-golang/refactor/internal/pkg/json"
+	"anti2api-golang/refactor/internal/quota"
+	"anti2api-golang/refactor/internal/storage"
 )
 
 type Store struct {
 	mu           sync.RWMutex
 	accounts     []Account
+	archived     []ArchivedAccount
 	currentIndex int
 	filePath     string
+	// db 非空时账号与回收站保存在 SQLite 中（见 storage.For），filePath 只用于首次导入已有的 JSON 文件。
+	db *storage.DB
+
+	// lowQuota 记录配额即将耗尽的账号（按 SessionID），GetToken 轮询时排到最后使用。
+	lowQuota map[string]bool
+	// usage 记录各账号当天的请求数与 token 数（按 usageKey，见 usage_cap.go）；usageSave 为待执行的延迟保存，usageWriteMu 串行化保存。
+	usage        map[string]accountUsage
+	usageSave    *time.Timer
+	usageWriteMu sync.Mutex
 }
 
 var (
@@ -28,7 +42,7 @@ var (
 func GetStore() *Store {
 	storeOnce.Do(func() {
 		cfg := config.Get()
-		store = &Store{filePath: filepath.Join(cfg.DataDir, "accounts.json")}
+		store = &Store{filePath: filepath.Join(cfg.DataDir, "accounts.json"), db: storage.For(cfg.DataDir)}
 		_ = store.Load()
 	})
 	return store
@@ -42,8 +56,14 @@ func (s *Store) Load() error {
 	if err := os.MkdirAll(dir, 0o755); err != nil {
 		return err
 	}
+	if err := s.loadArchiveUnlocked(); err != nil {
+		logger.Warn("读取账号回收站失败: %v", err)
+	}
+	if err := s.loadUsageUnlocked(time.Now()); err != nil {
+		logger.Warn("读取账号每日用量失败: %v", err)
+	}
 
-	data, err := os.ReadFile(s.filePath)
+	data, err := s.readDocument(s.filePath)
 	if err != nil {
 		if os.IsNotExist(err) {
 			s.accounts = []Account{}
@@ -69,7 +89,41 @@ func (s *Store) saveUnlocked() error {
 	if err != nil {
 		return err
 	}
-	return os.WriteFile(s.filePath, data, 0o644)
+	return s.writeDocument(s.filePath, data)
+}
+
+// readDocument 读取 path 对应的 JSON 文档：启用 SQLite 时从 documents 表（按文件名）读取，
+// 表中还没有时读取原文件并导入（数据目录只读时不导入），之后以数据库为准。文档不存在时返回 os.ErrNotExist。
+func (s *Store) readDocument(path string) ([]byte, error) {
+	if s.db == nil {
+		return os.ReadFile(path)
+	}
+	name := filepath.Base(path)
+	data, ok, err := s.db.LoadDocument(name)
+	if err != nil || ok {
+		return data, err
+	}
+	data, err = os.ReadFile(path)
+	if err != nil || config.DataDirReadOnly() {
+		return data, err
+	}
+	if err := s.db.SaveDocument(name, data); err != nil {
+		return nil, err
+	}
+	logger.Info("已将 %s 导入 SQLite 存储", path)
+	return data, nil
+}
+
+// writeDocument 写入 path 对应的 JSON 文档（启用 SQLite 时写入 documents 表）。
+// 数据目录只读时不写入，修改仅保留在内存中直到重启。
+func (s *Store) writeDocument(path string, data []byte) error {
+	if config.DataDirReadOnly() {
+		return nil
+	}
+	if s.db == nil {
+		return os.WriteFile(path, data, 0o644)
+	}
+	return s.db.SaveDocument(filepath.Base(path), data)
 }
 
 func (s *Store) Save() error {
@@ -79,6 +133,66 @@ func (s *Store) Save() error {
 }
 
 func (s *Store) GetToken() (*Account, error) {
+	return s.getToken(nil)
+}
+
+// GetTokenInPool 与 GetToken 相同，但配置了 IMAGE_ACCOUNTS 时只在对应的账号池中轮询：
+// image 为 true 时只使用图像专用账号，否则跳过它们。未配置时等同于 GetToken。
+func (s *Store) GetTokenInPool(image bool) (*Account, error) {
+	return s.GetTokenForModel("", image)
+}
+
+// GetTokenForModel 与 GetTokenInPool 相同，并按账号模型可用性（见 quota.Available）跳过已知无法使用 model 的账号。
+// 只有当某个账号的有效快照列出了 model 时才过滤，没有任何账号列出的模型不受影响。
+// 图像专用账号当天都已达到每日用量上限时，图像请求回退到普通账号。
+func (s *Store) GetTokenForModel(model string, image bool) (*Account, error) {
+	cfg := config.Get()
+	var modelAllow func(*Account) bool
+	maxAge := time.Duration(cfg.ModelAvailabilityMinutes) * time.Minute
+	filterModel := model != "" && maxAge > 0 && quota.Listed(model, maxAge)
+	if filterModel {
+		modelAllow = func(a *Account) bool {
+			ok, known := quota.Available(a.SessionID, model, maxAge)
+			return ok || !known
+		}
+	}
+
+	allow := modelAllow
+	pool := cfg.ImageAccounts
+	if len(pool) > 0 {
+		allow = func(a *Account) bool {
+			return IsImageAccount(pool, a) == image && (modelAllow == nil || modelAllow(a))
+		}
+	}
+	acc, err := s.getToken(allow)
+	if image && len(pool) > 0 && errors.Is(err, ErrDailyCapReached) {
+		acc, err = s.getToken(modelAllow)
+	}
+	switch {
+	case err == nil:
+		return acc, nil
+	case errors.Is(err, ErrDailyCapReached):
+		return nil, err
+	case filterModel:
+		return nil, fmt.Errorf("没有可以使用模型 %s 的可用账号", model)
+	case image && len(pool) > 0:
+		return nil, errors.New("没有可用的图像专用账号（IMAGE_ACCOUNTS）")
+	}
+	return nil, err
+}
+
+// IsImageAccount 判断账号是否属于 pool（按邮箱或 projectId 匹配，忽略大小写）。
+func IsImageAccount(pool []string, a *Account) bool {
+	for _, v := range pool {
+		if v != "" && (strings.EqualFold(v, a.Email) || strings.EqualFold(v, a.ProjectID)) {
+			return true
+		}
+	}
+	return false
+}
+
+// getToken 轮询获取可用账号；allow 非 nil 时跳过不满足条件的账号。
+func (s *Store) getToken(allow func(*Account) bool) (*Account, error) {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
@@ -86,29 +200,69 @@ func (s *Store) GetToken() (*Account, error) {
 		return nil, errors.New("没有可用的账号")
 	}
 
-	nowMs := time.Now().UnixMilli()
-	for attempts := 0; attempts < len(s.accounts); attempts++ {
-		account := &s.accounts[s.currentIndex]
-		s.currentIndex = (s.currentIndex + 1) % len(s.accounts)
-
-		if !account.Enable {
-			continue
-		}
-
-		if account.IsExpired(nowMs) {
-			if err := RefreshToken(account); err != nil {
+	now := time.Now()
+	nowMs := now.UnixMilli()
+	var refreshFailed map[*Account]bool
+	capped := false
+	// 第一轮跳过配额即将耗尽的账号，都不可用时第二轮再使用它们。
+	for pass := 0; pass < 2; pass++ {
+		for attempts := 0; attempts < len(s.accounts); attempts++ {
+			account := &s.accounts[s.currentIndex]
+			s.currentIndex = (s.currentIndex + 1) % len(s.accounts)
+
+			if !account.Enable || refreshFailed[account] {
+				continue
+			}
+			if allow != nil && !allow(account) {
+				continue
+			}
+			if s.dailyUsageUnlocked(account, now).Exceeded {
+				capped = true
+				continue
+			}
+			if pass == 0 && s.lowQuota[account.SessionID] {
 				continue
 			}
-			_ = s.saveUnlocked()
-		}
 
-		copyAccount := *account
-		return &copyAccount, nil
+			if account.IsExpired(nowMs) {
+				if err := RefreshToken(account); err != nil {
+					if refreshFailed == nil {
+						refreshFailed = make(map[*Account]bool)
+					}
+					refreshFailed[account] = true
+					continue
+				}
+				_ = s.saveUnlocked()
+			}
+
+			copyAccount := *account
+			return &copyAccount, nil
+		}
+		if len(s.lowQuota) == 0 {
+			break
+		}
 	}
 
+	if capped {
+		return nil, ErrDailyCapReached
+	}
 	return nil, errors.New("没有可用的 token")
 }
 
+// SetLowQuota 替换配额即将耗尽的账号集合（按 SessionID）。
+func (s *Store) SetLowQuota(sessionIDs map[string]bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.lowQuota = sessionIDs
+}
+
+// IsLowQuota 报告账号是否被标记为配额即将耗尽。
+func (s *Store) IsLowQuota(sessionID string) bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.lowQuota[sessionID]
+}
+
 func (s *Store) GetTokenByProjectID(projectID string) (*Account, error) {
 	s.mu.Lock()
 	defer s.mu.Unlock()
@@ -131,6 +285,51 @@ func (s *Store) GetTokenByProjectID(projectID string) (*Account, error) {
 	return nil, errors.New("未找到指定的账号")
 }
 
+// GetTokenBySessionID 返回 sessionID 对应账号的副本（不论是否启用），token 过期时先刷新；供管理面板对指定账号发起请求。
+func (s *Store) GetTokenBySessionID(sessionID string) (*Account, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for i := range s.accounts {
+		account := &s.accounts[i]
+		if account.SessionID != sessionID {
+			continue
+		}
+		if account.IsExpired(time.Now().UnixMilli()) {
+			if err := RefreshToken(account); err != nil {
+				return nil, err
+			}
+			_ = s.saveUnlocked()
+		}
+		copyAccount := *account
+		return &copyAccount, nil
+	}
+
+	return nil, errors.New("未找到指定的账号")
+}
+
+// RefreshBySessionID 强制刷新 sessionID 对应账号的 access token（不论是否临近过期），返回刷新后的副本。
+// 用于上游以 401 拒绝了本地认为仍有效的 token 的情况（例如 token 已被吊销）。
+func (s *Store) RefreshBySessionID(sessionID string) (*Account, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for i := range s.accounts {
+		account := &s.accounts[i]
+		if account.SessionID != sessionID {
+			continue
+		}
+		if err := RefreshToken(account); err != nil {
+			return nil, err
+		}
+		_ = s.saveUnlocked()
+		copyAccount := *account
+		return &copyAccount, nil
+	}
+
+	return nil, errors.New("未找到指定的账号")
+}
+
 func (s *Store) GetAll() []Account {
 	s.mu.RLock()
 	defer s.mu.RUnlock()
@@ -165,6 +364,47 @@ func (s *Store) Clear() error {
 	return s.saveUnlocked()
 }
 
+// Replace 用 accounts 与 archived 整体替换账号列表和回收站并持久化（用于从备份恢复）。
+func (s *Store) Replace(accounts []Account, archived []ArchivedAccount) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if accounts == nil {
+		accounts = []Account{}
+	}
+	if archived == nil {
+		archived = []ArchivedAccount{}
+	}
+	for i := range accounts {
+		accounts[i].SessionID = id.SessionID()
+	}
+	s.accounts = accounts
+	s.archived = archived
+	s.currentIndex = 0
+	s.lowQuota = nil
+	if err := s.saveUnlocked(); err != nil {
+		return err
+	}
+	return s.saveArchiveUnlocked()
+}
+
+// SaveFiles 将账号列表与回收站写入 JSON 文件（即使启用了 SQLite），供替换数据库后重新导入。
+func (s *Store) SaveFiles() error {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	for path, v := range map[string]any{s.filePath: s.accounts, archivePathFor(s.filePath): s.archived} {
+		data, err := jsonpkg.MarshalIndent(v, "", "  ")
+		if err != nil {
+			return err
+		}
+		if err := os.WriteFile(path, data, 0o644); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 func (s *Store) Add(account Account) error {
 	s.mu.Lock()
 	defer s.mu.Unlock()
@@ -187,6 +427,7 @@ func (s *Store) Add(account Account) error {
 	return s.saveUnlocked()
 }
 
+// Delete 将账号从账号列表移入回收站（见 Restore / Purge）。
 func (s *Store) Delete(index int) error {
 	s.mu.Lock()
 	defer s.mu.Unlock()
@@ -194,6 +435,9 @@ func (s *Store) Delete(index int) error {
 	if index < 0 || index >= len(s.accounts) {
 		return errors.New("索引超出范围")
 	}
+	if err := s.archiveUnlocked(s.accounts[index]); err != nil {
+		return err
+	}
 
 	s.accounts = append(s.accounts[:index], s.accounts[index+1:]...)
 	if s.currentIndex >= len(s.accounts) {
@@ -211,6 +455,10 @@ func (s *Store) SetEnable(index int, enable bool) error {
 	}
 
 	s.accounts[index].Enable = enable
+	if enable {
+		s.accounts[index].DisabledReason = ""
+		s.accounts[index].DisabledAt = 0
+	}
 	return s.saveUnlocked()
 }
 
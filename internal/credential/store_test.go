@@ -1,8 +1,13 @@
 package credential
 
 import (
+	"os"
+	"path/filepath"
 	"testing"
 	"time"
+
+	"anti2api-golang/refactor/internal/config"
+	"anti2api-golang/refactor/internal/quota"
 )
 
 func TestStoreGetToken_RoundRobinSequential(t *testing.T) {
@@ -62,3 +67,254 @@ func TestStoreGetToken_SkipsDisabled(t *testing.T) {
 	}
 }
 
+
+func TestStoreDelete_ArchivesAndRestores(t *testing.T) {
+	s := &Store{
+		filePath: filepath.Join(t.TempDir(), "accounts.json"),
+		accounts: []Account{
+			{Email: "a@example.com", RefreshToken: "r1", Enable: true},
+			{Email: "b@example.com", RefreshToken: "r2", Enable: true},
+		},
+	}
+
+	if err := s.Delete(0); err != nil {
+		t.Fatalf("Delete error: %v", err)
+	}
+	if s.Count() != 1 {
+		t.Fatalf("expected 1 account after delete, got %d", s.Count())
+	}
+	archived := s.Archived()
+	if len(archived) != 1 || archived[0].RefreshToken != "r1" || archived[0].Enable || archived[0].ArchiveID == "" {
+		t.Fatalf("unexpected archive %+v", archived)
+	}
+
+	// 回收站单独持久化，重新加载后仍然存在。
+	reloaded := &Store{filePath: s.filePath}
+	if err := reloaded.Load(); err != nil {
+		t.Fatalf("Load error: %v", err)
+	}
+	if got := reloaded.Archived(); len(got) != 1 || got[0].ArchiveID != archived[0].ArchiveID {
+		t.Fatalf("archive not persisted: %+v", got)
+	}
+
+	if err := s.Restore(archived[0].ArchiveID); err != nil {
+		t.Fatalf("Restore error: %v", err)
+	}
+	all := s.GetAll()
+	if len(all) != 2 || all[1].RefreshToken != "r1" || all[1].Enable || all[1].SessionID == "" {
+		t.Fatalf("unexpected accounts after restore %+v", all)
+	}
+	if len(s.Archived()) != 0 {
+		t.Fatalf("expected empty archive after restore")
+	}
+	if err := s.Restore(archived[0].ArchiveID); err != ErrArchivedAccountNotFound {
+		t.Fatalf("expected ErrArchivedAccountNotFound, got %v", err)
+	}
+}
+
+func TestStorePurge(t *testing.T) {
+	s := &Store{
+		filePath: filepath.Join(t.TempDir(), "accounts.json"),
+		accounts: []Account{{Email: "a@example.com", RefreshToken: "r1", Enable: true}},
+	}
+	if err := s.Delete(0); err != nil {
+		t.Fatalf("Delete error: %v", err)
+	}
+	// 已存在相同账号时拒绝恢复。
+	_ = s.Add(Account{Email: "a@example.com", RefreshToken: "r1-new", Enable: true})
+	archived := s.Archived()
+	if err := s.Restore(archived[0].ArchiveID); err == nil {
+		t.Fatalf("expected restore to be rejected for duplicate account")
+	}
+	if err := s.Purge(archived[0].ArchiveID); err != nil {
+		t.Fatalf("Purge error: %v", err)
+	}
+	if len(s.Archived()) != 0 {
+		t.Fatalf("expected empty archive after purge")
+	}
+}
+
+func TestStoreGetToken_LowQuotaUsedLast(t *testing.T) {
+	now := time.Now().UnixMilli()
+	s := &Store{
+		accounts: []Account{
+			{AccessToken: "t1", SessionID: "s1", ExpiresIn: 3600, Timestamp: now, Enable: true},
+			{AccessToken: "t2", SessionID: "s2", ExpiresIn: 3600, Timestamp: now, Enable: true},
+			{AccessToken: "t3", SessionID: "s3", ExpiresIn: 3600, Timestamp: now, Enable: true},
+		},
+	}
+	s.SetLowQuota(map[string]bool{"s1": true})
+
+	got := make([]string, 0, 4)
+	for i := 0; i < 4; i++ {
+		acc, err := s.GetToken()
+		if err != nil {
+			t.Fatalf("GetToken error: %v", err)
+		}
+		got = append(got, acc.AccessToken)
+	}
+	want := []string{"t2", "t3", "t2", "t3"}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("low quota order mismatch at %d: got %q want %q (all=%v)", i, got[i], want[i], got)
+		}
+	}
+
+	// 其余账号都不可用时仍会使用低配额账号。
+	s.SetLowQuota(map[string]bool{"s1": true, "s2": true, "s3": true})
+	if acc, err := s.GetToken(); err != nil || acc.AccessToken == "" {
+		t.Fatalf("expected low quota account as last resort, got %v, %v", acc, err)
+	}
+}
+
+func TestStoreGetTokenInPool_SeparatesImageAccounts(t *testing.T) {
+	c := config.Get()
+	old := c.ImageAccounts
+	t.Cleanup(func() { c.ImageAccounts = old })
+
+	now := time.Now().UnixMilli()
+	s := &Store{
+		accounts: []Account{
+			{AccessToken: "t1", Email: "text@example.com", ExpiresIn: 3600, Timestamp: now, Enable: true},
+			{AccessToken: "img", Email: "Image@example.com", ExpiresIn: 3600, Timestamp: now, Enable: true},
+			{AccessToken: "t2", ProjectID: "proj-2", ExpiresIn: 3600, Timestamp: now, Enable: true},
+		},
+	}
+
+	c.ImageAccounts = nil
+	if acc, err := s.GetTokenInPool(true); err != nil || acc.AccessToken != "t1" {
+		t.Fatalf("without IMAGE_ACCOUNTS any account should be used: %v %v", acc, err)
+	}
+
+	c.ImageAccounts = []string{"image@example.com"}
+	for i := 0; i < 4; i++ {
+		acc, err := s.GetTokenInPool(false)
+		if err != nil || acc.AccessToken == "img" {
+			t.Fatalf("text request landed on image account: %v %v", acc, err)
+		}
+		if acc, err := s.GetTokenInPool(true); err != nil || acc.AccessToken != "img" {
+			t.Fatalf("image request should use the image account: %v %v", acc, err)
+		}
+	}
+
+	c.ImageAccounts = []string{"missing@example.com"}
+	if _, err := s.GetTokenInPool(true); err == nil {
+		t.Fatal("image request must not fall back to text accounts")
+	}
+}
+
+func TestStoreGetTokenForModel_SkipsAccountsWithoutModel(t *testing.T) {
+	c := config.Get()
+	old := c.ModelAvailabilityMinutes
+	c.ModelAvailabilityMinutes = 60
+	t.Cleanup(func() { c.ModelAvailabilityMinutes = old; quota.Reset() })
+	quota.Reset()
+
+	now := time.Now().UnixMilli()
+	s := &Store{
+		accounts: []Account{
+			{SessionID: "a1", AccessToken: "no-claude", ExpiresIn: 3600, Timestamp: now, Enable: true},
+			{SessionID: "a2", AccessToken: "claude", ExpiresIn: 3600, Timestamp: now, Enable: true},
+			{SessionID: "a3", AccessToken: "unknown", ExpiresIn: 3600, Timestamp: now, Enable: true},
+		},
+	}
+	quota.Put("a1", []quota.Group{{GroupName: "g", ModelList: []string{"gemini-2.5-flash"}}}, time.Now())
+	quota.Put("a2", []quota.Group{{GroupName: "g", ModelList: []string{"gemini-2.5-flash", "claude-sonnet-4-5"}}}, time.Now())
+
+	for i := 0; i < 6; i++ {
+		acc, err := s.GetTokenForModel("claude-sonnet-4-5", false)
+		if err != nil || acc.AccessToken == "no-claude" {
+			t.Fatalf("account without the model was selected: %v %v", acc, err)
+		}
+	}
+
+	// 没有任何账号列出的模型不做过滤。
+	seen := map[string]bool{}
+	for i := 0; i < 3; i++ {
+		acc, err := s.GetTokenForModel("brand-new-model", false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		seen[acc.AccessToken] = true
+	}
+	if len(seen) != 3 {
+		t.Fatalf("unlisted model should rotate over all accounts, got %v", seen)
+	}
+
+	s.accounts[1].Enable = false
+	s.accounts[2].Enable = false
+	if _, err := s.GetTokenForModel("claude-sonnet-4-5", false); err == nil {
+		t.Fatal("expected no account: only a2 can serve the model and it is disabled")
+	}
+
+	// 过期的快照不再参与过滤。
+	quota.Put("a1", []quota.Group{{GroupName: "g", ModelList: []string{"gemini-2.5-flash"}}}, time.Now().Add(-2*time.Hour))
+	if acc, err := s.GetTokenForModel("claude-sonnet-4-5", false); err != nil || acc.AccessToken != "no-claude" {
+		t.Fatalf("stale snapshot must not exclude the account: %v %v", acc, err)
+	}
+}
+
+func TestStoreDisableBySessionID(t *testing.T) {
+	cfg := config.Get()
+	oldURL := cfg.AccountAlertWebhookURL
+	cfg.AccountAlertWebhookURL = ""
+	t.Cleanup(func() { cfg.AccountAlertWebhookURL = oldURL })
+
+	s := &Store{
+		filePath: filepath.Join(t.TempDir(), "accounts.json"),
+		accounts: []Account{{SessionID: "a1", Email: "a1@example.com", Enable: true}},
+	}
+	if s.DisableBySessionID("missing", "x") {
+		t.Fatal("unknown session should not be disabled")
+	}
+	if !s.DisableBySessionID("a1", "refresh_token 已失效") {
+		t.Fatal("expected account to be disabled")
+	}
+	acc := s.GetAll()[0]
+	if acc.Enable || acc.DisabledReason != "refresh_token 已失效" || acc.DisabledAt == 0 {
+		t.Fatalf("unexpected account state: %+v", acc)
+	}
+	if s.DisableBySessionID("a1", "again") {
+		t.Fatal("already disabled account should not be reported again")
+	}
+	if _, err := s.GetToken(); err == nil {
+		t.Fatal("disabled account should not be selected")
+	}
+
+	if err := s.SetEnable(0, true); err != nil {
+		t.Fatal(err)
+	}
+	if acc := s.GetAll()[0]; !acc.Enable || acc.DisabledReason != "" || acc.DisabledAt != 0 {
+		t.Fatalf("re-enabling should clear the reason: %+v", acc)
+	}
+}
+
+func TestStoreSave_SkippedWhenDataDirReadOnly(t *testing.T) {
+	c := config.Get()
+	old := c.DataDir
+	t.Cleanup(func() {
+		c.DataDir = t.TempDir()
+		_ = config.CheckDataDirWritable()
+		c.DataDir = old
+	})
+
+	file := filepath.Join(t.TempDir(), "file")
+	if err := os.WriteFile(file, nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	c.DataDir = filepath.Join(file, "data")
+	if err := config.CheckDataDirWritable(); err == nil || !config.DataDirReadOnly() {
+		t.Fatal("expected read-only mode")
+	}
+
+	s := &Store{filePath: filepath.Join(t.TempDir(), "accounts.json")}
+	if err := s.Add(Account{Email: "a@example.com", RefreshToken: "r1", Enable: true}); err != nil {
+		t.Fatalf("Add should succeed in memory, got %v", err)
+	}
+	if s.Count() != 1 {
+		t.Fatalf("expected account kept in memory, got %d", s.Count())
+	}
+	if _, err := os.Stat(s.filePath); !os.IsNotExist(err) {
+		t.Fatalf("accounts.json should not be written in read-only mode, stat err=%v", err)
+	}
+}
@@ -12,6 +12,16 @@ type Account struct {
 	Enable       bool      `json:"enable"`
 	CreatedAt    time.Time `json:"created_at"`
 	SessionID    string    `json:"-"`
+
+	// DisabledReason 为账号被自动禁用的原因（例如上游持续返回 UNAUTHENTICATED），手动启用或重新授权后清空。
+	DisabledReason string `json:"disabledReason,omitempty"`
+	// DisabledAt 为自动禁用的时间（毫秒时间戳）。
+	DisabledAt int64 `json:"disabledAt,omitempty"`
+
+	// DailyRequestCap / DailyTokenCap 为该账号单独设置的每日请求数 / token 数上限：0 沿用
+	// ACCOUNT_DAILY_REQUEST_CAP / ACCOUNT_DAILY_TOKEN_CAP，负数表示不限制（见 Store.DailyUsage）。
+	DailyRequestCap int `json:"dailyRequestCap,omitempty"`
+	DailyTokenCap   int `json:"dailyTokenCap,omitempty"`
 }
 
 func (a *Account) IsExpired(nowMs int64) bool {
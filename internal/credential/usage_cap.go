@@ -0,0 +1,224 @@
+package credential
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"anti2api-golang/refactor/internal/config"
+	"anti2api-golang/refactor/internal/logger"
+	jsonpkg "anti2api-golang/refactor/internal/pkg/json"
+)
+
+// ErrDailyCapReached 为所有可用账号都已达到每日用量上限时 GetToken 返回的错误。
+var ErrDailyCapReached = errors.New("所有可用账号都已达到每日用量上限（ACCOUNT_DAILY_REQUEST_CAP / ACCOUNT_DAILY_TOKEN_CAP），将在 UTC+8 0 点重置")
+
+// usageSaveDelay 为累计用量后延迟写入 account_usage.json 的时间，合并短时间内的多次写入。
+const usageSaveDelay = 5 * time.Second
+
+// accountUsage 为账号在 Day（UTC+8 日期）的用量，按 usageKey 保存在 account_usage.json 中，
+// 进程重启或从备份恢复账号（Replace）后不会清零。
+type accountUsage struct {
+	Day      string `json:"day"`
+	Requests int    `json:"requests"`
+	Tokens   int    `json:"tokens"`
+}
+
+// DailyUsage 为账号当天的用量与上限（上限为 0 表示不限制）。
+type DailyUsage struct {
+	Requests   int       `json:"requests"`
+	Tokens     int       `json:"tokens"`
+	RequestCap int       `json:"requestCap"`
+	TokenCap   int       `json:"tokenCap"`
+	Exceeded   bool      `json:"exceeded"`
+	ResetAt    time.Time `json:"resetAt"`
+}
+
+func usageDay(t time.Time) string {
+	return t.In(ChinaTimezone).Format("2006-01-02")
+}
+
+// nextUsageReset 返回 t 之后的下一个 UTC+8 0 点。
+func nextUsageReset(t time.Time) time.Time {
+	y, m, d := t.In(ChinaTimezone).Date()
+	return time.Date(y, m, d+1, 0, 0, 0, 0, ChinaTimezone)
+}
+
+// usageKey 返回账号用量的稳定标识：SessionID 在每次加载时重新生成，因此按邮箱，
+// 没有邮箱时按 refresh_token 的哈希记录。
+func usageKey(a *Account) string {
+	if email := strings.ToLower(strings.TrimSpace(a.Email)); email != "" {
+		return email
+	}
+	if a.RefreshToken != "" {
+		sum := sha256.Sum256([]byte(a.RefreshToken))
+		return "rt:" + hex.EncodeToString(sum[:8])
+	}
+	return "session:" + a.SessionID
+}
+
+func usagePathFor(accountsPath string) string {
+	return filepath.Join(filepath.Dir(accountsPath), "account_usage.json")
+}
+
+// loadUsageUnlocked 读取 account_usage.json，只保留当天的用量。
+func (s *Store) loadUsageUnlocked(now time.Time) error {
+	s.usage = make(map[string]accountUsage)
+	data, err := s.readDocument(usagePathFor(s.filePath))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	var saved map[string]accountUsage
+	if err := jsonpkg.Unmarshal(data, &saved); err != nil {
+		return err
+	}
+	day := usageDay(now)
+	for key, au := range saved {
+		if au.Day == day {
+			s.usage[key] = au
+		}
+	}
+	return nil
+}
+
+// scheduleUsageSaveUnlocked 在 usageSaveDelay 后保存用量；DATA_DIR 只读或未配置存储位置（测试中直接构造的 Store）时不保存。
+func (s *Store) scheduleUsageSaveUnlocked() {
+	if s.usageSave != nil || (s.filePath == "" && s.db == nil) || config.DataDirReadOnly() {
+		return
+	}
+	s.usageSave = time.AfterFunc(usageSaveDelay, func() {
+		if err := s.saveUsage(); err != nil {
+			logger.Warn("保存账号每日用量失败: %v", err)
+		}
+	})
+}
+
+// saveUsage 在持有 s.mu 时序列化当天的用量，释放锁之后再写入，避免磁盘 I/O 阻塞选取账号。
+// usageWriteMu 保证多次保存按序列化的先后写入。
+func (s *Store) saveUsage() error {
+	s.usageWriteMu.Lock()
+	defer s.usageWriteMu.Unlock()
+
+	s.mu.Lock()
+	s.usageSave = nil
+	day := usageDay(time.Now())
+	today := make(map[string]accountUsage, len(s.usage))
+	for key, au := range s.usage {
+		if au.Day == day {
+			today[key] = au
+		}
+	}
+	s.mu.Unlock()
+
+	data, err := jsonpkg.MarshalIndent(today, "", "  ")
+	if err != nil {
+		return err
+	}
+	return s.writeDocument(usagePathFor(s.filePath), data)
+}
+
+// dailyCaps 返回账号生效的每日请求数与 token 数上限（0 表示不限制）。
+func (a *Account) dailyCaps() (requests, tokens int) {
+	cfg := config.Get()
+	return effectiveCap(a.DailyRequestCap, cfg.AccountDailyRequestCap), effectiveCap(a.DailyTokenCap, cfg.AccountDailyTokenCap)
+}
+
+func effectiveCap(own, global int) int {
+	if own != 0 {
+		return max(own, 0)
+	}
+	return max(global, 0)
+}
+
+// dailyUsageUnlocked 返回账号在 now 当天的用量；调用方需持有 s.mu。
+func (s *Store) dailyUsageUnlocked(a *Account, now time.Time) DailyUsage {
+	u := DailyUsage{ResetAt: nextUsageReset(now)}
+	u.RequestCap, u.TokenCap = a.dailyCaps()
+	if au, ok := s.usage[usageKey(a)]; ok && au.Day == usageDay(now) {
+		u.Requests, u.Tokens = au.Requests, au.Tokens
+	}
+	u.Exceeded = u.overCap()
+	return u
+}
+
+func (u DailyUsage) overCap() bool {
+	return (u.RequestCap > 0 && u.Requests >= u.RequestCap) || (u.TokenCap > 0 && u.Tokens >= u.TokenCap)
+}
+
+// DailyUsage 返回 sessionID 对应账号当天的用量与上限；账号不存在时返回零值。
+func (s *Store) DailyUsage(sessionID string) DailyUsage {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	for i := range s.accounts {
+		if s.accounts[i].SessionID == sessionID {
+			return s.dailyUsageUnlocked(&s.accounts[i], time.Now())
+		}
+	}
+	return DailyUsage{}
+}
+
+// RecordUsage 为 sessionID 对应的账号累计一次请求及其 token 数（输入+输出）；达到每日上限时记录日志，
+// 之后 GetToken 在次日 UTC+8 0 点前跳过该账号。账号没有生效的上限时不记录。
+func (s *Store) RecordUsage(sessionID string, tokens int) {
+	if sessionID == "" {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for i := range s.accounts {
+		account := &s.accounts[i]
+		if account.SessionID != sessionID {
+			continue
+		}
+		// 未设置任何上限的账号不记录用量，也不触发保存。
+		if requests, tokens := account.dailyCaps(); requests == 0 && tokens == 0 {
+			return
+		}
+
+		now := time.Now()
+		before := s.dailyUsageUnlocked(account, now)
+		key, day := usageKey(account), usageDay(now)
+		au := s.usage[key]
+		if au.Day != day {
+			au = accountUsage{Day: day}
+		}
+		au.Requests++
+		au.Tokens += max(tokens, 0)
+		if s.usage == nil {
+			s.usage = make(map[string]accountUsage)
+		}
+		s.usage[key] = au
+		s.scheduleUsageSaveUnlocked()
+
+		if u := s.dailyUsageUnlocked(account, now); u.Exceeded && !before.Exceeded {
+			logger.Warn("账号 %s 已达到每日用量上限（请求 %d/%d，tokens %d/%d），%s 前不再使用",
+				account.Email, u.Requests, u.RequestCap, u.Tokens, u.TokenCap, u.ResetAt.Format("2006-01-02 15:04"))
+		}
+		return
+	}
+}
+
+// SetDailyCaps 设置 sessionID 对应账号的每日请求数 / token 数上限（0 沿用全局配置，负数表示不限制）并保存。
+func (s *Store) SetDailyCaps(sessionID string, requests, tokens int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for i := range s.accounts {
+		account := &s.accounts[i]
+		if account.SessionID != sessionID {
+			continue
+		}
+		account.DailyRequestCap = requests
+		account.DailyTokenCap = tokens
+		return s.saveUnlocked()
+	}
+	return errors.New("未找到指定的账号")
+}
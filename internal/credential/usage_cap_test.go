@@ -0,0 +1,200 @@
+package credential
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"anti2api-golang/refactor/internal/config"
+)
+
+func TestStoreGetToken_SkipsAccountsOverDailyCap(t *testing.T) {
+	cfg := config.Get()
+	oldRequests, oldTokens := cfg.AccountDailyRequestCap, cfg.AccountDailyTokenCap
+	t.Cleanup(func() { cfg.AccountDailyRequestCap, cfg.AccountDailyTokenCap = oldRequests, oldTokens })
+	cfg.AccountDailyRequestCap, cfg.AccountDailyTokenCap = 2, 0
+
+	now := time.Now().UnixMilli()
+	s := &Store{
+		accounts: []Account{
+			{AccessToken: "t1", ExpiresIn: 3600, Timestamp: now, Enable: true, SessionID: "s1"},
+			{AccessToken: "t2", ExpiresIn: 3600, Timestamp: now, Enable: true, SessionID: "s2", DailyTokenCap: 100},
+			{AccessToken: "t3", ExpiresIn: 3600, Timestamp: now, Enable: true, SessionID: "s3", DailyRequestCap: -1},
+		},
+	}
+
+	s.RecordUsage("s1", 10)
+	s.RecordUsage("s1", 10)
+	s.RecordUsage("s2", 150)
+	if u := s.DailyUsage("s1"); !u.Exceeded || u.Requests != 2 || u.Tokens != 20 || u.RequestCap != 2 {
+		t.Fatalf("unexpected usage for s1: %+v", u)
+	}
+	if u := s.DailyUsage("s2"); !u.Exceeded || u.TokenCap != 100 {
+		t.Fatalf("unexpected usage for s2: %+v", u)
+	}
+
+	for i := 0; i < 3; i++ {
+		acc, err := s.GetToken()
+		if err != nil {
+			t.Fatalf("GetToken error: %v", err)
+		}
+		if acc.AccessToken != "t3" {
+			t.Fatalf("expected only uncapped account t3, got %q", acc.AccessToken)
+		}
+		s.RecordUsage(acc.SessionID, 1000)
+	}
+
+	// 不限制的账号不记录用量；改为沿用全局上限后重新计数。
+	s.accounts[2].DailyRequestCap = 0
+	if u := s.DailyUsage("s3"); u.Requests != 0 {
+		t.Fatalf("usage of an uncapped account should not be tracked: %+v", u)
+	}
+	s.RecordUsage("s3", 10)
+	s.RecordUsage("s3", 10)
+	if _, err := s.GetToken(); !errors.Is(err, ErrDailyCapReached) {
+		t.Fatalf("expected ErrDailyCapReached, got %v", err)
+	}
+}
+
+func TestStoreDailyUsage_ResetsOnNewDay(t *testing.T) {
+	cfg := config.Get()
+	old := cfg.AccountDailyRequestCap
+	t.Cleanup(func() { cfg.AccountDailyRequestCap = old })
+	cfg.AccountDailyRequestCap = 1
+
+	now := time.Now()
+	s := &Store{
+		accounts: []Account{{AccessToken: "t1", ExpiresIn: 3600, Timestamp: now.UnixMilli(), Enable: true, SessionID: "s1", Email: "a@example.com"}},
+		usage:    map[string]accountUsage{"a@example.com": {Day: usageDay(now.AddDate(0, 0, -1)), Requests: 5, Tokens: 500}},
+	}
+	if u := s.DailyUsage("s1"); u.Exceeded || u.Requests != 0 {
+		t.Fatalf("usage from a previous day should not count: %+v", u)
+	}
+	if _, err := s.GetToken(); err != nil {
+		t.Fatalf("GetToken error: %v", err)
+	}
+	s.RecordUsage("s1", 10)
+	if u := s.DailyUsage("s1"); !u.Exceeded || u.Requests != 1 || u.Tokens != 10 {
+		t.Fatalf("unexpected usage after reset: %+v", u)
+	}
+	if reset := s.DailyUsage("s1").ResetAt.In(ChinaTimezone); reset.Hour() != 0 || reset.Minute() != 0 || !reset.After(now) {
+		t.Fatalf("unexpected reset time: %v", reset)
+	}
+}
+
+func TestStoreDailyUsage_SurvivesReloadAndReplace(t *testing.T) {
+	cfg := config.Get()
+	old := cfg.AccountDailyRequestCap
+	t.Cleanup(func() { cfg.AccountDailyRequestCap = old })
+	cfg.AccountDailyRequestCap = 1
+
+	now := time.Now().UnixMilli()
+	accounts := []Account{
+		{AccessToken: "t1", ExpiresIn: 3600, Timestamp: now, Enable: true, Email: "A@example.com"},
+		{AccessToken: "t2", ExpiresIn: 3600, Timestamp: now, Enable: true, RefreshToken: "rt-2"},
+	}
+	path := filepath.Join(t.TempDir(), "accounts.json")
+	s := &Store{filePath: path}
+	if err := s.Replace(accounts, nil); err != nil {
+		t.Fatalf("Replace: %v", err)
+	}
+	t.Cleanup(func() {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		if s.usageSave != nil {
+			s.usageSave.Stop()
+		}
+	})
+	all := s.GetAll()
+	s.RecordUsage(all[0].SessionID, 10)
+	s.RecordUsage(all[1].SessionID, 20)
+
+	// 从备份恢复会重新生成 SessionID，用量按邮箱 / refresh_token 保留。
+	if err := s.Replace(accounts, nil); err != nil {
+		t.Fatalf("Replace: %v", err)
+	}
+	all = s.GetAll()
+	if u := s.DailyUsage(all[0].SessionID); !u.Exceeded || u.Tokens != 10 {
+		t.Fatalf("usage should survive Replace: %+v", u)
+	}
+
+	if err := s.saveUsage(); err != nil {
+		t.Fatalf("saveUsage: %v", err)
+	}
+	reloaded := &Store{filePath: path}
+	if err := reloaded.Load(); err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	all = reloaded.GetAll()
+	if u := reloaded.DailyUsage(all[0].SessionID); !u.Exceeded || u.Tokens != 10 {
+		t.Fatalf("usage should survive a restart: %+v", u)
+	}
+	if u := reloaded.DailyUsage(all[1].SessionID); !u.Exceeded || u.Tokens != 20 {
+		t.Fatalf("accounts without email should be keyed by refresh token: %+v", u)
+	}
+	if _, err := reloaded.GetToken(); !errors.Is(err, ErrDailyCapReached) {
+		t.Fatalf("expected ErrDailyCapReached after reload, got %v", err)
+	}
+}
+
+func TestStoreGetTokenForModel_CappedImagePoolFallsBack(t *testing.T) {
+	cfg := config.Get()
+	oldRequests, oldPool := cfg.AccountDailyRequestCap, cfg.ImageAccounts
+	t.Cleanup(func() { cfg.AccountDailyRequestCap, cfg.ImageAccounts = oldRequests, oldPool })
+	cfg.AccountDailyRequestCap, cfg.ImageAccounts = 1, []string{"image@example.com"}
+
+	now := time.Now().UnixMilli()
+	s := &Store{
+		accounts: []Account{
+			{AccessToken: "image", ExpiresIn: 3600, Timestamp: now, Enable: true, SessionID: "s1", Email: "image@example.com"},
+			{AccessToken: "text", ExpiresIn: 3600, Timestamp: now, Enable: true, SessionID: "s2", Email: "text@example.com"},
+		},
+	}
+	if acc, err := s.GetTokenForModel("", true); err != nil || acc.AccessToken != "image" {
+		t.Fatalf("expected the image account first, got %+v err=%v", acc, err)
+	}
+	s.RecordUsage("s1", 0)
+	if acc, err := s.GetTokenForModel("", true); err != nil || acc.AccessToken != "text" {
+		t.Fatalf("capped image pool should fall back to regular accounts, got %+v err=%v", acc, err)
+	}
+	s.RecordUsage("s2", 0)
+	if _, err := s.GetTokenForModel("", true); !errors.Is(err, ErrDailyCapReached) {
+		t.Fatalf("expected ErrDailyCapReached when every account is capped, got %v", err)
+	}
+}
+
+func TestStoreRecordUsage_SkippedWithoutCaps(t *testing.T) {
+	cfg := config.Get()
+	oldRequests, oldTokens := cfg.AccountDailyRequestCap, cfg.AccountDailyTokenCap
+	t.Cleanup(func() { cfg.AccountDailyRequestCap, cfg.AccountDailyTokenCap = oldRequests, oldTokens })
+	cfg.AccountDailyRequestCap, cfg.AccountDailyTokenCap = 0, 0
+
+	s := &Store{
+		filePath: filepath.Join(t.TempDir(), "accounts.json"),
+		accounts: []Account{
+			{SessionID: "s1", Email: "a@example.com"},
+			{SessionID: "s2", Email: "b@example.com", DailyTokenCap: 100},
+		},
+	}
+	t.Cleanup(func() {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		if s.usageSave != nil {
+			s.usageSave.Stop()
+		}
+	})
+	s.RecordUsage("s1", 10)
+	s.mu.Lock()
+	_, tracked := s.usage["a@example.com"]
+	scheduled := s.usageSave != nil
+	s.mu.Unlock()
+	if tracked || scheduled {
+		t.Fatalf("accounts without caps should not be tracked or persisted (tracked=%v scheduled=%v)", tracked, scheduled)
+	}
+
+	s.RecordUsage("s2", 10)
+	if u := s.DailyUsage("s2"); u.Tokens != 10 {
+		t.Fatalf("accounts with a cap should be tracked: %+v", u)
+	}
+}
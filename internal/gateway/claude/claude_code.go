@@ -0,0 +1,55 @@
+package claude
+
+import (
+	"net/http"
+	"strings"
+
+	"anti2api-golang/refactor/internal/config"
+	"anti2api-golang/refactor/internal/vertex"
+)
+
+// claudeCodeBetaPrefixes 为 Claude Code 在 anthropic-beta 头中发送的 beta 标记前缀。
+var claudeCodeBetaPrefixes = []string{"claude-code-", "interleaved-thinking-", "fine-grained-tool-streaming-"}
+
+// isClaudeCodeRequest 判断是否对该请求启用 Claude Code 兼容模式（CLAUDE_CODE_COMPAT）：
+// on / off 强制开关；auto（默认）时根据 User-Agent（claude-cli/...）与 anthropic-beta 头识别。
+//
+// 兼容模式下：
+//   - message_start 之后立即输出一个 ping 事件；
+//   - tool_use 块以空 input 开始，参数通过 input_json_delta 输出（与官方 API 的事件顺序一致）；
+//   - is_error 的 tool_result 以 {"error": ...} 的形式交给上游，多个文本块按行拼接；
+//   - usage 带上 cache_creation_input_tokens / cache_read_input_tokens，结束时使用上游的真实输入 token 数。
+func isClaudeCodeRequest(h http.Header) bool {
+	switch config.Get().ClaudeCodeCompat {
+	case "on":
+		return true
+	case "off":
+		return false
+	}
+	if strings.HasPrefix(strings.ToLower(h.Get("User-Agent")), "claude-cli/") {
+		return true
+	}
+	for _, v := range h.Values("anthropic-beta") {
+		for _, beta := range strings.Split(v, ",") {
+			beta = strings.ToLower(strings.TrimSpace(beta))
+			for _, p := range claudeCodeBetaPrefixes {
+				if strings.HasPrefix(beta, p) {
+					return true
+				}
+			}
+		}
+	}
+	return false
+}
+
+// applyClaudeCodeUsage 按 Claude Code 的预期补全非流式响应的 usage；缓存 token 字段仅在 version 支持时输出。
+func applyClaudeCodeUsage(out *MessagesResponse, resp *vertex.Response, version string) {
+	if hasCacheUsage(version) {
+		zero := 0
+		out.Usage.CacheCreationInputTokens = &zero
+		out.Usage.CacheReadInputTokens = &zero
+	}
+	if resp != nil && resp.Response.UsageMetadata != nil && resp.Response.UsageMetadata.PromptTokenCount > 0 {
+		out.Usage.InputTokens = resp.Response.UsageMetadata.PromptTokenCount
+	}
+}
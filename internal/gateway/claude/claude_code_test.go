@@ -0,0 +1,93 @@
+package claude
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"anti2api-golang/refactor/internal/config"
+	"anti2api-golang/refactor/internal/signature"
+	"anti2api-golang/refactor/internal/vertex"
+)
+
+func TestIsClaudeCodeRequest(t *testing.T) {
+	c := config.Get()
+	old := c.ClaudeCodeCompat
+	t.Cleanup(func() { c.ClaudeCodeCompat = old })
+
+	c.ClaudeCodeCompat = "auto"
+	h := http.Header{}
+	if isClaudeCodeRequest(h) {
+		t.Fatalf("plain request should not enable compat mode")
+	}
+	h.Set("anthropic-beta", "prompt-caching-2024-07-31, Interleaved-Thinking-2025-05-14")
+	if !isClaudeCodeRequest(h) {
+		t.Fatalf("interleaved thinking beta should enable compat mode")
+	}
+	if !isClaudeCodeRequest(http.Header{"User-Agent": {"claude-cli/2.0.14 (external, cli)"}}) {
+		t.Fatalf("claude-cli user agent should enable compat mode")
+	}
+
+	c.ClaudeCodeCompat = "off"
+	if isClaudeCodeRequest(h) {
+		t.Fatalf("off should disable compat mode")
+	}
+	c.ClaudeCodeCompat = "on"
+	if !isClaudeCodeRequest(http.Header{}) {
+		t.Fatalf("on should always enable compat mode")
+	}
+}
+
+func TestSSEEmitterClaudeCodeEvents(t *testing.T) {
+	rec := httptest.NewRecorder()
+	e := NewSSEEmitter(rec, "req", "gemini-2.5-pro", 10)
+	e.claudeCode = true
+	e.cacheUsage = true
+	_ = e.Start()
+	_ = e.ProcessPart(StreamDataPart{FunctionCall: &vertex.FunctionCall{ID: "toolu_1", Name: "Read", Args: map[string]any{"file_path": "/a"}}})
+	e.SetPromptTokens(42)
+	_ = e.Finish(5, "tool_use", "")
+
+	body := rec.Body.String()
+	for _, want := range []string{
+		"event: ping\n",
+		`"cache_read_input_tokens":0`,
+		`"input":{}`,
+		`{"partial_json":"{\"file_path\":\"/a\"}","type":"input_json_delta"}`,
+		`"input_tokens":42`,
+	} {
+		if !strings.Contains(body, want) {
+			t.Fatalf("missing %s in:\n%s", want, body)
+		}
+	}
+	if strings.Index(body, "event: ping") < strings.Index(body, "event: message_start") {
+		t.Fatalf("ping must follow message_start")
+	}
+}
+
+func TestToVertexContentsClaudeCodeToolError(t *testing.T) {
+	messages := []Message{
+		{Role: "assistant", Content: []any{map[string]any{"type": "tool_use", "id": "toolu_1", "name": "Bash", "input": map[string]any{}}}},
+		{Role: "user", Content: []any{map[string]any{
+			"type":        "tool_result",
+			"tool_use_id": "toolu_1",
+			"is_error":    true,
+			"content":     []any{map[string]any{"type": "text", "text": "exit 1"}, map[string]any{"type": "text", "text": "not found"}},
+		}}},
+	}
+
+	contents, err := toVertexContents(messages, false, true, signature.GetManager())
+	if err != nil {
+		t.Fatal(err)
+	}
+	fr := contents[1].Parts[0].FunctionResponse
+	if fr == nil || fr.Response["error"] != "exit 1\nnot found" {
+		t.Fatalf("unexpected function response: %#v", fr)
+	}
+
+	contents, _ = toVertexContents(messages, false, false, signature.GetManager())
+	if fr := contents[1].Parts[0].FunctionResponse; fr.Response["output"] != "exit 1not found" {
+		t.Fatalf("default mode should keep legacy output: %#v", fr)
+	}
+}
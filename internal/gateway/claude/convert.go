@@ -2,6 +2,7 @@ package claude
 
 import (
 	"errors"
+	"fmt"
 	"strings"
 
 	"anti2api-golang/refactor/internal/config"
@@ -19,6 +20,9 @@ func ToVertexRequest(req *MessagesRequest, account *gwcommon.AccountContext) (*v
 	if len(req.Messages) == 0 {
 		return nil, "", errors.New("messages is required")
 	}
+	if err := validateThinking(req); err != nil {
+		return nil, "", err
+	}
 
 	model := strings.TrimSpace(req.Model)
 	isClaudeModel := modelutil.IsClaude(model)
@@ -39,22 +43,34 @@ func ToVertexRequest(req *MessagesRequest, account *gwcommon.AccountContext) (*v
 	vreq.RequestType = "agent"
 	vreq.UserAgent = "antigravity"
 
-	if sys := gwcommon.ExtractClaudeSystemText(req.System); sys != "" {
-		vreq.Request.SystemInstruction = &vertex.SystemInstruction{Role: "user", Parts: []vertex.Part{{Text: sys}}}
+	if sysParts := gwcommon.ExtractClaudeSystemParts(req.System); len(sysParts) > 0 {
+		vreq.Request.SystemInstruction = &vertex.SystemInstruction{Role: vertex.SystemInstructionRole(""), Parts: sysParts}
 	}
 
-	if len(req.Tools) > 0 {
-		vreq.Request.Tools = toVertexTools(req.Tools)
+	tools, err := filterServerTools(req.Tools)
+	if err != nil {
+		return nil, "", err
+	}
+	if len(tools) > 0 {
+		if vreq.Request.Tools, err = gwcommon.PrepareTools(toVertexTools(tools)); err != nil {
+			return nil, "", err
+		}
 		vreq.Request.ToolConfig = &vertex.ToolConfig{FunctionCallingConfig: &vertex.FunctionCallingConfig{Mode: "AUTO"}}
 	}
+	if search, ok := webSearchTool(req.Tools); ok {
+		applyWebSearch(vreq, search)
+	}
 
-	vreq.Request.GenerationConfig = buildGenerationConfig(req)
-	contents, err := toVertexContents(req.Messages, isClaudeModel)
+	vreq.Request.GenerationConfig = modelutil.ApplyVirtualModel(req.Model, buildGenerationConfig(req))
+	contents, err := toVertexContents(req.Messages, isClaudeModel, req.ClaudeCode, signature.GetManagerFor(req.Tenant))
 	if err != nil {
 		return nil, "", err
 	}
 	vreq.Request.Contents = contents
-	shouldSkipSystemPrompt := isImageModel || isGemini3Flash
+	gwcommon.TrimPrefill(vreq)
+	gwcommon.DownscaleImages(vreq)
+	gwcommon.ReferenceToolResults(vreq)
+	shouldSkipSystemPrompt := isImageModel || isGemini3Flash || req.NoSystemInjection
 	if !shouldSkipSystemPrompt {
 		vreq.Request.SystemInstruction = vertex.InjectAgentSystemPrompt(vreq.Request.SystemInstruction)
 	}
@@ -63,90 +79,106 @@ func ToVertexRequest(req *MessagesRequest, account *gwcommon.AccountContext) (*v
 }
 
 func buildGenerationConfig(req *MessagesRequest) *vertex.GenerationConfig {
-	model := strings.TrimSpace(req.Model)
-	isClaude := modelutil.IsClaude(model)
-	isGemini := modelutil.IsGemini(model)
-	isImageModel := modelutil.IsImageModel(model)
-
-	cfg := &vertex.GenerationConfig{CandidateCount: 1}
-	// Claude models: maxOutputTokens is fixed at 64000.
-	if isClaude {
-		cfg.MaxOutputTokens = modelutil.ClaudeMaxOutputTokens
-	} else if isGemini {
-		// Gemini models: maxOutputTokens is fixed at 65535.
-		cfg.MaxOutputTokens = modelutil.GeminiMaxOutputTokens
-	} else if req.MaxTokens > 0 {
-		cfg.MaxOutputTokens = req.MaxTokens
-	} else {
-		cfg.MaxOutputTokens = 8192
+	p := modelutil.GenerationParams{
+		MaxOutputTokens: req.MaxTokens,
+		Temperature:     req.Temperature,
+		TopP:            req.TopP,
+		TopK:            req.TopK,
+		StopSequences:   req.StopSequences,
+		MediaResolution: req.MediaResolution,
 	}
-	if req.Temperature != nil {
-		cfg.Temperature = req.Temperature
+	if req.Thinking != nil {
+		p.Thinking = modelutil.ThinkingConfigFromClaude(req.Model, req.Thinking.Type, req.Thinking.Budget, req.Thinking.BudgetTokens)
+		// 严格模式下客户端预算已通过 validateThinking 校验，只要不超过上游输出上限就原样透传。
+		p.ExactThinkingBudget = !config.Get().ClaudeThinkingLenient
 	}
-	if req.TopP != nil {
-		cfg.TopP = req.TopP
+	return modelutil.BuildGenerationConfig(req.Model, p)
+}
+
+// minClaudeThinkingBudget 是 Anthropic 对 thinking.budget_tokens 的最小值要求。
+const minClaudeThinkingBudget = 1024
+
+// validateThinking 按 Anthropic 的规则校验 thinking 参数：budget_tokens >= 1024 且小于 max_tokens。
+// CLAUDE_THINKING_LENIENT=true 时跳过校验（兼容旧客户端）。
+func validateThinking(req *MessagesRequest) error {
+	if req.Thinking == nil || config.Get().ClaudeThinkingLenient {
+		return nil
 	}
-	if len(req.StopSequences) > 0 {
-		cfg.StopSequences = append(cfg.StopSequences, req.StopSequences...)
+	if strings.ToLower(strings.TrimSpace(req.Thinking.Type)) != "enabled" {
+		return nil
 	}
-
-	if req.Thinking != nil {
-		cfg.ThinkingConfig = modelutil.ThinkingConfigFromClaude(model, req.Thinking.Type, req.Thinking.Budget, req.Thinking.BudgetTokens)
-	} else {
-		// 允许由模型名强制启用 thinking（例如 gemini-3-flash / claude 4.5）。
-		cfg.ThinkingConfig, _ = modelutil.ForcedThinkingConfig(model)
+	budget := req.Thinking.Budget
+	if budget <= 0 {
+		budget = req.Thinking.BudgetTokens
 	}
-
-	if cfg.ThinkingConfig != nil && cfg.ThinkingConfig.ThinkingBudget > 0 {
-		maxBudget := cfg.MaxOutputTokens - modelutil.ThinkingBudgetHeadroomTokens
-		if maxBudget < modelutil.ThinkingBudgetMinTokens {
-			maxBudget = modelutil.ThinkingBudgetMinTokens
-		}
-		if cfg.ThinkingConfig.ThinkingBudget > maxBudget {
-			cfg.ThinkingConfig.ThinkingBudget = maxBudget
-		}
+	if budget == 0 {
+		return errors.New("thinking.enabled.budget_tokens: Field required")
 	}
-
-	// Gemini image size virtual models: force imageConfig.imageSize via the model name.
-	if imageSize, _, ok := modelutil.GeminiProImageSizeConfig(model); ok {
-		cfg.ImageConfig = &vertex.ImageConfig{ImageSize: imageSize}
+	if budget < minClaudeThinkingBudget {
+		return fmt.Errorf("thinking.enabled.budget_tokens: Input should be greater than or equal to %d", minClaudeThinkingBudget)
 	}
-
-	// Gemini 3: apply global mediaResolution when configured.
-	if modelutil.IsGemini3(model) && !isImageModel {
-		if v, ok := modelutil.ToAPIMediaResolution(config.Get().Gemini3MediaResolution); ok && v != "" {
-			cfg.MediaResolution = v
-		}
+	if req.MaxTokens > 0 && budget >= req.MaxTokens {
+		return fmt.Errorf("`max_tokens` must be greater than `thinking.budget_tokens` (got max_tokens=%d, budget_tokens=%d)", req.MaxTokens, budget)
 	}
-	return cfg
+	return nil
 }
 
-func toVertexContents(messages []Message, isClaudeModel bool) ([]vertex.Content, error) {
+func toVertexContents(messages []Message, isClaudeModel, claudeCode bool, sigs *signature.Manager) ([]vertex.Content, error) {
+	normalizeToolCallIDs(messages, sigs)
 	var out []vertex.Content
 	for _, m := range messages {
 		switch m.Role {
 		case "user":
-			parts, err := extractContentParts(m.Content, out, isClaudeModel)
+			parts, err := extractContentParts(m.Content, out, isClaudeModel, claudeCode, sigs)
 			if err != nil {
 				return nil, err
 			}
-			if len(parts) > 0 {
-				out = append(out, vertex.Content{Role: "user", Parts: parts})
-			}
+			out = append(out, vertex.Content{Role: "user", Parts: parts})
 		case "assistant":
-			parts, err := extractContentParts(m.Content, out, isClaudeModel)
+			parts, err := extractContentParts(m.Content, out, isClaudeModel, claudeCode, sigs)
 			if err != nil {
 				return nil, err
 			}
-			if len(parts) > 0 {
-				out = append(out, vertex.Content{Role: "model", Parts: parts})
+			out = append(out, vertex.Content{Role: "model", Parts: parts})
+		}
+	}
+	// 内容为空的消息保留为占位轮次，避免 tool_use / tool_result 配对错位。
+	return vertex.NormalizeEmptyTurns(out), nil
+}
+
+// normalizeToolCallIDs 将客户端在多轮之间改写的 tool_use / tool_result ID 就地归一化为首次下发的规范 ID，
+// 使后续的签名查找与 FindFunctionName 按规范 ID 命中。
+func normalizeToolCallIDs(messages []Message, sigs *signature.Manager) {
+	norm := gwcommon.NewToolCallNormalizer(sigs)
+	for _, msg := range messages {
+		blocks, ok := msg.Content.([]any)
+		if !ok {
+			continue
+		}
+		for _, it := range blocks {
+			m, ok := it.(map[string]any)
+			if !ok {
+				continue
+			}
+			switch typ, _ := m["type"].(string); {
+			case typ == "tool_use" && msg.Role == "assistant":
+				idv, _ := m["id"].(string)
+				name, _ := m["name"].(string)
+				input, _ := m["input"].(map[string]any)
+				if canonical := norm.Call(strings.TrimSpace(idv), name, input); canonical != "" && canonical != idv {
+					m["id"] = canonical
+				}
+			case typ == "tool_result" && msg.Role == "user":
+				toolUseID, _ := m["tool_use_id"].(string)
+				if canonical := norm.Result(strings.TrimSpace(toolUseID)); canonical != "" && canonical != toolUseID {
+					m["tool_use_id"] = canonical
+				}
 			}
 		}
 	}
-	return out, nil
 }
 
-func extractContentParts(content any, contentsSoFar []vertex.Content, isClaudeModel bool) ([]vertex.Part, error) {
+func extractContentParts(content any, contentsSoFar []vertex.Content, isClaudeModel, claudeCode bool, sigs *signature.Manager) ([]vertex.Part, error) {
 	var out []vertex.Part
 	switch v := content.(type) {
 	case string:
@@ -192,7 +224,7 @@ func extractContentParts(content any, contentsSoFar []vertex.Content, isClaudeMo
 							}
 						}
 						if toolUseID != "" {
-							if e, ok := signature.GetManager().LookupByToolCallID(toolUseID); ok {
+							if e, ok := sigs.LookupByToolCallID(toolUseID); ok {
 								sig = strings.TrimSpace(e.Signature)
 							}
 						}
@@ -228,7 +260,7 @@ func extractContentParts(content any, contentsSoFar []vertex.Content, isClaudeMo
 							}
 						}
 						if toolUseID != "" {
-							if e, ok := signature.GetManager().LookupByToolCallID(toolUseID); ok {
+							if e, ok := sigs.LookupByToolCallID(toolUseID); ok {
 								data = strings.TrimSpace(e.Signature)
 							}
 						}
@@ -254,7 +286,7 @@ func extractContentParts(content any, contentsSoFar []vertex.Content, isClaudeMo
 				sig := ""
 				if !isClaudeModel {
 					// Ignore client-provided signature; only tool_call_id based lookup.
-					if e, ok := signature.GetManager().LookupByToolCallID(idv); ok {
+					if e, ok := sigs.LookupByToolCallID(idv); ok {
 						sig = e.Signature
 					}
 				}
@@ -271,8 +303,26 @@ func extractContentParts(content any, contentsSoFar []vertex.Content, isClaudeMo
 				if name == "" {
 					return out, nil
 				}
-				resultText := extractToolResultContent(m["content"])
-				out = append(out, vertex.Part{FunctionResponse: &vertex.FunctionResponse{ID: toolUseID, Name: name, Response: map[string]any{"output": resultText}}})
+				if !claudeCode {
+					response := gwcommon.ToolResultResponse("output", extractToolResultContent(m["content"]))
+					out = append(out, vertex.Part{FunctionResponse: &vertex.FunctionResponse{ID: toolUseID, Name: name, Response: response}})
+					continue
+				}
+				key := "output"
+				if isErr, _ := m["is_error"].(bool); isErr {
+					key = "error"
+				}
+				out = append(out, vertex.Part{FunctionResponse: &vertex.FunctionResponse{ID: toolUseID, Name: name, Response: gwcommon.ToolResultResponse(key, extractToolResultLines(m["content"]))}})
+			default:
+				if !isServerToolBlock(typ) {
+					continue
+				}
+				if config.Get().ClaudeServerToolBlocks == "reject" && !isWebSearchBlock(typ, m) {
+					return nil, unsupportedServerToolError(typ)
+				}
+				if t := serverToolBlockText(typ, m); t != "" {
+					out = append(out, vertex.Part{Text: t})
+				}
 			}
 		}
 	}
@@ -301,6 +351,21 @@ func extractToolResultContent(content any) string {
 	return ""
 }
 
+// extractToolResultLines 与 extractToolResultContent 相同，但多个文本块之间用换行分隔（Claude Code 的 tool_result 常拆成多块）。
+func extractToolResultLines(content any) string {
+	blocks, ok := content.([]any)
+	if !ok {
+		return extractToolResultContent(content)
+	}
+	var lines []string
+	for _, it := range blocks {
+		if t := extractToolResultContent([]any{it}); t != "" {
+			lines = append(lines, t)
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
 func toVertexTools(tools []Tool) []vertex.Tool {
 	var out []vertex.Tool
 	for _, t := range tools {
@@ -1,9 +1,11 @@
 package claude
 
 import (
+	"strings"
 	"testing"
 
 	"anti2api-golang/refactor/internal/config"
+	gwcommon "anti2api-golang/refactor/internal/gateway/common"
 )
 
 func TestBuildGenerationConfig_GeminiProImageVirtual_ForcesImageSize(t *testing.T) {
@@ -75,3 +77,177 @@ func TestBuildGenerationConfig_NonGemini3_DoesNotApplyGlobalMediaResolution(t *t
 		t.Fatalf("expected mediaResolution to be empty, got %q", cfg.MediaResolution)
 	}
 }
+
+func TestToVertexRequest_SystemArrayKeepsPartBoundaries(t *testing.T) {
+	req := &MessagesRequest{
+		Model: "gemini-2.5-pro",
+		System: []any{
+			map[string]any{"type": "text", "text": "first block"},
+			map[string]any{"type": "text", "text": "second block", "cache_control": map[string]any{"type": "ephemeral"}},
+		},
+		Messages: []Message{{Role: "user", Content: "hi"}},
+	}
+	vreq, _, err := ToVertexRequest(req, &gwcommon.AccountContext{ProjectID: "p", SessionID: "s"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	sys := vreq.Request.SystemInstruction
+	if sys == nil || len(sys.Parts) != 2 {
+		t.Fatalf("expected 2 system parts, got %#v", sys)
+	}
+	if !strings.HasSuffix(sys.Parts[0].Text, "first block") {
+		t.Fatalf("first part mismatch: %q", sys.Parts[0].Text)
+	}
+	if sys.Parts[1].Text != "second block" {
+		t.Fatalf("second part mismatch: %q", sys.Parts[1].Text)
+	}
+}
+
+func TestValidateThinking(t *testing.T) {
+	cases := []struct {
+		name    string
+		req     MessagesRequest
+		wantErr string
+	}{
+		{"disabled", MessagesRequest{MaxTokens: 100, Thinking: &Thinking{Type: "disabled"}}, ""},
+		{"valid", MessagesRequest{MaxTokens: 4096, Thinking: &Thinking{Type: "enabled", BudgetTokens: 2048}}, ""},
+		{"missing budget", MessagesRequest{MaxTokens: 4096, Thinking: &Thinking{Type: "enabled"}}, "Field required"},
+		{"too small", MessagesRequest{MaxTokens: 4096, Thinking: &Thinking{Type: "enabled", BudgetTokens: 512}}, "greater than or equal to 1024"},
+		{"not below max_tokens", MessagesRequest{MaxTokens: 2048, Thinking: &Thinking{Type: "enabled", BudgetTokens: 2048}}, "`max_tokens` must be greater"},
+	}
+	for _, tc := range cases {
+		err := validateThinking(&tc.req)
+		if tc.wantErr == "" {
+			if err != nil {
+				t.Fatalf("%s: unexpected error %v", tc.name, err)
+			}
+			continue
+		}
+		if err == nil || !strings.Contains(err.Error(), tc.wantErr) {
+			t.Fatalf("%s: expected error containing %q, got %v", tc.name, tc.wantErr, err)
+		}
+	}
+
+	c := config.Get()
+	old := c.ClaudeThinkingLenient
+	c.ClaudeThinkingLenient = true
+	t.Cleanup(func() { c.ClaudeThinkingLenient = old })
+	if err := validateThinking(&MessagesRequest{MaxTokens: 100, Thinking: &Thinking{Type: "enabled", BudgetTokens: 512}}); err != nil {
+		t.Fatalf("expected lenient mode to skip validation, got %v", err)
+	}
+}
+
+func TestBuildGenerationConfig_HonorsExactClaudeBudget(t *testing.T) {
+	req := &MessagesRequest{Model: "claude-opus-4-1", MaxTokens: 70000, Thinking: &Thinking{Type: "enabled", BudgetTokens: 63500}}
+	cfg := buildGenerationConfig(req)
+	if cfg.ThinkingConfig == nil || cfg.ThinkingConfig.ThinkingBudget != 63500 {
+		t.Fatalf("expected exact budget 63500, got %#v", cfg.ThinkingConfig)
+	}
+
+	c := config.Get()
+	old := c.ClaudeThinkingLenient
+	c.ClaudeThinkingLenient = true
+	t.Cleanup(func() { c.ClaudeThinkingLenient = old })
+	cfg = buildGenerationConfig(req)
+	if want := cfg.MaxOutputTokens - 1024; cfg.ThinkingConfig.ThinkingBudget != want {
+		t.Fatalf("expected lenient mode to clamp budget to %d, got %d", want, cfg.ThinkingConfig.ThinkingBudget)
+	}
+}
+
+func TestToVertexRequest_ServerToolBlocks(t *testing.T) {
+	c := config.Get()
+	old := c.ClaudeServerToolBlocks
+	t.Cleanup(func() { c.ClaudeServerToolBlocks = old })
+
+	req := &MessagesRequest{
+		Model: "gemini-2.5-pro",
+		Tools: []Tool{
+			{Type: "code_execution_20250522", Name: "code_execution"},
+			{Name: "read_file", InputSchema: map[string]any{"type": "object"}},
+		},
+		Messages: []Message{
+			{Role: "user", Content: "run it"},
+			{Role: "assistant", Content: []any{
+				map[string]any{"type": "server_tool_use", "id": "srvtoolu_1", "name": "code_execution", "input": map[string]any{"code": "print(1)"}},
+				map[string]any{"type": "code_execution_tool_result", "tool_use_id": "srvtoolu_1", "content": map[string]any{
+					"type": "code_execution_result", "stdout": "1\n", "stderr": "", "return_code": 0,
+				}},
+			}},
+			{Role: "user", Content: "thanks"},
+		},
+	}
+
+	c.ClaudeServerToolBlocks = "text"
+	vreq, _, err := ToVertexRequest(req, &gwcommon.AccountContext{ProjectID: "p", SessionID: "s"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(vreq.Request.Tools) != 1 || vreq.Request.Tools[0].FunctionDeclarations[0].Name != "read_file" {
+		t.Fatalf("server tool should be dropped, got %#v", vreq.Request.Tools)
+	}
+	parts := vreq.Request.Contents[1].Parts
+	if len(parts) != 2 {
+		t.Fatalf("expected 2 text parts, got %#v", parts)
+	}
+	if !strings.HasPrefix(parts[0].Text, "[server_tool_use code_execution]") || !strings.Contains(parts[0].Text, "print(1)") {
+		t.Fatalf("server_tool_use text mismatch: %q", parts[0].Text)
+	}
+	if !strings.Contains(parts[1].Text, "[code_execution_tool_result]") || !strings.Contains(parts[1].Text, "stdout:\n1") {
+		t.Fatalf("result text mismatch: %q", parts[1].Text)
+	}
+
+	c.ClaudeServerToolBlocks = "reject"
+	req.Tools = req.Tools[1:]
+	if _, _, err := ToVertexRequest(req, &gwcommon.AccountContext{ProjectID: "p", SessionID: "s"}); err == nil || !strings.Contains(err.Error(), `"server_tool_use"`) {
+		t.Fatalf("expected unsupported block error, got %v", err)
+	}
+}
+
+func TestBuildGenerationConfig_PassesTopK(t *testing.T) {
+	cfg := buildGenerationConfig(&MessagesRequest{Model: "claude-sonnet-4-5", MaxTokens: 1024, TopK: 5})
+	if cfg.TopK != 5 {
+		t.Fatalf("expected topK 5, got %d", cfg.TopK)
+	}
+}
+
+func TestToVertexRequest_WebSearchEmulation(t *testing.T) {
+	c := config.Get()
+	oldSearch, oldBlocks := c.ClaudeWebSearch, c.ClaudeServerToolBlocks
+	t.Cleanup(func() { c.ClaudeWebSearch, c.ClaudeServerToolBlocks = oldSearch, oldBlocks })
+	c.ClaudeServerToolBlocks = "reject"
+
+	req := &MessagesRequest{
+		Model: "gemini-2.5-pro",
+		Tools: []Tool{{Type: "web_search_20250305", Name: "web_search", MaxUses: 2}},
+		Messages: []Message{
+			{Role: "user", Content: "news?"},
+			{Role: "assistant", Content: []any{
+				map[string]any{"type": "server_tool_use", "id": "srvtoolu_1", "name": "web_search", "input": map[string]any{"query": "news"}},
+				map[string]any{"type": "web_search_tool_result", "tool_use_id": "srvtoolu_1", "content": []any{
+					map[string]any{"type": "web_search_result", "title": "Example", "url": "https://example.com"},
+				}},
+			}},
+			{Role: "user", Content: "more"},
+		},
+	}
+
+	c.ClaudeWebSearch = "google"
+	vreq, _, err := ToVertexRequest(req, &gwcommon.AccountContext{ProjectID: "p", SessionID: "s"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(vreq.Request.Tools) != 1 || vreq.Request.Tools[0].FunctionDeclarations[0].Name != gwcommon.WebSearchName {
+		t.Fatalf("expected web_search declaration, got %#v", vreq.Request.Tools)
+	}
+	if fn, ok := vreq.ProxyFunctions[gwcommon.WebSearchName]; !ok || !fn.Visible {
+		t.Fatalf("expected visible web_search proxy function, got %#v", vreq.ProxyFunctions)
+	}
+	if parts := vreq.Request.Contents[1].Parts; len(parts) != 2 || !strings.Contains(parts[1].Text, "https://example.com") {
+		t.Fatalf("web search blocks should become text, got %#v", parts)
+	}
+
+	c.ClaudeWebSearch = ""
+	if _, _, err := ToVertexRequest(req, &gwcommon.AccountContext{ProjectID: "p", SessionID: "s"}); err == nil {
+		t.Fatalf("without emulation reject mode should refuse the web_search tool")
+	}
+}
@@ -1,18 +1,24 @@
 package claude
 
 import (
-	"io"
+	"errors"
 	"net/http"
-	"strings"
 	"time"
 
+	"anti2api-golang/refactor/internal/config"
 	"anti2api-golang/refactor/internal/credential"
 	gwcommon "anti2api-golang/refactor/internal/gateway/common"
+	"anti2api-golang/refactor/internal/hooks"
 	"anti2api-golang/refactor/internal/logger"
+	"anti2api-golang/refactor/internal/middleware"
 	httppkg "anti2api-golang/refactor/internal/pkg/http"
 	"anti2api-golang/refactor/internal/pkg/id"
 	jsonpkg "anti2api-golang/refactor/internal/pkg/json"
+	"anti2api-golang/refactor/internal/pkg/memory"
 	"anti2api-golang/refactor/internal/pkg/modelutil"
+	"anti2api-golang/refactor/internal/pkg/spool"
+	"anti2api-golang/refactor/internal/secondary"
+	"anti2api-golang/refactor/internal/transcript"
 	"anti2api-golang/refactor/internal/vertex"
 )
 
@@ -24,17 +30,35 @@ type ModelItem struct {
 	ID          string `json:"id"`
 	Type        string `json:"type"`
 	DisplayName string `json:"display_name,omitempty"`
+	CreatedAt   string `json:"created_at,omitempty"`
+
+	// 以下为扩展字段（非 Anthropic 官方字段），供按模型元数据自动配置的客户端使用。
+	MaxInputTokens   int      `json:"max_input_tokens,omitempty"`
+	MaxOutputTokens  int      `json:"max_output_tokens,omitempty"`
+	InputModalities  []string `json:"input_modalities,omitempty"`
+	OutputModalities []string `json:"output_modalities,omitempty"`
+	SupportsThinking bool     `json:"supports_thinking"`
 }
 
 func HandleMessages(w http.ResponseWriter, r *http.Request) {
-	body, err := io.ReadAll(r.Body)
+	version, err := negotiateVersion(r.Header)
+	if err != nil {
+		httppkg.WriteClaudeErrorWithType(w, http.StatusBadRequest, "invalid_request_error", err.Error())
+		return
+	}
+	reqBody, err := spool.ReadRequest(r)
 	if err != nil {
 		httppkg.WriteClaudeError(w, http.StatusBadRequest, "读取请求体失败，请检查请求是否正确发送。")
 		return
 	}
+	defer reqBody.Close()
+	body := reqBody.Bytes()
+
+	var respBytes int
+	defer func() { memory.AfterLargeRequest(len(body) + respBytes) }()
 
 	if logger.IsClientLogEnabled() {
-		logger.ClientRequestWithHeaders(r.Method, r.URL.Path, r.Header, body)
+		logger.ClientRequestWithHeaders(r.Method, r.URL.RequestURI(), r.Header, body)
 	}
 
 	var req MessagesRequest
@@ -42,11 +66,49 @@ func HandleMessages(w http.ResponseWriter, r *http.Request) {
 		httppkg.WriteClaudeError(w, http.StatusBadRequest, "请求 JSON 解析失败，请检查请求体格式。")
 		return
 	}
+	req.Model = gwcommon.PresetModel(r.Context(), req.Model)
+	req.ClaudeCode = isClaudeCodeRequest(r.Header)
+	req.Version = version
+	req.NoSystemInjection = gwcommon.SkipSystemInjection(r)
+	req.Tenant = middleware.TenantFromContext(r.Context())
+	rec := transcript.Begin(r, "claude", body, req.Model, req.Stream)
+	sessionID, err := gwcommon.SessionIDFromRequest(r)
+	if err != nil {
+		rec.Finish(transcript.Result{Status: http.StatusBadRequest, Model: req.Model, Error: err.Error()})
+		httppkg.WriteClaudeErrorWithType(w, http.StatusBadRequest, "invalid_request_error", err.Error())
+		return
+	}
+	if req.MediaResolution, err = gwcommon.ResolveMediaResolution(r.Header, req.MediaResolution); err != nil {
+		rec.Finish(transcript.Result{Status: http.StatusBadRequest, Model: req.Model, Error: err.Error()})
+		httppkg.WriteClaudeErrorWithType(w, http.StatusBadRequest, "invalid_request_error", err.Error())
+		return
+	}
 
 	placeholder := &gwcommon.AccountContext{ProjectID: id.ProjectID(), SessionID: id.SessionID()}
 	vreq, requestID, err := ToVertexRequest(&req, placeholder)
 	if err != nil {
-		httppkg.WriteClaudeError(w, http.StatusBadRequest, err.Error())
+		rec.Finish(transcript.Result{Status: http.StatusBadRequest, Model: req.Model, Error: err.Error()})
+		httppkg.WriteClaudeErrorWithType(w, http.StatusBadRequest, "invalid_request_error", err.Error())
+		return
+	}
+	if err := gwcommon.CheckTurnLimit(vreq); err != nil {
+		rec.Finish(transcript.Result{Status: http.StatusBadRequest, Model: req.Model, Error: err.Error()})
+		httppkg.WriteClaudeErrorWithType(w, http.StatusBadRequest, "invalid_request_error", err.Error())
+		return
+	}
+	gwcommon.ApplyKeyPreset(r.Context(), vreq)
+	if err := gwcommon.ApplyThinkingHeaders(r.Header, req.Model, vreq); err != nil {
+		rec.Finish(transcript.Result{Status: http.StatusBadRequest, Model: req.Model, Error: err.Error()})
+		httppkg.WriteClaudeErrorWithType(w, http.StatusBadRequest, "invalid_request_error", err.Error())
+		return
+	}
+	gwcommon.DowngradeThinking(w, req.Model, vreq)
+	scrubber := gwcommon.NewPIIScrubber()
+	scrubber.ScrubRequest(vreq)
+	hookInfo := &hooks.Info{Endpoint: "claude", Model: req.Model, Stream: req.Stream, Header: r.Header}
+	if apiErr := hooks.BeforeRequest(r.Context(), hookInfo, vreq); apiErr != nil {
+		rec.Finish(transcript.Result{Status: apiErr.Status, Model: req.Model, VertexRequest: vreq, Error: apiErr.Message})
+		httppkg.WriteClaudeError(w, apiErr.Status, apiErr.Message)
 		return
 	}
 
@@ -57,58 +119,125 @@ func HandleMessages(w http.ResponseWriter, r *http.Request) {
 		attempts = 1
 	}
 	if req.Stream {
-		handleStreamWithRetry(w, r, &req, vreq, requestID, inputTokens, store, attempts)
+		handleStreamWithRetry(w, r, &req, vreq, requestID, sessionID, inputTokens, store, attempts, rec, scrubber, hookInfo)
 		return
 	}
 
 	startTime := time.Now()
-	var vresp *vertex.Response
-	var lastErr error
-	for attempt := 0; attempt < attempts; attempt++ {
-		acc, err := store.GetToken()
-		if err != nil {
+	generate := func() (*vertex.Response, error) {
+		var vresp *vertex.Response
+		var lastErr error
+		for attempt := 0; attempt < attempts; attempt++ {
+			acc, err := store.GetTokenForModel(vreq.Model, modelutil.IsImageModel(vreq.Model))
+			if err != nil {
+				lastErr = err
+				break
+			}
+			projectID := acc.ProjectID
+			if projectID == "" {
+				projectID = id.ProjectID()
+			}
+			rec.SetAccount(acc.Email)
+			vreq.Project = projectID
+			vreq.Request.SessionID = acc.SessionID
+			if sessionID != "" {
+				vreq.Request.SessionID = sessionID
+			}
+
+			vresp, err = vertex.GenerateContent(r.Context(), vreq, acc.AccessToken)
+			if refreshed, ok := gwcommon.RefreshOnUnauthorized(store, acc, err); ok {
+				vresp, err = vertex.GenerateContent(r.Context(), vreq, refreshed.AccessToken)
+				gwcommon.DisableOnUnauthenticated(store, refreshed, err)
+			}
+			if err == nil {
+				vreq.Account = acc.SessionID
+				gwcommon.SetQuotaHeaders(w, acc.SessionID, vreq.Model)
+				return vresp, nil
+			}
 			lastErr = err
-			break
-		}
-		projectID := acc.ProjectID
-		if projectID == "" {
-			projectID = id.ProjectID()
+			if !gwcommon.ShouldRetryWithNextToken(err) {
+				break
+			}
 		}
-		vreq.Project = projectID
-		vreq.Request.SessionID = acc.SessionID
+		return nil, lastErr
+	}
 
-		vresp, err = vertex.GenerateContent(r.Context(), vreq, acc.AccessToken)
-		if err == nil {
-			lastErr = nil
-			break
+	vresp, lastErr := generate()
+	vresp, servedModel, lastErr := gwcommon.TryModelFallbacks(req.Model, vresp, lastErr, func(fallback string) (*vertex.Response, error) {
+		fbReq := req
+		fbReq.Model = fallback
+		fbVreq, fbRequestID, err := ToVertexRequest(&fbReq, placeholder)
+		if err != nil {
+			return nil, err
 		}
-		lastErr = err
-		if !gwcommon.ShouldRetryWithNextToken(err) {
-			break
+		gwcommon.ApplyKeyPreset(r.Context(), fbVreq)
+		_ = gwcommon.ApplyThinkingHeaders(r.Header, fallback, fbVreq)
+		gwcommon.DowngradeThinking(w, fallback, fbVreq)
+		scrubber.ScrubRequest(fbVreq)
+		fbInfo := *hookInfo
+		fbInfo.Model = fallback
+		if apiErr := hooks.BeforeRequest(r.Context(), &fbInfo, fbVreq); apiErr != nil {
+			return nil, apiErr
 		}
+		vreq, requestID = fbVreq, fbRequestID
+		return generate()
+	})
+	vresp, servedModel, lastErr = gwcommon.TrySecondaryBackend(r.Context(), req.Model, servedModel, vresp, lastErr, func(target string) (*vertex.Response, error) {
+		return secondary.GenerateContent(r.Context(), target, vreq)
+	})
+	gwcommon.SetServedModelHeaders(w, servedModel)
+	gwcommon.SetUpstreamHeaders(w, vresp, lastErr)
+	if lastErr == nil && gwcommon.IsMalformedFunctionCall(vresp) && gwcommon.ForceAnyToolMode(vreq) {
+		logger.Warn("上游返回 MALFORMED_FUNCTION_CALL，使用 toolConfig.mode=ANY 重试一次")
+		vresp, lastErr = generate()
 	}
 	if lastErr != nil || vresp == nil {
-		status := gwcommon.StatusFromVertexError(lastErr)
-		if _, ok := lastErr.(*vertex.APIError); !ok {
-			status = http.StatusServiceUnavailable
-		}
+		status := gwcommon.UpstreamFailureStatus(lastErr)
 		if logger.IsClientLogEnabled() {
 			logger.ClientResponse(status, time.Since(startTime), lastErr.Error())
 		}
-		httppkg.WriteClaudeError(w, status, lastErr.Error())
+		rec.Finish(transcript.Result{Status: status, Model: servedModel, VertexRequest: vreq, Error: lastErr.Error()})
+		writeUpstreamError(w, status, lastErr)
+		return
+	}
+	if gwcommon.IsMalformedFunctionCall(vresp) {
+		if logger.IsClientLogEnabled() {
+			logger.ClientResponse(http.StatusBadGateway, time.Since(startTime), gwcommon.MalformedFunctionCallMessage)
+		}
+		rec.Finish(transcript.Result{Status: http.StatusBadGateway, Model: servedModel, VertexRequest: vreq, VertexResponse: vresp, Error: gwcommon.MalformedFunctionCallMessage})
+		httppkg.WriteClaudeError(w, http.StatusBadGateway, gwcommon.MalformedFunctionCallMessage)
+		return
+	}
+	if fb := gwcommon.BlockedPromptFeedback(vresp); fb != nil {
+		msg := gwcommon.ContentFilterMessage(fb)
+		if logger.IsClientLogEnabled() {
+			logger.ClientResponse(http.StatusBadRequest, time.Since(startTime), msg)
+		}
+		rec.Finish(transcript.Result{Status: http.StatusBadRequest, Model: servedModel, VertexRequest: vreq, VertexResponse: vresp, Error: msg})
+		httppkg.WriteClaudeErrorWithType(w, http.StatusBadRequest, "invalid_request_error", msg)
 		return
 	}
 
-	out := ToMessagesResponse(vresp, requestID, req.Model, inputTokens)
+	scrubber.RestoreResponse(vresp)
+	gwcommon.NewPrefillJoiner(vreq).JoinResponse(vresp)
+	respBytes = vresp.InlineDataBytes()
+	gwcommon.RecordResponseUsage(r.Context(), "claude", servedModel, vreq, vresp)
+	msg := ToMessagesResponse(vresp, requestID, servedModel, inputTokens, req.StopSequences, req.Tenant)
+	msg.Model = gwcommon.ResponseModel(req.Model, servedModel)
+	if req.ClaudeCode {
+		applyClaudeCodeUsage(msg, vresp, req.Version)
+	}
+	out := hooks.AfterResponse(r.Context(), hookInfo, msg)
 	if logger.IsClientLogEnabled() {
 		logger.ClientResponse(http.StatusOK, time.Since(startTime), out)
 	}
+	rec.Finish(transcript.Result{Status: http.StatusOK, Model: servedModel, VertexRequest: vreq, VertexResponse: vresp, ClientResponse: out})
 	httppkg.WriteJSON(w, http.StatusOK, out)
 }
 
 func HandleListModels(w http.ResponseWriter, r *http.Request) {
 	if logger.IsClientLogEnabled() {
-		logger.ClientRequestWithHeaders(r.Method, r.URL.Path, r.Header, nil)
+		logger.ClientRequestWithHeaders(r.Method, r.URL.RequestURI(), r.Header, nil)
 	}
 	startTime := time.Now()
 	store := credential.GetStore()
@@ -140,14 +269,11 @@ func HandleListModels(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 	if lastErr != nil || vm == nil {
-		status := gwcommon.StatusFromVertexError(lastErr)
-		if _, ok := lastErr.(*vertex.APIError); !ok {
-			status = http.StatusServiceUnavailable
-		}
+		status := gwcommon.UpstreamFailureStatus(lastErr)
 		if logger.IsClientLogEnabled() {
 			logger.ClientResponse(status, time.Since(startTime), lastErr.Error())
 		}
-		httppkg.WriteClaudeError(w, status, lastErr.Error())
+		writeUpstreamError(w, status, lastErr)
 		return
 	}
 
@@ -155,7 +281,7 @@ func HandleListModels(w http.ResponseWriter, r *http.Request) {
 
 	items := make([]ModelItem, 0, len(ids))
 	for _, mid := range ids {
-		items = append(items, ModelItem{ID: mid, Type: "model", DisplayName: mid})
+		items = append(items, newModelItem(mid, vm))
 	}
 
 	out := ModelListResponse{Data: items}
@@ -165,15 +291,69 @@ func HandleListModels(w http.ResponseWriter, r *http.Request) {
 	httppkg.WriteJSON(w, http.StatusOK, out)
 }
 
+// HandleRetrieveModel 处理 Anthropic SDK models.retrieve 发出的 GET /v1/models/{model_id}。
+func HandleRetrieveModel(w http.ResponseWriter, r *http.Request, modelID string) {
+	if logger.IsClientLogEnabled() {
+		logger.ClientRequestWithHeaders(r.Method, r.URL.RequestURI(), r.Header, nil)
+	}
+	startTime := time.Now()
+
+	vm, err := gwcommon.FetchAvailableModels(r.Context())
+	if err != nil {
+		status := gwcommon.FetchModelsErrorStatus(err)
+		if logger.IsClientLogEnabled() {
+			logger.ClientResponse(status, time.Since(startTime), err.Error())
+		}
+		httppkg.WriteClaudeError(w, status, err.Error())
+		return
+	}
+	mid, ok := gwcommon.FindModelID(vm, modelID)
+	if !ok {
+		msg := "model: " + modelID
+		if logger.IsClientLogEnabled() {
+			logger.ClientResponse(http.StatusNotFound, time.Since(startTime), msg)
+		}
+		httppkg.WriteClaudeErrorWithType(w, http.StatusNotFound, "not_found_error", msg)
+		return
+	}
+
+	out := newModelItem(mid, vm)
+	if logger.IsClientLogEnabled() {
+		logger.ClientResponse(http.StatusOK, time.Since(startTime), out)
+	}
+	httppkg.WriteJSON(w, http.StatusOK, out)
+}
+
+func newModelItem(mid string, vm *vertex.AvailableModelsResponse) ModelItem {
+	caps := modelutil.CapabilitiesFor(mid, modelutil.UpstreamModelInfo(vm.Models, mid))
+	return ModelItem{
+		ID:               mid,
+		Type:             "model",
+		DisplayName:      mid,
+		CreatedAt:        gwcommon.ModelsCreatedAt.Format(time.RFC3339),
+		MaxInputTokens:   caps.ContextWindow,
+		MaxOutputTokens:  caps.MaxOutputTokens,
+		InputModalities:  caps.InputModalities,
+		OutputModalities: caps.OutputModalities,
+		SupportsThinking: caps.SupportsThinking,
+	}
+}
+
 func HandleCountTokens(w http.ResponseWriter, r *http.Request) {
-	body, err := io.ReadAll(r.Body)
+	if _, err := negotiateVersion(r.Header); err != nil {
+		httppkg.WriteClaudeErrorWithType(w, http.StatusBadRequest, "invalid_request_error", err.Error())
+		return
+	}
+	reqBody, err := spool.ReadRequest(r)
 	if err != nil {
 		httppkg.WriteClaudeError(w, http.StatusBadRequest, "读取请求体失败，请检查请求是否正确发送。")
 		return
 	}
+	defer reqBody.Close()
+	body := reqBody.Bytes()
 
 	if logger.IsClientLogEnabled() {
-		logger.ClientRequestWithHeaders(r.Method, r.URL.Path, r.Header, body)
+		logger.ClientRequestWithHeaders(r.Method, r.URL.RequestURI(), r.Header, body)
 	}
 	// Use same request schema.
 	var req MessagesRequest
@@ -190,42 +370,113 @@ func HandleCountTokens(w http.ResponseWriter, r *http.Request) {
 	httppkg.WriteJSON(w, http.StatusOK, out)
 }
 
-func handleStreamWithRetry(w http.ResponseWriter, r *http.Request, req *MessagesRequest, vreq *vertex.Request, requestID string, inputTokens int, store *credential.Store, attempts int) {
+func handleStreamWithRetry(w http.ResponseWriter, r *http.Request, req *MessagesRequest, vreq *vertex.Request, requestID, sessionID string, inputTokens int, store *credential.Store, attempts int, rec *transcript.Recorder, scrubber *gwcommon.PIIScrubber, hookInfo *hooks.Info) {
 	startTime := time.Now()
-	var resp *http.Response
-	var err error
-	for attempt := 0; attempt < attempts; attempt++ {
-		acc, accErr := store.GetToken()
-		if accErr != nil {
-			err = accErr
-			break
-		}
-		projectID := acc.ProjectID
-		if projectID == "" {
-			projectID = id.ProjectID()
+	var upstream gwcommon.UpstreamTimer
+	openStream := func() (*http.Response, error) {
+		var resp *http.Response
+		var err error
+		upstream.Start()
+		for attempt := 0; attempt < attempts; attempt++ {
+			acc, accErr := store.GetTokenForModel(vreq.Model, modelutil.IsImageModel(vreq.Model))
+			if accErr != nil {
+				err = accErr
+				break
+			}
+			projectID := acc.ProjectID
+			if projectID == "" {
+				projectID = id.ProjectID()
+			}
+			rec.SetAccount(acc.Email)
+			vreq.Project = projectID
+			vreq.Request.SessionID = acc.SessionID
+			if sessionID != "" {
+				vreq.Request.SessionID = sessionID
+			}
+
+			resp, err = vertex.GenerateContentStream(r.Context(), vreq, acc.AccessToken)
+			if refreshed, ok := gwcommon.RefreshOnUnauthorized(store, acc, err); ok {
+				resp, err = vertex.GenerateContentStream(r.Context(), vreq, refreshed.AccessToken)
+				gwcommon.DisableOnUnauthenticated(store, refreshed, err)
+			}
+			if err == nil {
+				upstream.Opened(acc.Email)
+				vreq.Account = acc.SessionID
+				gwcommon.SetQuotaHeaders(w, acc.SessionID, vreq.Model)
+				break
+			}
+			if !gwcommon.ShouldRetryWithNextToken(err) {
+				break
+			}
 		}
-		vreq.Project = projectID
-		vreq.Request.SessionID = acc.SessionID
+		return resp, err
+	}
 
-		resp, err = vertex.GenerateContentStream(r.Context(), vreq, acc.AccessToken)
-		if err == nil {
-			break
+	resp, err := openStream()
+	resp, servedModel, err := gwcommon.TryModelFallbacks(req.Model, resp, err, func(fallback string) (*http.Response, error) {
+		fbReq := *req
+		fbReq.Model = fallback
+		fbVreq, fbRequestID, buildErr := ToVertexRequest(&fbReq, &gwcommon.AccountContext{ProjectID: id.ProjectID(), SessionID: id.SessionID()})
+		if buildErr != nil {
+			return nil, buildErr
 		}
-		if !gwcommon.ShouldRetryWithNextToken(err) {
-			break
+		gwcommon.ApplyKeyPreset(r.Context(), fbVreq)
+		_ = gwcommon.ApplyThinkingHeaders(r.Header, fallback, fbVreq)
+		gwcommon.DowngradeThinking(w, fallback, fbVreq)
+		scrubber.ScrubRequest(fbVreq)
+		fbInfo := *hookInfo
+		fbInfo.Model = fallback
+		if apiErr := hooks.BeforeRequest(r.Context(), &fbInfo, fbVreq); apiErr != nil {
+			return nil, apiErr
 		}
-	}
+		vreq, requestID = fbVreq, fbRequestID
+		return openStream()
+	})
+	resp, servedModel, err = gwcommon.TrySecondaryBackend(r.Context(), req.Model, servedModel, resp, err, func(target string) (*http.Response, error) {
+		return secondary.GenerateContentStream(r.Context(), target, vreq)
+	})
+	gwcommon.SetServedModelHeaders(w, servedModel)
+	gwcommon.SetUpstreamStreamHeaders(w, resp, err)
 	if err != nil {
+		rec.Finish(transcript.Result{Status: gwcommon.StatusFromVertexError(err), Model: servedModel, VertexRequest: vreq, Error: err.Error()})
+		if gwcommon.IsAuthError(err) {
+			// 尚未开始输出 SSE，认证失败直接返回对应的 HTTP 状态码，便于客户端重新认证或重试。
+			httppkg.WriteClaudeError(w, gwcommon.StatusFromVertexError(err), err.Error())
+			return
+		}
 		httppkg.SetSSEHeaders(w)
-		_ = writeSSEError(w, err.Error())
+		_ = writeSSEErrorWithType(w, upstreamErrorType(err), gwcommon.UpstreamErrorMessage(err))
 		return
 	}
 
 	httppkg.SetSSEHeaders(w)
-	emitter := NewSSEEmitter(w, requestID, req.Model, inputTokens)
+	w, flushDone := httppkg.BatchSSEFlushes(w)
+	defer flushDone()
+	emitter := NewSSEEmitter(w, requestID, servedModel, inputTokens)
+	emitter.echoModel = gwcommon.ResponseModel(req.Model, servedModel)
+	emitter.claudeCode = req.ClaudeCode
+	emitter.cacheUsage = req.ClaudeCode && hasCacheUsage(req.Version)
+	emitter.tenant = req.Tenant
+	_, emitter.webSearch = vreq.ProxyFunctions[gwcommon.WebSearchName]
 	_ = emitter.Start()
+	stopPing := emitter.StartPing(time.Duration(config.Get().ClaudePingSeconds) * time.Second)
+	defer stopPing()
+	prefill := gwcommon.NewPrefillJoiner(vreq)
 
-	streamResult, _ := vertex.ParseStreamWithResult(resp, func(data *vertex.StreamData) error {
+	guard := gwcommon.NewThinkingGuard()
+	defer guard.Stop()
+	guard.Arm(resp.Body)
+	limit := gwcommon.NewOutputLimit()
+	stops := newStopSequenceMatcher(req.StopSequences)
+	receiver := func(data *vertex.StreamData) error {
+		if err := guard.ObserveStreamData(data); err != nil {
+			return err
+		}
+		if err := limit.ObserveStreamData(data); err != nil {
+			return err
+		}
+		scrubber.RestoreStreamData(data)
+		prefill.JoinStreamData(data)
 		if len(data.Response.Candidates) == 0 {
 			return nil
 		}
@@ -237,12 +488,73 @@ func handleStreamWithRetry(w http.ResponseWriter, r *http.Request, req *Messages
 			}
 		}
 		for _, p := range c.Content.Parts {
-			if err := emitter.ProcessPart(StreamDataPart{Text: p.Text, FunctionCall: p.FunctionCall, Thought: p.Thought, ThoughtSignature: p.ThoughtSignature}); err != nil {
+			part := StreamDataPart{Text: p.Text, FunctionCall: p.FunctionCall, FunctionResponse: p.FunctionResponse, Thought: p.Thought, ThoughtSignature: p.ThoughtSignature}
+			if !p.Thought && p.Text != "" {
+				part.Text = stops.Feed(p.Text)
+			} else if pending := stops.Flush(); pending != "" {
+				// 非正文内容之前先输出暂存的正文，保持顺序。
+				if err := emitter.ProcessPart(StreamDataPart{Text: pending}); err != nil {
+					return err
+				}
+			}
+			if _, matched := stops.Matched(); matched && part.Text == "" {
+				return errStopSequence
+			}
+			if err := emitter.ProcessPart(part); err != nil {
 				return err
 			}
+			if _, matched := stops.Matched(); matched {
+				return errStopSequence
+			}
 		}
 		return nil
-	})
+	}
+	parse := func() (*vertex.StreamResult, error) {
+		result, err := vertex.ParseStreamWithResult(resp, receiver)
+		if errors.Is(err, errStopSequence) {
+			err = nil
+		}
+		return result, err
+	}
+	streamResult, streamErr := parse()
+
+	// 上游流在输出任何内容之前中断（连接被重置、gzip 截断等）时，换一个账号透明地重试一次。
+	if gwcommon.ShouldRetryStream(r.Context(), streamErr, emitter.HasOutput(), guard) {
+		logger.Warn("上游流在输出内容前中断（%v），重试一次", streamErr)
+		if resp, err = openStream(); err == nil {
+			guard.Arm(resp.Body)
+			streamResult, streamErr = parse()
+		}
+	}
+
+	// 尚未输出任何内容块时，MALFORMED_FUNCTION_CALL 可以透明地用 mode=ANY 重试一次。
+	if streamResult.FinishReason == gwcommon.FinishReasonMalformedFunctionCall && !emitter.HasOutput() && gwcommon.ForceAnyToolMode(vreq) {
+		logger.Warn("上游返回 MALFORMED_FUNCTION_CALL，使用 toolConfig.mode=ANY 重试一次")
+		if resp, err = openStream(); err == nil {
+			guard.Arm(resp.Body)
+			streamResult, streamErr = parse()
+		}
+	}
+	// 上游已结束：停止 ping，后面的错误事件会绕过 emitter 直接写 w。
+	stopPing()
+	if errors.Is(streamErr, gwcommon.ErrOutputLimit) {
+		// 输出超过 MAX_STREAM_OUTPUT_BYTES / MAX_STREAM_OUTPUT_TOKENS：已截断，按输出长度上限正常结束。
+		streamErr = nil
+	}
+	defer memory.AfterLargeRequest(streamResult.Bytes)
+	gwcommon.RecordStreamUsage(r.Context(), "claude", servedModel, vreq, streamResult.Usage, gwcommon.EstimateStreamOutput(streamResult))
+
+	if text, thought := scrubber.FlushStream(); text != "" || thought != "" {
+		if thought != "" {
+			_ = emitter.ProcessPart(StreamDataPart{Text: thought, Thought: true})
+		}
+		if text = stops.Feed(prefill.Text(text)); text != "" {
+			_ = emitter.ProcessPart(StreamDataPart{Text: text})
+		}
+	}
+	if text := stops.Flush(); text != "" {
+		_ = emitter.ProcessPart(StreamDataPart{Text: text})
+	}
 
 	duration := time.Since(startTime)
 	if logger.IsBackendLogEnabled() {
@@ -251,12 +563,62 @@ func handleStreamWithRetry(w http.ResponseWriter, r *http.Request, req *Messages
 	if logger.IsClientLogEnabled() {
 		logger.ClientStreamResponse(http.StatusOK, duration, emitter.GetMergedResponse())
 	}
+	result := transcript.Result{Status: http.StatusOK, Model: servedModel, VertexRequest: vreq, VertexResponse: streamResult.MergedResponse}
+	if rec != nil {
+		result.ClientResponse = emitter.GetMergedResponse()
+	}
+
+	if err != nil {
+		result.Error = err.Error()
+		rec.Finish(result)
+		_ = writeSSEErrorWithType(w, upstreamErrorType(err), gwcommon.UpstreamErrorMessage(err))
+		return
+	}
+	if limitErr := guard.Err(); limitErr != nil {
+		result.Error = limitErr.Error()
+		rec.Finish(result)
+		_ = writeSSEErrorWithType(w, "api_error", result.Error)
+		return
+	}
+	if streamErr != nil {
+		logger.Error("Stream scan error: %v", streamErr)
+		result.Error = gwcommon.StreamInterruptedMessage(streamErr)
+		rec.Finish(result)
+		_ = writeSSEErrorWithType(w, upstreamErrorType(streamErr), result.Error)
+		return
+	}
+	if streamResult.FinishReason == gwcommon.FinishReasonMalformedFunctionCall && !emitter.HasOutput() {
+		result.Error = gwcommon.MalformedFunctionCallMessage
+		rec.Finish(result)
+		_ = writeSSEError(w, gwcommon.MalformedFunctionCallMessage)
+		return
+	}
+	if streamResult.PromptFeedback != nil && !emitter.HasOutput() {
+		result.Error = gwcommon.ContentFilterMessage(streamResult.PromptFeedback)
+		rec.Finish(result)
+		_ = writeSSEErrorWithType(w, "invalid_request_error", result.Error)
+		return
+	}
+	rec.Finish(result)
 
 	stopReason := "end_turn"
-	if len(streamResult.ToolCalls) > 0 {
+	stopSequence := ""
+	if limit.Exceeded() {
+		stopReason = "max_tokens"
+	} else if hasClientToolCalls(streamResult.ToolCalls, vreq) {
 		stopReason = "tool_use"
+	} else if seq, ok := stops.Matched(); ok {
+		stopReason = "stop_sequence"
+		stopSequence = seq
+	}
+	if streamResult.Usage != nil {
+		emitter.SetPromptTokens(streamResult.Usage.PromptTokenCount)
 	}
-	_ = emitter.Finish(outputTokens(streamResult.Usage), stopReason)
+	if gwcommon.WantDebugInfo(hookInfo.Header) {
+		emitter.SetDebugInfo(upstream.DebugInfo(servedModel, resp))
+	}
+	_ = emitter.Finish(outputTokens(streamResult.Usage), stopReason, stopSequence)
+	hooks.AfterResponse(r.Context(), hookInfo, streamResult)
 }
 
 func outputTokens(usage *vertex.UsageMetadata) int {
@@ -278,9 +640,27 @@ func estimateTokens(body []byte) int {
 	return c
 }
 
+// writeUpstreamError 在开始输出之前以 status 返回生成请求的失败（上游超时时提示调整 TIMEOUT）。
+func writeUpstreamError(w http.ResponseWriter, status int, err error) {
+	httppkg.WriteClaudeErrorWithType(w, status, upstreamErrorType(err), gwcommon.UpstreamErrorMessage(err))
+}
+
+// upstreamErrorType 返回上游错误对应的 error.type：上游超时为 overloaded_error（SDK 会按可重试的过载错误处理），其他为 api_error。
+func upstreamErrorType(err error) string {
+	if gwcommon.IsUpstreamTimeout(err) {
+		return "overloaded_error"
+	}
+	return "api_error"
+}
+
 func writeSSEError(w http.ResponseWriter, msg string) error {
+	return writeSSEErrorWithType(w, "api_error", msg)
+}
+
+func writeSSEErrorWithType(w http.ResponseWriter, errType, msg string) error {
 	encoded, _ := jsonpkg.MarshalString(msg)
-	_, err := w.Write([]byte("event: error\ndata: {\"type\":\"error\",\"error\":{\"type\":\"api_error\",\"message\":" + strings.Trim(encoded, "\"") + "}}\n\n"))
+	encodedType, _ := jsonpkg.MarshalString(errType)
+	_, err := w.Write([]byte("event: error\ndata: {\"type\":\"error\",\"error\":{\"type\":" + encodedType + ",\"message\":" + encoded + "}}\n\n"))
 	if f, ok := w.(http.Flusher); ok {
 		f.Flush()
 	}
@@ -8,10 +8,23 @@ type MessagesRequest struct {
 	Stream        bool      `json:"stream"`
 	Temperature   *float64  `json:"temperature,omitempty"`
 	TopP          *float64  `json:"top_p,omitempty"`
+	TopK          int       `json:"top_k,omitempty"`
 	StopSequences []string  `json:"stop_sequences,omitempty"`
 	Tools         []Tool    `json:"tools,omitempty"`
 	ToolChoice    any       `json:"tool_choice,omitempty"`
 	Thinking      *Thinking `json:"thinking,omitempty"`
+	// MediaResolution 为扩展字段：按请求覆盖 Gemini 3 的 mediaResolution（low / medium / high），
+	// 未设置时取 X-Media-Resolution 请求头（见 gwcommon.ResolveMediaResolution）。
+	MediaResolution *string `json:"media_resolution,omitempty"`
+
+	// ClaudeCode 表示请求来自 Claude Code（见 isClaudeCodeRequest），不参与 JSON 编解码。
+	ClaudeCode bool `json:"-"`
+	// Version 为协商后的 anthropic-version（见 negotiateVersion），决定响应中可用的字段，不参与 JSON 编解码。
+	Version string `json:"-"`
+	// NoSystemInjection 表示跳过 agent 系统提示词注入（见 gwcommon.SkipSystemInjection），不参与 JSON 编解码。
+	NoSystemInjection bool `json:"-"`
+	// Tenant 为请求所属的租户（见 middleware.TenantFromContext），签名按租户隔离保存，不参与 JSON 编解码。
+	Tenant string `json:"-"`
 }
 
 type Message struct {
@@ -35,9 +48,15 @@ type ContentBlock struct {
 }
 
 type Tool struct {
+	// Type 为服务端工具的版本化类型（例如 code_execution_20250522），普通自定义工具为空或 "custom"。
+	Type        string         `json:"type,omitempty"`
 	Name        string         `json:"name"`
 	Description string         `json:"description,omitempty"`
 	InputSchema map[string]any `json:"input_schema"`
+	// MaxUses / AllowedDomains / BlockedDomains 为 web_search 服务端工具的参数（见 webSearchTool）。
+	MaxUses        int      `json:"max_uses,omitempty"`
+	AllowedDomains []string `json:"allowed_domains,omitempty"`
+	BlockedDomains []string `json:"blocked_domains,omitempty"`
 }
 
 type Thinking struct {
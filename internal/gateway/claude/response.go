@@ -23,6 +23,15 @@ type MessagesResponse struct {
 type Usage struct {
 	InputTokens  int `json:"input_tokens"`
 	OutputTokens int `json:"output_tokens"`
+	// 缓存相关字段仅在 Claude Code 兼容模式下输出（上游不提供缓存统计，固定为 0）。
+	CacheCreationInputTokens *int `json:"cache_creation_input_tokens,omitempty"`
+	CacheReadInputTokens     *int `json:"cache_read_input_tokens,omitempty"`
+	// ServerToolUse 为代为执行的服务端工具的调用次数（见 webSearchTool），没有调用时省略。
+	ServerToolUse *ServerToolUsage `json:"server_tool_use,omitempty"`
+}
+
+type ServerToolUsage struct {
+	WebSearchRequests int `json:"web_search_requests"`
 }
 
 type TokenCountResponse struct {
@@ -31,7 +40,7 @@ type TokenCountResponse struct {
 	Tokens      int `json:"tokens"`
 }
 
-func ToMessagesResponse(resp *vertex.Response, requestID string, model string, inputTokens int) *MessagesResponse {
+func ToMessagesResponse(resp *vertex.Response, requestID string, model string, inputTokens int, stopSequences []string, tenant string) *MessagesResponse {
 	out := &MessagesResponse{
 		ID:         "msg_" + requestID,
 		Type:       "message",
@@ -47,14 +56,17 @@ func ToMessagesResponse(resp *vertex.Response, requestID string, model string, i
 	if len(resp.Response.Candidates) == 0 {
 		return out
 	}
-	parts := resp.Response.Candidates[0].Content.Parts
+	searchBlocks, parts, searches := splitWebSearchParts(resp.Response.Candidates[0].Content.Parts, modelutil.IsClaude(model))
+	if searches > 0 {
+		out.Usage.ServerToolUse = &ServerToolUsage{WebSearchRequests: searches}
+	}
 
 	var text string
 	var thinking string
 	var thinkingSignature string
 	var toolUses []ContentBlock
 
-	sigMgr := sigpkg.GetManager()
+	sigMgr := sigpkg.GetManagerFor(tenant)
 	for _, p := range parts {
 		if modelutil.IsClaude(model) && p.Thought && p.ThoughtSignature != "" {
 			thinkingSignature = p.ThoughtSignature
@@ -78,14 +90,23 @@ func ToMessagesResponse(resp *vertex.Response, requestID string, model string, i
 				sig = thinkingSignature
 			}
 			if sig != "" {
-				sigMgr.Save(requestID, idv, sig, thinking, model)
+				sigMgr.SaveToolCall(requestID, idv, sigpkg.CallKey(p.FunctionCall.Name, p.FunctionCall.Args), sig, thinking, model)
 			}
 			toolUses = append(toolUses, ContentBlock{Type: "tool_use", ID: idv, Name: p.FunctionCall.Name, Input: p.FunctionCall.Args})
 			out.StopReason = "tool_use"
 		}
 	}
 
-	blocks := make([]ContentBlock, 0, 2+len(toolUses))
+	if i, seq, ok := findStopSequence(text, stopSequences); ok {
+		// Anthropic 在停止序列处结束输出：正文不包含命中的序列，其后的工具调用也不会产生。
+		text = text[:i]
+		toolUses = nil
+		out.StopReason = "stop_sequence"
+		out.StopSequence = &seq
+	}
+
+	blocks := make([]ContentBlock, 0, len(searchBlocks)+2+len(toolUses))
+	blocks = append(blocks, searchBlocks...)
 	if thinking != "" || thinkingSignature != "" {
 		blocks = append(blocks, ContentBlock{Type: "thinking", Thinking: thinking, Signature: thinkingSignature})
 	}
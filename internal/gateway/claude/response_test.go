@@ -0,0 +1,260 @@
+package claude
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+	"unicode/utf8"
+
+	gwcommon "anti2api-golang/refactor/internal/gateway/common"
+	"anti2api-golang/refactor/internal/vertex"
+)
+
+func TestFindStopSequence(t *testing.T) {
+	seqs := []string{"END", "</answer>", "</ans"}
+	if i, seq, ok := findStopSequence("result</answer> and more END", seqs); !ok || i != 6 || seq != "</answer>" {
+		t.Fatalf("expected earliest and longest match, got %d %q %v", i, seq, ok)
+	}
+	if _, _, ok := findStopSequence("plain answer", seqs); ok {
+		t.Fatalf("expected no match")
+	}
+	if _, _, ok := findStopSequence("END", nil); ok {
+		t.Fatalf("expected no match without stop_sequences")
+	}
+}
+
+func TestStopSequenceMatcher_AcrossChunks(t *testing.T) {
+	m := newStopSequenceMatcher([]string{"</answer>"})
+	var out strings.Builder
+	for _, chunk := range []string{"4", "2 <", "/ans", "wer> ignored", " also ignored"} {
+		out.WriteString(m.Feed(chunk))
+	}
+	if got := out.String() + m.Flush(); got != "42 " {
+		t.Fatalf("unexpected output: %q", got)
+	}
+	if seq, ok := m.Matched(); !ok || seq != "</answer>" {
+		t.Fatalf("expected match, got %q %v", seq, ok)
+	}
+
+	m = newStopSequenceMatcher([]string{"</answer>"})
+	if got := m.Feed("a <") + m.Feed("b>") + m.Flush(); got != "a <b>" {
+		t.Fatalf("held-back prefix should be released when it does not match: %q", got)
+	}
+	if _, ok := m.Matched(); ok {
+		t.Fatalf("unexpected match")
+	}
+}
+
+func TestToMessagesResponse_StopSequence(t *testing.T) {
+	resp := &vertex.Response{}
+	resp.Response.Candidates = []vertex.Candidate{{
+		Content:      vertex.Content{Role: "model", Parts: []vertex.Part{{Text: "hello END and the rest"}}},
+		FinishReason: "STOP",
+	}}
+
+	out := ToMessagesResponse(resp, "req", "gemini-2.5-pro", 1, []string{"END"}, "")
+	if out.StopReason != "stop_sequence" {
+		t.Fatalf("stop_reason mismatch: got %q", out.StopReason)
+	}
+	if out.StopSequence == nil || *out.StopSequence != "END" {
+		t.Fatalf("stop_sequence mismatch: got %v", out.StopSequence)
+	}
+	if len(out.Content) != 1 || out.Content[0].Text != "hello " {
+		t.Fatalf("expected text to be cut at the stop sequence, got %#v", out.Content)
+	}
+
+	resp.Response.Candidates[0].Content.Parts = []vertex.Part{{Text: "no sequence here"}}
+	if out := ToMessagesResponse(resp, "req", "gemini-2.5-pro", 1, []string{"END"}, ""); out.StopReason != "end_turn" || out.StopSequence != nil {
+		t.Fatalf("expected end_turn without a match, got %q %v", out.StopReason, out.StopSequence)
+	}
+}
+
+func TestPrefillWithStopSequence(t *testing.T) {
+	req := &MessagesRequest{
+		Model:         "gemini-2.5-pro",
+		StopSequences: []string{"</answer>"},
+		Messages: []Message{
+			{Role: "user", Content: "What is 6*7?"},
+			{Role: "assistant", Content: []any{map[string]any{"type": "text", "text": "<answer> "}}},
+		},
+	}
+	vreq, _, err := ToVertexRequest(req, &gwcommon.AccountContext{ProjectID: "p", SessionID: "s"})
+	if err != nil {
+		t.Fatalf("ToVertexRequest: %v", err)
+	}
+	last := vreq.Request.Contents[len(vreq.Request.Contents)-1]
+	if last.Role != "model" || len(last.Parts) != 1 || last.Parts[0].Text != "<answer>" {
+		t.Fatalf("prefill should be sent as trailing model turn without trailing whitespace: %#v", last)
+	}
+	if gc := vreq.Request.GenerationConfig; gc == nil || len(gc.StopSequences) != 1 || gc.StopSequences[0] != "</answer>" {
+		t.Fatalf("stop_sequences should be sent upstream, got %#v", gc)
+	}
+
+	// 上游未遵守 stopSequences 时由代理截断。
+
+	resp := &vertex.Response{}
+	resp.Response.Candidates = []vertex.Candidate{{
+		Content:      vertex.Content{Role: "model", Parts: []vertex.Part{{Text: " 42</answer>\n"}}},
+		FinishReason: "STOP",
+	}}
+	gwcommon.NewPrefillJoiner(vreq).JoinResponse(resp)
+	out := ToMessagesResponse(resp, "req", req.Model, 1, req.StopSequences, "")
+	if out.StopReason != "stop_sequence" || out.StopSequence == nil || *out.StopSequence != "</answer>" {
+		t.Fatalf("stop sequence mismatch: %q %v", out.StopReason, out.StopSequence)
+	}
+	if len(out.Content) != 1 || "<answer> "+out.Content[0].Text != "<answer> 42" {
+		t.Fatalf("prefill + continuation should concatenate cleanly: %#v", out.Content)
+	}
+}
+
+func TestSSEEmitter_SplitMultiByteText(t *testing.T) {
+	rec := httptest.NewRecorder()
+	e := NewSSEEmitter(rec, "req", "gemini-2.5-pro", 10)
+	_ = e.Start()
+	raw := []byte("你好")
+	_ = e.ProcessPart(StreamDataPart{Text: string(raw[:4])})
+	_ = e.ProcessPart(StreamDataPart{Text: string(raw[4:])})
+	_ = e.Finish(2, "end_turn", "")
+
+	body := rec.Body.String()
+	if !utf8.ValidString(body) {
+		t.Fatalf("SSE output contains invalid UTF-8: %q", body)
+	}
+	if !strings.Contains(body, `"text":"你"`) || !strings.Contains(body, `"text":"好"`) {
+		t.Fatalf("unexpected text deltas: %s", body)
+	}
+}
+
+func TestSSEEmitter_PingWhileIdle(t *testing.T) {
+	rec := httptest.NewRecorder()
+	e := NewSSEEmitter(rec, "req", "gemini-2.5-pro", 10)
+	_ = e.Start()
+	stop := e.StartPing(5 * time.Millisecond)
+	time.Sleep(40 * time.Millisecond)
+	_ = e.ProcessPart(StreamDataPart{Text: "hi"})
+	_ = e.Finish(1, "end_turn", "")
+	time.Sleep(20 * time.Millisecond)
+	stop()
+	stop()
+
+	body := rec.Body.String()
+	first := strings.Index(body, "event: ping\ndata: {\"type\": \"ping\"}\n\n")
+	if first < 0 || first < strings.Index(body, "event: message_start") {
+		t.Fatalf("expected ping after message_start: %s", body)
+	}
+	if !strings.HasSuffix(body, "event: message_stop\ndata: {\"type\":\"message_stop\"}\n\n") {
+		t.Fatalf("no ping may follow message_stop: %s", body)
+	}
+	for _, ev := range e.collectedEvents {
+		if ev["type"] == "ping" {
+			t.Fatal("timer pings should not be collected into the merged response")
+		}
+	}
+}
+
+func TestSSEEmitter_MessageDeltaCorrectsInputTokens(t *testing.T) {
+	rec := httptest.NewRecorder()
+	e := NewSSEEmitter(rec, "req", "gemini-2.5-pro", 10)
+	_ = e.Start()
+	_ = e.ProcessPart(StreamDataPart{Text: "hi"})
+	e.SetPromptTokens(42)
+	_ = e.Finish(1, "end_turn", "")
+
+	body := rec.Body.String()
+	start, delta := body[:strings.Index(body, "event: content_block_start")], body[strings.Index(body, "event: message_delta"):]
+	if !strings.Contains(start, `"input_tokens":10`) {
+		t.Fatalf("message_start should carry the estimate: %s", start)
+	}
+	if !strings.Contains(delta, `"input_tokens":42`) || strings.Contains(delta, "cache_read_input_tokens") {
+		t.Fatalf("message_delta should carry upstream input tokens only: %s", delta)
+	}
+
+	rec = httptest.NewRecorder()
+	e = NewSSEEmitter(rec, "req", "gemini-2.5-pro", 10)
+	_ = e.Start()
+	_ = e.Finish(0, "end_turn", "")
+	if delta := rec.Body.String()[strings.Index(rec.Body.String(), "event: message_delta"):]; strings.Contains(delta, "input_tokens") {
+		t.Fatalf("without upstream usage message_delta should not repeat input tokens: %s", delta)
+	}
+}
+
+func TestSSEEmitter_DebugInfoOnMessageDelta(t *testing.T) {
+	rec := httptest.NewRecorder()
+	e := NewSSEEmitter(rec, "req", "gemini-2.5-pro", 10)
+	_ = e.Start()
+	_ = e.ProcessPart(StreamDataPart{Text: "hi"})
+	e.SetDebugInfo(&gwcommon.DebugInfo{BackendModel: "gemini-2.5-pro", Endpoint: "daily", UpstreamMs: 1234, Account: "a@example.com"})
+	_ = e.Finish(1, "end_turn", "")
+
+	body := rec.Body.String()
+	start := strings.Index(body, "event: message_delta")
+	if start < 0 {
+		t.Fatalf("missing message_delta: %s", body)
+	}
+	delta := body[start:]
+	delta = delta[:strings.Index(delta, "\n\n")]
+	if !strings.Contains(delta, `"x_ant2api":{"backend_model":"gemini-2.5-pro","endpoint":"daily","upstream_ms":1234,"account":"a@example.com"}`) {
+		t.Fatalf("debug info not on message_delta: %s", delta)
+	}
+	if strings.Count(body, "x_ant2api") != 1 {
+		t.Fatalf("debug info should only appear once: %s", body)
+	}
+}
+
+func webSearchParts() []vertex.Part {
+	return []vertex.Part{
+		{Text: "Let me search. "},
+		{FunctionCall: &vertex.FunctionCall{Name: gwcommon.WebSearchName, Args: map[string]any{"query": "go 1.24"}}},
+		{FunctionResponse: &vertex.FunctionResponse{Name: gwcommon.WebSearchName, Response: map[string]any{
+			"query":   "go 1.24",
+			"results": []any{map[string]any{"title": "Go 1.24", "url": "https://go.dev/doc/go1.24", "page_age": ""}},
+		}}},
+		{Text: "Go 1.24 was released."},
+	}
+}
+
+func TestToMessagesResponse_WebSearchBlocks(t *testing.T) {
+	resp := &vertex.Response{}
+	resp.Response.Candidates = []vertex.Candidate{{Content: vertex.Content{Role: "model", Parts: webSearchParts()}, FinishReason: "STOP"}}
+
+	out := ToMessagesResponse(resp, "req", "gemini-2.5-pro", 1, nil, "")
+	var types []string
+	for _, b := range out.Content {
+		types = append(types, b.Type)
+	}
+	if got := strings.Join(types, ","); got != "text,server_tool_use,web_search_tool_result,text" {
+		t.Fatalf("unexpected block order: %s", got)
+	}
+	if out.Content[1].ID == "" || out.Content[2].ToolUseID != out.Content[1].ID {
+		t.Fatalf("result should reference the server_tool_use id: %#v", out.Content[1:3])
+	}
+	results, _ := out.Content[2].Content.([]map[string]any)
+	if len(results) != 1 || results[0]["type"] != "web_search_result" || results[0]["url"] != "https://go.dev/doc/go1.24" {
+		t.Fatalf("unexpected results: %#v", out.Content[2].Content)
+	}
+	if out.StopReason != "end_turn" || out.Usage.ServerToolUse == nil || out.Usage.ServerToolUse.WebSearchRequests != 1 {
+		t.Fatalf("unexpected stop reason / usage: %s %#v", out.StopReason, out.Usage.ServerToolUse)
+	}
+}
+
+func TestSSEEmitter_WebSearchBlocks(t *testing.T) {
+	rec := httptest.NewRecorder()
+	e := NewSSEEmitter(rec, "req", "gemini-2.5-pro", 1)
+	e.webSearch = true
+	_ = e.Start()
+	for _, p := range webSearchParts() {
+		_ = e.ProcessPart(StreamDataPart{Text: p.Text, FunctionCall: p.FunctionCall, FunctionResponse: p.FunctionResponse})
+	}
+	_ = e.Finish(1, "end_turn", "")
+
+	body := rec.Body.String()
+	for _, want := range []string{`"type":"server_tool_use"`, `"partial_json":"{\"query\":\"go 1.24\"}"`, `"type":"web_search_tool_result"`, `"web_search_requests":1`} {
+		if !strings.Contains(body, want) {
+			t.Fatalf("missing %s in stream:\n%s", want, body)
+		}
+	}
+	if strings.Contains(body, `"type":"tool_use"`) {
+		t.Fatalf("web_search must not be emitted as tool_use:\n%s", body)
+	}
+}
@@ -0,0 +1,130 @@
+package claude
+
+import (
+	"fmt"
+	"strings"
+
+	"anti2api-golang/refactor/internal/config"
+	gwcommon "anti2api-golang/refactor/internal/gateway/common"
+	"anti2api-golang/refactor/internal/logger"
+	jsonpkg "anti2api-golang/refactor/internal/pkg/json"
+)
+
+// serverToolTypePrefixes 为 Anthropic 服务端执行的工具类型前缀（工具定义中的 type 带日期版本号）。
+// 这些工具在 Anthropic 侧执行，Cloud Code 后端无法提供。
+var serverToolTypePrefixes = []string{"web_search_", "web_fetch_", "code_execution_", "tool_search_tool_"}
+
+// serverToolBlockTypes 为服务端工具相关、但不以 "_tool_result" 结尾的内容块类型。
+var serverToolBlockTypes = map[string]bool{
+	"server_tool_use":  true,
+	"mcp_tool_use":     true,
+	"mcp_tool_result":  true,
+	"container_upload": true,
+}
+
+func isServerTool(t Tool) bool {
+	for _, p := range serverToolTypePrefixes {
+		if strings.HasPrefix(t.Type, p) {
+			return true
+		}
+	}
+	return false
+}
+
+// isServerToolBlock 判断内容块是否为服务端工具的调用/结果块
+// （server_tool_use、web_search_tool_result、code_execution_tool_result 等）。
+func isServerToolBlock(typ string) bool {
+	return serverToolBlockTypes[typ] || strings.HasSuffix(typ, "_tool_result")
+}
+
+func unsupportedServerToolError(typ string) error {
+	return fmt.Errorf("content block type %q is not supported: server-side tools (code execution, web search, web fetch, MCP connector) are not available through this proxy; remove these blocks or set CLAUDE_SERVER_TOOL_BLOCKS=text", typ)
+}
+
+// filterServerTools 移除服务端工具定义：text 模式下忽略并告警，reject 模式下返回错误；由代理模拟的工具
+// （见 isEmulatedServerTool）直接移除，另行注入。
+func filterServerTools(tools []Tool) ([]Tool, error) {
+	out := make([]Tool, 0, len(tools))
+	var dropped []string
+	for _, t := range tools {
+		if !isServerTool(t) {
+			out = append(out, t)
+			continue
+		}
+		if isEmulatedServerTool(t) {
+			continue
+		}
+		if config.Get().ClaudeServerToolBlocks == "reject" {
+			return nil, fmt.Errorf("tool type %q is not supported: server-side tools are not available through this proxy; remove it or set CLAUDE_SERVER_TOOL_BLOCKS=text", t.Type)
+		}
+		dropped = append(dropped, t.Type)
+	}
+	if len(dropped) > 0 {
+		logger.Warn("Claude 请求包含服务端工具 %s，Cloud Code 不支持，已忽略", strings.Join(dropped, ", "))
+	}
+	return out, nil
+}
+
+// serverToolBlockText 将历史中的服务端工具块转为带标记的文本，保留调用参数与结果摘要，
+// 使模型仍能看到此前的执行结果。
+func serverToolBlockText(typ string, m map[string]any) string {
+	switch typ {
+	case "server_tool_use", "mcp_tool_use":
+		name, _ := m["name"].(string)
+		input, _ := jsonpkg.MarshalString(m["input"])
+		return fmt.Sprintf("[%s %s] %s", typ, name, input)
+	case "container_upload":
+		fileID, _ := m["file_id"].(string)
+		return fmt.Sprintf("[container_upload] %s", fileID)
+	}
+	body := strings.TrimSpace(serverToolResultText(m["content"]))
+	if body == "" {
+		return fmt.Sprintf("[%s]", typ)
+	}
+	return fmt.Sprintf("[%s]\n%s", typ, gwcommon.TruncateToolResult(body))
+}
+
+func serverToolResultText(content any) string {
+	switch v := content.(type) {
+	case string:
+		return v
+	case []any:
+		var lines []string
+		for _, it := range v {
+			if s := strings.TrimSpace(serverToolResultText(it)); s != "" {
+				lines = append(lines, s)
+			}
+		}
+		return strings.Join(lines, "\n")
+	case map[string]any:
+		typ, _ := v["type"].(string)
+		switch {
+		case typ == "text":
+			t, _ := v["text"].(string)
+			return t
+		case typ == "web_search_result":
+			title, _ := v["title"].(string)
+			url, _ := v["url"].(string)
+			return fmt.Sprintf("- %s %s", title, url)
+		case strings.HasSuffix(typ, "_error"):
+			code, _ := v["error_code"].(string)
+			return "error: " + code
+		}
+		if _, ok := v["stdout"]; ok {
+			var b strings.Builder
+			if s, _ := v["stdout"].(string); s != "" {
+				b.WriteString("stdout:\n" + s + "\n")
+			}
+			if s, _ := v["stderr"].(string); s != "" {
+				b.WriteString("stderr:\n" + s + "\n")
+			}
+			if rc, ok := v["return_code"]; ok {
+				fmt.Fprintf(&b, "return_code: %v", rc)
+			}
+			return b.String()
+		}
+		s, _ := jsonpkg.MarshalString(v)
+		return s
+	}
+	return ""
+}
@@ -0,0 +1,87 @@
+package claude
+
+import (
+	"errors"
+	"strings"
+)
+
+// errStopSequence 由流式 receiver 返回，表示正文已命中 stop_sequences，停止读取上游。
+var errStopSequence = errors.New("命中 stop_sequences")
+
+// findStopSequence 返回 text 中最早出现的停止序列及其位置（同一位置取最长的序列）。
+//
+// stop_sequences 会照常作为 stopSequences 发送给上游（见 buildGenerationConfig），这里只是兜底：
+// 上游未遵守（正文中仍出现序列）时在最早出现的序列处截断，并返回 stop_reason=stop_sequence 与命中的序列。
+// 上游命中序列时只返回 finishReason=STOP 且正文不含该序列，无法与正常结束区分，此时按 end_turn 返回。
+func findStopSequence(text string, stopSequences []string) (int, string, bool) {
+	at, best := -1, ""
+	for _, seq := range stopSequences {
+		if seq == "" {
+			continue
+		}
+		i := strings.Index(text, seq)
+		if i < 0 {
+			continue
+		}
+		if at < 0 || i < at || (i == at && len(seq) > len(best)) {
+			at, best = i, seq
+		}
+	}
+	return at, best, at >= 0
+}
+
+// stopSequenceMatcher 在流式正文中查找停止序列：可能是某个序列前缀的尾部先暂存，确认不构成序列后再输出，
+// 避免序列跨分片时被部分发送给客户端。
+type stopSequenceMatcher struct {
+	seqs    []string
+	pending string
+	matched string
+}
+
+func newStopSequenceMatcher(stopSequences []string) *stopSequenceMatcher {
+	m := &stopSequenceMatcher{}
+	for _, seq := range stopSequences {
+		if seq != "" {
+			m.seqs = append(m.seqs, seq)
+		}
+	}
+	return m
+}
+
+// Feed 处理一段正文并返回可以输出的部分；命中停止序列时返回序列之前的正文，之后的输入都被丢弃。
+func (m *stopSequenceMatcher) Feed(text string) string {
+	if len(m.seqs) == 0 {
+		return text
+	}
+	if m.matched != "" {
+		return ""
+	}
+	buf := m.pending + text
+	if i, seq, ok := findStopSequence(buf, m.seqs); ok {
+		m.matched, m.pending = seq, ""
+		return buf[:i]
+	}
+	hold := 0
+	for _, seq := range m.seqs {
+		for k := min(len(seq)-1, len(buf)); k > hold; k-- {
+			if strings.HasSuffix(buf, seq[:k]) {
+				hold = k
+				break
+			}
+		}
+	}
+	m.pending = buf[len(buf)-hold:]
+	return buf[:len(buf)-hold]
+}
+
+// Flush 返回暂存的正文（流结束或即将输出非正文内容时调用）。
+func (m *stopSequenceMatcher) Flush() string {
+	text := m.pending
+	m.pending = ""
+	return text
+}
+
+// Matched 返回命中的停止序列。
+func (m *stopSequenceMatcher) Matched() (string, bool) {
+	return m.matched, m.matched != ""
+}
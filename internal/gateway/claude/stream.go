@@ -1,11 +1,15 @@
 package claude
 
 import (
+	"cmp"
 	"fmt"
+	"io"
 	"net/http"
 	"strings"
 	"sync"
+	"time"
 
+	gwcommon "anti2api-golang/refactor/internal/gateway/common"
 	"anti2api-golang/refactor/internal/logger"
 	"anti2api-golang/refactor/internal/pkg/id"
 	jsonpkg "anti2api-golang/refactor/internal/pkg/json"
@@ -17,6 +21,7 @@ import (
 type StreamDataPart struct {
 	Text             string
 	FunctionCall     *vertex.FunctionCall
+	FunctionResponse *vertex.FunctionResponse
 	Thought          bool
 	ThoughtSignature string
 }
@@ -33,7 +38,29 @@ type SSEEmitter struct {
 	pendingThinkingSignature string
 	pendingThinkingText      strings.Builder
 	enableThinkingSignature  bool
-	mu                       sync.Mutex
+	// textUTF8 / thinkingUTF8 缓存被上游拆到两个分片中的多字节字符，保证每个 delta 都是合法的 UTF-8。
+	textUTF8     gwcommon.UTF8Buffer
+	thinkingUTF8 gwcommon.UTF8Buffer
+	// claudeCode 启用 Claude Code 兼容的事件格式（见 isClaudeCodeRequest）；promptTokens 为上游返回的真实输入 token 数。
+	claudeCode   bool
+	promptTokens int
+	// cacheUsage 为 true 时 usage 带缓存 token 字段（Claude Code 兼容模式且 anthropic-version 支持，见 hasCacheUsage）。
+	cacheUsage bool
+	// tenant 为请求所属的租户，签名保存到该租户的存储中。
+	tenant string
+	// echoModel 为 message_start 中回显的模型名（见 gwcommon.ResponseModel），为空时使用 model。
+	echoModel string
+	// debug 非空时随 message_delta 输出（见 gwcommon.DebugInfoHeader）。
+	debug *gwcommon.DebugInfo
+	// webSearch 为 true 时 web_search 调用及其结果输出为 server_tool_use / web_search_tool_result 块（见 webSearchTool）；
+	// pendingSearchIDs 为尚未输出结果的 server_tool_use ID，searches 为搜索次数。
+	webSearch        bool
+	pendingSearchIDs []string
+	searches         int
+	// lastWrite 为最近一次写出事件的时间，定时 ping 只在空闲超过间隔时发送；finished 之后不再发送 ping。
+	lastWrite time.Time
+	finished  bool
+	mu        sync.Mutex
 }
 
 func NewSSEEmitter(w http.ResponseWriter, requestID string, model string, inputTokens int) *SSEEmitter {
@@ -49,22 +76,47 @@ func NewSSEEmitter(w http.ResponseWriter, requestID string, model string, inputT
 func (e *SSEEmitter) Start() error {
 	e.mu.Lock()
 	defer e.mu.Unlock()
-	return e.writeSSE("message_start", map[string]any{
+	usage := map[string]any{
+		"input_tokens":  e.inputTokens,
+		"output_tokens": 0,
+	}
+	if e.cacheUsage {
+		usage["cache_creation_input_tokens"] = 0
+		usage["cache_read_input_tokens"] = 0
+	}
+	if err := e.writeSSE("message_start", map[string]any{
 		"type": "message_start",
 		"message": map[string]any{
 			"id":            "msg_" + e.requestID,
 			"type":          "message",
 			"role":          "assistant",
-			"model":         e.model,
+			"model":         cmp.Or(e.echoModel, e.model),
 			"stop_sequence": nil,
-			"usage": map[string]any{
-				"input_tokens":  e.inputTokens,
-				"output_tokens": 0,
-			},
-			"content":     []any{},
-			"stop_reason": nil,
+			"usage":         usage,
+			"content":       []any{},
+			"stop_reason":   nil,
 		},
-	})
+	}); err != nil {
+		return err
+	}
+	if e.claudeCode {
+		return e.writeSSE("ping", map[string]any{"type": "ping"})
+	}
+	return nil
+}
+
+// SetDebugInfo 设置随 message_delta 输出的调试信息。
+func (e *SSEEmitter) SetDebugInfo(info *gwcommon.DebugInfo) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.debug = info
+}
+
+// SetPromptTokens 记录上游 usageMetadata 中的输入 token 数，在 message_delta 中输出以更正 message_start 的估算值。
+func (e *SSEEmitter) SetPromptTokens(n int) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.promptTokens = n
 }
 
 func (e *SSEEmitter) SetSignature(signature string) error {
@@ -90,13 +142,27 @@ func (e *SSEEmitter) ProcessPart(part StreamDataPart) error {
 	if part.Text != "" {
 		return e.sendTextLocked(part.Text)
 	}
+	if part.FunctionCall != nil && e.webSearch && part.FunctionCall.Name == gwcommon.WebSearchName {
+		return e.sendServerToolUseLocked(part.FunctionCall)
+	}
 	if part.FunctionCall != nil {
 		return e.sendToolCallLocked(part.FunctionCall, part.ThoughtSignature)
 	}
+	if part.FunctionResponse != nil && e.webSearch && part.FunctionResponse.Name == gwcommon.WebSearchName {
+		return e.sendWebSearchResultLocked(part.FunctionResponse)
+	}
 	return nil
 }
 
-func (e *SSEEmitter) Finish(outputTokens int, stopReason string) error {
+// HasOutput 报告是否已经输出过内容块（message_start 之外）。
+func (e *SSEEmitter) HasOutput() bool {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.nextIndex > 0
+}
+
+// Finish 关闭所有内容块并输出 message_delta / message_stop；stopSequence 为空时输出 null。
+func (e *SSEEmitter) Finish(outputTokens int, stopReason string, stopSequence string) error {
 	e.mu.Lock()
 	defer e.mu.Unlock()
 
@@ -109,20 +175,95 @@ func (e *SSEEmitter) Finish(outputTokens int, stopReason string) error {
 	_ = e.closeThinkingBlockLocked()
 	_ = e.closeTextBlockLocked()
 
-	_ = e.writeSSE("message_delta", map[string]any{
+	var stopSeq any
+	if stopSequence != "" {
+		stopSeq = stopSequence
+	}
+	usage := map[string]any{
+		"output_tokens": outputTokens,
+	}
+	if e.searches > 0 {
+		usage["server_tool_use"] = map[string]any{"web_search_requests": e.searches}
+	}
+	// message_start 中的 input_tokens 是按请求体估算的；上游返回真实值后在 message_delta 中更正，
+	// 客户端（Anthropic SDK 的累计 usage）以后到的值为准。
+	if e.promptTokens > 0 {
+		usage["input_tokens"] = e.promptTokens
+		if e.cacheUsage {
+			usage["cache_creation_input_tokens"] = 0
+			usage["cache_read_input_tokens"] = 0
+		}
+	}
+	delta := map[string]any{
 		"type": "message_delta",
 		"delta": map[string]any{
 			"stop_reason":   stopReason,
-			"stop_sequence": nil,
-		},
-		"usage": map[string]any{
-			"output_tokens": outputTokens,
+			"stop_sequence": stopSeq,
 		},
-	})
+		"usage": usage,
+	}
+	if e.debug != nil {
+		delta[gwcommon.DebugInfoField] = e.debug
+	}
+	_ = e.writeSSE("message_delta", delta)
 
+	e.finished = true
 	return e.writeSSE("message_stop", map[string]any{"type": "message_stop"})
 }
 
+// pingEvent 为定时 ping 的 SSE 帧，与 Anthropic 官方流一致。
+const pingEvent = "event: ping\ndata: {\"type\": \"ping\"}\n\n"
+
+// StartPing 在 interval > 0 时启动后台定时器：距上一次写出事件超过 interval 时输出一个 ping 事件，
+// 等待上游（例如长时间思考）期间客户端仍能持续收到数据，不会按空闲超时断开连接。
+// 返回的 stop 会等待定时器退出，之后可以安全地绕过 emitter 直接写 w；可重复调用。
+func (e *SSEEmitter) StartPing(interval time.Duration) (stop func()) {
+	if interval <= 0 {
+		return func() {}
+	}
+	quit := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-quit:
+				return
+			case <-ticker.C:
+				if err := e.pingIfIdle(interval); err != nil {
+					return
+				}
+			}
+		}
+	}()
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			close(quit)
+			<-done
+		})
+	}
+}
+
+// pingIfIdle 在空闲超过 interval 时写出 ping；ping 不计入日志中的合并响应。
+func (e *SSEEmitter) pingIfIdle(interval time.Duration) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.finished || time.Since(e.lastWrite) < interval {
+		return nil
+	}
+	if _, err := io.WriteString(e.w, pingEvent); err != nil {
+		return err
+	}
+	e.lastWrite = time.Now()
+	if f, ok := e.w.(http.Flusher); ok {
+		f.Flush()
+	}
+	return nil
+}
+
 // GetMergedResponse returns a merged view of collected SSE event JSON objects,
 // matching the original project's logging output.
 func (e *SSEEmitter) GetMergedResponse() []any {
@@ -230,6 +371,10 @@ func (e *SSEEmitter) ensureThinkingBlock() error {
 }
 
 func (e *SSEEmitter) sendTextLocked(text string) error {
+	text = e.textUTF8.Write(text)
+	if text == "" {
+		return nil
+	}
 	// If we're switching away from a thinking block (to text), flush signature to the thinking block.
 	if e.thinkingBlockIndex != nil && e.enableThinkingSignature && e.pendingThinkingSignature != "" {
 		_ = e.sendSignatureDeltaLocked(*e.thinkingBlockIndex, e.pendingThinkingSignature)
@@ -251,6 +396,10 @@ func (e *SSEEmitter) sendThinkingLocked(text string) error {
 	if err := e.ensureThinkingBlock(); err != nil {
 		return err
 	}
+	text = e.thinkingUTF8.Write(text)
+	if text == "" {
+		return nil
+	}
 	e.pendingThinkingText.WriteString(text)
 	return e.writeSSE("content_block_delta", map[string]any{
 		"type":  "content_block_delta",
@@ -270,15 +419,34 @@ func (e *SSEEmitter) sendToolCallLocked(fc *vertex.FunctionCall, thoughtSignatur
 		fc.ID = toolID
 	}
 	block := map[string]any{"type": "tool_use", "id": toolID, "name": fc.Name, "input": fc.Args}
+	if e.claudeCode {
+		// 官方 API 的 tool_use 块以空 input 开始，参数通过 input_json_delta 给出，Claude Code 只从 delta 中累积参数。
+		block["input"] = map[string]any{}
+	}
 	if err := e.writeSSE("content_block_start", map[string]any{"type": "content_block_start", "index": idx, "content_block": block}); err != nil {
 		return err
 	}
+	if e.claudeCode {
+		args := "{}"
+		if fc.Args != nil {
+			if s, err := jsonpkg.MarshalString(fc.Args); err == nil {
+				args = s
+			}
+		}
+		if err := e.writeSSE("content_block_delta", map[string]any{
+			"type":  "content_block_delta",
+			"index": idx,
+			"delta": map[string]any{"type": "input_json_delta", "partial_json": args},
+		}); err != nil {
+			return err
+		}
+	}
 	sig := strings.TrimSpace(thoughtSignature)
 	if sig == "" {
 		sig = e.pendingThinkingSignature
 	}
 	if sig != "" {
-		signature.GetManager().Save(e.requestID, fc.ID, sig, e.pendingThinkingText.String(), e.model)
+		signature.GetManagerFor(e.tenant).SaveToolCall(e.requestID, fc.ID, signature.CallKey(fc.Name, fc.Args), sig, e.pendingThinkingText.String(), e.model)
 		// Bind the signature to this functionCall; do not attach it to thinking blocks.
 		// Keep pendingThinkingSignature so multiple tool calls in the same turn can reuse it
 		// unless a new signature arrives.
@@ -286,11 +454,75 @@ func (e *SSEEmitter) sendToolCallLocked(fc *vertex.FunctionCall, thoughtSignatur
 	return e.writeSSE("content_block_stop", map[string]any{"type": "content_block_stop", "index": idx})
 }
 
+// sendServerToolUseLocked 输出代为执行的 web_search 调用（server_tool_use 块），结果由 sendWebSearchResultLocked 输出。
+func (e *SSEEmitter) sendServerToolUseLocked(fc *vertex.FunctionCall) error {
+	// 服务端工具调用不会像 tool_use 那样从签名缓存中恢复签名，切换前把签名写入 thinking 块。
+	if e.thinkingBlockIndex != nil && e.enableThinkingSignature && e.pendingThinkingSignature != "" {
+		_ = e.sendSignatureDeltaLocked(*e.thinkingBlockIndex, e.pendingThinkingSignature)
+		e.pendingThinkingSignature = ""
+	}
+	_ = e.closeThinkingBlockLocked()
+	_ = e.closeTextBlockLocked()
+	idx := e.nextIndex
+	e.nextIndex++
+	toolID := serverToolUseID()
+	e.pendingSearchIDs = append(e.pendingSearchIDs, toolID)
+	e.searches++
+	input := "{}"
+	if fc.Args != nil {
+		if s, err := jsonpkg.MarshalString(fc.Args); err == nil {
+			input = s
+		}
+	}
+	if err := e.writeSSE("content_block_start", map[string]any{
+		"type":          "content_block_start",
+		"index":         idx,
+		"content_block": map[string]any{"type": "server_tool_use", "id": toolID, "name": fc.Name, "input": map[string]any{}},
+	}); err != nil {
+		return err
+	}
+	if err := e.writeSSE("content_block_delta", map[string]any{
+		"type":  "content_block_delta",
+		"index": idx,
+		"delta": map[string]any{"type": "input_json_delta", "partial_json": input},
+	}); err != nil {
+		return err
+	}
+	return e.writeSSE("content_block_stop", map[string]any{"type": "content_block_stop", "index": idx})
+}
+
+// sendWebSearchResultLocked 输出最早一个尚未输出结果的 web_search 调用的结果（web_search_tool_result 块）。
+func (e *SSEEmitter) sendWebSearchResultLocked(fr *vertex.FunctionResponse) error {
+	if len(e.pendingSearchIDs) == 0 {
+		return nil
+	}
+	toolID := e.pendingSearchIDs[0]
+	e.pendingSearchIDs = e.pendingSearchIDs[1:]
+	idx := e.nextIndex
+	e.nextIndex++
+	if err := e.writeSSE("content_block_start", map[string]any{
+		"type":          "content_block_start",
+		"index":         idx,
+		"content_block": map[string]any{"type": "web_search_tool_result", "tool_use_id": toolID, "content": webSearchResultContent(fr.Response)},
+	}); err != nil {
+		return err
+	}
+	return e.writeSSE("content_block_stop", map[string]any{"type": "content_block_stop", "index": idx})
+}
+
 func (e *SSEEmitter) closeThinkingBlockLocked() error {
 	if e.thinkingBlockIndex == nil {
 		return nil
 	}
 	idx := *e.thinkingBlockIndex
+	if rest := e.thinkingUTF8.Flush(); rest != "" {
+		e.pendingThinkingText.WriteString(rest)
+		_ = e.writeSSE("content_block_delta", map[string]any{
+			"type":  "content_block_delta",
+			"index": idx,
+			"delta": map[string]any{"type": "thinking_delta", "thinking": rest},
+		})
+	}
 	e.thinkingBlockIndex = nil
 	return e.writeSSE("content_block_stop", map[string]any{"type": "content_block_stop", "index": idx})
 }
@@ -300,6 +532,13 @@ func (e *SSEEmitter) closeTextBlockLocked() error {
 		return nil
 	}
 	idx := *e.textBlockIndex
+	if rest := e.textUTF8.Flush(); rest != "" {
+		_ = e.writeSSE("content_block_delta", map[string]any{
+			"type":  "content_block_delta",
+			"index": idx,
+			"delta": map[string]any{"type": "text_delta", "text": rest},
+		})
+	}
 	e.textBlockIndex = nil
 	return e.writeSSE("content_block_stop", map[string]any{"type": "content_block_stop", "index": idx})
 }
@@ -331,6 +570,7 @@ func (e *SSEEmitter) writeSSE(event string, data any) error {
 	if _, err := fmt.Fprintf(e.w, "event: %s\ndata: %s\n\n", event, b); err != nil {
 		return err
 	}
+	e.lastWrite = time.Now()
 	if f, ok := e.w.(http.Flusher); ok {
 		f.Flush()
 	}
@@ -0,0 +1,74 @@
+package claude
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"anti2api-golang/refactor/internal/config"
+	httppkg "anti2api-golang/refactor/internal/pkg/http"
+)
+
+// anthropicVersions 为支持的 anthropic-version 取值（按日期升序），最后一个为默认版本。
+var anthropicVersions = []string{"2023-01-01", "2023-06-01"}
+
+// cacheUsageVersion 起 usage 才带 cache_creation_input_tokens / cache_read_input_tokens，更早版本的严格 SDK 不认识这两个字段。
+const cacheUsageVersion = "2023-06-01"
+
+func defaultAnthropicVersion() string {
+	return anthropicVersions[len(anthropicVersions)-1]
+}
+
+// negotiateVersion 解析请求的 anthropic-version 头：未携带时使用默认版本，已知版本原样返回。
+// 未知版本在 ANTHROPIC_VERSION_STRICT=true 时返回错误；否则按不晚于它的最新已知版本处理（无法解析或早于所有已知版本时使用默认版本）。
+func negotiateVersion(h http.Header) (string, error) {
+	v := strings.TrimSpace(h.Get("anthropic-version"))
+	if v == "" {
+		return defaultAnthropicVersion(), nil
+	}
+	for _, known := range anthropicVersions {
+		if v == known {
+			return v, nil
+		}
+	}
+	if config.Get().AnthropicVersionStrict {
+		return "", fmt.Errorf("anthropic-version %q is not supported; supported versions: %s", v, strings.Join(anthropicVersions, ", "))
+	}
+	if _, err := time.Parse(time.DateOnly, v); err != nil {
+		return defaultAnthropicVersion(), nil
+	}
+	// 日期格式的版本号按字典序即时间顺序比较。
+	negotiated := ""
+	for _, known := range anthropicVersions {
+		if known <= v {
+			negotiated = known
+		}
+	}
+	if negotiated == "" {
+		return defaultAnthropicVersion(), nil
+	}
+	return negotiated, nil
+}
+
+// hasCacheUsage 判断该版本的 usage 是否包含缓存 token 字段。
+func hasCacheUsage(version string) bool {
+	return version >= cacheUsageVersion
+}
+
+// VersionsResponse 为 /v1/versions 的响应。
+type VersionsResponse struct {
+	Versions []string `json:"versions"`
+	Default  string   `json:"default"`
+	// Strict 为 true 时未知的 anthropic-version 会被拒绝（见 ANTHROPIC_VERSION_STRICT）。
+	Strict bool `json:"strict"`
+}
+
+// HandleVersions 列出支持的 anthropic-version 取值。
+func HandleVersions(w http.ResponseWriter, _ *http.Request) {
+	httppkg.WriteJSON(w, http.StatusOK, VersionsResponse{
+		Versions: anthropicVersions,
+		Default:  defaultAnthropicVersion(),
+		Strict:   config.Get().AnthropicVersionStrict,
+	})
+}
@@ -0,0 +1,52 @@
+package claude
+
+import (
+	"net/http"
+	"testing"
+
+	"anti2api-golang/refactor/internal/config"
+)
+
+func TestNegotiateVersion(t *testing.T) {
+	c := config.Get()
+	old := c.AnthropicVersionStrict
+	t.Cleanup(func() { c.AnthropicVersionStrict = old })
+
+	c.AnthropicVersionStrict = false
+	for header, want := range map[string]string{
+		"":           "2023-06-01",
+		"2023-01-01": "2023-01-01",
+		"2023-03-15": "2023-01-01",
+		"2030-01-01": "2023-06-01",
+		"2020-01-01": "2023-06-01",
+		"latest":     "2023-06-01",
+	} {
+		h := http.Header{}
+		if header != "" {
+			h.Set("anthropic-version", header)
+		}
+		if got, err := negotiateVersion(h); err != nil || got != want {
+			t.Errorf("%q: got %q, %v; want %q", header, got, err, want)
+		}
+	}
+
+	c.AnthropicVersionStrict = true
+	if _, err := negotiateVersion(http.Header{"Anthropic-Version": {"2030-01-01"}}); err == nil {
+		t.Fatal("strict mode should reject unknown versions")
+	}
+	if got, err := negotiateVersion(http.Header{"Anthropic-Version": {"2023-06-01"}}); err != nil || got != "2023-06-01" {
+		t.Fatalf("strict mode should accept known versions, got %q, %v", got, err)
+	}
+}
+
+func TestApplyClaudeCodeUsage_OmitsCacheFieldsForOldVersions(t *testing.T) {
+	out := &MessagesResponse{}
+	applyClaudeCodeUsage(out, nil, "2023-01-01")
+	if out.Usage.CacheReadInputTokens != nil || out.Usage.CacheCreationInputTokens != nil {
+		t.Fatalf("2023-01-01 must not include cache usage fields: %+v", out.Usage)
+	}
+	applyClaudeCodeUsage(out, nil, "2023-06-01")
+	if out.Usage.CacheReadInputTokens == nil || out.Usage.CacheCreationInputTokens == nil {
+		t.Fatalf("2023-06-01 should include cache usage fields: %+v", out.Usage)
+	}
+}
@@ -0,0 +1,141 @@
+package claude
+
+import (
+	"strings"
+
+	gwcommon "anti2api-golang/refactor/internal/gateway/common"
+	"anti2api-golang/refactor/internal/logger"
+	"anti2api-golang/refactor/internal/pkg/id"
+	"anti2api-golang/refactor/internal/vertex"
+)
+
+// webSearchTool 返回请求中需要模拟的 web_search 服务端工具：配置了 CLAUDE_WEB_SEARCH 时，该工具不再被忽略，
+// 而是以同名函数声明发送给上游，模型的调用由代理执行搜索（见 gwcommon.WebSearchFunction），
+// 调用与结果以 server_tool_use / web_search_tool_result 块返回给客户端。
+func webSearchTool(tools []Tool) (Tool, bool) {
+	for _, t := range tools {
+		if isEmulatedServerTool(t) {
+			return t, true
+		}
+	}
+	return Tool{}, false
+}
+
+// isEmulatedServerTool 判断服务端工具是否由代理模拟（目前只有配置了 CLAUDE_WEB_SEARCH 时的 web_search）。
+func isEmulatedServerTool(t Tool) bool {
+	return strings.HasPrefix(t.Type, "web_search_") && gwcommon.WebSearchEnabled()
+}
+
+// applyWebSearch 为 vreq 注入 web_search 函数声明及其代执行实现；客户端已有同名自定义工具时不做处理。
+func applyWebSearch(vreq *vertex.Request, t Tool) {
+	for _, vt := range vreq.Request.Tools {
+		for _, d := range vt.FunctionDeclarations {
+			if d.Name == gwcommon.WebSearchName {
+				logger.Warn("Claude 请求已包含名为 %s 的自定义工具，不模拟 web_search 服务端工具", gwcommon.WebSearchName)
+				return
+			}
+		}
+	}
+	vreq.Request.Tools = append(vreq.Request.Tools, vertex.Tool{FunctionDeclarations: []vertex.FunctionDeclaration{gwcommon.WebSearchDeclaration()}})
+	if vreq.Request.ToolConfig == nil {
+		vreq.Request.ToolConfig = &vertex.ToolConfig{FunctionCallingConfig: &vertex.FunctionCallingConfig{Mode: "AUTO"}}
+	}
+	if vreq.ProxyFunctions == nil {
+		vreq.ProxyFunctions = make(map[string]vertex.ProxyFunction)
+	}
+	vreq.ProxyFunctions[gwcommon.WebSearchName] = gwcommon.WebSearchFunction(gwcommon.WebSearchOptions{
+		MaxUses:        t.MaxUses,
+		AllowedDomains: t.AllowedDomains,
+		BlockedDomains: t.BlockedDomains,
+	})
+}
+
+// isWebSearchBlock 判断历史中的内容块是否为模拟 web_search 时输出的块（模拟开启时总是转为文本，不受 reject 模式影响）。
+func isWebSearchBlock(typ string, m map[string]any) bool {
+	if !gwcommon.WebSearchEnabled() {
+		return false
+	}
+	return typ == "web_search_tool_result" || (typ == "server_tool_use" && m["name"] == gwcommon.WebSearchName)
+}
+
+func serverToolUseID() string {
+	return "srvtoolu_" + strings.TrimPrefix(id.ToolCallID(), "call_")
+}
+
+// webSearchResultContent 将 web_search 的执行结果转为 web_search_tool_result 块的 content：
+// 成功时为 web_search_result 列表，失败时为 web_search_tool_result_error。
+func webSearchResultContent(resp map[string]any) any {
+	if code, ok := resp["error_code"].(string); ok {
+		return map[string]any{"type": "web_search_tool_result_error", "error_code": code}
+	}
+	items, _ := resp["results"].([]any)
+	out := make([]map[string]any, 0, len(items))
+	for _, it := range items {
+		m, ok := it.(map[string]any)
+		if !ok {
+			continue
+		}
+		result := map[string]any{"type": "web_search_result", "title": m["title"], "url": m["url"], "encrypted_content": "", "page_age": nil}
+		if age, _ := m["page_age"].(string); age != "" {
+			result["page_age"] = age
+		}
+		out = append(out, result)
+	}
+	return out
+}
+
+// splitWebSearchParts 将代为执行 web_search 的分片（最后一个执行结果及其之前的分片）与其余分片分开，
+// 前者按顺序转为内容块；其中的客户端工具调用留在 rest 中按普通 tool_use 处理。searches 为搜索次数。
+func splitWebSearchParts(parts []vertex.Part, isClaudeModel bool) (blocks []ContentBlock, rest []vertex.Part, searches int) {
+	cut := 0
+	for i, p := range parts {
+		if p.FunctionResponse != nil && p.FunctionResponse.Name == gwcommon.WebSearchName {
+			cut = i + 1
+		}
+	}
+	if cut == 0 {
+		return nil, parts, 0
+	}
+	var pending []string
+	for _, p := range parts[:cut] {
+		last := len(blocks) - 1
+		switch {
+		case p.Thought:
+			if last < 0 || blocks[last].Type != "thinking" || blocks[last].Signature != "" {
+				blocks = append(blocks, ContentBlock{Type: "thinking"})
+				last = len(blocks) - 1
+			}
+			blocks[last].Thinking += p.Text
+			if isClaudeModel && p.ThoughtSignature != "" {
+				blocks[last].Signature = p.ThoughtSignature
+			}
+		case p.Text != "":
+			if last < 0 || blocks[last].Type != "text" {
+				blocks = append(blocks, ContentBlock{Type: "text"})
+				last = len(blocks) - 1
+			}
+			blocks[last].Text += p.Text
+		case p.FunctionCall != nil && p.FunctionCall.Name == gwcommon.WebSearchName:
+			toolID := serverToolUseID()
+			pending = append(pending, toolID)
+			blocks = append(blocks, ContentBlock{Type: "server_tool_use", ID: toolID, Name: gwcommon.WebSearchName, Input: p.FunctionCall.Args})
+			searches++
+		case p.FunctionCall != nil:
+			rest = append(rest, p)
+		case p.FunctionResponse != nil && len(pending) > 0:
+			blocks = append(blocks, ContentBlock{Type: "web_search_tool_result", ToolUseID: pending[0], Content: webSearchResultContent(p.FunctionResponse.Response)})
+			pending = pending[1:]
+		}
+	}
+	return blocks, append(rest, parts[cut:]...), searches
+}
+
+// hasClientToolCalls 报告流中是否有需要客户端执行的工具调用（代为执行的函数调用除外）。
+func hasClientToolCalls(calls []vertex.ToolCallInfo, vreq *vertex.Request) bool {
+	for _, c := range calls {
+		if _, ok := vreq.ProxyFunctions[c.Name]; !ok {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,50 @@
+package common
+
+import (
+	"strings"
+
+	"anti2api-golang/refactor/internal/vertex"
+)
+
+// BlockedPromptFeedback 返回上游拦截提示词时的 promptFeedback；未被拦截或已有候选输出时返回 nil。
+func BlockedPromptFeedback(resp *vertex.Response) *vertex.PromptFeedback {
+	if resp == nil || len(resp.Response.Candidates) > 0 {
+		return nil
+	}
+	fb := resp.Response.PromptFeedback
+	if fb == nil || fb.BlockReason == "" {
+		return nil
+	}
+	return fb
+}
+
+// ContentFilterMessage 生成面向客户端的拦截说明，包含 blockReason 与被拦截的安全类别。
+func ContentFilterMessage(fb *vertex.PromptFeedback) string {
+	var b strings.Builder
+	b.WriteString("请求被上游内容安全策略拦截（blockReason: ")
+	if fb == nil || fb.BlockReason == "" {
+		b.WriteString("UNKNOWN")
+	} else {
+		b.WriteString(fb.BlockReason)
+	}
+
+	if fb != nil {
+		var categories []string
+		for _, r := range fb.SafetyRatings {
+			if r.Blocked && r.Category != "" {
+				categories = append(categories, r.Category)
+			}
+		}
+		if len(categories) > 0 {
+			b.WriteString("；类别: ")
+			b.WriteString(strings.Join(categories, ", "))
+		}
+	}
+	b.WriteString("）")
+
+	if fb != nil && fb.BlockReasonMessage != "" {
+		b.WriteString("：")
+		b.WriteString(fb.BlockReasonMessage)
+	}
+	return b.String()
+}
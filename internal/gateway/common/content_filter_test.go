@@ -0,0 +1,39 @@
+package common
+
+import (
+	"strings"
+	"testing"
+
+	"anti2api-golang/refactor/internal/vertex"
+)
+
+func TestBlockedPromptFeedback(t *testing.T) {
+	resp := &vertex.Response{}
+	if BlockedPromptFeedback(resp) != nil {
+		t.Fatalf("expected nil without promptFeedback")
+	}
+
+	resp.Response.PromptFeedback = &vertex.PromptFeedback{
+		BlockReason: "SAFETY",
+		SafetyRatings: []vertex.SafetyRating{
+			{Category: "HARM_CATEGORY_HARASSMENT", Probability: "HIGH", Blocked: true},
+			{Category: "HARM_CATEGORY_HATE_SPEECH", Probability: "LOW"},
+		},
+	}
+	fb := BlockedPromptFeedback(resp)
+	if fb == nil {
+		t.Fatalf("expected blocked feedback")
+	}
+	msg := ContentFilterMessage(fb)
+	if !strings.Contains(msg, "SAFETY") || !strings.Contains(msg, "HARM_CATEGORY_HARASSMENT") {
+		t.Fatalf("message should include block reason and category, got %q", msg)
+	}
+	if strings.Contains(msg, "HARM_CATEGORY_HATE_SPEECH") {
+		t.Fatalf("message should only include blocked categories, got %q", msg)
+	}
+
+	resp.Response.Candidates = []vertex.Candidate{{}}
+	if BlockedPromptFeedback(resp) != nil {
+		t.Fatalf("expected nil when candidates are present")
+	}
+}
@@ -0,0 +1,73 @@
+package common
+
+import (
+	"net/http"
+	"strings"
+	"time"
+
+	"anti2api-golang/refactor/internal/pkg/modelutil"
+	"anti2api-golang/refactor/internal/vertex"
+)
+
+// DebugInfoHeader 请求头为 1 / true 时，在流式响应的最后一个 chunk（OpenAI 结束 chunk、Claude message_delta）中
+// 附带扩展字段 DebugInfoField，便于无法查看服务端日志的客户端排查慢请求。
+const DebugInfoHeader = "X-Ant2api-Debug"
+
+// DebugInfoField 为调试信息在响应 JSON 中的字段名（厂商扩展字段，官方 SDK 会忽略）。
+const DebugInfoField = "x_ant2api"
+
+// DebugInfo 为一次流式请求的上游调试信息。
+type DebugInfo struct {
+	// BackendModel 为实际发往上游的后端模型 id（虚拟模型展开、模型降级之后）。
+	BackendModel string `json:"backend_model"`
+	// Endpoint 为所用上游端点的 key（daily / autopush / production），备用后端为其 Host。
+	Endpoint string `json:"endpoint,omitempty"`
+	// UpstreamMs 为从发起上游请求到流结束的耗时（毫秒），FirstByteMs 为到收到上游响应头的耗时。
+	UpstreamMs  int64 `json:"upstream_ms"`
+	FirstByteMs int64 `json:"first_byte_ms,omitempty"`
+	// Account 为处理请求的账号邮箱。
+	Account string `json:"account,omitempty"`
+}
+
+// WantDebugInfo 判断客户端是否通过 DebugInfoHeader 请求了调试信息。
+func WantDebugInfo(h http.Header) bool {
+	switch strings.ToLower(strings.TrimSpace(h.Get(DebugInfoHeader))) {
+	case "1", "true", "yes", "on":
+		return true
+	}
+	return false
+}
+
+// UpstreamTimer 记录一次流式请求打开上游流的时间点与所用账号，供生成 DebugInfo。
+type UpstreamTimer struct {
+	start     time.Time
+	firstByte time.Duration
+	account   string
+}
+
+// Start 在发起上游请求（含换号重试与模型降级）前调用，重新开始计时。
+func (t *UpstreamTimer) Start() {
+	t.start = time.Now()
+	t.firstByte = 0
+	t.account = ""
+}
+
+// Opened 在成功拿到上游响应头后调用，记录首字节耗时与所用账号。
+func (t *UpstreamTimer) Opened(account string) {
+	t.firstByte = time.Since(t.start)
+	t.account = account
+}
+
+// DebugInfo 返回结束时的调试信息；resp 为最终使用的上游流式响应。
+func (t *UpstreamTimer) DebugInfo(servedModel string, resp *http.Response) *DebugInfo {
+	info := &DebugInfo{
+		BackendModel: modelutil.BackendModelID(servedModel),
+		Endpoint:     vertex.EndpointKeyOf(resp),
+		FirstByteMs:  t.firstByte.Milliseconds(),
+		Account:      t.account,
+	}
+	if !t.start.IsZero() {
+		info.UpstreamMs = time.Since(t.start).Milliseconds()
+	}
+	return info
+}
@@ -0,0 +1,87 @@
+package common
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+
+	"anti2api-golang/refactor/internal/config"
+	"anti2api-golang/refactor/internal/logger"
+	"anti2api-golang/refactor/internal/pkg/modelutil"
+	"anti2api-golang/refactor/internal/secondary"
+	"anti2api-golang/refactor/internal/vertex"
+)
+
+// ServedModelHeader 标识实际处理请求的模型（发生模型降级时与请求中的 model 不同）。
+const ServedModelHeader = "X-Served-Model"
+
+// BackendModelHeader 标识实际发往上游的后端模型 id（虚拟模型展开之后），便于成本统计。
+const BackendModelHeader = "X-Backend-Model"
+
+// SetServedModelHeaders 写入 X-Served-Model 与 X-Backend-Model 响应头。
+func SetServedModelHeaders(w http.ResponseWriter, served string) {
+	w.Header().Set(ServedModelHeader, served)
+	w.Header().Set(BackendModelHeader, modelutil.BackendModelID(served))
+}
+
+// ResponseModel 返回响应体 model 字段应回显的模型名：默认为客户端请求的 requested（可能是虚拟模型；发生降级时
+// 实际模型见 X-Served-Model），ECHO_BACKEND_MODEL=true 时改为实际模型 served 的后端模型 id。
+func ResponseModel(requested, served string) string {
+	if config.Get().EchoBackendModel {
+		return modelutil.BackendModelID(served)
+	}
+	return requested
+}
+
+// ModelFallbacks 返回 MODEL_FALLBACKS 中为 model 配置的降级链（不含 model 本身）。
+func ModelFallbacks(model string) []string {
+	return config.Get().ModelFallbacks[strings.ToLower(modelutil.CanonicalModelID(model))]
+}
+
+// ShouldFallbackModel 判断错误是否值得切换到降级模型：模型不存在、配额耗尽或上游容量不足。
+// 403 等策略拒绝（含请求钩子拒绝）不降级，换模型也不应绕过。
+func ShouldFallbackModel(err error) bool {
+	var apiErr *vertex.APIError
+	if !errors.As(err, &apiErr) {
+		return false
+	}
+	switch apiErr.Status {
+	case http.StatusNotFound, http.StatusTooManyRequests:
+		return true
+	case http.StatusServiceUnavailable:
+		return strings.Contains(strings.ToLower(apiErr.Message), "capacity")
+	}
+	return false
+}
+
+// TryModelFallbacks 在主模型请求（v, err）失败时，依次用降级链中的模型调用 try。
+// 返回最终结果以及实际使用的模型名。
+func TryModelFallbacks[T any](model string, v T, err error, try func(fallback string) (T, error)) (T, string, error) {
+	served := model
+	for _, fb := range ModelFallbacks(model) {
+		if !ShouldFallbackModel(err) {
+			break
+		}
+		logger.Warn("模型 %s 请求失败（%v），降级到 %s", served, err, fb)
+		served = fb
+		v, err = try(fb)
+	}
+	return v, served, err
+}
+
+// TrySecondaryBackend 在 Cloud Code 不可用（见 secondary.ShouldUse）且 model 匹配 SECONDARY_BACKEND_MODELS 时，
+// 用 try 把请求转发到备用后端。备用后端也失败时保留原错误，返回值中的模型名为实际使用的模型。
+func TrySecondaryBackend[T any](ctx context.Context, model, served string, v T, err error, try func(target string) (T, error)) (T, string, error) {
+	target, ok := secondary.Match(model)
+	if !ok || !secondary.ShouldUse(ctx, err) {
+		return v, served, err
+	}
+	logger.Warn("Cloud Code 不可用（%v），降级到备用后端模型 %s", err, target)
+	sv, serr := try(target)
+	if serr != nil {
+		logger.Warn("备用后端请求失败: %v", serr)
+		return v, served, err
+	}
+	return sv, target, nil
+}
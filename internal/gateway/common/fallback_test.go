@@ -0,0 +1,97 @@
+package common
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"anti2api-golang/refactor/internal/config"
+	"anti2api-golang/refactor/internal/vertex"
+)
+
+func TestTryModelFallbacks(t *testing.T) {
+	c := config.Get()
+	old := c.ModelFallbacks
+	c.ModelFallbacks = map[string][]string{"primary": {"second", "third"}}
+	t.Cleanup(func() { c.ModelFallbacks = old })
+
+	var tried []string
+	v, served, err := TryModelFallbacks("Primary", "", error(&vertex.APIError{Status: http.StatusNotFound}), func(fb string) (string, error) {
+		tried = append(tried, fb)
+		if fb == "second" {
+			return "", &vertex.APIError{Status: http.StatusTooManyRequests}
+		}
+		return "ok:" + fb, nil
+	})
+	if err != nil || v != "ok:third" || served != "third" {
+		t.Fatalf("unexpected result: v=%q served=%q err=%v", v, served, err)
+	}
+	if len(tried) != 2 {
+		t.Fatalf("expected 2 fallback attempts, got %v", tried)
+	}
+}
+
+func TestTryModelFallbacks_NonFallbackError(t *testing.T) {
+	c := config.Get()
+	old := c.ModelFallbacks
+	c.ModelFallbacks = map[string][]string{"primary": {"second"}}
+	t.Cleanup(func() { c.ModelFallbacks = old })
+
+	called := false
+	_, served, err := TryModelFallbacks("primary", 0, errors.New("boom"), func(string) (int, error) {
+		called = true
+		return 1, nil
+	})
+	if called || served != "primary" || err == nil {
+		t.Fatalf("expected no fallback for non-API error (called=%v served=%q err=%v)", called, served, err)
+	}
+}
+
+func TestResponseModel_VirtualModel(t *testing.T) {
+	c := config.Get()
+	oldVirtual, oldEcho := c.VirtualModels, c.EchoBackendModel
+	c.VirtualModels = []config.VirtualModel{{Name: "creative", Backend: "gemini-3-pro-high"}}
+	t.Cleanup(func() { c.VirtualModels, c.EchoBackendModel = oldVirtual, oldEcho })
+
+	rec := httptest.NewRecorder()
+	SetServedModelHeaders(rec, "creative")
+	if got := rec.Header().Get(ServedModelHeader); got != "creative" {
+		t.Fatalf("%s = %q", ServedModelHeader, got)
+	}
+	if got := rec.Header().Get(BackendModelHeader); got != "gemini-3-pro-high" {
+		t.Fatalf("%s = %q", BackendModelHeader, got)
+	}
+
+	c.EchoBackendModel = false
+	if got := ResponseModel("creative", "creative"); got != "creative" {
+		t.Fatalf("ResponseModel = %q, want the requested name by default", got)
+	}
+	// 降级后响应体仍回显请求的模型，实际模型只见响应头。
+	if got := ResponseModel("primary", "creative"); got != "primary" {
+		t.Fatalf("ResponseModel = %q, want the requested name after fallback", got)
+	}
+	c.EchoBackendModel = true
+	if got := ResponseModel("creative", "creative"); got != "gemini-3-pro-high" {
+		t.Fatalf("ResponseModel = %q, want backend id", got)
+	}
+}
+
+func TestShouldFallbackModel(t *testing.T) {
+	cases := []struct {
+		err  error
+		want bool
+	}{
+		{&vertex.APIError{Status: http.StatusNotFound}, true},
+		{&vertex.APIError{Status: http.StatusTooManyRequests}, true},
+		{&vertex.APIError{Status: http.StatusServiceUnavailable, Message: "No capacity available for model"}, true},
+		{&vertex.APIError{Status: http.StatusServiceUnavailable, Message: "请求钩子不可用: timeout"}, false},
+		{&vertex.APIError{Status: http.StatusForbidden, Message: "denied by policy"}, false},
+		{errors.New("boom"), false},
+	}
+	for _, tc := range cases {
+		if got := ShouldFallbackModel(tc.err); got != tc.want {
+			t.Errorf("ShouldFallbackModel(%v) = %v, want %v", tc.err, got, tc.want)
+		}
+	}
+}
@@ -0,0 +1,76 @@
+package common
+
+import (
+	"encoding/base64"
+	"strings"
+
+	"anti2api-golang/refactor/internal/config"
+	"anti2api-golang/refactor/internal/logger"
+	"anti2api-golang/refactor/internal/pkg/imagescale"
+	"anti2api-golang/refactor/internal/pkg/modelutil"
+	"anti2api-golang/refactor/internal/vertex"
+)
+
+// 未配置 IMAGE_MAX_DIMENSION 时按 mediaResolution 选择的最长边上限；未设置 mediaResolution 时
+// Claude 模型使用 Anthropic 建议的 1568，其他模型使用 3072。
+var mediaResolutionMaxDimension = map[string]int{
+	"MEDIA_RESOLUTION_LOW":    768,
+	"MEDIA_RESOLUTION_MEDIUM": 1536,
+	"MEDIA_RESOLUTION_HIGH":   3072,
+}
+
+const (
+	claudeImageMaxDimension  = 1568
+	defaultImageMaxDimension = 3072
+)
+
+// DownscaleImages 在 IMAGE_DOWNSCALE=true 时缩小并重新压缩 req 中用户轮次的 inlineData 图片（须在 generationConfig 确定后调用）。
+// model 轮次的图片由模型生成且可能绑定了思考签名，保持原样；无法解码的图片保持原样并记录告警。
+func DownscaleImages(req *vertex.Request) {
+	cfg := config.Get()
+	if !cfg.ImageDownscale || req == nil {
+		return
+	}
+	opts := imagescale.Options{MaxDimension: imageMaxDimension(req), JPEGQuality: cfg.ImageJPEGQuality}
+	for i := range req.Request.Contents {
+		c := &req.Request.Contents[i]
+		if c.Role == "model" {
+			continue
+		}
+		for j := range c.Parts {
+			d := c.Parts[j].InlineData
+			if d == nil || !strings.HasPrefix(strings.ToLower(d.MimeType), "image/") {
+				continue
+			}
+			raw, err := base64.StdEncoding.DecodeString(d.Data)
+			if err != nil {
+				continue
+			}
+			out, mimeType, changed, err := imagescale.Process(raw, d.MimeType, opts)
+			if err != nil {
+				logger.Warn("图片缩放失败，按原图发送: %v", err)
+				continue
+			}
+			if !changed {
+				continue
+			}
+			c.Parts[j].InlineData = &vertex.InlineData{MimeType: mimeType, Data: base64.StdEncoding.EncodeToString(out)}
+			logger.Debug("图片已压缩: %s %d -> %s %d 字节", d.MimeType, len(raw), mimeType, len(out))
+		}
+	}
+}
+
+func imageMaxDimension(req *vertex.Request) int {
+	if v := config.Get().ImageMaxDimension; v > 0 {
+		return v
+	}
+	if gc := req.Request.GenerationConfig; gc != nil {
+		if v, ok := mediaResolutionMaxDimension[gc.MediaResolution]; ok {
+			return v
+		}
+	}
+	if modelutil.IsClaude(req.Model) {
+		return claudeImageMaxDimension
+	}
+	return defaultImageMaxDimension
+}
@@ -0,0 +1,53 @@
+package common
+
+import (
+	"bytes"
+	"encoding/base64"
+	"image"
+	"image/png"
+	"testing"
+
+	"anti2api-golang/refactor/internal/config"
+	"anti2api-golang/refactor/internal/vertex"
+)
+
+func TestDownscaleImages(t *testing.T) {
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, image.NewGray(image.Rect(0, 0, 1200, 600))); err != nil {
+		t.Fatal(err)
+	}
+	data := base64.StdEncoding.EncodeToString(buf.Bytes())
+	newReq := func() *vertex.Request {
+		return &vertex.Request{Model: "gemini-3-pro-preview", Request: vertex.InnerReq{
+			GenerationConfig: &vertex.GenerationConfig{MediaResolution: "MEDIA_RESOLUTION_LOW"},
+			Contents: []vertex.Content{
+				{Role: "user", Parts: []vertex.Part{{InlineData: &vertex.InlineData{MimeType: "image/png", Data: data}}}},
+				{Role: "model", Parts: []vertex.Part{{InlineData: &vertex.InlineData{MimeType: "image/png", Data: data}}}},
+			},
+		}}
+	}
+
+	c := config.Get()
+	oldEnabled, oldMax := c.ImageDownscale, c.ImageMaxDimension
+	t.Cleanup(func() { c.ImageDownscale, c.ImageMaxDimension = oldEnabled, oldMax })
+
+	c.ImageDownscale = false
+	req := newReq()
+	DownscaleImages(req)
+	if req.Request.Contents[0].Parts[0].InlineData.Data != data {
+		t.Fatal("images must not change when IMAGE_DOWNSCALE is off")
+	}
+
+	c.ImageDownscale, c.ImageMaxDimension = true, 0
+	req = newReq()
+	DownscaleImages(req)
+	got := req.Request.Contents[0].Parts[0].InlineData
+	raw, _ := base64.StdEncoding.DecodeString(got.Data)
+	cfg, _, err := image.DecodeConfig(bytes.NewReader(raw))
+	if err != nil || got.MimeType != "image/jpeg" || cfg.Width != 768 || cfg.Height != 384 {
+		t.Fatalf("expected 768x384 JPEG for low media resolution, got %s %dx%d (%v)", got.MimeType, cfg.Width, cfg.Height, err)
+	}
+	if req.Request.Contents[1].Parts[0].InlineData.Data != data {
+		t.Fatal("model turn images must be left untouched")
+	}
+}
@@ -0,0 +1,49 @@
+package common
+
+import (
+	"anti2api-golang/refactor/internal/vertex"
+)
+
+// FinishReasonMalformedFunctionCall 是上游在模型生成了无法解析的工具调用时返回的 finishReason。
+const FinishReasonMalformedFunctionCall = "MALFORMED_FUNCTION_CALL"
+
+// MalformedFunctionCallMessage 是重试后仍失败时返回给客户端的说明。
+const MalformedFunctionCallMessage = "上游返回 MALFORMED_FUNCTION_CALL：模型生成的工具调用无法解析，通常是工具参数 schema 过于复杂或包含不受支持的结构，请简化工具定义后重试。"
+
+// IsMalformedFunctionCall 判断非流式响应是否因工具调用格式错误而结束且没有任何可用输出。
+func IsMalformedFunctionCall(resp *vertex.Response) bool {
+	if resp == nil || len(resp.Response.Candidates) == 0 {
+		return false
+	}
+	c := resp.Response.Candidates[0]
+	if c.FinishReason != FinishReasonMalformedFunctionCall {
+		return false
+	}
+	for _, p := range c.Content.Parts {
+		if p.FunctionCall != nil || (!p.Thought && p.Text != "") || p.InlineData != nil {
+			return false
+		}
+	}
+	return true
+}
+
+// ForceAnyToolMode 将请求的工具调用模式改为 ANY，用于 MALFORMED_FUNCTION_CALL 后的单次重试。
+// 请求未声明工具或已经是 ANY 时返回 false（此时重试没有意义）。
+func ForceAnyToolMode(req *vertex.Request) bool {
+	if req == nil || len(req.Request.Tools) == 0 {
+		return false
+	}
+	tc := req.Request.ToolConfig
+	if tc == nil {
+		tc = &vertex.ToolConfig{}
+		req.Request.ToolConfig = tc
+	}
+	if tc.FunctionCallingConfig == nil {
+		tc.FunctionCallingConfig = &vertex.FunctionCallingConfig{}
+	}
+	if tc.FunctionCallingConfig.Mode == "ANY" {
+		return false
+	}
+	tc.FunctionCallingConfig.Mode = "ANY"
+	return true
+}
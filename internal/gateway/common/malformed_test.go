@@ -0,0 +1,55 @@
+package common
+
+import (
+	"testing"
+
+	"anti2api-golang/refactor/internal/vertex"
+)
+
+func malformedResponse(parts ...vertex.Part) *vertex.Response {
+	resp := &vertex.Response{}
+	resp.Response.Candidates = []vertex.Candidate{{
+		Content:      vertex.Content{Role: "model", Parts: parts},
+		FinishReason: FinishReasonMalformedFunctionCall,
+	}}
+	return resp
+}
+
+func TestIsMalformedFunctionCall(t *testing.T) {
+	if !IsMalformedFunctionCall(malformedResponse()) {
+		t.Fatalf("expected empty MALFORMED_FUNCTION_CALL response to be detected")
+	}
+	if !IsMalformedFunctionCall(malformedResponse(vertex.Part{Text: "thinking", Thought: true})) {
+		t.Fatalf("expected thought-only response to be detected")
+	}
+	if IsMalformedFunctionCall(malformedResponse(vertex.Part{Text: "partial answer"})) {
+		t.Fatalf("expected response with visible text not to be treated as malformed")
+	}
+
+	ok := malformedResponse()
+	ok.Response.Candidates[0].FinishReason = "STOP"
+	if IsMalformedFunctionCall(ok) {
+		t.Fatalf("expected STOP response not to be detected")
+	}
+	if IsMalformedFunctionCall(nil) {
+		t.Fatalf("expected nil response not to be detected")
+	}
+}
+
+func TestForceAnyToolMode(t *testing.T) {
+	req := &vertex.Request{}
+	if ForceAnyToolMode(req) {
+		t.Fatalf("expected no retry when request has no tools")
+	}
+
+	req.Request.Tools = []vertex.Tool{{FunctionDeclarations: []vertex.FunctionDeclaration{{Name: "f"}}}}
+	if !ForceAnyToolMode(req) {
+		t.Fatalf("expected mode to be forced")
+	}
+	if got := req.Request.ToolConfig.FunctionCallingConfig.Mode; got != "ANY" {
+		t.Fatalf("mode mismatch: got %q want %q", got, "ANY")
+	}
+	if ForceAnyToolMode(req) {
+		t.Fatalf("expected second call to report no change")
+	}
+}
@@ -0,0 +1,32 @@
+package common
+
+import (
+	"fmt"
+	"net/http"
+
+	"anti2api-golang/refactor/internal/pkg/modelutil"
+)
+
+// MediaResolutionHeader 为请求级 mediaResolution 覆盖头（low / medium / high 或 MEDIA_RESOLUTION_* 枚举名），
+// 供 OpenAI / Claude 接口的客户端在图片较多时按请求权衡 token 消耗与识别精度；请求体中的 media_resolution 优先。
+const MediaResolutionHeader = "X-Media-Resolution"
+
+// ResolveMediaResolution 合并请求体字段 body 与 MediaResolutionHeader（body 非 nil 时优先），返回规范化后的
+// low / medium / high（见 modelutil.ValidateMediaResolution）；都未设置时返回 nil，使用全局 GEMINI3_MEDIA_RESOLUTION。
+// 值非法时返回错误。
+func ResolveMediaResolution(h http.Header, body *string) (*string, error) {
+	name, value := "media_resolution", ""
+	switch {
+	case body != nil:
+		value = *body
+	case h.Get(MediaResolutionHeader) != "":
+		name, value = MediaResolutionHeader, h.Get(MediaResolutionHeader)
+	default:
+		return nil, nil
+	}
+	v, ok := modelutil.ValidateMediaResolution(value)
+	if !ok {
+		return nil, fmt.Errorf("%s 仅支持 low / medium / high，当前为 %q", name, value)
+	}
+	return &v, nil
+}
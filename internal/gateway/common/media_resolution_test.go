@@ -0,0 +1,34 @@
+package common
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestResolveMediaResolution(t *testing.T) {
+	str := func(s string) *string { return &s }
+
+	if got, err := ResolveMediaResolution(http.Header{}, nil); err != nil || got != nil {
+		t.Fatalf("unset: got %v, %v", got, err)
+	}
+
+	h := http.Header{}
+	h.Set(MediaResolutionHeader, "MEDIA_RESOLUTION_LOW")
+	if got, err := ResolveMediaResolution(h, nil); err != nil || got == nil || *got != "low" {
+		t.Fatalf("header: got %v, %v", got, err)
+	}
+	if got, err := ResolveMediaResolution(h, str("High")); err != nil || got == nil || *got != "high" {
+		t.Fatalf("body should take precedence: got %v, %v", got, err)
+	}
+	if got, err := ResolveMediaResolution(h, str("")); err != nil || got == nil || *got != "" {
+		t.Fatalf("explicit empty body should disable the field: got %v, %v", got, err)
+	}
+
+	if _, err := ResolveMediaResolution(http.Header{}, str("ultra")); err == nil {
+		t.Fatal("expected error for invalid body value")
+	}
+	h.Set(MediaResolutionHeader, "ultra")
+	if _, err := ResolveMediaResolution(h, nil); err == nil {
+		t.Fatal("expected error for invalid header value")
+	}
+}
@@ -0,0 +1,56 @@
+package common
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"anti2api-golang/refactor/internal/credential"
+	"anti2api-golang/refactor/internal/pkg/id"
+	"anti2api-golang/refactor/internal/pkg/modelutil"
+	"anti2api-golang/refactor/internal/vertex"
+)
+
+// ModelsCreatedAt 作为模型详情中的创建时间（上游不提供该字段，使用进程启动时间保持稳定）。
+var ModelsCreatedAt = time.Now().UTC().Truncate(time.Second)
+
+// FetchAvailableModels 轮询可用账号获取上游模型列表。
+func FetchAvailableModels(ctx context.Context) (*vertex.AvailableModelsResponse, error) {
+	store := credential.GetStore()
+	vm, _, err := DoWithRoundRobin(ctx, store, store.EnabledCount(), func(acc *credential.Account) (*vertex.AvailableModelsResponse, error) {
+		projectID := acc.ProjectID
+		if projectID == "" {
+			projectID = id.ProjectID()
+		}
+		return vertex.FetchAvailableModels(ctx, projectID, acc.AccessToken)
+	})
+	if err == nil && vm == nil {
+		err = errors.New("上游未返回模型列表")
+	}
+	return vm, err
+}
+
+// FetchModelsErrorStatus 返回获取模型列表失败时应答的 HTTP 状态码（非上游错误按 503 处理）。
+func FetchModelsErrorStatus(err error) int {
+	var apiErr *vertex.APIError
+	if errors.As(err, &apiErr) {
+		return apiErr.Status
+	}
+	return http.StatusServiceUnavailable
+}
+
+// FindModelID 在上游模型列表（含虚拟模型）中查找 model，忽略大小写，返回列表中的规范 ID。
+func FindModelID(vm *vertex.AvailableModelsResponse, model string) (string, bool) {
+	model = strings.TrimSpace(model)
+	if vm == nil || model == "" {
+		return "", false
+	}
+	for _, mid := range modelutil.BuildSortedModelIDs(vm.Models) {
+		if strings.EqualFold(mid, model) {
+			return mid, true
+		}
+	}
+	return "", false
+}
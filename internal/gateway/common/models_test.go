@@ -0,0 +1,34 @@
+package common
+
+import (
+	"errors"
+	"net/http"
+	"testing"
+
+	"anti2api-golang/refactor/internal/vertex"
+)
+
+func TestFindModelID(t *testing.T) {
+	vm := &vertex.AvailableModelsResponse{Models: map[string]any{
+		"gemini-2.5-pro":    map[string]any{},
+		"claude-sonnet-4-5": map[string]any{},
+	}}
+	if got, ok := FindModelID(vm, " Claude-Sonnet-4-5 "); !ok || got != "claude-sonnet-4-5" {
+		t.Fatalf("FindModelID = %q, %v", got, ok)
+	}
+	if _, ok := FindModelID(vm, "gpt-4o"); ok {
+		t.Fatalf("expected unknown model not to be found")
+	}
+	if _, ok := FindModelID(nil, "gemini-2.5-pro"); ok {
+		t.Fatalf("expected nil model list not to match")
+	}
+}
+
+func TestFetchModelsErrorStatus(t *testing.T) {
+	if got := FetchModelsErrorStatus(&vertex.APIError{Status: http.StatusTooManyRequests}); got != http.StatusTooManyRequests {
+		t.Fatalf("got %d", got)
+	}
+	if got := FetchModelsErrorStatus(errors.New("no account")); got != http.StatusServiceUnavailable {
+		t.Fatalf("got %d", got)
+	}
+}
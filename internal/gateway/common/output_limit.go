@@ -0,0 +1,84 @@
+package common
+
+import (
+	"errors"
+
+	"anti2api-golang/refactor/internal/config"
+	"anti2api-golang/refactor/internal/logger"
+	jsonpkg "anti2api-golang/refactor/internal/pkg/json"
+	"anti2api-golang/refactor/internal/vertex"
+)
+
+// ErrOutputLimit 由流式 receiver 返回，表示输出超过 MAX_STREAM_OUTPUT_BYTES / MAX_STREAM_OUTPUT_TOKENS，
+// 流已被截断；调用方应以 length / max_tokens 正常结束响应，而不是报告错误。
+var ErrOutputLimit = errors.New("流式输出超过 MAX_STREAM_OUTPUT_BYTES / MAX_STREAM_OUTPUT_TOKENS 限制，已截断")
+
+// OutputLimit 统计流式请求的输出字节数与 token 数（正文、思考、工具调用参数与图片数据都计入）。
+// token 数取本地估算值与上游 usageMetadata（candidates + thoughts）中的较大者。
+// 未配置任何限制时 NewOutputLimit 返回 nil，所有方法对 nil 安全。
+type OutputLimit struct {
+	maxBytes  int
+	maxTokens int
+	bytes     int
+	estimate  int
+	reported  int
+	exceeded  bool
+}
+
+func NewOutputLimit() *OutputLimit {
+	cfg := config.Get()
+	if cfg.MaxStreamOutputBytes <= 0 && cfg.MaxStreamOutputTokens <= 0 {
+		return nil
+	}
+	return &OutputLimit{maxBytes: max(cfg.MaxStreamOutputBytes, 0), maxTokens: max(cfg.MaxStreamOutputTokens, 0)}
+}
+
+// Observe 计入一个分片的输出（bytes 为字节数，tokens 为估算的 token 数）。超过限制时返回 ErrOutputLimit，
+// 该分片不应再转发给客户端。
+func (l *OutputLimit) Observe(bytes, tokens int, usage *vertex.UsageMetadata) error {
+	if l == nil {
+		return nil
+	}
+	if l.exceeded {
+		return ErrOutputLimit
+	}
+	l.bytes += bytes
+	l.estimate += tokens
+	if usage != nil {
+		l.reported = max(l.reported, usage.CandidatesTokenCount+usage.ThoughtsTokenCount)
+	}
+	if (l.maxBytes > 0 && l.bytes > l.maxBytes) || (l.maxTokens > 0 && max(l.estimate, l.reported) > l.maxTokens) {
+		l.exceeded = true
+		logger.Warn("流式输出超过限制（%d 字节，约 %d token），已截断", l.bytes, max(l.estimate, l.reported))
+		return ErrOutputLimit
+	}
+	return nil
+}
+
+// ObserveStreamData 对 vertex 流式分片调用 Observe。
+func (l *OutputLimit) ObserveStreamData(data *vertex.StreamData) error {
+	if l == nil || data == nil {
+		return nil
+	}
+	bytes, tokens := 0, 0
+	if len(data.Response.Candidates) > 0 {
+		for _, p := range data.Response.Candidates[0].Content.Parts {
+			bytes += len(p.Text)
+			tokens += EstimateTokens(p.Text)
+			if p.FunctionCall != nil {
+				s, _ := jsonpkg.MarshalString(p.FunctionCall.Args)
+				bytes += len(p.FunctionCall.Name) + len(s)
+				tokens += EstimateTokens(p.FunctionCall.Name) + EstimateTokens(s)
+			}
+			if p.InlineData != nil {
+				bytes += len(p.InlineData.Data)
+			}
+		}
+	}
+	return l.Observe(bytes, tokens, data.Response.UsageMetadata)
+}
+
+// Exceeded 报告输出是否已被截断。
+func (l *OutputLimit) Exceeded() bool {
+	return l != nil && l.exceeded
+}
@@ -0,0 +1,76 @@
+package common
+
+import (
+	"errors"
+	"testing"
+
+	"anti2api-golang/refactor/internal/config"
+	jsonpkg "anti2api-golang/refactor/internal/pkg/json"
+	"anti2api-golang/refactor/internal/vertex"
+)
+
+func setOutputLimits(t *testing.T, bytes, tokens int) {
+	t.Helper()
+	c := config.Get()
+	oldBytes, oldTokens := c.MaxStreamOutputBytes, c.MaxStreamOutputTokens
+	c.MaxStreamOutputBytes, c.MaxStreamOutputTokens = bytes, tokens
+	t.Cleanup(func() { c.MaxStreamOutputBytes, c.MaxStreamOutputTokens = oldBytes, oldTokens })
+}
+
+func textChunk(t *testing.T, text string, usage string) *vertex.StreamData {
+	t.Helper()
+	raw := `{"response":{"candidates":[{"content":{"parts":[{"text":` + quote(t, text) + `}]}}]` + usage + `}}`
+	var data vertex.StreamData
+	if err := jsonpkg.UnmarshalString(raw, &data); err != nil {
+		t.Fatal(err)
+	}
+	return &data
+}
+
+func quote(t *testing.T, s string) string {
+	t.Helper()
+	b, err := jsonpkg.MarshalString(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+func TestOutputLimit_DisabledByDefault(t *testing.T) {
+	setOutputLimits(t, 0, 0)
+	l := NewOutputLimit()
+	if l != nil {
+		t.Fatal("expected nil limit when not configured")
+	}
+	if err := l.ObserveStreamData(textChunk(t, "hello", "")); err != nil || l.Exceeded() {
+		t.Fatalf("nil limit should be a no-op, got %v", err)
+	}
+}
+
+func TestOutputLimit_Bytes(t *testing.T) {
+	setOutputLimits(t, 10, 0)
+	l := NewOutputLimit()
+	if err := l.ObserveStreamData(textChunk(t, "0123456789", "")); err != nil {
+		t.Fatalf("chunk within the limit rejected: %v", err)
+	}
+	if err := l.ObserveStreamData(textChunk(t, "x", "")); !errors.Is(err, ErrOutputLimit) {
+		t.Fatalf("expected ErrOutputLimit, got %v", err)
+	}
+	if !l.Exceeded() {
+		t.Fatal("Exceeded should report true")
+	}
+	if err := l.ObserveStreamData(textChunk(t, "", "")); !errors.Is(err, ErrOutputLimit) {
+		t.Fatal("limit should stay tripped")
+	}
+}
+
+func TestOutputLimit_TokensUseUpstreamUsage(t *testing.T) {
+	setOutputLimits(t, 0, 100)
+	l := NewOutputLimit()
+	if err := l.ObserveStreamData(textChunk(t, "short", `,"usageMetadata":{"candidatesTokenCount":60,"thoughtsTokenCount":30}`)); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := l.ObserveStreamData(textChunk(t, "more", `,"usageMetadata":{"candidatesTokenCount":75,"thoughtsTokenCount":30}`)); !errors.Is(err, ErrOutputLimit) {
+		t.Fatalf("expected ErrOutputLimit from reported usage, got %v", err)
+	}
+}
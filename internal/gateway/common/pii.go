@@ -0,0 +1,298 @@
+package common
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"sync"
+
+	"anti2api-golang/refactor/internal/config"
+	"anti2api-golang/refactor/internal/logger"
+	"anti2api-golang/refactor/internal/vertex"
+)
+
+// 占位符形如 [[PII_EMAIL_1]]，只包含 ASCII，模型通常会原样复述。
+const piiPlaceholderHead = "[[PII_"
+
+var piiPlaceholderRe = regexp.MustCompile(`\[\[PII_[A-Z]+_\d+\]\]`)
+
+// builtinPIIPatterns 为 PII_SCRUB 可选的内置规则。phone 只匹配以 + 开头的国际号码，或带区号括号 / 分隔符的号码
+// （如 (555) 123-4567、010-1234-5678），并要求前后是单词边界，避免把时间戳、长 ID 等连续数字当作号码。
+var builtinPIIPatterns = map[string]string{
+	"email": `[A-Za-z0-9._%+\-]+@[A-Za-z0-9\-]+(?:\.[A-Za-z0-9\-]+)*\.[A-Za-z]{2,}`,
+	"phone": `\+\d{1,3}[\s\-.]?(?:\(\d{1,4}\)[\s\-.]?)?\d{2,4}(?:[\s\-.]?\d{2,4}){1,3}\b|(?:\(\d{2,4}\)\s?|\b\d{2,4}[\s\-])\d{3,4}[\s\-]\d{3,4}\b`,
+}
+
+type piiRule struct {
+	kind string
+	re   *regexp.Regexp
+}
+
+var (
+	piiRulesOnce sync.Once
+	piiRules     []piiRule
+)
+
+func loadPIIRules() []piiRule {
+	piiRulesOnce.Do(func() {
+		cfg := config.Get()
+		for _, kind := range cfg.PIIScrub {
+			expr, ok := builtinPIIPatterns[kind]
+			if !ok {
+				logger.Warn("未知的 PII_SCRUB 类别: %s（可选 email、phone）", kind)
+				continue
+			}
+			piiRules = append(piiRules, piiRule{kind: strings.ToUpper(kind), re: regexp.MustCompile(expr)})
+		}
+		for _, expr := range cfg.PIIScrubPatterns {
+			re, err := regexp.Compile(expr)
+			if err != nil {
+				logger.Warn("PII_SCRUB_PATTERNS 正则无效，已忽略: %s (%v)", expr, err)
+				continue
+			}
+			piiRules = append(piiRules, piiRule{kind: "CUSTOM", re: re})
+		}
+	})
+	return piiRules
+}
+
+// PIIScrubber 在转发前把请求中的敏感信息替换为占位符，并在响应中还原。
+// 每个客户端请求使用一个实例；未配置任何规则时 NewPIIScrubber 返回 nil，所有方法对 nil 安全。
+type PIIScrubber struct {
+	rules         []piiRule
+	toPlaceholder map[string]string
+	toOriginal    map[string]string
+	counts        map[string]int
+
+	pendingText    string
+	pendingThought string
+}
+
+func NewPIIScrubber() *PIIScrubber {
+	rules := loadPIIRules()
+	if len(rules) == 0 {
+		return nil
+	}
+	return newPIIScrubber(rules)
+}
+
+func newPIIScrubber(rules []piiRule) *PIIScrubber {
+	return &PIIScrubber{
+		rules:         rules,
+		toPlaceholder: make(map[string]string),
+		toOriginal:    make(map[string]string),
+		counts:        make(map[string]int),
+	}
+}
+
+// Scrub 替换文本中的敏感信息；同一原文在整个请求内映射到同一个占位符。
+func (s *PIIScrubber) Scrub(text string) string {
+	if s == nil || text == "" {
+		return text
+	}
+	for _, rule := range s.rules {
+		text = replaceOutsidePlaceholders(text, func(seg string) string {
+			return rule.re.ReplaceAllStringFunc(seg, func(match string) string {
+				return s.placeholderFor(rule.kind, match)
+			})
+		})
+	}
+	return text
+}
+
+func (s *PIIScrubber) placeholderFor(kind, match string) string {
+	if ph, ok := s.toPlaceholder[match]; ok {
+		return ph
+	}
+	s.counts[kind]++
+	ph := fmt.Sprintf("%s%s_%d]]", piiPlaceholderHead, kind, s.counts[kind])
+	s.toPlaceholder[match] = ph
+	s.toOriginal[ph] = match
+	return ph
+}
+
+// replaceOutsidePlaceholders 只对占位符之外的片段应用 fn，避免后续规则改写已生成的占位符。
+func replaceOutsidePlaceholders(text string, fn func(string) string) string {
+	locs := piiPlaceholderRe.FindAllStringIndex(text, -1)
+	if len(locs) == 0 {
+		return fn(text)
+	}
+	var b strings.Builder
+	prev := 0
+	for _, loc := range locs {
+		b.WriteString(fn(text[prev:loc[0]]))
+		b.WriteString(text[loc[0]:loc[1]])
+		prev = loc[1]
+	}
+	b.WriteString(fn(text[prev:]))
+	return b.String()
+}
+
+// Restore 将文本中的占位符还原为原文；未知占位符保持不变。
+func (s *PIIScrubber) Restore(text string) string {
+	if s == nil || len(s.toOriginal) == 0 || !strings.Contains(text, piiPlaceholderHead) {
+		return text
+	}
+	return piiPlaceholderRe.ReplaceAllStringFunc(text, func(ph string) string {
+		if orig, ok := s.toOriginal[ph]; ok {
+			return orig
+		}
+		return ph
+	})
+}
+
+// ScrubRequest 脱敏 contents（文本、工具调用参数、工具结果）与 systemInstruction。
+func (s *PIIScrubber) ScrubRequest(req *vertex.Request) {
+	if s == nil || req == nil {
+		return
+	}
+	if si := req.Request.SystemInstruction; si != nil {
+		for i := range si.Parts {
+			si.Parts[i].Text = s.Scrub(si.Parts[i].Text)
+		}
+	}
+	for i := range req.Request.Contents {
+		parts := req.Request.Contents[i].Parts
+		for j := range parts {
+			parts[j].Text = s.Scrub(parts[j].Text)
+			if fc := parts[j].FunctionCall; fc != nil {
+				fc.Args = s.mapValues(fc.Args, s.Scrub)
+			}
+			if fr := parts[j].FunctionResponse; fr != nil {
+				fr.Response = s.mapValues(fr.Response, s.Scrub)
+			}
+		}
+	}
+}
+
+// RestoreResponse 还原非流式响应中的文本与工具调用参数。
+func (s *PIIScrubber) RestoreResponse(resp *vertex.Response) {
+	if s == nil || resp == nil {
+		return
+	}
+	for i := range resp.Response.Candidates {
+		parts := resp.Response.Candidates[i].Content.Parts
+		for j := range parts {
+			parts[j].Text = s.Restore(parts[j].Text)
+			if fc := parts[j].FunctionCall; fc != nil {
+				fc.Args = s.RestoreArgs(fc.Args)
+			}
+		}
+	}
+}
+
+// RestoreStreamData 还原流式分片（文本见 RestoreStreamText）。
+func (s *PIIScrubber) RestoreStreamData(data *vertex.StreamData) {
+	if s == nil || data == nil {
+		return
+	}
+	for i := range data.Response.Candidates {
+		parts := data.Response.Candidates[i].Content.Parts
+		for j := range parts {
+			if fc := parts[j].FunctionCall; fc != nil {
+				fc.Args = s.RestoreArgs(fc.Args)
+			} else if parts[j].InlineData == nil {
+				parts[j].Text = s.RestoreStreamText(parts[j].Text, parts[j].Thought)
+			}
+		}
+	}
+}
+
+// RestoreStreamText 还原流式文本。占位符可能被拆到相邻分片中，
+// 因此末尾疑似占位符前缀的部分会暂存到下一个分片，流结束时需调用 FlushStream。
+func (s *PIIScrubber) RestoreStreamText(text string, thought bool) string {
+	if s == nil || len(s.toOriginal) == 0 {
+		return text
+	}
+	pending := &s.pendingText
+	if thought {
+		pending = &s.pendingThought
+	}
+	text, *pending = s.restoreChunk(*pending + text)
+	return text
+}
+
+// RestoreArgs 还原工具调用参数中的字符串值（原地修改）。
+func (s *PIIScrubber) RestoreArgs(args map[string]any) map[string]any {
+	if s == nil || len(s.toOriginal) == 0 {
+		return args
+	}
+	return s.mapValues(args, s.Restore)
+}
+
+// FlushStream 返回流结束时仍暂存的文本（已尽可能还原）。
+func (s *PIIScrubber) FlushStream() (text, thought string) {
+	if s == nil {
+		return "", ""
+	}
+	text, thought = s.Restore(s.pendingText), s.Restore(s.pendingThought)
+	s.pendingText, s.pendingThought = "", ""
+	return text, thought
+}
+
+func (s *PIIScrubber) restoreChunk(text string) (out, pending string) {
+	start := strings.LastIndexByte(text, '[')
+	if start < 0 {
+		return s.Restore(text), ""
+	}
+	if start > 0 && text[start-1] == '[' {
+		start--
+	}
+	if isPartialPIIPlaceholder(text[start:]) {
+		return s.Restore(text[:start]), text[start:]
+	}
+	return s.Restore(text), ""
+}
+
+// isPartialPIIPlaceholder 判断 s 是否为尚未结束的占位符前缀（例如 "[[PII_EM"）。
+func isPartialPIIPlaceholder(s string) bool {
+	if len(s) <= len(piiPlaceholderHead) {
+		return strings.HasPrefix(piiPlaceholderHead, s)
+	}
+	if !strings.HasPrefix(s, piiPlaceholderHead) {
+		return false
+	}
+	rest := s[len(piiPlaceholderHead):]
+	i := 0
+	for i < len(rest) && rest[i] >= 'A' && rest[i] <= 'Z' {
+		i++
+	}
+	if i == len(rest) {
+		return true
+	}
+	if i == 0 || rest[i] != '_' {
+		return false
+	}
+	i++
+	j := i
+	for j < len(rest) && rest[j] >= '0' && rest[j] <= '9' {
+		j++
+	}
+	if j == len(rest) {
+		return true
+	}
+	return j > i && rest[j:] == "]"
+}
+
+func (s *PIIScrubber) mapValues(m map[string]any, fn func(string) string) map[string]any {
+	for k, v := range m {
+		m[k] = s.walkValue(v, fn)
+	}
+	return m
+}
+
+func (s *PIIScrubber) walkValue(v any, fn func(string) string) any {
+	switch t := v.(type) {
+	case string:
+		return fn(t)
+	case map[string]any:
+		return s.mapValues(t, fn)
+	case []any:
+		for i := range t {
+			t[i] = s.walkValue(t[i], fn)
+		}
+		return t
+	default:
+		return v
+	}
+}
@@ -0,0 +1,127 @@
+package common
+
+import (
+	"regexp"
+	"strings"
+	"testing"
+
+	"anti2api-golang/refactor/internal/vertex"
+)
+
+func testPIIScrubber() *PIIScrubber {
+	return newPIIScrubber([]piiRule{
+		{kind: "EMAIL", re: regexp.MustCompile(builtinPIIPatterns["email"])},
+		{kind: "PHONE", re: regexp.MustCompile(builtinPIIPatterns["phone"])},
+		{kind: "CUSTOM", re: regexp.MustCompile(`\d+`)},
+	})
+}
+
+func TestPIIScrubber_ScrubAndRestore(t *testing.T) {
+	s := testPIIScrubber()
+	in := "mail alice@example.com or +1 (555) 123-4567, again alice@example.com"
+	got := s.Scrub(in)
+	if strings.Contains(got, "alice@example.com") || strings.Contains(got, "555") {
+		t.Fatalf("expected PII to be scrubbed, got %q", got)
+	}
+	if strings.Count(got, "[[PII_EMAIL_1]]") != 2 {
+		t.Fatalf("expected the same email to map to one placeholder, got %q", got)
+	}
+	if !strings.Contains(got, "[[PII_PHONE_1]]") {
+		t.Fatalf("expected phone placeholder, got %q", got)
+	}
+	if back := s.Restore(got); back != in {
+		t.Fatalf("restore mismatch:\ngot  %q\nwant %q", back, in)
+	}
+}
+
+func TestBuiltinPhonePattern(t *testing.T) {
+	re := regexp.MustCompile(builtinPIIPatterns["phone"])
+	for _, in := range []string{
+		"+1 (555) 123-4567",
+		"+86 138 1234 5678",
+		"+8613812345678",
+		"+44 20 7946 0958",
+		"(555) 123-4567",
+		"555-123-4567",
+		"010-1234-5678",
+	} {
+		if got := re.FindString("call " + in + " now"); got != in {
+			t.Fatalf("%q: expected a full phone match, got %q", in, got)
+		}
+	}
+	for _, in := range []string{
+		"2026-10-17 12:30:45",
+		"2026-10-17T12:30:45.123Z",
+		"1697500000000",
+		"20261017123045",
+		"order 12345678901234567890",
+		"13812345678",
+		"msg_01ABC1234567890",
+		"192.168.100.200",
+		"v1.2345.6789",
+	} {
+		if got := re.FindString(in); got != "" {
+			t.Fatalf("%q should not look like a phone number, matched %q", in, got)
+		}
+	}
+}
+
+func TestPIIScrubber_RequestAndResponse(t *testing.T) {
+	s := testPIIScrubber()
+	req := &vertex.Request{Request: vertex.InnerReq{
+		SystemInstruction: &vertex.SystemInstruction{Parts: []vertex.Part{{Text: "owner bob@corp.io"}}},
+		Contents: []vertex.Content{{Role: "user", Parts: []vertex.Part{
+			{Text: "email bob@corp.io"},
+			{FunctionResponse: &vertex.FunctionResponse{Name: "lookup", Response: map[string]any{"output": []any{"carol@corp.io"}}}},
+		}}},
+	}}
+	s.ScrubRequest(req)
+	if got := req.Request.SystemInstruction.Parts[0].Text; got != "owner [[PII_EMAIL_1]]" {
+		t.Fatalf("unexpected system text %q", got)
+	}
+	if got := req.Request.Contents[0].Parts[1].FunctionResponse.Response["output"].([]any)[0]; got != "[[PII_EMAIL_2]]" {
+		t.Fatalf("unexpected function response value %v", got)
+	}
+
+	resp := &vertex.Response{}
+	resp.Response.Candidates = []vertex.Candidate{{Content: vertex.Content{Parts: []vertex.Part{
+		{Text: "sent to [[PII_EMAIL_1]] and [[PII_EMAIL_9]]"},
+		{FunctionCall: &vertex.FunctionCall{Name: "send", Args: map[string]any{"to": "[[PII_EMAIL_2]]"}}},
+	}}}}
+	s.RestoreResponse(resp)
+	parts := resp.Response.Candidates[0].Content.Parts
+	if parts[0].Text != "sent to bob@corp.io and [[PII_EMAIL_9]]" {
+		t.Fatalf("unexpected restored text %q", parts[0].Text)
+	}
+	if parts[1].FunctionCall.Args["to"] != "carol@corp.io" {
+		t.Fatalf("unexpected restored args %v", parts[1].FunctionCall.Args)
+	}
+}
+
+func TestPIIScrubber_StreamSplitPlaceholder(t *testing.T) {
+	s := testPIIScrubber()
+	s.Scrub("dave@example.org")
+
+	var out strings.Builder
+	for _, chunk := range []string{"hi [", "[PII_EM", "AIL_1]", "] bye [x] [[PII"} {
+		out.WriteString(s.RestoreStreamText(chunk, false))
+	}
+	text, _ := s.FlushStream()
+	out.WriteString(text)
+	if got := out.String(); got != "hi dave@example.org bye [x] [[PII" {
+		t.Fatalf("unexpected stream output %q", got)
+	}
+}
+
+func TestIsPartialPIIPlaceholder(t *testing.T) {
+	for _, s := range []string{"[", "[[", "[[PI", "[[PII_", "[[PII_EMAIL", "[[PII_EMAIL_", "[[PII_EMAIL_12", "[[PII_EMAIL_12]"} {
+		if !isPartialPIIPlaceholder(s) {
+			t.Fatalf("expected %q to be a partial placeholder", s)
+		}
+	}
+	for _, s := range []string{"[x", "[[PII_EMAIL_1]]", "[[PII__", "[[PII_EMAIL_]", "[[PII_email"} {
+		if isPartialPIIPlaceholder(s) {
+			t.Fatalf("expected %q not to be a partial placeholder", s)
+		}
+	}
+}
@@ -0,0 +1,121 @@
+package common
+
+import (
+	"strings"
+
+	"anti2api-golang/refactor/internal/vertex"
+)
+
+// TrimPrefill 处理请求末尾的 assistant 预填充（prefill）：contents 以不含工具调用的 model 轮次结尾时，
+// 该轮次会作为续写前缀发送给上游。Anthropic 后端拒绝以空白结尾的 prefill，因此去掉末尾空白
+// （去掉后为空的 part/轮次一并移除），被去掉的空白记录在 req.PrefillWhitespace，供 PrefillJoiner 使用。
+func TrimPrefill(req *vertex.Request) {
+	if req == nil {
+		return
+	}
+	contents := req.Request.Contents
+	if len(contents) == 0 {
+		return
+	}
+	last := &contents[len(contents)-1]
+	if last.Role != "model" {
+		return
+	}
+	for _, p := range last.Parts {
+		if p.FunctionCall != nil || p.FunctionResponse != nil {
+			return
+		}
+	}
+
+	removed := ""
+	parts := last.Parts
+	for len(parts) > 0 {
+		p := &parts[len(parts)-1]
+		if p.Thought || p.InlineData != nil {
+			break
+		}
+		trimmed := strings.TrimRight(p.Text, " \t\r\n")
+		removed = p.Text[len(trimmed):] + removed
+		if trimmed != "" {
+			p.Text = trimmed
+			break
+		}
+		parts = parts[:len(parts)-1]
+	}
+	last.Parts = parts
+	if len(parts) == 0 {
+		req.Request.Contents = contents[:len(contents)-1]
+	}
+	req.PrefillWhitespace = removed
+}
+
+// PrefillJoiner 保证客户端把 prefill 与续写输出直接拼接后得到正确的文本：
+// prefill 末尾的空白在发送前被去掉（见 TrimPrefill），模型续写时往往会重新输出这段空白，
+// 而客户端持有的 prefill 仍带着它，因此去掉输出开头与之重复的部分。
+// 没有被去掉的空白时 NewPrefillJoiner 返回 nil，所有方法对 nil 安全。
+type PrefillJoiner struct {
+	pending string
+}
+
+func NewPrefillJoiner(req *vertex.Request) *PrefillJoiner {
+	if req == nil || req.PrefillWhitespace == "" {
+		return nil
+	}
+	return &PrefillJoiner{pending: req.PrefillWhitespace}
+}
+
+// Text 处理一段按顺序输出的正文（不含思考内容），返回应发送给客户端的部分。
+func (j *PrefillJoiner) Text(s string) string {
+	if j == nil || j.pending == "" || s == "" {
+		return s
+	}
+	n := min(len(j.pending), len(s))
+	if s[:n] != j.pending[:n] {
+		j.pending = ""
+		return s
+	}
+	j.pending = j.pending[n:]
+	return s[n:]
+}
+
+// JoinResponse 处理非流式响应中的正文。
+func (j *PrefillJoiner) JoinResponse(resp *vertex.Response) {
+	if j == nil || resp == nil || len(resp.Response.Candidates) == 0 {
+		return
+	}
+	parts := resp.Response.Candidates[0].Content.Parts
+	for i := range parts {
+		if j.pending == "" {
+			return
+		}
+		if parts[i].Thought {
+			continue
+		}
+		if parts[i].FunctionCall != nil || parts[i].InlineData != nil {
+			j.pending = ""
+			return
+		}
+		parts[i].Text = j.Text(parts[i].Text)
+	}
+}
+
+// JoinStreamData 处理流式分片中的正文。
+func (j *PrefillJoiner) JoinStreamData(data *vertex.StreamData) {
+	if j == nil || data == nil || len(data.Response.Candidates) == 0 {
+		return
+	}
+	parts := data.Response.Candidates[0].Content.Parts
+	for i := range parts {
+		if j.pending == "" {
+			return
+		}
+		if parts[i].Thought {
+			continue
+		}
+		if parts[i].FunctionCall != nil || parts[i].InlineData != nil {
+			j.pending = ""
+			return
+		}
+		parts[i].Text = j.Text(parts[i].Text)
+	}
+}
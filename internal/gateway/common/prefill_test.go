@@ -0,0 +1,67 @@
+package common
+
+import (
+	"testing"
+
+	"anti2api-golang/refactor/internal/vertex"
+)
+
+func TestTrimPrefill(t *testing.T) {
+	req := &vertex.Request{}
+	req.Request.Contents = []vertex.Content{
+		{Role: "user", Parts: []vertex.Part{{Text: "hi"}}},
+		{Role: "model", Parts: []vertex.Part{{Text: "Answer: "}, {Text: "\n"}}},
+	}
+	TrimPrefill(req)
+	last := req.Request.Contents[len(req.Request.Contents)-1]
+	if len(last.Parts) != 1 || last.Parts[0].Text != "Answer:" {
+		t.Fatalf("prefill not trimmed: %#v", last.Parts)
+	}
+	if req.PrefillWhitespace != " \n" {
+		t.Fatalf("PrefillWhitespace = %q", req.PrefillWhitespace)
+	}
+
+	req.Request.Contents = []vertex.Content{
+		{Role: "user", Parts: []vertex.Part{{Text: "hi"}}},
+		{Role: "model", Parts: []vertex.Part{{Text: "  "}}},
+	}
+	TrimPrefill(req)
+	if len(req.Request.Contents) != 1 || req.PrefillWhitespace != "  " {
+		t.Fatalf("whitespace-only prefill should be dropped: %#v %q", req.Request.Contents, req.PrefillWhitespace)
+	}
+
+	// 以工具调用结尾的 model 轮次不是 prefill。
+	req = &vertex.Request{}
+	req.Request.Contents = []vertex.Content{{Role: "model", Parts: []vertex.Part{
+		{Text: "calling "},
+		{FunctionCall: &vertex.FunctionCall{Name: "f"}},
+	}}}
+	TrimPrefill(req)
+	if req.Request.Contents[0].Parts[0].Text != "calling " || req.PrefillWhitespace != "" {
+		t.Fatalf("tool call turn should be left alone: %#v", req.Request.Contents)
+	}
+}
+
+func TestPrefillJoiner(t *testing.T) {
+	req := &vertex.Request{PrefillWhitespace: " \n"}
+	j := NewPrefillJoiner(req)
+	if got := j.Text(" "); got != "" {
+		t.Fatalf("first chunk = %q", got)
+	}
+	if got := j.Text("\nworld"); got != "world" {
+		t.Fatalf("second chunk = %q", got)
+	}
+	if got := j.Text(" again"); got != " again" {
+		t.Fatalf("later chunks must pass through, got %q", got)
+	}
+
+	j = NewPrefillJoiner(req)
+	if got := j.Text("world"); got != "world" {
+		t.Fatalf("non-whitespace start = %q", got)
+	}
+
+	nilJoiner := NewPrefillJoiner(&vertex.Request{})
+	if nilJoiner != nil || nilJoiner.Text(" x") != " x" {
+		t.Fatal("joiner without trimmed whitespace should be a no-op")
+	}
+}
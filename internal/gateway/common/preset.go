@@ -0,0 +1,37 @@
+package common
+
+import (
+	"context"
+
+	"anti2api-golang/refactor/internal/config"
+	"anti2api-golang/refactor/internal/middleware"
+	"anti2api-golang/refactor/internal/pkg/modelutil"
+	"anti2api-golang/refactor/internal/vertex"
+)
+
+// KeyPreset 返回当前请求所用 API Key 的预设（见 API_KEY_PRESETS）。
+func KeyPreset(ctx context.Context) (config.APIKeyPreset, bool) {
+	key := middleware.APIKeyFromContext(ctx)
+	if key == "" {
+		return config.APIKeyPreset{}, false
+	}
+	p, ok := config.Get().APIKeyPresets[key]
+	return p, ok
+}
+
+// PresetModel 返回应用 API Key 预设后的模型名（在解析请求后、转换为 Vertex 请求前调用）。
+func PresetModel(ctx context.Context, model string) string {
+	if p, ok := KeyPreset(ctx); ok {
+		return modelutil.PresetModel(p, model)
+	}
+	return model
+}
+
+// ApplyKeyPreset 将 API Key 预设的生成参数应用到 req（主请求与降级请求都需调用，位于 DowngradeThinking 之前）。
+func ApplyKeyPreset(ctx context.Context, req *vertex.Request) {
+	p, ok := KeyPreset(ctx)
+	if !ok || req == nil {
+		return
+	}
+	req.Request.GenerationConfig = modelutil.ApplyPreset(p, req.Request.GenerationConfig)
+}
@@ -0,0 +1,39 @@
+package common
+
+import (
+	"net/http"
+	"strconv"
+
+	"anti2api-golang/refactor/internal/config"
+	"anti2api-golang/refactor/internal/quota"
+)
+
+// 剩余配额响应头（QUOTA_HEADERS=true 时返回），取自服务账号最近一次的配额快照，供客户端在触发 429 前自行限速。
+const (
+	QuotaRemainingHeader = "X-RateLimit-Remaining-Fraction"
+	QuotaGroupHeader     = "X-Quota-Group"
+	QuotaResetHeader     = "X-Quota-Reset"
+)
+
+// SetQuotaHeaders 按服务账号（SessionID）与后端模型写入剩余配额响应头；未开启或没有该模型的配额快照时不写出。
+// 应在选定账号、写出响应头之前调用（重试切换账号时再次调用会覆盖）。
+func SetQuotaHeaders(w http.ResponseWriter, sessionID, model string) {
+	if !config.Get().QuotaHeaders {
+		return
+	}
+	h := w.Header()
+	h.Del(QuotaRemainingHeader)
+	h.Del(QuotaGroupHeader)
+	h.Del(QuotaResetHeader)
+	g, _, ok := quota.Lookup(sessionID, model)
+	if !ok {
+		return
+	}
+	h.Set(QuotaGroupHeader, g.GroupName)
+	if g.RemainingFraction != nil {
+		h.Set(QuotaRemainingHeader, strconv.FormatFloat(*g.RemainingFraction, 'f', -1, 64))
+	}
+	if g.ResetTime != "" {
+		h.Set(QuotaResetHeader, g.ResetTime)
+	}
+}
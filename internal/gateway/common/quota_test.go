@@ -0,0 +1,43 @@
+package common
+
+import (
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"anti2api-golang/refactor/internal/config"
+	"anti2api-golang/refactor/internal/quota"
+)
+
+func TestSetQuotaHeaders(t *testing.T) {
+	quota.Reset()
+	t.Cleanup(quota.Reset)
+	c := config.Get()
+	old := c.QuotaHeaders
+	t.Cleanup(func() { c.QuotaHeaders = old })
+
+	remaining := 0.25
+	quota.Put("s1", []quota.Group{{GroupName: "Gemini 3 Pro", RemainingFraction: &remaining, ResetTime: "2026-01-01T00:00:00Z", ModelList: []string{"gemini-3-pro-high"}}}, time.Now())
+
+	c.QuotaHeaders = false
+	w := httptest.NewRecorder()
+	SetQuotaHeaders(w, "s1", "gemini-3-pro-high")
+	if w.Header().Get(QuotaGroupHeader) != "" {
+		t.Fatalf("headers must not be written when QUOTA_HEADERS is off")
+	}
+
+	c.QuotaHeaders = true
+	SetQuotaHeaders(w, "s1", "models/Gemini-3-Pro-High")
+	if got := w.Header().Get(QuotaRemainingHeader); got != "0.25" {
+		t.Fatalf("%s = %q", QuotaRemainingHeader, got)
+	}
+	if w.Header().Get(QuotaGroupHeader) != "Gemini 3 Pro" || w.Header().Get(QuotaResetHeader) != "2026-01-01T00:00:00Z" {
+		t.Fatalf("unexpected headers: %v", w.Header())
+	}
+
+	// 重试切换到没有快照的账号时清除旧值。
+	SetQuotaHeaders(w, "s2", "gemini-3-pro-high")
+	if w.Header().Get(QuotaRemainingHeader) != "" || w.Header().Get(QuotaGroupHeader) != "" {
+		t.Fatalf("stale quota headers kept: %v", w.Header())
+	}
+}
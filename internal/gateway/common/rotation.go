@@ -6,6 +6,7 @@ import (
 	"net/http"
 
 	"anti2api-golang/refactor/internal/credential"
+	"anti2api-golang/refactor/internal/logger"
 	"anti2api-golang/refactor/internal/vertex"
 )
 
@@ -23,6 +24,48 @@ func ShouldRetryWithNextToken(err error) bool {
 	return false
 }
 
+// IsAuthError 判断 err 是否为上游的认证失败（401 / 403）。
+// 流式请求在开始输出 SSE 之前遇到这类错误时应返回对应的 HTTP 状态码，而不是 200 + SSE 错误事件，
+// 否则部分客户端不会触发重新认证或重试。
+func IsAuthError(err error) bool {
+	status := StatusFromVertexError(err)
+	return status == http.StatusUnauthorized || status == http.StatusForbidden
+}
+
+// RefreshOnUnauthorized 在上游以 401 拒绝 acc 的 token 时强制刷新该账号的 token。
+// 刷新成功时返回刷新后的账号与 true，调用方应使用同一账号重试一次，并将重试结果交给 DisableOnUnauthenticated；
+// 否则返回 nil, false，按原逻辑轮换账号。token 端点明确拒绝 refresh_token 时同时自动禁用该账号。
+func RefreshOnUnauthorized(store *credential.Store, acc *credential.Account, err error) (*credential.Account, bool) {
+	var apiErr *vertex.APIError
+	if store == nil || acc == nil || !errors.As(err, &apiErr) || apiErr.Status != http.StatusUnauthorized {
+		return nil, false
+	}
+	refreshed, refreshErr := store.RefreshBySessionID(acc.SessionID)
+	if refreshErr != nil {
+		logger.Warn("账号 %s 的 token 被上游拒绝（401），刷新失败: %v", acc.Email, refreshErr)
+		if errors.Is(refreshErr, credential.ErrRefreshRejected) {
+			store.DisableBySessionID(acc.SessionID, "refresh_token 已失效，需要重新授权")
+		}
+		return nil, false
+	}
+	logger.Info("账号 %s 的 token 被上游拒绝（401），已刷新并重试", acc.Email)
+	return refreshed, true
+}
+
+// DisableOnUnauthenticated 在刷新 token 后重试仍被上游以 UNAUTHENTICATED（APIError.DisableToken）拒绝时自动禁用该账号，
+// 避免账号保持启用、每次轮到都失败一次。返回是否禁用了账号。
+func DisableOnUnauthenticated(store *credential.Store, acc *credential.Account, err error) bool {
+	var apiErr *vertex.APIError
+	if store == nil || acc == nil || !errors.As(err, &apiErr) || !apiErr.DisableToken {
+		return false
+	}
+	reason := "上游返回 UNAUTHENTICATED，刷新 token 后仍被拒绝"
+	if apiErr.Message != "" {
+		reason += "：" + apiErr.Message
+	}
+	return store.DisableBySessionID(acc.SessionID, reason)
+}
+
 func DoWithRoundRobin[T any](ctx context.Context, store *credential.Store, maxAttempts int, op func(acc *credential.Account) (T, error)) (T, *credential.Account, error) {
 	var zero T
 	if store == nil {
@@ -0,0 +1,65 @@
+package common
+
+import (
+	"errors"
+	"net/http"
+	"testing"
+
+	"anti2api-golang/refactor/internal/credential"
+	"anti2api-golang/refactor/internal/vertex"
+)
+
+func TestIsAuthError(t *testing.T) {
+	cases := []struct {
+		err  error
+		want bool
+	}{
+		{&vertex.APIError{Status: http.StatusUnauthorized}, true},
+		{&vertex.APIError{Status: http.StatusForbidden}, true},
+		{&vertex.APIError{Status: http.StatusTooManyRequests}, false},
+		{errors.New("没有可用的账号"), false},
+		{nil, false},
+	}
+	for _, c := range cases {
+		if got := IsAuthError(c.err); got != c.want {
+			t.Errorf("IsAuthError(%v) = %v, want %v", c.err, got, c.want)
+		}
+	}
+}
+
+func TestRefreshOnUnauthorized_OnlyFor401(t *testing.T) {
+	acc := &credential.Account{SessionID: "s1"}
+	for _, err := range []error{
+		nil,
+		&vertex.APIError{Status: http.StatusForbidden},
+		&vertex.APIError{Status: http.StatusTooManyRequests},
+	} {
+		if _, ok := RefreshOnUnauthorized(&credential.Store{}, acc, err); ok {
+			t.Fatalf("RefreshOnUnauthorized(%v) should not refresh", err)
+		}
+	}
+	if _, ok := RefreshOnUnauthorized(nil, acc, &vertex.APIError{Status: http.StatusUnauthorized}); ok {
+		t.Fatal("nil store should not refresh")
+	}
+	// 找不到账号时刷新失败，回退到原有的轮换逻辑。
+	if _, ok := RefreshOnUnauthorized(&credential.Store{}, acc, &vertex.APIError{Status: http.StatusUnauthorized}); ok {
+		t.Fatal("unknown account should not refresh")
+	}
+}
+
+func TestDisableOnUnauthenticated_OnlyForDisableToken(t *testing.T) {
+	acc := &credential.Account{SessionID: "s1"}
+	for _, err := range []error{
+		nil,
+		errors.New("network"),
+		&vertex.APIError{Status: http.StatusUnauthorized},
+		&vertex.APIError{Status: http.StatusForbidden},
+	} {
+		if DisableOnUnauthenticated(&credential.Store{}, acc, err) {
+			t.Fatalf("DisableOnUnauthenticated(%v) should not disable", err)
+		}
+	}
+	if DisableOnUnauthenticated(nil, acc, &vertex.APIError{Status: http.StatusUnauthorized, DisableToken: true}) {
+		t.Fatal("nil store should not disable")
+	}
+}
@@ -0,0 +1,16 @@
+package common
+
+import (
+	"net/http"
+
+	"anti2api-golang/refactor/internal/middleware"
+	"anti2api-golang/refactor/internal/session"
+)
+
+// SessionIDHeader 为客户端显式指定 Vertex sessionId 的请求头（会话可通过 /v1/sessions 创建）。
+const SessionIDHeader = "X-Session-ID"
+
+// SessionIDFromRequest 返回请求指定的 sessionId（只接受当前租户创建的会话）；为空表示沿用账号自身的 sessionId。
+func SessionIDFromRequest(r *http.Request) (string, error) {
+	return session.GetStore().Resolve(middleware.TenantFromContext(r.Context()), r.Header.Get(SessionIDHeader))
+}
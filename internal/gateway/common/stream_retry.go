@@ -0,0 +1,26 @@
+package common
+
+import (
+	"context"
+	"errors"
+)
+
+// StreamInterruptedMessage 返回上游流在输出过程中中断时发给客户端的错误信息。
+// 读取响应体期间触发 TIMEOUT 时返回 TimeoutMessage。
+func StreamInterruptedMessage(err error) string {
+	if IsUpstreamTimeout(err) {
+		return TimeoutMessage()
+	}
+	return "上游流意外中断（" + err.Error() + "），响应不完整，请重试。"
+}
+
+// ShouldRetryStream 判断读取上游流出错后是否应透明地重新打开一次流（会轮换到下一个账号）：
+// 客户端尚未收到任何内容、客户端仍在等待，且错误不是思考限制 / 输出上限主动中止或请求取消造成的。
+// 连接被重置、意外 EOF、gzip 截断等读取错误都属于这一类。
+func ShouldRetryStream(ctx context.Context, err error, forwarded bool, guard *ThinkingGuard) bool {
+	if err == nil || forwarded || ctx.Err() != nil || guard.Err() != nil || errors.Is(err, ErrOutputLimit) {
+		return false
+	}
+	var limitErr *ThinkingLimitError
+	return !errors.As(err, &limitErr) && !errors.Is(err, context.Canceled) && !errors.Is(err, context.DeadlineExceeded)
+}
@@ -0,0 +1,34 @@
+package common
+
+import (
+	"context"
+	"io"
+	"testing"
+	"time"
+)
+
+func TestShouldRetryStream(t *testing.T) {
+	ctx := context.Background()
+	canceled, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	cases := []struct {
+		name      string
+		ctx       context.Context
+		err       error
+		forwarded bool
+		want      bool
+	}{
+		{"unexpected EOF before output", ctx, io.ErrUnexpectedEOF, false, true},
+		{"clean end", ctx, nil, false, false},
+		{"already forwarded", ctx, io.ErrUnexpectedEOF, true, false},
+		{"client gone", canceled, io.ErrUnexpectedEOF, false, false},
+		{"request canceled", ctx, context.Canceled, false, false},
+		{"thinking limit", ctx, &ThinkingLimitError{Limit: "MAX_THINKING_SECONDS", Elapsed: 11 * time.Second}, false, false},
+	}
+	for _, c := range cases {
+		if got := ShouldRetryStream(c.ctx, c.err, c.forwarded, nil); got != c.want {
+			t.Errorf("%s: got %v, want %v", c.name, got, c.want)
+		}
+	}
+}
@@ -0,0 +1,26 @@
+package common
+
+import (
+	"net/http"
+	"slices"
+	"strings"
+
+	"anti2api-golang/refactor/internal/config"
+	"anti2api-golang/refactor/internal/middleware"
+)
+
+// NoSystemInjectionHeader 为按请求跳过 Antigravity agent 系统提示词注入的请求头（值为 1 / true 时跳过，0 / false 时强制注入）。
+const NoSystemInjectionHeader = "X-No-System-Injection"
+
+// SkipSystemInjection 判断该请求是否跳过 InjectAgentSystemPrompt，使客户端完全控制系统提示词：
+// 请求头 X-No-System-Injection 优先，未发送时按 API Key 是否在 NO_SYSTEM_INJECTION_KEYS 中决定。
+func SkipSystemInjection(r *http.Request) bool {
+	switch strings.ToLower(strings.TrimSpace(r.Header.Get(NoSystemInjectionHeader))) {
+	case "1", "true", "yes", "on":
+		return true
+	case "0", "false", "no", "off":
+		return false
+	}
+	key := middleware.APIKeyFromContext(r.Context())
+	return key != "" && slices.Contains(config.Get().NoSystemInjectionKeys, key)
+}
@@ -0,0 +1,19 @@
+package common
+
+import (
+	"net/http/httptest"
+	"testing"
+)
+
+func TestSkipSystemInjection_Header(t *testing.T) {
+	cases := map[string]bool{"": false, "1": true, "true": true, " ON ": true, "0": false, "false": false, "maybe": false}
+	for value, want := range cases {
+		r := httptest.NewRequest("POST", "/v1/chat/completions", nil)
+		if value != "" {
+			r.Header.Set(NoSystemInjectionHeader, value)
+		}
+		if got := SkipSystemInjection(r); got != want {
+			t.Errorf("header %q: got %v, want %v", value, got, want)
+		}
+	}
+}
@@ -1,6 +1,10 @@
 package common
 
-import "strings"
+import (
+	"strings"
+
+	"anti2api-golang/refactor/internal/vertex"
+)
 
 // ExtractTextFromContent 从 OpenAI/Claude 常见的 content/system 字段中提取纯文本：
 // - string：直接返回
@@ -62,3 +66,35 @@ func ExtractSystemFromMessages[T any](messages []T, role func(T) string, content
 func ExtractClaudeSystemText(system any) string {
 	return ExtractTextFromContent(system, "\n\n", true)
 }
+
+// ExtractClaudeSystemParts 将 Claude 请求中的 system 字段转换为 SystemInstruction parts。
+// 数组形式的每个非空 text block 保持为独立 part（按原顺序），不再拼接成一段文本；
+// cache_control 等元数据上游不支持，直接忽略。
+func ExtractClaudeSystemParts(system any) []vertex.Part {
+	switch v := system.(type) {
+	case string:
+		if v == "" {
+			return nil
+		}
+		return []vertex.Part{{Text: v}}
+	case []any:
+		parts := make([]vertex.Part, 0, len(v))
+		for _, it := range v {
+			m, ok := it.(map[string]any)
+			if !ok || m["type"] != "text" {
+				continue
+			}
+			t, _ := m["text"].(string)
+			if t == "" {
+				continue
+			}
+			parts = append(parts, vertex.Part{Text: t})
+		}
+		if len(parts) == 0 {
+			return nil
+		}
+		return parts
+	default:
+		return nil
+	}
+}
@@ -0,0 +1,60 @@
+package common
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"anti2api-golang/refactor/internal/logger"
+	"anti2api-golang/refactor/internal/pkg/modelutil"
+	"anti2api-golang/refactor/internal/vertex"
+)
+
+// ThinkingDowngradedHeader 在请求的 thinking 配置因模型不支持而被移除时设置为 "true"。
+const ThinkingDowngradedHeader = "X-Thinking-Downgraded"
+
+// 请求级 thinking 覆盖头，供请求体无法表达推理参数的客户端使用：
+// X-Thinking-Budget 为非负整数（0 关闭 thinking），X-Thinking-Level 为 minimal / low / medium / high / off。
+const (
+	ThinkingBudgetHeader = "X-Thinking-Budget"
+	ThinkingLevelHeader  = "X-Thinking-Level"
+)
+
+// ApplyThinkingHeaders 按请求头覆盖 req 已计算的 ThinkingConfig（见 modelutil.OverrideThinking），
+// 位于 ApplyKeyPreset 之后、DowngradeThinking 之前；头的值非法时返回错误且不修改 req。
+func ApplyThinkingHeaders(h http.Header, model string, req *vertex.Request) error {
+	budget, level := -1, strings.ToLower(strings.TrimSpace(h.Get(ThinkingLevelHeader)))
+	if v := strings.TrimSpace(h.Get(ThinkingBudgetHeader)); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			return fmt.Errorf("%s 必须为非负整数（0 表示关闭 thinking），当前为 %q", ThinkingBudgetHeader, v)
+		}
+		budget = n
+	}
+	switch level {
+	case "", "minimal", "low", "medium", "high", "off", "none":
+	default:
+		return fmt.Errorf("%s 仅支持 minimal / low / medium / high / off，当前为 %q", ThinkingLevelHeader, level)
+	}
+	if req == nil || (budget < 0 && level == "") {
+		return nil
+	}
+	if req.Request.GenerationConfig == nil {
+		req.Request.GenerationConfig = &vertex.GenerationConfig{}
+	}
+	modelutil.OverrideThinking(model, req.Request.GenerationConfig, budget, level)
+	return nil
+}
+
+// DowngradeThinking 对不支持 thinking 的模型（见 modelutil.RejectsThinkingConfig）移除请求中的 thinkingConfig，
+// 避免上游直接返回 400；发生移除时输出告警并设置 ThinkingDowngradedHeader。
+func DowngradeThinking(w http.ResponseWriter, model string, req *vertex.Request) {
+	if req == nil || !modelutil.DowngradeThinking(model, req.Request.GenerationConfig) {
+		return
+	}
+	logger.Warn("模型 %s 不支持 thinking，已忽略请求中的思考配置", model)
+	if w != nil {
+		w.Header().Set(ThinkingDowngradedHeader, "true")
+	}
+}
@@ -0,0 +1,169 @@
+package common
+
+import (
+	"fmt"
+	"io"
+	"sync"
+	"time"
+
+	"anti2api-golang/refactor/internal/config"
+	"anti2api-golang/refactor/internal/logger"
+	"anti2api-golang/refactor/internal/vertex"
+)
+
+// ThinkingLimitError 表示流式生成因长时间只有思考内容、没有任何可见输出而被中止（见 MAX_THINKING_SECONDS / MAX_THINKING_TOKENS）。
+type ThinkingLimitError struct {
+	// Limit 为触发的限制项（MAX_THINKING_SECONDS 或 MAX_THINKING_TOKENS）。
+	Limit         string
+	Elapsed       time.Duration
+	ThoughtTokens int
+}
+
+func (e *ThinkingLimitError) Error() string {
+	return fmt.Sprintf("模型已思考 %s（约 %d 个思考 token）仍没有任何输出，超过 %s 限制，已中止生成；请降低 thinking 预算或简化请求后重试。",
+		e.Elapsed.Round(time.Second), e.ThoughtTokens, e.Limit)
+}
+
+// ThinkingGuard 在流式生成出现第一段可见输出（正文、工具调用或图片）之前限制思考的时长与 token 数。
+// 时长限制由计时器保证：上游在思考期间不发送任何分片（例如未开启 includeThoughts）时，超时后关闭上游响应体以中止读取。
+// 未配置任何限制时 NewThinkingGuard 返回 nil，所有方法对 nil 安全。
+type ThinkingGuard struct {
+	maxDuration time.Duration
+	maxTokens   int
+
+	mu            sync.Mutex
+	start         time.Time
+	timer         *time.Timer
+	body          io.Closer
+	thoughtTokens int
+	visible       bool
+	err           *ThinkingLimitError
+}
+
+func NewThinkingGuard() *ThinkingGuard {
+	cfg := config.Get()
+	if cfg.MaxThinkingSeconds <= 0 && cfg.MaxThinkingTokens <= 0 {
+		return nil
+	}
+	return &ThinkingGuard{
+		maxDuration: time.Duration(max(cfg.MaxThinkingSeconds, 0)) * time.Second,
+		maxTokens:   max(cfg.MaxThinkingTokens, 0),
+	}
+}
+
+// Arm 在打开上游流后调用，body 为上游响应体。计时从第一次 Arm 开始，重新打开流（例如 MALFORMED_FUNCTION_CALL 重试）时再次调用，
+// 剩余时间沿用。
+func (g *ThinkingGuard) Arm(body io.Closer) {
+	if g == nil {
+		return
+	}
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.start.IsZero() {
+		g.start = time.Now()
+	}
+	g.body = body
+	if g.timer != nil {
+		g.timer.Stop()
+		g.timer = nil
+	}
+	if g.maxDuration > 0 && !g.visible && g.err == nil {
+		g.timer = time.AfterFunc(g.maxDuration-time.Since(g.start), g.expire)
+	}
+}
+
+func (g *ThinkingGuard) expire() {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.visible || g.err != nil {
+		return
+	}
+	g.tripLocked("MAX_THINKING_SECONDS")
+	if g.body != nil {
+		_ = g.body.Close()
+	}
+}
+
+func (g *ThinkingGuard) tripLocked(limit string) {
+	g.err = &ThinkingLimitError{Limit: limit, Elapsed: time.Since(g.start), ThoughtTokens: g.thoughtTokens}
+	logger.Warn("%s", g.err.Error())
+}
+
+// Observe 记录一个流式分片：thought 为其中的思考文本，visible 表示分片包含可见输出，usage 为分片中的 usageMetadata（可为 nil）。
+// 超过限制时返回 *ThinkingLimitError，调用方应停止读取上游流。
+func (g *ThinkingGuard) Observe(thought string, visible bool, usage *vertex.UsageMetadata) error {
+	if g == nil {
+		return nil
+	}
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.err != nil {
+		return g.err
+	}
+	if g.visible {
+		return nil
+	}
+	if visible {
+		g.visible = true
+		if g.timer != nil {
+			g.timer.Stop()
+		}
+		return nil
+	}
+	g.thoughtTokens += EstimateTokens(thought)
+	if usage != nil && usage.ThoughtsTokenCount > g.thoughtTokens {
+		g.thoughtTokens = usage.ThoughtsTokenCount
+	}
+	switch {
+	case g.maxTokens > 0 && g.thoughtTokens > g.maxTokens:
+		g.tripLocked("MAX_THINKING_TOKENS")
+	case g.maxDuration > 0 && time.Since(g.start) >= g.maxDuration:
+		g.tripLocked("MAX_THINKING_SECONDS")
+	default:
+		return nil
+	}
+	return g.err
+}
+
+// ObserveStreamData 对 vertex 流式分片调用 Observe。
+func (g *ThinkingGuard) ObserveStreamData(data *vertex.StreamData) error {
+	if g == nil || data == nil {
+		return nil
+	}
+	thought, visible := "", false
+	if len(data.Response.Candidates) > 0 {
+		for _, p := range data.Response.Candidates[0].Content.Parts {
+			if p.Thought {
+				thought += p.Text
+			} else if p.Text != "" || p.FunctionCall != nil || p.InlineData != nil {
+				visible = true
+			}
+		}
+	}
+	return g.Observe(thought, visible, data.Response.UsageMetadata)
+}
+
+// Err 返回触发的限制，未触发时返回 nil。
+func (g *ThinkingGuard) Err() error {
+	if g == nil {
+		return nil
+	}
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.err == nil {
+		return nil
+	}
+	return g.err
+}
+
+// Stop 停止计时器，请求结束时调用。
+func (g *ThinkingGuard) Stop() {
+	if g == nil {
+		return
+	}
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.timer != nil {
+		g.timer.Stop()
+	}
+}
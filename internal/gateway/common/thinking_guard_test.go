@@ -0,0 +1,93 @@
+package common
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"anti2api-golang/refactor/internal/config"
+	jsonpkg "anti2api-golang/refactor/internal/pkg/json"
+	"anti2api-golang/refactor/internal/vertex"
+)
+
+func setThinkingLimits(t *testing.T, seconds, tokens int) {
+	t.Helper()
+	c := config.Get()
+	oldSeconds, oldTokens := c.MaxThinkingSeconds, c.MaxThinkingTokens
+	c.MaxThinkingSeconds, c.MaxThinkingTokens = seconds, tokens
+	t.Cleanup(func() { c.MaxThinkingSeconds, c.MaxThinkingTokens = oldSeconds, oldTokens })
+}
+
+func thoughtChunk(t *testing.T, text string) *vertex.StreamData {
+	t.Helper()
+	data := &vertex.StreamData{}
+	if err := jsonpkg.UnmarshalString(`{"response":{"candidates":[{"content":{"parts":[{"thought":true,"text":"`+text+`"}]}}]}}`, data); err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+func TestThinkingGuard_Disabled(t *testing.T) {
+	setThinkingLimits(t, 0, 0)
+	if g := NewThinkingGuard(); g != nil {
+		t.Fatalf("guard should be nil when no limit is configured")
+	}
+}
+
+func TestThinkingGuard_TokenLimit(t *testing.T) {
+	setThinkingLimits(t, 0, 10)
+	g := NewThinkingGuard()
+	g.Arm(nil)
+	defer g.Stop()
+
+	if err := g.ObserveStreamData(thoughtChunk(t, strings.Repeat("a", 32))); err != nil {
+		t.Fatalf("8 thought tokens should not trip the guard: %v", err)
+	}
+	err := g.ObserveStreamData(thoughtChunk(t, strings.Repeat("a", 32)))
+	var limitErr *ThinkingLimitError
+	if !errors.As(err, &limitErr) || limitErr.Limit != "MAX_THINKING_TOKENS" {
+		t.Fatalf("err = %v, want MAX_THINKING_TOKENS limit", err)
+	}
+	if g.Err() == nil {
+		t.Fatalf("Err() should report the tripped limit")
+	}
+}
+
+func TestThinkingGuard_VisibleOutputDisarms(t *testing.T) {
+	setThinkingLimits(t, 0, 10)
+	g := NewThinkingGuard()
+	g.Arm(nil)
+	defer g.Stop()
+
+	if err := g.Observe("", true, nil); err != nil {
+		t.Fatalf("visible output: %v", err)
+	}
+	if err := g.Observe(strings.Repeat("a", 400), false, &vertex.UsageMetadata{ThoughtsTokenCount: 1000}); err != nil {
+		t.Fatalf("guard should not trip after visible output: %v", err)
+	}
+}
+
+type closeRecorder chan struct{}
+
+func (c closeRecorder) Close() error {
+	close(c)
+	return nil
+}
+
+func TestThinkingGuard_TimerClosesBody(t *testing.T) {
+	g := &ThinkingGuard{maxDuration: 20 * time.Millisecond}
+	body := make(closeRecorder)
+	g.Arm(body)
+	defer g.Stop()
+
+	select {
+	case <-body:
+	case <-time.After(2 * time.Second):
+		t.Fatalf("upstream body was not closed after the thinking time limit")
+	}
+	var limitErr *ThinkingLimitError
+	if !errors.As(g.Err(), &limitErr) || limitErr.Limit != "MAX_THINKING_SECONDS" {
+		t.Fatalf("Err() = %v, want MAX_THINKING_SECONDS limit", g.Err())
+	}
+}
@@ -0,0 +1,59 @@
+package common
+
+import (
+	"net/http"
+	"testing"
+
+	"anti2api-golang/refactor/internal/vertex"
+)
+
+func TestApplyThinkingHeaders(t *testing.T) {
+	newReq := func() *vertex.Request {
+		return &vertex.Request{Request: vertex.InnerReq{GenerationConfig: &vertex.GenerationConfig{
+			MaxOutputTokens: 64000,
+			ThinkingConfig:  &vertex.ThinkingConfig{IncludeThoughts: true, ThinkingBudget: 32000},
+		}}}
+	}
+
+	h := http.Header{}
+	h.Set(ThinkingBudgetHeader, "2048")
+	req := newReq()
+	if err := ApplyThinkingHeaders(h, "claude-sonnet-4-5-thinking", req); err != nil {
+		t.Fatal(err)
+	}
+	if tc := req.Request.GenerationConfig.ThinkingConfig; tc == nil || tc.ThinkingBudget != 2048 {
+		t.Fatalf("budget header not applied: %+v", tc)
+	}
+
+	h = http.Header{}
+	h.Set(ThinkingBudgetHeader, "0")
+	req = newReq()
+	if err := ApplyThinkingHeaders(h, "claude-sonnet-4-5-thinking", req); err != nil || req.Request.GenerationConfig.ThinkingConfig != nil {
+		t.Fatalf("budget 0 should disable thinking: err=%v cfg=%+v", err, req.Request.GenerationConfig.ThinkingConfig)
+	}
+
+	h = http.Header{}
+	h.Set(ThinkingLevelHeader, "Low")
+	req = &vertex.Request{}
+	if err := ApplyThinkingHeaders(h, "gemini-3-pro-high", req); err != nil {
+		t.Fatal(err)
+	}
+	if tc := req.Request.GenerationConfig.ThinkingConfig; tc == nil || tc.ThinkingLevel != "low" || tc.ThinkingBudget != 0 {
+		t.Fatalf("level header not applied: %+v", tc)
+	}
+
+	for _, bad := range []http.Header{{ThinkingBudgetHeader: {"-5"}}, {ThinkingBudgetHeader: {"lots"}}, {ThinkingLevelHeader: {"extreme"}}} {
+		req = newReq()
+		if err := ApplyThinkingHeaders(bad, "claude-sonnet-4-5-thinking", req); err == nil {
+			t.Fatalf("expected error for %v", bad)
+		}
+		if req.Request.GenerationConfig.ThinkingConfig.ThinkingBudget != 32000 {
+			t.Fatal("invalid header must leave the request untouched")
+		}
+	}
+
+	req = newReq()
+	if err := ApplyThinkingHeaders(http.Header{}, "claude-sonnet-4-5-thinking", req); err != nil || req.Request.GenerationConfig.ThinkingConfig.ThinkingBudget != 32000 {
+		t.Fatal("absent headers must be a no-op")
+	}
+}
@@ -0,0 +1,50 @@
+package common
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+
+	"anti2api-golang/refactor/internal/config"
+	"anti2api-golang/refactor/internal/vertex"
+)
+
+// IsUpstreamTimeout 判断 err 是否为上游请求超时：TIMEOUT 触发的 http.Client 超时（包括读取响应体期间）、
+// 响应头超时或请求 context 到期。客户端主动断开（context.Canceled）不属于超时。
+func IsUpstreamTimeout(err error) bool {
+	if err == nil {
+		return false
+	}
+	if errors.Is(err, context.DeadlineExceeded) {
+		return true
+	}
+	var netErr net.Error
+	return errors.As(err, &netErr) && netErr.Timeout()
+}
+
+// TimeoutMessage 返回上游超时时发给客户端的错误信息（包含当前的 TIMEOUT 与调整建议）。
+func TimeoutMessage() string {
+	return fmt.Sprintf("上游请求超时（TIMEOUT=%dms）。长输出或深度思考的请求可调大 TIMEOUT 环境变量，或改用流式请求。", config.Get().TimeoutMs)
+}
+
+// UpstreamErrorMessage 返回生成请求失败时发给客户端的错误信息：上游超时为 TimeoutMessage，其他错误为 err.Error()。
+func UpstreamErrorMessage(err error) string {
+	if IsUpstreamTimeout(err) {
+		return TimeoutMessage()
+	}
+	return err.Error()
+}
+
+// UpstreamFailureStatus 返回生成请求失败时的状态码：上游 API 错误沿用其状态码，上游超时为 504，
+// 其他错误（如没有可用账号、连接失败）为 503。
+func UpstreamFailureStatus(err error) int {
+	if _, ok := err.(*vertex.APIError); ok {
+		return StatusFromVertexError(err)
+	}
+	if IsUpstreamTimeout(err) {
+		return http.StatusGatewayTimeout
+	}
+	return http.StatusServiceUnavailable
+}
@@ -0,0 +1,49 @@
+package common
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+
+	"anti2api-golang/refactor/internal/vertex"
+)
+
+type timeoutErr struct{}
+
+func (timeoutErr) Error() string   { return "i/o timeout" }
+func (timeoutErr) Timeout() bool   { return true }
+func (timeoutErr) Temporary() bool { return true }
+
+func TestUpstreamTimeoutMapping(t *testing.T) {
+	clientTimeout := &url.Error{Op: "Post", URL: "https://example.com", Err: timeoutErr{}}
+	cases := []struct {
+		name    string
+		err     error
+		timeout bool
+		status  int
+	}{
+		{"client timeout", clientTimeout, true, http.StatusGatewayTimeout},
+		{"deadline", context.DeadlineExceeded, true, http.StatusGatewayTimeout},
+		{"canceled", context.Canceled, false, http.StatusServiceUnavailable},
+		{"api error", &vertex.APIError{Status: http.StatusTooManyRequests, Message: "quota"}, false, http.StatusTooManyRequests},
+		{"other", errors.New("没有可用的账号"), false, http.StatusServiceUnavailable},
+	}
+	for _, c := range cases {
+		if got := IsUpstreamTimeout(c.err); got != c.timeout {
+			t.Errorf("%s: IsUpstreamTimeout = %v", c.name, got)
+		}
+		if got := UpstreamFailureStatus(c.err); got != c.status {
+			t.Errorf("%s: UpstreamFailureStatus = %d, want %d", c.name, got, c.status)
+		}
+	}
+
+	if msg := UpstreamErrorMessage(clientTimeout); !strings.Contains(msg, "TIMEOUT") {
+		t.Fatalf("timeout message should suggest TIMEOUT, got %q", msg)
+	}
+	if msg := StreamInterruptedMessage(clientTimeout); !strings.Contains(msg, "TIMEOUT") {
+		t.Fatalf("interrupted stream caused by timeout should suggest TIMEOUT, got %q", msg)
+	}
+}
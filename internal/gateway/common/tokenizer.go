@@ -0,0 +1,110 @@
+package common
+
+import (
+	"unicode"
+
+	jsonpkg "anti2api-golang/refactor/internal/pkg/json"
+	"anti2api-golang/refactor/internal/vertex"
+)
+
+// ApproxTokens 以接近 BPE 分词器（tiktoken cl100k）的方式近似估算文本的 token 数，用于上游未返回 usageMetadata 时的兜底统计。
+// 规则：英文单词（连同前导空格）约 6 个字母一个 token，数字每 3 位一个 token，连续的标点符号约 2 个一个 token，
+// 其余空白段（换行、缩进）各一个 token，中日韩文字每字一个 token，其他字母文字约 2 个字符一个 token，表情等符号各两个 token。
+// 比 EstimateTokens 更贴近真实计数，但逐字符分类，开销较大，只对合并后的完整输出调用。
+func ApproxTokens(s string) int {
+	rs := []rune(s)
+	n := 0
+	for i := 0; i < len(rs); {
+		// 单个空格并入后面的单词（BPE 词表中的 " word"）。
+		if rs[i] == ' ' && i+1 < len(rs) && (tokenClass(rs[i+1]) == classWord || tokenClass(rs[i+1]) == classLetter) {
+			i++
+		}
+		class := tokenClass(rs[i])
+		j := i + 1
+		switch class {
+		case classWord, classDigit, classSpace, classLetter, classPunct:
+			for j < len(rs) && tokenClass(rs[j]) == class {
+				j++
+			}
+		}
+		switch run := j - i; class {
+		case classWord:
+			n += 1 + (run-1)/6
+		case classDigit:
+			n += (run + 2) / 3
+		case classLetter, classPunct:
+			n += (run + 1) / 2
+		case classSymbol:
+			n += 2
+		default: // classSpace、classCJK
+			n++
+		}
+		i = j
+	}
+	return n
+}
+
+const (
+	classWord   = iota // ASCII 字母与下划线
+	classDigit         // ASCII 数字
+	classSpace         // 空白
+	classCJK           // 中日韩文字
+	classLetter        // 其他字母文字（西里尔、带变音符号的拉丁字母等）
+	classPunct         // ASCII 标点与符号
+	classSymbol        // 表情等其他符号
+)
+
+func tokenClass(r rune) int {
+	switch {
+	case r < 0x80 && (unicode.IsLetter(r) || r == '_'):
+		return classWord
+	case r >= '0' && r <= '9':
+		return classDigit
+	case unicode.IsSpace(r):
+		return classSpace
+	case unicode.In(r, unicode.Han, unicode.Hiragana, unicode.Katakana, unicode.Hangul):
+		return classCJK
+	case unicode.IsLetter(r) || unicode.IsMark(r):
+		return classLetter
+	case r < 0x80:
+		return classPunct
+	}
+	return classSymbol
+}
+
+// approxPartsTokens 用 ApproxTokens 估算 parts 中文本与工具调用的 token 数。
+func approxPartsTokens(parts []vertex.Part) int {
+	n := 0
+	for _, p := range parts {
+		n += ApproxTokens(p.Text)
+		if p.FunctionCall != nil {
+			s, _ := jsonpkg.MarshalString(p.FunctionCall.Args)
+			n += ApproxTokens(p.FunctionCall.Name) + ApproxTokens(s)
+		}
+	}
+	return n
+}
+
+// FillUsage 补全上游缺失或为 0 的用量：输入 token 按请求内容估算，输出 token 取 outputEstimate。
+// 返回补全后的副本（u 不变）以及是否包含估算值；u 中已有的非零计数保持不变。
+func FillUsage(req *vertex.Request, u *vertex.UsageMetadata, outputEstimate int) (*vertex.UsageMetadata, bool) {
+	out := vertex.UsageMetadata{}
+	if u != nil {
+		out = *u
+	}
+	estimated := false
+	if out.PromptTokenCount == 0 {
+		if n := EstimateRequestTokens(req); n > 0 {
+			out.PromptTokenCount = n
+			estimated = true
+		}
+	}
+	if out.CandidatesTokenCount == 0 && out.ThoughtsTokenCount == 0 && outputEstimate > 0 {
+		out.CandidatesTokenCount = outputEstimate
+		estimated = true
+	}
+	if estimated || out.TotalTokenCount == 0 {
+		out.TotalTokenCount = max(out.TotalTokenCount, out.PromptTokenCount+out.CandidatesTokenCount+out.ThoughtsTokenCount)
+	}
+	return &out, estimated
+}
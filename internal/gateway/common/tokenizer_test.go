@@ -0,0 +1,53 @@
+package common
+
+import (
+	"testing"
+
+	"anti2api-golang/refactor/internal/vertex"
+)
+
+func TestApproxTokens(t *testing.T) {
+	cases := map[string]int{
+		"":                       0,
+		"Hello, world!":          4,
+		"The quick brown fox":    4,
+		"internationalization":   4,
+		"12345":                  2,
+		"你好世界":                   4,
+		"line1\nline2":           5,
+		"    return x":           3,
+		"Привет мир":             5,
+		"🙂":                      2,
+		`{"name":"get_weather"}`: 7,
+	}
+	for in, want := range cases {
+		if got := ApproxTokens(in); got != want {
+			t.Errorf("ApproxTokens(%q) = %d, want %d", in, got, want)
+		}
+	}
+}
+
+func TestFillUsage(t *testing.T) {
+	req := &vertex.Request{}
+	req.Request.Contents = []vertex.Content{{Role: "user", Parts: []vertex.Part{{Text: "abcdefghijklmnop"}}}}
+
+	u, estimated := FillUsage(req, nil, 7)
+	if !estimated || u.PromptTokenCount != 4 || u.CandidatesTokenCount != 7 || u.TotalTokenCount != 11 {
+		t.Fatalf("missing usage: %+v estimated=%v", u, estimated)
+	}
+
+	// 只有输入计数：补全输出，不改动已有的值。
+	partial := &vertex.UsageMetadata{PromptTokenCount: 10, TotalTokenCount: 10}
+	u, estimated = FillUsage(req, partial, 5)
+	if !estimated || u.PromptTokenCount != 10 || u.CandidatesTokenCount != 5 || u.TotalTokenCount != 15 {
+		t.Fatalf("partial usage: %+v estimated=%v", u, estimated)
+	}
+	if partial.CandidatesTokenCount != 0 {
+		t.Fatal("FillUsage must not modify its input")
+	}
+
+	full := &vertex.UsageMetadata{PromptTokenCount: 10, CandidatesTokenCount: 2, TotalTokenCount: 12}
+	if u, estimated = FillUsage(req, full, 50); estimated || *u != *full {
+		t.Fatalf("complete usage should be kept: %+v estimated=%v", u, estimated)
+	}
+}
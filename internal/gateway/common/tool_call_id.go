@@ -0,0 +1,84 @@
+package common
+
+import (
+	"strings"
+
+	"anti2api-golang/refactor/internal/signature"
+)
+
+// minToolCallIDPrefix 为按前缀匹配截断 ID 时要求的最短长度，过短的前缀（如 "call_"）不足以区分不同调用。
+const minToolCallIDPrefix = 8
+
+// ToolCallNormalizer 在转换一次请求时，把客户端在多轮之间重新生成或截断的 tool_call ID 归一化为本服务首次下发的规范 ID，
+// 使签名查找（LookupByToolCallID）与 FindFunctionName 在后续处理中按规范 ID 命中。
+// 须按消息顺序调用：先对 assistant 历史中的工具调用调用 Call，再对引用它们的工具结果调用 Result。
+type ToolCallNormalizer struct {
+	sigs    *signature.Manager
+	aliases map[string]string   // 客户端 ID → 规范 ID
+	seen    map[string]struct{} // 本次请求中已出现的工具调用 ID（归一化后）
+	order   []string
+}
+
+func NewToolCallNormalizer(sigs *signature.Manager) *ToolCallNormalizer {
+	return &ToolCallNormalizer{sigs: sigs, aliases: make(map[string]string), seen: make(map[string]struct{})}
+}
+
+// Call 归一化 assistant 历史中的一次工具调用：ID 能直接查到签名时保持不变；
+// 否则按函数名 + 参数哈希（signature.CallKey）模糊匹配首次下发时保存的条目，改用其 ID 并记录别名。
+func (n *ToolCallNormalizer) Call(id, name string, args map[string]any) string {
+	canonical := id
+	if _, ok := n.sigs.LookupByToolCallID(id); id == "" || !ok {
+		if e, ok := n.sigs.LookupByCallKey(signature.CallKey(name, args)); ok && e.ToolCallID != id {
+			// 同一请求中重复的相同调用只归一化第一次，避免出现两个 ID 相同的 functionCall。
+			if _, dup := n.seen[e.ToolCallID]; !dup {
+				canonical = e.ToolCallID
+				if id != "" {
+					n.aliases[id] = canonical
+				}
+			}
+		}
+	}
+	if canonical != "" {
+		if _, dup := n.seen[canonical]; !dup {
+			n.seen[canonical] = struct{}{}
+			n.order = append(n.order, canonical)
+		}
+	}
+	return canonical
+}
+
+// Result 归一化工具结果引用的 ID：先查 Call 记录的别名，再精确匹配已出现的工具调用，
+// 最后按前缀匹配（一方为另一方的前缀，用于客户端截断 ID 的情况），仅在唯一命中时采用。
+func (n *ToolCallNormalizer) Result(id string) string {
+	if id == "" {
+		return id
+	}
+	if canonical, ok := n.aliases[id]; ok {
+		return canonical
+	}
+	if _, ok := n.seen[id]; ok {
+		return id
+	}
+	match := ""
+	for _, known := range n.order {
+		if !prefixMatch(id, known) {
+			continue
+		}
+		if match != "" {
+			return id
+		}
+		match = known
+	}
+	if match == "" {
+		return id
+	}
+	n.aliases[id] = match
+	return match
+}
+
+func prefixMatch(a, b string) bool {
+	if len(a) > len(b) {
+		a, b = b, a
+	}
+	return len(a) >= minToolCallIDPrefix && strings.HasPrefix(b, a)
+}
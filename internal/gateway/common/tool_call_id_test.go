@@ -0,0 +1,43 @@
+package common
+
+import (
+	"testing"
+
+	"anti2api-golang/refactor/internal/config"
+	"anti2api-golang/refactor/internal/signature"
+)
+
+func TestToolCallNormalizer(t *testing.T) {
+	c := config.Get()
+	old := c.DataDir
+	c.DataDir = t.TempDir()
+	t.Cleanup(func() {
+		signature.DropTenant("normalizer")
+		c.DataDir = old
+	})
+
+	sigs := signature.GetManagerFor("normalizer")
+	args := map[string]any{"path": "/tmp/a.txt", "limit": float64(10)}
+	sigs.SaveToolCall("req", "toolu_canonical_0001", signature.CallKey("read_file", args), "sig", "", "gemini-2.5-pro")
+
+	n := NewToolCallNormalizer(sigs)
+	// 键顺序不同的相同参数应命中同一条目。
+	if got := n.Call("call_regenerated", "read_file", map[string]any{"limit": float64(10), "path": "/tmp/a.txt"}); got != "toolu_canonical_0001" {
+		t.Fatalf("expected canonical id from call key, got %q", got)
+	}
+	if got := n.Result("call_regenerated"); got != "toolu_canonical_0001" {
+		t.Fatalf("expected result to follow the alias, got %q", got)
+	}
+	if got := n.Call("call_other", "read_file", map[string]any{"path": "/tmp/b.txt"}); got != "call_other" {
+		t.Fatalf("unknown call should keep its id, got %q", got)
+	}
+
+	n = NewToolCallNormalizer(sigs)
+	n.Call("toolu_canonical_0001", "read_file", args)
+	if got := n.Result("toolu_canon"); got != "toolu_canonical_0001" {
+		t.Fatalf("expected truncated id to match by prefix, got %q", got)
+	}
+	if got := n.Result("toolu"); got != "toolu" {
+		t.Fatalf("too short prefix should not match, got %q", got)
+	}
+}
@@ -0,0 +1,99 @@
+package common
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"strings"
+	"unicode/utf8"
+
+	"anti2api-golang/refactor/internal/config"
+	jsonpkg "anti2api-golang/refactor/internal/pkg/json"
+	"anti2api-golang/refactor/internal/vertex"
+)
+
+// toolRefSummaryBytes 为引用中保留的工具结果开头的字节数。
+const toolRefSummaryBytes = 512
+
+// ReferenceToolResults 在 TOOL_RESULT_REF_BYTES > 0 时，把 req 中超过该字节数的工具结果（functionResponse）
+// 保存到 req.ToolResultRefs，上游提示中只保留引用 ID、大小与开头摘要，并注入 fetch_tool_result 工具供模型按行读取原文
+// （须在 tools 确定后调用）。引用 ID 由内容哈希得出，客户端每轮重发历史时同一结果得到同一引用，不影响上游的前缀缓存。
+// 请求未声明工具、禁止调用工具或客户端已有同名工具时不做处理。
+func ReferenceToolResults(req *vertex.Request) {
+	threshold := config.Get().ToolResultRefBytes
+	if threshold <= 0 || req == nil || len(req.Request.Tools) == 0 {
+		return
+	}
+	var fcc *vertex.FunctionCallingConfig
+	if req.Request.ToolConfig != nil {
+		fcc = req.Request.ToolConfig.FunctionCallingConfig
+	}
+	if fcc != nil && strings.EqualFold(fcc.Mode, "NONE") {
+		return
+	}
+	for _, t := range req.Request.Tools {
+		for _, d := range t.FunctionDeclarations {
+			if d.Name == vertex.ToolResultFetchName {
+				return
+			}
+		}
+	}
+
+	refs := make(map[string]string)
+	for i := range req.Request.Contents {
+		parts := req.Request.Contents[i].Parts
+		for j := range parts {
+			fr := parts[j].FunctionResponse
+			if fr == nil {
+				continue
+			}
+			text := toolResultText(fr.Response)
+			if len(text) <= threshold {
+				continue
+			}
+			sum := sha256.Sum256([]byte(text))
+			ref := "tr_" + hex.EncodeToString(sum[:8])
+			refs[ref] = text
+			parts[j].FunctionResponse = &vertex.FunctionResponse{ID: fr.ID, Name: fr.Name, Response: map[string]any{
+				"ref":     ref,
+				"bytes":   len(text),
+				"lines":   strings.Count(strings.TrimSuffix(text, "\n"), "\n") + 1,
+				"summary": headBytes(text, toolRefSummaryBytes),
+				"note":    "Output stored server-side; call " + vertex.ToolResultFetchName + " with this ref to read more lines.",
+			}}
+		}
+	}
+	if len(refs) == 0 {
+		return
+	}
+	req.ToolResultRefs = refs
+	req.Request.Tools = append(req.Request.Tools, vertex.Tool{FunctionDeclarations: []vertex.FunctionDeclaration{vertex.ToolResultFetchDeclaration()}})
+	if fcc != nil && len(fcc.AllowedFunctionNames) > 0 {
+		fcc.AllowedFunctionNames = append(fcc.AllowedFunctionNames, vertex.ToolResultFetchName)
+	}
+}
+
+// toolResultText 返回工具结果的文本：只有 output / error 一个文本字段时取该文本，否则为整个结果的 JSON。
+func toolResultText(resp map[string]any) string {
+	if len(resp) == 1 {
+		for _, key := range []string{"output", "error"} {
+			if s, ok := resp[key].(string); ok {
+				return s
+			}
+		}
+	}
+	b, err := jsonpkg.Marshal(resp)
+	if err != nil {
+		return ""
+	}
+	return string(b)
+}
+
+func headBytes(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	for n > 0 && !utf8.RuneStart(s[n]) {
+		n--
+	}
+	return s[:n] + "…"
+}
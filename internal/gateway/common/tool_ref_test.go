@@ -0,0 +1,57 @@
+package common
+
+import (
+	"strings"
+	"testing"
+
+	"anti2api-golang/refactor/internal/config"
+	"anti2api-golang/refactor/internal/vertex"
+)
+
+func TestReferenceToolResults(t *testing.T) {
+	cfg := config.Get()
+	old := cfg.ToolResultRefBytes
+	t.Cleanup(func() { cfg.ToolResultRefBytes = old })
+	cfg.ToolResultRefBytes = 100
+
+	big := strings.Repeat("line\n", 50)
+	newReq := func() *vertex.Request {
+		return &vertex.Request{Request: vertex.InnerReq{
+			Tools: []vertex.Tool{{FunctionDeclarations: []vertex.FunctionDeclaration{{Name: "read_file"}}}},
+			Contents: []vertex.Content{
+				{Role: "model", Parts: []vertex.Part{{FunctionCall: &vertex.FunctionCall{ID: "c1", Name: "read_file"}}}},
+				{Role: "user", Parts: []vertex.Part{
+					{FunctionResponse: &vertex.FunctionResponse{ID: "c1", Name: "read_file", Response: map[string]any{"output": big}}},
+					{FunctionResponse: &vertex.FunctionResponse{ID: "c2", Name: "read_file", Response: map[string]any{"output": "small"}}},
+				}},
+			},
+		}}
+	}
+
+	req := newReq()
+	ReferenceToolResults(req)
+	resp := req.Request.Contents[1].Parts[0].FunctionResponse
+	ref, _ := resp.Response["ref"].(string)
+	if ref == "" || req.ToolResultRefs[ref] != big || resp.Response["lines"] != 50 || resp.ID != "c1" {
+		t.Fatalf("expected large result to be referenced, got %v", resp.Response)
+	}
+	if req.Request.Contents[1].Parts[1].FunctionResponse.Response["output"] != "small" {
+		t.Fatalf("small result should stay inline")
+	}
+	if len(req.Request.Tools) != 2 || req.Request.Tools[1].FunctionDeclarations[0].Name != vertex.ToolResultFetchName {
+		t.Fatalf("expected fetch tool to be injected, got %+v", req.Request.Tools)
+	}
+
+	again := newReq()
+	ReferenceToolResults(again)
+	if again.Request.Contents[1].Parts[0].FunctionResponse.Response["ref"] != ref {
+		t.Fatalf("ref should be stable across requests")
+	}
+
+	noTools := newReq()
+	noTools.Request.Tools = nil
+	ReferenceToolResults(noTools)
+	if noTools.ToolResultRefs != nil || noTools.Request.Contents[1].Parts[0].FunctionResponse.Response["output"] != big {
+		t.Fatalf("requests without tools should be left unchanged")
+	}
+}
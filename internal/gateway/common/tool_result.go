@@ -0,0 +1,69 @@
+package common
+
+import (
+	"fmt"
+	"strings"
+	"unicode/utf8"
+
+	"anti2api-golang/refactor/internal/config"
+	jsonpkg "anti2api-golang/refactor/internal/pkg/json"
+)
+
+// ToolResultResponse 构造 functionResponse.response：key 为结果字段名（"output" 或 "error"）。
+// 开启 STRUCTURED_TOOL_RESULTS 且工具输出是 JSON 对象时，"output" 直接使用该对象（Gemini 对结构化结果的理解更好），
+// "error" 及 JSON 数组放在 key 下；其余文本（以及超出 TOOL_RESULT_MAX_BYTES、无法结构化截断的 JSON）按原样截断后放在 key 下。
+func ToolResultResponse(key, text string) map[string]any {
+	cfg := config.Get()
+	if v, ok := structuredToolResult(text, cfg.StructuredToolResults, cfg.ToolResultMaxBytes); ok {
+		if obj, isObj := v.(map[string]any); isObj && key == "output" {
+			return obj
+		}
+		return map[string]any{key: v}
+	}
+	return map[string]any{key: truncateHeadTail(text, cfg.ToolResultMaxBytes)}
+}
+
+func structuredToolResult(text string, enabled bool, maxBytes int) (any, bool) {
+	if !enabled || (maxBytes > 0 && len(text) > maxBytes) {
+		return nil, false
+	}
+	trimmed := strings.TrimSpace(text)
+	if trimmed == "" || (trimmed[0] != '{' && trimmed[0] != '[') {
+		return nil, false
+	}
+	var v any
+	if err := jsonpkg.UnmarshalString(trimmed, &v); err != nil {
+		return nil, false
+	}
+	switch v.(type) {
+	case map[string]any, []any:
+		return v, true
+	}
+	return nil, false
+}
+
+// TruncateToolResult 按 TOOL_RESULT_MAX_BYTES 截断过大的工具输出：保留头部和尾部，中间插入截断提示。
+func TruncateToolResult(s string) string {
+	return truncateHeadTail(s, config.Get().ToolResultMaxBytes)
+}
+
+func truncateHeadTail(s string, maxBytes int) string {
+	if maxBytes <= 0 || len(s) <= maxBytes {
+		return s
+	}
+
+	// 头部保留 2/3，尾部保留 1/3（报错信息、汇总通常在末尾）。
+	headLen := maxBytes * 2 / 3
+	tailLen := maxBytes - headLen
+	for headLen > 0 && !utf8.RuneStart(s[headLen]) {
+		headLen--
+	}
+	tailStart := len(s) - tailLen
+	for tailStart < len(s) && !utf8.RuneStart(s[tailStart]) {
+		tailStart++
+	}
+
+	omitted := tailStart - headLen
+	notice := fmt.Sprintf("\n\n[... tool output truncated: %d of %d bytes omitted ...]\n\n", omitted, len(s))
+	return s[:headLen] + notice + s[tailStart:]
+}
@@ -0,0 +1,68 @@
+package common
+
+import (
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+func TestTruncateHeadTail_Disabled(t *testing.T) {
+	s := strings.Repeat("a", 100)
+	if got := truncateHeadTail(s, 0); got != s {
+		t.Fatalf("expected no truncation when limit is 0")
+	}
+	if got := truncateHeadTail(s, 100); got != s {
+		t.Fatalf("expected no truncation when within limit")
+	}
+}
+
+func TestTruncateHeadTail_KeepsHeadAndTail(t *testing.T) {
+	s := "HEAD" + strings.Repeat("x", 1000) + "TAIL"
+	got := truncateHeadTail(s, 60)
+	if !strings.HasPrefix(got, "HEAD") || !strings.HasSuffix(got, "TAIL") {
+		t.Fatalf("expected head and tail to be kept, got %q", got)
+	}
+	if !strings.Contains(got, "tool output truncated: 948 of 1008 bytes omitted") {
+		t.Fatalf("expected truncation notice, got %q", got)
+	}
+}
+
+func TestTruncateHeadTail_RespectsUTF8Boundaries(t *testing.T) {
+	s := strings.Repeat("工具输出", 100)
+	got := truncateHeadTail(s, 50)
+	if !utf8.ValidString(got) {
+		t.Fatalf("expected valid UTF-8 after truncation, got %q", got)
+	}
+}
+
+func TestStructuredToolResult(t *testing.T) {
+	if v, ok := structuredToolResult(` {"temp": 21, "unit": "C"} `, true, 0); !ok || v.(map[string]any)["unit"] != "C" {
+		t.Fatalf("expected JSON object to be structured, got %v %v", v, ok)
+	}
+	if v, ok := structuredToolResult(`[1, 2]`, true, 0); !ok || len(v.([]any)) != 2 {
+		t.Fatalf("expected JSON array to be structured, got %v %v", v, ok)
+	}
+	for _, s := range []string{"plain text", "42", `"quoted"`, `{"broken": `, ""} {
+		if _, ok := structuredToolResult(s, true, 0); ok {
+			t.Fatalf("expected %q to stay text", s)
+		}
+	}
+	if _, ok := structuredToolResult(`{"a": 1}`, false, 0); ok {
+		t.Fatalf("expected structured results to be disabled")
+	}
+	if _, ok := structuredToolResult(`{"a": "0123456789"}`, true, 10); ok {
+		t.Fatalf("expected oversized JSON to fall back to truncated text")
+	}
+}
+
+func TestToolResultResponse(t *testing.T) {
+	if got := ToolResultResponse("output", `{"ok": true}`); got["ok"] != true || len(got) != 1 {
+		t.Fatalf("expected JSON object to be used as response, got %v", got)
+	}
+	if got := ToolResultResponse("error", `{"code": 1}`); got["error"].(map[string]any)["code"] != float64(1) {
+		t.Fatalf("expected error object under error key, got %v", got)
+	}
+	if got := ToolResultResponse("output", "done"); got["output"] != "done" {
+		t.Fatalf("expected text under output key, got %v", got)
+	}
+}
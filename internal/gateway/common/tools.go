@@ -0,0 +1,64 @@
+package common
+
+import (
+	"fmt"
+	"strings"
+
+	"anti2api-golang/refactor/internal/config"
+	"anti2api-golang/refactor/internal/logger"
+	jsonpkg "anti2api-golang/refactor/internal/pkg/json"
+	"anti2api-golang/refactor/internal/vertex"
+)
+
+// PrepareTools 整理发往上游的工具声明：去掉完全相同（名称、描述与参数 schema 均一致）的重复 functionDeclaration，
+// 按 MAX_TOOLS 限制声明数量（超出时返回列出多余工具名称的错误），MERGE_TOOL_DECLARATIONS 开启时合并为单个 vertex.Tool。
+// 同名但定义不同的声明原样保留，由上游报告冲突。
+func PrepareTools(tools []vertex.Tool) ([]vertex.Tool, error) {
+	if len(tools) == 0 {
+		return tools, nil
+	}
+	cfg := config.Get()
+
+	seen := make(map[string]bool)
+	var decls []vertex.FunctionDeclaration
+	out := make([]vertex.Tool, 0, len(tools))
+	dropped := 0
+	for _, t := range tools {
+		kept := t.FunctionDeclarations[:0:0]
+		for _, fd := range t.FunctionDeclarations {
+			key := declarationKey(fd)
+			if seen[key] {
+				dropped++
+				continue
+			}
+			seen[key] = true
+			kept = append(kept, fd)
+			decls = append(decls, fd)
+		}
+		if len(kept) > 0 || len(t.FunctionDeclarations) == 0 {
+			t.FunctionDeclarations = kept
+			out = append(out, t)
+		}
+	}
+	if dropped > 0 {
+		logger.Debug("已去除 %d 个重复的工具声明", dropped)
+	}
+
+	if cfg.MaxTools > 0 && len(decls) > cfg.MaxTools {
+		names := make([]string, 0, len(decls)-cfg.MaxTools)
+		for _, fd := range decls[cfg.MaxTools:] {
+			names = append(names, fd.Name)
+		}
+		return nil, fmt.Errorf("请求包含 %d 个工具（已去除重复声明），超过 MAX_TOOLS=%d 的上限；超出的工具：%s", len(decls), cfg.MaxTools, strings.Join(names, ", "))
+	}
+
+	if cfg.MergeToolDeclarations && len(out) > 1 {
+		return []vertex.Tool{{FunctionDeclarations: decls}}, nil
+	}
+	return out, nil
+}
+
+func declarationKey(fd vertex.FunctionDeclaration) string {
+	params, _ := jsonpkg.MarshalString(fd.Parameters)
+	return fd.Name + "\x00" + fd.Description + "\x00" + params
+}
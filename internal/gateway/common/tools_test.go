@@ -0,0 +1,63 @@
+package common
+
+import (
+	"strings"
+	"testing"
+
+	"anti2api-golang/refactor/internal/config"
+	"anti2api-golang/refactor/internal/vertex"
+)
+
+func setToolLimits(t *testing.T, maxTools int, merge bool) {
+	t.Helper()
+	c := config.Get()
+	oldMax, oldMerge := c.MaxTools, c.MergeToolDeclarations
+	c.MaxTools, c.MergeToolDeclarations = maxTools, merge
+	t.Cleanup(func() { c.MaxTools, c.MergeToolDeclarations = oldMax, oldMerge })
+}
+
+func toolDecl(name, desc string) vertex.Tool {
+	return vertex.Tool{FunctionDeclarations: []vertex.FunctionDeclaration{{
+		Name:        name,
+		Description: desc,
+		Parameters:  map[string]any{"type": "object", "properties": map[string]any{"q": map[string]any{"type": "string"}}},
+	}}}
+}
+
+func TestPrepareTools_Dedup(t *testing.T) {
+	setToolLimits(t, 0, false)
+	tools := []vertex.Tool{toolDecl("a", "x"), toolDecl("b", "y"), toolDecl("a", "x"), toolDecl("a", "other")}
+	out, err := PrepareTools(tools)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(out) != 3 {
+		t.Fatalf("got %d tools, want 3 (identical duplicate removed, differing definition kept)", len(out))
+	}
+	if out[2].FunctionDeclarations[0].Description != "other" {
+		t.Fatalf("unexpected order: %+v", out)
+	}
+}
+
+func TestPrepareTools_MaxTools(t *testing.T) {
+	setToolLimits(t, 2, false)
+	tools := []vertex.Tool{toolDecl("a", ""), toolDecl("a", ""), toolDecl("b", ""), toolDecl("c", ""), toolDecl("d", "")}
+	_, err := PrepareTools(tools)
+	if err == nil {
+		t.Fatal("expected an error when exceeding MAX_TOOLS")
+	}
+	if !strings.Contains(err.Error(), "4 个工具") || !strings.Contains(err.Error(), "c, d") {
+		t.Fatalf("error should report the count and overflow tools: %v", err)
+	}
+}
+
+func TestPrepareTools_Merge(t *testing.T) {
+	setToolLimits(t, 0, true)
+	out, err := PrepareTools([]vertex.Tool{toolDecl("a", ""), toolDecl("b", ""), toolDecl("b", "")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(out) != 1 || len(out[0].FunctionDeclarations) != 2 {
+		t.Fatalf("tools not merged: %+v", out)
+	}
+}
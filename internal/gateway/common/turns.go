@@ -0,0 +1,50 @@
+package common
+
+import (
+	"fmt"
+	"sync/atomic"
+
+	"anti2api-golang/refactor/internal/config"
+	"anti2api-golang/refactor/internal/vertex"
+)
+
+// TooManyTurnsCode 为超过 MAX_TURNS 时 OpenAI 错误中的 error.code。
+const TooManyTurnsCode = "too_many_turns"
+
+// TurnStats 为对话轮次的计数快照。
+type TurnStats struct {
+	// Limit 为当前的 MAX_TURNS（0 表示不限制）。
+	Limit int `json:"limit"`
+	// Rejected 为进程启动以来因超过上限被拒绝的请求数。
+	Rejected int64 `json:"rejected"`
+	// MaxSeen 为进程启动以来单个请求出现过的最大轮次（包括被拒绝的请求）。
+	MaxSeen int64 `json:"maxSeen"`
+}
+
+var (
+	turnsRejected atomic.Int64
+	turnsMaxSeen  atomic.Int64
+)
+
+// Turns 返回对话轮次的计数。
+func Turns() TurnStats {
+	return TurnStats{Limit: config.Get().MaxTurns, Rejected: turnsRejected.Load(), MaxSeen: turnsMaxSeen.Load()}
+}
+
+// CheckTurnLimit 记录 req 的对话轮次（contents 条目数），超过 MAX_TURNS 时返回错误（网关返回 400），
+// 避免失控的 agent 循环把请求累积到数百轮。
+func CheckTurnLimit(req *vertex.Request) error {
+	n := int64(len(req.Request.Contents))
+	for {
+		seen := turnsMaxSeen.Load()
+		if n <= seen || turnsMaxSeen.CompareAndSwap(seen, n) {
+			break
+		}
+	}
+	limit := config.Get().MaxTurns
+	if limit <= 0 || n <= int64(limit) {
+		return nil
+	}
+	turnsRejected.Add(1)
+	return fmt.Errorf("请求包含 %d 个对话轮次，超过 MAX_TURNS=%d 的上限；请压缩或截断对话历史后重试", n, limit)
+}
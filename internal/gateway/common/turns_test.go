@@ -0,0 +1,40 @@
+package common
+
+import (
+	"strings"
+	"testing"
+
+	"anti2api-golang/refactor/internal/config"
+	"anti2api-golang/refactor/internal/vertex"
+)
+
+func TestCheckTurnLimit(t *testing.T) {
+	c := config.Get()
+	old := c.MaxTurns
+	t.Cleanup(func() { c.MaxTurns = old })
+
+	req := &vertex.Request{}
+	req.Request.Contents = make([]vertex.Content, 5)
+
+	c.MaxTurns = 0
+	before := Turns()
+	if err := CheckTurnLimit(req); err != nil {
+		t.Fatalf("no limit configured, got %v", err)
+	}
+	if Turns().MaxSeen < 5 {
+		t.Fatalf("expected max seen to be recorded, got %+v", Turns())
+	}
+
+	c.MaxTurns = 5
+	if err := CheckTurnLimit(req); err != nil {
+		t.Fatalf("at the limit should pass, got %v", err)
+	}
+	c.MaxTurns = 4
+	err := CheckTurnLimit(req)
+	if err == nil || !strings.Contains(err.Error(), "MAX_TURNS=4") {
+		t.Fatalf("expected turn limit error, got %v", err)
+	}
+	if got := Turns(); got.Rejected != before.Rejected+1 || got.Limit != 4 {
+		t.Fatalf("unexpected stats: %+v", got)
+	}
+}
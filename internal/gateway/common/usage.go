@@ -0,0 +1,133 @@
+package common
+
+import (
+	"context"
+	"unicode/utf8"
+
+	"anti2api-golang/refactor/internal/credential"
+	"anti2api-golang/refactor/internal/logger"
+	"anti2api-golang/refactor/internal/middleware"
+	jsonpkg "anti2api-golang/refactor/internal/pkg/json"
+	"anti2api-golang/refactor/internal/usage"
+	"anti2api-golang/refactor/internal/vertex"
+)
+
+// EstimateTokens 粗略估算文本的 token 数：ASCII 约 4 字节一个 token，其他字符（中日韩文字等）约一个字符一个 token。
+func EstimateTokens(s string) int {
+	ascii, other := 0, 0
+	for _, r := range s {
+		if r < utf8.RuneSelf {
+			ascii++
+		} else {
+			other++
+		}
+	}
+	return (ascii+3)/4 + other
+}
+
+// EstimateRequestTokens 估算请求（系统指令与 contents 中的文本、工具调用与结果）的输入 token 数。
+func EstimateRequestTokens(req *vertex.Request) int {
+	if req == nil {
+		return 0
+	}
+	n := 0
+	if si := req.Request.SystemInstruction; si != nil {
+		for _, p := range si.Parts {
+			n += EstimateTokens(p.Text)
+		}
+	}
+	for _, c := range req.Request.Contents {
+		n += estimatePartsTokens(c.Parts)
+	}
+	return n
+}
+
+func estimatePartsTokens(parts []vertex.Part) int {
+	n := 0
+	for _, p := range parts {
+		n += EstimateTokens(p.Text)
+		if p.FunctionCall != nil {
+			s, _ := jsonpkg.MarshalString(p.FunctionCall.Args)
+			n += EstimateTokens(p.FunctionCall.Name) + EstimateTokens(s)
+		}
+		if p.FunctionResponse != nil {
+			s, _ := jsonpkg.MarshalString(p.FunctionResponse.Response)
+			n += EstimateTokens(s)
+		}
+	}
+	return n
+}
+
+// EstimateStreamOutput 按流式结果中合并后的正文、思考内容与工具调用估算输出 token 数（见 ApproxTokens）。
+func EstimateStreamOutput(result *vertex.StreamResult) int {
+	if result == nil {
+		return 0
+	}
+	n := ApproxTokens(result.Text) + ApproxTokens(result.Thinking)
+	for _, tc := range result.ToolCalls {
+		s, _ := jsonpkg.MarshalString(tc.Args)
+		n += ApproxTokens(tc.Name) + ApproxTokens(s)
+	}
+	return n
+}
+
+// RecordStreamUsage 记录一次流式生成的用量。last 为最后收到的 usageMetadata，outputEstimate 为按已输出内容估算的输出 token 数。
+// 客户端中途断开（ctx 已取消）时 usageMetadata 通常还没有到达或只是部分值，此时取两者中较大的输出数，并在日志中说明；
+// 部分路径的 usageMetadata 不含输出计数，此时同样使用估算值，避免记为 0。
+func RecordStreamUsage(ctx context.Context, endpoint, model string, req *vertex.Request, last *vertex.UsageMetadata, outputEstimate int) {
+	aborted := ctx.Err() != nil
+	rec := usage.Record{Endpoint: endpoint, Model: model, Tenant: middleware.TenantFromContext(ctx), Aborted: aborted}
+	if last != nil {
+		rec.PromptTokens = last.PromptTokenCount
+		rec.CompletionTokens = last.CandidatesTokenCount + last.ThoughtsTokenCount
+	}
+	if rec.PromptTokens == 0 {
+		rec.PromptTokens = EstimateRequestTokens(req)
+		rec.Estimated = true
+	}
+	if (aborted || last == nil || rec.CompletionTokens == 0) && outputEstimate > rec.CompletionTokens {
+		rec.CompletionTokens = outputEstimate
+		rec.Estimated = true
+	}
+	usage.Add(rec)
+	recordAccountUsage(req, rec)
+	if aborted {
+		kind := "实际"
+		if rec.Estimated {
+			kind = "估算"
+		}
+		logger.Info("客户端中断了 %s 流式请求（%s），按%s用量记录：输入 %d / 输出 %d tokens", endpoint, model, kind, rec.PromptTokens, rec.CompletionTokens)
+	}
+}
+
+// RecordResponseUsage 记录一次非流式生成的用量；上游没有返回 usageMetadata（或其中计数为 0）时按请求与响应内容估算。
+func RecordResponseUsage(ctx context.Context, endpoint, model string, req *vertex.Request, resp *vertex.Response) {
+	rec := usage.Record{Endpoint: endpoint, Model: model, Tenant: middleware.TenantFromContext(ctx)}
+	u, estimated := ResponseUsage(req, resp)
+	rec.PromptTokens = u.PromptTokenCount
+	rec.CompletionTokens = u.CandidatesTokenCount + u.ThoughtsTokenCount
+	rec.Estimated = estimated
+	usage.Add(rec)
+	recordAccountUsage(req, rec)
+}
+
+// recordAccountUsage 将用量累计到完成请求的账号（用于 ACCOUNT_DAILY_REQUEST_CAP / ACCOUNT_DAILY_TOKEN_CAP）。
+func recordAccountUsage(req *vertex.Request, rec usage.Record) {
+	if req == nil || req.Account == "" {
+		return
+	}
+	credential.GetStore().RecordUsage(req.Account, rec.PromptTokens+rec.CompletionTokens)
+}
+
+// ResponseUsage 返回非流式响应的用量，缺失的计数按 FillUsage 补全。
+func ResponseUsage(req *vertex.Request, resp *vertex.Response) (*vertex.UsageMetadata, bool) {
+	var u *vertex.UsageMetadata
+	outputEstimate := 0
+	if resp != nil {
+		u = resp.Response.UsageMetadata
+		if len(resp.Response.Candidates) > 0 {
+			outputEstimate = approxPartsTokens(resp.Response.Candidates[0].Content.Parts)
+		}
+	}
+	return FillUsage(req, u, outputEstimate)
+}
@@ -0,0 +1,72 @@
+package common
+
+import (
+	"context"
+	"testing"
+
+	"anti2api-golang/refactor/internal/usage"
+	"anti2api-golang/refactor/internal/vertex"
+)
+
+func TestEstimateTokens(t *testing.T) {
+	cases := map[string]int{
+		"":         0,
+		"abcd":     1,
+		"abcdefgh": 2,
+		"abcde":    2,
+		"你好":       2,
+		"hi 你好":    3,
+	}
+	for in, want := range cases {
+		if got := EstimateTokens(in); got != want {
+			t.Errorf("EstimateTokens(%q) = %d, want %d", in, got, want)
+		}
+	}
+}
+
+func TestRecordStreamUsage_AbortedUsesEstimate(t *testing.T) {
+	usage.Reset()
+	t.Cleanup(usage.Reset)
+
+	req := &vertex.Request{}
+	req.Request.Contents = []vertex.Content{{Role: "user", Parts: []vertex.Part{{Text: "abcdefghijklmnop"}}}}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	// 中断时上游只返回了部分用量：输入以 usageMetadata 为准，输出取两者中较大的值。
+	RecordStreamUsage(ctx, "openai", "m", req, &vertex.UsageMetadata{PromptTokenCount: 10, CandidatesTokenCount: 2}, 7)
+	// 没有任何 usageMetadata：输入与输出都按内容估算。
+	RecordStreamUsage(ctx, "openai", "m", req, nil, 3)
+
+	got := usage.Snapshot()["m"]
+	want := usage.ModelUsage{Requests: 2, PromptTokens: 10 + 4, CompletionTokens: 7 + 3, Estimated: 2, Aborted: 2}
+	if got != want {
+		t.Fatalf("usage = %+v, want %+v", got, want)
+	}
+}
+
+func TestRecordStreamUsage_CompletedUsesMetadata(t *testing.T) {
+	usage.Reset()
+	t.Cleanup(usage.Reset)
+
+	RecordStreamUsage(context.Background(), "claude", "m", &vertex.Request{}, &vertex.UsageMetadata{PromptTokenCount: 10, CandidatesTokenCount: 5, ThoughtsTokenCount: 3}, 100)
+
+	got := usage.Snapshot()["m"]
+	want := usage.ModelUsage{Requests: 1, PromptTokens: 10, CompletionTokens: 8}
+	if got != want {
+		t.Fatalf("usage = %+v, want %+v", got, want)
+	}
+}
+
+func TestRecordStreamUsage_MetadataWithoutOutputUsesEstimate(t *testing.T) {
+	usage.Reset()
+	t.Cleanup(usage.Reset)
+
+	RecordStreamUsage(context.Background(), "openai", "m", &vertex.Request{}, &vertex.UsageMetadata{PromptTokenCount: 10}, 6)
+
+	got := usage.Snapshot()["m"]
+	want := usage.ModelUsage{Requests: 1, PromptTokens: 10, CompletionTokens: 6, Estimated: 1}
+	if got != want {
+		t.Fatalf("usage = %+v, want %+v", got, want)
+	}
+}
@@ -0,0 +1,53 @@
+package common
+
+import (
+	"strings"
+	"unicode/utf8"
+)
+
+// UTF8Buffer 缓存流式文本末尾不完整的多字节 UTF-8 序列。
+// 上游偶尔会把一个多字节字符拆到相邻两个分片中，直接逐片输出会让严格的客户端看到乱码；
+// 经过 UTF8Buffer 后每次输出的都是合法的 UTF-8，被拆开的字符在下一个分片到达时完整输出。
+// 零值可直接使用。
+type UTF8Buffer struct {
+	pending []byte
+}
+
+// Write 追加 s，返回可以安全输出的部分；末尾不完整的字符留待下次 Write 或 Flush。
+// 中间出现的非法字节替换为 U+FFFD。
+func (b *UTF8Buffer) Write(s string) string {
+	if len(b.pending) == 0 && utf8.ValidString(s) {
+		return s
+	}
+	data := append(b.pending, s...)
+	b.pending = nil
+	cut := incompleteTail(data)
+	if cut < len(data) {
+		b.pending = append([]byte(nil), data[cut:]...)
+	}
+	return strings.ToValidUTF8(string(data[:cut]), "\uFFFD")
+}
+
+// Flush 返回并清空缓存的字节（此时它们已不可能组成完整字符，替换为 U+FFFD）。
+func (b *UTF8Buffer) Flush() string {
+	if len(b.pending) == 0 {
+		return ""
+	}
+	s := strings.ToValidUTF8(string(b.pending), "\uFFFD")
+	b.pending = nil
+	return s
+}
+
+// incompleteTail 返回 data 末尾不完整 UTF-8 序列的起始位置；末尾完整时返回 len(data)。
+func incompleteTail(data []byte) int {
+	for i := 1; i < utf8.UTFMax && i <= len(data); i++ {
+		c := data[len(data)-i]
+		if utf8.RuneStart(c) {
+			if c >= utf8.RuneSelf && !utf8.FullRune(data[len(data)-i:]) {
+				return len(data) - i
+			}
+			break
+		}
+	}
+	return len(data)
+}
@@ -0,0 +1,39 @@
+package common
+
+import (
+	"testing"
+	"unicode/utf8"
+)
+
+func TestUTF8Buffer_JoinsSplitRunes(t *testing.T) {
+	text := "你好，世界 🌍 ok"
+	raw := []byte(text)
+	for split := 1; split < len(raw); split++ {
+		var b UTF8Buffer
+		first := b.Write(string(raw[:split]))
+		second := b.Write(string(raw[split:]))
+		rest := b.Flush()
+		for _, s := range []string{first, second} {
+			if !utf8.ValidString(s) {
+				t.Fatalf("split %d: invalid output %q", split, s)
+			}
+		}
+		if got := first + second + rest; got != text {
+			t.Fatalf("split %d: got %q, want %q", split, got, text)
+		}
+	}
+}
+
+func TestUTF8Buffer_FlushReplacesTruncatedRune(t *testing.T) {
+	var b UTF8Buffer
+	raw := []byte("中")
+	if got := b.Write("a" + string(raw[:2])); got != "a" {
+		t.Fatalf("Write = %q, want %q", got, "a")
+	}
+	if got := b.Flush(); got != "\uFFFD" {
+		t.Fatalf("Flush = %q, want U+FFFD", got)
+	}
+	if got := b.Flush(); got != "" {
+		t.Fatalf("second Flush = %q, want empty", got)
+	}
+}
@@ -1,6 +1,7 @@
 package common
 
 import (
+	"errors"
 	"net/http"
 
 	"anti2api-golang/refactor/internal/vertex"
@@ -10,6 +11,9 @@ func StatusFromVertexError(err error) int {
 	if apiErr, ok := err.(*vertex.APIError); ok {
 		return apiErr.Status
 	}
+	if IsUpstreamTimeout(err) {
+		return http.StatusGatewayTimeout
+	}
 	return http.StatusInternalServerError
 }
 
@@ -29,3 +33,42 @@ func FindFunctionName(contents []vertex.Content, toolCallID string) string {
 	}
 	return ""
 }
+
+// UpstreamHeaderPrefix 为透传给客户端的上游响应头前缀（见 UPSTREAM_HEADERS）。
+const UpstreamHeaderPrefix = "X-Upstream-"
+
+// SetUpstreamHeaders 将非流式请求对应的上游响应头（成功时取自 vresp，失败时取自 err）以 X-Upstream- 前缀写入响应。
+func SetUpstreamHeaders(w http.ResponseWriter, vresp *vertex.Response, err error) {
+	h := vresp.UpstreamHeader()
+	if h == nil {
+		h = upstreamErrorHeader(err)
+	}
+	writeUpstreamHeaders(w, h)
+}
+
+// SetUpstreamStreamHeaders 与 SetUpstreamHeaders 相同，用于流式请求（须在写出响应头之前调用）。
+func SetUpstreamStreamHeaders(w http.ResponseWriter, resp *http.Response, err error) {
+	var h http.Header
+	if resp != nil {
+		h = vertex.SelectUpstreamHeaders(resp.Header)
+	} else {
+		h = upstreamErrorHeader(err)
+	}
+	writeUpstreamHeaders(w, h)
+}
+
+func upstreamErrorHeader(err error) http.Header {
+	var apiErr *vertex.APIError
+	if errors.As(err, &apiErr) {
+		return apiErr.UpstreamHeader
+	}
+	return nil
+}
+
+func writeUpstreamHeaders(w http.ResponseWriter, h http.Header) {
+	for k, values := range h {
+		for _, v := range values {
+			w.Header().Add(UpstreamHeaderPrefix+k, v)
+		}
+	}
+}
@@ -0,0 +1,237 @@
+package common
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"anti2api-golang/refactor/internal/config"
+	"anti2api-golang/refactor/internal/logger"
+	"anti2api-golang/refactor/internal/pkg/id"
+	jsonpkg "anti2api-golang/refactor/internal/pkg/json"
+	"anti2api-golang/refactor/internal/vertex"
+)
+
+// WebSearchName 为模拟服务端搜索工具时注入的函数名（与 Anthropic web_search 工具同名）。
+const WebSearchName = "web_search"
+
+// maxWebSearchResults 为单次搜索返回的结果数上限。
+const maxWebSearchResults = 10
+
+var webSearchClient = &http.Client{Timeout: 15 * time.Second}
+
+// WebSearchOptions 为搜索工具的限制（对应 Anthropic web_search 工具的 max_uses / allowed_domains / blocked_domains）。
+type WebSearchOptions struct {
+	MaxUses        int
+	AllowedDomains []string
+	BlockedDomains []string
+}
+
+// WebSearchResult 为一条搜索结果。
+type WebSearchResult struct {
+	Title   string
+	URL     string
+	Snippet string
+	PageAge string
+}
+
+// WebSearchEnabled 报告是否配置了搜索后端（CLAUDE_WEB_SEARCH）。
+func WebSearchEnabled() bool {
+	backend := strings.ToLower(config.Get().ClaudeWebSearch)
+	return backend != "" && backend != "off"
+}
+
+// WebSearchDeclaration 返回 web_search 的函数声明。
+func WebSearchDeclaration() vertex.FunctionDeclaration {
+	return vertex.FunctionDeclaration{
+		Name:        WebSearchName,
+		Description: "Search the web for up-to-date information. Returns result titles, URLs and snippets.",
+		Parameters: map[string]any{
+			"type": "OBJECT",
+			"properties": map[string]any{
+				"query": map[string]any{"type": "STRING", "description": "The search query."},
+			},
+			"required": []any{"query"},
+		},
+	}
+}
+
+// WebSearchFunction 返回由代理执行 web_search 调用的函数（按 CLAUDE_WEB_SEARCH 选择后端）。调用结果为
+// {"query", "results": [{"title", "url", "snippet", "page_age"}]}，失败时为 {"error_code", "error"}，
+// error_code 取 Anthropic web_search_tool_result_error 的取值。
+func WebSearchFunction(opts WebSearchOptions) vertex.ProxyFunction {
+	var uses atomic.Int32
+	return vertex.ProxyFunction{Visible: true, Call: func(ctx context.Context, req *vertex.Request, accessToken string, args map[string]any) map[string]any {
+		query, _ := args["query"].(string)
+		query = strings.TrimSpace(query)
+		if query == "" {
+			return webSearchError("invalid_tool_input", "query is required")
+		}
+		if opts.MaxUses > 0 && int(uses.Add(1)) > opts.MaxUses {
+			return webSearchError("max_uses_exceeded", fmt.Sprintf("web_search may be used at most %d times in this request", opts.MaxUses))
+		}
+		results, err := webSearch(ctx, req, accessToken, query)
+		if err != nil {
+			logger.Warn("web_search 搜索失败: %v", err)
+			return webSearchError("unavailable", err.Error())
+		}
+		items := make([]any, 0, len(results))
+		for _, r := range results {
+			if !domainAllowed(r.URL, opts) {
+				continue
+			}
+			items = append(items, map[string]any{"title": r.Title, "url": r.URL, "snippet": r.Snippet, "page_age": r.PageAge})
+		}
+		return map[string]any{"query": query, "results": items}
+	}}
+}
+
+func webSearchError(code, msg string) map[string]any {
+	return map[string]any{"error_code": code, "error": msg}
+}
+
+func webSearch(ctx context.Context, req *vertex.Request, accessToken, query string) ([]WebSearchResult, error) {
+	backend := config.Get().ClaudeWebSearch
+	if strings.EqualFold(backend, "google") {
+		return googleSearch(ctx, req, accessToken, query)
+	}
+	return apiSearch(ctx, backend, query)
+}
+
+// googleSearch 用启用 googleSearch grounding 的单独请求（模型为 WEB_SEARCH_MODEL，使用同一账号）检索，
+// 结果取自 groundingMetadata，摘要为引用该来源的回答片段。
+func googleSearch(ctx context.Context, req *vertex.Request, accessToken, query string) ([]WebSearchResult, error) {
+	sreq := &vertex.Request{
+		Project:     req.Project,
+		Model:       config.Get().WebSearchModel,
+		RequestID:   id.RequestID(),
+		RequestType: "agent",
+		UserAgent:   "antigravity",
+		Request: vertex.InnerReq{
+			Contents:  []vertex.Content{{Role: "user", Parts: []vertex.Part{{Text: "Search the web and summarize the most relevant findings for: " + query}}}},
+			Tools:     []vertex.Tool{{GoogleSearch: &vertex.GoogleSearch{}}},
+			SessionID: req.Request.SessionID,
+		},
+	}
+	resp, err := vertex.GenerateContent(ctx, sreq, accessToken)
+	if err != nil {
+		return nil, err
+	}
+	if len(resp.Response.Candidates) == 0 || resp.Response.Candidates[0].GroundingMetadata == nil {
+		return nil, nil
+	}
+	gm := resp.Response.Candidates[0].GroundingMetadata
+	results := make([]WebSearchResult, len(gm.GroundingChunks))
+	for i, c := range gm.GroundingChunks {
+		if c.Web != nil {
+			results[i] = WebSearchResult{Title: c.Web.Title, URL: c.Web.URI}
+		}
+	}
+	for _, s := range gm.GroundingSupports {
+		if len(s.GroundingChunkIndices) == 0 {
+			continue
+		}
+		if i := s.GroundingChunkIndices[0]; i >= 0 && i < len(results) && len(results[i].Snippet) < 1024 {
+			results[i].Snippet = strings.TrimSpace(results[i].Snippet + " " + s.Segment.Text)
+		}
+	}
+	results = slices.DeleteFunc(results, func(r WebSearchResult) bool { return r.URL == "" })
+	return results[:min(len(results), maxWebSearchResults)], nil
+}
+
+// apiSearch 调用 SearXNG 兼容的 JSON 搜索接口：GET endpoint?q=<query>&format=json，
+// 返回 {"results": [{"title", "url", "content", "publishedDate"}]}（也接受 snippet / page_age 字段）。
+func apiSearch(ctx context.Context, endpoint, query string) ([]WebSearchResult, error) {
+	u, err := url.Parse(endpoint)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+		return nil, fmt.Errorf("CLAUDE_WEB_SEARCH 不是有效的搜索接口地址: %q", endpoint)
+	}
+	q := u.Query()
+	q.Set("q", query)
+	if q.Get("format") == "" {
+		q.Set("format", "json")
+	}
+	u.RawQuery = q.Encode()
+	hreq, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	hreq.Header.Set("Accept", "application/json")
+	if key := config.Get().WebSearchAPIKey; key != "" {
+		hreq.Header.Set("Authorization", "Bearer "+key)
+	}
+	resp, err := webSearchClient.Do(hreq)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 4<<20))
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("搜索接口返回 %d", resp.StatusCode)
+	}
+	var out struct {
+		Results []struct {
+			Title         string `json:"title"`
+			URL           string `json:"url"`
+			Content       string `json:"content"`
+			Snippet       string `json:"snippet"`
+			PublishedDate string `json:"publishedDate"`
+			PageAge       string `json:"page_age"`
+		} `json:"results"`
+	}
+	if err := jsonpkg.Unmarshal(body, &out); err != nil {
+		return nil, errors.New("搜索接口返回的不是有效的 JSON")
+	}
+	var results []WebSearchResult
+	for _, r := range out.Results {
+		if r.URL == "" {
+			continue
+		}
+		results = append(results, WebSearchResult{
+			Title:   r.Title,
+			URL:     r.URL,
+			Snippet: headBytes(strings.TrimSpace(cmp.Or(r.Content, r.Snippet)), 1024),
+			PageAge: cmp.Or(r.PageAge, r.PublishedDate),
+		})
+		if len(results) == maxWebSearchResults {
+			break
+		}
+	}
+	return results, nil
+}
+
+// domainAllowed 按 allowed_domains / blocked_domains 过滤结果（域名本身及其子域名均匹配）。
+func domainAllowed(rawURL string, opts WebSearchOptions) bool {
+	if len(opts.AllowedDomains) == 0 && len(opts.BlockedDomains) == 0 {
+		return true
+	}
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return false
+	}
+	host := strings.ToLower(u.Hostname())
+	match := func(domains []string) bool {
+		for _, d := range domains {
+			d = strings.ToLower(strings.TrimPrefix(strings.TrimSpace(d), "."))
+			if d != "" && (host == d || strings.HasSuffix(host, "."+d)) {
+				return true
+			}
+		}
+		return false
+	}
+	if match(opts.BlockedDomains) {
+		return false
+	}
+	return len(opts.AllowedDomains) == 0 || match(opts.AllowedDomains)
+}
@@ -0,0 +1,51 @@
+package common
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"anti2api-golang/refactor/internal/config"
+)
+
+func TestWebSearchFunction_API(t *testing.T) {
+	var gotQuery, gotAuth string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotQuery, gotAuth = r.URL.Query().Get("q"), r.Header.Get("Authorization")
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"results":[
+			{"title":"Go","url":"https://go.dev/","content":"The Go language","publishedDate":"2025-02-11"},
+			{"title":"Spam","url":"https://spam.example.com/x","content":"blocked"},
+			{"title":"No URL","content":"skipped"}]}`))
+	}))
+	defer srv.Close()
+
+	c := config.Get()
+	oldSearch, oldKey := c.ClaudeWebSearch, c.WebSearchAPIKey
+	t.Cleanup(func() { c.ClaudeWebSearch, c.WebSearchAPIKey = oldSearch, oldKey })
+	c.ClaudeWebSearch, c.WebSearchAPIKey = srv.URL+"/search", "k"
+
+	fn := WebSearchFunction(WebSearchOptions{MaxUses: 1, BlockedDomains: []string{"example.com"}})
+	out := fn.Call(context.Background(), nil, "", map[string]any{"query": "golang"})
+	if gotQuery != "golang" || gotAuth != "Bearer k" {
+		t.Fatalf("unexpected upstream request: q=%q auth=%q", gotQuery, gotAuth)
+	}
+	results, _ := out["results"].([]any)
+	if len(results) != 1 {
+		t.Fatalf("expected blocked and URL-less results to be dropped, got %#v", out)
+	}
+	if r := results[0].(map[string]any); r["url"] != "https://go.dev/" || r["snippet"] != "The Go language" || r["page_age"] != "2025-02-11" {
+		t.Fatalf("unexpected result: %#v", r)
+	}
+	if out := fn.Call(context.Background(), nil, "", map[string]any{"query": "again"}); out["error_code"] != "max_uses_exceeded" {
+		t.Fatalf("expected max_uses_exceeded, got %#v", out)
+	}
+}
+
+func TestDomainAllowed(t *testing.T) {
+	opts := WebSearchOptions{AllowedDomains: []string{"go.dev"}}
+	if !domainAllowed("https://pkg.go.dev/x", opts) || domainAllowed("https://notgo.dev/", opts) {
+		t.Fatalf("allowed_domains should match the domain and its subdomains only")
+	}
+}
@@ -8,14 +8,18 @@ import (
 	"strings"
 	"time"
 
-	"anti2api-golang/refactor/internal/config"
 	"anti2api-golang/refactor/internal/credential"
 	gwcommon "anti2api-golang/refactor/internal/gateway/common"
+	"anti2api-golang/refactor/internal/hooks"
 	"anti2api-golang/refactor/internal/logger"
 	httppkg "anti2api-golang/refactor/internal/pkg/http"
 	"anti2api-golang/refactor/internal/pkg/id"
 	jsonpkg "anti2api-golang/refactor/internal/pkg/json"
+	"anti2api-golang/refactor/internal/pkg/memory"
 	"anti2api-golang/refactor/internal/pkg/modelutil"
+	"anti2api-golang/refactor/internal/pkg/spool"
+	"anti2api-golang/refactor/internal/secondary"
+	"anti2api-golang/refactor/internal/transcript"
 	"anti2api-golang/refactor/internal/vertex"
 )
 
@@ -57,137 +61,39 @@ type GeminiImageCfg struct {
 type GeminiResponse struct {
 	Candidates    []vertex.Candidate    `json:"candidates"`
 	UsageMetadata *vertex.UsageMetadata `json:"usageMetadata,omitempty"`
+	ModelVersion  string                `json:"modelVersion,omitempty"`
 }
 
 func toVertexGenerationConfig(model string, cfg *GeminiGenerationConfig) *vertex.GenerationConfig {
-	model = strings.TrimSpace(model)
-	isClaude := modelutil.IsClaude(model)
-	isGemini := modelutil.IsGemini(model)
-	forcedThinking, forced := modelutil.ForcedThinkingConfig(model)
-	isGeminiProImage := modelutil.IsGeminiProImage(model)
-	forcedImageSize, _, forcedImage := modelutil.GeminiProImageSizeConfig(model)
-
 	if cfg == nil {
-		if isClaude {
-			out := &vertex.GenerationConfig{CandidateCount: 1, MaxOutputTokens: modelutil.ClaudeMaxOutputTokens}
-			if forced {
-				out.ThinkingConfig = forcedThinking
-			}
-			return out
-		}
-		if isGemini {
-			out := &vertex.GenerationConfig{CandidateCount: 1, MaxOutputTokens: modelutil.GeminiMaxOutputTokens}
-			if forced {
-				out.ThinkingConfig = forcedThinking
-			}
-			if isGeminiProImage && forcedImage {
-				out.ImageConfig = &vertex.ImageConfig{ImageSize: forcedImageSize}
-			}
-			if modelutil.IsGemini3(model) && !modelutil.IsImageModel(model) {
-				if v, ok := modelutil.ToAPIMediaResolution(config.Get().Gemini3MediaResolution); ok && v != "" {
-					out.MediaResolution = v
-				}
-			}
-			return out
-		}
-		return nil
-	}
-	out := &vertex.GenerationConfig{CandidateCount: cfg.CandidateCount, StopSequences: cfg.StopSequences, MaxOutputTokens: cfg.MaxOutputTokens, TopK: cfg.TopK}
-	out.Temperature = cfg.Temperature
-	out.TopP = cfg.TopP
-	if forced {
-		// Gemini 3 Flash / Claude 4.5：忽略客户端 thinking 参数，由模型名强制决定。
-		out.ThinkingConfig = forcedThinking
-	} else if cfg.ThinkingConfig != nil {
-		if cfg.ThinkingConfig.IncludeThoughts {
-			out.ThinkingConfig = modelutil.ThinkingConfigFromGemini(model, true, cfg.ThinkingConfig.ThinkingBudget, cfg.ThinkingConfig.ThinkingLevel)
+		// 未提供 generationConfig 时仅为 Claude / Gemini 写出默认配置（固定上限、强制 thinking 等）。
+		if !modelutil.IsClaude(model) && !modelutil.IsGemini(model) {
+			return nil
+		}
+		return modelutil.BuildGenerationConfig(model, modelutil.GenerationParams{})
+	}
+	p := modelutil.GenerationParams{
+		CandidateCount:  cfg.CandidateCount,
+		MaxOutputTokens: cfg.MaxOutputTokens,
+		Temperature:     cfg.Temperature,
+		TopP:            cfg.TopP,
+		TopK:            cfg.TopK,
+		StopSequences:   cfg.StopSequences,
+		MediaResolution: cfg.MediaResolution,
+	}
+	if tc := cfg.ThinkingConfig; tc != nil {
+		if tc.IncludeThoughts {
+			p.Thinking = modelutil.ThinkingConfigFromGemini(model, true, tc.ThinkingBudget, tc.ThinkingLevel)
 		} else {
 			// 保持原行为：客户端显式传 includeThoughts=false 时也透传该结构。
-			out.ThinkingConfig = &vertex.ThinkingConfig{
-				IncludeThoughts: false,
-				ThinkingBudget:  cfg.ThinkingConfig.ThinkingBudget,
-				ThinkingLevel:   cfg.ThinkingConfig.ThinkingLevel,
-			}
-		}
-	}
-
-	// Claude models: maxOutputTokens is fixed at 64000.
-	if isClaude {
-		out.MaxOutputTokens = modelutil.ClaudeMaxOutputTokens
-	}
-	// Gemini models: maxOutputTokens is fixed at 65535.
-	if isGemini {
-		out.MaxOutputTokens = modelutil.GeminiMaxOutputTokens
-	}
-
-	// When thinkingBudget is used, ensure it's compatible with maxOutputTokens.
-	if out.ThinkingConfig != nil && out.ThinkingConfig.IncludeThoughts {
-		if out.MaxOutputTokens <= 0 {
-			if isClaude {
-				out.MaxOutputTokens = modelutil.ClaudeMaxOutputTokens
-			} else if isGemini {
-				out.MaxOutputTokens = modelutil.GeminiMaxOutputTokens
-			} else if out.ThinkingConfig.ThinkingBudget > 0 {
-				out.MaxOutputTokens = out.ThinkingConfig.ThinkingBudget + modelutil.ThinkingMaxOutputTokensOverheadTokens
-			} else {
-				out.MaxOutputTokens = 8192
-			}
-		}
-		if out.ThinkingConfig.ThinkingBudget > 0 {
-			if isClaude {
-				maxBudget := out.MaxOutputTokens - modelutil.ThinkingBudgetHeadroomTokens
-				if maxBudget < modelutil.ThinkingBudgetMinTokens {
-					maxBudget = modelutil.ThinkingBudgetMinTokens
-				}
-				if out.ThinkingConfig.ThinkingBudget > maxBudget {
-					out.ThinkingConfig.ThinkingBudget = maxBudget
-				}
-			} else if isGemini && out.MaxOutputTokens <= out.ThinkingConfig.ThinkingBudget {
-				maxBudget := out.MaxOutputTokens - modelutil.ThinkingBudgetHeadroomTokens
-				if maxBudget < modelutil.ThinkingBudgetMinTokens {
-					maxBudget = modelutil.ThinkingBudgetMinTokens
-				}
-				out.ThinkingConfig.ThinkingBudget = maxBudget
-			} else if out.MaxOutputTokens <= out.ThinkingConfig.ThinkingBudget {
-				out.MaxOutputTokens = out.ThinkingConfig.ThinkingBudget + modelutil.ThinkingMaxOutputTokensOverheadTokens
-			}
-		}
-	}
-
-	if isGeminiProImage {
-		var aspectRatio string
-		var imageSize string
-		if cfg.ImageConfig != nil {
-			aspectRatio = strings.TrimSpace(cfg.ImageConfig.AspectRatio)
-			imageSize = strings.TrimSpace(cfg.ImageConfig.ImageSize)
-		}
-		if forcedImage {
-			imageSize = forcedImageSize
-		}
-
-		if aspectRatio != "" || imageSize != "" {
-			out.ImageConfig = &vertex.ImageConfig{}
-			if aspectRatio != "" {
-				out.ImageConfig.AspectRatio = aspectRatio
-			}
-			if imageSize != "" {
-				out.ImageConfig.ImageSize = imageSize
-			}
+			p.Thinking = &vertex.ThinkingConfig{ThinkingBudget: tc.ThinkingBudget, ThinkingLevel: tc.ThinkingLevel}
 		}
 	}
-
-	if modelutil.IsGemini3(model) && !modelutil.IsImageModel(model) {
-		// 客户端 mediaResolution（若提供）优先于全局设置；显式空值/非法值将导致不写出该字段。
-		if cfg.MediaResolution != nil {
-			if v, ok := modelutil.ToAPIMediaResolution(*cfg.MediaResolution); ok && v != "" {
-				out.MediaResolution = v
-			}
-		} else if v, ok := modelutil.ToAPIMediaResolution(config.Get().Gemini3MediaResolution); ok && v != "" {
-			out.MediaResolution = v
-		}
+	if cfg.ImageConfig != nil {
+		p.ImageAspectRatio = cfg.ImageConfig.AspectRatio
+		p.ImageSize = cfg.ImageConfig.ImageSize
 	}
-
-	return out
+	return modelutil.BuildGenerationConfig(model, p)
 }
 
 type GeminiModelsResponse struct {
@@ -202,9 +108,14 @@ type GeminiModel struct {
 	InputTokenLimit            int      `json:"inputTokenLimit,omitempty"`
 	OutputTokenLimit           int      `json:"outputTokenLimit,omitempty"`
 	SupportedGenerationMethods []string `json:"supportedGenerationMethods,omitempty"`
+	Thinking                   bool     `json:"thinking"`
+	// 扩展字段（非 Gemini 官方字段）。
+	InputModalities  []string `json:"inputModalities,omitempty"`
+	OutputModalities []string `json:"outputModalities,omitempty"`
 }
 
-func transformGeminiStreamLine(line string) string {
+// transformGeminiStreamLine 将上游 SSE 行中的 response 解包为 Gemini 原生格式；modelVersion 非空时覆盖其中的 modelVersion。
+func transformGeminiStreamLine(line, modelVersion string) string {
 	if !strings.HasPrefix(line, "data: ") {
 		return line
 	}
@@ -220,6 +131,9 @@ func transformGeminiStreamLine(line string) string {
 	}
 
 	if resp, ok := data["response"].(map[string]any); ok {
+		if modelVersion != "" {
+			resp["modelVersion"] = modelVersion
+		}
 		b, err := jsonpkg.Marshal(resp)
 		if err != nil {
 			return line
@@ -233,6 +147,7 @@ func transformGeminiStreamLine(line string) string {
 func HandleModels(w http.ResponseWriter, r *http.Request) {
 	// Routes:
 	// - GET  /v1beta/models
+	// - GET  /v1beta/models/{model}
 	// - POST /v1beta/models/{model}:generateContent
 	// - POST /v1beta/models/{model}:streamGenerateContent
 	const prefix = "/v1beta/models/"
@@ -259,13 +174,17 @@ func HandleModels(w http.ResponseWriter, r *http.Request) {
 		HandleGenerateContent(w, r)
 		return
 	}
+	if !strings.Contains(rest, ":") && (r.Method == http.MethodGet || r.Method == http.MethodHead) {
+		HandleGetModel(w, r)
+		return
+	}
 
 	http.NotFound(w, r)
 }
 
 func HandleListModels(w http.ResponseWriter, r *http.Request) {
 	if logger.IsClientLogEnabled() {
-		logger.ClientRequestWithHeaders(r.Method, r.URL.Path, r.Header, nil)
+		logger.ClientRequestWithHeaders(r.Method, r.URL.RequestURI(), r.Header, nil)
 	}
 	startTime := time.Now()
 	store := credential.GetStore()
@@ -297,37 +216,17 @@ func HandleListModels(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 	if lastErr != nil || vm == nil {
-		status := gwcommon.StatusFromVertexError(lastErr)
-		if _, ok := lastErr.(*vertex.APIError); !ok {
-			status = http.StatusServiceUnavailable
-		}
+		status := gwcommon.UpstreamFailureStatus(lastErr)
 		if logger.IsClientLogEnabled() {
 			logger.ClientResponse(status, time.Since(startTime), lastErr.Error())
 		}
-		httppkg.WriteJSON(w, status, map[string]any{"error": map[string]any{"message": lastErr.Error()}})
+		writeUpstreamError(w, status, lastErr)
 		return
 	}
 	ids := modelutil.BuildSortedModelIDs(vm.Models)
 	models := make([]GeminiModel, 0, len(ids))
 	for _, modelID := range ids {
-		desc := "Model provided by google"
-		if _, ok := vm.Models[modelID]; !ok {
-			switch strings.ToLower(strings.TrimSpace(modelID)) {
-			case "gemini-3-flash-thinking":
-				desc = "Virtual model provided by google (gemini-3-flash with thinkingLevel=high)"
-			case "claude-opus-4-5":
-				desc = "Virtual model provided by anthropic (claude-opus-4-5-thinking with thinkingBudget=0)"
-			}
-		}
-		models = append(models, GeminiModel{
-			Name:        "models/" + modelID,
-			DisplayName: modelID,
-			Description: desc,
-			SupportedGenerationMethods: []string{
-				"generateContent",
-				"streamGenerateContent",
-			},
-		})
+		models = append(models, newGeminiModel(modelID, vm))
 	}
 	out := GeminiModelsResponse{Models: models}
 	if logger.IsClientLogEnabled() {
@@ -336,6 +235,72 @@ func HandleListModels(w http.ResponseWriter, r *http.Request) {
 	httppkg.WriteJSON(w, http.StatusOK, out)
 }
 
+// HandleGetModel 处理 GET /v1beta/models/{model}（google-genai 的 get_model），返回 token 上限与支持的方法。
+func HandleGetModel(w http.ResponseWriter, r *http.Request) {
+	if logger.IsClientLogEnabled() {
+		logger.ClientRequestWithHeaders(r.Method, r.URL.RequestURI(), r.Header, nil)
+	}
+	startTime := time.Now()
+
+	model, ok := modelFromPath(r)
+	if !ok {
+		httppkg.WriteJSON(w, http.StatusNotFound, map[string]any{"error": map[string]any{"message": "未找到对应的模型或接口。"}})
+		return
+	}
+	model = gwcommon.PresetModel(r.Context(), model)
+	vm, err := gwcommon.FetchAvailableModels(r.Context())
+	if err != nil {
+		status := gwcommon.FetchModelsErrorStatus(err)
+		if logger.IsClientLogEnabled() {
+			logger.ClientResponse(status, time.Since(startTime), err.Error())
+		}
+		httppkg.WriteJSON(w, status, map[string]any{"error": map[string]any{"message": err.Error()}})
+		return
+	}
+	mid, ok := gwcommon.FindModelID(vm, model)
+	if !ok {
+		msg := "模型不存在: " + model
+		if logger.IsClientLogEnabled() {
+			logger.ClientResponse(http.StatusNotFound, time.Since(startTime), msg)
+		}
+		httppkg.WriteJSON(w, http.StatusNotFound, map[string]any{"error": map[string]any{"message": msg}})
+		return
+	}
+
+	out := newGeminiModel(mid, vm)
+	if logger.IsClientLogEnabled() {
+		logger.ClientResponse(http.StatusOK, time.Since(startTime), out)
+	}
+	httppkg.WriteJSON(w, http.StatusOK, out)
+}
+
+func newGeminiModel(modelID string, vm *vertex.AvailableModelsResponse) GeminiModel {
+	desc := "Model provided by google"
+	if _, ok := vm.Models[modelID]; !ok {
+		switch strings.ToLower(strings.TrimSpace(modelID)) {
+		case "gemini-3-flash-thinking":
+			desc = "Virtual model provided by google (gemini-3-flash with thinkingLevel=high)"
+		case "claude-opus-4-5":
+			desc = "Virtual model provided by anthropic (claude-opus-4-5-thinking with thinkingBudget=0)"
+		}
+	}
+	caps := modelutil.CapabilitiesFor(modelID, modelutil.UpstreamModelInfo(vm.Models, modelID))
+	return GeminiModel{
+		Name:             "models/" + modelID,
+		DisplayName:      modelID,
+		Description:      desc,
+		InputTokenLimit:  caps.ContextWindow,
+		OutputTokenLimit: caps.MaxOutputTokens,
+		SupportedGenerationMethods: []string{
+			"generateContent",
+			"streamGenerateContent",
+		},
+		Thinking:         caps.SupportsThinking,
+		InputModalities:  caps.InputModalities,
+		OutputModalities: caps.OutputModalities,
+	}
+}
+
 func modelFromPath(r *http.Request) (string, bool) {
 	// Parse from URL path (compatible with Go 1.21 ServeMux).
 	const prefix = "/v1beta/models/"
@@ -361,20 +326,27 @@ func HandleGenerateContent(w http.ResponseWriter, r *http.Request) {
 		httppkg.WriteJSON(w, http.StatusNotFound, map[string]any{"error": map[string]any{"message": "未找到对应的模型或接口。"}})
 		return
 	}
-	body, err := io.ReadAll(r.Body)
+	model = gwcommon.PresetModel(r.Context(), model)
+	reqBody, err := spool.ReadRequest(r)
 	if err != nil {
 		httppkg.WriteJSON(w, http.StatusBadRequest, map[string]any{"error": map[string]any{"message": "读取请求体失败，请检查请求是否正确发送。"}})
 		return
 	}
+	defer reqBody.Close()
+	body := reqBody.Bytes()
+
+	var respBytes int
+	defer func() { memory.AfterLargeRequest(len(body) + respBytes) }()
 
 	if logger.IsClientLogEnabled() {
-		logger.ClientRequestWithHeaders(r.Method, r.URL.Path, r.Header, body)
+		logger.ClientRequestWithHeaders(r.Method, r.URL.RequestURI(), r.Header, body)
 	}
 	var req GeminiRequest
 	if err := jsonpkg.Unmarshal(body, &req); err != nil {
 		httppkg.WriteJSON(w, http.StatusBadRequest, map[string]any{"error": map[string]any{"message": "请求 JSON 解析失败，请检查请求体格式。"}})
 		return
 	}
+	rec := transcript.Begin(r, "gemini", body, model, false)
 
 	store := credential.GetStore()
 	attempts := store.EnabledCount()
@@ -390,7 +362,7 @@ func HandleGenerateContent(w http.ResponseWriter, r *http.Request) {
 		Request: vertex.InnerReq{
 			Contents:          vertex.SanitizeContents(req.Contents),
 			SystemInstruction: req.SystemInstruction,
-			GenerationConfig:  toVertexGenerationConfig(model, req.GenerationConfig),
+			GenerationConfig:  modelutil.ApplyVirtualModel(model, toVertexGenerationConfig(model, req.GenerationConfig)),
 			Tools:             req.Tools,
 			ToolConfig:        req.ToolConfig,
 			SessionID:         id.SessionID(),
@@ -398,68 +370,132 @@ func HandleGenerateContent(w http.ResponseWriter, r *http.Request) {
 	}
 	vreq.RequestType = "agent"
 	vreq.UserAgent = "antigravity"
-	overrideSessionID := false
-	if sid := strings.TrimSpace(r.Header.Get("X-Session-ID")); sid != "" {
-		overrideSessionID = true
-		vreq.Request.SessionID = sid
+	if err := gwcommon.CheckTurnLimit(vreq); err != nil {
+		rec.Finish(transcript.Result{Status: http.StatusBadRequest, Model: model, Error: err.Error()})
+		httppkg.WriteJSON(w, http.StatusBadRequest, map[string]any{"error": map[string]any{"code": http.StatusBadRequest, "message": err.Error(), "status": "INVALID_ARGUMENT"}})
+		return
+	}
+	gwcommon.DownscaleImages(vreq)
+	tools, err := gwcommon.PrepareTools(vreq.Request.Tools)
+	if err != nil {
+		rec.Finish(transcript.Result{Status: http.StatusBadRequest, Model: model, Error: err.Error()})
+		httppkg.WriteJSON(w, http.StatusBadRequest, map[string]any{"error": map[string]any{"message": err.Error()}})
+		return
+	}
+	vreq.Request.Tools = tools
+	gwcommon.ReferenceToolResults(vreq)
+	gwcommon.ApplyKeyPreset(r.Context(), vreq)
+	if err := gwcommon.ApplyThinkingHeaders(r.Header, model, vreq); err != nil {
+		rec.Finish(transcript.Result{Status: http.StatusBadRequest, Model: model, Error: err.Error()})
+		httppkg.WriteJSON(w, http.StatusBadRequest, map[string]any{"error": map[string]any{"message": err.Error()}})
+		return
+	}
+	gwcommon.DowngradeThinking(w, model, vreq)
+	sessionID, err := gwcommon.SessionIDFromRequest(r)
+	if err != nil {
+		rec.Finish(transcript.Result{Status: http.StatusBadRequest, Model: model, Error: err.Error()})
+		httppkg.WriteJSON(w, http.StatusBadRequest, map[string]any{"error": map[string]any{"message": err.Error()}})
+		return
+	}
+	overrideSessionID := sessionID != ""
+	if overrideSessionID {
+		vreq.Request.SessionID = sessionID
 	}
 	if rid := strings.TrimSpace(r.Header.Get("X-Request-ID")); rid != "" {
 		vreq.RequestID = rid
 	}
 	isImageModel := modelutil.IsImageModel(model)
 	isGemini3Flash := modelutil.IsGemini3Flash(model)
-	shouldSkipSystemPrompt := isImageModel || isGemini3Flash
+	shouldSkipSystemPrompt := isImageModel || isGemini3Flash || gwcommon.SkipSystemInjection(r)
 	if !shouldSkipSystemPrompt {
 		vreq.Request.SystemInstruction = vertex.InjectAgentSystemPrompt(vreq.Request.SystemInstruction)
 	}
-	if vreq.Request.SystemInstruction != nil && vreq.Request.SystemInstruction.Role == "" {
-		vreq.Request.SystemInstruction.Role = "user"
+	if vreq.Request.SystemInstruction != nil {
+		vreq.Request.SystemInstruction.Role = vertex.SystemInstructionRole(vreq.Request.SystemInstruction.Role)
+	}
+	scrubber := gwcommon.NewPIIScrubber()
+	scrubber.ScrubRequest(vreq)
+	hookInfo := &hooks.Info{Endpoint: "gemini", Model: model, Header: r.Header}
+	if apiErr := hooks.BeforeRequest(r.Context(), hookInfo, vreq); apiErr != nil {
+		rec.Finish(transcript.Result{Status: apiErr.Status, Model: model, VertexRequest: vreq, Error: apiErr.Message})
+		httppkg.WriteJSON(w, apiErr.Status, map[string]any{"error": map[string]any{"message": apiErr.Message}})
+		return
 	}
 
 	startTime := time.Now()
-	var resp *vertex.Response
-	var lastErr error
-	for attempt := 0; attempt < attempts; attempt++ {
-		acc, err := store.GetToken()
-		if err != nil {
-			lastErr = err
-			break
-		}
-		projectID := acc.ProjectID
-		if projectID == "" {
-			projectID = id.ProjectID()
-		}
-		vreq.Project = projectID
-		if !overrideSessionID {
-			vreq.Request.SessionID = acc.SessionID
-		}
+	send := func() (*vertex.Response, error) {
+		var lastErr error
+		for attempt := 0; attempt < attempts; attempt++ {
+			acc, err := store.GetTokenForModel(vreq.Model, modelutil.IsImageModel(vreq.Model))
+			if err != nil {
+				lastErr = err
+				break
+			}
+			projectID := acc.ProjectID
+			if projectID == "" {
+				projectID = id.ProjectID()
+			}
+			rec.SetAccount(acc.Email)
+			vreq.Project = projectID
+			if !overrideSessionID {
+				vreq.Request.SessionID = acc.SessionID
+			}
 
-		resp, err = vertex.GenerateContent(r.Context(), vreq, acc.AccessToken)
-		if err == nil {
-			lastErr = nil
-			break
-		}
-		lastErr = err
-		if !gwcommon.ShouldRetryWithNextToken(err) {
-			break
+			resp, err := vertex.GenerateContent(r.Context(), vreq, acc.AccessToken)
+			if refreshed, ok := gwcommon.RefreshOnUnauthorized(store, acc, err); ok {
+				resp, err = vertex.GenerateContent(r.Context(), vreq, refreshed.AccessToken)
+				gwcommon.DisableOnUnauthenticated(store, refreshed, err)
+			}
+			if err == nil {
+				vreq.Account = acc.SessionID
+				gwcommon.SetQuotaHeaders(w, acc.SessionID, vreq.Model)
+				return resp, nil
+			}
+			lastErr = err
+			if !gwcommon.ShouldRetryWithNextToken(err) {
+				break
+			}
 		}
-	}
+		return nil, lastErr
+	}
+
+	resp, lastErr := send()
+	resp, servedModel, lastErr := gwcommon.TryModelFallbacks(model, resp, lastErr, func(fallback string) (*vertex.Response, error) {
+		vreq.Model = modelutil.BackendModelID(fallback)
+		vreq.Request.GenerationConfig = modelutil.ApplyVirtualModel(fallback, toVertexGenerationConfig(fallback, req.GenerationConfig))
+		gwcommon.ApplyKeyPreset(r.Context(), vreq)
+		_ = gwcommon.ApplyThinkingHeaders(r.Header, fallback, vreq)
+		gwcommon.DowngradeThinking(w, fallback, vreq)
+		fbInfo := *hookInfo
+		fbInfo.Model = fallback
+		if apiErr := hooks.BeforeRequest(r.Context(), &fbInfo, vreq); apiErr != nil {
+			return nil, apiErr
+		}
+		return send()
+	})
+	resp, servedModel, lastErr = gwcommon.TrySecondaryBackend(r.Context(), model, servedModel, resp, lastErr, func(target string) (*vertex.Response, error) {
+		return secondary.GenerateContent(r.Context(), target, vreq)
+	})
+	gwcommon.SetServedModelHeaders(w, servedModel)
+	gwcommon.SetUpstreamHeaders(w, resp, lastErr)
 	if lastErr != nil || resp == nil {
-		status := gwcommon.StatusFromVertexError(lastErr)
-		if _, ok := lastErr.(*vertex.APIError); !ok {
-			status = http.StatusServiceUnavailable
-		}
+		status := gwcommon.UpstreamFailureStatus(lastErr)
 		if logger.IsClientLogEnabled() {
 			logger.ClientResponse(status, time.Since(startTime), lastErr.Error())
 		}
-		httppkg.WriteJSON(w, status, map[string]any{"error": map[string]any{"message": lastErr.Error()}})
+		rec.Finish(transcript.Result{Status: status, Model: servedModel, VertexRequest: vreq, Error: lastErr.Error()})
+		writeUpstreamError(w, status, lastErr)
 		return
 	}
 
-	out := &GeminiResponse{Candidates: resp.Response.Candidates, UsageMetadata: resp.Response.UsageMetadata}
+	respBytes = resp.InlineDataBytes()
+	scrubber.RestoreResponse(resp)
+	gwcommon.RecordResponseUsage(r.Context(), "gemini", servedModel, vreq, resp)
+	out := hooks.AfterResponse(r.Context(), hookInfo, &GeminiResponse{Candidates: resp.Response.Candidates, UsageMetadata: resp.Response.UsageMetadata, ModelVersion: gwcommon.ResponseModel(model, servedModel)})
 	if logger.IsClientLogEnabled() {
 		logger.ClientResponse(http.StatusOK, time.Since(startTime), out)
 	}
+	rec.Finish(transcript.Result{Status: http.StatusOK, Model: servedModel, VertexRequest: vreq, VertexResponse: resp, ClientResponse: out})
 	httppkg.WriteJSON(w, http.StatusOK, out)
 }
 
@@ -470,15 +506,20 @@ func HandleStreamGenerateContent(w http.ResponseWriter, r *http.Request) {
 		vertex.WriteStreamError(w, "未找到对应的模型或接口。")
 		return
 	}
-	body, err := io.ReadAll(r.Body)
+	reqBody, err := spool.ReadRequest(r)
 	if err != nil {
 		vertex.SetStreamHeaders(w)
 		vertex.WriteStreamError(w, "读取请求体失败，请检查请求是否正确发送。")
 		return
 	}
+	defer reqBody.Close()
+	body := reqBody.Bytes()
+
+	var respBytes int
+	defer func() { memory.AfterLargeRequest(len(body) + respBytes) }()
 
 	if logger.IsClientLogEnabled() {
-		logger.ClientRequestWithHeaders(r.Method, r.URL.Path, r.Header, body)
+		logger.ClientRequestWithHeaders(r.Method, r.URL.RequestURI(), r.Header, body)
 	}
 	var req GeminiRequest
 	if err := jsonpkg.Unmarshal(body, &req); err != nil {
@@ -486,6 +527,7 @@ func HandleStreamGenerateContent(w http.ResponseWriter, r *http.Request) {
 		vertex.WriteStreamError(w, "请求 JSON 解析失败，请检查请求体格式。")
 		return
 	}
+	rec := transcript.Begin(r, "gemini", body, model, true)
 
 	store := credential.GetStore()
 	attempts := store.EnabledCount()
@@ -501,7 +543,7 @@ func HandleStreamGenerateContent(w http.ResponseWriter, r *http.Request) {
 		Request: vertex.InnerReq{
 			Contents:          vertex.SanitizeContents(req.Contents),
 			SystemInstruction: req.SystemInstruction,
-			GenerationConfig:  toVertexGenerationConfig(model, req.GenerationConfig),
+			GenerationConfig:  modelutil.ApplyVirtualModel(model, toVertexGenerationConfig(model, req.GenerationConfig)),
 			Tools:             req.Tools,
 			ToolConfig:        req.ToolConfig,
 			SessionID:         id.SessionID(),
@@ -509,101 +551,211 @@ func HandleStreamGenerateContent(w http.ResponseWriter, r *http.Request) {
 	}
 	vreq.RequestType = "agent"
 	vreq.UserAgent = "antigravity"
-	overrideSessionID := false
-	if sid := strings.TrimSpace(r.Header.Get("X-Session-ID")); sid != "" {
-		overrideSessionID = true
-		vreq.Request.SessionID = sid
+	if err := gwcommon.CheckTurnLimit(vreq); err != nil {
+		rec.Finish(transcript.Result{Status: http.StatusBadRequest, Model: model, Error: err.Error()})
+		vertex.SetStreamHeaders(w)
+		vertex.WriteStreamError(w, err.Error())
+		return
+	}
+	gwcommon.DownscaleImages(vreq)
+	tools, err := gwcommon.PrepareTools(vreq.Request.Tools)
+	if err != nil {
+		rec.Finish(transcript.Result{Status: http.StatusBadRequest, Model: model, Error: err.Error()})
+		vertex.SetStreamHeaders(w)
+		vertex.WriteStreamError(w, err.Error())
+		return
+	}
+	vreq.Request.Tools = tools
+	gwcommon.ReferenceToolResults(vreq)
+	gwcommon.ApplyKeyPreset(r.Context(), vreq)
+	if err := gwcommon.ApplyThinkingHeaders(r.Header, model, vreq); err != nil {
+		rec.Finish(transcript.Result{Status: http.StatusBadRequest, Model: model, Error: err.Error()})
+		httppkg.WriteJSON(w, http.StatusBadRequest, map[string]any{"error": map[string]any{"message": err.Error()}})
+		return
+	}
+	gwcommon.DowngradeThinking(w, model, vreq)
+	sessionID, err := gwcommon.SessionIDFromRequest(r)
+	if err != nil {
+		rec.Finish(transcript.Result{Status: http.StatusBadRequest, Model: model, Error: err.Error()})
+		vertex.SetStreamHeaders(w)
+		vertex.WriteStreamError(w, err.Error())
+		return
+	}
+	overrideSessionID := sessionID != ""
+	if overrideSessionID {
+		vreq.Request.SessionID = sessionID
 	}
 	if rid := strings.TrimSpace(r.Header.Get("X-Request-ID")); rid != "" {
 		vreq.RequestID = rid
 	}
 	isImageModel := modelutil.IsImageModel(model)
 	isGemini3Flash := modelutil.IsGemini3Flash(model)
-	shouldSkipSystemPrompt := isImageModel || isGemini3Flash
+	shouldSkipSystemPrompt := isImageModel || isGemini3Flash || gwcommon.SkipSystemInjection(r)
 	if !shouldSkipSystemPrompt {
 		vreq.Request.SystemInstruction = vertex.InjectAgentSystemPrompt(vreq.Request.SystemInstruction)
 	}
-	if vreq.Request.SystemInstruction != nil && vreq.Request.SystemInstruction.Role == "" {
-		vreq.Request.SystemInstruction.Role = "user"
+	if vreq.Request.SystemInstruction != nil {
+		vreq.Request.SystemInstruction.Role = vertex.SystemInstructionRole(vreq.Request.SystemInstruction.Role)
+	}
+	scrubber := gwcommon.NewPIIScrubber()
+	scrubber.ScrubRequest(vreq)
+	hookInfo := &hooks.Info{Endpoint: "gemini", Model: model, Stream: true, Header: r.Header}
+	if apiErr := hooks.BeforeRequest(r.Context(), hookInfo, vreq); apiErr != nil {
+		rec.Finish(transcript.Result{Status: apiErr.Status, Model: model, VertexRequest: vreq, Error: apiErr.Message})
+		vertex.SetStreamHeaders(w)
+		vertex.WriteStreamError(w, apiErr.Message)
+		return
 	}
 
 	startTime := time.Now()
-	var resp *http.Response
-	var lastErr error
-	for attempt := 0; attempt < attempts; attempt++ {
-		acc, err := store.GetToken()
-		if err != nil {
-			lastErr = err
-			break
-		}
-		projectID := acc.ProjectID
-		if projectID == "" {
-			projectID = id.ProjectID()
-		}
-		vreq.Project = projectID
-		if !overrideSessionID {
-			vreq.Request.SessionID = acc.SessionID
-		}
+	send := func() (*http.Response, error) {
+		var lastErr error
+		for attempt := 0; attempt < attempts; attempt++ {
+			acc, err := store.GetTokenForModel(vreq.Model, modelutil.IsImageModel(vreq.Model))
+			if err != nil {
+				lastErr = err
+				break
+			}
+			projectID := acc.ProjectID
+			if projectID == "" {
+				projectID = id.ProjectID()
+			}
+			rec.SetAccount(acc.Email)
+			vreq.Project = projectID
+			if !overrideSessionID {
+				vreq.Request.SessionID = acc.SessionID
+			}
 
-		resp, err = vertex.GenerateContentStream(r.Context(), vreq, acc.AccessToken)
-		if err == nil {
-			lastErr = nil
-			break
-		}
-		lastErr = err
-		if !gwcommon.ShouldRetryWithNextToken(err) {
-			break
+			resp, err := vertex.GenerateContentStream(r.Context(), vreq, acc.AccessToken)
+			if refreshed, ok := gwcommon.RefreshOnUnauthorized(store, acc, err); ok {
+				resp, err = vertex.GenerateContentStream(r.Context(), vreq, refreshed.AccessToken)
+				gwcommon.DisableOnUnauthenticated(store, refreshed, err)
+			}
+			if err == nil {
+				vreq.Account = acc.SessionID
+				gwcommon.SetQuotaHeaders(w, acc.SessionID, vreq.Model)
+				return resp, nil
+			}
+			lastErr = err
+			if !gwcommon.ShouldRetryWithNextToken(err) {
+				break
+			}
 		}
-	}
+		return nil, lastErr
+	}
+
+	resp, lastErr := send()
+	resp, servedModel, lastErr := gwcommon.TryModelFallbacks(model, resp, lastErr, func(fallback string) (*http.Response, error) {
+		vreq.Model = modelutil.BackendModelID(fallback)
+		vreq.Request.GenerationConfig = modelutil.ApplyVirtualModel(fallback, toVertexGenerationConfig(fallback, req.GenerationConfig))
+		gwcommon.ApplyKeyPreset(r.Context(), vreq)
+		_ = gwcommon.ApplyThinkingHeaders(r.Header, fallback, vreq)
+		gwcommon.DowngradeThinking(w, fallback, vreq)
+		fbInfo := *hookInfo
+		fbInfo.Model = fallback
+		if apiErr := hooks.BeforeRequest(r.Context(), &fbInfo, vreq); apiErr != nil {
+			return nil, apiErr
+		}
+		return send()
+	})
+	resp, servedModel, lastErr = gwcommon.TrySecondaryBackend(r.Context(), model, servedModel, resp, lastErr, func(target string) (*http.Response, error) {
+		return secondary.GenerateContentStream(r.Context(), target, vreq)
+	})
+	gwcommon.SetServedModelHeaders(w, servedModel)
+	gwcommon.SetUpstreamStreamHeaders(w, resp, lastErr)
 	if lastErr != nil || resp == nil {
+		rec.Finish(transcript.Result{Status: gwcommon.StatusFromVertexError(lastErr), Model: servedModel, VertexRequest: vreq, Error: lastErr.Error()})
+		if gwcommon.IsAuthError(lastErr) {
+			// 尚未开始输出 SSE，认证失败直接返回对应的 HTTP 状态码，便于客户端重新认证或重试。
+			httppkg.WriteJSON(w, gwcommon.StatusFromVertexError(lastErr), map[string]any{"error": map[string]any{"message": lastErr.Error()}})
+			return
+		}
 		vertex.SetStreamHeaders(w)
-		vertex.WriteStreamError(w, lastErr.Error())
+		vertex.WriteStreamError(w, gwcommon.UpstreamErrorMessage(lastErr))
 		return
 	}
-	defer resp.Body.Close()
+	guard := gwcommon.NewThinkingGuard()
+	defer guard.Stop()
+	guard.Arm(resp.Body)
+	limit := gwcommon.NewOutputLimit()
 
 	vertex.SetStreamHeaders(w)
+	w, flushDone := httppkg.BatchSSEFlushes(w)
+	defer flushDone()
 
-	var reader io.Reader = resp.Body
-	if resp.Header.Get("Content-Encoding") == "gzip" {
-		gzReader, err := gzip.NewReader(resp.Body)
-		if err != nil {
-			vertex.WriteStreamError(w, err.Error())
-			return
-		}
-		defer gzReader.Close()
-		reader = gzReader
-	}
-
-	scanner := bufio.NewScanner(reader)
-	buf := make([]byte, 0, 64*1024)
-	scanner.Buffer(buf, 16*1024*1024)
-
-	buildMerged := logger.IsBackendLogEnabled() || logger.IsClientLogEnabled()
-	var mergedParts []any
+	buildMerged := logger.IsBackendLogEnabled() || logger.IsClientLogEnabled() || rec != nil || hooks.Enabled()
+	mergedParts := vertex.NewPartsCollector()
 	var lastFinishReason string
 	var lastUsage any
-
-	for scanner.Scan() {
-		line := scanner.Text()
-		if strings.HasPrefix(line, "data: ") {
-			jsonData := strings.TrimSpace(line[6:])
-			if jsonData != "[DONE]" && jsonData != "" {
-				if buildMerged {
-					var rawChunk map[string]any
-					if jsonpkg.UnmarshalString(jsonData, &rawChunk) == nil {
-						if respMap, ok := rawChunk["response"].(map[string]any); ok {
-							if usage, ok := respMap["usageMetadata"]; ok {
-								lastUsage = usage
+	// 用量统计：记录最后一次 usageMetadata，并按已透传的文本估算输出 token（客户端中途断开时使用）。
+	var lastUsageMeta *vertex.UsageMetadata
+	outputEstimate := 0
+	// forwarded 表示是否已经向客户端透传过数据；尚未透传时上游流中断可以透明重试。
+	forwarded := false
+	echoModel := gwcommon.ResponseModel(model, servedModel)
+
+	// pump 读取上游 SSE 流并逐行透传给客户端，返回读取错误（正常结束时为 nil）。
+	pump := func(resp *http.Response) error {
+		defer resp.Body.Close()
+		var reader io.Reader = resp.Body
+		if resp.Header.Get("Content-Encoding") == "gzip" {
+			gzReader, err := gzip.NewReader(resp.Body)
+			if err != nil {
+				return err
+			}
+			defer gzReader.Close()
+			reader = gzReader
+		}
+
+		scanner := bufio.NewScanner(reader)
+		buf := make([]byte, 0, 64*1024)
+		scanner.Buffer(buf, 16*1024*1024)
+		for scanner.Scan() {
+			line := scanner.Text()
+			respBytes += len(line)
+			if strings.HasPrefix(line, "data: ") {
+				jsonData := strings.TrimSpace(line[6:])
+				if jsonData != "[DONE]" && jsonData != "" {
+					var chunk usageChunk
+					if jsonpkg.UnmarshalString(jsonData, &chunk) == nil {
+						if chunk.Response.UsageMetadata != nil {
+							lastUsageMeta = chunk.Response.UsageMetadata
+						}
+						thought, visible, chunkTokens := "", false, 0
+						for _, c := range chunk.Response.Candidates {
+							for _, p := range c.Content.Parts {
+								chunkTokens += gwcommon.EstimateTokens(p.Text)
+								if p.Thought {
+									thought += p.Text
+								} else if p.Text != "" || p.FunctionCall != nil || p.InlineData != nil {
+									visible = true
+								}
 							}
-							if candidates, ok := respMap["candidates"].([]any); ok && len(candidates) > 0 {
-								if cand, ok := candidates[0].(map[string]any); ok {
-									if fr, ok := cand["finishReason"].(string); ok && fr != "" {
-										lastFinishReason = fr
-									}
-									if content, ok := cand["content"].(map[string]any); ok {
-										if parts, ok := content["parts"].([]any); ok {
-											mergedParts = append(mergedParts, parts...)
+						}
+						outputEstimate += chunkTokens
+						if guard.Observe(thought, visible, chunk.Response.UsageMetadata) != nil {
+							break
+						}
+						if limit.Observe(len(jsonData), chunkTokens, chunk.Response.UsageMetadata) != nil {
+							break
+						}
+					}
+					if buildMerged {
+						var rawChunk map[string]any
+						if jsonpkg.UnmarshalString(jsonData, &rawChunk) == nil {
+							if respMap, ok := rawChunk["response"].(map[string]any); ok {
+								if usage, ok := respMap["usageMetadata"]; ok {
+									lastUsage = usage
+								}
+								if candidates, ok := respMap["candidates"].([]any); ok && len(candidates) > 0 {
+									if cand, ok := candidates[0].(map[string]any); ok {
+										if fr, ok := cand["finishReason"].(string); ok && fr != "" {
+											lastFinishReason = fr
+										}
+										if content, ok := cand["content"].(map[string]any); ok {
+											if parts, ok := content["parts"].([]any); ok {
+												mergedParts.Add(parts, len(jsonData))
+											}
 										}
 									}
 								}
@@ -611,26 +763,66 @@ func HandleStreamGenerateContent(w http.ResponseWriter, r *http.Request) {
 						}
 					}
 				}
-			}
 
-			transformed := transformGeminiStreamLine(line)
-			_, _ = io.WriteString(w, transformed+"\n\n")
-			if f, ok := w.(http.Flusher); ok {
-				f.Flush()
+				transformed := transformGeminiStreamLine(line, echoModel)
+				if scrubber != nil {
+					transformed = restoreGeminiStreamLine(scrubber, transformed)
+				}
+				// 分两次写入，避免为多 MB 的图片分片再拼接一份副本。
+				_, _ = io.WriteString(w, transformed)
+				_, _ = io.WriteString(w, "\n\n")
+				forwarded = true
+				if f, ok := w.(http.Flusher); ok {
+					f.Flush()
+				}
 			}
 		}
+		return scanner.Err()
 	}
 
-	duration := time.Since(startTime)
-	if err := scanner.Err(); err != nil {
-		logger.Error("Stream scan error: %v", err)
+	scanErr := pump(resp)
+	if gwcommon.ShouldRetryStream(r.Context(), scanErr, forwarded, guard) {
+		// 上游流在透传任何数据之前中断（连接被重置、gzip 截断等）时，换一个账号透明地重试一次。
+		logger.Warn("上游流在输出内容前中断（%v），重试一次", scanErr)
+		if retryResp, err := send(); err == nil {
+			guard.Arm(retryResp.Body)
+			scanErr = pump(retryResp)
+		} else {
+			logger.Warn("重试打开上游流失败: %v", err)
+		}
+	}
+
+	if text, thought := scrubber.FlushStream(); text != "" || thought != "" {
+		writeGeminiTrailingText(w, text, thought)
+	}
+	if limit.Exceeded() {
+		// 输出超过 MAX_STREAM_OUTPUT_BYTES / MAX_STREAM_OUTPUT_TOKENS：已截断，以 MAX_TOKENS 结束。
+		lastFinishReason = "MAX_TOKENS"
+		writeGeminiFinish(w, lastFinishReason)
 	}
 
+	duration := time.Since(startTime)
+	var errMsg string
+	status := http.StatusOK
+	if limitErr := guard.Err(); limitErr != nil {
+		errMsg = limitErr.Error()
+		vertex.WriteStreamError(w, errMsg)
+	} else if scanErr != nil {
+		// 流中途中断时发送错误事件，避免客户端把不完整的响应当作正常结束。
+		logger.Error("Stream scan error: %v", scanErr)
+		errMsg = gwcommon.StreamInterruptedMessage(scanErr)
+		vertex.WriteStreamError(w, errMsg)
+		if !forwarded {
+			status = http.StatusBadGateway
+		}
+	}
+	gwcommon.RecordStreamUsage(r.Context(), "gemini", servedModel, vreq, lastUsageMeta, outputEstimate)
+
 	if buildMerged {
 		mergedResp := map[string]any{
 			"response": map[string]any{
 				"candidates": []any{map[string]any{
-					"content":      map[string]any{"role": "model", "parts": vertex.MergeParts(mergedParts)},
+					"content":      map[string]any{"role": "model", "parts": mergedParts.Merged()},
 					"finishReason": lastFinishReason,
 				}},
 				"usageMetadata": lastUsage,
@@ -642,6 +834,103 @@ func HandleStreamGenerateContent(w http.ResponseWriter, r *http.Request) {
 		if logger.IsClientLogEnabled() {
 			logger.ClientStreamResponse(http.StatusOK, duration, mergedResp)
 		}
+		rec.Finish(transcript.Result{Status: status, Model: servedModel, VertexRequest: vreq, VertexResponse: mergedResp, Error: errMsg})
+		hooks.AfterResponse(r.Context(), hookInfo, mergedResp)
+	}
+}
+
+// usageChunk 为流式分片中用量统计与思考限制所需的字段（functionCall / inlineData 只判断是否存在，不解码内容）。
+type usageChunk struct {
+	Response struct {
+		Candidates []struct {
+			Content struct {
+				Parts []struct {
+					Text         string    `json:"text"`
+					Thought      bool      `json:"thought"`
+					FunctionCall *struct{} `json:"functionCall"`
+					InlineData   *struct{} `json:"inlineData"`
+				} `json:"parts"`
+			} `json:"content"`
+		} `json:"candidates"`
+		UsageMetadata *vertex.UsageMetadata `json:"usageMetadata"`
+	} `json:"response"`
+}
+
+// restoreGeminiStreamLine 还原已转换（去掉 response 包装）的流式分片中的 PII 占位符。
+func restoreGeminiStreamLine(scrubber *gwcommon.PIIScrubber, line string) string {
+	if !strings.HasPrefix(line, "data: ") {
+		return line
+	}
+	var data map[string]any
+	if err := jsonpkg.UnmarshalString(strings.TrimSpace(line[6:]), &data); err != nil {
+		return line
+	}
+	candidates, _ := data["candidates"].([]any)
+	for _, c := range candidates {
+		cand, _ := c.(map[string]any)
+		content, _ := cand["content"].(map[string]any)
+		parts, _ := content["parts"].([]any)
+		for _, p := range parts {
+			part, _ := p.(map[string]any)
+			if part == nil {
+				continue
+			}
+			if fc, ok := part["functionCall"].(map[string]any); ok {
+				if args, ok := fc["args"].(map[string]any); ok {
+					fc["args"] = scrubber.RestoreArgs(args)
+				}
+				continue
+			}
+			if text, ok := part["text"].(string); ok {
+				thought, _ := part["thought"].(bool)
+				part["text"] = scrubber.RestoreStreamText(text, thought)
+			}
+		}
+	}
+	b, err := jsonpkg.Marshal(data)
+	if err != nil {
+		return line
+	}
+	return "data: " + string(b)
+}
+
+// writeGeminiTrailingText 在流结束时输出仍暂存的文本（被拆分的占位符前缀等）。
+// writeUpstreamError 以 status 返回生成请求的失败；上游超时按 Google API 的格式返回 DEADLINE_EXCEEDED 并提示调整 TIMEOUT。
+func writeUpstreamError(w http.ResponseWriter, status int, err error) {
+	if gwcommon.IsUpstreamTimeout(err) {
+		httppkg.WriteJSON(w, status, map[string]any{"error": map[string]any{"code": status, "message": gwcommon.TimeoutMessage(), "status": "DEADLINE_EXCEEDED"}})
+		return
+	}
+	httppkg.WriteJSON(w, status, map[string]any{"error": map[string]any{"message": err.Error()}})
+}
+
+func writeGeminiTrailingText(w http.ResponseWriter, text, thought string) {
+	var parts []vertex.Part
+	if thought != "" {
+		parts = append(parts, vertex.Part{Text: thought, Thought: true})
+	}
+	if text != "" {
+		parts = append(parts, vertex.Part{Text: text})
+	}
+	b, err := jsonpkg.Marshal(GeminiResponse{Candidates: []vertex.Candidate{{Content: vertex.Content{Role: "model", Parts: parts}}}})
+	if err != nil {
+		return
+	}
+	_, _ = io.WriteString(w, "data: "+string(b)+"\n\n")
+	if f, ok := w.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// writeGeminiFinish 输出只带 finishReason 的结束分片（上游流被本地截断时使用）。
+func writeGeminiFinish(w http.ResponseWriter, reason string) {
+	b, err := jsonpkg.Marshal(GeminiResponse{Candidates: []vertex.Candidate{{Content: vertex.Content{Role: "model", Parts: []vertex.Part{}}, FinishReason: reason}}})
+	if err != nil {
+		return
+	}
+	_, _ = io.WriteString(w, "data: "+string(b)+"\n\n")
+	if f, ok := w.(http.Flusher); ok {
+		f.Flush()
 	}
 }
 
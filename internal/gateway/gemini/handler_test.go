@@ -1,9 +1,12 @@
 package gemini
 
 import (
+	"strings"
 	"testing"
 
 	"anti2api-golang/refactor/internal/config"
+	"anti2api-golang/refactor/internal/pkg/modelutil"
+	"anti2api-golang/refactor/internal/vertex"
 )
 
 func strptr(s string) *string { return &s }
@@ -200,3 +203,23 @@ func TestToVertexGenerationConfig_NonGemini3_DoesNotApplyGlobalMediaResolution(t
 		t.Fatalf("expected mediaResolution to be empty, got %q", out.MediaResolution)
 	}
 }
+
+func TestNewGeminiModel_TokenLimits(t *testing.T) {
+	vm := &vertex.AvailableModelsResponse{Models: map[string]any{
+		"gemini-3-pro-high":        map[string]any{"maxTokens": float64(500000)},
+		"claude-opus-4-5-thinking": map[string]any{},
+	}}
+
+	m := newGeminiModel("gemini-3-pro-high", vm)
+	if m.Name != "models/gemini-3-pro-high" || m.InputTokenLimit != 500000 || m.OutputTokenLimit != modelutil.GeminiMaxOutputTokens {
+		t.Fatalf("unexpected model %+v", m)
+	}
+	if !m.Thinking || len(m.InputModalities) != 2 || len(m.SupportedGenerationMethods) != 2 {
+		t.Fatalf("unexpected methods %v", m.SupportedGenerationMethods)
+	}
+
+	v := newGeminiModel("claude-opus-4-5", vm)
+	if !strings.HasPrefix(v.Description, "Virtual model") || v.InputTokenLimit != 200000 || v.OutputTokenLimit != modelutil.ClaudeMaxOutputTokens || v.Thinking {
+		t.Fatalf("unexpected virtual model %+v", v)
+	}
+}
@@ -0,0 +1,75 @@
+package manager
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+
+	"anti2api-golang/refactor/internal/credential"
+	"anti2api-golang/refactor/internal/gateway/manager/views"
+	"anti2api-golang/refactor/internal/logger"
+)
+
+// HandleArchive 返回回收站中的账号（HTMX 请求返回 HTML，否则返回不含凭证的 JSON 摘要）。
+func HandleArchive(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		http.Error(w, "不支持的请求方法", http.StatusMethodNotAllowed)
+		return
+	}
+
+	items := credential.GetStore().Archived()
+	if isHTMX(r) {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		views.ArchiveList(items).Render(r.Context(), w)
+		return
+	}
+	out := make([]map[string]any, 0, len(items))
+	for _, it := range items {
+		out = append(out, map[string]any{
+			"id":         it.ArchiveID,
+			"email":      it.Email,
+			"projectId":  it.ProjectID,
+			"created_at": it.CreatedAt,
+			"deleted_at": it.DeletedAt,
+		})
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"items": out})
+}
+
+// HandleArchiveRestore 将回收站中的账号恢复到账号列表。
+func HandleArchiveRestore(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "不支持的请求方法", http.StatusMethodNotAllowed)
+		return
+	}
+
+	if err := credential.GetStore().Restore(strings.TrimSpace(r.URL.Query().Get("id"))); err != nil {
+		writeArchiveError(w, err)
+		return
+	}
+	w.Header().Set("HX-Trigger", "refreshStats, refreshList")
+	w.Write([]byte(""))
+}
+
+// HandleArchivePurge 从回收站彻底删除账号。
+func HandleArchivePurge(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "不支持的请求方法", http.StatusMethodNotAllowed)
+		return
+	}
+
+	if err := credential.GetStore().Purge(strings.TrimSpace(r.URL.Query().Get("id"))); err != nil {
+		writeArchiveError(w, err)
+		return
+	}
+	w.Write([]byte(""))
+}
+
+func writeArchiveError(w http.ResponseWriter, err error) {
+	if errors.Is(err, credential.ErrArchivedAccountNotFound) {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	logger.Warn("回收站操作失败: %v", err)
+	http.Error(w, err.Error(), http.StatusConflict)
+}
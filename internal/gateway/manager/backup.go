@@ -0,0 +1,445 @@
+package manager
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"anti2api-golang/refactor/internal/config"
+	"anti2api-golang/refactor/internal/credential"
+	"anti2api-golang/refactor/internal/logger"
+	"anti2api-golang/refactor/internal/storage"
+)
+
+// 备份为 DATA_DIR 的 tar.gz 快照：
+//   - backup.json 记录格式版本、创建时间与账号的导出方式；
+//   - accounts.json / accounts_archive.json 由内存中的账号列表生成（与存储后端无关），按 accounts 参数完整导出、脱敏或省略；
+//   - data.db 以 VACUUM INTO 生成一致性快照并去掉其中的账号文档；
+//   - 其余文件（settings.json、签名、会话记录、租户数据等）原样打包，临时目录（spool、stream_tee）不包含在内。
+const (
+	backupManifestName = "backup.json"
+	backupVersion      = 1
+
+	// maxRestoreBytes 为恢复时解压后的总大小上限。
+	maxRestoreBytes = 2 << 30
+	// maxRestoreUpload 为上传的压缩包大小上限。
+	maxRestoreUpload = 512 << 20
+)
+
+// 账号的导出方式。
+const (
+	backupAccountsFull     = "full"
+	backupAccountsRedacted = "redacted"
+	backupAccountsNone     = "none"
+)
+
+var (
+	accountDocuments = []string{"accounts.json", "accounts_archive.json"}
+	// backupSkipDirs 为不打包的临时目录（相对 DATA_DIR）。
+	backupSkipDirs = map[string]bool{"spool": true, "stream_tee": true}
+)
+
+type backupManifest struct {
+	Version   int       `json:"version"`
+	CreatedAt time.Time `json:"createdAt"`
+	Accounts  string    `json:"accounts"`
+	Storage   string    `json:"storage"`
+}
+
+// HandleBackup 下载 DATA_DIR 的 tar.gz 快照。accounts 查询参数：full 包含完整凭证，redacted（默认）去掉 token，none 不包含账号。
+func HandleBackup(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		http.Error(w, "不支持的请求方法", http.StatusMethodNotAllowed)
+		return
+	}
+
+	mode := strings.TrimSpace(r.URL.Query().Get("accounts"))
+	switch mode {
+	case "":
+		mode = backupAccountsRedacted
+	case backupAccountsFull, backupAccountsRedacted, backupAccountsNone:
+	default:
+		writeJSON(w, http.StatusBadRequest, map[string]any{"error": "accounts 只能为 full、redacted 或 none"})
+		return
+	}
+
+	name := "ant2api-backup-" + time.Now().Format("20060102-150405") + ".tar.gz"
+	w.Header().Set("Content-Type", "application/gzip")
+	w.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": name}))
+	if r.Method == http.MethodHead {
+		return
+	}
+	if err := writeBackup(w, config.Get().DataDir, mode); err != nil {
+		// 响应头已发出，只能记录错误；客户端会得到不完整的压缩包。
+		logger.Warn("生成备份失败: %v", err)
+	}
+}
+
+func writeBackup(w io.Writer, dataDir, mode string) error {
+	gz := gzip.NewWriter(w)
+	tw := tar.NewWriter(gz)
+	now := time.Now()
+
+	backend := "file"
+	if storage.Enabled() {
+		backend = "sqlite"
+	}
+	manifest, err := json.MarshalIndent(backupManifest{Version: backupVersion, CreatedAt: now, Accounts: mode, Storage: backend}, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := writeTarFile(tw, backupManifestName, manifest, now); err != nil {
+		return err
+	}
+	if mode != backupAccountsNone {
+		if err := writeBackupAccounts(tw, mode == backupAccountsRedacted, now); err != nil {
+			return err
+		}
+	}
+
+	err = filepath.WalkDir(dataDir, func(p string, d os.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(dataDir, p)
+		if err != nil || rel == "." {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+		if d.IsDir() {
+			if backupSkipDirs[rel] || strings.HasPrefix(d.Name(), ".restore-") {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !d.Type().IsRegular() || skipBackupFile(rel, d.Name()) {
+			return nil
+		}
+		if d.Name() == storage.FileName {
+			return writeBackupDB(tw, p, rel)
+		}
+		if db := storage.For(filepath.Dir(p)); db != nil && strings.HasPrefix(d.Name(), storage.FileName+"-") {
+			// 数据库已打开时其 WAL 已包含在快照中。
+			return nil
+		}
+		return writeTarPath(tw, p, rel)
+	})
+	if err != nil {
+		return err
+	}
+	if err := tw.Close(); err != nil {
+		return err
+	}
+	return gz.Close()
+}
+
+// skipBackupFile 判断文件是否不打包：账号文件（单独生成）、写入探测与原子写入的临时文件、待恢复的数据库。
+func skipBackupFile(rel, name string) bool {
+	if rel == backupManifestName {
+		return true
+	}
+	for _, doc := range accountDocuments {
+		if rel == doc {
+			return true
+		}
+	}
+	return strings.HasPrefix(name, ".write-probe-") || strings.HasSuffix(name, ".tmp") || strings.HasSuffix(name, storage.RestoreSuffix)
+}
+
+func writeBackupAccounts(tw *tar.Writer, redact bool, now time.Time) error {
+	store := credential.GetStore()
+	accounts := store.GetAll()
+	archived := store.Archived()
+	if redact {
+		for i := range accounts {
+			redactAccount(&accounts[i])
+		}
+		for i := range archived {
+			redactAccount(&archived[i].Account)
+		}
+	}
+	for i, v := range []any{accounts, archived} {
+		data, err := json.MarshalIndent(v, "", "  ")
+		if err != nil {
+			return err
+		}
+		if err := writeTarFile(tw, accountDocuments[i], data, now); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func redactAccount(a *credential.Account) {
+	a.AccessToken = ""
+	a.RefreshToken = ""
+}
+
+// writeBackupDB 打包数据目录中的 data.db：已打开的数据库写快照（不含账号文档），否则原样打包。
+func writeBackupDB(tw *tar.Writer, p, rel string) error {
+	db := storage.For(filepath.Dir(p))
+	if db == nil {
+		return writeTarPath(tw, p, rel)
+	}
+	tmp, err := os.MkdirTemp("", "ant2api-backup-")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(tmp)
+	snap := filepath.Join(tmp, storage.FileName)
+	if err := db.Snapshot(snap, accountDocuments...); err != nil {
+		return fmt.Errorf("生成 %s 快照失败: %w", rel, err)
+	}
+	return writeTarPath(tw, snap, rel)
+}
+
+func writeTarFile(tw *tar.Writer, name string, data []byte, modTime time.Time) error {
+	if err := tw.WriteHeader(&tar.Header{Name: name, Mode: 0o600, Size: int64(len(data)), ModTime: modTime, Typeflag: tar.TypeReg}); err != nil {
+		return err
+	}
+	_, err := tw.Write(data)
+	return err
+}
+
+func writeTarPath(tw *tar.Writer, p, name string) error {
+	f, err := os.Open(p)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	if err := tw.WriteHeader(&tar.Header{Name: name, Mode: int64(info.Mode().Perm()), Size: info.Size(), ModTime: info.ModTime(), Typeflag: tar.TypeReg}); err != nil {
+		return err
+	}
+	// 按头部记录的大小复制，文件在打包期间被追加时只取快照时的长度。
+	_, err = io.CopyN(tw, f, info.Size())
+	return err
+}
+
+// restoreResult 为恢复结果。
+type restoreResult struct {
+	Files           int  `json:"files"`
+	Accounts        int  `json:"accounts"`
+	AccountsSkipped bool `json:"accountsSkipped,omitempty"`
+	RestartRequired bool `json:"restartRequired"`
+}
+
+// HandleRestore 从上传的备份（multipart 的 file 字段或原始请求体）恢复 DATA_DIR。
+// 压缩包先完整解压到数据目录下的临时目录并校验（路径、文件类型、JSON 格式、账号格式），全部通过后才替换现有文件；
+// 备份中没有的文件保持不变。账号立即生效；脱敏备份中的账号不会覆盖现有账号。
+// settings.json、签名与 data.db 在重启后生效（启用 SQLite 时 data.db 先写为 data.db.restore，下次打开时替换）。
+func HandleRestore(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "不支持的请求方法", http.StatusMethodNotAllowed)
+		return
+	}
+	if config.DataDirReadOnly() {
+		writeJSON(w, http.StatusConflict, map[string]any{"error": "数据目录只读，无法恢复备份"})
+		return
+	}
+
+	r.Body = http.MaxBytesReader(w, r.Body, maxRestoreUpload)
+	body := io.Reader(r.Body)
+	if mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type")); mediaType == "multipart/form-data" {
+		file, _, err := r.FormFile("file")
+		if err != nil {
+			writeJSON(w, http.StatusBadRequest, map[string]any{"error": "缺少备份文件: " + err.Error()})
+			return
+		}
+		defer file.Close()
+		body = file
+	}
+
+	dataDir := config.Get().DataDir
+	result, err := restoreBackup(body, dataDir)
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]any{"error": err.Error()})
+		return
+	}
+	logger.Info("已从备份恢复 %d 个文件、%d 个账号", result.Files, result.Accounts)
+	w.Header().Set("HX-Trigger", "refreshStats, refreshList")
+	writeJSON(w, http.StatusOK, map[string]any{"success": true, "result": result})
+}
+
+func restoreBackup(body io.Reader, dataDir string) (*restoreResult, error) {
+	if err := os.MkdirAll(dataDir, 0o755); err != nil {
+		return nil, err
+	}
+	staging, err := os.MkdirTemp(dataDir, ".restore-")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(staging)
+
+	files, err := extractBackup(body, staging)
+	if err != nil {
+		return nil, err
+	}
+
+	raw, err := os.ReadFile(filepath.Join(staging, backupManifestName))
+	if err != nil {
+		return nil, errors.New("不是有效的备份文件：缺少 " + backupManifestName)
+	}
+	var manifest backupManifest
+	if err := json.Unmarshal(raw, &manifest); err != nil {
+		return nil, fmt.Errorf("%s 格式错误: %w", backupManifestName, err)
+	}
+	if manifest.Version != backupVersion {
+		return nil, fmt.Errorf("不支持的备份格式版本 %d", manifest.Version)
+	}
+
+	var (
+		accounts     []credential.Account
+		archived     []credential.ArchivedAccount
+		haveAccounts bool
+	)
+	if raw, err := os.ReadFile(filepath.Join(staging, accountDocuments[0])); err == nil {
+		if err := json.Unmarshal(raw, &accounts); err != nil {
+			return nil, fmt.Errorf("%s 格式错误: %w", accountDocuments[0], err)
+		}
+		haveAccounts = true
+	}
+	if raw, err := os.ReadFile(filepath.Join(staging, accountDocuments[1])); err == nil {
+		if err := json.Unmarshal(raw, &archived); err != nil {
+			return nil, fmt.Errorf("%s 格式错误: %w", accountDocuments[1], err)
+		}
+	}
+
+	result := &restoreResult{}
+	pendingDB := false
+	for _, rel := range files {
+		if rel == backupManifestName || rel == accountDocuments[0] || rel == accountDocuments[1] {
+			continue
+		}
+		src := filepath.Join(staging, filepath.FromSlash(rel))
+		dst := filepath.Join(dataDir, filepath.FromSlash(rel))
+		if err := os.MkdirAll(filepath.Dir(dst), 0o755); err != nil {
+			return result, err
+		}
+		if path.Base(rel) == storage.FileName && storage.Enabled() {
+			dst += storage.RestoreSuffix
+			result.RestartRequired = true
+			pendingDB = pendingDB || rel == storage.FileName
+		} else if rel == "settings.json" || strings.HasPrefix(rel, "signatures/") || strings.Contains(rel, "/signatures/") {
+			result.RestartRequired = true
+		}
+		if err := os.Rename(src, dst); err != nil {
+			return result, err
+		}
+		result.Files++
+	}
+
+	switch {
+	case !haveAccounts:
+	case manifest.Accounts == backupAccountsRedacted:
+		result.AccountsSkipped = true
+	default:
+		if err := credential.GetStore().Replace(accounts, archived); err != nil {
+			return result, fmt.Errorf("恢复账号失败: %w", err)
+		}
+		result.Accounts = len(accounts)
+	}
+	if pendingDB {
+		// 快照中不含账号文档，重启替换数据库后从 JSON 文件重新导入当前账号。
+		if err := credential.GetStore().SaveFiles(); err != nil {
+			return result, fmt.Errorf("保存账号文件失败: %w", err)
+		}
+	}
+	return result, nil
+}
+
+// extractBackup 将 tar.gz 解压到 dir 并返回其中的文件（相对路径，/ 分隔）。
+// 只接受普通文件与目录；绝对路径、含 .. 的路径以及无法解析的 .json 文件都会使整个恢复失败。
+func extractBackup(body io.Reader, dir string) ([]string, error) {
+	gz, err := gzip.NewReader(body)
+	if err != nil {
+		return nil, errors.New("不是有效的 tar.gz 文件")
+	}
+	defer gz.Close()
+	tr := tar.NewReader(gz)
+
+	var (
+		files []string
+		total int64
+	)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("读取备份失败: %w", err)
+		}
+		rel, ok := cleanBackupPath(hdr.Name)
+		if !ok {
+			return nil, fmt.Errorf("备份中包含非法路径 %q", hdr.Name)
+		}
+		switch hdr.Typeflag {
+		case tar.TypeDir:
+			continue
+		case tar.TypeReg:
+		default:
+			return nil, fmt.Errorf("备份中包含不支持的文件类型 %q", hdr.Name)
+		}
+		total += hdr.Size
+		if hdr.Size < 0 || total > maxRestoreBytes {
+			return nil, errors.New("备份内容过大")
+		}
+
+		dst := filepath.Join(dir, filepath.FromSlash(rel))
+		if err := os.MkdirAll(filepath.Dir(dst), 0o755); err != nil {
+			return nil, err
+		}
+		f, err := os.OpenFile(dst, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0o600)
+		if err != nil {
+			return nil, err
+		}
+		_, err = io.Copy(f, io.LimitReader(tr, hdr.Size))
+		if cerr := f.Close(); err == nil {
+			err = cerr
+		}
+		if err != nil {
+			return nil, fmt.Errorf("解压 %s 失败: %w", rel, err)
+		}
+		if strings.HasSuffix(rel, ".json") {
+			data, err := os.ReadFile(dst)
+			if err != nil {
+				return nil, err
+			}
+			if !json.Valid(data) {
+				return nil, fmt.Errorf("%s 不是有效的 JSON", rel)
+			}
+		}
+		files = append(files, rel)
+	}
+	if len(files) == 0 {
+		return nil, errors.New("备份为空")
+	}
+	return files, nil
+}
+
+// cleanBackupPath 规范化压缩包中的路径，拒绝绝对路径与越出数据目录的路径。
+func cleanBackupPath(name string) (string, bool) {
+	name = strings.ReplaceAll(name, "\\", "/")
+	if name == "" || strings.HasPrefix(name, "/") || filepath.IsAbs(name) || filepath.VolumeName(name) != "" {
+		return "", false
+	}
+	clean := path.Clean(name)
+	if clean == "." || clean == ".." || strings.HasPrefix(clean, "../") {
+		return "", false
+	}
+	return clean, true
+}
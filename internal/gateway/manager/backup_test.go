@@ -0,0 +1,110 @@
+package manager
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestBackupRestoreRoundTrip(t *testing.T) {
+	src := t.TempDir()
+	files := map[string]string{
+		"settings.json":                           `{"version":1}`,
+		"signatures/2026-01-01.jsonl":             `{"requestId":"r"}` + "\n",
+		"tenants/alice/transcripts/a.jsonl":       `{"id":"a"}` + "\n",
+		"spool/body-1":                            "temporary",
+		"stream_tee/20260101-req.sse":             "data: {}\n",
+		"tenants/alice/signatures/2026-01-01.tmp": "partial",
+	}
+	for name, content := range files {
+		p := filepath.Join(src, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(p), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(p, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := writeBackup(&buf, src, backupAccountsNone); err != nil {
+		t.Fatalf("writeBackup: %v", err)
+	}
+
+	dst := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dst, "settings.json"), []byte(`{"old":true}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	result, err := restoreBackup(&buf, dst)
+	if err != nil {
+		t.Fatalf("restoreBackup: %v", err)
+	}
+	if result.Files != 3 || !result.RestartRequired || result.Accounts != 0 {
+		t.Fatalf("unexpected result: %+v", result)
+	}
+	for _, name := range []string{"settings.json", "signatures/2026-01-01.jsonl", "tenants/alice/transcripts/a.jsonl"} {
+		got, err := os.ReadFile(filepath.Join(dst, filepath.FromSlash(name)))
+		if err != nil || string(got) != files[name] {
+			t.Fatalf("%s not restored: %q %v", name, got, err)
+		}
+	}
+	for _, name := range []string{"spool", "stream_tee", "tenants/alice/signatures"} {
+		if _, err := os.Stat(filepath.Join(dst, filepath.FromSlash(name))); !os.IsNotExist(err) {
+			t.Fatalf("%s should not be in the backup", name)
+		}
+	}
+	if entries, _ := filepath.Glob(filepath.Join(dst, ".restore-*")); len(entries) != 0 {
+		t.Fatalf("staging directory left behind: %v", entries)
+	}
+}
+
+func TestRestoreBackup_RejectsInvalidArchives(t *testing.T) {
+	cases := map[string]map[string]string{
+		"traversal":    {backupManifestName: `{"version":1}`, "../evil": "x"},
+		"absolute":     {backupManifestName: `{"version":1}`, "/etc/evil": "x"},
+		"bad json":     {backupManifestName: `{"version":1}`, "settings.json": "{"},
+		"no manifest":  {"settings.json": "{}"},
+		"bad accounts": {backupManifestName: `{"version":1}`, "accounts.json": `{"not":"a list"}`},
+	}
+	for name, entries := range cases {
+		t.Run(name, func(t *testing.T) {
+			dst := t.TempDir()
+			if _, err := restoreBackup(bytes.NewReader(makeTarGz(t, entries)), dst); err == nil {
+				t.Fatal("expected error")
+			}
+			if _, err := os.Stat(filepath.Join(dst, "settings.json")); !os.IsNotExist(err) {
+				t.Fatal("nothing should be restored from an invalid backup")
+			}
+		})
+	}
+
+	if _, err := restoreBackup(strings.NewReader("not gzip"), t.TempDir()); err == nil {
+		t.Fatal("expected error for non-gzip upload")
+	}
+}
+
+func makeTarGz(t *testing.T, entries map[string]string) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(gz)
+	for name, content := range entries {
+		if err := tw.WriteHeader(&tar.Header{Name: name, Mode: 0o600, Size: int64(len(content)), Typeflag: tar.TypeReg}); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := tw.Write([]byte(content)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := gz.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
@@ -0,0 +1,70 @@
+package manager
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"anti2api-golang/refactor/internal/config"
+	"anti2api-golang/refactor/internal/logger"
+	"anti2api-golang/refactor/internal/vertex"
+)
+
+const defaultEndpointRecentLimit = 50
+
+// HandleEndpoint 查看与切换上游端点模式：
+//   - GET 返回当前模式、下一次请求将使用的端点、各端点的成功 / 失败计数与平均延迟，以及最近请求实际使用的端点；
+//   - POST {"mode": "..."} 在运行时切换模式（写入 settings.json，ENDPOINT_MODE 环境变量仅影响启动时的默认值）。
+func HandleEndpoint(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet, http.MethodHead:
+	case http.MethodPost:
+		var req struct {
+			Mode string `json:"mode"`
+		}
+		if err := json.NewDecoder(io.LimitReader(r.Body, 1<<16)).Decode(&req); err != nil {
+			writeJSON(w, http.StatusBadRequest, map[string]any{"error": "请求体不是有效的 JSON"})
+			return
+		}
+		mode := strings.ToLower(strings.TrimSpace(req.Mode))
+		if !config.ValidEndpointMode(mode) {
+			writeJSON(w, http.StatusBadRequest, map[string]any{"error": "未知的端点模式：" + req.Mode, "modes": config.EndpointModes})
+			return
+		}
+		if err := config.GetEndpointManager().SetMode(mode); err != nil {
+			logger.Error("保存端点模式失败：%v", err)
+			writeJSON(w, http.StatusInternalServerError, map[string]any{"error": "保存端点模式失败: " + err.Error()})
+			return
+		}
+		logger.Info("端点模式已切换为 %s", mode)
+	default:
+		http.Error(w, "不支持的请求方法", http.StatusMethodNotAllowed)
+		return
+	}
+
+	limit, _ := strconv.Atoi(r.URL.Query().Get("limit"))
+	if limit <= 0 {
+		limit = defaultEndpointRecentLimit
+	}
+	mgr := config.GetEndpointManager()
+	stats := vertex.EndpointStats()
+	endpoints := make([]map[string]any, 0, len(config.RoundRobinEndpoints))
+	for _, key := range config.RoundRobinEndpoints {
+		ep := config.APIEndpoints[key]
+		endpoints = append(endpoints, map[string]any{
+			"key":   ep.Key,
+			"label": ep.Label,
+			"host":  ep.Host,
+			"stats": stats[key],
+		})
+	}
+	writeJSON(w, http.StatusOK, map[string]any{
+		"mode":      mgr.GetMode(),
+		"current":   mgr.CurrentEndpointKey(),
+		"modes":     config.EndpointModes,
+		"endpoints": endpoints,
+		"recent":    vertex.RecentEndpointUses(limit),
+	})
+}
@@ -0,0 +1,191 @@
+package manager
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"anti2api-golang/refactor/internal/config"
+	"anti2api-golang/refactor/internal/credential"
+	"anti2api-golang/refactor/internal/logger"
+	"anti2api-golang/refactor/internal/pkg/id"
+	"anti2api-golang/refactor/internal/pkg/modelutil"
+	"anti2api-golang/refactor/internal/vertex"
+)
+
+const (
+	// endpointProbeFile 为保存最近一次端点探测结果的文件（位于 DATA_DIR）。
+	endpointProbeFile = "endpoint_probe.json"
+	// defaultProbeModel 为未指定模型时探测使用的模型（响应快、配额充足）。
+	defaultProbeModel = "gemini-2.5-flash"
+	// endpointProbeTimeout 为单个端点探测的超时时间。
+	endpointProbeTimeout = 60 * time.Second
+)
+
+// EndpointProbe 为一次端点探测：用同一账号、同一模型向每个端点各发一次很小的生成请求。
+type EndpointProbe struct {
+	Time    time.Time             `json:"time"`
+	Account string                `json:"account"`
+	Email   string                `json:"email,omitempty"`
+	Model   string                `json:"model"`
+	Results []EndpointProbeResult `json:"results"`
+}
+
+// EndpointProbeResult 为单个端点的探测结果；Status 为上游 HTTP 状态码，0 表示未得到响应（网络错误、超时）。
+type EndpointProbeResult struct {
+	Endpoint  string `json:"endpoint"`
+	Label     string `json:"label"`
+	Status    int    `json:"status"`
+	LatencyMs int64  `json:"latencyMs"`
+	Error     string `json:"error,omitempty"`
+}
+
+var lastEndpointProbe struct {
+	sync.Mutex
+	probe  *EndpointProbe
+	loaded bool
+}
+
+// HandleEndpointProbe 为端点延迟探测工具，用于选择端点模式：
+//   - GET 返回最近一次探测结果（保存在 DATA_DIR/endpoint_probe.json，重启后仍可查看）；
+//   - POST {"account": sessionId, "model": "..."} 用指定账号（为空时轮询选取）向 daily / autopush / production
+//     并发各发一次探测请求，返回各端点的状态码与延迟并保存。
+func HandleEndpointProbe(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet, http.MethodHead:
+		writeJSON(w, http.StatusOK, map[string]any{"probe": loadEndpointProbe()})
+		return
+	case http.MethodPost:
+	default:
+		http.Error(w, "不支持的请求方法", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req struct {
+		Account string `json:"account"`
+		Model   string `json:"model"`
+	}
+	if err := json.NewDecoder(io.LimitReader(r.Body, 1<<16)).Decode(&req); err != nil && !errors.Is(err, io.EOF) {
+		writeJSON(w, http.StatusBadRequest, map[string]any{"error": "请求体不是有效的 JSON"})
+		return
+	}
+	model := strings.TrimSpace(req.Model)
+	if model == "" {
+		model = defaultProbeModel
+	}
+
+	store := credential.GetStore()
+	var (
+		account *credential.Account
+		err     error
+	)
+	if sessionID := strings.TrimSpace(req.Account); sessionID != "" {
+		account, err = store.GetTokenBySessionID(sessionID)
+	} else {
+		account, err = store.GetToken()
+	}
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]any{"error": "无法获取账号: " + err.Error()})
+		return
+	}
+
+	probe := runEndpointProbe(r.Context(), account, model, config.RoundRobinEndpoints)
+	saveEndpointProbe(probe)
+	writeJSON(w, http.StatusOK, map[string]any{"probe": probe})
+}
+
+// runEndpointProbe 并发向 endpoints 中的每个端点发送一次最小的生成请求（不重试），按 endpoints 的顺序返回结果。
+func runEndpointProbe(ctx context.Context, account *credential.Account, model string, endpoints []string) *EndpointProbe {
+	projectID := account.ProjectID
+	if projectID == "" {
+		projectID = id.ProjectID()
+	}
+	probe := &EndpointProbe{
+		Time:    time.Now(),
+		Account: account.SessionID,
+		Email:   account.Email,
+		Model:   model,
+		Results: make([]EndpointProbeResult, len(endpoints)),
+	}
+
+	var wg sync.WaitGroup
+	for i, key := range endpoints {
+		probe.Results[i] = EndpointProbeResult{Endpoint: key, Label: config.APIEndpoints[key].Label}
+		wg.Add(1)
+		go func(res *EndpointProbeResult) {
+			defer wg.Done()
+			req := &vertex.Request{
+				Project:     projectID,
+				Model:       modelutil.BackendModelID(model),
+				RequestID:   id.RequestID(),
+				RequestType: "agent",
+				UserAgent:   "antigravity",
+				Request: vertex.InnerReq{
+					Contents:         []vertex.Content{{Role: "user", Parts: []vertex.Part{{Text: "ping"}}}},
+					GenerationConfig: &vertex.GenerationConfig{MaxOutputTokens: 8},
+					SessionID:        id.SessionID(),
+				},
+			}
+			pctx, cancel := context.WithTimeout(vertex.WithEndpoint(ctx, res.Endpoint), endpointProbeTimeout)
+			defer cancel()
+			start := time.Now()
+			_, err := vertex.GetClient().SendRequest(pctx, req, account.AccessToken)
+			res.LatencyMs = time.Since(start).Milliseconds()
+			res.Status = http.StatusOK
+			if err != nil {
+				res.Status, res.Error = 0, err.Error()
+				var apiErr *vertex.APIError
+				if errors.As(err, &apiErr) {
+					res.Status, res.Error = apiErr.Status, apiErr.Message
+				}
+			}
+		}(&probe.Results[i])
+	}
+	wg.Wait()
+	return probe
+}
+
+// loadEndpointProbe 返回最近一次探测结果，首次调用时从文件读取；没有记录时返回 nil。
+func loadEndpointProbe() *EndpointProbe {
+	lastEndpointProbe.Lock()
+	defer lastEndpointProbe.Unlock()
+	if !lastEndpointProbe.loaded {
+		lastEndpointProbe.loaded = true
+		if data, err := os.ReadFile(filepath.Join(config.Get().DataDir, endpointProbeFile)); err == nil {
+			var p EndpointProbe
+			if err := json.Unmarshal(data, &p); err == nil {
+				lastEndpointProbe.probe = &p
+			}
+		}
+	}
+	return lastEndpointProbe.probe
+}
+
+// saveEndpointProbe 记录探测结果并写入文件（数据目录只读时只保存在内存中）。
+func saveEndpointProbe(p *EndpointProbe) {
+	lastEndpointProbe.Lock()
+	defer lastEndpointProbe.Unlock()
+	lastEndpointProbe.probe, lastEndpointProbe.loaded = p, true
+	if config.DataDirReadOnly() {
+		return
+	}
+	data, err := json.MarshalIndent(p, "", "  ")
+	if err != nil {
+		return
+	}
+	path := filepath.Join(config.Get().DataDir, endpointProbeFile)
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o644); err == nil {
+		err = os.Rename(tmp, path)
+	}
+	if err != nil {
+		logger.Warn("保存端点探测结果失败: %v", err)
+	}
+}
@@ -0,0 +1,43 @@
+package manager
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"anti2api-golang/refactor/internal/config"
+)
+
+func TestEndpointProbe_PersistsLastResult(t *testing.T) {
+	c := config.Get()
+	old := c.DataDir
+	c.DataDir = t.TempDir()
+	t.Cleanup(func() {
+		c.DataDir = old
+		lastEndpointProbe.Lock()
+		lastEndpointProbe.probe, lastEndpointProbe.loaded = nil, false
+		lastEndpointProbe.Unlock()
+	})
+
+	saveEndpointProbe(&EndpointProbe{
+		Time:  time.Now(),
+		Model: "gemini-2.5-flash",
+		Results: []EndpointProbeResult{
+			{Endpoint: "daily", Status: 200, LatencyMs: 120},
+			{Endpoint: "production", Status: 0, Error: "timeout"},
+		},
+	})
+
+	// 模拟重启：清空内存中的记录后应从文件读取。
+	lastEndpointProbe.Lock()
+	lastEndpointProbe.probe, lastEndpointProbe.loaded = nil, false
+	lastEndpointProbe.Unlock()
+
+	w := httptest.NewRecorder()
+	HandleEndpointProbe(w, httptest.NewRequest(http.MethodGet, "/manager/api/endpoint/probe", nil))
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), `"latencyMs":120`) || !strings.Contains(w.Body.String(), `"error":"timeout"`) {
+		t.Fatalf("unexpected response %d %s", w.Code, w.Body.String())
+	}
+}
@@ -8,30 +8,36 @@ import (
 	"io"
 	"net/http"
 	"sort"
+	"strconv"
 	"strings"
-	"sync"
 	"time"
 
 	"anti2api-golang/refactor/internal/config"
 	"anti2api-golang/refactor/internal/credential"
 	"anti2api-golang/refactor/internal/gateway/manager/views"
 	"anti2api-golang/refactor/internal/logger"
+	httppkg "anti2api-golang/refactor/internal/pkg/http"
 	"anti2api-golang/refactor/internal/pkg/id"
 	"anti2api-golang/refactor/internal/vertex"
 )
 
-const sessionCookieName = "grok_admin_session"
+// SessionCookieName 为管理面板登录会话的 Cookie 名（OpenAPI 描述中的 managerSession 鉴权）。
+const SessionCookieName = "grok_admin_session"
 
 func ManagerAuth(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		// Check cookie
-		if cookie, err := r.Cookie(sessionCookieName); err == nil && cookie.Value == "authenticated" {
+		if cookie, err := r.Cookie(SessionCookieName); err == nil && cookie.Value == "authenticated" {
 			next.ServeHTTP(w, r)
 			return
 		}
 
 		// If API request, return 401
 		if strings.HasPrefix(r.URL.Path, "/manager/api") {
+			if SetupRequired() {
+				http.Error(w, "尚未完成初始化，请先访问 /setup", http.StatusUnauthorized)
+				return
+			}
 			http.Error(w, "未登录或会话已过期，请先登录管理面板", http.StatusUnauthorized)
 			return
 		}
@@ -39,16 +45,24 @@ func ManagerAuth(next http.Handler) http.Handler {
 		// Otherwise redirect to login
 		// If it is the login page itself, don't redirect (handled by mux usually, but let's be safe if this is applied globally to /manager)
 		// In our router we will apply this to /manager and others but not login.
+		if SetupRequired() {
+			http.Redirect(w, r, "/setup", http.StatusFound)
+			return
+		}
 		http.Redirect(w, r, "/login", http.StatusFound)
 	})
 }
 
 func HandleLoginView(w http.ResponseWriter, r *http.Request) {
 	// If already logged in, redirect to manager
-	if cookie, err := r.Cookie(sessionCookieName); err == nil && cookie.Value == "authenticated" {
+	if cookie, err := r.Cookie(SessionCookieName); err == nil && cookie.Value == "authenticated" {
 		http.Redirect(w, r, "/", http.StatusFound)
 		return
 	}
+	if SetupRequired() {
+		http.Redirect(w, r, "/setup", http.StatusFound)
+		return
+	}
 	views.Login("").Render(r.Context(), w)
 }
 
@@ -65,27 +79,58 @@ func HandleLogin(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	ip := httppkg.ClientIP(r)
+	if remaining := defaultLoginGuard.locked(ip); remaining > 0 {
+		w.Header().Set("Retry-After", strconv.Itoa(int(remaining.Seconds())+1))
+		views.Login(fmt.Sprintf("登录失败次数过多，请 %s 后再试", formatLockout(remaining))).Render(r.Context(), w)
+		return
+	}
+
 	password := r.FormValue("password")
 	if password == adminPassword {
-		http.SetCookie(w, &http.Cookie{
-			Name:     sessionCookieName,
-			Value:    "authenticated",
-			Path:     "/",
-			HttpOnly: true,
-			Expires:  time.Now().Add(24 * time.Hour),
-		})
+		defaultLoginGuard.succeed(ip)
+		logger.Info("[审计] 管理面板登录成功 ip=%s", ip)
+		setSessionCookie(w)
 		// HTMX redirect
 		w.Header().Set("HX-Redirect", "/")
 		w.Write([]byte("登录成功"))
 		return
 	}
 
+	failures, lockout := defaultLoginGuard.fail(ip)
+	logger.Warn("[审计] 管理面板登录失败 ip=%s 连续失败 %d 次", ip, failures)
+	if lockout > 0 {
+		logger.Warn("[审计] 管理面板登录已锁定 ip=%s 锁定 %s", ip, formatLockout(lockout))
+		sendLoginAlert(ip, failures, time.Now().Add(lockout))
+		w.Header().Set("Retry-After", strconv.Itoa(int(lockout.Seconds())))
+		views.Login(fmt.Sprintf("密码错误，登录失败次数过多，请 %s 后再试", formatLockout(lockout))).Render(r.Context(), w)
+		return
+	}
+
 	views.Login("密码错误").Render(r.Context(), w)
 }
 
+// formatLockout 将锁定时长格式化为便于阅读的中文（向上取整到秒 / 分钟）。
+func formatLockout(d time.Duration) string {
+	if d < time.Minute {
+		return fmt.Sprintf("%d 秒", int((d+time.Second-1)/time.Second))
+	}
+	return fmt.Sprintf("%d 分钟", int((d+time.Minute-1)/time.Minute))
+}
+
+func setSessionCookie(w http.ResponseWriter) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     SessionCookieName,
+		Value:    "authenticated",
+		Path:     "/",
+		HttpOnly: true,
+		Expires:  time.Now().Add(24 * time.Hour),
+	})
+}
+
 func HandleLogout(w http.ResponseWriter, r *http.Request) {
 	http.SetCookie(w, &http.Cookie{
-		Name:     sessionCookieName,
+		Name:     SessionCookieName,
 		Value:    "",
 		Path:     "/",
 		HttpOnly: true,
@@ -191,7 +236,12 @@ func HandleDelete(w http.ResponseWriter, r *http.Request) {
 	id := r.URL.Query().Get("id")
 	idx := findIndexBySessionID(id)
 	if idx != -1 {
-		credential.GetStore().Delete(idx)
+		if err := credential.GetStore().Delete(idx); err != nil {
+			logger.Error("删除账号失败：%v", err)
+			http.Error(w, "删除失败", http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("HX-Trigger", "refreshStats, refreshArchive")
 		w.Write([]byte(""))
 	} else {
 		http.Error(w, "未找到", http.StatusNotFound)
@@ -320,42 +370,7 @@ func HandleQuotaAll(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	type result struct {
-		sessionID string
-		groups    []QuotaGroup
-		cached    bool
-		err       error
-	}
-
-	results := make([]result, len(accounts))
-
-	sem := make(chan struct{}, quotaMaxConcurrency)
-	wg := sync.WaitGroup{}
-
-	for i, acc := range accounts {
-		i := i
-		acc := acc
-		wg.Add(1)
-		go func() {
-			defer wg.Done()
-
-			select {
-			case sem <- struct{}{}:
-			case <-r.Context().Done():
-				return
-			}
-			defer func() { <-sem }()
-
-			q, cached, err := GetAccountQuotaCached(r.Context(), acc, force)
-			if err != nil || q == nil {
-				results[i] = result{sessionID: acc.SessionID, cached: cached, err: err}
-				return
-			}
-			results[i] = result{sessionID: acc.SessionID, groups: q.Groups, cached: cached}
-		}()
-	}
-
-	wg.Wait()
+	results := fetchAllQuotas(r.Context(), accounts, force)
 
 	if isHTMX(r) {
 		w.Header().Set("Content-Type", "text/html; charset=utf-8")
@@ -411,6 +426,9 @@ func quotaErrorMessage(err error) string {
 		return "无法获取配额：" + err.Error()
 	}
 
+	if errors.Is(err, errQuotaPending) {
+		return err.Error()
+	}
 	if errors.Is(err, context.DeadlineExceeded) {
 		return "请求超时，无法获取配额"
 	}
@@ -582,7 +600,13 @@ func HandleSettingsGet(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	writeJSON(w, http.StatusOK, settings)
+	writeJSON(w, http.StatusOK, settingsPayload{WebUISettings: settings, EndpointMode: config.GetEndpointManager().GetMode()})
+}
+
+// settingsPayload 为设置接口的 JSON 结构：WebUI 设置之外附带端点模式（POST 时为空表示不修改，也可通过 /manager/api/endpoint 单独切换）。
+type settingsPayload struct {
+	config.WebUISettings
+	EndpointMode string `json:"endpointMode"`
 }
 
 // HandleSettingsPost saves the settings to .env file and updates in-memory config
@@ -592,11 +616,17 @@ func HandleSettingsPost(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	var req config.WebUISettings
-	if err := json.NewDecoder(io.LimitReader(r.Body, 1<<20)).Decode(&req); err != nil {
+	var payload settingsPayload
+	if err := json.NewDecoder(io.LimitReader(r.Body, 1<<20)).Decode(&payload); err != nil {
 		writeJSON(w, http.StatusBadRequest, map[string]any{"error": "请求体不是有效的 JSON"})
 		return
 	}
+	req := payload.WebUISettings
+	endpointMode := strings.ToLower(strings.TrimSpace(payload.EndpointMode))
+	if endpointMode != "" && !config.ValidEndpointMode(endpointMode) {
+		writeJSON(w, http.StatusBadRequest, map[string]any{"error": "未知的端点模式：" + payload.EndpointMode})
+		return
+	}
 
 	// Validate required fields
 	if strings.TrimSpace(req.WebUIPassword) == "" {
@@ -615,12 +645,29 @@ func HandleSettingsPost(w http.ResponseWriter, r *http.Request) {
 	}
 	req.Debug = debug
 
+	if req.QuotaRefreshIntervalMinutes < 0 {
+		writeJSON(w, http.StatusBadRequest, map[string]any{"error": "配额刷新间隔不能为负数"})
+		return
+	}
+	if req.QuotaLowThresholdPercent < 0 || req.QuotaLowThresholdPercent > 100 {
+		writeJSON(w, http.StatusBadRequest, map[string]any{"error": "低配额阈值必须在 0-100 之间"})
+		return
+	}
+
 	// Update settings
 	if err := config.UpdateWebUISettings(req); err != nil {
 		logger.Error("保存设置失败: %v", err)
 		writeJSON(w, http.StatusInternalServerError, map[string]any{"error": "保存设置失败: " + err.Error()})
 		return
 	}
+	if endpointMode != "" && endpointMode != config.GetEndpointManager().GetMode() {
+		if err := config.GetEndpointManager().SetMode(endpointMode); err != nil {
+			logger.Error("保存端点模式失败: %v", err)
+			writeJSON(w, http.StatusInternalServerError, map[string]any{"error": "保存端点模式失败: " + err.Error()})
+			return
+		}
+		logger.Info("端点模式已切换为 %s", endpointMode)
+	}
 
 	logger.Info("设置已更新: Debug=%s, UserAgent=%s", req.Debug, req.UserAgent)
 	writeJSON(w, http.StatusOK, map[string]any{"success": true})
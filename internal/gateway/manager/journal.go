@@ -0,0 +1,28 @@
+package manager
+
+import (
+	"net/http"
+	"strconv"
+
+	"anti2api-golang/refactor/internal/journal"
+)
+
+const defaultJournalLimit = 200
+
+// HandleJournal 返回请求日志：最近的事件以及当前未结束的请求（按最近一次启动计算）。
+func HandleJournal(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		http.Error(w, "不支持的请求方法", http.StatusMethodNotAllowed)
+		return
+	}
+
+	limit, _ := strconv.Atoi(r.URL.Query().Get("limit"))
+	if limit <= 0 {
+		limit = defaultJournalLimit
+	}
+	writeJSON(w, http.StatusOK, map[string]any{
+		"enabled":    journal.Enabled(),
+		"unfinished": journal.Unfinished(),
+		"events":     journal.Tail(limit),
+	})
+}
@@ -0,0 +1,145 @@
+package manager
+
+import (
+	"bytes"
+	"net/http"
+	"sync"
+	"time"
+
+	"anti2api-golang/refactor/internal/config"
+	"anti2api-golang/refactor/internal/logger"
+	jsonpkg "anti2api-golang/refactor/internal/pkg/json"
+)
+
+const (
+	maxLoginLockout   = time.Hour
+	loginEntryTTL     = 24 * time.Hour
+	loginPruneTrigger = 1024
+)
+
+// loginGuard 按 IP 记录管理面板登录失败次数：连续失败达到阈值后锁定，
+// 锁定时长从基础时长起每次失败翻倍（最长 1 小时），登录成功后清零。
+type loginGuard struct {
+	mu      sync.Mutex
+	entries map[string]*loginAttempts
+	now     func() time.Time
+}
+
+type loginAttempts struct {
+	failures    int
+	lockedUntil time.Time
+	lastSeen    time.Time
+}
+
+var defaultLoginGuard = newLoginGuard()
+
+func newLoginGuard() *loginGuard {
+	return &loginGuard{entries: make(map[string]*loginAttempts), now: time.Now}
+}
+
+// locked 返回 ip 剩余的锁定时长，未锁定时为 0。
+func (g *loginGuard) locked(ip string) time.Duration {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if e, ok := g.entries[ip]; ok {
+		if remaining := e.lockedUntil.Sub(g.now()); remaining > 0 {
+			return remaining
+		}
+	}
+	return 0
+}
+
+// fail 记录一次失败，返回连续失败次数与本次触发的锁定时长（未锁定为 0）。
+func (g *loginGuard) fail(ip string) (int, time.Duration) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	now := g.now()
+	if len(g.entries) >= loginPruneTrigger {
+		g.pruneLocked(now)
+	}
+
+	e, ok := g.entries[ip]
+	if !ok {
+		e = &loginAttempts{}
+		g.entries[ip] = e
+	}
+	e.failures++
+	e.lastSeen = now
+
+	cfg := config.Get()
+	if cfg.LoginMaxFailures <= 0 || e.failures < cfg.LoginMaxFailures {
+		return e.failures, 0
+	}
+	lockout := time.Duration(cfg.LoginLockoutSeconds) * time.Second
+	if lockout <= 0 {
+		lockout = time.Minute
+	}
+	for i := cfg.LoginMaxFailures; i < e.failures && lockout < maxLoginLockout; i++ {
+		lockout *= 2
+	}
+	if lockout > maxLoginLockout {
+		lockout = maxLoginLockout
+	}
+	e.lockedUntil = now.Add(lockout)
+	return e.failures, lockout
+}
+
+// pruneLocked 删除超过 loginEntryTTL 未再失败且未处于锁定中的记录，返回删除的数量。
+func (g *loginGuard) pruneLocked(now time.Time) int {
+	n := 0
+	for k, e := range g.entries {
+		if now.Sub(e.lastSeen) > loginEntryTTL && !e.lockedUntil.After(now) {
+			delete(g.entries, k)
+			n++
+		}
+	}
+	return n
+}
+
+// ReapLoginAttempts 清理过期的登录失败记录（供 reaper 定期调用），返回删除的数量。
+func ReapLoginAttempts(now time.Time) int {
+	defaultLoginGuard.mu.Lock()
+	defer defaultLoginGuard.mu.Unlock()
+	return defaultLoginGuard.pruneLocked(now)
+}
+
+func (g *loginGuard) succeed(ip string) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	delete(g.entries, ip)
+}
+
+type loginAlert struct {
+	Event       string    `json:"event"`
+	IP          string    `json:"ip"`
+	Failures    int       `json:"failures"`
+	LockedUntil time.Time `json:"lockedUntil"`
+	Time        time.Time `json:"time"`
+}
+
+var loginAlertClient = &http.Client{Timeout: 5 * time.Second}
+
+// sendLoginAlert 在配置了 LOGIN_ALERT_WEBHOOK_URL 时异步发送登录锁定告警。
+func sendLoginAlert(ip string, failures int, lockedUntil time.Time) {
+	url := config.Get().LoginAlertWebhookURL
+	if url == "" {
+		return
+	}
+	body, err := jsonpkg.Marshal(loginAlert{Event: "login_lockout", IP: ip, Failures: failures, LockedUntil: lockedUntil, Time: time.Now()})
+	if err != nil {
+		return
+	}
+	go func() {
+		resp, err := loginAlertClient.Post(url, "application/json", bytes.NewReader(body))
+		if err != nil {
+			logger.Warn("登录告警 Webhook 调用失败: %v", err)
+			return
+		}
+		_ = resp.Body.Close()
+		if resp.StatusCode < 200 || resp.StatusCode > 299 {
+			logger.Warn("登录告警 Webhook 返回 HTTP %d", resp.StatusCode)
+		}
+	}()
+}
@@ -0,0 +1,55 @@
+package manager
+
+import (
+	"testing"
+	"time"
+
+	"anti2api-golang/refactor/internal/config"
+)
+
+func TestLoginGuard_ExponentialLockout(t *testing.T) {
+	c := config.Get()
+	oldMax, oldLock := c.LoginMaxFailures, c.LoginLockoutSeconds
+	c.LoginMaxFailures, c.LoginLockoutSeconds = 3, 10
+	t.Cleanup(func() { c.LoginMaxFailures, c.LoginLockoutSeconds = oldMax, oldLock })
+
+	now := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	g := newLoginGuard()
+	g.now = func() time.Time { return now }
+
+	for i := 1; i < 3; i++ {
+		if n, lock := g.fail("1.2.3.4"); n != i || lock != 0 {
+			t.Fatalf("failure %d: got n=%d lock=%v", i, n, lock)
+		}
+	}
+	if _, lock := g.fail("1.2.3.4"); lock != 10*time.Second {
+		t.Fatalf("expected 10s lockout at threshold, got %v", lock)
+	}
+	if g.locked("1.2.3.4") != 10*time.Second || g.locked("5.6.7.8") != 0 {
+		t.Fatalf("lockout must apply per IP")
+	}
+	if _, lock := g.fail("1.2.3.4"); lock != 20*time.Second {
+		t.Fatalf("expected lockout to double, got %v", lock)
+	}
+
+	for i := 0; i < 20; i++ {
+		g.fail("1.2.3.4")
+	}
+	if _, lock := g.fail("1.2.3.4"); lock != maxLoginLockout {
+		t.Fatalf("expected lockout capped at %v, got %v", maxLoginLockout, lock)
+	}
+
+	g.succeed("1.2.3.4")
+	if g.locked("1.2.3.4") != 0 {
+		t.Fatalf("success should clear lockout")
+	}
+}
+
+func TestFormatLockout(t *testing.T) {
+	if got := formatLockout(1500 * time.Millisecond); got != "2 秒" {
+		t.Fatalf("got %q", got)
+	}
+	if got := formatLockout(61 * time.Second); got != "2 分钟" {
+		t.Fatalf("got %q", got)
+	}
+}
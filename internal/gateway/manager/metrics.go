@@ -0,0 +1,27 @@
+package manager
+
+import (
+	"net/http"
+
+	gwcommon "anti2api-golang/refactor/internal/gateway/common"
+	"anti2api-golang/refactor/internal/middleware"
+	"anti2api-golang/refactor/internal/pkg/jsonrepair"
+	"anti2api-golang/refactor/internal/reaper"
+	"anti2api-golang/refactor/internal/usage"
+)
+
+// HandleMetrics 返回进程内的运行计数（工具调用参数修复次数、生成请求并发与拒绝次数、按模型的 token 用量、后台资源回收数量、
+// 对话轮次上限与拒绝次数）。
+func HandleMetrics(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		http.Error(w, "不支持的请求方法", http.StatusMethodNotAllowed)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]any{
+		"toolArgsRepair": jsonrepair.Stats(),
+		"inFlight":       middleware.InFlight(),
+		"usage":          usage.Snapshot(),
+		"reaper":         reaper.Stats(),
+		"turns":          gwcommon.Turns(),
+	})
+}
@@ -11,6 +11,7 @@ import (
 	"anti2api-golang/refactor/internal/credential"
 	"anti2api-golang/refactor/internal/pkg/id"
 	"anti2api-golang/refactor/internal/pkg/modelutil"
+	"anti2api-golang/refactor/internal/quota"
 	"anti2api-golang/refactor/internal/vertex"
 )
 
@@ -22,12 +23,8 @@ const (
 	quotaGroupGemini25        = "Gemini 2.5 Pro/Flash/Lite"
 )
 
-type QuotaGroup struct {
-	GroupName         string   `json:"groupName"`
-	RemainingFraction *float64 `json:"remainingFraction,omitempty"`
-	ResetTime         string   `json:"resetTime,omitempty"`
-	ModelList         []string `json:"modelList,omitempty"`
-}
+// QuotaGroup 为一个配额组，与 quota 包中的快照共用同一类型。
+type QuotaGroup = quota.Group
 
 type AccountQuota struct {
 	SessionID string       `json:"sessionId"`
@@ -56,11 +53,13 @@ func FetchAccountQuota(ctx context.Context, account credential.Account) (*Accoun
 	}
 
 	groups := groupQuotaGroups(vm.Models)
-	return &AccountQuota{
+	q := &AccountQuota{
 		SessionID: account.SessionID,
 		Groups:    groups,
 		FetchedAt: time.Now(),
-	}, nil
+	}
+	quota.Put(q.SessionID, q.Groups, q.FetchedAt)
+	return q, nil
 }
 
 func groupQuotaKey(modelID string) string {
@@ -7,16 +7,49 @@ import (
 	"sync"
 	"time"
 
+	"anti2api-golang/refactor/internal/config"
 	"anti2api-golang/refactor/internal/credential"
 )
 
-const (
-	quotaCacheTTL       = 2 * time.Minute
-	quotaErrorCacheTTL  = 30 * time.Second
-	quotaFetchTimeout   = 20 * time.Second
-	quotaMaxConcurrency = 4
+// fetchAccountQuota 为实际的配额请求，测试中替换。
+var fetchAccountQuota = FetchAccountQuota
+
+// quotaErrorCacheTTL 为获取失败结果的缓存时间（不超过 QUOTA_CACHE_TTL_SECONDS）。
+const quotaErrorCacheTTL = 30 * time.Second
+
+// errQuotaPending 表示账号配额在 QUOTA_PAGE_WAIT_SECONDS 内未获取完成，仍在后台继续。
+var errQuotaPending = errors.New("配额仍在获取中，请稍后刷新")
+
+// quotaSem 限制同时进行的配额获取数量（QUOTA_FETCH_CONCURRENCY），管理面板与后台定时刷新共用；命中缓存不占用名额。
+var (
+	quotaSem     chan struct{}
+	quotaSemOnce sync.Once
 )
 
+func quotaCacheTTL() time.Duration {
+	return time.Duration(max(config.Get().QuotaCacheTTLSeconds, 0)) * time.Second
+}
+
+func quotaFetchTimeout() time.Duration {
+	if sec := config.Get().QuotaFetchTimeoutSeconds; sec > 0 {
+		return time.Duration(sec) * time.Second
+	}
+	return 20 * time.Second
+}
+
+// acquireQuotaSlot 占用一个配额获取名额，返回释放函数；ctx 先结束时返回 ctx.Err()。
+func acquireQuotaSlot(ctx context.Context) (func(), error) {
+	quotaSemOnce.Do(func() {
+		quotaSem = make(chan struct{}, max(config.Get().QuotaFetchConcurrency, 1))
+	})
+	select {
+	case quotaSem <- struct{}{}:
+		return func() { <-quotaSem }, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
 type quotaCacheEntry struct {
 	quota     *AccountQuota
 	err       error
@@ -97,12 +130,11 @@ func GetAccountQuotaCached(ctx context.Context, account credential.Account, forc
 
 	delete(quotaState.inflight, sessionID)
 
-	cacheUntil := time.Time{}
-	if err == nil {
-		cacheUntil = time.Now().Add(quotaCacheTTL)
-	} else {
-		cacheUntil = time.Now().Add(quotaErrorCacheTTL)
+	ttl := quotaCacheTTL()
+	if err != nil {
+		ttl = min(ttl, quotaErrorCacheTTL)
 	}
+	cacheUntil := time.Now().Add(ttl)
 	quotaState.cache[sessionID] = quotaCacheEntry{quota: quota, err: err, expiresAt: cacheUntil}
 
 	inflight.quota = quota
@@ -114,11 +146,73 @@ func GetAccountQuotaCached(ctx context.Context, account credential.Account, forc
 }
 
 func fetchQuotaOnce(ctx context.Context, account credential.Account) (*AccountQuota, error) {
-	cctx, cancel := context.WithTimeout(ctx, quotaFetchTimeout)
+	release, err := acquireQuotaSlot(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+
+	cctx, cancel := context.WithTimeout(ctx, quotaFetchTimeout())
 	defer cancel()
-	q, err := FetchAccountQuota(cctx, account)
+	q, err := fetchAccountQuota(cctx, account)
 	if err != nil && errors.Is(ctx.Err(), context.Canceled) {
 		return nil, ctx.Err()
 	}
 	return q, err
 }
+
+// quotaResult 为单个账号的配额获取结果。
+type quotaResult struct {
+	sessionID string
+	groups    []QuotaGroup
+	cached    bool
+	err       error
+}
+
+// fetchAllQuotas 并发获取所有账号的配额（并发数受 QUOTA_FETCH_CONCURRENCY 限制），最多等待 QUOTA_PAGE_WAIT_SECONDS（<=0 表示等待全部完成）。
+// 届时仍未完成的账号返回 errQuotaPending；其获取不随请求取消，在后台完成后写入缓存，下次刷新即可命中。
+func fetchAllQuotas(ctx context.Context, accounts []credential.Account, force bool) []quotaResult {
+	var mu sync.Mutex
+	results := make([]quotaResult, len(accounts))
+	for i, acc := range accounts {
+		results[i] = quotaResult{sessionID: acc.SessionID, err: errQuotaPending}
+	}
+
+	fetchCtx := context.WithoutCancel(ctx)
+	var wg sync.WaitGroup
+	for i, acc := range accounts {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			q, cached, err := GetAccountQuotaCached(fetchCtx, acc, force)
+			res := quotaResult{sessionID: acc.SessionID, cached: cached, err: err}
+			if err == nil && q != nil {
+				res.groups = q.Groups
+			}
+			mu.Lock()
+			results[i] = res
+			mu.Unlock()
+		}()
+	}
+
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+	var timeout <-chan time.Time
+	if wait := time.Duration(config.Get().QuotaPageWaitSeconds) * time.Second; wait > 0 {
+		timer := time.NewTimer(wait)
+		defer timer.Stop()
+		timeout = timer.C
+	}
+	select {
+	case <-done:
+	case <-timeout:
+	case <-ctx.Done():
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	return append([]quotaResult(nil), results...)
+}
@@ -0,0 +1,57 @@
+package manager
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"anti2api-golang/refactor/internal/config"
+	"anti2api-golang/refactor/internal/credential"
+)
+
+func TestFetchAllQuotas_ReturnsPartialResultsAndFinishesInBackground(t *testing.T) {
+	c := config.Get()
+	oldWait := c.QuotaPageWaitSeconds
+	c.QuotaPageWaitSeconds = 1
+	release := make(chan struct{})
+	oldFetch := fetchAccountQuota
+	fetchAccountQuota = func(ctx context.Context, acc credential.Account) (*AccountQuota, error) {
+		if acc.SessionID == "quota-slow" {
+			<-release
+		}
+		return &AccountQuota{SessionID: acc.SessionID, Groups: []QuotaGroup{{GroupName: acc.SessionID}}, FetchedAt: time.Now()}, nil
+	}
+	t.Cleanup(func() {
+		c.QuotaPageWaitSeconds = oldWait
+		fetchAccountQuota = oldFetch
+		InvalidateQuotaCache("quota-fast")
+		InvalidateQuotaCache("quota-slow")
+	})
+
+	accounts := []credential.Account{{SessionID: "quota-fast"}, {SessionID: "quota-slow"}}
+	ctx, cancel := context.WithCancel(context.Background())
+	results := fetchAllQuotas(ctx, accounts, true)
+	cancel()
+
+	if results[0].err != nil || len(results[0].groups) != 1 {
+		t.Fatalf("fast account: %+v", results[0])
+	}
+	if !errors.Is(results[1].err, errQuotaPending) || quotaErrorMessage(results[1].err) != errQuotaPending.Error() {
+		t.Fatalf("slow account should be pending: %+v", results[1])
+	}
+
+	// 请求结束后获取仍在后台继续，完成后写入缓存。
+	close(release)
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		q, cached, err := GetAccountQuotaCached(context.Background(), accounts[1], false)
+		if cached && err == nil && q != nil {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("background fetch was not cached: cached=%v err=%v", cached, err)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
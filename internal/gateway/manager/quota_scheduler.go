@@ -0,0 +1,90 @@
+package manager
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"anti2api-golang/refactor/internal/config"
+	"anti2api-golang/refactor/internal/credential"
+	"anti2api-golang/refactor/internal/logger"
+)
+
+// quotaSchedulerIdleCheck 为定时刷新关闭时重新检查设置的间隔（设置可在管理面板中随时修改）。
+const quotaSchedulerIdleCheck = time.Minute
+
+// StartQuotaScheduler 启动后台配额刷新任务：每 QUOTA_REFRESH_INTERVAL_MINUTES 分钟刷新一次所有启用账号的配额，
+// 并将所有模型组剩余配额都不高于 QUOTA_LOW_THRESHOLD_PERCENT 的账号排到轮询最后。
+func StartQuotaScheduler() {
+	go func() {
+		logger.Info("配额定时刷新任务已启动")
+		for {
+			interval := time.Duration(config.Get().QuotaRefreshIntervalMinutes) * time.Minute
+			if interval <= 0 {
+				time.Sleep(quotaSchedulerIdleCheck)
+				continue
+			}
+			refreshQuotaAndRotate(context.Background())
+			time.Sleep(interval)
+		}
+	}()
+}
+
+// refreshQuotaAndRotate 强制刷新所有启用账号的配额（同时更新管理面板的配额缓存），并更新低配额账号集合。
+// 获取失败的账号沿用上一次的标记。
+func refreshQuotaAndRotate(ctx context.Context) {
+	store := credential.GetStore()
+	threshold := float64(config.Get().QuotaLowThresholdPercent) / 100
+
+	var (
+		mu  sync.Mutex
+		low = make(map[string]bool)
+		wg  sync.WaitGroup
+	)
+	failed := 0
+	for _, acc := range store.GetAll() {
+		if !acc.Enable {
+			continue
+		}
+		acc := acc
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			q, _, err := GetAccountQuotaCached(ctx, acc, true)
+			mu.Lock()
+			defer mu.Unlock()
+			if err != nil || q == nil {
+				failed++
+				if store.IsLowQuota(acc.SessionID) {
+					low[acc.SessionID] = true
+				}
+				return
+			}
+			if threshold > 0 && isQuotaNearlyExhausted(q.Groups, threshold) {
+				low[acc.SessionID] = true
+			}
+		}()
+	}
+	wg.Wait()
+
+	store.SetLowQuota(low)
+	if len(low) > 0 || failed > 0 {
+		logger.Info("配额定时刷新完成: 低配额账号 %d, 获取失败 %d", len(low), failed)
+	}
+}
+
+// isQuotaNearlyExhausted 在所有已知模型组的剩余配额都不高于 threshold 时返回 true（没有任何配额信息时返回 false）。
+func isQuotaNearlyExhausted(groups []QuotaGroup, threshold float64) bool {
+	known := false
+	for _, g := range groups {
+		if g.RemainingFraction == nil {
+			continue
+		}
+		known = true
+		if *g.RemainingFraction > threshold {
+			return false
+		}
+	}
+	return known
+}
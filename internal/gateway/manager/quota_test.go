@@ -54,3 +54,17 @@ func abs(v float64) float64 {
 	}
 	return v
 }
+
+func TestIsQuotaNearlyExhausted(t *testing.T) {
+	f := func(v float64) *float64 { return &v }
+
+	if !isQuotaNearlyExhausted([]QuotaGroup{{RemainingFraction: f(0.05)}, {RemainingFraction: f(0.1)}, {}}, 0.1) {
+		t.Fatalf("expected all groups at or below threshold to be nearly exhausted")
+	}
+	if isQuotaNearlyExhausted([]QuotaGroup{{RemainingFraction: f(0.05)}, {RemainingFraction: f(0.5)}}, 0.1) {
+		t.Fatalf("expected an account with a healthy group not to be nearly exhausted")
+	}
+	if isQuotaNearlyExhausted([]QuotaGroup{{GroupName: "unknown"}}, 0.1) {
+		t.Fatalf("expected accounts without quota info not to be nearly exhausted")
+	}
+}
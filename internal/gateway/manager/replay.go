@@ -0,0 +1,235 @@
+package manager
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"anti2api-golang/refactor/internal/config"
+	"anti2api-golang/refactor/internal/credential"
+	"anti2api-golang/refactor/internal/gateway/manager/views"
+	"anti2api-golang/refactor/internal/pkg/id"
+	"anti2api-golang/refactor/internal/pkg/modelutil"
+	"anti2api-golang/refactor/internal/vertex"
+)
+
+// maxDiffCells 限制逐行差异的计算量（两侧行数之积），超过时只给出整体替换。
+const maxDiffCells = 4 << 20
+
+// replayRequest 为重放参数；model / account / endpoint 为空时分别沿用记录中的模型、轮询选取账号、按 ENDPOINT_MODE 选择端点。
+type replayRequest struct {
+	ID       string `json:"id"`
+	Model    string `json:"model"`
+	Account  string `json:"account"`
+	Endpoint string `json:"endpoint"`
+}
+
+// HandleTranscriptReplay 重放一条会话记录：将记录中的 Vertex 请求（即当时发往上游的请求）按指定的模型 / 账号 / 端点
+// 重新发送一次（非流式、不重试），并与当时的响应逐行比较，用于快速复现用户反馈的问题。
+// 参数可用 JSON 或表单提交，支持 tenant 查询参数；HTMX 请求返回 HTML 片段，否则返回 JSON。
+func HandleTranscriptReplay(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "不支持的请求方法", http.StatusMethodNotAllowed)
+		return
+	}
+	var req replayRequest
+	if strings.HasPrefix(r.Header.Get("Content-Type"), "application/json") {
+		if err := json.NewDecoder(io.LimitReader(r.Body, 1<<16)).Decode(&req); err != nil {
+			writeJSON(w, http.StatusBadRequest, map[string]any{"error": "请求体不是有效的 JSON"})
+			return
+		}
+	} else {
+		req = replayRequest{ID: r.FormValue("id"), Model: r.FormValue("model"), Account: r.FormValue("account"), Endpoint: r.FormValue("endpoint")}
+	}
+
+	store := transcriptStore(w, r)
+	if store == nil {
+		return
+	}
+	raw, ok := store.Find(strings.TrimSpace(req.ID))
+	if !ok {
+		writeReplayError(w, r, http.StatusNotFound, "未找到该会话记录")
+		return
+	}
+	result, err := replayTranscript(r, raw, req)
+	if err != nil {
+		writeReplayError(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+	if isHTMX(r) {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		views.TranscriptReplay(result).Render(r.Context(), w)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"replay": result})
+}
+
+func writeReplayError(w http.ResponseWriter, r *http.Request, status int, msg string) {
+	if isHTMX(r) {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		views.TranscriptReplay(views.ReplayResult{Error: msg}).Render(r.Context(), w)
+		return
+	}
+	writeJSON(w, status, map[string]any{"error": msg})
+}
+
+// replayTranscript 解析记录 raw 并按 req 重放；记录或参数无效时返回错误，上游失败记录在结果中。
+func replayTranscript(r *http.Request, raw []byte, req replayRequest) (views.ReplayResult, error) {
+	var rec struct {
+		Model          string          `json:"model"`
+		VertexRequest  json.RawMessage `json:"vertexRequest"`
+		VertexResponse json.RawMessage `json:"vertexResponse"`
+	}
+	if err := json.Unmarshal(raw, &rec); err != nil {
+		return views.ReplayResult{}, fmt.Errorf("会话记录无法解析: %w", err)
+	}
+	var vreq vertex.Request
+	if len(rec.VertexRequest) == 0 || string(rec.VertexRequest) == "null" || json.Unmarshal(rec.VertexRequest, &vreq) != nil {
+		return views.ReplayResult{}, errors.New("该记录没有可重放的 Vertex 请求（请求在转换前已失败）")
+	}
+
+	ctx := r.Context()
+	endpoint := strings.TrimSpace(req.Endpoint)
+	if endpoint != "" {
+		if _, ok := config.APIEndpoints[endpoint]; !ok {
+			return views.ReplayResult{}, fmt.Errorf("未知的端点：%s", endpoint)
+		}
+		ctx = vertex.WithEndpoint(ctx, endpoint)
+	}
+	store := credential.GetStore()
+	var (
+		account *credential.Account
+		err     error
+	)
+	if sessionID := strings.TrimSpace(req.Account); sessionID != "" {
+		account, err = store.GetTokenBySessionID(sessionID)
+	} else {
+		account, err = store.GetToken()
+	}
+	if err != nil {
+		return views.ReplayResult{}, fmt.Errorf("无法获取账号: %w", err)
+	}
+
+	model := strings.TrimSpace(req.Model)
+	if model == "" {
+		model = rec.Model
+	} else {
+		vreq.Model = modelutil.BackendModelID(model)
+	}
+	vreq.Project = account.ProjectID
+	if vreq.Project == "" {
+		vreq.Project = id.ProjectID()
+	}
+	vreq.RequestID = id.RequestID()
+
+	result := views.ReplayResult{Model: model, Account: account.Email, Endpoint: endpoint}
+	if result.Account == "" {
+		result.Account = account.SessionID
+	}
+	start := time.Now()
+	resp, err := vertex.GetClient().SendRequest(ctx, &vreq, account.AccessToken)
+	result.LatencyMs = time.Since(start).Milliseconds()
+	result.Status = http.StatusOK
+	if err != nil {
+		result.Status, result.Error = 0, err.Error()
+		var apiErr *vertex.APIError
+		if errors.As(err, &apiErr) {
+			result.Status, result.Error = apiErr.Status, apiErr.Message
+		}
+	}
+
+	var original *vertex.Response
+	if len(rec.VertexResponse) > 0 && string(rec.VertexResponse) != "null" {
+		original = &vertex.Response{}
+		if json.Unmarshal(rec.VertexResponse, original) != nil {
+			original = nil
+		}
+	}
+	result.Diff = diffLines(splitLines(replayText(original)), splitLines(replayText(resp)))
+	return result, nil
+}
+
+// replayText 将响应的首个候选转为便于比较的文本：正文原样输出，思考与函数调用各占带标记的行。
+func replayText(resp *vertex.Response) string {
+	if resp == nil || len(resp.Response.Candidates) == 0 {
+		return ""
+	}
+	var sb strings.Builder
+	for _, p := range resp.Response.Candidates[0].Content.Parts {
+		switch {
+		case p.FunctionCall != nil:
+			args, _ := json.Marshal(p.FunctionCall.Args)
+			fmt.Fprintf(&sb, "\n[functionCall] %s %s\n", p.FunctionCall.Name, args)
+		case p.Thought:
+			if p.Text != "" {
+				fmt.Fprintf(&sb, "[thought] %s\n", strings.ReplaceAll(p.Text, "\n", " "))
+			}
+		default:
+			sb.WriteString(p.Text)
+		}
+	}
+	return sb.String()
+}
+
+func splitLines(s string) []string {
+	s = strings.Trim(s, "\n")
+	if s == "" {
+		return nil
+	}
+	return strings.Split(s, "\n")
+}
+
+// diffLines 返回 a → b 的逐行差异（最长公共子序列）；行数之积超过 maxDiffCells 时给出整体删除 + 插入。
+func diffLines(a, b []string) []views.DiffLine {
+	if len(a)*len(b) > maxDiffCells {
+		out := make([]views.DiffLine, 0, len(a)+len(b))
+		for _, l := range a {
+			out = append(out, views.DiffLine{Op: "-", Text: l})
+		}
+		for _, l := range b {
+			out = append(out, views.DiffLine{Op: "+", Text: l})
+		}
+		return out
+	}
+	// lcs[i][j] 为 a[i:] 与 b[j:] 的最长公共子序列长度。
+	lcs := make([][]int, len(a)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else {
+				lcs[i][j] = max(lcs[i+1][j], lcs[i][j+1])
+			}
+		}
+	}
+	var out []views.DiffLine
+	i, j := 0, 0
+	for i < len(a) && j < len(b) {
+		switch {
+		case a[i] == b[j]:
+			out = append(out, views.DiffLine{Op: " ", Text: a[i]})
+			i++
+			j++
+		case lcs[i+1][j] >= lcs[i][j+1]:
+			out = append(out, views.DiffLine{Op: "-", Text: a[i]})
+			i++
+		default:
+			out = append(out, views.DiffLine{Op: "+", Text: b[j]})
+			j++
+		}
+	}
+	for ; i < len(a); i++ {
+		out = append(out, views.DiffLine{Op: "-", Text: a[i]})
+	}
+	for ; j < len(b); j++ {
+		out = append(out, views.DiffLine{Op: "+", Text: b[j]})
+	}
+	return out
+}
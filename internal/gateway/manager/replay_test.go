@@ -0,0 +1,45 @@
+package manager
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"anti2api-golang/refactor/internal/gateway/manager/views"
+	"anti2api-golang/refactor/internal/vertex"
+)
+
+func TestDiffLines(t *testing.T) {
+	got := diffLines([]string{"a", "b", "c"}, []string{"a", "x", "c", "d"})
+	want := []views.DiffLine{{Op: " ", Text: "a"}, {Op: "-", Text: "b"}, {Op: "+", Text: "x"}, {Op: " ", Text: "c"}, {Op: "+", Text: "d"}}
+	if len(got) != len(want) {
+		t.Fatalf("diff = %v, want %v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("diff = %v, want %v", got, want)
+		}
+	}
+}
+
+func TestReplayText(t *testing.T) {
+	resp := &vertex.Response{}
+	resp.Response.Candidates = []vertex.Candidate{{Content: vertex.Content{Parts: []vertex.Part{
+		{Text: "plan\nsteps", Thought: true},
+		{Text: "hello "},
+		{Text: "world"},
+		{FunctionCall: &vertex.FunctionCall{Name: "read", Args: map[string]any{"path": "a.go"}}},
+	}}}}
+	want := "[thought] plan steps\nhello world\n[functionCall] read {\"path\":\"a.go\"}\n"
+	if got := replayText(resp); got != want {
+		t.Fatalf("replayText = %q, want %q", got, want)
+	}
+}
+
+func TestReplayTranscript_RequiresVertexRequest(t *testing.T) {
+	r := httptest.NewRequest("POST", "/manager/api/transcripts/replay", nil)
+	_, err := replayTranscript(r, []byte(`{"id":"x","model":"m","error":"bad request"}`), replayRequest{ID: "x"})
+	if err == nil || !strings.Contains(err.Error(), "Vertex 请求") {
+		t.Fatalf("expected missing vertex request error, got %v", err)
+	}
+}
@@ -0,0 +1,76 @@
+package manager
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"net/http"
+	"strings"
+
+	"anti2api-golang/refactor/internal/config"
+	"anti2api-golang/refactor/internal/credential"
+	"anti2api-golang/refactor/internal/gateway/manager/views"
+	"anti2api-golang/refactor/internal/logger"
+)
+
+// SetupRequired 报告是否处于首次运行状态：既没有配置 WEBUI_PASSWORD，也没有任何账号。
+// 此时管理面板跳转到 /setup 初始化页面，而不是要求手动编辑 .env。
+func SetupRequired() bool {
+	return config.Get().AdminPassword == "" && credential.GetStore().Count() == 0
+}
+
+// HandleSetup 提供首次运行初始化页面：设置管理密码与 API 密钥，完成后登录并进入管理面板添加账号。
+func HandleSetup(w http.ResponseWriter, r *http.Request) {
+	if !SetupRequired() {
+		http.Redirect(w, r, "/login", http.StatusFound)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet, http.MethodHead:
+		views.Setup(generateAPIKey(), "").Render(r.Context(), w)
+	case http.MethodPost:
+		handleSetupPost(w, r)
+	default:
+		http.Error(w, "不支持的请求方法", http.StatusMethodNotAllowed)
+	}
+}
+
+func handleSetupPost(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		views.Setup("", "无效的请求").Render(r.Context(), w)
+		return
+	}
+
+	password := r.FormValue("password")
+	apiKey := strings.TrimSpace(r.FormValue("apiKey"))
+	if strings.TrimSpace(password) == "" {
+		views.Setup(apiKey, "管理员密码不能为空").Render(r.Context(), w)
+		return
+	}
+	if password != r.FormValue("confirm") {
+		views.Setup(apiKey, "两次输入的密码不一致").Render(r.Context(), w)
+		return
+	}
+
+	settings := config.GetWebUISettings()
+	settings.WebUIPassword = password
+	settings.APIKey = apiKey
+	if err := config.UpdateWebUISettings(settings); err != nil {
+		logger.Error("保存初始化设置失败: %v", err)
+		views.Setup(apiKey, "保存设置失败: "+err.Error()).Render(r.Context(), w)
+		return
+	}
+	logger.Info("首次运行初始化完成，已设置管理密码")
+
+	setSessionCookie(w)
+	w.Header().Set("HX-Redirect", "/")
+	w.Write([]byte("初始化完成"))
+}
+
+func generateAPIKey() string {
+	b := make([]byte, 24)
+	if _, err := rand.Read(b); err != nil {
+		return ""
+	}
+	return "sk-" + hex.EncodeToString(b)
+}
@@ -0,0 +1,54 @@
+package manager
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"anti2api-golang/refactor/internal/config"
+)
+
+func TestHandleSetup_RedirectsWhenPasswordConfigured(t *testing.T) {
+	c := config.Get()
+	old := c.AdminPassword
+	c.AdminPassword = "secret"
+	t.Cleanup(func() { c.AdminPassword = old })
+
+	w := httptest.NewRecorder()
+	HandleSetup(w, httptest.NewRequest(http.MethodGet, "/setup", nil))
+	if w.Code != http.StatusFound || w.Header().Get("Location") != "/login" {
+		t.Fatalf("expected redirect to /login, got %d %q", w.Code, w.Header().Get("Location"))
+	}
+}
+
+func TestHandleSetup_PasswordMismatch(t *testing.T) {
+	c := config.Get()
+	old := c.AdminPassword
+	c.AdminPassword = ""
+	t.Cleanup(func() { c.AdminPassword = old })
+	if !SetupRequired() {
+		t.Skip("store already has accounts")
+	}
+
+	form := url.Values{"password": {"a"}, "confirm": {"b"}, "apiKey": {"sk-test"}}
+	r := httptest.NewRequest(http.MethodPost, "/setup", strings.NewReader(form.Encode()))
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	w := httptest.NewRecorder()
+	HandleSetup(w, r)
+
+	if !strings.Contains(w.Body.String(), "两次输入的密码不一致") {
+		t.Fatalf("expected mismatch error, got %s", w.Body.String())
+	}
+	if len(w.Result().Cookies()) != 0 || c.AdminPassword != "" {
+		t.Fatalf("setup must not log in or save on validation error")
+	}
+}
+
+func TestGenerateAPIKey(t *testing.T) {
+	k1, k2 := generateAPIKey(), generateAPIKey()
+	if !strings.HasPrefix(k1, "sk-") || len(k1) != 51 || k1 == k2 {
+		t.Fatalf("unexpected api keys: %q %q", k1, k2)
+	}
+}
@@ -0,0 +1,27 @@
+#!/bin/sh
+#
+# 下载管理面板使用的前端资源到 assets/，由 go:embed 打包进二进制。
+# 资源存在时管理面板从 /static/ 加载，无需访问外网；缺失时回退到 CDN。
+#
+#   go generate ./internal/gateway/manager/static
+#
+set -e
+
+cd "$(dirname "$0")/assets"
+
+fetch() {
+    if [ -s "$1" ] && [ "$FORCE" != "1" ]; then
+        return
+    fi
+    echo "下载 $2"
+    if command -v curl >/dev/null 2>&1; then
+        curl -fsSL -o "$1.tmp" "$2"
+    else
+        wget -q -O "$1.tmp" "$2"
+    fi
+    mv "$1.tmp" "$1"
+}
+
+# 版本与 static.go 中的 CDN 回退地址保持一致。
+fetch htmx.min.js "https://unpkg.com/htmx.org@1.9.10/dist/htmx.min.js"
+fetch tailwind.js "https://cdn.tailwindcss.com/3.4.16"
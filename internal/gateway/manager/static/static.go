@@ -0,0 +1,87 @@
+// Package static 内嵌管理面板使用的前端资源（htmx、Tailwind），通过 /static/ 提供，
+// 使管理面板在离线 / 内网环境中也能正常使用。资源文件由 fetch.sh 下载到 assets/。
+package static
+
+import (
+	"crypto/sha256"
+	"embed"
+	"encoding/hex"
+	"io/fs"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+//go:generate sh fetch.sh
+
+//go:embed assets
+var embedded embed.FS
+
+// Prefix 是静态资源的 URL 前缀。
+const Prefix = "/static/"
+
+// Asset 描述一个前端资源：已内嵌时从 /static/ 加载，否则回退到 CDN 地址。
+type Asset struct {
+	Name string
+	CDN  string
+}
+
+var (
+	HTMX     = Asset{Name: "htmx.min.js", CDN: "https://unpkg.com/htmx.org@1.9.10"}
+	Tailwind = Asset{Name: "tailwind.js", CDN: "https://cdn.tailwindcss.com/3.4.16"}
+)
+
+var (
+	assetsFS   fs.FS
+	versions   map[string]string
+	loadAssets sync.Once
+)
+
+func load() {
+	loadAssets.Do(func() {
+		assetsFS, _ = fs.Sub(embedded, "assets")
+		versions = make(map[string]string)
+		for _, a := range []Asset{HTMX, Tailwind} {
+			data, err := fs.ReadFile(assetsFS, a.Name)
+			if err != nil || len(data) == 0 {
+				continue
+			}
+			sum := sha256.Sum256(data)
+			versions[a.Name] = hex.EncodeToString(sum[:])[:12]
+		}
+	})
+}
+
+// Embedded 报告资源是否已内嵌。
+func (a Asset) Embedded() bool {
+	load()
+	_, ok := versions[a.Name]
+	return ok
+}
+
+// URL 返回页面中引用该资源的地址；内嵌资源带内容哈希，便于长期缓存。
+func (a Asset) URL() string {
+	load()
+	if v, ok := versions[a.Name]; ok {
+		return Prefix + a.Name + "?v=" + v
+	}
+	return a.CDN
+}
+
+// Handler 提供 /static/ 下的内嵌资源。
+func Handler() http.Handler {
+	load()
+	files := http.StripPrefix(Prefix, http.FileServer(http.FS(assetsFS)))
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasSuffix(r.URL.Path, "/") || strings.HasSuffix(r.URL.Path, ".md") {
+			http.NotFound(w, r)
+			return
+		}
+		if r.URL.Query().Get("v") != "" {
+			w.Header().Set("Cache-Control", "public, max-age=31536000, immutable")
+		} else {
+			w.Header().Set("Cache-Control", "public, max-age=3600")
+		}
+		files.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,32 @@
+package static
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestAssetURL(t *testing.T) {
+	for _, a := range []Asset{HTMX, Tailwind} {
+		url := a.URL()
+		if a.Embedded() {
+			if !strings.HasPrefix(url, Prefix+a.Name+"?v=") {
+				t.Fatalf("embedded asset %s should be served locally, got %q", a.Name, url)
+			}
+		} else if url != a.CDN {
+			t.Fatalf("missing asset %s should fall back to CDN, got %q", a.Name, url)
+		}
+	}
+}
+
+func TestHandler_HidesDirectoryAndReadme(t *testing.T) {
+	h := Handler()
+	for _, path := range []string{"/static/", "/static/README.md"} {
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, path, nil))
+		if w.Code != http.StatusNotFound {
+			t.Fatalf("%s: expected 404, got %d", path, w.Code)
+		}
+	}
+}
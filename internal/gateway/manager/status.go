@@ -0,0 +1,86 @@
+package manager
+
+import (
+	"net/http"
+	"strings"
+	"time"
+
+	"anti2api-golang/refactor/internal/config"
+	"anti2api-golang/refactor/internal/credential"
+	"anti2api-golang/refactor/internal/gateway/manager/views"
+	"anti2api-golang/refactor/internal/vertex"
+)
+
+// statusRecentWindow 为判断上游是否异常时检查的最近上游请求数：这些请求全部失败时状态为 degraded。
+const statusRecentWindow = 10
+
+// HandleStatus 为公开的只读状态页（STATUS_PAGE=true 时启用，无需鉴权）：浏览器访问返回页面，其他请求
+// （或 ?format=json）返回 JSON。只展示整体可用性与模型列表更新时间，不可用时状态码为 503，便于外部监控。
+func HandleStatus(w http.ResponseWriter, r *http.Request) {
+	if !config.Get().StatusPage {
+		http.NotFound(w, r)
+		return
+	}
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		http.Error(w, "不支持的请求方法", http.StatusMethodNotAllowed)
+		return
+	}
+
+	info := currentStatus(time.Now())
+	status := http.StatusOK
+	if info.Status == "down" {
+		status = http.StatusServiceUnavailable
+	}
+	w.Header().Set("Cache-Control", "no-store")
+	if wantsStatusPage(r) {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.WriteHeader(status)
+		_ = views.Status(info).Render(r.Context(), w)
+		return
+	}
+	body := map[string]any{
+		"status":    info.Status,
+		"message":   info.Message,
+		"checkedAt": info.CheckedAt.UTC(),
+	}
+	if !info.ModelsUpdatedAt.IsZero() {
+		body["modelsUpdatedAt"] = info.ModelsUpdatedAt.UTC()
+	}
+	writeJSON(w, status, body)
+}
+
+// currentStatus 汇总整体可用性：没有启用的账号为 down，最近的上游请求全部失败为 degraded，否则为 up。
+func currentStatus(now time.Time) views.StatusInfo {
+	info := views.StatusInfo{Status: "up", Message: "服务运行正常", ModelsUpdatedAt: vertex.ModelsFetchedAt(), CheckedAt: now}
+	if credential.GetStore().EnabledCount() == 0 {
+		info.Status, info.Message = "down", "当前没有可用账号，暂时无法处理请求"
+		return info
+	}
+	if upstreamFailing(vertex.RecentEndpointUses(statusRecentWindow)) {
+		info.Status, info.Message = "degraded", "最近的上游请求均失败，服务可能暂时不可用"
+	}
+	return info
+}
+
+func upstreamFailing(uses []vertex.EndpointUse) bool {
+	if len(uses) == 0 {
+		return false
+	}
+	for _, u := range uses {
+		if u.Status >= 200 && u.Status < 300 {
+			return false
+		}
+	}
+	return true
+}
+
+// wantsStatusPage 判断返回页面还是 JSON：format 参数优先，否则按 Accept 是否包含 text/html。
+func wantsStatusPage(r *http.Request) bool {
+	switch strings.ToLower(r.URL.Query().Get("format")) {
+	case "json":
+		return false
+	case "html":
+		return true
+	}
+	return strings.Contains(r.Header.Get("Accept"), "text/html")
+}
@@ -0,0 +1,63 @@
+package manager
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"anti2api-golang/refactor/internal/config"
+	"anti2api-golang/refactor/internal/credential"
+	"anti2api-golang/refactor/internal/vertex"
+)
+
+func TestHandleStatus(t *testing.T) {
+	c := config.Get()
+	old := c.StatusPage
+	t.Cleanup(func() { c.StatusPage = old })
+
+	c.StatusPage = false
+	w := httptest.NewRecorder()
+	HandleStatus(w, httptest.NewRequest(http.MethodGet, "/status", nil))
+	if w.Code != http.StatusNotFound {
+		t.Fatalf("disabled status page: got %d, want 404", w.Code)
+	}
+
+	c.StatusPage = true
+	if credential.GetStore().EnabledCount() != 0 {
+		t.Skip("store already has accounts")
+	}
+	w = httptest.NewRecorder()
+	HandleStatus(w, httptest.NewRequest(http.MethodGet, "/status", nil))
+	if w.Code != http.StatusServiceUnavailable || !strings.Contains(w.Body.String(), `"status":"down"`) {
+		t.Fatalf("no accounts: got %d %s", w.Code, w.Body.String())
+	}
+
+	r := httptest.NewRequest(http.MethodGet, "/status", nil)
+	r.Header.Set("Accept", "text/html,application/xhtml+xml")
+	w = httptest.NewRecorder()
+	HandleStatus(w, r)
+	if !strings.HasPrefix(w.Header().Get("Content-Type"), "text/html") || !strings.Contains(w.Body.String(), "不可用") {
+		t.Fatalf("browser request should get the HTML page, got %q", w.Header().Get("Content-Type"))
+	}
+}
+
+func TestUpstreamFailing(t *testing.T) {
+	cases := []struct {
+		statuses []int
+		want     bool
+	}{
+		{nil, false},
+		{[]int{500, 0, 429}, true},
+		{[]int{500, 200, 0}, false},
+	}
+	for _, tc := range cases {
+		var uses []vertex.EndpointUse
+		for _, s := range tc.statuses {
+			uses = append(uses, vertex.EndpointUse{Status: s})
+		}
+		if got := upstreamFailing(uses); got != tc.want {
+			t.Errorf("%v: got %v, want %v", tc.statuses, got, tc.want)
+		}
+	}
+}
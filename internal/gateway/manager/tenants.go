@@ -0,0 +1,69 @@
+package manager
+
+import (
+	"net/http"
+	"os"
+	"slices"
+	"sort"
+	"strings"
+
+	"anti2api-golang/refactor/internal/config"
+	"anti2api-golang/refactor/internal/logger"
+	"anti2api-golang/refactor/internal/signature"
+	"anti2api-golang/refactor/internal/storage"
+	"anti2api-golang/refactor/internal/transcript"
+	"anti2api-golang/refactor/internal/usage"
+)
+
+// HandleTenants 返回配置的租户（见 TENANTS）及各自的数据目录与按模型的用量。
+func HandleTenants(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		http.Error(w, "不支持的请求方法", http.StatusMethodNotAllowed)
+		return
+	}
+
+	names := config.TenantNames()
+	sort.Strings(names)
+	snapshot := usage.TenantSnapshot()
+	items := make([]map[string]any, 0, len(names))
+	for _, name := range names {
+		items = append(items, map[string]any{
+			"name":    name,
+			"dataDir": config.TenantDataDir(name),
+			"usage":   snapshot[name],
+		})
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"items": items})
+}
+
+// HandleTenantPurge 清理租户的全部数据：签名缓存、会话记录、数据目录与用量统计（租户配置本身保留）。
+func HandleTenantPurge(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "不支持的请求方法", http.StatusMethodNotAllowed)
+		return
+	}
+
+	tenant := strings.TrimSpace(r.URL.Query().Get("tenant"))
+	if tenant == "" || !slices.Contains(config.TenantNames(), tenant) {
+		writeJSON(w, http.StatusNotFound, map[string]any{"error": "未配置该租户"})
+		return
+	}
+
+	// 先停止签名写入协程并清空会话记录，再删除目录，避免删除后又被写回旧数据。
+	signature.DropTenant(tenant)
+	err := transcript.GetStoreFor(tenant).Purge()
+	if err == nil {
+		err = storage.Close(config.TenantDataDir(tenant))
+	}
+	if err == nil {
+		err = os.RemoveAll(config.TenantDataDir(tenant))
+	}
+	if err != nil {
+		logger.Warn("清理租户 %s 的数据失败: %v", tenant, err)
+		writeJSON(w, http.StatusInternalServerError, map[string]any{"error": err.Error()})
+		return
+	}
+	usage.ResetTenant(tenant)
+	logger.Info("已清理租户 %s 的数据", tenant)
+	writeJSON(w, http.StatusOK, map[string]any{"success": true})
+}
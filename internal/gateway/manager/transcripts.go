@@ -0,0 +1,136 @@
+package manager
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"anti2api-golang/refactor/internal/config"
+	"anti2api-golang/refactor/internal/gateway/manager/views"
+	"anti2api-golang/refactor/internal/logger"
+	"anti2api-golang/refactor/internal/transcript"
+)
+
+// HandleTranscriptsView 渲染会话记录标签页。
+func HandleTranscriptsView(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	views.TranscriptsView().Render(r.Context(), w)
+}
+
+// HandleTranscripts 返回会话记录摘要列表（HTMX 请求返回 HTML，否则返回 JSON）。
+func HandleTranscripts(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		http.Error(w, "不支持的请求方法", http.StatusMethodNotAllowed)
+		return
+	}
+
+	session := strings.TrimSpace(r.URL.Query().Get("session"))
+	limit, _ := strconv.Atoi(r.URL.Query().Get("limit"))
+	store := transcriptStore(w, r)
+	if store == nil {
+		return
+	}
+	items := store.List(session, limit)
+
+	if isHTMX(r) {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		views.TranscriptList(toViewTranscripts(items), transcript.Enabled()).Render(r.Context(), w)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"enabled": transcript.Enabled(), "items": items})
+}
+
+// HandleTranscriptDetail 按 ID 返回完整的会话记录 JSON。
+func HandleTranscriptDetail(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		http.Error(w, "不支持的请求方法", http.StatusMethodNotAllowed)
+		return
+	}
+
+	store := transcriptStore(w, r)
+	if store == nil {
+		return
+	}
+	raw, ok := store.Find(strings.TrimSpace(r.URL.Query().Get("id")))
+	if !ok {
+		writeJSON(w, http.StatusNotFound, map[string]any{"error": "未找到该会话记录"})
+		return
+	}
+	if isHTMX(r) {
+		var pretty bytes.Buffer
+		if err := json.Indent(&pretty, raw, "", "  "); err == nil {
+			raw = pretty.Bytes()
+		}
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		views.TranscriptDetail(string(raw)).Render(r.Context(), w)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(http.StatusOK)
+	_, _ = w.Write(raw)
+}
+
+// HandleTranscriptExport 以 JSONL 下载会话记录，可按 session / date（YYYY-MM-DD）过滤。
+// 以上会话记录接口都支持 tenant 查询参数，指定租户时读取该租户的记录（见 TENANTS）。
+func HandleTranscriptExport(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		http.Error(w, "不支持的请求方法", http.StatusMethodNotAllowed)
+		return
+	}
+
+	store := transcriptStore(w, r)
+	if store == nil {
+		return
+	}
+	q := r.URL.Query()
+	session := strings.TrimSpace(q.Get("session"))
+	date := strings.TrimSpace(q.Get("date"))
+	if date != "" {
+		if _, err := time.Parse("2006-01-02", date); err != nil {
+			writeJSON(w, http.StatusBadRequest, map[string]any{"error": "date 格式应为 YYYY-MM-DD"})
+			return
+		}
+	}
+
+	name := "transcripts"
+	if date != "" {
+		name += "-" + date
+	}
+	w.Header().Set("Content-Type", "application/x-ndjson; charset=utf-8")
+	w.Header().Set("Content-Disposition", `attachment; filename="`+name+`.jsonl"`)
+	if err := store.Export(w, session, date); err != nil {
+		logger.Warn("导出会话记录失败: %v", err)
+	}
+}
+
+// transcriptStore 返回 tenant 查询参数指定的租户的会话记录存储（未指定时为默认租户）；租户未配置时写出 404 并返回 nil。
+func transcriptStore(w http.ResponseWriter, r *http.Request) *transcript.Store {
+	tenant := strings.TrimSpace(r.URL.Query().Get("tenant"))
+	if tenant != "" && !slices.Contains(config.TenantNames(), tenant) {
+		writeJSON(w, http.StatusNotFound, map[string]any{"error": "未配置该租户"})
+		return nil
+	}
+	return transcript.GetStoreFor(tenant)
+}
+
+func toViewTranscripts(items []transcript.Summary) []views.TranscriptItem {
+	out := make([]views.TranscriptItem, 0, len(items))
+	for _, it := range items {
+		out = append(out, views.TranscriptItem{
+			ID:         it.ID,
+			SessionKey: it.SessionKey,
+			Endpoint:   it.Endpoint,
+			Model:      it.Model,
+			Stream:     it.Stream,
+			Status:     it.Status,
+			Error:      it.Error,
+			CreatedAt:  it.CreatedAt,
+			DurationMs: it.DurationMs,
+		})
+	}
+	return out
+}
@@ -0,0 +1,57 @@
+package manager
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+
+	"anti2api-golang/refactor/internal/credential"
+	"anti2api-golang/refactor/internal/gateway/manager/views"
+)
+
+// HandleCaps 查看（GET）或设置（POST）账号的每日用量上限：requestCap / tokenCap 为空或 0 时沿用
+// ACCOUNT_DAILY_REQUEST_CAP / ACCOUNT_DAILY_TOKEN_CAP，负数表示不限制。HTMX 请求返回更新后的账号卡片。
+func HandleCaps(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead && r.Method != http.MethodPost {
+		http.Error(w, "不支持的请求方法", http.StatusMethodNotAllowed)
+		return
+	}
+
+	sessionID := strings.TrimSpace(r.URL.Query().Get("id"))
+	idx := findIndexBySessionID(sessionID)
+	if idx == -1 {
+		writeJSON(w, http.StatusNotFound, map[string]any{"success": false, "message": "未找到对应账号"})
+		return
+	}
+
+	store := credential.GetStore()
+	if r.Method == http.MethodPost {
+		requests, err1 := parseCap(r.FormValue("requestCap"))
+		tokens, err2 := parseCap(r.FormValue("tokenCap"))
+		if err1 != nil || err2 != nil {
+			writeJSON(w, http.StatusBadRequest, map[string]any{"success": false, "message": "requestCap / tokenCap 必须是整数"})
+			return
+		}
+		if err := store.SetDailyCaps(sessionID, requests, tokens); err != nil {
+			writeJSON(w, http.StatusInternalServerError, map[string]any{"success": false, "message": err.Error()})
+			return
+		}
+	}
+
+	if isHTMX(r) {
+		accounts := store.GetAll()
+		if idx < len(accounts) {
+			views.TokenCard(accounts[idx], false).Render(r.Context(), w)
+		}
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"success": true, "sessionId": sessionID, "usage": store.DailyUsage(sessionID)})
+}
+
+func parseCap(s string) (int, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return 0, nil
+	}
+	return strconv.Atoi(s)
+}
@@ -8,6 +8,8 @@ package views
 import "github.com/a-h/templ"
 import templruntime "github.com/a-h/templ/runtime"
 
+import "anti2api-golang/refactor/internal/gateway/manager/static"
+
 func Layout(title string) templ.Component {
 	return templruntime.GeneratedTemplate(func(templ_7745c5c3_Input templruntime.GeneratedComponentInput) (templ_7745c5c3_Err error) {
 		templ_7745c5c3_W, ctx := templ_7745c5c3_Input.Writer, templ_7745c5c3_Input.Context
@@ -36,13 +38,39 @@ func Layout(title string) templ.Component {
 		var templ_7745c5c3_Var2 string
 		templ_7745c5c3_Var2, templ_7745c5c3_Err = templ.JoinStringErrs(title)
 		if templ_7745c5c3_Err != nil {
-			return templ.Error{Err: templ_7745c5c3_Err, FileName: `internal/gateway/manager/views/layout.templ`, Line: 9, Col: 16}
+			return templ.Error{Err: templ_7745c5c3_Err, FileName: `internal/gateway/manager/views/layout.templ`, Line: 11, Col: 16}
 		}
 		_, templ_7745c5c3_Err = templ_7745c5c3_Buffer.WriteString(templ.EscapeString(templ_7745c5c3_Var2))
 		if templ_7745c5c3_Err != nil {
 			return templ_7745c5c3_Err
 		}
-		templ_7745c5c3_Err = templruntime.WriteString(templ_7745c5c3_Buffer, 2, "</title><script src=\"https://unpkg.com/htmx.org@1.9.10\"></script><script src=\"https://cdn.tailwindcss.com\"></script><link href=\"https://fonts.googleapis.com/css2?family=Inter:wght@300;400;500;600;700&display=swap\" rel=\"stylesheet\"><style>\n\t\t\tbody { font-family: 'Inter', sans-serif; }\n            .htmx-indicator { opacity: 0; transition: opacity 200ms ease-in; }\n            .htmx-request .htmx-indicator { opacity: 1 }\n            .htmx-request.htmx-indicator { opacity: 1 }\n\t\t\tsummary::-webkit-details-marker { display: none; }\n\t\t\tsummary::marker { content: \"\"; }\n\t\t\t@keyframes quotaPop {\n\t\t\t\t0% { transform: scale(0.96); opacity: 0.75; }\n\t\t\t\t100% { transform: scale(1); opacity: 1; }\n\t\t\t}\n\t\t\t@keyframes quotaBarPop {\n\t\t\t\t0% { transform: scaleY(0.6); opacity: 0.7; }\n\t\t\t\t100% { transform: scaleY(1); opacity: 1; }\n\t\t\t}\n\t\t\t.quota-pop { animation: quotaPop 260ms ease-out; }\n\t\t\t.quota-bar-pop { animation: quotaBarPop 320ms ease-out; transform-origin: center; }\n\t\t</style></head><body class=\"bg-white text-slate-900 min-h-screen pt-14 pb-10\">")
+		templ_7745c5c3_Err = templruntime.WriteString(templ_7745c5c3_Buffer, 2, "</title><script src=\"")
+		if templ_7745c5c3_Err != nil {
+			return templ_7745c5c3_Err
+		}
+		var templ_7745c5c3_Var3 string
+		templ_7745c5c3_Var3, templ_7745c5c3_Err = templ.JoinStringErrs(static.HTMX.URL())
+		if templ_7745c5c3_Err != nil {
+			return templ.Error{Err: templ_7745c5c3_Err, FileName: `internal/gateway/manager/views/layout.templ`, Line: 12, Col: 33}
+		}
+		_, templ_7745c5c3_Err = templ_7745c5c3_Buffer.WriteString(templ.EscapeString(templ_7745c5c3_Var3))
+		if templ_7745c5c3_Err != nil {
+			return templ_7745c5c3_Err
+		}
+		templ_7745c5c3_Err = templruntime.WriteString(templ_7745c5c3_Buffer, 3, "\"></script><script src=\"")
+		if templ_7745c5c3_Err != nil {
+			return templ_7745c5c3_Err
+		}
+		var templ_7745c5c3_Var4 string
+		templ_7745c5c3_Var4, templ_7745c5c3_Err = templ.JoinStringErrs(static.Tailwind.URL())
+		if templ_7745c5c3_Err != nil {
+			return templ.Error{Err: templ_7745c5c3_Err, FileName: `internal/gateway/manager/views/layout.templ`, Line: 13, Col: 37}
+		}
+		_, templ_7745c5c3_Err = templ_7745c5c3_Buffer.WriteString(templ.EscapeString(templ_7745c5c3_Var4))
+		if templ_7745c5c3_Err != nil {
+			return templ_7745c5c3_Err
+		}
+		templ_7745c5c3_Err = templruntime.WriteString(templ_7745c5c3_Buffer, 4, "\"></script><style>\n\t\t\tbody { font-family: 'Inter', system-ui, -apple-system, 'Segoe UI', 'PingFang SC', 'Microsoft YaHei', sans-serif; }\n            .htmx-indicator { opacity: 0; transition: opacity 200ms ease-in; }\n            .htmx-request .htmx-indicator { opacity: 1 }\n            .htmx-request.htmx-indicator { opacity: 1 }\n\t\t\tsummary::-webkit-details-marker { display: none; }\n\t\t\tsummary::marker { content: \"\"; }\n\t\t\t@keyframes quotaPop {\n\t\t\t\t0% { transform: scale(0.96); opacity: 0.75; }\n\t\t\t\t100% { transform: scale(1); opacity: 1; }\n\t\t\t}\n\t\t\t@keyframes quotaBarPop {\n\t\t\t\t0% { transform: scaleY(0.6); opacity: 0.7; }\n\t\t\t\t100% { transform: scaleY(1); opacity: 1; }\n\t\t\t}\n\t\t\t.quota-pop { animation: quotaPop 260ms ease-out; }\n\t\t\t.quota-bar-pop { animation: quotaBarPop 320ms ease-out; transform-origin: center; }\n\t\t</style></head><body class=\"bg-white text-slate-900 min-h-screen pt-14 pb-10\">")
 		if templ_7745c5c3_Err != nil {
 			return templ_7745c5c3_Err
 		}
@@ -50,7 +78,7 @@ func Layout(title string) templ.Component {
 		if templ_7745c5c3_Err != nil {
 			return templ_7745c5c3_Err
 		}
-		templ_7745c5c3_Err = templruntime.WriteString(templ_7745c5c3_Buffer, 3, "<div id=\"toast-container\" class=\"fixed top-20 right-5 z-50 flex flex-col gap-2\"></div><script>\n            document.body.addEventListener(\"showMessage\", function(evt){\n                const msg = evt.detail.message;\n                const type = evt.detail.type || 'info';\n                const toast = document.createElement('div');\n                \n                let bgClass = 'bg-blue-600';\n                if(type === 'error') bgClass = 'bg-red-600';\n                if(type === 'success') bgClass = 'bg-emerald-600';\n\n                toast.className = `p-4 rounded-lg shadow-lg text-white transform transition-all duration-300 translate-x-full opacity-0 ${bgClass}`;\n                toast.textContent = msg;\n                \n                document.getElementById('toast-container').appendChild(toast);\n                \n                // Animation in\n                requestAnimationFrame(() => {\n                    toast.classList.remove('translate-x-full', 'opacity-0');\n                });\n\n                // Remove after 3s\n                setTimeout(() => {\n                    toast.classList.add('translate-x-full', 'opacity-0');\n                    setTimeout(() => toast.remove(), 300);\n                }, 3000);\n            })\n        </script></body></html>")
+		templ_7745c5c3_Err = templruntime.WriteString(templ_7745c5c3_Buffer, 5, "<div id=\"toast-container\" class=\"fixed top-20 right-5 z-50 flex flex-col gap-2\"></div><script>\n            document.body.addEventListener(\"showMessage\", function(evt){\n                const msg = evt.detail.message;\n                const type = evt.detail.type || 'info';\n                const toast = document.createElement('div');\n                \n                let bgClass = 'bg-blue-600';\n                if(type === 'error') bgClass = 'bg-red-600';\n                if(type === 'success') bgClass = 'bg-emerald-600';\n\n                toast.className = `p-4 rounded-lg shadow-lg text-white transform transition-all duration-300 translate-x-full opacity-0 ${bgClass}`;\n                toast.textContent = msg;\n                \n                document.getElementById('toast-container').appendChild(toast);\n                \n                // Animation in\n                requestAnimationFrame(() => {\n                    toast.classList.remove('translate-x-full', 'opacity-0');\n                });\n\n                // Remove after 3s\n                setTimeout(() => {\n                    toast.classList.add('translate-x-full', 'opacity-0');\n                    setTimeout(() => toast.remove(), 300);\n                }, 3000);\n            })\n        </script></body></html>")
 		if templ_7745c5c3_Err != nil {
 			return templ_7745c5c3_Err
 		}
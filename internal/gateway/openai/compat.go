@@ -0,0 +1,84 @@
+package openai
+
+import (
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+
+	"anti2api-golang/refactor/internal/config"
+	"anti2api-golang/refactor/internal/middleware"
+	"anti2api-golang/refactor/internal/vertex"
+)
+
+// CompatModeHeader 为按请求开启 Cline / Roo-Code 兼容模式的请求头（值为 cline 或 roo）。
+const CompatModeHeader = "X-Compat-Mode"
+
+// isClineCompat 判断是否对该请求启用 Cline / Roo-Code 兼容模式：请求头 X-Compat-Mode 为 cline / roo，
+// 或使用的 API Key 在 CLINE_COMPAT_KEYS 中。
+//
+// 兼容模式下：
+//   - finish_reason 只使用 OpenAI 的取值（stop / length / tool_calls / content_filter）；
+//   - 结束 chunk 与非流式响应总是带 usage（上游未返回时为 0）；
+//   - 不输出空 delta：role 随第一个有内容的 delta 一起发送，结束 chunk 的 delta 为 {"content":""}；
+//   - 思考内容放在 reasoning_content 字段（而不是 reasoning）。
+func isClineCompat(r *http.Request) bool {
+	switch strings.ToLower(strings.TrimSpace(r.Header.Get(CompatModeHeader))) {
+	case "cline", "roo", "roo-code":
+		return true
+	}
+	key := middleware.APIKeyFromContext(r.Context())
+	return key != "" && slices.Contains(config.Get().ClineCompatKeys, key)
+}
+
+// openAIFinishReason 将上游 finishReason 映射为 OpenAI 的取值。
+func openAIFinishReason(upstream string, hasToolCalls bool) string {
+	if hasToolCalls {
+		return "tool_calls"
+	}
+	switch upstream {
+	case "MAX_TOKENS":
+		return "length"
+	case "SAFETY", "RECITATION", "BLOCKLIST", "PROHIBITED_CONTENT", "SPII", "IMAGE_SAFETY":
+		return "content_filter"
+	}
+	return "stop"
+}
+
+// applyClineCompat 按兼容模式调整非流式响应。
+func applyClineCompat(out *ChatCompletion, resp *vertex.Response) {
+	if out.Usage == nil {
+		out.Usage = &Usage{}
+	}
+	if len(out.Choices) == 0 {
+		return
+	}
+	msg := &out.Choices[0].Message
+	upstream := ""
+	if resp != nil && len(resp.Response.Candidates) > 0 {
+		upstream = resp.Response.Candidates[0].FinishReason
+	}
+	finish := openAIFinishReason(upstream, len(msg.ToolCalls) > 0)
+	out.Choices[0].FinishReason = &finish
+	msg.ReasoningContent, msg.Reasoning = msg.Reasoning, ""
+}
+
+// modalitiesWarning 返回请求中被忽略的输出模态说明（例如 modalities 含 audio 或携带 audio 参数）；没有需要忽略的模态时返回空字符串。
+// 部分客户端总是发送 modalities:["text","audio"]，这里按纯文本输出处理而不是报错。
+func modalitiesWarning(req *ChatRequest) string {
+	var ignored []string
+	for _, m := range req.Modalities {
+		m = strings.ToLower(strings.TrimSpace(m))
+		if m == "" || m == "text" || m == "image" || slices.Contains(ignored, m) {
+			continue
+		}
+		ignored = append(ignored, m)
+	}
+	if req.Audio != nil && !slices.Contains(ignored, "audio") {
+		ignored = append(ignored, "audio")
+	}
+	if len(ignored) == 0 {
+		return ""
+	}
+	return fmt.Sprintf("不支持的输出模态 %s 已忽略，仅返回文本", strings.Join(ignored, ", "))
+}
@@ -0,0 +1,99 @@
+package openai
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"anti2api-golang/refactor/internal/vertex"
+)
+
+func TestIsClineCompat(t *testing.T) {
+	r := httptest.NewRequest("POST", "/v1/chat/completions", nil)
+	if isClineCompat(r) {
+		t.Fatalf("compat mode should be off by default")
+	}
+	r.Header.Set(CompatModeHeader, "Roo")
+	if !isClineCompat(r) {
+		t.Fatalf("X-Compat-Mode: roo should enable compat mode")
+	}
+}
+
+func TestStreamWriterClineCompat(t *testing.T) {
+	rec := httptest.NewRecorder()
+	sw := NewStreamWriter(rec, "chatcmpl-1", 1, "gemini-2.5-pro", "req")
+	sw.clineCompat = true
+	_ = sw.ProcessPart(StreamDataPart{Text: "thinking", Thought: true})
+	_ = sw.ProcessPart(StreamDataPart{Text: "answer"})
+	sw.WriteFinish(openAIFinishReason("MAX_TOKENS", false), nil)
+
+	body := rec.Body.String()
+	chunks := strings.Split(strings.TrimSpace(body), "\n\n")
+	if len(chunks) != 4 {
+		t.Fatalf("expected reasoning, content, finish and [DONE] chunks, got %d:\n%s", len(chunks), body)
+	}
+	if !strings.Contains(chunks[0], `"reasoning_content":"thinking"`) || !strings.Contains(chunks[0], `"role":"assistant"`) {
+		t.Fatalf("first chunk should carry role and reasoning_content: %s", chunks[0])
+	}
+	if strings.Contains(body, `"reasoning":`) || strings.Contains(body, `"delta":{}`) {
+		t.Fatalf("compat stream should not contain reasoning or empty deltas:\n%s", body)
+	}
+	for _, want := range []string{`"finish_reason":"length"`, `"delta":{"content":""}`, `"usage":{"prompt_tokens":0,"completion_tokens":0,"total_tokens":0}`} {
+		if !strings.Contains(chunks[2], want) {
+			t.Fatalf("finish chunk missing %s: %s", want, chunks[2])
+		}
+	}
+}
+
+func TestApplyClineCompat(t *testing.T) {
+	resp := &vertex.Response{}
+	resp.Response.Candidates = []vertex.Candidate{{
+		Content:      vertex.Content{Role: "model", Parts: []vertex.Part{{Text: "why", Thought: true}, {Text: "partial"}}},
+		FinishReason: "MAX_TOKENS",
+	}}
+	out := ToChatCompletion(resp, "gemini-2.5-pro", "req", "")
+	applyClineCompat(out, resp)
+
+	msg := out.Choices[0].Message
+	if *out.Choices[0].FinishReason != "length" || out.Usage == nil {
+		t.Fatalf("unexpected finish/usage: %v %v", *out.Choices[0].FinishReason, out.Usage)
+	}
+	if msg.ReasoningContent != "why" || msg.Reasoning != "" {
+		t.Fatalf("reasoning should move to reasoning_content: %+v", msg)
+	}
+}
+
+func TestModalitiesWarning(t *testing.T) {
+	cases := []struct {
+		req  ChatRequest
+		want string
+	}{
+		{ChatRequest{}, ""},
+		{ChatRequest{Modalities: []string{"text"}}, ""},
+		{ChatRequest{Modalities: []string{"text", "audio"}, Audio: map[string]any{"voice": "alloy", "format": "wav"}}, "audio"},
+		{ChatRequest{Audio: map[string]any{"voice": "alloy"}}, "audio"},
+	}
+	for _, c := range cases {
+		got := modalitiesWarning(&c.req)
+		if (c.want == "") != (got == "") || !strings.Contains(got, c.want) || strings.Count(got, "audio") > 1 {
+			t.Errorf("%+v: got %q, want mention of %q", c.req, got, c.want)
+		}
+	}
+}
+
+func TestStreamWriterWarningOnFirstChunk(t *testing.T) {
+	rec := httptest.NewRecorder()
+	sw := NewStreamWriter(rec, "chatcmpl-1", 1, "gemini-2.5-pro", "req")
+	sw.warning = "ignored audio"
+	_ = sw.ProcessPart(StreamDataPart{Text: "a"})
+	_ = sw.ProcessPart(StreamDataPart{Text: "b"})
+	sw.WriteFinish("stop", nil)
+
+	chunks := strings.Split(strings.TrimSpace(rec.Body.String()), "\n\n")
+	if !strings.Contains(chunks[0], `"warning":"ignored audio"`) {
+		t.Fatalf("first chunk should carry the warning: %s", chunks[0])
+	}
+	if strings.Count(rec.Body.String(), `"warning"`) != 1 {
+		t.Fatalf("warning should be sent once:\n%s", rec.Body.String())
+	}
+}
@@ -3,9 +3,11 @@ package openai
 import (
 	"regexp"
 	"strings"
+	"sync"
 
 	"anti2api-golang/refactor/internal/config"
 	gwcommon "anti2api-golang/refactor/internal/gateway/common"
+	"anti2api-golang/refactor/internal/logger"
 	"anti2api-golang/refactor/internal/pkg/id"
 	jsonpkg "anti2api-golang/refactor/internal/pkg/json"
 	"anti2api-golang/refactor/internal/pkg/modelutil"
@@ -35,17 +37,31 @@ func ToVertexRequest(req *ChatRequest, account *gwcommon.AccountContext) (*verte
 	vreq.UserAgent = "antigravity"
 
 	if sys := gwcommon.ExtractSystemFromMessages(req.Messages, func(m Message) string { return m.Role }, func(m Message) any { return m.Content }); sys != "" {
-		vreq.Request.SystemInstruction = &vertex.SystemInstruction{Role: "user", Parts: []vertex.Part{{Text: sys}}}
+		vreq.Request.SystemInstruction = &vertex.SystemInstruction{Role: vertex.SystemInstructionRole(""), Parts: []vertex.Part{{Text: sys}}}
+	}
+
+	if hint := predictionHint(req.Prediction); hint != "" {
+		if vreq.Request.SystemInstruction == nil {
+			vreq.Request.SystemInstruction = &vertex.SystemInstruction{Role: vertex.SystemInstructionRole("")}
+		}
+		vreq.Request.SystemInstruction.Parts = append(vreq.Request.SystemInstruction.Parts, vertex.Part{Text: hint})
 	}
 
 	if len(req.Tools) > 0 {
-		vreq.Request.Tools = toVertexTools(req.Tools)
+		tools, err := gwcommon.PrepareTools(toVertexTools(req.Tools))
+		if err != nil {
+			return nil, "", err
+		}
+		vreq.Request.Tools = tools
 		vreq.Request.ToolConfig = &vertex.ToolConfig{FunctionCallingConfig: &vertex.FunctionCallingConfig{Mode: "AUTO"}}
 	}
 
-	vreq.Request.GenerationConfig = buildGenerationConfig(req)
+	vreq.Request.GenerationConfig = modelutil.ApplyVirtualModel(req.Model, buildGenerationConfig(req))
 	vreq.Request.Contents = vertex.SanitizeContents(toVertexContents(req, requestID))
-	shouldSkipSystemPrompt := isImageModel || isGemini3Flash
+	gwcommon.TrimPrefill(vreq)
+	gwcommon.DownscaleImages(vreq)
+	gwcommon.ReferenceToolResults(vreq)
+	shouldSkipSystemPrompt := isImageModel || isGemini3Flash || req.NoSystemInjection
 	if !shouldSkipSystemPrompt {
 		vreq.Request.SystemInstruction = vertex.InjectAgentSystemPrompt(vreq.Request.SystemInstruction)
 	}
@@ -53,31 +69,72 @@ func ToVertexRequest(req *ChatRequest, account *gwcommon.AccountContext) (*verte
 	return vreq, requestID, nil
 }
 
+// predictionHint 将 OpenAI prediction 转为系统指令中的参考内容（仅在 OPENAI_PREDICTION_HINT=true 且类型为 content 时）。
+// Vertex 没有推测解码，这里只提示模型尽量沿用预测内容中仍然正确的部分。
+func predictionHint(p *Prediction) string {
+	if p == nil || !config.Get().OpenAIPredictionHint || p.Type != "content" {
+		return ""
+	}
+	content := gwcommon.ExtractTextFromContent(p.Content, "", false)
+	if strings.TrimSpace(content) == "" {
+		return ""
+	}
+	return "The response is expected to closely match the following predicted content. Reuse it verbatim wherever it is still correct and only change what the request requires.\n<predicted_output>\n" + content + "\n</predicted_output>"
+}
+
 func toVertexContents(req *ChatRequest, requestID string) []vertex.Content {
 	var out []vertex.Content
+	sigs := signature.GetManagerFor(req.Tenant)
 	model := strings.TrimSpace(req.Model)
 	isClaudeThinking := modelutil.IsClaudeThinking(model)
 	isGemini := modelutil.IsGemini(model)
+	norm := gwcommon.NewToolCallNormalizer(sigs)
 	for _, m := range req.Messages {
 		switch m.Role {
 		case "system":
 			continue
 		case "user":
-			out = append(out, vertex.Content{Role: "user", Parts: extractUserParts(m.Content)})
+			out = append(out, vertex.Content{Role: "user", Parts: extractUserParts(sigs, m.Content)})
 		case "assistant":
 			parts := make([]vertex.Part, 0, 2+len(m.ToolCalls))
 			thinkingText := strings.TrimSpace(m.Reasoning)
 			if thinkingText == "" {
 				thinkingText = strings.TrimSpace(m.ReasoningContent)
 			}
+			details := signaturesFromDetails(m.ReasoningDetails)
+			if thinkingText == "" {
+				thinkingText = strings.TrimSpace(details.text)
+			}
+
+			text := gwcommon.ExtractTextFromContent(m.Content, "\n", false)
+
+			// 客户端可能在多轮之间改写 tool_call ID，先归一化为首次下发的规范 ID 再查签名。
+			toolArgs := make([]map[string]any, len(m.ToolCalls))
+			toolIDs := make([]string, len(m.ToolCalls))
+			for i, tc := range m.ToolCalls {
+				toolArgs[i] = parseArgs(tc.Function.Arguments)
+				toolIDs[i] = norm.Call(tc.ID, tc.Function.Name, toolArgs[i])
+			}
 
 			firstToolSig := ""
 			firstToolReasoning := ""
 			if len(m.ToolCalls) > 0 {
-				if e, ok := signature.GetManager().LookupByToolCallID(m.ToolCalls[0].ID); ok {
+				if e, ok := sigs.LookupByToolCallID(toolIDs[0]); ok {
 					firstToolSig = strings.TrimSpace(e.Signature)
 					firstToolReasoning = e.Reasoning
 				}
+			} else if isClaudeThinking {
+				// 纯文本轮次：按回复文本查找上一轮缓存的签名（见 textTurnKey）。
+				if key := textTurnKey(text); key != "" {
+					if e, ok := sigs.LookupByToolCallID(key); ok {
+						firstToolSig = strings.TrimSpace(e.Signature)
+						firstToolReasoning = e.Reasoning
+					}
+				}
+			}
+			// 客户端通过 reasoning_details 带回的签名优先于服务端缓存。
+			if details.thinking != "" {
+				firstToolSig = details.thinking
 			}
 
 			// Claude thinking models: Vertex requires a thoughtSignature-carrying thought part before tool calls.
@@ -88,7 +145,7 @@ func toVertexContents(req *ChatRequest, requestID string) []vertex.Content {
 					injectedText = strings.TrimSpace(firstToolReasoning)
 				}
 				injectedSig := firstToolSig
-				if injectedSig != "" && injectedText == "" && len(m.ToolCalls) > 0 {
+				if injectedSig != "" && injectedText == "" {
 					injectedText = "[missing thought text]"
 				}
 				if injectedSig == "" && len(m.ToolCalls) > 0 {
@@ -104,46 +161,23 @@ func toVertexContents(req *ChatRequest, requestID string) []vertex.Content {
 				parts = append(parts, vertex.Part{Text: thinkingText, Thought: true})
 			}
 
-			if t := gwcommon.ExtractTextFromContent(m.Content, "\n", false); t != "" {
-				images := parseMarkdownImages(t)
-				if len(images) == 0 {
-					parts = append(parts, vertex.Part{Text: t})
-				} else {
-					last := 0
-					for _, img := range images {
-						if img.start > last {
-							if seg := t[last:img.start]; seg != "" {
-								parts = append(parts, vertex.Part{Text: seg})
-							}
-						}
-						parts = append(parts, vertex.Part{
-							InlineData:       &vertex.InlineData{MimeType: img.mimeType, Data: img.data},
-							ThoughtSignature: img.signature,
-						})
-						last = img.end
-					}
-					if last < len(t) {
-						if seg := t[last:]; seg != "" {
-							parts = append(parts, vertex.Part{Text: seg})
-						}
-					}
-				}
-			}
+			parts = append(parts, segmentAssistantContent(sigs, m.Content)...)
 			for i, tc := range m.ToolCalls {
-				args := parseArgs(tc.Function.Arguments)
 				sig := ""
 				if isGemini {
 					// Gemini: signature is attached to the first functionCall part.
 					// Claude: signature must not be placed on functionCall parts.
-					if e, ok := signature.GetManager().LookupByToolCallID(tc.ID); ok {
-						sig = strings.TrimSpace(e.Signature)
+					if sig = details.forToolCall(tc.ID, toolIDs[i]); sig == "" {
+						if e, ok := sigs.LookupByToolCallID(toolIDs[i]); ok {
+							sig = strings.TrimSpace(e.Signature)
+						}
 					}
 					if i != 0 {
 						sig = ""
 					}
 				}
 				parts = append(parts, vertex.Part{
-					FunctionCall:     &vertex.FunctionCall{ID: tc.ID, Name: tc.Function.Name, Args: args},
+					FunctionCall:     &vertex.FunctionCall{ID: toolIDs[i], Name: tc.Function.Name, Args: toolArgs[i]},
 					ThoughtSignature: sig,
 				})
 			}
@@ -151,8 +185,9 @@ func toVertexContents(req *ChatRequest, requestID string) []vertex.Content {
 				out = append(out, vertex.Content{Role: "model", Parts: parts})
 			}
 		case "tool":
-			funcName := gwcommon.FindFunctionName(out, m.ToolCallID)
-			p := vertex.Part{FunctionResponse: &vertex.FunctionResponse{ID: m.ToolCallID, Name: funcName, Response: map[string]any{"output": gwcommon.ExtractTextFromContent(m.Content, "\n", false)}}}
+			toolCallID := norm.Result(m.ToolCallID)
+			funcName := gwcommon.FindFunctionName(out, toolCallID)
+			p := vertex.Part{FunctionResponse: &vertex.FunctionResponse{ID: toolCallID, Name: funcName, Response: gwcommon.ToolResultResponse("output", gwcommon.ExtractTextFromContent(m.Content, "\n", false))}}
 			appendFunctionResponse(&out, p)
 		}
 	}
@@ -160,85 +195,45 @@ func toVertexContents(req *ChatRequest, requestID string) []vertex.Content {
 }
 
 func buildGenerationConfig(req *ChatRequest) *vertex.GenerationConfig {
-	model := strings.TrimSpace(req.Model)
-	isClaude := modelutil.IsClaude(model)
-	isGemini := modelutil.IsGemini(model)
-	isImageModel := modelutil.IsImageModel(model)
-	cfg := &vertex.GenerationConfig{CandidateCount: 1}
-	// Gemini models: maxOutputTokens is fixed at 65535.
-	if isGemini {
-		cfg.MaxOutputTokens = modelutil.GeminiMaxOutputTokens
-	} else if req.MaxTokens > 0 && !isClaude {
-		cfg.MaxOutputTokens = req.MaxTokens
-	}
-	if req.Temperature != nil {
-		cfg.Temperature = req.Temperature
-	}
-	if req.TopP != nil {
-		cfg.TopP = req.TopP
-	}
-
-	// Enable thinking output when requested. Cloud Code API differs per model family:
-	// - Gemini 3: thinkingLevel
-	// - Gemini 2.5: thinkingBudget
-	// - Claude thinking: thinkingBudget
-	if tc := modelutil.ThinkingConfigFromOpenAI(req.Model, req.ReasoningEffort); tc != nil {
-		cfg.ThinkingConfig = tc
-	}
-
-	// Claude models: maxOutputTokens is fixed at 64000.
-	if isClaude {
-		cfg.MaxOutputTokens = modelutil.ClaudeMaxOutputTokens
-	}
-
-	// When thinkingBudget is used, ensure it is compatible with maxOutputTokens.
-	if cfg.ThinkingConfig != nil && cfg.ThinkingConfig.ThinkingBudget > 0 {
-		if cfg.MaxOutputTokens <= 0 {
-			cfg.MaxOutputTokens = cfg.ThinkingConfig.ThinkingBudget + modelutil.ThinkingMaxOutputTokensOverheadTokens
-		}
-		if isClaude {
-			maxBudget := cfg.MaxOutputTokens - modelutil.ThinkingBudgetHeadroomTokens
-			if maxBudget < modelutil.ThinkingBudgetMinTokens {
-				maxBudget = modelutil.ThinkingBudgetMinTokens
-			}
-			if cfg.ThinkingConfig.ThinkingBudget > maxBudget {
-				cfg.ThinkingConfig.ThinkingBudget = maxBudget
-			}
-		} else if isGemini && cfg.MaxOutputTokens <= cfg.ThinkingConfig.ThinkingBudget {
-			maxBudget := cfg.MaxOutputTokens - modelutil.ThinkingBudgetHeadroomTokens
-			if maxBudget < modelutil.ThinkingBudgetMinTokens {
-				maxBudget = modelutil.ThinkingBudgetMinTokens
-			}
-			cfg.ThinkingConfig.ThinkingBudget = maxBudget
-		} else if cfg.MaxOutputTokens <= cfg.ThinkingConfig.ThinkingBudget {
-			cfg.MaxOutputTokens = cfg.ThinkingConfig.ThinkingBudget + modelutil.ThinkingMaxOutputTokensOverheadTokens
-		}
-	}
-
-	// Gemini image size virtual models: force imageConfig.imageSize via the model name.
-	if imageSize, _, ok := modelutil.GeminiProImageSizeConfig(model); ok {
-		cfg.ImageConfig = &vertex.ImageConfig{ImageSize: imageSize}
-	}
-
-	// Gemini 3: apply global mediaResolution when configured.
-	if modelutil.IsGemini3(model) && !isImageModel {
-		if v, ok := modelutil.ToAPIMediaResolution(config.Get().Gemini3MediaResolution); ok && v != "" {
-			cfg.MediaResolution = v
-		}
-	}
-	return cfg
+	return modelutil.BuildGenerationConfig(req.Model, modelutil.GenerationParams{
+		MaxOutputTokens: req.MaxTokens,
+		Temperature:     req.Temperature,
+		TopP:            req.TopP,
+		// reasoning_effort 映射：Gemini 3 使用 thinkingLevel，Gemini 2.5 / Claude 使用 thinkingBudget。
+		Thinking:        modelutil.ThinkingConfigFromOpenAI(req.Model, req.ReasoningEffort),
+		MediaResolution: req.MediaResolution,
+	})
 }
 
 func toVertexTools(tools []Tool) []vertex.Tool {
 	var out []vertex.Tool
 	for _, t := range tools {
 		params := vertex.SanitizeFunctionParametersSchema(t.Function.Parameters)
-		out = append(out, vertex.Tool{FunctionDeclarations: []vertex.FunctionDeclaration{{Name: t.Function.Name, Description: t.Function.Description, Parameters: params}}})
+		strict := t.Function.Strict != nil && *t.Function.Strict
+		if strict {
+			warnStrictSchemaLoss(t.Function.Name, vertex.LostSchemaConstraints(t.Function.Parameters, params))
+		}
+		out = append(out, vertex.Tool{FunctionDeclarations: []vertex.FunctionDeclaration{{Name: t.Function.Name, Description: t.Function.Description, Parameters: params, Strict: strict}}})
 	}
 	return out
 }
 
-func extractUserParts(content any) []vertex.Part {
+// strictSchemaWarned 记录已告警过的 strict 工具（名称与丢失的约束），同一定义只告警一次。
+var strictSchemaWarned sync.Map
+
+// warnStrictSchemaLoss 在 strict 函数的 schema 约束因上游不支持而被删除时告警：模型输出的参数不再保证满足这些约束。
+func warnStrictSchemaLoss(name string, lost []string) {
+	if len(lost) == 0 {
+		return
+	}
+	key := name + "\x00" + strings.Join(lost, ",")
+	if _, warned := strictSchemaWarned.LoadOrStore(key, true); warned {
+		return
+	}
+	logger.Warn("工具 %s 声明了 strict: true，但以下 schema 约束 Cloud Code 不支持、已被移除，参数将不再严格保证：%s", name, strings.Join(lost, ", "))
+}
+
+func extractUserParts(sigs *signature.Manager, content any) []vertex.Part {
 	var out []vertex.Part
 	switch v := content.(type) {
 	case string:
@@ -264,15 +259,7 @@ func extractUserParts(content any) []vertex.Part {
 				}
 				urlStr, _ := img["url"].(string)
 				if inline := parseImageURL(urlStr); inline != nil {
-					imageKey := inline.Data
-					if len(imageKey) > 20 {
-						imageKey = imageKey[:20]
-					}
-					sig := ""
-					if e, ok := signature.GetManager().LookupByToolCallID(imageKey); ok {
-						sig = e.Signature
-					}
-					out = append(out, vertex.Part{InlineData: inline, ThoughtSignature: sig})
+					out = append(out, imagePart(sigs, inline))
 				}
 			}
 		}
@@ -280,53 +267,11 @@ func extractUserParts(content any) []vertex.Part {
 	return out
 }
 
-var markdownImageRe = regexp.MustCompile(`!\[image\]\(data:([^;]+);base64,([^)]+)\)`)
-
-type markdownImage struct {
-	mimeType  string
-	data      string
-	signature string
-	start     int
-	end       int
-}
-
-func parseMarkdownImages(content string) []markdownImage {
-	matches := markdownImageRe.FindAllStringSubmatchIndex(content, -1)
-	if len(matches) == 0 {
-		return nil
-	}
-
-	out := make([]markdownImage, 0, len(matches))
-	for _, m := range matches {
-		if len(m) != 6 {
-			continue
-		}
-		mimeType := content[m[2]:m[3]]
-		base64Data := content[m[4]:m[5]]
-
-		imageKey := base64Data
-		if len(imageKey) > 20 {
-			imageKey = imageKey[:20]
-		}
-		sig := ""
-		if e, ok := signature.GetManager().LookupByToolCallID(imageKey); ok {
-			sig = e.Signature
-		}
-
-		out = append(out, markdownImage{
-			mimeType:  mimeType,
-			data:      base64Data,
-			signature: sig,
-			start:     m[0],
-			end:       m[1],
-		})
-	}
-	return out
-}
+// imageDataURLRe 匹配 data URL 图片；子类型允许 "+" / "." / "-"（例如 image/svg+xml）。
+var imageDataURLRe = regexp.MustCompile(`^data:image/([\w.+-]+);base64,(.+)$`)
 
 func parseImageURL(urlStr string) *vertex.InlineData {
-	re := regexp.MustCompile(`^data:image/(\w+);base64,(.+)$`)
-	if matches := re.FindStringSubmatch(urlStr); len(matches) == 3 {
+	if matches := imageDataURLRe.FindStringSubmatch(urlStr); len(matches) == 3 {
 		return &vertex.InlineData{MimeType: "image/" + matches[1], Data: matches[2]}
 	}
 	return nil
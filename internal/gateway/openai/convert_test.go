@@ -1,9 +1,16 @@
 package openai
 
 import (
+	"net/http/httptest"
+	"os"
+	"slices"
+	"strings"
 	"testing"
 
 	"anti2api-golang/refactor/internal/config"
+	gwcommon "anti2api-golang/refactor/internal/gateway/common"
+	jsonpkg "anti2api-golang/refactor/internal/pkg/json"
+	"anti2api-golang/refactor/internal/vertex"
 )
 
 func TestBuildGenerationConfig_GeminiProImageVirtual_ForcesImageSize(t *testing.T) {
@@ -78,3 +85,215 @@ func TestBuildGenerationConfig_NonGemini3_DoesNotApplyGlobalMediaResolution(t *t
 		t.Fatalf("expected mediaResolution to be empty, got %q", cfg.MediaResolution)
 	}
 }
+
+func TestClaudeThinking_TextTurnSignatureRoundTrip(t *testing.T) {
+	// 签名缓存会写入 DataDir，测试中指向临时目录。
+	c := config.Get()
+	oldDir := c.DataDir
+	dir, err := os.MkdirTemp("", "openai-sig-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.DataDir = dir
+	t.Cleanup(func() {
+		c.DataDir = oldDir
+		_ = os.RemoveAll(dir)
+	})
+
+	model := "claude-sonnet-4-5-thinking"
+	resp := &vertex.Response{}
+	resp.Response.Candidates = []vertex.Candidate{{Content: vertex.Content{Role: "model", Parts: []vertex.Part{
+		{Text: "let me think", Thought: true, ThoughtSignature: "sig-text-turn"},
+		{Text: "The answer is 42."},
+	}}}}
+	out := ToChatCompletion(resp, model, "req-text-turn", "")
+	if out.Choices[0].Message.Content != "The answer is 42." {
+		t.Fatalf("unexpected content %v", out.Choices[0].Message.Content)
+	}
+
+	req := &ChatRequest{Model: model, Messages: []Message{
+		{Role: "user", Content: "question"},
+		{Role: "assistant", Content: "The answer is 42."},
+		{Role: "user", Content: "why?"},
+	}}
+	contents := toVertexContents(req, "req-next")
+	if len(contents) != 3 {
+		t.Fatalf("expected 3 contents, got %d", len(contents))
+	}
+	parts := contents[1].Parts
+	if len(parts) != 2 || !parts[0].Thought || parts[0].ThoughtSignature != "sig-text-turn" || parts[0].Text != "let me think" {
+		t.Fatalf("expected reconstructed thinking part, got %+v", parts)
+	}
+
+	req.Messages[1].Content = "A different answer."
+	if parts := toVertexContents(req, "req-next")[1].Parts; len(parts) != 1 || parts[0].Thought {
+		t.Fatalf("expected no thinking part for an unknown turn, got %+v", parts)
+	}
+}
+
+func TestImageResponse_MarkdownContent(t *testing.T) {
+	img := &vertex.InlineData{MimeType: "image/png", Data: strings.Repeat("A", 1024)}
+	want := "here ![image](data:image/png;base64," + img.Data + ")"
+
+	resp := &vertex.Response{}
+	resp.Response.Candidates = []vertex.Candidate{{Content: vertex.Content{Role: "model", Parts: []vertex.Part{
+		{Text: "here "},
+		{InlineData: img},
+	}}}}
+	if got := ToChatCompletion(resp, "gemini-3-pro-image", "req-image", "").Choices[0].Message.Content; got != want {
+		t.Fatalf("unexpected non-stream content %q", got)
+	}
+	if resp.InlineDataBytes() != len(img.Data) {
+		t.Fatalf("unexpected inline data size %d", resp.InlineDataBytes())
+	}
+
+	rec := httptest.NewRecorder()
+	sw := NewStreamWriter(rec, "chatcmpl-test", 0, "gemini-3-pro-image", "req-image")
+	_ = sw.ProcessPart(StreamDataPart{Text: "here "})
+	_ = sw.ProcessPart(StreamDataPart{InlineData: img})
+	var got strings.Builder
+	for _, line := range strings.Split(rec.Body.String(), "\n") {
+		var chunk struct {
+			Choices []struct {
+				Delta struct {
+					Content string `json:"content"`
+				} `json:"delta"`
+			} `json:"choices"`
+		}
+		if data, ok := strings.CutPrefix(line, "data: "); ok && jsonpkg.UnmarshalString(data, &chunk) == nil && len(chunk.Choices) > 0 {
+			got.WriteString(chunk.Choices[0].Delta.Content)
+		}
+	}
+	if got.String() != want {
+		t.Fatalf("unexpected stream content %q", got.String())
+	}
+}
+
+func TestToVertexRequest_Prediction(t *testing.T) {
+	body := `{"model":"gemini-2.5-pro","messages":[{"role":"user","content":"rename foo"}],` +
+		`"prediction":{"type":"content","content":[{"type":"text","text":"func bar() {}"}]}}`
+	var req ChatRequest
+	if err := jsonpkg.UnmarshalString(body, &req); err != nil {
+		t.Fatalf("unmarshal: %v", err)
+	}
+	if req.Prediction == nil || req.Prediction.Type != "content" {
+		t.Fatalf("prediction not parsed: %#v", req.Prediction)
+	}
+
+	hasHint := func(vreq *vertex.Request) bool {
+		if vreq.Request.SystemInstruction == nil {
+			return false
+		}
+		for _, p := range vreq.Request.SystemInstruction.Parts {
+			if strings.Contains(p.Text, "<predicted_output>\nfunc bar() {}\n</predicted_output>") {
+				return true
+			}
+		}
+		return false
+	}
+
+	c := config.Get()
+	old := c.OpenAIPredictionHint
+	t.Cleanup(func() { c.OpenAIPredictionHint = old })
+
+	c.OpenAIPredictionHint = false
+	vreq, _, err := ToVertexRequest(&req, &gwcommon.AccountContext{ProjectID: "p", SessionID: "s"})
+	if err != nil {
+		t.Fatalf("ToVertexRequest: %v", err)
+	}
+	if hasHint(vreq) {
+		t.Fatal("prediction should be ignored by default")
+	}
+
+	c.OpenAIPredictionHint = true
+	vreq, _, err = ToVertexRequest(&req, &gwcommon.AccountContext{ProjectID: "p", SessionID: "s"})
+	if err != nil {
+		t.Fatalf("ToVertexRequest: %v", err)
+	}
+	if !hasHint(vreq) {
+		t.Fatalf("expected prediction hint in system instruction: %#v", vreq.Request.SystemInstruction)
+	}
+}
+
+func TestToVertexRequest_StrictTool(t *testing.T) {
+	body := `{"model":"gemini-2.5-pro","messages":[{"role":"user","content":"hi"}],"tools":[{"type":"function","function":{` +
+		`"name":"lookup","strict":true,"parameters":{"type":"object","additionalProperties":false,"required":["id","tag"],` +
+		`"properties":{"id":{"type":"string","pattern":"^[a-z]+$"},"tag":{"type":["string","null"]}}}}}]}`
+	var req ChatRequest
+	if err := jsonpkg.UnmarshalString(body, &req); err != nil {
+		t.Fatalf("unmarshal: %v", err)
+	}
+	vreq, _, err := ToVertexRequest(&req, &gwcommon.AccountContext{ProjectID: "p", SessionID: "s"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	fd := vreq.Request.Tools[0].FunctionDeclarations[0]
+	if !fd.Strict {
+		t.Fatalf("strict flag not recorded: %+v", fd)
+	}
+	if got := fd.Parameters["required"]; !slices.Equal(got.([]string), []string{"id", "tag"}) {
+		t.Fatalf("required = %#v, want [id tag]", got)
+	}
+	out, _ := jsonpkg.MarshalString(vreq)
+	if strings.Contains(out, "strict") {
+		t.Fatalf("strict must not be sent upstream: %s", out)
+	}
+}
+
+func TestToVertexRequest_NoSystemInjectionKeepsSystemPromptExact(t *testing.T) {
+	req := ChatRequest{Model: "gemini-2.5-pro", Messages: []Message{{Role: "system", Content: "exact prompt"}, {Role: "user", Content: "hi"}}}
+	vreq, _, err := ToVertexRequest(&req, &gwcommon.AccountContext{ProjectID: "p", SessionID: "s"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sys := vreq.Request.SystemInstruction; sys == nil || !strings.HasPrefix(sys.Parts[0].Text, vertex.AgentSystemPrompt) {
+		t.Fatalf("expected agent prompt to be injected by default, got %#v", sys)
+	}
+
+	req.NoSystemInjection = true
+	vreq, _, err = ToVertexRequest(&req, &gwcommon.AccountContext{ProjectID: "p", SessionID: "s"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sys := vreq.Request.SystemInstruction; sys == nil || len(sys.Parts) != 1 || sys.Parts[0].Text != "exact prompt" {
+		t.Fatalf("expected byte-exact system prompt, got %#v", sys)
+	}
+}
+
+func TestReasoningDetails_SignatureRoundTrip(t *testing.T) {
+	c := config.Get()
+	oldDir := c.DataDir
+	c.DataDir = t.TempDir()
+	t.Cleanup(func() { c.DataDir = oldDir })
+
+	// Gemini：签名附在函数调用上，以 reasoning.encrypted + tool call id 下发。
+	resp := &vertex.Response{}
+	resp.Response.Candidates = []vertex.Candidate{{Content: vertex.Content{Role: "model", Parts: []vertex.Part{
+		{FunctionCall: &vertex.FunctionCall{ID: "call_1", Name: "ls", Args: map[string]any{}}, ThoughtSignature: "sig-gemini"},
+	}}}}
+	details := ToChatCompletion(resp, "gemini-2.5-pro", "req-details", "").Choices[0].Message.ReasoningDetails
+	if len(details) != 1 || details[0].Type != reasoningDetailEncrypted || details[0].ID != "call_1" || details[0].Signature != "sig-gemini" || details[0].Format != "google-gemini-v1" {
+		t.Fatalf("unexpected reasoning_details: %+v", details)
+	}
+
+	// 客户端带回的签名优先于缓存：这里与缓存中的签名不同。
+	req := &ChatRequest{Model: "gemini-2.5-pro", Messages: []Message{
+		{Role: "user", Content: "list"},
+		{Role: "assistant", ToolCalls: []ToolCall{{ID: "call_1", Type: "function", Function: FunctionCall{Name: "ls", Arguments: "{}"}}},
+			ReasoningDetails: []ReasoningDetail{{Type: reasoningDetailEncrypted, ID: "call_1", Signature: "sig-client"}}},
+	}}
+	if parts := toVertexContents(req, "req-next")[1].Parts; parts[0].ThoughtSignature != "sig-client" {
+		t.Fatalf("expected client signature on the function call, got %+v", parts)
+	}
+
+	// Claude thinking：没有服务端缓存时，用 reasoning.text 中的签名与文本重建 thinking 块。
+	req = &ChatRequest{Model: "claude-sonnet-4-5-thinking", Messages: []Message{
+		{Role: "user", Content: "question"},
+		{Role: "assistant", Content: "uncached answer", ReasoningDetails: []ReasoningDetail{{Type: reasoningDetailText, Text: "thinking...", Signature: "sig-claude"}}},
+		{Role: "user", Content: "why?"},
+	}}
+	parts := toVertexContents(req, "req-next")[1].Parts
+	if len(parts) != 2 || !parts[0].Thought || parts[0].ThoughtSignature != "sig-claude" || parts[0].Text != "thinking..." {
+		t.Fatalf("expected thinking part from reasoning_details, got %+v", parts)
+	}
+}
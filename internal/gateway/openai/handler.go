@@ -2,24 +2,30 @@ package openai
 
 import (
 	"context"
-	"io"
+	"errors"
 	"net/http"
 	"strings"
 	"time"
 
 	"anti2api-golang/refactor/internal/credential"
 	gwcommon "anti2api-golang/refactor/internal/gateway/common"
+	"anti2api-golang/refactor/internal/hooks"
 	"anti2api-golang/refactor/internal/logger"
+	"anti2api-golang/refactor/internal/middleware"
 	httppkg "anti2api-golang/refactor/internal/pkg/http"
 	"anti2api-golang/refactor/internal/pkg/id"
 	jsonpkg "anti2api-golang/refactor/internal/pkg/json"
+	"anti2api-golang/refactor/internal/pkg/memory"
 	"anti2api-golang/refactor/internal/pkg/modelutil"
+	"anti2api-golang/refactor/internal/pkg/spool"
+	"anti2api-golang/refactor/internal/secondary"
+	"anti2api-golang/refactor/internal/transcript"
 	"anti2api-golang/refactor/internal/vertex"
 )
 
 func HandleListModels(w http.ResponseWriter, r *http.Request) {
 	if logger.IsClientLogEnabled() {
-		logger.ClientRequestWithHeaders(r.Method, r.URL.Path, r.Header, nil)
+		logger.ClientRequestWithHeaders(r.Method, r.URL.RequestURI(), r.Header, nil)
 	}
 	startTime := time.Now()
 	store := credential.GetStore()
@@ -51,14 +57,11 @@ func HandleListModels(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 	if lastErr != nil || vm == nil {
-		status := gwcommon.StatusFromVertexError(lastErr)
-		if _, ok := lastErr.(*vertex.APIError); !ok {
-			status = http.StatusServiceUnavailable
-		}
+		status := gwcommon.UpstreamFailureStatus(lastErr)
 		if logger.IsClientLogEnabled() {
 			logger.ClientResponse(status, time.Since(startTime), lastErr.Error())
 		}
-		httppkg.WriteOpenAIError(w, status, lastErr.Error())
+		httppkg.WriteOpenAIErrorWithType(w, status, gwcommon.UpstreamErrorMessage(lastErr), upstreamErrorType(lastErr))
 		return
 	}
 
@@ -66,13 +69,7 @@ func HandleListModels(w http.ResponseWriter, r *http.Request) {
 
 	items := make([]ModelItem, 0, len(ids))
 	for _, mid := range ids {
-		owned := "google"
-		if strings.HasPrefix(mid, "claude-") {
-			owned = "anthropic"
-		} else if strings.HasPrefix(mid, "gpt-") {
-			owned = "openai"
-		}
-		items = append(items, ModelItem{ID: mid, Object: "model", OwnedBy: owned})
+		items = append(items, newModelItem(mid, vm))
 	}
 
 	out := ModelsResponse{Object: "list", Data: items}
@@ -82,15 +79,74 @@ func HandleListModels(w http.ResponseWriter, r *http.Request) {
 	httppkg.WriteJSON(w, http.StatusOK, out)
 }
 
+// HandleRetrieveModel 处理 GET /v1/models/{id}，部分客户端会在对话前确认模型存在。
+func HandleRetrieveModel(w http.ResponseWriter, r *http.Request, modelID string) {
+	if logger.IsClientLogEnabled() {
+		logger.ClientRequestWithHeaders(r.Method, r.URL.RequestURI(), r.Header, nil)
+	}
+	startTime := time.Now()
+
+	vm, err := gwcommon.FetchAvailableModels(r.Context())
+	if err != nil {
+		status := gwcommon.FetchModelsErrorStatus(err)
+		if logger.IsClientLogEnabled() {
+			logger.ClientResponse(status, time.Since(startTime), err.Error())
+		}
+		httppkg.WriteOpenAIError(w, status, err.Error())
+		return
+	}
+	mid, ok := gwcommon.FindModelID(vm, modelID)
+	if !ok {
+		msg := "模型不存在: " + modelID
+		if logger.IsClientLogEnabled() {
+			logger.ClientResponse(http.StatusNotFound, time.Since(startTime), msg)
+		}
+		httppkg.WriteOpenAIErrorWithCode(w, http.StatusNotFound, msg, "invalid_request_error", "model_not_found")
+		return
+	}
+
+	out := newModelItem(mid, vm)
+	if logger.IsClientLogEnabled() {
+		logger.ClientResponse(http.StatusOK, time.Since(startTime), out)
+	}
+	httppkg.WriteJSON(w, http.StatusOK, out)
+}
+
+func newModelItem(mid string, vm *vertex.AvailableModelsResponse) ModelItem {
+	owned := "google"
+	if strings.HasPrefix(mid, "claude-") {
+		owned = "anthropic"
+	} else if strings.HasPrefix(mid, "gpt-") {
+		owned = "openai"
+	}
+	caps := modelutil.CapabilitiesFor(mid, modelutil.UpstreamModelInfo(vm.Models, mid))
+	return ModelItem{
+		ID:               mid,
+		Object:           "model",
+		Created:          gwcommon.ModelsCreatedAt.Unix(),
+		OwnedBy:          owned,
+		ContextLength:    caps.ContextWindow,
+		MaxOutputTokens:  caps.MaxOutputTokens,
+		InputModalities:  caps.InputModalities,
+		OutputModalities: caps.OutputModalities,
+		SupportsThinking: caps.SupportsThinking,
+	}
+}
+
 func HandleChatCompletions(w http.ResponseWriter, r *http.Request) {
-	body, err := io.ReadAll(r.Body)
+	reqBody, err := spool.ReadRequest(r)
 	if err != nil {
 		httppkg.WriteOpenAIError(w, http.StatusBadRequest, "读取请求体失败，请检查请求是否正确发送。")
 		return
 	}
+	defer reqBody.Close()
+	body := reqBody.Bytes()
+
+	var respBytes int
+	defer func() { memory.AfterLargeRequest(len(body) + respBytes) }()
 
 	if logger.IsClientLogEnabled() {
-		logger.ClientRequestWithHeaders(r.Method, r.URL.Path, r.Header, body)
+		logger.ClientRequestWithHeaders(r.Method, r.URL.RequestURI(), r.Header, body)
 	}
 
 	var req ChatRequest
@@ -98,15 +154,52 @@ func HandleChatCompletions(w http.ResponseWriter, r *http.Request) {
 		httppkg.WriteOpenAIError(w, http.StatusBadRequest, "请求 JSON 解析失败，请检查请求体格式。")
 		return
 	}
+	req.Model = gwcommon.PresetModel(r.Context(), req.Model)
+	req.ClineCompat = isClineCompat(r)
+	req.NoSystemInjection = gwcommon.SkipSystemInjection(r)
+	req.Tenant = middleware.TenantFromContext(r.Context())
+	rec := transcript.Begin(r, "openai", body, req.Model, req.Stream)
+	sessionID, err := gwcommon.SessionIDFromRequest(r)
+	if err != nil {
+		rec.Finish(transcript.Result{Status: http.StatusBadRequest, Model: req.Model, Error: err.Error()})
+		httppkg.WriteOpenAIError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if req.MediaResolution, err = gwcommon.ResolveMediaResolution(r.Header, req.MediaResolution); err != nil {
+		rec.Finish(transcript.Result{Status: http.StatusBadRequest, Model: req.Model, Error: err.Error()})
+		httppkg.WriteOpenAIErrorWithType(w, http.StatusBadRequest, err.Error(), "invalid_request_error")
+		return
+	}
 
 	placeholder := &gwcommon.AccountContext{ProjectID: id.ProjectID(), SessionID: id.SessionID()}
 	vreq, requestID, err := ToVertexRequest(&req, placeholder)
 	if err != nil {
+		rec.Finish(transcript.Result{Status: http.StatusBadRequest, Model: req.Model, Error: err.Error()})
+		httppkg.WriteOpenAIError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if err := gwcommon.CheckTurnLimit(vreq); err != nil {
+		rec.Finish(transcript.Result{Status: http.StatusBadRequest, Model: req.Model, Error: err.Error()})
+		httppkg.WriteOpenAIErrorWithCode(w, http.StatusBadRequest, err.Error(), "invalid_request_error", gwcommon.TooManyTurnsCode)
+		return
+	}
+	gwcommon.ApplyKeyPreset(r.Context(), vreq)
+	if err := gwcommon.ApplyThinkingHeaders(r.Header, req.Model, vreq); err != nil {
+		rec.Finish(transcript.Result{Status: http.StatusBadRequest, Model: req.Model, Error: err.Error()})
 		httppkg.WriteOpenAIError(w, http.StatusBadRequest, err.Error())
 		return
 	}
+	gwcommon.DowngradeThinking(w, req.Model, vreq)
+	scrubber := gwcommon.NewPIIScrubber()
+	scrubber.ScrubRequest(vreq)
 
 	ctx := r.Context()
+	hookInfo := &hooks.Info{Endpoint: "openai", Model: req.Model, Stream: req.Stream, Header: r.Header}
+	if apiErr := hooks.BeforeRequest(ctx, hookInfo, vreq); apiErr != nil {
+		rec.Finish(transcript.Result{Status: apiErr.Status, Model: req.Model, VertexRequest: vreq, Error: apiErr.Message})
+		httppkg.WriteOpenAIError(w, apiErr.Status, apiErr.Message)
+		return
+	}
 	store := credential.GetStore()
 	attempts := store.EnabledCount()
 	if attempts < 1 {
@@ -114,90 +207,223 @@ func HandleChatCompletions(w http.ResponseWriter, r *http.Request) {
 	}
 
 	if req.Stream {
-		handleStreamWithRetry(w, ctx, &req, vreq, requestID, store, attempts)
+		handleStreamWithRetry(w, ctx, &req, vreq, requestID, sessionID, store, attempts, rec, scrubber, hookInfo)
 		return
 	}
 
 	startTime := time.Now()
-	var vresp *vertex.Response
-	var lastErr error
-	for attempt := 0; attempt < attempts; attempt++ {
-		acc, err := store.GetToken()
-		if err != nil {
+	generate := func() (*vertex.Response, error) {
+		var vresp *vertex.Response
+		var lastErr error
+		for attempt := 0; attempt < attempts; attempt++ {
+			acc, err := store.GetTokenForModel(vreq.Model, modelutil.IsImageModel(vreq.Model))
+			if err != nil {
+				lastErr = err
+				break
+			}
+			projectID := acc.ProjectID
+			if projectID == "" {
+				projectID = id.ProjectID()
+			}
+			rec.SetAccount(acc.Email)
+			vreq.Project = projectID
+			vreq.Request.SessionID = acc.SessionID
+			if sessionID != "" {
+				vreq.Request.SessionID = sessionID
+			}
+
+			vresp, err = vertex.GenerateContent(ctx, vreq, acc.AccessToken)
+			if refreshed, ok := gwcommon.RefreshOnUnauthorized(store, acc, err); ok {
+				vresp, err = vertex.GenerateContent(ctx, vreq, refreshed.AccessToken)
+				gwcommon.DisableOnUnauthenticated(store, refreshed, err)
+			}
+			if err == nil {
+				vreq.Account = acc.SessionID
+				gwcommon.SetQuotaHeaders(w, acc.SessionID, vreq.Model)
+				return vresp, nil
+			}
 			lastErr = err
-			break
-		}
-		projectID := acc.ProjectID
-		if projectID == "" {
-			projectID = id.ProjectID()
+			if !gwcommon.ShouldRetryWithNextToken(err) {
+				break
+			}
 		}
-		vreq.Project = projectID
-		vreq.Request.SessionID = acc.SessionID
+		return nil, lastErr
+	}
 
-		vresp, err = vertex.GenerateContent(ctx, vreq, acc.AccessToken)
-		if err == nil {
-			lastErr = nil
-			break
+	vresp, lastErr := generate()
+	vresp, servedModel, lastErr := gwcommon.TryModelFallbacks(req.Model, vresp, lastErr, func(fallback string) (*vertex.Response, error) {
+		fbReq := req
+		fbReq.Model = fallback
+		fbVreq, fbRequestID, err := ToVertexRequest(&fbReq, placeholder)
+		if err != nil {
+			return nil, err
 		}
-		lastErr = err
-		if !gwcommon.ShouldRetryWithNextToken(err) {
-			break
+		gwcommon.ApplyKeyPreset(r.Context(), fbVreq)
+		_ = gwcommon.ApplyThinkingHeaders(r.Header, fallback, fbVreq)
+		gwcommon.DowngradeThinking(w, fallback, fbVreq)
+		scrubber.ScrubRequest(fbVreq)
+		fbInfo := *hookInfo
+		fbInfo.Model = fallback
+		if apiErr := hooks.BeforeRequest(ctx, &fbInfo, fbVreq); apiErr != nil {
+			return nil, apiErr
 		}
+		vreq, requestID = fbVreq, fbRequestID
+		return generate()
+	})
+	vresp, servedModel, lastErr = gwcommon.TrySecondaryBackend(ctx, req.Model, servedModel, vresp, lastErr, func(target string) (*vertex.Response, error) {
+		return secondary.GenerateContent(ctx, target, vreq)
+	})
+	gwcommon.SetServedModelHeaders(w, servedModel)
+	gwcommon.SetUpstreamHeaders(w, vresp, lastErr)
+	if lastErr == nil && gwcommon.IsMalformedFunctionCall(vresp) && gwcommon.ForceAnyToolMode(vreq) {
+		logger.Warn("上游返回 MALFORMED_FUNCTION_CALL，使用 toolConfig.mode=ANY 重试一次")
+		vresp, lastErr = generate()
 	}
 	if lastErr != nil || vresp == nil {
-		status := gwcommon.StatusFromVertexError(lastErr)
-		if _, ok := lastErr.(*vertex.APIError); !ok {
-			status = http.StatusServiceUnavailable
-		}
+		status := gwcommon.UpstreamFailureStatus(lastErr)
 		if logger.IsClientLogEnabled() {
 			logger.ClientResponse(status, time.Since(startTime), lastErr.Error())
 		}
-		httppkg.WriteOpenAIError(w, status, lastErr.Error())
+		rec.Finish(transcript.Result{Status: status, Model: servedModel, VertexRequest: vreq, Error: lastErr.Error()})
+		httppkg.WriteOpenAIErrorWithType(w, status, gwcommon.UpstreamErrorMessage(lastErr), upstreamErrorType(lastErr))
+		return
+	}
+	if gwcommon.IsMalformedFunctionCall(vresp) {
+		if logger.IsClientLogEnabled() {
+			logger.ClientResponse(http.StatusBadGateway, time.Since(startTime), gwcommon.MalformedFunctionCallMessage)
+		}
+		rec.Finish(transcript.Result{Status: http.StatusBadGateway, Model: servedModel, VertexRequest: vreq, VertexResponse: vresp, Error: gwcommon.MalformedFunctionCallMessage})
+		httppkg.WriteOpenAIError(w, http.StatusBadGateway, gwcommon.MalformedFunctionCallMessage)
+		return
+	}
+	if fb := gwcommon.BlockedPromptFeedback(vresp); fb != nil {
+		msg := gwcommon.ContentFilterMessage(fb)
+		if logger.IsClientLogEnabled() {
+			logger.ClientResponse(http.StatusBadRequest, time.Since(startTime), msg)
+		}
+		rec.Finish(transcript.Result{Status: http.StatusBadRequest, Model: servedModel, VertexRequest: vreq, VertexResponse: vresp, Error: msg})
+		httppkg.WriteOpenAIErrorWithCode(w, http.StatusBadRequest, msg, "invalid_request_error", "content_filter")
 		return
 	}
 
-	out := ToChatCompletion(vresp, req.Model, requestID)
+	scrubber.RestoreResponse(vresp)
+	gwcommon.NewPrefillJoiner(vreq).JoinResponse(vresp)
+	respBytes = vresp.InlineDataBytes()
+	gwcommon.RecordResponseUsage(ctx, "openai", servedModel, vreq, vresp)
+	completion := ToChatCompletion(vresp, servedModel, requestID, req.Tenant)
+	completion.Model = gwcommon.ResponseModel(req.Model, servedModel)
+	if u, estimated := gwcommon.ResponseUsage(vreq, vresp); estimated {
+		completion.Usage = ConvertUsage(u)
+	}
+	if req.ClineCompat {
+		applyClineCompat(completion, vresp)
+	}
+	completion.Warning = modalitiesWarning(&req)
+	out := hooks.AfterResponse(ctx, hookInfo, completion)
 	if logger.IsClientLogEnabled() {
 		logger.ClientResponse(http.StatusOK, time.Since(startTime), out)
 	}
+	rec.Finish(transcript.Result{Status: http.StatusOK, Model: servedModel, VertexRequest: vreq, VertexResponse: vresp, ClientResponse: out})
 	httppkg.WriteJSON(w, http.StatusOK, out)
 }
 
-func handleStreamWithRetry(w http.ResponseWriter, ctx context.Context, req *ChatRequest, vreq *vertex.Request, requestID string, store *credential.Store, attempts int) {
+func handleStreamWithRetry(w http.ResponseWriter, ctx context.Context, req *ChatRequest, vreq *vertex.Request, requestID, sessionID string, store *credential.Store, attempts int, rec *transcript.Recorder, scrubber *gwcommon.PIIScrubber, hookInfo *hooks.Info) {
 	startTime := time.Now()
-	var resp *http.Response
-	var err error
-	for attempt := 0; attempt < attempts; attempt++ {
-		acc, accErr := store.GetToken()
-		if accErr != nil {
-			err = accErr
-			break
-		}
-		projectID := acc.ProjectID
-		if projectID == "" {
-			projectID = id.ProjectID()
+	var upstream gwcommon.UpstreamTimer
+	openStream := func() (*http.Response, error) {
+		var resp *http.Response
+		var err error
+		upstream.Start()
+		for attempt := 0; attempt < attempts; attempt++ {
+			acc, accErr := store.GetTokenForModel(vreq.Model, modelutil.IsImageModel(vreq.Model))
+			if accErr != nil {
+				err = accErr
+				break
+			}
+			projectID := acc.ProjectID
+			if projectID == "" {
+				projectID = id.ProjectID()
+			}
+			rec.SetAccount(acc.Email)
+			vreq.Project = projectID
+			vreq.Request.SessionID = acc.SessionID
+			if sessionID != "" {
+				vreq.Request.SessionID = sessionID
+			}
+
+			resp, err = vertex.GenerateContentStream(ctx, vreq, acc.AccessToken)
+			if refreshed, ok := gwcommon.RefreshOnUnauthorized(store, acc, err); ok {
+				resp, err = vertex.GenerateContentStream(ctx, vreq, refreshed.AccessToken)
+				gwcommon.DisableOnUnauthenticated(store, refreshed, err)
+			}
+			if err == nil {
+				upstream.Opened(acc.Email)
+				vreq.Account = acc.SessionID
+				gwcommon.SetQuotaHeaders(w, acc.SessionID, vreq.Model)
+				break
+			}
+			if !gwcommon.ShouldRetryWithNextToken(err) {
+				break
+			}
 		}
-		vreq.Project = projectID
-		vreq.Request.SessionID = acc.SessionID
+		return resp, err
+	}
 
-		resp, err = vertex.GenerateContentStream(ctx, vreq, acc.AccessToken)
-		if err == nil {
-			break
+	resp, err := openStream()
+	resp, servedModel, err := gwcommon.TryModelFallbacks(req.Model, resp, err, func(fallback string) (*http.Response, error) {
+		fbReq := *req
+		fbReq.Model = fallback
+		fbVreq, fbRequestID, buildErr := ToVertexRequest(&fbReq, &gwcommon.AccountContext{ProjectID: id.ProjectID(), SessionID: id.SessionID()})
+		if buildErr != nil {
+			return nil, buildErr
 		}
-		if !gwcommon.ShouldRetryWithNextToken(err) {
-			break
+		gwcommon.ApplyKeyPreset(ctx, fbVreq)
+		_ = gwcommon.ApplyThinkingHeaders(hookInfo.Header, fallback, fbVreq)
+		gwcommon.DowngradeThinking(w, fallback, fbVreq)
+		scrubber.ScrubRequest(fbVreq)
+		fbInfo := *hookInfo
+		fbInfo.Model = fallback
+		if apiErr := hooks.BeforeRequest(ctx, &fbInfo, fbVreq); apiErr != nil {
+			return nil, apiErr
 		}
-	}
+		vreq, requestID = fbVreq, fbRequestID
+		return openStream()
+	})
+	resp, servedModel, err = gwcommon.TrySecondaryBackend(ctx, req.Model, servedModel, resp, err, func(target string) (*http.Response, error) {
+		return secondary.GenerateContentStream(ctx, target, vreq)
+	})
+	gwcommon.SetServedModelHeaders(w, servedModel)
+	gwcommon.SetUpstreamStreamHeaders(w, resp, err)
 	if err != nil {
-		httppkg.SetSSEHeaders(w)
-		WriteSSEError(w, err.Error())
+		rec.Finish(transcript.Result{Status: gwcommon.StatusFromVertexError(err), Model: servedModel, VertexRequest: vreq, Error: err.Error()})
+		// 尚未开始输出 SSE，直接以上游状态码返回错误，便于客户端按状态码重新认证或重试。
+		writeUpstreamError(w, err)
 		return
 	}
 
 	httppkg.SetSSEHeaders(w)
-	writer := NewStreamWriter(w, id.ChatCompletionID(), time.Now().Unix(), req.Model, requestID)
+	w, flushDone := httppkg.BatchSSEFlushes(w)
+	defer flushDone()
+	writer := NewStreamWriter(w, id.ChatCompletionID(), time.Now().Unix(), servedModel, requestID)
+	writer.clineCompat = req.ClineCompat
+	writer.tenant = req.Tenant
+	writer.echoModel = gwcommon.ResponseModel(req.Model, servedModel)
+	writer.warning = modalitiesWarning(req)
+	prefill := gwcommon.NewPrefillJoiner(vreq)
 
-	streamResult, _ := vertex.ParseStreamWithResult(resp, func(data *vertex.StreamData) error {
+	guard := gwcommon.NewThinkingGuard()
+	defer guard.Stop()
+	guard.Arm(resp.Body)
+	limit := gwcommon.NewOutputLimit()
+	receiver := func(data *vertex.StreamData) error {
+		if err := guard.ObserveStreamData(data); err != nil {
+			return err
+		}
+		if err := limit.ObserveStreamData(data); err != nil {
+			return err
+		}
+		scrubber.RestoreStreamData(data)
+		prefill.JoinStreamData(data)
 		if len(data.Response.Candidates) == 0 {
 			return nil
 		}
@@ -211,7 +437,42 @@ func handleStreamWithRetry(w http.ResponseWriter, ctx context.Context, req *Chat
 			_ = writer.FlushToolCalls()
 		}
 		return nil
-	})
+	}
+	streamResult, streamErr := vertex.ParseStreamWithResult(resp, receiver)
+
+	// 上游流在输出任何内容之前中断（连接被重置、gzip 截断等）时，换一个账号透明地重试一次。
+	if gwcommon.ShouldRetryStream(ctx, streamErr, writer.HasOutput(), guard) {
+		logger.Warn("上游流在输出内容前中断（%v），重试一次", streamErr)
+		if resp, err = openStream(); err == nil {
+			guard.Arm(resp.Body)
+			streamResult, streamErr = vertex.ParseStreamWithResult(resp, receiver)
+		}
+	}
+
+	// 客户端尚未收到任何内容时，MALFORMED_FUNCTION_CALL 可以透明地用 mode=ANY 重试一次。
+	if streamResult.FinishReason == gwcommon.FinishReasonMalformedFunctionCall && !writer.HasOutput() && gwcommon.ForceAnyToolMode(vreq) {
+		logger.Warn("上游返回 MALFORMED_FUNCTION_CALL，使用 toolConfig.mode=ANY 重试一次")
+		if resp, err = openStream(); err == nil {
+			guard.Arm(resp.Body)
+			streamResult, streamErr = vertex.ParseStreamWithResult(resp, receiver)
+		}
+	}
+	if errors.Is(streamErr, gwcommon.ErrOutputLimit) {
+		// 输出超过 MAX_STREAM_OUTPUT_BYTES / MAX_STREAM_OUTPUT_TOKENS：已截断，按输出长度上限正常结束。
+		streamErr = nil
+	}
+	defer memory.AfterLargeRequest(streamResult.Bytes)
+	outputEstimate := gwcommon.EstimateStreamOutput(streamResult)
+	gwcommon.RecordStreamUsage(ctx, "openai", servedModel, vreq, streamResult.Usage, outputEstimate)
+
+	if text, thought := scrubber.FlushStream(); text != "" || thought != "" {
+		if thought != "" {
+			_ = writer.ProcessPart(StreamDataPart{Text: thought, Thought: true})
+		}
+		if text = prefill.Text(text); text != "" {
+			_ = writer.ProcessPart(StreamDataPart{Text: text})
+		}
+	}
 
 	duration := time.Since(startTime)
 	if logger.IsBackendLogEnabled() {
@@ -220,10 +481,58 @@ func handleStreamWithRetry(w http.ResponseWriter, ctx context.Context, req *Chat
 	if logger.IsClientLogEnabled() {
 		logger.ClientStreamResponse(http.StatusOK, duration, writer.GetMergedResponse())
 	}
+	result := transcript.Result{Status: http.StatusOK, Model: servedModel, VertexRequest: vreq, VertexResponse: streamResult.MergedResponse}
+	if rec != nil {
+		result.ClientResponse = writer.GetMergedResponse()
+	}
+
+	if err != nil {
+		result.Error = err.Error()
+		rec.Finish(result)
+		writeSSEUpstreamError(w, err)
+		return
+	}
+	if limitErr := guard.Err(); limitErr != nil {
+		result.Error = limitErr.Error()
+		rec.Finish(result)
+		writeSSEErrorWithCode(w, result.Error, "server_error", "thinking_limit_exceeded")
+		return
+	}
+	if streamErr != nil {
+		logger.Error("Stream scan error: %v", streamErr)
+		result.Error = gwcommon.StreamInterruptedMessage(streamErr)
+		rec.Finish(result)
+		writeSSEErrorWithCode(w, result.Error, upstreamErrorType(streamErr), "stream_interrupted")
+		return
+	}
+	if streamResult.FinishReason == gwcommon.FinishReasonMalformedFunctionCall && !writer.HasOutput() {
+		result.Error = gwcommon.MalformedFunctionCallMessage
+		rec.Finish(result)
+		WriteSSEError(w, gwcommon.MalformedFunctionCallMessage)
+		return
+	}
+	if streamResult.PromptFeedback != nil && !writer.HasOutput() {
+		result.Error = gwcommon.ContentFilterMessage(streamResult.PromptFeedback)
+		rec.Finish(result)
+		writeSSEErrorWithCode(w, result.Error, "invalid_request_error", "content_filter")
+		return
+	}
+	rec.Finish(result)
 
 	finish := "stop"
-	if streamResult.FinishReason != "" {
+	if req.ClineCompat {
+		finish = openAIFinishReason(streamResult.FinishReason, len(streamResult.ToolCalls) > 0)
+	} else if streamResult.FinishReason != "" {
 		finish = streamResult.FinishReason
 	}
-	writer.WriteFinish(finish, ConvertUsage(streamResult.Usage))
+	if limit.Exceeded() {
+		finish = "length"
+	}
+	// 上游没有返回（或只返回了部分）usageMetadata 时按请求与合并后的输出估算，usage chunk 不会为 0。
+	finalUsage, _ := gwcommon.FillUsage(vreq, streamResult.Usage, outputEstimate)
+	if gwcommon.WantDebugInfo(hookInfo.Header) {
+		writer.debug = upstream.DebugInfo(servedModel, resp)
+	}
+	writer.WriteFinish(finish, ConvertUsage(finalUsage))
+	hooks.AfterResponse(ctx, hookInfo, streamResult)
 }
@@ -0,0 +1,91 @@
+package openai
+
+import (
+	"testing"
+
+	"anti2api-golang/refactor/internal/config"
+	"anti2api-golang/refactor/internal/vertex"
+)
+
+func TestModerationInputs(t *testing.T) {
+	got, err := moderationInputs([]any{"a", "b"})
+	if err != nil || len(got) != 2 || got[1][0].Text != "b" {
+		t.Fatalf("string array should yield one input per string, got %+v err=%v", got, err)
+	}
+
+	got, err = moderationInputs([]any{
+		map[string]any{"type": "text", "text": "caption"},
+		map[string]any{"type": "image_url", "image_url": map[string]any{"url": "data:image/png;base64,AAAA"}},
+	})
+	if err != nil || len(got) != 1 || len(got[0]) != 2 || got[0][1].InlineData == nil {
+		t.Fatalf("multimodal array should yield a single input with text and image, got %+v err=%v", got, err)
+	}
+
+	for _, bad := range []any{nil, []any{}, []any{"a", 1}, []any{map[string]any{"type": "image_url", "image_url": map[string]any{"url": "https://example.com/a.png"}}}} {
+		if _, err := moderationInputs(bad); err == nil {
+			t.Fatalf("expected error for input %#v", bad)
+		}
+	}
+}
+
+func TestModerationScores_MergesModelOutputAndSafetyRatings(t *testing.T) {
+	var resp vertex.Response
+	resp.Response.Candidates = []vertex.Candidate{{
+		Content: vertex.Content{Parts: []vertex.Part{
+			{Text: "weighing categories", Thought: true},
+			{Text: "```json\n{\"harassment\": 0.7, \"violence\": 0.1, \"unknown\": 1}\n```"},
+		}},
+		SafetyRatings: []vertex.SafetyRating{{Category: "HARM_CATEGORY_DANGEROUS_CONTENT", Probability: "MEDIUM"}},
+	}}
+
+	scores, blocked, err := moderationScores(&resp)
+	if err != nil || blocked {
+		t.Fatalf("unexpected result: blocked=%v err=%v", blocked, err)
+	}
+	if scores["harassment"] != 0.7 || scores["violence"] != 0.6 || scores["illicit"] != 0.6 {
+		t.Fatalf("unexpected scores: %v", scores)
+	}
+
+	res := moderationResult(scores, blocked, []vertex.Part{{Text: "x"}})
+	if !res.Flagged || !res.Categories["harassment"] || res.Categories["hate"] || len(res.CategoryScores) != len(moderationCategories) {
+		t.Fatalf("unexpected result: %+v", res)
+	}
+	if types := res.CategoryAppliedInputTypes["sexual"]; len(types) != 1 || types[0] != "text" {
+		t.Fatalf("unexpected applied input types: %v", types)
+	}
+}
+
+func TestModerationScores_BlockedPrompt(t *testing.T) {
+	var resp vertex.Response
+	resp.Response.PromptFeedback = &vertex.PromptFeedback{BlockReason: "PROHIBITED_CONTENT"}
+
+	scores, blocked, err := moderationScores(&resp)
+	if err != nil || !blocked {
+		t.Fatalf("blocked prompt should be reported: blocked=%v err=%v", blocked, err)
+	}
+	if res := moderationResult(scores, blocked, []vertex.Part{{Text: "x"}}); !res.Flagged {
+		t.Fatalf("blocked prompt should be flagged: %+v", res)
+	}
+
+	if _, _, err := moderationScores(&vertex.Response{}); err == nil {
+		t.Fatalf("expected error when neither scores nor ratings are available")
+	}
+}
+
+func TestModerationModel(t *testing.T) {
+	cfg := config.Get()
+	old := cfg.ModerationModel
+	t.Cleanup(func() { cfg.ModerationModel = old })
+	cfg.ModerationModel = "gemini-2.5-flash"
+
+	for _, m := range []string{"", "omni-moderation-latest", "text-moderation-stable", "gpt-4o", "unknown"} {
+		if got := moderationModel(m); got != "gemini-2.5-flash" {
+			t.Fatalf("%q should fall back to MODERATION_MODEL, got %q", m, got)
+		}
+	}
+	for _, m := range []string{"gemini-2.5-pro", "models/gemini-2.5-flash-lite", "claude-sonnet-4-5"} {
+		if got := moderationModel(m); got != m {
+			t.Fatalf("%q should be used as is, got %q", m, got)
+		}
+	}
+}
@@ -0,0 +1,83 @@
+package openai
+
+import (
+	"strings"
+
+	"anti2api-golang/refactor/internal/pkg/modelutil"
+)
+
+// reasoning_details 的 type：thinking 文本的签名为 reasoning.text，附在工具调用上的签名（Gemini）为 reasoning.encrypted。
+const (
+	reasoningDetailText      = "reasoning.text"
+	reasoningDetailEncrypted = "reasoning.encrypted"
+)
+
+// ReasoningDetail 为扩展字段 reasoning_details 的一项（格式与 OpenRouter 兼容），携带上游的 thoughtSignature。
+// 能持久化该字段的客户端在下一轮的 assistant 消息中原样带回，转换时优先使用，不再依赖服务端签名缓存。
+type ReasoningDetail struct {
+	Type      string `json:"type"`
+	Text      string `json:"text,omitempty"`
+	Signature string `json:"signature,omitempty"`
+	// ID 为签名所属的 tool call id；为空表示签名属于 thinking 文本。
+	ID     string `json:"id,omitempty"`
+	Format string `json:"format,omitempty"`
+	Index  int    `json:"index"`
+}
+
+func reasoningDetailFormat(model string) string {
+	if modelutil.IsClaude(model) {
+		return "anthropic-claude-v1"
+	}
+	return "google-gemini-v1"
+}
+
+// detailSignatures 为 assistant 消息 reasoning_details 中带回的签名。
+type detailSignatures struct {
+	// thinking 为 thinking 文本的签名，text 为随签名带回的 thinking 文本（可能为空）。
+	thinking, text string
+	byToolCall     map[string]string
+}
+
+func signaturesFromDetails(details []ReasoningDetail) detailSignatures {
+	var ds detailSignatures
+	for _, d := range details {
+		sig := strings.TrimSpace(d.Signature)
+		switch {
+		case d.ID != "" && sig != "":
+			if ds.byToolCall == nil {
+				ds.byToolCall = make(map[string]string)
+			}
+			ds.byToolCall[d.ID] = sig
+		case d.Type == reasoningDetailText:
+			ds.text += d.Text
+			if sig != "" {
+				ds.thinking = sig
+			}
+		}
+	}
+	return ds
+}
+
+// forToolCall 返回 tool call 的签名，ids 依次为客户端提供的 ID 与归一化后的 ID。
+func (ds detailSignatures) forToolCall(ids ...string) string {
+	for _, id := range ids {
+		if sig := ds.byToolCall[id]; sig != "" {
+			return sig
+		}
+	}
+	return ""
+}
+
+// reasoningDetails 组装非流式响应的 reasoning_details：thinking 签名（连同 thinking 文本）在前，工具调用的签名在后。
+func reasoningDetails(model, reasoning, thinkingSig string, calls []ReasoningDetail) []ReasoningDetail {
+	var out []ReasoningDetail
+	if thinkingSig != "" {
+		out = append(out, ReasoningDetail{Type: reasoningDetailText, Text: reasoning, Signature: thinkingSig})
+	}
+	out = append(out, calls...)
+	format := reasoningDetailFormat(model)
+	for i := range out {
+		out[i].Format, out[i].Index = format, i
+	}
+	return out
+}
@@ -13,6 +13,28 @@ type ChatRequest struct {
 	// ToolChoice 为 OpenAI 兼容字段：当前未实现 tool_choice 语义（保持历史行为）。
 	ToolChoice      any    `json:"tool_choice,omitempty"`
 	ReasoningEffort string `json:"reasoning_effort,omitempty"`
+	// Prediction 为 OpenAI Predicted Outputs 字段：默认接受但忽略，OPENAI_PREDICTION_HINT=true 时作为参考内容写入系统指令。
+	Prediction *Prediction `json:"prediction,omitempty"`
+	// Modalities / Audio 为 OpenAI 音频输出字段：后端只能输出文本，不支持的模态被忽略（不转发给上游），
+	// 并在响应的 warning 字段中说明（见 modalitiesWarning）。
+	Modalities []string `json:"modalities,omitempty"`
+	Audio      any      `json:"audio,omitempty"`
+	// MediaResolution 为扩展字段：按请求覆盖 Gemini 3 的 mediaResolution（low / medium / high），
+	// 未设置时取 X-Media-Resolution 请求头（见 gwcommon.ResolveMediaResolution）。
+	MediaResolution *string `json:"media_resolution,omitempty"`
+
+	// ClineCompat 表示对该请求启用 Cline / Roo-Code 兼容模式（见 isClineCompat），不参与 JSON 编解码。
+	ClineCompat bool `json:"-"`
+	// NoSystemInjection 表示跳过 agent 系统提示词注入（见 gwcommon.SkipSystemInjection），不参与 JSON 编解码。
+	NoSystemInjection bool `json:"-"`
+	// Tenant 为请求所属的租户（见 middleware.TenantFromContext），签名按租户隔离保存，不参与 JSON 编解码。
+	Tenant string `json:"-"`
+}
+
+// Prediction 为 {type:"content", content: string | [{type:"text", text}]}。
+type Prediction struct {
+	Type    string `json:"type"`
+	Content any    `json:"content"`
 }
 
 type Message struct {
@@ -25,6 +47,8 @@ type Message struct {
 	Reasoning string `json:"reasoning,omitempty"`
 	// Non-standard but widely used alias; helps preserve Claude extended thinking blocks across turns.
 	ReasoningContent string `json:"reasoning_content,omitempty"`
+	// ReasoningDetails 为扩展字段：响应中携带 thoughtSignature，请求中客户端原样带回时优先于服务端签名缓存（见 ReasoningDetail）。
+	ReasoningDetails []ReasoningDetail `json:"reasoning_details,omitempty"`
 }
 
 type ContentPart struct {
@@ -47,6 +71,8 @@ type Function struct {
 	Name        string         `json:"name"`
 	Description string         `json:"description"`
 	Parameters  map[string]any `json:"parameters,omitempty"`
+	// Strict 为 OpenAI strict 函数调用标记：上游不支持该字段，仅记录在声明中，并在 schema 约束无法保留时告警。
+	Strict *bool `json:"strict,omitempty"`
 }
 
 type ToolCall struct {
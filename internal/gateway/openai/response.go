@@ -1,11 +1,15 @@
 package openai
 
 import (
-	"fmt"
+	"cmp"
+	"crypto/sha256"
+	"encoding/hex"
 	"strings"
 	"time"
 
+	gwcommon "anti2api-golang/refactor/internal/gateway/common"
 	"anti2api-golang/refactor/internal/pkg/id"
+	"anti2api-golang/refactor/internal/pkg/jsonrepair"
 	"anti2api-golang/refactor/internal/pkg/modelutil"
 	"anti2api-golang/refactor/internal/signature"
 	"anti2api-golang/refactor/internal/vertex"
@@ -18,6 +22,10 @@ type ChatCompletion struct {
 	Model   string   `json:"model"`
 	Choices []Choice `json:"choices"`
 	Usage   *Usage   `json:"usage,omitempty"`
+	// Warning 为扩展字段（非 OpenAI 官方字段）：说明请求中被忽略的参数，例如不支持的 audio 输出模态。
+	Warning string `json:"warning,omitempty"`
+	// Debug 为扩展字段：请求头带 X-Ant2api-Debug 时随流式响应的结束 chunk 输出（见 gwcommon.DebugInfo）。
+	Debug *gwcommon.DebugInfo `json:"x_ant2api,omitempty"`
 }
 
 type Choice struct {
@@ -32,6 +40,10 @@ type Delta struct {
 	Content   string     `json:"content,omitempty"`
 	ToolCalls []ToolCall `json:"tool_calls,omitempty"`
 	Reasoning string     `json:"reasoning,omitempty"`
+	// ReasoningContent 仅在 Cline / Roo-Code 兼容模式下使用（替代 Reasoning）。
+	ReasoningContent string `json:"reasoning_content,omitempty"`
+	// ReasoningDetails 为扩展字段：上游返回的签名（见 ReasoningDetail）。
+	ReasoningDetails []ReasoningDetail `json:"reasoning_details,omitempty"`
 }
 
 type Usage struct {
@@ -48,7 +60,15 @@ type ModelsResponse struct {
 type ModelItem struct {
 	ID      string `json:"id"`
 	Object  string `json:"object"`
+	Created int64  `json:"created"`
 	OwnedBy string `json:"owned_by"`
+
+	// 以下为扩展字段（非 OpenAI 官方字段），供按模型元数据自动配置的客户端使用。
+	ContextLength    int      `json:"context_length,omitempty"`
+	MaxOutputTokens  int      `json:"max_output_tokens,omitempty"`
+	InputModalities  []string `json:"input_modalities,omitempty"`
+	OutputModalities []string `json:"output_modalities,omitempty"`
+	SupportsThinking bool     `json:"supports_thinking"`
 }
 
 func ConvertUsage(metadata *vertex.UsageMetadata) *Usage {
@@ -62,7 +82,7 @@ func ConvertUsage(metadata *vertex.UsageMetadata) *Usage {
 	}
 }
 
-func ToChatCompletion(resp *vertex.Response, model string, requestID string) *ChatCompletion {
+func ToChatCompletion(resp *vertex.Response, model string, requestID string, tenant string) *ChatCompletion {
 	out := &ChatCompletion{
 		ID:      id.ChatCompletionID(),
 		Object:  "chat.completion",
@@ -77,14 +97,19 @@ func ToChatCompletion(resp *vertex.Response, model string, requestID string) *Ch
 	}
 	parts := resp.Response.Candidates[0].Content.Parts
 
-	var content string
+	// 图片响应的 base64 可能有数 MB：预先按总长度分配，避免 content += 反复复制。
+	var content strings.Builder
+	content.Grow(estimateContentSize(parts))
 	var reasoning string
 	var toolCalls []ToolCall
 
-	sigMgr := signature.GetManager()
+	sigMgr := signature.GetManagerFor(tenant)
 	isClaudeThinking := modelutil.IsClaudeThinking(model)
 	pendingSig := ""
 	var pendingReasoning strings.Builder
+	// thinkingSig / callDetails 为随响应下发给客户端的签名（见 ReasoningDetail）。
+	thinkingSig := ""
+	var callDetails []ReasoningDetail
 
 	for _, p := range parts {
 		if p.Thought {
@@ -93,11 +118,12 @@ func ToChatCompletion(resp *vertex.Response, model string, requestID string) *Ch
 			if isClaudeThinking && p.ThoughtSignature != "" {
 				// Claude thinking: bind this signature to the first subsequent tool call id.
 				pendingSig = p.ThoughtSignature
+				thinkingSig = p.ThoughtSignature
 			}
 			continue
 		}
 		if p.Text != "" {
-			content += p.Text
+			content.WriteString(p.Text)
 			continue
 		}
 		if p.InlineData != nil {
@@ -109,8 +135,7 @@ func ToChatCompletion(resp *vertex.Response, model string, requestID string) *Ch
 				sigMgr.Save(requestID, imageKey, p.ThoughtSignature, pendingReasoning.String(), model)
 				pendingReasoning.Reset()
 			}
-			imageMarkdown := fmt.Sprintf("![image](data:%s;base64,%s)", p.InlineData.MimeType, p.InlineData.Data)
-			content += imageMarkdown
+			writeImageMarkdown(&content, p.InlineData)
 			continue
 		}
 		if p.FunctionCall != nil {
@@ -118,27 +143,25 @@ func ToChatCompletion(resp *vertex.Response, model string, requestID string) *Ch
 			if tcID == "" {
 				tcID = id.ToolCallID()
 			}
+			callKey := signature.CallKey(p.FunctionCall.Name, p.FunctionCall.Args)
 
 			if isClaudeThinking {
 				if pendingSig != "" {
-					sigMgr.Save(requestID, tcID, pendingSig, pendingReasoning.String(), model)
+					sigMgr.SaveToolCall(requestID, tcID, callKey, pendingSig, pendingReasoning.String(), model)
 					pendingSig = ""
 					pendingReasoning.Reset()
 				} else if p.ThoughtSignature != "" {
-					sigMgr.Save(requestID, tcID, p.ThoughtSignature, pendingReasoning.String(), model)
+					sigMgr.SaveToolCall(requestID, tcID, callKey, p.ThoughtSignature, pendingReasoning.String(), model)
 					pendingReasoning.Reset()
+					thinkingSig = cmp.Or(thinkingSig, p.ThoughtSignature)
 				}
 			} else if p.ThoughtSignature != "" {
-				sigMgr.Save(requestID, tcID, p.ThoughtSignature, pendingReasoning.String(), model)
+				sigMgr.SaveToolCall(requestID, tcID, callKey, p.ThoughtSignature, pendingReasoning.String(), model)
 				pendingReasoning.Reset()
+				callDetails = append(callDetails, ReasoningDetail{Type: reasoningDetailEncrypted, Signature: p.ThoughtSignature, ID: tcID})
 			}
 
-			args := "{}"
-			if p.FunctionCall.Args != nil {
-				if s, err := jsonString(p.FunctionCall.Args); err == nil {
-					args = s
-				}
-			}
+			args := jsonrepair.ToolArguments(p.FunctionCall.Args)
 
 			toolCalls = append(toolCalls, ToolCall{
 				ID:   tcID,
@@ -151,16 +174,71 @@ func ToChatCompletion(resp *vertex.Response, model string, requestID string) *Ch
 		}
 	}
 
+	if isClaudeThinking && pendingSig != "" && len(toolCalls) == 0 {
+		// 纯文本轮次没有 tool call id 可绑定，按回复文本的哈希缓存签名，供下一轮请求重建 thinking 块。
+		if key := textTurnKey(content.String()); key != "" {
+			sigMgr.Save(requestID, key, pendingSig, pendingReasoning.String(), model)
+		}
+	}
+
 	finish := "stop"
 	if len(toolCalls) > 0 {
 		finish = "tool_calls"
 	}
 	out.Choices[0].FinishReason = &finish
-	out.Choices[0].Message.Content = content
+	out.Choices[0].Message.Content = content.String()
 	out.Choices[0].Message.Reasoning = reasoning
 	out.Choices[0].Message.ToolCalls = toolCalls
+	out.Choices[0].Message.ReasoningDetails = reasoningDetails(model, reasoning, thinkingSig, callDetails)
 
 	return out
 }
 
 func ptr[T any](v T) *T { return &v }
+
+const imageMarkdownPrefix, imageMarkdownBase64, imageMarkdownSuffix = "![image](data:", ";base64,", ")"
+
+// writeImageMarkdown 将图片以 Markdown data URL 直接写入 b，不产生中间字符串。
+func writeImageMarkdown(b *strings.Builder, d *vertex.InlineData) {
+	b.WriteString(imageMarkdownPrefix)
+	b.WriteString(d.MimeType)
+	b.WriteString(imageMarkdownBase64)
+	b.WriteString(d.Data)
+	b.WriteString(imageMarkdownSuffix)
+}
+
+func imageMarkdownLen(d *vertex.InlineData) int {
+	return len(imageMarkdownPrefix) + len(d.MimeType) + len(imageMarkdownBase64) + len(d.Data) + len(imageMarkdownSuffix)
+}
+
+// imageMarkdown 返回图片的 Markdown data URL（一次分配）。
+func imageMarkdown(d *vertex.InlineData) string {
+	var b strings.Builder
+	b.Grow(imageMarkdownLen(d))
+	writeImageMarkdown(&b, d)
+	return b.String()
+}
+
+func estimateContentSize(parts []vertex.Part) int {
+	n := 0
+	for _, p := range parts {
+		switch {
+		case p.Thought:
+		case p.Text != "":
+			n += len(p.Text)
+		case p.InlineData != nil:
+			n += imageMarkdownLen(p.InlineData)
+		}
+	}
+	return n
+}
+
+// textTurnKey 返回纯文本 assistant 轮次的签名缓存键（与 tool call id 共用同一索引），内容为空时返回空串。
+func textTurnKey(content string) string {
+	content = strings.TrimSpace(content)
+	if content == "" {
+		return ""
+	}
+	sum := sha256.Sum256([]byte(content))
+	return "text_" + hex.EncodeToString(sum[:16])
+}
@@ -0,0 +1,91 @@
+package openai
+
+import (
+	"regexp"
+	"strings"
+
+	"anti2api-golang/refactor/internal/signature"
+	"anti2api-golang/refactor/internal/vertex"
+)
+
+// markdownImageRe 匹配 ToChatCompletion / StreamWriter 输出的 Markdown data URL 图片（见 writeImageMarkdown）。
+// mimeType 与 base64 部分只接受合法字符，避免与相邻的普通文本（例如紧跟的右括号）粘连。
+var markdownImageRe = regexp.MustCompile(`!\[image\]\(data:([\w.+-]+/[\w.+-]+);base64,([A-Za-z0-9+/=]+)\)`)
+
+// imagePart 构建图片 part，并带上该图片在上一轮响应中缓存的 thoughtSignature（以 base64 前 20 个字符为键）。
+func imagePart(sigs *signature.Manager, d *vertex.InlineData) vertex.Part {
+	imageKey := d.Data
+	if len(imageKey) > 20 {
+		imageKey = imageKey[:20]
+	}
+	sig := ""
+	if e, ok := sigs.LookupByToolCallID(imageKey); ok {
+		sig = e.Signature
+	}
+	return vertex.Part{InlineData: d, ThoughtSignature: sig}
+}
+
+// segmentAssistantContent 将 assistant 历史消息的 content 按原始顺序拆分为 Vertex parts：
+//   - 字符串中的 Markdown data URL 图片还原为 inlineData，图片之间的文本保持原位；
+//   - 数组中的 text 项同样按 Markdown 图片拆分，相邻的 text 项以 "\n" 连接（与 ExtractTextFromContent 一致）；
+//   - 数组中的 image_url 项还原为 inlineData，位置与其在数组中的位置一致。
+//
+// 思考内容与工具调用在 OpenAI 格式中是独立字段，由调用方分别放在这些 parts 之前与之后。
+func segmentAssistantContent(sigs *signature.Manager, content any) []vertex.Part {
+	switch v := content.(type) {
+	case string:
+		return segmentMarkdownImages(sigs, nil, v)
+	case []any:
+		var parts []vertex.Part
+		var text strings.Builder
+		hasText := false
+		flush := func() {
+			if hasText {
+				parts = segmentMarkdownImages(sigs, parts, text.String())
+				text.Reset()
+				hasText = false
+			}
+		}
+		for _, it := range v {
+			m, ok := it.(map[string]any)
+			if !ok {
+				continue
+			}
+			switch m["type"] {
+			case "text":
+				t, _ := m["text"].(string)
+				if hasText {
+					text.WriteString("\n")
+				}
+				text.WriteString(t)
+				hasText = true
+			case "image_url":
+				img, _ := m["image_url"].(map[string]any)
+				urlStr, _ := img["url"].(string)
+				if inline := parseImageURL(urlStr); inline != nil {
+					flush()
+					parts = append(parts, imagePart(sigs, inline))
+				}
+			}
+		}
+		flush()
+		return parts
+	}
+	return nil
+}
+
+// segmentMarkdownImages 将 t 按 Markdown 图片拆分后追加到 parts，空文本段不生成 part。
+func segmentMarkdownImages(sigs *signature.Manager, parts []vertex.Part, t string) []vertex.Part {
+	last := 0
+	for _, m := range markdownImageRe.FindAllStringSubmatchIndex(t, -1) {
+		if m[0] > last {
+			parts = append(parts, vertex.Part{Text: t[last:m[0]]})
+		}
+		parts = append(parts, imagePart(sigs, &vertex.InlineData{MimeType: t[m[2]:m[3]], Data: t[m[4]:m[5]]}))
+		last = m[1]
+	}
+	if last < len(t) {
+		parts = append(parts, vertex.Part{Text: t[last:]})
+	}
+	return parts
+}
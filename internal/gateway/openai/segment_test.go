@@ -0,0 +1,137 @@
+package openai
+
+import (
+	"fmt"
+	"math/rand"
+	"strings"
+	"testing"
+
+	"anti2api-golang/refactor/internal/signature"
+	"anti2api-golang/refactor/internal/vertex"
+)
+
+// segmentTextAlphabet 覆盖多字节字符以及容易与 Markdown 图片语法粘连的字符（不含 ':'，因此不会意外拼出图片语法）。
+var segmentTextAlphabet = []rune("ab 中文\n()[]!;,=+/é🌍")
+
+func randomSegmentText(r *rand.Rand) string {
+	n := 1 + r.Intn(12)
+	var b strings.Builder
+	for i := 0; i < n; i++ {
+		b.WriteRune(segmentTextAlphabet[r.Intn(len(segmentTextAlphabet))])
+	}
+	return b.String()
+}
+
+func randomImage(r *rand.Rand, i int) *vertex.InlineData {
+	mimes := []string{"image/png", "image/jpeg", "image/webp", "image/svg+xml"}
+	return &vertex.InlineData{
+		MimeType: mimes[r.Intn(len(mimes))],
+		// 前缀保证不同图片的签名缓存键互不相同。
+		Data: fmt.Sprintf("c2VnbWVudA%04d", i) + strings.Repeat("QUJD+/=", 1+r.Intn(4)),
+	}
+}
+
+// partShape 为比较用的 part 摘要；相邻文本合并后比较，因为 OpenAI 的 content 字符串不保留文本分段。
+func partShapes(parts []vertex.Part) []string {
+	var out []string
+	for _, p := range parts {
+		var s string
+		switch {
+		case p.Thought:
+			s = "thought:" + p.Text
+		case p.FunctionCall != nil:
+			s = "call:" + p.FunctionCall.Name
+		case p.InlineData != nil:
+			s = "image:" + p.InlineData.MimeType + ":" + p.InlineData.Data
+		case p.Text != "":
+			if n := len(out); n > 0 && strings.HasPrefix(out[n-1], "text:") {
+				out[n-1] += p.Text
+				continue
+			}
+			s = "text:" + p.Text
+		default:
+			continue
+		}
+		out = append(out, s)
+	}
+	return out
+}
+
+func TestSegmentAssistantContent_RoundTripPreservesOrder(t *testing.T) {
+	r := rand.New(rand.NewSource(1701))
+	for iter := 0; iter < 500; iter++ {
+		var parts []vertex.Part
+		if r.Intn(2) == 0 {
+			parts = append(parts, vertex.Part{Text: "think " + fmt.Sprint(iter), Thought: true})
+		}
+		for i, n := 0, r.Intn(7); i < n; i++ {
+			if r.Intn(2) == 0 {
+				parts = append(parts, vertex.Part{Text: randomSegmentText(r)})
+			} else {
+				parts = append(parts, vertex.Part{InlineData: randomImage(r, iter*10+i)})
+			}
+		}
+		for i, n := 0, r.Intn(3); i < n; i++ {
+			parts = append(parts, vertex.Part{FunctionCall: &vertex.FunctionCall{ID: fmt.Sprintf("call_%d_%d", iter, i), Name: fmt.Sprintf("tool_%d", i), Args: map[string]any{}}})
+		}
+
+		resp := &vertex.Response{}
+		resp.Response.Candidates = []vertex.Candidate{{Content: vertex.Content{Role: "model", Parts: parts}}}
+		completion := ToChatCompletion(resp, "gemini-2.5-flash", "req", "")
+		msg := completion.Choices[0].Message
+		msg.Role = "assistant"
+
+		contents := toVertexContents(&ChatRequest{Model: "gemini-2.5-flash", Messages: []Message{msg}}, "req")
+		var got []vertex.Part
+		if len(contents) > 0 {
+			got = contents[0].Parts
+		}
+		want, have := partShapes(parts), partShapes(got)
+		if strings.Join(want, "\x00") != strings.Join(have, "\x00") {
+			t.Fatalf("iter %d: order mismatch\nwant %q\ngot  %q", iter, want, have)
+		}
+	}
+}
+
+func TestSegmentAssistantContent_ArrayContentKeepsImagePositions(t *testing.T) {
+	r := rand.New(rand.NewSource(17011))
+	for iter := 0; iter < 300; iter++ {
+		var items []any
+		var want []vertex.Part
+		prevText := false
+		for i, n := 0, 1+r.Intn(6); i < n; i++ {
+			if r.Intn(2) == 0 {
+				txt := randomSegmentText(r)
+				items = append(items, map[string]any{"type": "text", "text": txt})
+				if prevText {
+					txt = "\n" + txt
+				}
+				want = append(want, vertex.Part{Text: txt})
+				prevText = true
+				continue
+			}
+			img := randomImage(r, iter*10+i)
+			items = append(items, map[string]any{"type": "image_url", "image_url": map[string]any{"url": "data:" + img.MimeType + ";base64," + img.Data}})
+			want = append(want, vertex.Part{InlineData: img})
+			prevText = false
+		}
+
+		got := segmentAssistantContent(signature.GetManager(), items)
+		if a, b := strings.Join(partShapes(want), "\x00"), strings.Join(partShapes(got), "\x00"); a != b {
+			t.Fatalf("iter %d: order mismatch\nwant %q\ngot  %q", iter, partShapes(want), partShapes(got))
+		}
+	}
+}
+
+func TestSegmentAssistantContent_MarkdownInsideArrayText(t *testing.T) {
+	items := []any{
+		map[string]any{"type": "text", "text": "before ![image](data:image/png;base64,QUJD) mid"},
+		map[string]any{"type": "image_url", "image_url": map[string]any{"url": "data:image/jpeg;base64,REVG"}},
+		map[string]any{"type": "text", "text": "after)"},
+	}
+	got := partShapes(segmentAssistantContent(signature.GetManager(), items))
+	want := []string{"text:before ", "image:image/png:QUJD", "text: mid", "image:image/jpeg:REVG", "text:after)"}
+	if strings.Join(got, "|") != strings.Join(want, "|") {
+		t.Fatalf("got %q, want %q", got, want)
+	}
+}
@@ -1,16 +1,19 @@
 package openai
 
 import (
+	"cmp"
 	"fmt"
 	"net/http"
 	"strings"
 	"sync"
 	"unicode/utf8"
 
+	gwcommon "anti2api-golang/refactor/internal/gateway/common"
 	"anti2api-golang/refactor/internal/logger"
 	httppkg "anti2api-golang/refactor/internal/pkg/http"
 	"anti2api-golang/refactor/internal/pkg/id"
 	jsonpkg "anti2api-golang/refactor/internal/pkg/json"
+	"anti2api-golang/refactor/internal/pkg/jsonrepair"
 	"anti2api-golang/refactor/internal/pkg/modelutil"
 	"anti2api-golang/refactor/internal/signature"
 	"anti2api-golang/refactor/internal/vertex"
@@ -34,10 +37,24 @@ type StreamWriter struct {
 	contentBuf       []byte
 	reasoningBuf     []byte
 	pendingReasoning strings.Builder
+	content          strings.Builder
 	toolCalls        []ToolCall
 	collectedEvents  []map[string]any
 	pendingSig       string
-	mu               sync.Mutex
+	// detailCount 为已输出的 reasoning_details 项数。
+	detailCount int
+	// clineCompat 启用 Cline / Roo-Code 兼容的 chunk 格式；roleInNext 表示 role 尚未随 delta 发送。
+	clineCompat bool
+	roleInNext  bool
+	// warning 随第一个 chunk 输出（见 modalitiesWarning），输出后清空。
+	warning string
+	// tenant 为请求所属的租户，签名保存到该租户的存储中。
+	tenant string
+	// echoModel 为 chunk 中回显的模型名（见 gwcommon.ResponseModel），为空时使用 model。
+	echoModel string
+	// debug 非空时随结束 chunk 输出（见 gwcommon.DebugInfoHeader）。
+	debug *gwcommon.DebugInfo
+	mu    sync.Mutex
 }
 
 func NewStreamWriter(w http.ResponseWriter, id string, created int64, model string, requestID string) *StreamWriter {
@@ -46,7 +63,50 @@ func NewStreamWriter(w http.ResponseWriter, id string, created int64, model stri
 }
 
 func WriteSSEError(w http.ResponseWriter, msg string) {
-	_ = writeSSEData(w, map[string]any{"error": map[string]any{"message": msg, "type": "server_error"}})
+	writeSSEErrorWithType(w, msg, "server_error")
+}
+
+// errorTypeForStatus 将上游状态码映射为 OpenAI 的 error.type。
+func errorTypeForStatus(status int) string {
+	switch status {
+	case http.StatusUnauthorized, http.StatusForbidden:
+		return "authentication_error"
+	case http.StatusTooManyRequests:
+		return "rate_limit_error"
+	case http.StatusBadRequest, http.StatusNotFound, http.StatusRequestEntityTooLarge, http.StatusUnprocessableEntity:
+		return "invalid_request_error"
+	case http.StatusGatewayTimeout:
+		return "timeout"
+	}
+	return "server_error"
+}
+
+// upstreamErrorType 返回生成请求失败时的 error.type：上游超时为 timeout，其他保持 server_error。
+func upstreamErrorType(err error) string {
+	if gwcommon.IsUpstreamTimeout(err) {
+		return "timeout"
+	}
+	return "server_error"
+}
+
+// writeUpstreamError 在 SSE 响应头发送之前报告上游错误：以上游状态码返回 JSON 错误，而不是 200 + SSE 错误帧。
+func writeUpstreamError(w http.ResponseWriter, err error) {
+	status := gwcommon.StatusFromVertexError(err)
+	httppkg.WriteOpenAIErrorWithType(w, status, gwcommon.UpstreamErrorMessage(err), errorTypeForStatus(status))
+}
+
+// writeSSEUpstreamError 在流式输出过程中报告错误，error.type 按上游状态码映射。
+func writeSSEUpstreamError(w http.ResponseWriter, err error) {
+	writeSSEErrorWithType(w, gwcommon.UpstreamErrorMessage(err), errorTypeForStatus(gwcommon.StatusFromVertexError(err)))
+}
+
+func writeSSEErrorWithType(w http.ResponseWriter, msg, errType string) {
+	_ = writeSSEData(w, map[string]any{"error": map[string]any{"message": msg, "type": errType}})
+	_, _ = w.Write([]byte("data: [DONE]\n\n"))
+}
+
+func writeSSEErrorWithCode(w http.ResponseWriter, msg, errType, code string) {
+	_ = writeSSEData(w, map[string]any{"error": map[string]any{"message": msg, "type": errType, "code": code}})
 	_, _ = w.Write([]byte("data: [DONE]\n\n"))
 }
 
@@ -62,7 +122,13 @@ func (sw *StreamWriter) ProcessPart(part StreamDataPart) error {
 
 	if part.Thought {
 		sw.pendingReasoning.WriteString(part.Text)
-		return sw.writeReasoningLocked(part.Text)
+		if err := sw.writeReasoningLocked(part.Text); err != nil {
+			return err
+		}
+		if isClaudeThinking && part.ThoughtSignature != "" {
+			return sw.writeReasoningDetailLocked(ReasoningDetail{Type: reasoningDetailText, Signature: part.ThoughtSignature})
+		}
+		return nil
 	}
 	if part.Text != "" {
 		return sw.writeContentLocked(part.Text)
@@ -73,11 +139,10 @@ func (sw *StreamWriter) ProcessPart(part StreamDataPart) error {
 			imageKey = imageKey[:20]
 		}
 		if part.ThoughtSignature != "" {
-			signature.GetManager().Save(sw.requestID, imageKey, part.ThoughtSignature, sw.pendingReasoning.String(), sw.model)
+			signature.GetManagerFor(sw.tenant).Save(sw.requestID, imageKey, part.ThoughtSignature, sw.pendingReasoning.String(), sw.model)
 			sw.pendingReasoning.Reset()
 		}
-		imageMarkdown := fmt.Sprintf("![image](data:%s;base64,%s)", part.InlineData.MimeType, part.InlineData.Data)
-		return sw.writeContentLocked(imageMarkdown)
+		return sw.writeImageLocked(part.InlineData)
 	}
 	if part.FunctionCall != nil {
 		toolCallID := part.FunctionCall.ID
@@ -86,29 +151,33 @@ func (sw *StreamWriter) ProcessPart(part StreamDataPart) error {
 		}
 
 		reasoning := sw.pendingReasoning.String()
+		callKey := signature.CallKey(part.FunctionCall.Name, part.FunctionCall.Args)
 		saved := false
+		var detail *ReasoningDetail
 		if isClaudeThinking {
 			if sw.pendingSig != "" {
-				signature.GetManager().Save(sw.requestID, toolCallID, sw.pendingSig, reasoning, sw.model)
+				signature.GetManagerFor(sw.tenant).SaveToolCall(sw.requestID, toolCallID, callKey, sw.pendingSig, reasoning, sw.model)
 				sw.pendingSig = ""
 				saved = true
 			} else if part.ThoughtSignature != "" {
-				signature.GetManager().Save(sw.requestID, toolCallID, part.ThoughtSignature, reasoning, sw.model)
+				signature.GetManagerFor(sw.tenant).SaveToolCall(sw.requestID, toolCallID, callKey, part.ThoughtSignature, reasoning, sw.model)
 				saved = true
+				detail = &ReasoningDetail{Type: reasoningDetailText, Signature: part.ThoughtSignature}
 			}
 		} else if part.ThoughtSignature != "" {
-			signature.GetManager().Save(sw.requestID, toolCallID, part.ThoughtSignature, reasoning, sw.model)
+			signature.GetManagerFor(sw.tenant).SaveToolCall(sw.requestID, toolCallID, callKey, part.ThoughtSignature, reasoning, sw.model)
 			saved = true
+			detail = &ReasoningDetail{Type: reasoningDetailEncrypted, Signature: part.ThoughtSignature, ID: toolCallID}
 		}
 		if saved {
 			sw.pendingReasoning.Reset()
 		}
-		args := "{}"
-		if part.FunctionCall.Args != nil {
-			if s, err := jsonpkg.MarshalString(part.FunctionCall.Args); err == nil {
-				args = s
+		if detail != nil {
+			if err := sw.writeReasoningDetailLocked(*detail); err != nil {
+				return err
 			}
 		}
+		args := jsonrepair.ToolArguments(part.FunctionCall.Args)
 		idx := len(sw.toolCalls)
 		idxCopy := idx
 		sw.toolCalls = append(sw.toolCalls, ToolCall{Index: &idxCopy, ID: toolCallID, Type: "function", Function: FunctionCall{Name: part.FunctionCall.Name, Arguments: args}})
@@ -129,24 +198,80 @@ func (sw *StreamWriter) FlushToolCalls() error {
 	return nil
 }
 
+// HasOutput 报告是否已向客户端写出过任何 chunk（或有待发送的工具调用）。
+func (sw *StreamWriter) HasOutput() bool {
+	sw.mu.Lock()
+	defer sw.mu.Unlock()
+	return sw.sentRole || len(sw.toolCalls) > 0
+}
+
 func (sw *StreamWriter) WriteFinish(finishReason string, usage *Usage) {
 	sw.mu.Lock()
 	defer sw.mu.Unlock()
+	if sw.pendingSig != "" && modelutil.IsClaudeThinking(sw.model) {
+		// 签名没有被任何工具调用消费：这是纯文本轮次，按回复文本缓存签名（见 textTurnKey）。
+		if key := textTurnKey(sw.content.String()); key != "" {
+			signature.GetManagerFor(sw.tenant).Save(sw.requestID, key, sw.pendingSig, sw.pendingReasoning.String(), sw.model)
+		}
+		sw.pendingSig = ""
+	}
+	if sw.clineCompat {
+		sw.writeCompatFinishLocked(finishReason, usage)
+		return
+	}
 	_ = sw.writeRoleLocked()
 	_ = sw.writeSSEChunkLocked(&Delta{}, &finishReason, usage)
 	_, _ = sw.w.Write([]byte("data: [DONE]\n\n"))
 }
 
+// writeCompatFinishLocked 输出兼容模式的结束 chunk：delta 不为空、总是带 usage。
+func (sw *StreamWriter) writeCompatFinishLocked(finishReason string, usage *Usage) {
+	if usage == nil {
+		usage = &Usage{}
+	}
+	delta := map[string]any{"content": ""}
+	if !sw.sentRole || sw.roleInNext {
+		delta["role"] = "assistant"
+		sw.sentRole, sw.roleInNext = true, false
+	}
+	chunk := map[string]any{
+		"id":      sw.id,
+		"object":  "chat.completion.chunk",
+		"created": sw.created,
+		"model":   cmp.Or(sw.echoModel, sw.model),
+		"choices": []any{map[string]any{"index": 0, "delta": delta, "finish_reason": finishReason}},
+		"usage":   usage,
+	}
+	if sw.debug != nil {
+		chunk[gwcommon.DebugInfoField] = sw.debug
+	}
+	if sw.warning != "" {
+		chunk["warning"] = sw.warning
+		sw.warning = ""
+	}
+	_ = sw.writeSSEDataAndCollect(chunk)
+	_, _ = sw.w.Write([]byte("data: [DONE]\n\n"))
+}
+
 func (sw *StreamWriter) writeRoleLocked() error {
 	if sw.sentRole {
 		return nil
 	}
 	sw.sentRole = true
+	if sw.clineCompat {
+		// 兼容模式不单独发送只有 role 的 delta，而是随下一个 delta 一起发送。
+		sw.roleInNext = true
+		return nil
+	}
 	return sw.writeSSEChunkLocked(&Delta{Role: "assistant"}, nil, nil)
 }
 
 func (sw *StreamWriter) writeContentLocked(s string) error {
 	_ = sw.writeRoleLocked()
+	if modelutil.IsClaudeThinking(sw.model) {
+		// 仅 Claude thinking 需要完整回复文本来缓存纯文本轮次的签名（见 WriteFinish）。
+		sw.content.WriteString(s)
+	}
 	sw.contentBuf = append(sw.contentBuf, []byte(s)...)
 	valid, rest := extractValidUTF8(sw.contentBuf)
 	sw.contentBuf = rest
@@ -156,6 +281,16 @@ func (sw *StreamWriter) writeContentLocked(s string) error {
 	return sw.writeSSEChunkLocked(&Delta{Content: valid}, nil, nil)
 }
 
+// writeImageLocked 直接输出图片 Markdown（纯 ASCII），不经过 contentBuf 的 UTF-8 拼接，
+// 避免多 MB 的 base64 在缓冲区中被多次复制。
+func (sw *StreamWriter) writeImageLocked(d *vertex.InlineData) error {
+	if len(sw.contentBuf) > 0 || modelutil.IsClaudeThinking(sw.model) {
+		return sw.writeContentLocked(imageMarkdown(d))
+	}
+	_ = sw.writeRoleLocked()
+	return sw.writeSSEChunkLocked(&Delta{Content: imageMarkdown(d)}, nil, nil)
+}
+
 func (sw *StreamWriter) writeReasoningLocked(s string) error {
 	_ = sw.writeRoleLocked()
 	sw.reasoningBuf = append(sw.reasoningBuf, []byte(s)...)
@@ -164,23 +299,43 @@ func (sw *StreamWriter) writeReasoningLocked(s string) error {
 	if valid == "" {
 		return nil
 	}
+	if sw.clineCompat {
+		return sw.writeSSEChunkLocked(&Delta{ReasoningContent: valid}, nil, nil)
+	}
 	return sw.writeSSEChunkLocked(&Delta{Reasoning: valid}, nil, nil)
 }
 
+// writeReasoningDetailLocked 输出一项 reasoning_details（签名随到随发，index 依次递增）。
+func (sw *StreamWriter) writeReasoningDetailLocked(d ReasoningDetail) error {
+	_ = sw.writeRoleLocked()
+	d.Format, d.Index = reasoningDetailFormat(sw.model), sw.detailCount
+	sw.detailCount++
+	return sw.writeSSEChunkLocked(&Delta{ReasoningDetails: []ReasoningDetail{d}}, nil, nil)
+}
+
 func (sw *StreamWriter) writeToolCallsLocked(calls []ToolCall) error {
 	_ = sw.writeRoleLocked()
 	return sw.writeSSEChunkLocked(&Delta{ToolCalls: calls}, nil, nil)
 }
 
 func (sw *StreamWriter) writeSSEChunkLocked(delta *Delta, finishReason *string, usage *Usage) error {
+	if sw.roleInNext && delta != nil {
+		delta.Role = "assistant"
+		sw.roleInNext = false
+	}
 	chunk := &ChatCompletion{
 		ID:      sw.id,
 		Object:  "chat.completion.chunk",
 		Created: sw.created,
-		Model:   sw.model,
+		Model:   cmp.Or(sw.echoModel, sw.model),
 		Choices: []Choice{{Index: 0, Delta: delta, FinishReason: finishReason}},
 		Usage:   usage,
+		Warning: sw.warning,
+	}
+	if finishReason != nil {
+		chunk.Debug = sw.debug
 	}
+	sw.warning = ""
 	return sw.writeSSEDataAndCollect(chunk)
 }
 
@@ -240,7 +395,7 @@ func (sw *StreamWriter) GetMergedResponse() []any {
 				"id":      sw.id,
 				"object":  "chat.completion.chunk",
 				"created": sw.created,
-				"model":   sw.model,
+				"model":   cmp.Or(sw.echoModel, sw.model),
 				"choices": []any{map[string]any{"index": 0, "delta": map[string]any{"reasoning": pendingReasoning}}},
 			})
 			pendingReasoning = ""
@@ -250,7 +405,7 @@ func (sw *StreamWriter) GetMergedResponse() []any {
 				"id":      sw.id,
 				"object":  "chat.completion.chunk",
 				"created": sw.created,
-				"model":   sw.model,
+				"model":   cmp.Or(sw.echoModel, sw.model),
 				"choices": []any{map[string]any{"index": 0, "delta": map[string]any{"content": pendingContent}}},
 			})
 			pendingContent = ""
@@ -0,0 +1,90 @@
+package openai
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"anti2api-golang/refactor/internal/config"
+	gwcommon "anti2api-golang/refactor/internal/gateway/common"
+	"anti2api-golang/refactor/internal/vertex"
+)
+
+func TestWriteUpstreamError_UsesUpstreamStatus(t *testing.T) {
+	cases := []struct {
+		err        error
+		wantStatus int
+		wantType   string
+	}{
+		{&vertex.APIError{Status: http.StatusTooManyRequests, Message: "quota"}, http.StatusTooManyRequests, "rate_limit_error"},
+		{&vertex.APIError{Status: http.StatusUnauthorized, Message: "auth"}, http.StatusUnauthorized, "authentication_error"},
+		{&vertex.APIError{Status: http.StatusBadRequest, Message: "bad"}, http.StatusBadRequest, "invalid_request_error"},
+		{errors.New("没有可用的账号"), http.StatusInternalServerError, "server_error"},
+	}
+	for _, c := range cases {
+		rr := httptest.NewRecorder()
+		writeUpstreamError(rr, c.err)
+		if rr.Code != c.wantStatus {
+			t.Errorf("%v: status = %d, want %d", c.err, rr.Code, c.wantStatus)
+		}
+		if got := rr.Header().Get("Content-Type"); got != "application/json" {
+			t.Errorf("%v: Content-Type = %q", c.err, got)
+		}
+		if !strings.Contains(rr.Body.String(), `"type":"`+c.wantType+`"`) {
+			t.Errorf("%v: body = %s, want type %s", c.err, rr.Body.String(), c.wantType)
+		}
+	}
+}
+
+func TestWriteSSEUpstreamError_MapsType(t *testing.T) {
+	rr := httptest.NewRecorder()
+	writeSSEUpstreamError(rr, &vertex.APIError{Status: http.StatusTooManyRequests, Message: "quota"})
+	body := rr.Body.String()
+	if !strings.HasPrefix(body, "data: ") || !strings.Contains(body, `"type":"rate_limit_error"`) {
+		t.Fatalf("unexpected SSE error frame: %s", body)
+	}
+	if !strings.HasSuffix(body, "data: [DONE]\n\n") {
+		t.Fatalf("missing [DONE]: %s", body)
+	}
+}
+
+func TestStreamWriter_DebugInfoOnFinishChunk(t *testing.T) {
+	for _, compat := range []bool{false, true} {
+		rr := httptest.NewRecorder()
+		sw := NewStreamWriter(rr, "chatcmpl-1", 1, "gemini-2.5-pro", "req")
+		sw.clineCompat = compat
+		sw.debug = &gwcommon.DebugInfo{BackendModel: "gemini-2.5-pro", Endpoint: "daily", UpstreamMs: 42}
+		_ = sw.ProcessPart(StreamDataPart{Text: "hi"})
+		sw.WriteFinish("stop", &Usage{PromptTokens: 1, CompletionTokens: 1, TotalTokens: 2})
+
+		body := rr.Body.String()
+		if strings.Count(body, `"x_ant2api"`) != 1 {
+			t.Fatalf("compat=%v: debug info should appear exactly once: %s", compat, body)
+		}
+		last := body[:strings.LastIndex(body, "data: [DONE]")]
+		last = last[strings.LastIndex(strings.TrimSpace(last), "data: "):]
+		if !strings.Contains(last, `"finish_reason":"stop"`) || !strings.Contains(last, `"x_ant2api":{"backend_model":"gemini-2.5-pro","endpoint":"daily","upstream_ms":42}`) {
+			t.Fatalf("compat=%v: debug info not on the finish chunk: %s", compat, last)
+		}
+	}
+}
+
+func TestStreamWriter_ReasoningDetails(t *testing.T) {
+	c := config.Get()
+	oldDir := c.DataDir
+	c.DataDir = t.TempDir()
+	t.Cleanup(func() { c.DataDir = oldDir })
+
+	rr := httptest.NewRecorder()
+	sw := NewStreamWriter(rr, "chatcmpl-1", 1, "claude-sonnet-4-5-thinking", "req")
+	_ = sw.ProcessPart(StreamDataPart{Text: "hmm", Thought: true, ThoughtSignature: "sig-claude"})
+	_ = sw.ProcessPart(StreamDataPart{Text: "answer"})
+	sw.WriteFinish("stop", nil)
+
+	body := rr.Body.String()
+	if !strings.Contains(body, `"reasoning_details":[{"type":"reasoning.text","signature":"sig-claude","format":"anthropic-claude-v1","index":0}]`) {
+		t.Fatalf("expected signature in a reasoning_details delta: %s", body)
+	}
+}
@@ -0,0 +1,157 @@
+package gateway
+
+import (
+	"net/http"
+	"strings"
+
+	"anti2api-golang/refactor/internal/gateway/manager"
+	httppkg "anti2api-golang/refactor/internal/pkg/http"
+)
+
+// handleOpenAPI 输出本服务的 OpenAPI 3 描述，供客户端与 API 网关（Kong、APISIX 等）导入。
+// servers 取自当前请求的 Host（经反向代理时参考 X-Forwarded-Proto / X-Forwarded-Host）。
+func handleOpenAPI(w http.ResponseWriter, r *http.Request) {
+	httppkg.WriteJSON(w, http.StatusOK, buildOpenAPI(requestBaseURL(r)))
+}
+
+// buildOpenAPI 由路由表（apiRoutes / managerRoutes）生成 OpenAPI 文档；serverURL 为空时不写 servers。
+func buildOpenAPI(serverURL string) map[string]any {
+	paths := map[string]any{}
+	for _, rt := range append(apiRoutes(), managerRoutes()...) {
+		for _, op := range rt.ops {
+			path := op.path
+			if path == "" {
+				path = rt.pattern
+			}
+			item, _ := paths[path].(map[string]any)
+			if item == nil {
+				item = map[string]any{}
+				paths[path] = item
+			}
+			item[strings.ToLower(op.method)] = openAPIOperation(path, op)
+		}
+	}
+
+	doc := map[string]any{
+		"openapi": "3.0.3",
+		"info": map[string]any{
+			"title":       "ant2api",
+			"description": "Antigravity 反向代理：OpenAI / Anthropic / Gemini 兼容接口及管理面板 API。",
+			"version":     "1.0.0",
+		},
+		"tags": []map[string]any{
+			{"name": tagSystem},
+			{"name": tagModels, "description": "模型列表（OpenAI / Anthropic 共用路径）"},
+			{"name": tagOpenAI, "description": "OpenAI 兼容接口"},
+			{"name": tagClaude, "description": "Anthropic 兼容接口"},
+			{"name": tagGemini, "description": "Gemini 透传接口"},
+			{"name": tagSessions, "description": "显式 Vertex sessionId 管理，请求时通过 X-Session-ID 传回"},
+			{"name": tagManager, "description": "管理面板 API（需登录会话）"},
+		},
+		"paths": paths,
+		"components": map[string]any{
+			"securitySchemes": map[string]any{
+				"bearerAuth":    map[string]any{"type": "http", "scheme": "bearer"},
+				"apiKeyHeader":  map[string]any{"type": "apiKey", "in": "header", "name": "x-api-key"},
+				"googApiKey":    map[string]any{"type": "apiKey", "in": "header", "name": "x-goog-api-key"},
+				"apiKeyQuery":   map[string]any{"type": "apiKey", "in": "query", "name": "key"},
+				securityManager: map[string]any{"type": "apiKey", "in": "cookie", "name": manager.SessionCookieName},
+			},
+		},
+	}
+	if serverURL != "" {
+		doc["servers"] = []map[string]any{{"url": serverURL}}
+	}
+	return doc
+}
+
+func openAPIOperation(path string, op operation) map[string]any {
+	out := map[string]any{
+		"operationId": operationID(op.method, path),
+		"summary":     op.summary,
+		"tags":        []string{op.tag},
+	}
+
+	if len(op.params) > 0 {
+		params := make([]map[string]any, 0, len(op.params))
+		for _, p := range op.params {
+			param := map[string]any{"name": p.name, "in": p.in, "schema": map[string]any{"type": "string"}}
+			if p.required {
+				param["required"] = true
+			}
+			if p.desc != "" {
+				param["description"] = p.desc
+			}
+			params = append(params, param)
+		}
+		out["parameters"] = params
+	}
+
+	if op.body {
+		out["requestBody"] = map[string]any{
+			"required": true,
+			"content":  map[string]any{"application/json": map[string]any{"schema": map[string]any{"type": "object"}}},
+		}
+	}
+
+	produces := op.produces
+	if produces == "" {
+		produces = "application/json"
+	}
+	content := map[string]any{produces: map[string]any{}}
+	if op.stream {
+		content["text/event-stream"] = map[string]any{}
+	}
+	responses := map[string]any{"200": map[string]any{"description": "成功", "content": content}}
+
+	switch op.security {
+	case securityAPIKey:
+		out["security"] = []map[string][]string{{"bearerAuth": {}}, {"apiKeyHeader": {}}, {"googApiKey": {}}, {"apiKeyQuery": {}}}
+		responses["401"] = map[string]any{"description": "缺少或无效的 API Key"}
+	case securityManager:
+		out["security"] = []map[string][]string{{securityManager: {}}}
+		responses["401"] = map[string]any{"description": "未登录管理面板"}
+	default:
+		out["security"] = []map[string][]string{}
+	}
+	out["responses"] = responses
+	return out
+}
+
+// operationID 由方法与路径生成稳定的 operationId，例如 POST /v1/chat/completions → post_v1_chat_completions。
+func operationID(method, path string) string {
+	var b strings.Builder
+	b.WriteString(strings.ToLower(method))
+	sep := true
+	for _, c := range path {
+		if c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' {
+			if sep {
+				b.WriteByte('_')
+				sep = false
+			}
+			b.WriteRune(c)
+			continue
+		}
+		sep = true
+	}
+	return b.String()
+}
+
+func requestBaseURL(r *http.Request) string {
+	host, _, _ := strings.Cut(r.Header.Get("X-Forwarded-Host"), ",")
+	host = strings.TrimSpace(host)
+	if host == "" {
+		host = r.Host
+	}
+	if host == "" {
+		return ""
+	}
+	scheme := "http"
+	if r.TLS != nil {
+		scheme = "https"
+	}
+	if proto := strings.TrimSpace(r.Header.Get("X-Forwarded-Proto")); proto == "http" || proto == "https" {
+		scheme = proto
+	}
+	return scheme + "://" + host
+}
@@ -0,0 +1,90 @@
+package gateway
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+
+	"anti2api-golang/refactor/internal/config"
+	"anti2api-golang/refactor/internal/middleware"
+	jsonpkg "anti2api-golang/refactor/internal/pkg/json"
+)
+
+func TestRoutes_OperationsMatchRegistration(t *testing.T) {
+	for _, rt := range append(apiRoutes(), managerRoutes()...) {
+		for _, op := range rt.ops {
+			if len(rt.methods) > 0 && !slices.Contains(rt.methods, op.method) {
+				t.Errorf("%s: documented %s is rejected by allowMethods %v", rt.pattern, op.method, rt.methods)
+			}
+			if op.path != "" && !strings.HasPrefix(op.path, rt.pattern) {
+				t.Errorf("%s: documented path %s is not served by this pattern", rt.pattern, op.path)
+			}
+			if op.tag == "" || op.summary == "" {
+				t.Errorf("%s %s: missing tag or summary", op.method, rt.pattern)
+			}
+		}
+	}
+}
+
+func TestHandleOpenAPI(t *testing.T) {
+	r := httptest.NewRequest(http.MethodGet, "/openapi.json", nil)
+	r.Host = "internal:8045"
+	r.Header.Set("X-Forwarded-Host", "api.example.com")
+	r.Header.Set("X-Forwarded-Proto", "https")
+	rr := httptest.NewRecorder()
+	handleOpenAPI(rr, r)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("status %d", rr.Code)
+	}
+
+	var doc struct {
+		OpenAPI string                               `json:"openapi"`
+		Servers []struct{ URL string }               `json:"servers"`
+		Paths   map[string]map[string]map[string]any `json:"paths"`
+	}
+	if err := jsonpkg.Unmarshal(rr.Body.Bytes(), &doc); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if !strings.HasPrefix(doc.OpenAPI, "3.") || len(doc.Servers) != 1 || doc.Servers[0].URL != "https://api.example.com" {
+		t.Fatalf("unexpected header fields: %+v", doc)
+	}
+
+	want := map[string][]string{
+		"/v1/chat/completions": {"post"},
+		"/v1/messages":         {"post"},
+		"/v1/models/{model}":   {"get"},
+		"/v1/sessions/{id}":    {"get", "delete"},
+		"/v1beta/models/{model}:streamGenerateContent": {"post"},
+		"/manager/api/settings":                        {"get", "post"},
+		"/openapi.json":                                {"get"},
+	}
+	for path, methods := range want {
+		for _, m := range methods {
+			if _, ok := doc.Paths[path][m]; !ok {
+				t.Errorf("missing %s %s", m, path)
+			}
+		}
+	}
+	if _, ok := doc.Paths["/v1/chat/completions/"]; ok {
+		t.Error("trailing-slash alias should not be documented")
+	}
+	if op := doc.Paths["/v1/chat/completions"]["post"]; op["operationId"] != "post_v1_chat_completions" {
+		t.Errorf("operationId = %v", op["operationId"])
+	}
+}
+
+func TestOpenAPI_PublicWithAPIKey(t *testing.T) {
+	c := config.Get()
+	old := c.APIKey
+	c.APIKey = "sk-test"
+	t.Cleanup(func() { c.APIKey = old })
+
+	h := middleware.Auth(http.HandlerFunc(handleOpenAPI))
+	rr := httptest.NewRecorder()
+	h.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/openapi.json", nil))
+	if rr.Code != http.StatusOK {
+		t.Fatalf("status %d, want 200 without API key", rr.Code)
+	}
+}
@@ -7,7 +7,6 @@ import (
 	"strings"
 
 	"anti2api-golang/refactor/internal/gateway/claude"
-	"anti2api-golang/refactor/internal/gateway/gemini"
 	"anti2api-golang/refactor/internal/gateway/manager"
 	"anti2api-golang/refactor/internal/gateway/openai"
 	"anti2api-golang/refactor/internal/middleware"
@@ -17,64 +16,26 @@ func NewRouter() http.Handler {
 	mux := http.NewServeMux()
 
 	// NOTE: Keep routing compatible with Go 1.21's ServeMux behavior.
-	mux.HandleFunc("/health", allowMethods(handleHealth, http.MethodGet, http.MethodHead))
-
-	// Shared path between OpenAI and Anthropic-compatible clients; select response format by headers.
-	mux.HandleFunc("/v1/models", allowMethods(handleListModels, http.MethodGet, http.MethodHead))
-	mux.HandleFunc("/v1/chat/completions", allowMethods(openai.HandleChatCompletions, http.MethodPost))
-	mux.HandleFunc("/v1/chat/completions/", allowMethods(openai.HandleChatCompletions, http.MethodPost))
-
-	mux.HandleFunc("/v1/messages", allowMethods(claude.HandleMessages, http.MethodPost))
-	mux.HandleFunc("/v1/messages/count_tokens", allowMethods(claude.HandleCountTokens, http.MethodPost))
-
-	// Gemini endpoints include a variable model segment.
-	mux.HandleFunc("/v1beta/models/", gemini.HandleModels)
-	// Provide a stable non-redirect entrypoint for list.
-	mux.HandleFunc("/v1beta/models", allowMethods(gemini.HandleListModels, http.MethodGet, http.MethodHead))
-
-	// Manager UI & API
-	// Public Login
-	mux.HandleFunc("/login", func(w http.ResponseWriter, r *http.Request) {
-		if r.Method == http.MethodPost {
-			manager.HandleLogin(w, r)
-		} else {
-			manager.HandleLoginView(w, r)
-		}
-	})
-	mux.HandleFunc("/logout", manager.HandleLogout)
+	// 路由表见 routes.go，/openapi.json 由同一张表生成。
+	for _, rt := range apiRoutes() {
+		rt.register(mux)
+	}
 
 	// Protected Manager Routes
 	// We use a separate mux for manager routes to wrap them in ManagerAuth
 	// However, since we want to mount it at root "/", we must be careful not to shadow /v1 routes
 	// But ServeMux uses longest match, so /v1 will still take precedence over /
-
-	// We can't mount a handler at "/" AND have other handlers at /v1 on the *same* mux easily if we modify the handler for "/"
-	// Wait, mux.Handle("/", ...) works as catch-all.
-
 	managerMux := http.NewServeMux()
-	managerMux.HandleFunc("/", manager.HandleDashboard)
-	managerMux.HandleFunc("/manager/api/list", manager.HandleList)
-	managerMux.HandleFunc("/manager/api/stats", manager.HandleStats)
-	managerMux.HandleFunc("/manager/api/delete", manager.HandleDelete)
-	managerMux.HandleFunc("/manager/api/toggle", manager.HandleToggle)
-	managerMux.HandleFunc("/manager/api/refresh", manager.HandleRefresh)
-	managerMux.HandleFunc("/manager/api/refresh_all", manager.HandleRefreshAll)
-	managerMux.HandleFunc("/manager/api/quota", manager.HandleQuota)
-	managerMux.HandleFunc("/manager/api/quota/all", manager.HandleQuotaAll)
-	managerMux.HandleFunc("/manager/api/oauth/url", manager.HandleOAuthURL)
-	managerMux.HandleFunc("/manager/api/oauth/parse-url", manager.HandleOAuthParseURL)
-	managerMux.HandleFunc("/manager/api/settings", func(w http.ResponseWriter, r *http.Request) {
-		if r.Method == http.MethodPost {
-			manager.HandleSettingsPost(w, r)
-		} else {
-			manager.HandleSettingsGet(w, r)
-		}
-	})
+	for _, rt := range managerRoutes() {
+		rt.register(managerMux)
+	}
 
 	// Mount the protected manager logic at root
 	mux.Handle("/", manager.ManagerAuth(managerMux))
 
 	h := middleware.Recovery(mux)
+	h = middleware.LoadShed(h)
+	h = middleware.Decompress(h)
 	h = middleware.Logging(h)
 	h = middleware.Auth(h)
 	return h
@@ -82,13 +43,38 @@ func NewRouter() http.Handler {
 
 func handleListModels(w http.ResponseWriter, r *http.Request) {
 	// Anthropic SDKs typically include this header; prefer Anthropic format when present.
-	if strings.TrimSpace(r.Header.Get("anthropic-version")) != "" || strings.TrimSpace(r.Header.Get("anthropic-beta")) != "" {
+	if isAnthropicRequest(r) {
 		claude.HandleListModels(w, r)
 		return
 	}
 	openai.HandleListModels(w, r)
 }
 
+func handleRetrieveModel(w http.ResponseWriter, r *http.Request) {
+	modelID := strings.Trim(strings.TrimPrefix(r.URL.Path, "/v1/models/"), "/")
+	if modelID == "" {
+		handleListModels(w, r)
+		return
+	}
+	if isAnthropicRequest(r) {
+		claude.HandleRetrieveModel(w, r, modelID)
+		return
+	}
+	openai.HandleRetrieveModel(w, r, modelID)
+}
+
+func isAnthropicRequest(r *http.Request) bool {
+	return strings.TrimSpace(r.Header.Get("anthropic-version")) != "" || strings.TrimSpace(r.Header.Get("anthropic-beta")) != ""
+}
+
+func (rt route) register(mux *http.ServeMux) {
+	h := rt.handler
+	if len(rt.methods) > 0 {
+		h = allowMethods(h, rt.methods...)
+	}
+	mux.HandleFunc(rt.pattern, h)
+}
+
 func allowMethods(h http.HandlerFunc, methods ...string) http.HandlerFunc {
 	allowed := make(map[string]struct{}, len(methods))
 	for _, m := range methods {
@@ -0,0 +1,224 @@
+package gateway
+
+import (
+	"net/http"
+
+	"anti2api-golang/refactor/internal/gateway/claude"
+	"anti2api-golang/refactor/internal/gateway/gemini"
+	"anti2api-golang/refactor/internal/gateway/manager"
+	"anti2api-golang/refactor/internal/gateway/manager/static"
+	"anti2api-golang/refactor/internal/gateway/openai"
+)
+
+// OpenAPI 标签（接口分组）。
+const (
+	tagSystem   = "System"
+	tagModels   = "Models"
+	tagOpenAI   = "OpenAI"
+	tagClaude   = "Claude"
+	tagGemini   = "Gemini"
+	tagSessions = "Sessions"
+	tagManager  = "Manager"
+)
+
+// OpenAPI 鉴权方式（见 openAPISecuritySchemes）。
+const (
+	securityAPIKey  = "apiKey"
+	securityManager = "managerSession"
+)
+
+// route 是一条路由的元数据：NewRouter 按它注册处理函数，/openapi.json 也由同一张表生成，新增路由时二者不会不同步。
+type route struct {
+	pattern string // ServeMux 模式
+	handler http.HandlerFunc
+	// methods 非空时由 allowMethods 限制请求方法；manager 处理函数自行校验方法，不再包装。
+	methods []string
+	// ops 为写入 OpenAPI 的操作；为空表示不公开（页面、静态资源、兼容用的带尾斜杠路径）。
+	ops []operation
+}
+
+// operation 描述一个对外公开的 HTTP 操作。
+type operation struct {
+	method   string
+	path     string // OpenAPI 路径，可含 {param}；为空时使用 route.pattern
+	tag      string
+	summary  string
+	security string
+	params   []parameter
+	body     bool   // 请求体为 JSON
+	stream   bool   // 可返回 SSE（text/event-stream）
+	produces string // 响应类型，为空时为 application/json
+}
+
+// parameter 描述 path / query / header 参数（类型均为 string）。
+type parameter struct {
+	name     string
+	in       string
+	required bool
+	desc     string
+}
+
+var (
+	modelPathParam   = parameter{name: "model", in: "path", required: true, desc: "模型 ID"}
+	sessionPathParam = parameter{name: "id", in: "path", required: true, desc: "会话 ID"}
+	accountIDParam   = parameter{name: "id", in: "query", required: true, desc: "账号 sessionId"}
+	archiveIDParam   = parameter{name: "id", in: "query", required: true, desc: "归档 ID"}
+	limitParam       = parameter{name: "limit", in: "query", desc: "返回条数上限"}
+	tenantParam      = parameter{name: "tenant", in: "query", desc: "租户名（见 TENANTS），为空表示默认租户"}
+)
+
+// apiRoutes 返回对外接口（OpenAI / Claude / Gemini / 会话）及公开页面的路由，注册在根 mux 上。
+func apiRoutes() []route {
+	get := []string{http.MethodGet, http.MethodHead}
+	post := []string{http.MethodPost}
+
+	return []route{
+		{pattern: "/health", handler: handleHealth, methods: get, ops: []operation{
+			{method: http.MethodGet, tag: tagSystem, summary: "存活检查", produces: "text/plain"},
+		}},
+		{pattern: "/openapi.json", handler: handleOpenAPI, methods: get, ops: []operation{
+			{method: http.MethodGet, tag: tagSystem, summary: "本服务的 OpenAPI 3 描述"},
+		}},
+		{pattern: "/status", handler: manager.HandleStatus, ops: []operation{
+			{method: http.MethodGet, tag: tagSystem, summary: "公开状态页（STATUS_PAGE=true 时启用；浏览器返回页面，其他返回 JSON）", params: []parameter{{name: "format", in: "query", desc: "html / json"}}},
+		}},
+
+		// Shared path between OpenAI and Anthropic-compatible clients; select response format by headers.
+		{pattern: "/v1/models", handler: handleListModels, methods: get, ops: []operation{
+			{method: http.MethodGet, tag: tagModels, summary: "模型列表（携带 anthropic-version 时返回 Anthropic 格式）", security: securityAPIKey},
+		}},
+		{pattern: "/v1/models/", handler: handleRetrieveModel, methods: get, ops: []operation{
+			{method: http.MethodGet, path: "/v1/models/{model}", tag: tagModels, summary: "模型详情（携带 anthropic-version 时返回 Anthropic 格式）", security: securityAPIKey, params: []parameter{modelPathParam}},
+		}},
+		{pattern: "/v1/chat/completions", handler: openai.HandleChatCompletions, methods: post, ops: []operation{
+			{method: http.MethodPost, tag: tagOpenAI, summary: "OpenAI Chat Completions", security: securityAPIKey, body: true, stream: true},
+		}},
+		{pattern: "/v1/chat/completions/", handler: openai.HandleChatCompletions, methods: post},
+		{pattern: "/v1/moderations", handler: openai.HandleModerations, methods: post, ops: []operation{
+			{method: http.MethodPost, tag: tagOpenAI, summary: "OpenAI Moderations（由 MODERATION_MODEL 分类并合并上游安全评级）", security: securityAPIKey, body: true},
+		}},
+
+		{pattern: "/v1/messages", handler: claude.HandleMessages, methods: post, ops: []operation{
+			{method: http.MethodPost, tag: tagClaude, summary: "Anthropic Messages", security: securityAPIKey, body: true, stream: true},
+		}},
+		{pattern: "/v1/messages/count_tokens", handler: claude.HandleCountTokens, methods: post, ops: []operation{
+			{method: http.MethodPost, tag: tagClaude, summary: "Anthropic Messages token 计数", security: securityAPIKey, body: true},
+		}},
+		{pattern: "/v1/versions", handler: claude.HandleVersions, methods: get, ops: []operation{
+			{method: http.MethodGet, tag: tagClaude, summary: "支持的 anthropic-version 取值", security: securityAPIKey},
+		}},
+
+		// Explicit Vertex sessionId management; clients pass the id back via X-Session-ID.
+		{pattern: "/v1/sessions", handler: handleSessions, methods: []string{http.MethodGet, http.MethodPost}, ops: []operation{
+			{method: http.MethodGet, tag: tagSessions, summary: "列出未过期的会话", security: securityAPIKey},
+			{method: http.MethodPost, tag: tagSessions, summary: "创建会话", security: securityAPIKey, body: true},
+		}},
+		{pattern: "/v1/sessions/", handler: handleSession, methods: []string{http.MethodGet, http.MethodDelete}, ops: []operation{
+			{method: http.MethodGet, path: "/v1/sessions/{id}", tag: tagSessions, summary: "会话详情", security: securityAPIKey, params: []parameter{sessionPathParam}},
+			{method: http.MethodDelete, path: "/v1/sessions/{id}", tag: tagSessions, summary: "删除会话", security: securityAPIKey, params: []parameter{sessionPathParam}},
+		}},
+
+		// Gemini endpoints include a variable model segment.
+		{pattern: "/v1beta/models/", handler: gemini.HandleModels, ops: []operation{
+			{method: http.MethodGet, path: "/v1beta/models/{model}", tag: tagGemini, summary: "Gemini 模型详情", security: securityAPIKey, params: []parameter{modelPathParam}},
+			{method: http.MethodPost, path: "/v1beta/models/{model}:generateContent", tag: tagGemini, summary: "Gemini generateContent", security: securityAPIKey, params: []parameter{modelPathParam}, body: true},
+			{method: http.MethodPost, path: "/v1beta/models/{model}:streamGenerateContent", tag: tagGemini, summary: "Gemini streamGenerateContent（alt=sse 时为 SSE）", security: securityAPIKey, params: []parameter{modelPathParam, {name: "alt", in: "query", desc: "sse"}}, body: true, stream: true},
+		}},
+		// Provide a stable non-redirect entrypoint for list.
+		{pattern: "/v1beta/models", handler: gemini.HandleListModels, methods: get, ops: []operation{
+			{method: http.MethodGet, tag: tagGemini, summary: "Gemini 模型列表", security: securityAPIKey},
+		}},
+
+		// Manager UI & API
+		// Embedded frontend assets (htmx / Tailwind) so the manager works without internet egress.
+		{pattern: static.Prefix, handler: static.Handler().ServeHTTP},
+		// Public Login
+		{pattern: "/login", handler: func(w http.ResponseWriter, r *http.Request) {
+			if r.Method == http.MethodPost {
+				manager.HandleLogin(w, r)
+			} else {
+				manager.HandleLoginView(w, r)
+			}
+		}},
+		{pattern: "/logout", handler: manager.HandleLogout},
+		// First-run setup: only active while no admin password and no accounts exist.
+		{pattern: "/setup", handler: manager.HandleSetup},
+	}
+}
+
+// managerRoutes 返回管理面板的路由，挂载在受 ManagerAuth 保护的子 mux 上。
+func managerRoutes() []route {
+	get := func(summary string, params ...parameter) []operation {
+		return []operation{{method: http.MethodGet, tag: tagManager, summary: summary, security: securityManager, params: params}}
+	}
+	post := func(summary string, params ...parameter) []operation {
+		return []operation{{method: http.MethodPost, tag: tagManager, summary: summary, security: securityManager, params: params}}
+	}
+	html := func(ops []operation) []operation {
+		for i := range ops {
+			ops[i].produces = "text/html"
+		}
+		return ops
+	}
+
+	return []route{
+		{pattern: "/", handler: manager.HandleDashboard},
+		{pattern: "/manager/api/list", handler: manager.HandleList, ops: html(get("账号列表（HTML 片段）", parameter{name: "status", in: "query", desc: "按状态筛选"}))},
+		{pattern: "/manager/api/stats", handler: manager.HandleStats, ops: html(get("账号统计（HTML 片段）"))},
+		{pattern: "/manager/api/delete", handler: manager.HandleDelete, ops: post("删除账号", accountIDParam)},
+		{pattern: "/manager/api/archive", handler: manager.HandleArchive, ops: get("已归档账号列表")},
+		{pattern: "/manager/api/archive/restore", handler: manager.HandleArchiveRestore, ops: post("恢复归档账号", archiveIDParam)},
+		{pattern: "/manager/api/archive/purge", handler: manager.HandleArchivePurge, ops: post("彻底删除归档账号", archiveIDParam)},
+		{pattern: "/manager/api/toggle", handler: manager.HandleToggle, ops: post("启用 / 停用账号", accountIDParam)},
+		{pattern: "/manager/api/caps", handler: manager.HandleCaps, ops: append(get("账号当天用量与每日上限", accountIDParam), post("设置账号每日用量上限", accountIDParam,
+			parameter{name: "requestCap", in: "query", desc: "每日请求数上限：0 或空沿用 ACCOUNT_DAILY_REQUEST_CAP，负数不限制"},
+			parameter{name: "tokenCap", in: "query", desc: "每日 token 数上限：0 或空沿用 ACCOUNT_DAILY_TOKEN_CAP，负数不限制"})...)},
+		{pattern: "/manager/api/refresh", handler: manager.HandleRefresh, ops: post("刷新账号 token", accountIDParam)},
+		{pattern: "/manager/api/refresh_all", handler: manager.HandleRefreshAll, ops: post("刷新全部账号 token")},
+		{pattern: "/manager/api/quota", handler: manager.HandleQuota, ops: get("账号配额", accountIDParam, parameter{name: "force", in: "query", desc: "1 表示忽略缓存"})},
+		{pattern: "/manager/api/quota/all", handler: manager.HandleQuotaAll, ops: post("刷新全部账号配额")},
+		{pattern: "/manager/api/oauth/url", handler: manager.HandleOAuthURL, ops: get("生成 OAuth 授权链接")},
+		{pattern: "/manager/api/oauth/parse-url", handler: manager.HandleOAuthParseURL, ops: []operation{
+			{method: http.MethodPost, tag: tagManager, summary: "解析 OAuth 回调 URL 并保存账号", security: securityManager, body: true},
+		}},
+		{pattern: "/manager/api/transcripts", handler: manager.HandleTranscripts, ops: get("对话记录列表", parameter{name: "session", in: "query", desc: "会话键"}, limitParam, tenantParam)},
+		{pattern: "/manager/api/transcripts/view", handler: manager.HandleTranscriptsView},
+		{pattern: "/manager/api/transcripts/detail", handler: manager.HandleTranscriptDetail, ops: get("对话记录详情", parameter{name: "id", in: "query", required: true, desc: "记录 ID"}, tenantParam)},
+		{pattern: "/manager/api/transcripts/replay", handler: manager.HandleTranscriptReplay, ops: []operation{
+			{method: http.MethodPost, tag: tagManager, summary: "按指定模型 / 账号 / 端点重放对话记录并对比响应", security: securityManager, body: true, params: []parameter{tenantParam}},
+		}},
+		{pattern: "/manager/api/transcripts/export", handler: manager.HandleTranscriptExport, ops: []operation{
+			{method: http.MethodGet, tag: tagManager, summary: "导出对话记录（JSONL）", security: securityManager, produces: "application/x-ndjson", params: []parameter{
+				{name: "session", in: "query", desc: "会话键"}, {name: "date", in: "query", desc: "日期 YYYY-MM-DD"}, tenantParam,
+			}},
+		}},
+		{pattern: "/manager/api/backup", handler: manager.HandleBackup, ops: []operation{
+			{method: http.MethodGet, tag: tagManager, summary: "下载数据目录备份（tar.gz）", security: securityManager, produces: "application/gzip", params: []parameter{
+				{name: "accounts", in: "query", desc: "账号导出方式：full / redacted（默认）/ none"},
+			}},
+		}},
+		{pattern: "/manager/api/restore", handler: manager.HandleRestore, ops: post("从备份恢复数据目录（上传 tar.gz）")},
+		{pattern: "/manager/api/journal", handler: manager.HandleJournal, ops: get("操作日志", limitParam)},
+		{pattern: "/manager/api/metrics", handler: manager.HandleMetrics, ops: get("运行指标")},
+		{pattern: "/manager/api/tenants", handler: manager.HandleTenants, ops: get("租户列表及用量")},
+		{pattern: "/manager/api/tenants/purge", handler: manager.HandleTenantPurge, ops: post("清空租户数据", parameter{name: "tenant", in: "query", required: true, desc: "租户名"})},
+		{pattern: "/manager/api/endpoint", handler: manager.HandleEndpoint, ops: []operation{
+			{method: http.MethodGet, tag: tagManager, summary: "端点模式、各端点成功率与最近请求使用的端点", security: securityManager, params: []parameter{limitParam}},
+			{method: http.MethodPost, tag: tagManager, summary: "切换端点模式", security: securityManager, body: true},
+		}},
+		{pattern: "/manager/api/endpoint/probe", handler: manager.HandleEndpointProbe, ops: []operation{
+			{method: http.MethodGet, tag: tagManager, summary: "最近一次端点延迟探测结果", security: securityManager},
+			{method: http.MethodPost, tag: tagManager, summary: "用指定账号向各端点发送探测请求并比较延迟", security: securityManager, body: true},
+		}},
+		{pattern: "/manager/api/settings", handler: func(w http.ResponseWriter, r *http.Request) {
+			if r.Method == http.MethodPost {
+				manager.HandleSettingsPost(w, r)
+			} else {
+				manager.HandleSettingsGet(w, r)
+			}
+		}, ops: []operation{
+			{method: http.MethodGet, tag: tagManager, summary: "读取系统设置", security: securityManager},
+			{method: http.MethodPost, tag: tagManager, summary: "保存系统设置", security: securityManager, body: true},
+		}},
+	}
+}
@@ -0,0 +1,88 @@
+package gateway
+
+import (
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"anti2api-golang/refactor/internal/middleware"
+	httppkg "anti2api-golang/refactor/internal/pkg/http"
+	jsonpkg "anti2api-golang/refactor/internal/pkg/json"
+	"anti2api-golang/refactor/internal/session"
+)
+
+type createSessionRequest struct {
+	Label      string `json:"label"`
+	TTLSeconds int    `json:"ttl_seconds"`
+}
+
+type sessionObject struct {
+	session.Session
+	Object string `json:"object"`
+}
+
+func toSessionObject(s session.Session) sessionObject {
+	return sessionObject{Session: s, Object: "session"}
+}
+
+// handleSessions 处理 /v1/sessions：GET 列出当前租户未过期的会话，POST 为当前租户创建新会话。
+func handleSessions(w http.ResponseWriter, r *http.Request) {
+	store := session.GetStore()
+	tenant := middleware.TenantFromContext(r.Context())
+	if r.Method != http.MethodPost {
+		list := store.List(tenant)
+		data := make([]sessionObject, 0, len(list))
+		for _, s := range list {
+			data = append(data, toSessionObject(s))
+		}
+		httppkg.WriteJSON(w, http.StatusOK, map[string]any{"object": "list", "data": data})
+		return
+	}
+
+	var req createSessionRequest
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		httppkg.WriteOpenAIError(w, http.StatusBadRequest, "读取请求体失败，请检查请求是否正确发送。")
+		return
+	}
+	if len(strings.TrimSpace(string(body))) > 0 {
+		if err := jsonpkg.Unmarshal(body, &req); err != nil {
+			httppkg.WriteOpenAIError(w, http.StatusBadRequest, "请求 JSON 解析失败，请检查请求体格式。")
+			return
+		}
+	}
+	if req.TTLSeconds < 0 {
+		httppkg.WriteOpenAIError(w, http.StatusBadRequest, "ttl_seconds 不能为负数。")
+		return
+	}
+	s := store.Create(tenant, req.Label, time.Duration(req.TTLSeconds)*time.Second)
+	httppkg.WriteJSON(w, http.StatusCreated, toSessionObject(s))
+}
+
+// handleSession 处理 /v1/sessions/{id}：GET 查询会话，DELETE 使会话立即失效（仅限当前租户的会话）。
+func handleSession(w http.ResponseWriter, r *http.Request) {
+	sessionID := strings.TrimPrefix(r.URL.Path, "/v1/sessions/")
+	if sessionID == "" || strings.Contains(sessionID, "/") {
+		httppkg.WriteOpenAIError(w, http.StatusNotFound, "未找到对应的会话。")
+		return
+	}
+
+	store := session.GetStore()
+	tenant := middleware.TenantFromContext(r.Context())
+	if r.Method == http.MethodDelete {
+		if !store.Expire(tenant, sessionID) {
+			httppkg.WriteOpenAIError(w, http.StatusNotFound, "未找到对应的会话或会话已过期。")
+			return
+		}
+		httppkg.WriteJSON(w, http.StatusOK, map[string]any{"id": sessionID, "object": "session.deleted", "deleted": true})
+		return
+	}
+
+	s, ok := store.Get(tenant, sessionID)
+	if !ok {
+		httppkg.WriteOpenAIError(w, http.StatusNotFound, "未找到对应的会话或会话已过期。")
+		return
+	}
+	httppkg.WriteJSON(w, http.StatusOK, toSessionObject(s))
+}
@@ -0,0 +1,50 @@
+package gateway
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	jsonpkg "anti2api-golang/refactor/internal/pkg/json"
+)
+
+func TestSessionsAPI(t *testing.T) {
+	rr := httptest.NewRecorder()
+	handleSessions(rr, httptest.NewRequest(http.MethodPost, "/v1/sessions", strings.NewReader(`{"label":"agent","ttl_seconds":60}`)))
+	if rr.Code != http.StatusCreated {
+		t.Fatalf("create: status %d body %s", rr.Code, rr.Body.String())
+	}
+	var created struct {
+		ID     string `json:"id"`
+		Object string `json:"object"`
+		Label  string `json:"label"`
+	}
+	if err := jsonpkg.Unmarshal(rr.Body.Bytes(), &created); err != nil || created.ID == "" || created.Object != "session" || created.Label != "agent" {
+		t.Fatalf("unexpected create response %s (%v)", rr.Body.String(), err)
+	}
+
+	rr = httptest.NewRecorder()
+	handleSession(rr, httptest.NewRequest(http.MethodGet, "/v1/sessions/"+created.ID, nil))
+	if rr.Code != http.StatusOK {
+		t.Fatalf("get: status %d body %s", rr.Code, rr.Body.String())
+	}
+
+	rr = httptest.NewRecorder()
+	handleSessions(rr, httptest.NewRequest(http.MethodGet, "/v1/sessions", nil))
+	if rr.Code != http.StatusOK || !strings.Contains(rr.Body.String(), created.ID) {
+		t.Fatalf("list: status %d body %s", rr.Code, rr.Body.String())
+	}
+
+	rr = httptest.NewRecorder()
+	handleSession(rr, httptest.NewRequest(http.MethodDelete, "/v1/sessions/"+created.ID, nil))
+	if rr.Code != http.StatusOK {
+		t.Fatalf("delete: status %d body %s", rr.Code, rr.Body.String())
+	}
+
+	rr = httptest.NewRecorder()
+	handleSession(rr, httptest.NewRequest(http.MethodGet, "/v1/sessions/"+created.ID, nil))
+	if rr.Code != http.StatusNotFound {
+		t.Fatalf("get after delete: status %d body %s", rr.Code, rr.Body.String())
+	}
+}
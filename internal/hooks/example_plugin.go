@@ -0,0 +1,42 @@
+//go:build hooks_example
+
+package hooks
+
+// 编译期插件示例：go build -tags hooks_example ./cmd/server
+// 通过 HOOK_EXAMPLE_DENY_MODELS（逗号分隔）拒绝指定模型。
+
+import (
+	"context"
+	"net/http"
+	"os"
+	"strings"
+
+	"anti2api-golang/refactor/internal/vertex"
+)
+
+type denyModelsHook struct {
+	deny map[string]bool
+}
+
+func init() {
+	deny := make(map[string]bool)
+	for _, m := range strings.Split(os.Getenv("HOOK_EXAMPLE_DENY_MODELS"), ",") {
+		if m = strings.ToLower(strings.TrimSpace(m)); m != "" {
+			deny[m] = true
+		}
+	}
+	Register(&denyModelsHook{deny: deny})
+}
+
+func (h *denyModelsHook) Name() string { return "example-deny-models" }
+
+func (h *denyModelsHook) BeforeRequest(_ context.Context, info *Info, _ *vertex.Request) error {
+	if h.deny[strings.ToLower(info.Model)] {
+		return &vertex.APIError{Status: http.StatusForbidden, Message: "模型 " + info.Model + " 已被策略禁用"}
+	}
+	return nil
+}
+
+func (h *denyModelsHook) AfterResponse(context.Context, *Info, any) (any, error) {
+	return nil, nil
+}
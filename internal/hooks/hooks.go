@@ -0,0 +1,98 @@
+// Package hooks 提供请求扩展点：在转换后的 vertex.Request 发往上游前、以及响应写回客户端前调用已注册的钩子，
+// 用于自定义策略（审计、拦截、改写）而无需修改各协议的转换代码。
+//
+// 钩子来源有两种：
+//   - 编译期插件：在带 build tag 的文件中通过 init() 调用 Register（参见 example_plugin.go）；
+//   - Webhook：设置 HOOK_WEBHOOK_URL 后，每个请求都会同步调用外部 HTTP 服务（参见 webhook.go）。
+package hooks
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sync"
+
+	"anti2api-golang/refactor/internal/config"
+	"anti2api-golang/refactor/internal/logger"
+	"anti2api-golang/refactor/internal/vertex"
+)
+
+// Info 描述当前请求，供钩子判断来源。
+type Info struct {
+	Endpoint string // openai | claude | gemini
+	Model    string
+	Stream   bool
+	Header   http.Header
+}
+
+// Hook 是扩展钩子接口。
+type Hook interface {
+	Name() string
+	// BeforeRequest 在请求发往上游前调用，可原地修改 req；返回错误即拒绝请求（*vertex.APIError 可指定状态码）。
+	BeforeRequest(ctx context.Context, info *Info, req *vertex.Request) error
+	// AfterResponse 在响应写回客户端前调用。非流式请求传入客户端格式的响应体，返回非 nil 值时替换之；
+	// 流式请求传入 *vertex.StreamResult（或 Gemini 透传时的合并响应），内容已发出，仅供观察。
+	AfterResponse(ctx context.Context, info *Info, resp any) (any, error)
+}
+
+var (
+	mu         sync.RWMutex
+	registered []Hook
+	setupOnce  sync.Once
+)
+
+// Register 注册一个钩子，通常在插件文件的 init() 中调用。
+func Register(h Hook) {
+	if h == nil {
+		return
+	}
+	mu.Lock()
+	registered = append(registered, h)
+	mu.Unlock()
+}
+
+func active() []Hook {
+	setupOnce.Do(func() {
+		if url := config.Get().HookWebhookURL; url != "" {
+			Register(NewWebhook(url))
+			logger.Info("已启用请求钩子 Webhook: %s", url)
+		}
+	})
+	mu.RLock()
+	defer mu.RUnlock()
+	return registered
+}
+
+// Enabled 报告是否存在任何已注册的钩子。
+func Enabled() bool {
+	return len(active()) > 0
+}
+
+// BeforeRequest 依次调用所有钩子；任一钩子返回错误时停止并返回 *vertex.APIError（默认 403）。
+func BeforeRequest(ctx context.Context, info *Info, req *vertex.Request) *vertex.APIError {
+	for _, h := range active() {
+		if err := h.BeforeRequest(ctx, info, req); err != nil {
+			var apiErr *vertex.APIError
+			if errors.As(err, &apiErr) {
+				return apiErr
+			}
+			return &vertex.APIError{Status: http.StatusForbidden, Message: err.Error()}
+		}
+	}
+	return nil
+}
+
+// AfterResponse 依次调用所有钩子并返回（可能被替换的）响应；钩子出错时记录日志并保留当前响应。
+func AfterResponse(ctx context.Context, info *Info, resp any) any {
+	for _, h := range active() {
+		out, err := h.AfterResponse(ctx, info, resp)
+		if err != nil {
+			logger.Warn("钩子 %s 处理响应失败: %v", h.Name(), err)
+			continue
+		}
+		if out != nil {
+			resp = out
+		}
+	}
+	return resp
+}
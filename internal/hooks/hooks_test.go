@@ -0,0 +1,144 @@
+package hooks
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"anti2api-golang/refactor/internal/vertex"
+)
+
+type funcHook struct {
+	before func(*Info, *vertex.Request) error
+	after  func(any) (any, error)
+}
+
+func (h *funcHook) Name() string { return "func" }
+
+func (h *funcHook) BeforeRequest(_ context.Context, info *Info, req *vertex.Request) error {
+	if h.before == nil {
+		return nil
+	}
+	return h.before(info, req)
+}
+
+func (h *funcHook) AfterResponse(_ context.Context, _ *Info, resp any) (any, error) {
+	if h.after == nil {
+		return nil, nil
+	}
+	return h.after(resp)
+}
+
+func withHooks(t *testing.T, hs ...Hook) {
+	t.Helper()
+	active()
+	mu.Lock()
+	saved := registered
+	registered = hs
+	mu.Unlock()
+	t.Cleanup(func() {
+		mu.Lock()
+		registered = saved
+		mu.Unlock()
+	})
+}
+
+func TestBeforeRequest_ModifiesAndRejects(t *testing.T) {
+	withHooks(t,
+		&funcHook{before: func(_ *Info, req *vertex.Request) error {
+			req.Model = "rewritten"
+			return nil
+		}},
+		&funcHook{before: func(info *Info, _ *vertex.Request) error {
+			if info.Model == "blocked" {
+				return errors.New("not allowed")
+			}
+			return nil
+		}},
+	)
+
+	req := &vertex.Request{Model: "orig"}
+	if apiErr := BeforeRequest(context.Background(), &Info{Model: "ok"}, req); apiErr != nil {
+		t.Fatalf("unexpected rejection: %v", apiErr)
+	}
+	if req.Model != "rewritten" {
+		t.Fatalf("expected hook to modify request, got %q", req.Model)
+	}
+
+	apiErr := BeforeRequest(context.Background(), &Info{Model: "blocked"}, req)
+	if apiErr == nil || apiErr.Status != http.StatusForbidden || apiErr.Message != "not allowed" {
+		t.Fatalf("expected 403 rejection, got %#v", apiErr)
+	}
+}
+
+func TestAfterResponse_ReplacesAndIgnoresErrors(t *testing.T) {
+	withHooks(t,
+		&funcHook{after: func(any) (any, error) { return nil, errors.New("boom") }},
+		&funcHook{after: func(resp any) (any, error) { return resp.(string) + "!", nil }},
+	)
+	if got := AfterResponse(context.Background(), &Info{}, "hi"); got != "hi!" {
+		t.Fatalf("unexpected response %v", got)
+	}
+}
+
+func TestWebhook_RejectAndReplace(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		switch {
+		case r.Header.Get("X-Hook-Phase") == "response":
+			_, _ = io.WriteString(w, `{"response":{"replaced":true}}`)
+		case strings.Contains(string(body), `"model":"deny-me"`):
+			_, _ = io.WriteString(w, `{"reject":{"status":451,"message":"policy"}}`)
+		case strings.Contains(string(body), `"model":"rewrite-me"`):
+			_, _ = io.WriteString(w, `{"request":{"model":"rewritten","request":{"contents":[]}}}`)
+		default:
+			w.WriteHeader(http.StatusNoContent)
+		}
+	}))
+	defer srv.Close()
+
+	h := NewWebhook(srv.URL)
+	ctx := context.Background()
+
+	err := h.BeforeRequest(ctx, &Info{Model: "deny-me"}, &vertex.Request{})
+	var apiErr *vertex.APIError
+	if !errors.As(err, &apiErr) || apiErr.Status != 451 || apiErr.Message != "policy" {
+		t.Fatalf("expected 451 rejection, got %v", err)
+	}
+
+	req := &vertex.Request{Model: "keep"}
+	if err := h.BeforeRequest(ctx, &Info{Model: "pass"}, req); err != nil || req.Model != "keep" {
+		t.Fatalf("expected request to pass unchanged, got %v / %q", err, req.Model)
+	}
+	if err := h.BeforeRequest(ctx, &Info{Model: "rewrite-me"}, req); err != nil || req.Model != "rewritten" {
+		t.Fatalf("expected request to be replaced, got %v / %q", err, req.Model)
+	}
+
+	out, err := h.AfterResponse(ctx, &Info{}, map[string]any{"a": 1})
+	if err != nil || !strings.Contains(string(out.(json.RawMessage)), `"replaced":true`) {
+		t.Fatalf("expected replaced response, got %v / %v", out, err)
+	}
+}
+
+func TestWebhook_FailOpenAndClosed(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer srv.Close()
+
+	h := NewWebhook(srv.URL)
+	if err := h.BeforeRequest(context.Background(), &Info{}, &vertex.Request{}); err != nil {
+		t.Fatalf("expected fail-open, got %v", err)
+	}
+	h.failClosed = true
+	err := h.BeforeRequest(context.Background(), &Info{}, &vertex.Request{})
+	var apiErr *vertex.APIError
+	if !errors.As(err, &apiErr) || apiErr.Status != http.StatusServiceUnavailable {
+		t.Fatalf("expected 503 when fail-closed, got %v", err)
+	}
+}
@@ -0,0 +1,141 @@
+package hooks
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"anti2api-golang/refactor/internal/config"
+	"anti2api-golang/refactor/internal/logger"
+	jsonpkg "anti2api-golang/refactor/internal/pkg/json"
+	"anti2api-golang/refactor/internal/vertex"
+)
+
+// Webhook 将钩子调用转发到外部 HTTP 服务。
+//
+// 请求：POST JSON {"phase":"request"|"response","endpoint","model","stream","request"|"response"}。
+// 响应：2xx 且 body 为空表示不做修改；否则可返回
+//
+//	{"request": {...}}                          替换发往上游的 vertex 请求（仅 request 阶段）
+//	{"response": {...}}                         替换返回给客户端的响应（仅非流式 response 阶段）
+//	{"reject": {"status": 403, "message": ""}}  拒绝请求（仅 request 阶段）
+//
+// Webhook 不可用时默认放行并告警；HOOK_WEBHOOK_FAIL_CLOSED=true 时改为拒绝（503）。
+type Webhook struct {
+	url        string
+	client     *http.Client
+	failClosed bool
+}
+
+type webhookPayload struct {
+	Phase    string `json:"phase"`
+	Endpoint string `json:"endpoint"`
+	Model    string `json:"model"`
+	Stream   bool   `json:"stream"`
+	Request  any    `json:"request,omitempty"`
+	Response any    `json:"response,omitempty"`
+}
+
+type webhookReply struct {
+	Request  json.RawMessage `json:"request,omitempty"`
+	Response json.RawMessage `json:"response,omitempty"`
+	Reject   *struct {
+		Status  int    `json:"status"`
+		Message string `json:"message"`
+	} `json:"reject,omitempty"`
+}
+
+func NewWebhook(url string) *Webhook {
+	cfg := config.Get()
+	timeout := time.Duration(cfg.HookWebhookTimeoutMs) * time.Millisecond
+	if timeout <= 0 {
+		timeout = 5 * time.Second
+	}
+	return &Webhook{
+		url:        url,
+		client:     &http.Client{Timeout: timeout},
+		failClosed: cfg.HookWebhookFailClosed,
+	}
+}
+
+func (h *Webhook) Name() string { return "webhook" }
+
+func (h *Webhook) BeforeRequest(ctx context.Context, info *Info, req *vertex.Request) error {
+	reply, err := h.call(ctx, webhookPayload{Phase: "request", Endpoint: info.Endpoint, Model: info.Model, Stream: info.Stream, Request: req})
+	if err != nil {
+		if h.failClosed {
+			return &vertex.APIError{Status: http.StatusServiceUnavailable, Message: "请求钩子不可用: " + err.Error()}
+		}
+		logger.Warn("请求钩子 Webhook 调用失败，已放行: %v", err)
+		return nil
+	}
+	if reply == nil {
+		return nil
+	}
+	if reply.Reject != nil {
+		status := reply.Reject.Status
+		if status < 400 || status > 599 {
+			status = http.StatusForbidden
+		}
+		msg := reply.Reject.Message
+		if msg == "" {
+			msg = "请求被策略钩子拒绝"
+		}
+		return &vertex.APIError{Status: status, Message: msg}
+	}
+	if len(reply.Request) > 0 {
+		var replaced vertex.Request
+		if err := jsonpkg.Unmarshal(reply.Request, &replaced); err != nil {
+			return fmt.Errorf("请求钩子返回的 request 无效: %w", err)
+		}
+		*req = replaced
+	}
+	return nil
+}
+
+func (h *Webhook) AfterResponse(ctx context.Context, info *Info, resp any) (any, error) {
+	reply, err := h.call(ctx, webhookPayload{Phase: "response", Endpoint: info.Endpoint, Model: info.Model, Stream: info.Stream, Response: resp})
+	if err != nil || reply == nil || len(reply.Response) == 0 {
+		return nil, err
+	}
+	return reply.Response, nil
+}
+
+func (h *Webhook) call(ctx context.Context, payload webhookPayload) (*webhookReply, error) {
+	body, err := jsonpkg.Marshal(payload)
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, h.url, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Hook-Phase", payload.Phase)
+
+	resp, err := h.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	respBody, err := io.ReadAll(io.LimitReader(resp.Body, 32<<20))
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return nil, fmt.Errorf("HTTP %d: %s", resp.StatusCode, bytes.TrimSpace(respBody))
+	}
+	if len(bytes.TrimSpace(respBody)) == 0 {
+		return nil, nil
+	}
+	var reply webhookReply
+	if err := jsonpkg.Unmarshal(respBody, &reply); err != nil {
+		return nil, fmt.Errorf("无法解析钩子响应: %w", err)
+	}
+	return &reply, nil
+}
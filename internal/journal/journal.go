@@ -0,0 +1,204 @@
+// Package journal 以追加写 JSONL 的方式记录每个请求的开始与结束（模型、账号、状态）。
+//
+// 与会话记录（transcript）不同，journal 不保存请求/响应正文，每个事件都会立即写入文件，
+// 因此进程崩溃或被 OOM 终止后仍能看到最后正在处理的请求。启动时会检查上一次运行中
+// 有开始但没有结束的请求并输出告警。
+package journal
+
+import (
+	"bufio"
+	"bytes"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"anti2api-golang/refactor/internal/config"
+	"anti2api-golang/refactor/internal/logger"
+	jsonpkg "anti2api-golang/refactor/internal/pkg/json"
+)
+
+const (
+	EventBoot    = "boot"
+	EventStart   = "start"
+	EventAccount = "account"
+	EventEnd     = "end"
+
+	fileName = "requests.jsonl"
+)
+
+// Event 是 journal 中的一行。
+type Event struct {
+	Time       time.Time `json:"t"`
+	Event      string    `json:"ev"`
+	PID        int       `json:"pid,omitempty"`
+	ID         string    `json:"id,omitempty"`
+	Endpoint   string    `json:"endpoint,omitempty"`
+	Model      string    `json:"model,omitempty"`
+	Stream     bool      `json:"stream,omitempty"`
+	Account    string    `json:"account,omitempty"`
+	Status     int       `json:"status,omitempty"`
+	Error      string    `json:"error,omitempty"`
+	DurationMs int64     `json:"durationMs,omitempty"`
+}
+
+var mu sync.Mutex
+
+// Enabled 报告是否开启了请求日志（JOURNAL_ENABLED）。
+func Enabled() bool {
+	return config.Get().JournalEnabled
+}
+
+// Path 返回当前 journal 文件路径。
+func Path() string {
+	return filepath.Join(config.Get().DataDir, "journal", fileName)
+}
+
+// Boot 在进程启动时调用：报告上一次运行中未结束的请求，并写入 boot 事件。
+func Boot() {
+	if !Enabled() {
+		return
+	}
+	if unfinished := Unfinished(); len(unfinished) > 0 {
+		logger.Warn("上次运行中有 %d 个请求未正常结束（可能发生了崩溃或 OOM），详见 %s", len(unfinished), Path())
+		for i, e := range unfinished {
+			if i >= 10 {
+				break
+			}
+			logger.Warn("  未结束的请求: %s %s model=%s stream=%v account=%s 开始于 %s",
+				e.ID, e.Endpoint, e.Model, e.Stream, e.Account, e.Time.Format(time.RFC3339))
+		}
+	}
+	write(Event{Event: EventBoot, PID: os.Getpid()})
+}
+
+// Start 记录请求开始。
+func Start(id, endpoint, model string, stream bool) {
+	if !Enabled() {
+		return
+	}
+	write(Event{Event: EventStart, ID: id, Endpoint: endpoint, Model: model, Stream: stream})
+}
+
+// Account 记录请求选中的账号（每次轮换账号都会记录一行）。
+func Account(id, account string) {
+	if !Enabled() {
+		return
+	}
+	write(Event{Event: EventAccount, ID: id, Account: account})
+}
+
+// End 记录请求结束。
+func End(id, model string, status int, errMsg string, duration time.Duration) {
+	if !Enabled() {
+		return
+	}
+	write(Event{Event: EventEnd, ID: id, Model: model, Status: status, Error: errMsg, DurationMs: duration.Milliseconds()})
+}
+
+// write 追加一条事件；数据目录只读时直接丢弃，避免每个事件都因写入失败而告警。
+func write(e Event) {
+	if config.DataDirReadOnly() {
+		return
+	}
+	if e.Time.IsZero() {
+		e.Time = time.Now()
+	}
+	line, err := jsonpkg.Marshal(e)
+	if err != nil {
+		return
+	}
+	line = append(line, '\n')
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	path := Path()
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		logger.Warn("创建请求日志目录失败: %v", err)
+		return
+	}
+	if maxBytes := int64(config.Get().JournalMaxBytes); maxBytes > 0 {
+		if fi, err := os.Stat(path); err == nil && fi.Size()+int64(len(line)) > maxBytes {
+			_ = os.Rename(path, path+".1")
+		}
+	}
+	// 每个事件单独打开并追加写入，保证崩溃前的事件已交给操作系统。
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		logger.Warn("写入请求日志失败: %v", err)
+		return
+	}
+	_, _ = f.Write(line)
+	_ = f.Close()
+}
+
+// Unfinished 返回最近一次 boot 之后有 start 但没有 end 的请求（账号取最后一次 account 事件）。
+// 在 Boot 写入新的 boot 事件之前调用，即为上一次运行中未结束的请求。
+func Unfinished() []Event {
+	events := readEvents()
+	last := 0
+	for i, e := range events {
+		if e.Event == EventBoot {
+			last = i + 1
+		}
+	}
+
+	open := make(map[string]int)
+	var starts []Event
+	for _, e := range events[last:] {
+		switch e.Event {
+		case EventStart:
+			open[e.ID] = len(starts)
+			starts = append(starts, e)
+		case EventAccount:
+			if i, ok := open[e.ID]; ok {
+				starts[i].Account = e.Account
+			}
+		case EventEnd:
+			if i, ok := open[e.ID]; ok {
+				starts[i].ID = ""
+				delete(open, e.ID)
+			}
+		}
+	}
+	out := make([]Event, 0, len(open))
+	for _, e := range starts {
+		if e.ID != "" {
+			out = append(out, e)
+		}
+	}
+	return out
+}
+
+// Tail 返回最近的 n 个事件（按时间顺序）。
+func Tail(n int) []Event {
+	events := readEvents()
+	if n > 0 && len(events) > n {
+		events = events[len(events)-n:]
+	}
+	return events
+}
+
+func readEvents() []Event {
+	mu.Lock()
+	defer mu.Unlock()
+
+	path := Path()
+	var events []Event
+	for _, p := range []string{path + ".1", path} {
+		data, err := os.ReadFile(p)
+		if err != nil {
+			continue
+		}
+		sc := bufio.NewScanner(bytes.NewReader(data))
+		sc.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+		for sc.Scan() {
+			var e Event
+			if jsonpkg.Unmarshal(sc.Bytes(), &e) == nil {
+				events = append(events, e)
+			}
+		}
+	}
+	return events
+}
@@ -0,0 +1,59 @@
+package journal
+
+import (
+	"os"
+	"testing"
+	"time"
+
+	"anti2api-golang/refactor/internal/config"
+)
+
+func withJournal(t *testing.T, maxBytes int) {
+	t.Helper()
+	c := config.Get()
+	oldDir, oldEnabled, oldMax := c.DataDir, c.JournalEnabled, c.JournalMaxBytes
+	c.DataDir, c.JournalEnabled, c.JournalMaxBytes = t.TempDir(), true, maxBytes
+	t.Cleanup(func() { c.DataDir, c.JournalEnabled, c.JournalMaxBytes = oldDir, oldEnabled, oldMax })
+}
+
+func TestUnfinished_SinceLastBoot(t *testing.T) {
+	withJournal(t, 0)
+
+	Start("old", "openai", "m", false)
+	Boot()
+	Start("a", "openai", "gemini-2.5-flash", true)
+	Account("a", "a@example.com")
+	Start("b", "claude", "claude-sonnet-4-5", false)
+	End("b", "claude-sonnet-4-5", 200, "", time.Second)
+
+	got := Unfinished()
+	if len(got) != 1 || got[0].ID != "a" || got[0].Account != "a@example.com" || !got[0].Stream {
+		t.Fatalf("unexpected unfinished requests: %#v", got)
+	}
+
+	Boot()
+	if got := Unfinished(); len(got) != 0 {
+		t.Fatalf("expected no unfinished requests after boot, got %#v", got)
+	}
+}
+
+func TestWrite_Rotates(t *testing.T) {
+	withJournal(t, 300)
+
+	for i := 0; i < 10; i++ {
+		Start("r", "openai", "gemini-2.5-flash", false)
+	}
+	fi, err := os.Stat(Path())
+	if err != nil {
+		t.Fatalf("stat journal: %v", err)
+	}
+	if fi.Size() > 300 {
+		t.Fatalf("expected journal to stay under max bytes, got %d", fi.Size())
+	}
+	if _, err := os.Stat(Path() + ".1"); err != nil {
+		t.Fatalf("expected rotated journal: %v", err)
+	}
+	if n := len(Tail(3)); n != 3 {
+		t.Fatalf("expected 3 tail events, got %d", n)
+	}
+}
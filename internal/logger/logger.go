@@ -6,7 +6,9 @@ import (
 	"encoding/json"
 	"fmt"
 	"net/http"
+	"net/url"
 	"os"
+	"slices"
 	"strings"
 	"time"
 )
@@ -138,7 +140,7 @@ func BackendRequest(method, url string, rawJSON []byte) {
 		return
 	}
 	fmt.Printf("%s====================== 后端请求 ========================%s\n", ColorYellow, ColorReset)
-	fmt.Printf("%s[后端请求]%s %s%s%s %s\n", ColorYellow, ColorReset, ColorCyan, method, ColorReset, url)
+	fmt.Printf("%s[后端请求]%s %s%s%s %s\n", ColorYellow, ColorReset, ColorCyan, method, ColorReset, RedactQuery(url))
 	if len(rawJSON) > 0 {
 		fmt.Println(formatRawJSON(rawJSON))
 	}
@@ -150,7 +152,7 @@ func ClientRequestWithHeaders(method, path string, headers http.Header, rawJSON
 		return
 	}
 	fmt.Printf("%s===================== 客户端请求 ======================%s\n", ColorPurple, ColorReset)
-	fmt.Printf("%s[客户端请求]%s %s%s%s %s\n", ColorPurple, ColorReset, ColorCyan, method, ColorReset, path)
+	fmt.Printf("%s[客户端请求]%s %s%s%s %s\n", ColorPurple, ColorReset, ColorCyan, method, ColorReset, RedactQuery(path))
 	if headers != nil {
 		fmt.Printf("%s[客户端请求头]%s\n", ColorPurple, ColorReset)
 		printJSON(redactHeaders(headers))
@@ -166,7 +168,7 @@ func BackendRequestWithHeaders(method, url string, headers http.Header, rawJSON
 		return
 	}
 	fmt.Printf("%s====================== 后端请求 ========================%s\n", ColorYellow, ColorReset)
-	fmt.Printf("%s[后端请求]%s %s%s%s %s\n", ColorYellow, ColorReset, ColorCyan, method, ColorReset, url)
+	fmt.Printf("%s[后端请求]%s %s%s%s %s\n", ColorYellow, ColorReset, ColorCyan, method, ColorReset, RedactQuery(url))
 	if headers != nil {
 		fmt.Printf("%s[后端请求头]%s\n", ColorYellow, ColorReset)
 		printJSON(redactHeaders(headers))
@@ -185,11 +187,37 @@ func redactHeaders(h http.Header) http.Header {
 			out[k] = []string{"Bearer ***"}
 			continue
 		}
+		if kl == "x-api-key" || kl == "x-goog-api-key" {
+			out[k] = []string{"***"}
+			continue
+		}
 		out[k] = append([]string(nil), v...)
 	}
 	return out
 }
 
+// RedactQuery 将 uri（路径加可选的查询串）中 LOG_REDACT_PARAMS 列出的查询参数值替换为 ***（参数名不区分大小写），
+// 其余部分与参数顺序保持不变。
+func RedactQuery(uri string) string {
+	path, query, ok := strings.Cut(uri, "?")
+	names := config.Get().LogRedactParams
+	if !ok || query == "" || len(names) == 0 {
+		return uri
+	}
+	pairs := strings.Split(query, "&")
+	for i, pair := range pairs {
+		rawName, _, _ := strings.Cut(pair, "=")
+		name := rawName
+		if unescaped, err := url.QueryUnescape(rawName); err == nil {
+			name = unescaped
+		}
+		if slices.Contains(names, strings.ToLower(name)) {
+			pairs[i] = rawName + "=***"
+		}
+	}
+	return path + "?" + strings.Join(pairs, "&")
+}
+
 func BackendResponse(status int, duration time.Duration, body any) {
 	if currentLogLevel < LogHigh {
 		return
@@ -249,7 +277,7 @@ func Banner(port int, endpointMode string) {
 	Info("Endpoint mode: %s", endpointMode)
 	Info("Debug level: %s", config.Get().Debug)
 
-	if os.Getenv("API_KEY") == "" {
+	if os.Getenv("API_KEY") == "" && os.Getenv("API_KEYS") == "" && os.Getenv("HMAC_SECRET") == "" {
 		Warn("API_KEY not set - API authentication disabled")
 	}
 
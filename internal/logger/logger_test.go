@@ -1,9 +1,12 @@
 package logger
 
 import (
+	"net/http"
 	"reflect"
 	"strings"
 	"testing"
+
+	"anti2api-golang/refactor/internal/config"
 )
 
 func TestSanitizeJSONForLogContext_NoSanitizationReturnsOriginalMap(t *testing.T) {
@@ -88,3 +91,30 @@ func TestSanitizeJSONForLogContext_MarkdownDataURLTruncates(t *testing.T) {
 		t.Fatalf("expected markdown suffix preserved, got: %q", truncated)
 	}
 }
+
+func TestRedactQuery(t *testing.T) {
+	c := config.Get()
+	old := c.LogRedactParams
+	c.LogRedactParams = []string{"key", "api_key"}
+	t.Cleanup(func() { c.LogRedactParams = old })
+
+	cases := map[string]string{
+		"/v1beta/models": "/v1beta/models",
+		"/v1beta/models/x:streamGenerateContent?alt=sse&key=AIza123": "/v1beta/models/x:streamGenerateContent?alt=sse&key=***",
+		"/v1/models?KEY=abc&Api%5Fkey=def&keys=ok":                   "/v1/models?KEY=***&Api%5Fkey=***&keys=ok",
+		"https://example.com/v1?key":                                 "https://example.com/v1?key=***",
+	}
+	for in, want := range cases {
+		if got := RedactQuery(in); got != want {
+			t.Errorf("RedactQuery(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
+
+func TestRedactHeaders_HidesAPIKeys(t *testing.T) {
+	h := http.Header{"X-Api-Key": {"sk-secret"}, "X-Goog-Api-Key": {"AIza"}, "Content-Type": {"application/json"}}
+	got := redactHeaders(h)
+	if got.Get("X-Api-Key") != "***" || got.Get("X-Goog-Api-Key") != "***" || got.Get("Content-Type") != "application/json" {
+		t.Fatalf("unexpected headers: %v", got)
+	}
+}
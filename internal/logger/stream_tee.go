@@ -0,0 +1,133 @@
+package logger
+
+import (
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"anti2api-golang/refactor/internal/config"
+)
+
+const streamTeeTruncatedMarker = "\n# stream tee truncated: STREAM_TEE_MAX_BYTES reached\n"
+
+var streamTeeMu sync.Mutex
+
+// IsStreamTeeEnabled 报告是否需要把上游原始 SSE 字节落盘（DEBUG=high 且 STREAM_TEE_ENABLED=true，数据目录只读时不落盘）。
+func IsStreamTeeEnabled() bool {
+	return currentLogLevel >= LogHigh && config.Get().StreamTeeEnabled && !config.DataDirReadOnly()
+}
+
+// TeeStreamBody 将 body 包装为边读边写入 data/stream_tee/<时间>-<requestID>.sse 的 ReadCloser，
+// 便于事后分析偶发的异常分片。单个文件超过 STREAM_TEE_MAX_BYTES（<=0 表示不限制）后停止写入，
+// 目录中只保留最新的 STREAM_TEE_MAX_FILES 个文件。未开启或创建文件失败时原样返回 body。
+func TeeStreamBody(body io.ReadCloser, requestID string) io.ReadCloser {
+	if !IsStreamTeeEnabled() {
+		return body
+	}
+	cfg := config.Get()
+	f, err := openStreamTeeFile(filepath.Join(cfg.DataDir, "stream_tee"), requestID, cfg.StreamTeeMaxFiles)
+	if err != nil {
+		Warn("创建流式原始数据文件失败: %v", err)
+		return body
+	}
+	Debug("流式原始数据写入 %s", f.Name())
+	remaining := int64(cfg.StreamTeeMaxBytes)
+	if remaining <= 0 {
+		remaining = math.MaxInt64
+	}
+	return &streamTee{body: body, f: f, remaining: remaining}
+}
+
+func openStreamTeeFile(dir, requestID string, maxFiles int) (*os.File, error) {
+	streamTeeMu.Lock()
+	defer streamTeeMu.Unlock()
+
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	if maxFiles > 0 {
+		pruneStreamTeeFiles(dir, maxFiles-1)
+	}
+	name := time.Now().Format("20060102-150405.000000") + "-" + sanitizeFileName(requestID) + ".sse"
+	return os.OpenFile(filepath.Join(dir, name), os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0o644)
+}
+
+// pruneStreamTeeFiles 删除最旧的文件，使目录中最多保留 keep 个 .sse 文件（文件名以时间开头，按名称排序即按时间排序）。
+func pruneStreamTeeFiles(dir string, keep int) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return
+	}
+	var names []string
+	for _, de := range entries {
+		if !de.IsDir() && strings.HasSuffix(de.Name(), ".sse") {
+			names = append(names, de.Name())
+		}
+	}
+	if len(names) <= keep {
+		return
+	}
+	sort.Strings(names)
+	for _, name := range names[:len(names)-keep] {
+		_ = os.Remove(filepath.Join(dir, name))
+	}
+}
+
+func sanitizeFileName(s string) string {
+	var b strings.Builder
+	for _, r := range s {
+		if (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z') || (r >= '0' && r <= '9') || r == '-' || r == '_' {
+			b.WriteRune(r)
+		}
+		if b.Len() >= 64 {
+			break
+		}
+	}
+	if b.Len() == 0 {
+		return "stream"
+	}
+	return b.String()
+}
+
+type streamTee struct {
+	body      io.ReadCloser
+	f         *os.File
+	remaining int64
+}
+
+func (t *streamTee) Read(p []byte) (int, error) {
+	n, err := t.body.Read(p)
+	if n > 0 && t.f != nil {
+		w := min(int64(n), t.remaining)
+		if w > 0 {
+			if _, werr := t.f.Write(p[:w]); werr != nil {
+				Warn("写入流式原始数据失败: %v", werr)
+				t.closeFile()
+				return n, err
+			}
+			t.remaining -= w
+		}
+		if int64(n) > w {
+			_, _ = io.WriteString(t.f, streamTeeTruncatedMarker)
+			t.closeFile()
+		}
+	}
+	return n, err
+}
+
+func (t *streamTee) Close() error {
+	t.closeFile()
+	return t.body.Close()
+}
+
+func (t *streamTee) closeFile() {
+	if t.f != nil {
+		_ = t.f.Close()
+		t.f = nil
+	}
+}
@@ -0,0 +1,58 @@
+package logger
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestStreamTee_CapsFileSize(t *testing.T) {
+	dir := t.TempDir()
+	f, err := openStreamTeeFile(dir, "req/1", 10)
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	tee := &streamTee{body: io.NopCloser(strings.NewReader("data: 0123456789\n\n")), f: f, remaining: 8}
+
+	got, err := io.ReadAll(tee)
+	if err != nil {
+		t.Fatalf("read: %v", err)
+	}
+	if string(got) != "data: 0123456789\n\n" {
+		t.Fatalf("tee must not alter the stream, got %q", got)
+	}
+	_ = tee.Close()
+
+	if !strings.HasSuffix(f.Name(), "-req1.sse") {
+		t.Fatalf("unexpected file name %s", f.Name())
+	}
+	written, err := os.ReadFile(f.Name())
+	if err != nil {
+		t.Fatalf("read file: %v", err)
+	}
+	if string(written) != "data: 01"+streamTeeTruncatedMarker {
+		t.Fatalf("unexpected tee content %q", written)
+	}
+}
+
+func TestPruneStreamTeeFiles(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"20260101-000000.000001-a.sse", "20260101-000000.000002-b.sse", "20260101-000000.000003-c.sse", "notes.txt"} {
+		if err := os.WriteFile(filepath.Join(dir, name), nil, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	pruneStreamTeeFiles(dir, 1)
+
+	entries, _ := os.ReadDir(dir)
+	var names []string
+	for _, de := range entries {
+		names = append(names, de.Name())
+	}
+	if strings.Join(names, ",") != "20260101-000000.000003-c.sse,notes.txt" {
+		t.Fatalf("unexpected files after prune: %v", names)
+	}
+}
@@ -0,0 +1,30 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+
+	"anti2api-golang/refactor/internal/config"
+)
+
+type apiKeyContextKey struct{}
+
+// withAPIKey 记录通过校验的客户端 API Key，供下游按 key 查找预设（见 API_KEY_PRESETS）。
+func withAPIKey(r *http.Request, key string) *http.Request {
+	return r.WithContext(context.WithValue(r.Context(), apiKeyContextKey{}, key))
+}
+
+// APIKeyFromContext 返回当前请求通过校验的 API Key；未启用认证或使用 HMAC_SECRET 签名（未带 X-Signature-Key）时返回空字符串。
+func APIKeyFromContext(ctx context.Context) string {
+	key, _ := ctx.Value(apiKeyContextKey{}).(string)
+	return key
+}
+
+// TenantFromContext 返回当前请求所属的租户（见 TENANTS）；未配置或 API Key 不在列表中时返回空字符串（默认租户）。
+func TenantFromContext(ctx context.Context) string {
+	key := APIKeyFromContext(ctx)
+	if key == "" {
+		return ""
+	}
+	return config.Get().Tenants[key]
+}
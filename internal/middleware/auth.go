@@ -1,8 +1,10 @@
 package middleware
 
 import (
+	"errors"
 	"net/http"
 	"strings"
+	"time"
 
 	"anti2api-golang/refactor/internal/config"
 	jsonpkg "anti2api-golang/refactor/internal/pkg/json"
@@ -10,23 +12,60 @@ import (
 
 func Auth(next http.Handler) http.Handler {
 	cfg := config.Get()
-	if cfg.APIKey == "" {
-		return next
-	}
 
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// API_KEY 可能在运行时通过初始化页面或系统设置修改，因此每次请求时读取。
+		if cfg.APIKey == "" && len(cfg.APIKeyScopes) == 0 && cfg.HMACSecret == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+
 // Keep health endpoint accessible for liveness checks.
-		if r.URL.Path == "/health" {
+		// OpenAPI 描述同样公开，便于 API 网关在配置鉴权前导入。
+		if r.URL.Path == "/health" || r.URL.Path == "/openapi.json" {
+			next.ServeHTTP(w, r)
+			return
+		}
+		// 状态页只含整体可用性，开启 STATUS_PAGE 时供没有 API Key 的用户查看。
+		if r.URL.Path == "/status" && cfg.StatusPage {
 			next.ServeHTTP(w, r)
 			return
 		}
         
         // Allow Manager UI and Login (handled by separate auth)
-        if r.URL.Path == "/" || strings.HasPrefix(r.URL.Path, "/login") || strings.HasPrefix(r.URL.Path, "/manager") {
+        if r.URL.Path == "/" || strings.HasPrefix(r.URL.Path, "/login") || r.URL.Path == "/setup" || strings.HasPrefix(r.URL.Path, "/static/") || strings.HasPrefix(r.URL.Path, "/manager") {
             next.ServeHTTP(w, r)
             return
         }
 
+		// 携带签名头时按 HMAC 签名校验（不再检查 API Key 请求头）：带 X-Signature-Key 时以 HMAC_KEY_IDS 中对应的 API Key
+		// 为签名密钥，并按该 Key 的接口族、租户与预设处理；否则以 HMAC_SECRET 校验，不限接口族、属于默认租户。
+		if r.Header.Get(SignatureHeader) != "" && (cfg.HMACSecret != "" || len(cfg.HMACKeyIDs) > 0) {
+			secret, key := cfg.HMACSecret, ""
+			if keyID := r.Header.Get(SignatureKeyHeader); keyID != "" {
+				secret, key = cfg.HMACKeyIDs[keyID], cfg.HMACKeyIDs[keyID]
+			}
+			if secret == "" {
+				writeUnauthorized(w, r, errSignatureKey.Error(), "invalid_signature")
+				return
+			}
+			maxSkew := time.Duration(cfg.HMACMaxSkewSeconds) * time.Second
+			if err := verifySignature(r, secret, maxSkew, int64(cfg.HMACMaxBodyBytes), time.Now()); err != nil {
+				if errors.Is(err, errSignatureTooLarge) {
+					writeAuthError(w, r, http.StatusRequestEntityTooLarge, err.Error(), "request_too_large")
+					return
+				}
+				writeUnauthorized(w, r, err.Error(), "invalid_signature")
+				return
+			}
+			if key == "" {
+				next.ServeHTTP(w, r)
+				return
+			}
+			serveAPIKey(w, r, next, key)
+			return
+		}
+
 		key := ""
 		if v := r.Header.Get("x-api-key"); v != "" {
 			key = v
@@ -54,17 +93,36 @@ func Auth(next http.Handler) http.Handler {
 			writeUnauthorized(w, r, "缺少 API_KEY：请在请求头 x-api-key / x-goog-api-key，或 Authorization: Bearer <key> 中提供。", "missing_api_key")
 			return
 		}
-		if key != cfg.APIKey {
-			writeUnauthorized(w, r, "API_KEY 无效或不匹配：请确认客户端传入的 key 与服务端配置的 API_KEY 一致。", "invalid_api_key")
-			return
-		}
-		next.ServeHTTP(w, r)
+		serveAPIKey(w, r, next, key)
 	})
 }
 
+// serveAPIKey 校验 key 是否为 API_KEY 或 API_KEYS 中允许访问当前接口族的 Key，通过后记录 key 并交给 next 处理。
+func serveAPIKey(w http.ResponseWriter, r *http.Request, next http.Handler, key string) {
+	cfg := config.Get()
+	if cfg.APIKey != "" && key == cfg.APIKey {
+		next.ServeHTTP(w, withAPIKey(r, key))
+		return
+	}
+	scopes, ok := cfg.APIKeyScopes[key]
+	if !ok {
+		writeUnauthorized(w, r, "API_KEY 无效或不匹配：请确认客户端传入的 key 与服务端配置的 API_KEY 一致。", "invalid_api_key")
+		return
+	}
+	if !scopeAllows(scopes, endpointFamily(r)) {
+		writeAuthError(w, r, http.StatusForbidden, "该 API Key 无权访问此接口（允许的接口族："+strings.Join(scopes, ", ")+"）。", "insufficient_scope")
+		return
+	}
+	next.ServeHTTP(w, withAPIKey(r, key))
+}
+
 func writeUnauthorized(w http.ResponseWriter, r *http.Request, msg string, code string) {
+	writeAuthError(w, r, http.StatusUnauthorized, msg, code)
+}
+
+func writeAuthError(w http.ResponseWriter, r *http.Request, status int, msg string, code string) {
 	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(http.StatusUnauthorized)
+	w.WriteHeader(status)
 
 	encodedMsg, _ := jsonpkg.MarshalString(msg)
 	encodedCode, _ := jsonpkg.MarshalString(code)
@@ -0,0 +1,64 @@
+package middleware
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"anti2api-golang/refactor/internal/config"
+)
+
+// Decompress 透明解压 Content-Encoding: gzip 的请求体，使下游处理器读取到的是原始 JSON。
+// 解压后超过 MAX_DECOMPRESSED_BODY_BYTES 时返回 413，数据损坏返回 400，不支持的编码返回 415。
+// 位于 Auth 之内：HMAC 签名按客户端实际发送的（压缩后）字节计算。
+func Decompress(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		encoding := strings.ToLower(strings.TrimSpace(r.Header.Get("Content-Encoding")))
+		switch encoding {
+		case "", "identity":
+			next.ServeHTTP(w, r)
+			return
+		case "gzip", "x-gzip":
+		default:
+			writeAuthError(w, r, http.StatusUnsupportedMediaType, "不支持的请求体编码 "+strconv.Quote(encoding)+"：仅支持 gzip。", "unsupported_content_encoding")
+			return
+		}
+
+		body, status, msg := readGzipBody(r.Body, config.Get().MaxGzipBodyBytes)
+		_ = r.Body.Close()
+		if status != 0 {
+			writeAuthError(w, r, status, msg, "invalid_request_body")
+			return
+		}
+		r.Body = io.NopCloser(bytes.NewReader(body))
+		r.ContentLength = int64(len(body))
+		r.Header.Del("Content-Encoding")
+		r.Header.Set("Content-Length", strconv.Itoa(len(body)))
+		next.ServeHTTP(w, r)
+	})
+}
+
+// readGzipBody 解压 gzip 请求体；失败时返回非零的 HTTP 状态码与错误信息。
+func readGzipBody(body io.Reader, limit int) ([]byte, int, string) {
+	zr, err := gzip.NewReader(body)
+	if err != nil {
+		return nil, http.StatusBadRequest, "gzip 请求体解压失败，请检查 Content-Encoding 与请求体是否一致。"
+	}
+	defer zr.Close()
+
+	var reader io.Reader = zr
+	if limit > 0 {
+		reader = io.LimitReader(zr, int64(limit)+1)
+	}
+	data, err := io.ReadAll(reader)
+	if err != nil {
+		return nil, http.StatusBadRequest, "gzip 请求体解压失败，请检查 Content-Encoding 与请求体是否一致。"
+	}
+	if limit > 0 && len(data) > limit {
+		return nil, http.StatusRequestEntityTooLarge, "请求体解压后超过 " + strconv.Itoa(limit) + " 字节上限（MAX_DECOMPRESSED_BODY_BYTES）。"
+	}
+	return data, 0, ""
+}
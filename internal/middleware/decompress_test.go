@@ -0,0 +1,69 @@
+package middleware
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"anti2api-golang/refactor/internal/config"
+)
+
+func gzipBytes(t *testing.T, s string) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	if _, err := zw.Write([]byte(s)); err != nil {
+		t.Fatal(err)
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestDecompress(t *testing.T) {
+	c := config.Get()
+	old := c.MaxGzipBodyBytes
+	c.MaxGzipBodyBytes = 64
+	t.Cleanup(func() { c.MaxGzipBodyBytes = old })
+
+	var got string
+	h := Decompress(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := io.ReadAll(r.Body)
+		got = string(b)
+		if r.Header.Get("Content-Encoding") != "" || r.ContentLength != int64(len(b)) {
+			t.Errorf("headers not updated: encoding=%q length=%d", r.Header.Get("Content-Encoding"), r.ContentLength)
+		}
+	}))
+
+	serve := func(body []byte, encoding string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/v1/chat/completions", bytes.NewReader(body))
+		if encoding != "" {
+			req.Header.Set("Content-Encoding", encoding)
+		}
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		return rec
+	}
+
+	if rec := serve(gzipBytes(t, `{"model":"gemini-2.5-flash"}`), "GZIP"); rec.Code != http.StatusOK || got != `{"model":"gemini-2.5-flash"}` {
+		t.Fatalf("gzip body not decompressed: code=%d body=%q", rec.Code, got)
+	}
+	got = ""
+	if rec := serve([]byte(`{"plain":true}`), ""); rec.Code != http.StatusOK || got != `{"plain":true}` {
+		t.Fatalf("plain body should pass through: code=%d body=%q", rec.Code, got)
+	}
+	if rec := serve(gzipBytes(t, strings.Repeat("a", 65)), "gzip"); rec.Code != http.StatusRequestEntityTooLarge {
+		t.Fatalf("oversized body: code=%d", rec.Code)
+	}
+	if rec := serve([]byte("not gzip"), "gzip"); rec.Code != http.StatusBadRequest {
+		t.Fatalf("corrupt body: code=%d", rec.Code)
+	}
+	if rec := serve([]byte("x"), "br"); rec.Code != http.StatusUnsupportedMediaType {
+		t.Fatalf("unsupported encoding: code=%d", rec.Code)
+	}
+}
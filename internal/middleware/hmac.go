@@ -0,0 +1,135 @@
+package middleware
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"anti2api-golang/refactor/internal/pkg/spool"
+)
+
+// HMAC 请求签名：
+//
+//	X-Signature-Timestamp: <Unix 秒>
+//	X-Signature: hex(HMAC-SHA256(secret, timestamp + "\n" + METHOD + "\n" + RequestURI + "\n" + hex(SHA256(body))))
+//	X-Signature-Key: <key ID>（可选）
+//
+// 不带 X-Signature-Key 时 secret 为 HMAC_SECRET，请求不限接口族并属于默认租户（没有对应的 API Key，也不应用预设）；
+// 带 X-Signature-Key 时 secret 为 HMAC_KEY_IDS 中该 key ID 对应的 API Key，请求按该 Key 的接口族、租户与预设处理。
+// 时间戳与服务器时间相差超过 HMAC_MAX_SKEW_SECONDS 的请求会被拒绝；有效期内同一签名只能使用一次，防止重放。
+const (
+	SignatureHeader          = "X-Signature"
+	SignatureTimestampHeader = "X-Signature-Timestamp"
+	SignatureKeyHeader       = "X-Signature-Key"
+
+	// replayBucketSeconds 为防重放缓存的时间桶宽度：签名按过期时间分桶，整桶过期后一次删除。
+	replayBucketSeconds = 10
+)
+
+var (
+	errSignatureTimestamp = errors.New("签名时间戳无效或已过期：请使用当前 Unix 时间（秒），并校准客户端时钟。")
+	errSignatureMismatch  = errors.New("请求签名无效：请确认签名密钥与签名内容（时间戳、方法、路径、请求体哈希）。")
+	errSignatureReplay    = errors.New("请求签名已被使用：每个签名只能使用一次。")
+	errSignatureBody      = errors.New("读取请求体失败，无法校验签名。")
+	errSignatureTooLarge  = errors.New("请求体超过 HMAC_MAX_BODY_BYTES，拒绝校验签名。")
+	errSignatureKey       = errors.New("签名 key ID 无效：X-Signature-Key 必须是 HMAC_KEY_IDS 中配置的 key ID。")
+)
+
+// SignRequest 计算请求签名，供客户端与测试使用。
+func SignRequest(secret string, timestamp int64, method, requestURI string, body []byte) string {
+	bodySum := sha256.Sum256(body)
+	return signBodyHash(secret, timestamp, method, requestURI, bodySum[:])
+}
+
+func signBodyHash(secret string, timestamp int64, method, requestURI string, bodySum []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(strconv.FormatInt(timestamp, 10) + "\n" + method + "\n" + requestURI + "\n" + hex.EncodeToString(bodySum)))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// replayCache 记录有效期内已使用的签名。签名的过期时间由签名中的时间戳决定（见 verifySignature），
+// 因此同一签名总是落在同一个桶中；只有通过 MAC 校验的签名才会被记录，每次记录时删除已整体过期的桶。
+type replayCache struct {
+	mu      sync.Mutex
+	buckets map[int64]map[string]struct{}
+}
+
+var signatureReplays = &replayCache{buckets: make(map[int64]map[string]struct{})}
+
+// remember 记录签名直到 expires；签名已存在且未过期时返回 false。
+func (c *replayCache) remember(sig string, expires, now time.Time) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for b := range c.buckets {
+		if (b+1)*replayBucketSeconds <= now.Unix() {
+			delete(c.buckets, b)
+		}
+	}
+	b := expires.Unix() / replayBucketSeconds
+	set := c.buckets[b]
+	if set == nil {
+		set = make(map[string]struct{})
+		c.buckets[b] = set
+	}
+	if _, ok := set[sig]; ok {
+		return false
+	}
+	set[sig] = struct{}{}
+	return true
+}
+
+// verifySignature 校验 HMAC 签名；会读取请求体并替换 r.Body，以便后续处理器继续读取。
+// 请求体在校验签名之前读取，因此超过 maxBody（<=0 表示不限制）时直接拒绝，不再继续读取。
+func verifySignature(r *http.Request, secret string, maxSkew time.Duration, maxBody int64, now time.Time) error {
+	ts, err := strconv.ParseInt(r.Header.Get(SignatureTimestampHeader), 10, 64)
+	if err != nil {
+		return errSignatureTimestamp
+	}
+	if maxSkew <= 0 {
+		maxSkew = 5 * time.Minute
+	}
+	signedAt := time.Unix(ts, 0)
+	if signedAt.Before(now.Add(-maxSkew)) || signedAt.After(now.Add(maxSkew)) {
+		return errSignatureTimestamp
+	}
+
+	// 请求体边读边计算哈希，超过 REQUEST_SPOOL_BYTES 时落盘（见 pkg/spool），处理器读取时直接复用，不再复制。
+	h := sha256.New()
+	if r.Body != nil && r.Body != http.NoBody {
+		if maxBody > 0 {
+			if r.ContentLength > maxBody {
+				return errSignatureTooLarge
+			}
+			r.Body = http.MaxBytesReader(nil, r.Body, maxBody)
+		}
+		body, err := spool.ReadRequestTee(r, h)
+		_ = r.Body.Close()
+		if err != nil {
+			var tooLarge *http.MaxBytesError
+			if errors.As(err, &tooLarge) {
+				return errSignatureTooLarge
+			}
+			return errSignatureBody
+		}
+		r.Body = body.Reader()
+	}
+
+	got, err := hex.DecodeString(r.Header.Get(SignatureHeader))
+	if err != nil {
+		return errSignatureMismatch
+	}
+	want, _ := hex.DecodeString(signBodyHash(secret, ts, r.Method, r.URL.RequestURI(), h.Sum(nil)))
+	if !hmac.Equal(got, want) {
+		return errSignatureMismatch
+	}
+	if !signatureReplays.remember(hex.EncodeToString(got), signedAt.Add(maxSkew), now) {
+		return errSignatureReplay
+	}
+	return nil
+}
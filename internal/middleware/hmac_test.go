@@ -0,0 +1,141 @@
+package middleware
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"anti2api-golang/refactor/internal/config"
+)
+
+func signedRequest(secret string, ts int64, body string) *http.Request {
+	r := httptest.NewRequest(http.MethodPost, "/v1/chat/completions?x=1", strings.NewReader(body))
+	r.Header.Set(SignatureTimestampHeader, strconv.FormatInt(ts, 10))
+	r.Header.Set(SignatureHeader, SignRequest(secret, ts, http.MethodPost, "/v1/chat/completions?x=1", []byte(body)))
+	return r
+}
+
+func TestVerifySignature(t *testing.T) {
+	now := time.Now()
+	body := `{"model":"m"}`
+
+	r := signedRequest("s3cret", now.Unix(), body)
+	if err := verifySignature(r, "s3cret", time.Minute, 0, now); err != nil {
+		t.Fatalf("expected valid signature, got %v", err)
+	}
+	if got, _ := io.ReadAll(r.Body); string(got) != body {
+		t.Fatalf("body must be restored for the handler, got %q", got)
+	}
+
+	if err := verifySignature(signedRequest("s3cret", now.Unix(), body), "s3cret", time.Minute, 0, now); err != errSignatureReplay {
+		t.Fatalf("expected replay to be rejected, got %v", err)
+	}
+	if err := verifySignature(signedRequest("s3cret", now.Add(-2*time.Minute).Unix(), body), "s3cret", time.Minute, 0, now); err != errSignatureTimestamp {
+		t.Fatalf("expected stale timestamp to be rejected, got %v", err)
+	}
+	if err := verifySignature(signedRequest("other", now.Unix()+1, body), "s3cret", time.Minute, 0, now); err != errSignatureMismatch {
+		t.Fatalf("expected wrong secret to be rejected, got %v", err)
+	}
+
+	tampered := signedRequest("s3cret", now.Unix()+2, body)
+	tampered.Body = io.NopCloser(strings.NewReader(`{"model":"x"}`))
+	if err := verifySignature(tampered, "s3cret", time.Minute, 0, now); err != errSignatureMismatch {
+		t.Fatalf("expected tampered body to be rejected, got %v", err)
+	}
+}
+
+func TestAuth_SignatureKeyID(t *testing.T) {
+	cfg := config.Get()
+	oldKey, oldScopes, oldSecret, oldIDs, oldTenants := cfg.APIKey, cfg.APIKeyScopes, cfg.HMACSecret, cfg.HMACKeyIDs, cfg.Tenants
+	t.Cleanup(func() {
+		cfg.APIKey, cfg.APIKeyScopes, cfg.HMACSecret, cfg.HMACKeyIDs, cfg.Tenants = oldKey, oldScopes, oldSecret, oldIDs, oldTenants
+	})
+	cfg.APIKey, cfg.HMACSecret = "", "master"
+	cfg.APIKeyScopes = map[string][]string{"sk-chat": {ScopeOpenAI}}
+	cfg.HMACKeyIDs = map[string]string{"ci": "sk-chat", "stale": "sk-removed"}
+	cfg.Tenants = map[string]string{"sk-chat": "alice"}
+
+	var gotKey, gotTenant, gotBody string
+	h := Auth(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotKey, gotTenant = APIKeyFromContext(r.Context()), TenantFromContext(r.Context())
+		b, _ := io.ReadAll(r.Body)
+		gotBody = string(b)
+	}))
+	send := func(path, keyID, secret string, ts int64) int {
+		body := `{"model":"m"}`
+		r := httptest.NewRequest(http.MethodPost, path, strings.NewReader(body))
+		r.Header.Set(SignatureTimestampHeader, strconv.FormatInt(ts, 10))
+		r.Header.Set(SignatureHeader, SignRequest(secret, ts, http.MethodPost, path, []byte(body)))
+		if keyID != "" {
+			r.Header.Set(SignatureKeyHeader, keyID)
+		}
+		rr := httptest.NewRecorder()
+		h.ServeHTTP(rr, r)
+		return rr.Code
+	}
+
+	now := time.Now().Unix()
+	if code := send("/v1/chat/completions", "ci", "sk-chat", now); code != http.StatusOK || gotKey != "sk-chat" || gotTenant != "alice" || gotBody != `{"model":"m"}` {
+		t.Fatalf("key ID request: code=%d key=%q tenant=%q body=%q", code, gotKey, gotTenant, gotBody)
+	}
+	if code := send("/v1/messages", "ci", "sk-chat", now+1); code != http.StatusForbidden {
+		t.Fatalf("key ID request must respect the key's scopes, got %d", code)
+	}
+	if code := send("/v1/chat/completions", "ci", "master", now+2); code != http.StatusUnauthorized {
+		t.Fatalf("key ID request signed with HMAC_SECRET must be rejected, got %d", code)
+	}
+	if code := send("/v1/chat/completions", "unknown", "sk-chat", now+3); code != http.StatusUnauthorized {
+		t.Fatalf("unknown key ID must be rejected, got %d", code)
+	}
+	if code := send("/v1/chat/completions", "stale", "sk-removed", now+4); code != http.StatusUnauthorized {
+		t.Fatalf("key ID mapped to an unconfigured API key must be rejected, got %d", code)
+	}
+
+	gotKey, gotTenant = "x", "x"
+	if code := send("/v1/messages", "", "master", now+5); code != http.StatusOK || gotKey != "" || gotTenant != "" {
+		t.Fatalf("HMAC_SECRET request: code=%d key=%q tenant=%q", code, gotKey, gotTenant)
+	}
+}
+
+func TestVerifySignature_BodyLimit(t *testing.T) {
+	now := time.Now()
+	body := strings.Repeat("x", 100)
+
+	r := signedRequest("s3cret", now.Unix()+10, body)
+	if err := verifySignature(r, "s3cret", time.Minute, 64, now); err != errSignatureTooLarge {
+		t.Fatalf("expected oversized body (Content-Length) to be rejected, got %v", err)
+	}
+	r = signedRequest("s3cret", now.Unix()+11, body)
+	r.ContentLength = -1
+	if err := verifySignature(r, "s3cret", time.Minute, 64, now); err != errSignatureTooLarge {
+		t.Fatalf("expected oversized body (chunked) to be rejected, got %v", err)
+	}
+	if err := verifySignature(signedRequest("s3cret", now.Unix()+12, body), "s3cret", time.Minute, 100, now); err != nil {
+		t.Fatalf("body at the limit should be accepted, got %v", err)
+	}
+}
+
+func TestReplayCache_DropsExpiredBuckets(t *testing.T) {
+	c := &replayCache{buckets: make(map[int64]map[string]struct{})}
+	now := time.Unix(1_000_000, 0)
+	for i := 0; i < 100; i++ {
+		if !c.remember(strconv.Itoa(i), now.Add(time.Duration(i)*time.Second), now) {
+			t.Fatalf("signature %d should be new", i)
+		}
+	}
+	if c.remember("5", now.Add(5*time.Second), now) {
+		t.Fatalf("a replayed signature must be rejected")
+	}
+
+	later := now.Add(200 * time.Second)
+	if !c.remember("new", later.Add(time.Minute), later) {
+		t.Fatalf("signature should be new")
+	}
+	if len(c.buckets) != 1 {
+		t.Fatalf("expired buckets should be dropped, %d left", len(c.buckets))
+	}
+}
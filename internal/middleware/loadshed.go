@@ -0,0 +1,225 @@
+package middleware
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync/atomic"
+
+	"anti2api-golang/refactor/internal/config"
+	jsonpkg "anti2api-golang/refactor/internal/pkg/json"
+	"anti2api-golang/refactor/internal/pkg/spool"
+)
+
+// streamPeekBytes 为判断 OpenAI / Claude 请求是否流式时最多读取的请求体前缀长度。
+const streamPeekBytes = 64 << 10
+
+var (
+	inFlightStream    atomic.Int64
+	inFlightNonStream atomic.Int64
+	shedTotal         atomic.Int64
+)
+
+// LoadStats 为生成请求的并发快照。
+type LoadStats struct {
+	Stream    int64 `json:"stream"`
+	NonStream int64 `json:"nonStream"`
+	// Shed 为进程启动以来因超过并发上限被拒绝的请求数。
+	Shed int64 `json:"shed"`
+}
+
+// InFlight 返回当前正在处理的流式 / 非流式生成请求数。
+func InFlight() LoadStats {
+	return LoadStats{Stream: inFlightStream.Load(), NonStream: inFlightNonStream.Load(), Shed: shedTotal.Load()}
+}
+
+// LoadShed 限制同时处理的生成请求数（MAX_INFLIGHT_STREAM / MAX_INFLIGHT_NONSTREAM，流式与非流式分别计数），
+// 超出时直接返回 503 与 Retry-After，避免小内存容器在客户端重试风暴中被 OOM 连锁杀死。
+// 模型列表、管理面板等其他接口不受限制。OpenAI / Claude 需查看请求体中的 stream 字段（只读取有限的前缀，
+// 两类名额都已占满时不读取），因此位于 Decompress 之内。
+func LoadShed(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		cfg := config.Get()
+		if cfg.MaxInFlightStream <= 0 && cfg.MaxInFlightNonStream <= 0 {
+			next.ServeHTTP(w, r)
+			return
+		}
+		if !isGenerationPath(r) {
+			next.ServeHTTP(w, r)
+			return
+		}
+		// 两类名额都已占满时无需区分是否流式，直接拒绝，不读取请求体。
+		if atCap(&inFlightStream, cfg.MaxInFlightStream) && atCap(&inFlightNonStream, cfg.MaxInFlightNonStream) {
+			shed(w, r, cfg.ShedRetryAfterSeconds)
+			return
+		}
+
+		counter, limit := &inFlightNonStream, cfg.MaxInFlightNonStream
+		if isStreamRequest(r) {
+			counter, limit = &inFlightStream, cfg.MaxInFlightStream
+		}
+		n := counter.Add(1)
+		defer counter.Add(-1)
+		if limit > 0 && n > int64(limit) {
+			shed(w, r, cfg.ShedRetryAfterSeconds)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func atCap(counter *atomic.Int64, limit int) bool {
+	return limit > 0 && counter.Load() >= int64(limit)
+}
+
+func shed(w http.ResponseWriter, r *http.Request, retryAfter int) {
+	shedTotal.Add(1)
+	if retryAfter > 0 {
+		w.Header().Set("Retry-After", strconv.Itoa(retryAfter))
+	}
+	writeAuthError(w, r, http.StatusServiceUnavailable, "服务繁忙：同时处理的请求已达上限，请稍后重试。", "overloaded")
+}
+
+// isGenerationPath 判断请求是否为生成类请求（计入并发上限）。
+func isGenerationPath(r *http.Request) bool {
+	if r.Method != http.MethodPost {
+		return false
+	}
+	path := r.URL.Path
+	switch {
+	case strings.HasPrefix(path, "/v1beta/models/"):
+		return strings.HasSuffix(path, ":streamGenerateContent") || strings.HasSuffix(path, ":generateContent")
+	case path == "/v1/chat/completions" || path == "/v1/chat/completions/" || path == "/v1/messages":
+		return true
+	}
+	return false
+}
+
+// isStreamRequest 判断生成请求是否流式：Gemini 由路径区分；OpenAI / Claude 取请求体顶层的 stream 字段。
+// 已由签名校验读入的请求体（spool.Body）直接查看，不复制；其他请求只读取不超过 streamPeekBytes 的前缀，
+// 再与剩余部分拼接放回 r.Body，前缀中找不到 stream 字段时按非流式（两种协议的默认值）计数。
+func isStreamRequest(r *http.Request) bool {
+	path := r.URL.Path
+	if strings.HasPrefix(path, "/v1beta/models/") {
+		return strings.HasSuffix(path, ":streamGenerateContent")
+	}
+	if r.Body == nil || r.Body == http.NoBody {
+		return false
+	}
+	if body, ok := spool.Unread(r.Body); ok {
+		stream, _ := jsonpkg.GetBool(body, "stream")
+		return stream
+	}
+
+	prefix, err := io.ReadAll(io.LimitReader(r.Body, streamPeekBytes))
+	r.Body = prefixedBody{Reader: io.MultiReader(bytes.NewReader(prefix), r.Body), Closer: r.Body}
+	if err != nil {
+		return false
+	}
+	stream, _ := topLevelBool(prefix, "stream")
+	return stream
+}
+
+// prefixedBody 把已读取的前缀与原始请求体拼接，Close 时关闭原始请求体。
+type prefixedBody struct {
+	io.Reader
+	io.Closer
+}
+
+// topLevelBool 在可能被截断的 JSON 对象 data 中查找顶层字段 key 的布尔值；嵌套对象、数组与字符串中的同名内容会被跳过。
+// data 在找到字段之前结束时返回 found=false。
+func topLevelBool(data []byte, key string) (value, found bool) {
+	i := skipSpace(data, 0)
+	if i >= len(data) || data[i] != '{' {
+		return false, false
+	}
+	i++
+	for {
+		i = skipSpace(data, i)
+		if i >= len(data) || data[i] != '"' {
+			return false, false
+		}
+		end := skipString(data, i)
+		if end < 0 {
+			return false, false
+		}
+		name := data[i+1 : end-1]
+		i = skipSpace(data, end)
+		if i >= len(data) || data[i] != ':' {
+			return false, false
+		}
+		i = skipSpace(data, i+1)
+		if string(name) == key {
+			switch {
+			case bytes.HasPrefix(data[i:], []byte("true")):
+				return true, true
+			case bytes.HasPrefix(data[i:], []byte("false")):
+				return false, true
+			}
+			return false, false
+		}
+		if i = skipValue(data, i); i < 0 {
+			return false, false
+		}
+		i = skipSpace(data, i)
+		if i >= len(data) || data[i] != ',' {
+			return false, false
+		}
+		i++
+	}
+}
+
+func skipSpace(data []byte, i int) int {
+	for i < len(data) && (data[i] == ' ' || data[i] == '\t' || data[i] == '\n' || data[i] == '\r') {
+		i++
+	}
+	return i
+}
+
+// skipString 返回从 data[i]（引号）开始的字符串之后的位置；字符串未结束时返回 -1。
+func skipString(data []byte, i int) int {
+	for j := i + 1; j < len(data); j++ {
+		switch data[j] {
+		case '\\':
+			j++
+		case '"':
+			return j + 1
+		}
+	}
+	return -1
+}
+
+// skipValue 返回从 data[i] 开始的 JSON 值之后的位置；值未结束时返回 -1。
+func skipValue(data []byte, i int) int {
+	depth := 0
+	for i < len(data) {
+		switch data[i] {
+		case '"':
+			if i = skipString(data, i); i < 0 {
+				return -1
+			}
+			if depth == 0 {
+				return i
+			}
+			continue
+		case '{', '[':
+			depth++
+		case '}', ']':
+			depth--
+			if depth == 0 {
+				return i + 1
+			}
+			if depth < 0 {
+				return i
+			}
+		case ',':
+			if depth == 0 {
+				return i
+			}
+		}
+		i++
+	}
+	return -1
+}
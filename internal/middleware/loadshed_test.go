@@ -0,0 +1,131 @@
+package middleware
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"anti2api-golang/refactor/internal/config"
+	"anti2api-golang/refactor/internal/pkg/spool"
+)
+
+func TestLoadShed(t *testing.T) {
+	c := config.Get()
+	oldStream, oldNonStream, oldRetry := c.MaxInFlightStream, c.MaxInFlightNonStream, c.ShedRetryAfterSeconds
+	c.MaxInFlightStream, c.MaxInFlightNonStream, c.ShedRetryAfterSeconds = 1, 2, 7
+	t.Cleanup(func() {
+		c.MaxInFlightStream, c.MaxInFlightNonStream, c.ShedRetryAfterSeconds = oldStream, oldNonStream, oldRetry
+	})
+
+	release := make(chan struct{})
+	var entered sync.WaitGroup
+	h := LoadShed(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if b, _ := io.ReadAll(r.Body); strings.Contains(string(b), "hold") || strings.Contains(r.URL.Path, "hold") {
+			entered.Done()
+			<-release
+		}
+	}))
+	serve := func(path, body string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, path, strings.NewReader(body)))
+		return rec
+	}
+
+	// 占满流式名额（1）与非流式名额（2）。
+	var done sync.WaitGroup
+	for _, req := range [][2]string{
+		{"/v1/chat/completions", `{"stream":true,"model":"hold"}`},
+		{"/v1/messages", `{"model":"hold"}`},
+		{"/v1beta/models/hold:generateContent", `{}`},
+	} {
+		entered.Add(1)
+		done.Add(1)
+		go func(path, body string) { defer done.Done(); serve(path, body) }(req[0], req[1])
+	}
+	entered.Wait()
+
+	if got := InFlight(); got.Stream != 1 || got.NonStream != 2 {
+		t.Fatalf("in-flight = %+v", got)
+	}
+	rec := serve("/v1beta/models/gemini-2.5-flash:streamGenerateContent", `{}`)
+	if rec.Code != http.StatusServiceUnavailable || rec.Header().Get("Retry-After") != "7" {
+		t.Fatalf("stream request over the cap: code=%d retry-after=%q", rec.Code, rec.Header().Get("Retry-After"))
+	}
+	if rec := serve("/v1/chat/completions", `{"stream":false,"messages":[{"content":"\"stream\":true"}]}`); rec.Code != http.StatusServiceUnavailable {
+		t.Fatalf("non-stream request over the cap: code=%d", rec.Code)
+	}
+	if rec := serve("/v1/messages/count_tokens", `{}`); rec.Code != http.StatusOK {
+		t.Fatalf("non-generation endpoints must not be limited: code=%d", rec.Code)
+	}
+
+	close(release)
+	done.Wait()
+	if got := InFlight(); got.Stream != 0 || got.NonStream != 0 || got.Shed < 2 {
+		t.Fatalf("after release = %+v", got)
+	}
+	if rec := serve("/v1/messages", `{"stream":true}`); rec.Code != http.StatusOK {
+		t.Fatalf("request after release: code=%d", rec.Code)
+	}
+}
+
+func TestTopLevelBool(t *testing.T) {
+	cases := []struct {
+		in           string
+		value, found bool
+	}{
+		{`{"stream":true}`, true, true},
+		{` { "model" : "m", "stream" : false }`, false, true},
+		{`{"messages":[{"stream":true,"content":"{\"stream\":true}"}],"n":1,"stream":true}`, true, true},
+		{`{"metadata":{"stream":true},"model":"m"}`, false, false},
+		{`{"messages":[{"content":"truncated`, false, false},
+		{`{"stream":"yes"}`, false, false},
+		{`[]`, false, false},
+	}
+	for _, c := range cases {
+		if v, ok := topLevelBool([]byte(c.in), "stream"); v != c.value || ok != c.found {
+			t.Fatalf("%s: got (%v, %v), want (%v, %v)", c.in, v, ok, c.value, c.found)
+		}
+	}
+}
+
+type countingReader struct {
+	r    io.Reader
+	read int
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.read += n
+	return n, err
+}
+
+func TestIsStreamRequest_ReadsBoundedPrefix(t *testing.T) {
+	body := `{"messages":[{"content":"` + strings.Repeat("x", 4*streamPeekBytes) + `"}],"stream":true}`
+	src := &countingReader{r: strings.NewReader(body)}
+	r := httptest.NewRequest(http.MethodPost, "/v1/chat/completions", io.NopCloser(src))
+	if isStreamRequest(r) {
+		t.Fatalf("stream field beyond the peeked prefix should count as non-stream")
+	}
+	if src.read > streamPeekBytes {
+		t.Fatalf("read %d bytes, want at most %d", src.read, streamPeekBytes)
+	}
+	if got, _ := io.ReadAll(r.Body); string(got) != body {
+		t.Fatalf("the full body must still reach the handler (got %d bytes)", len(got))
+	}
+}
+
+func TestIsStreamRequest_KeepsSpooledBody(t *testing.T) {
+	b, err := spool.Read(strings.NewReader(`{"model":"m","stream":true}`), -1, 0, t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := httptest.NewRequest(http.MethodPost, "/v1/messages", nil)
+	r.Body = b.Reader()
+	body := r.Body
+	if !isStreamRequest(r) || r.Body != body {
+		t.Fatalf("spooled body should be inspected in place and passed on unchanged")
+	}
+}
@@ -25,7 +25,7 @@ func Logging(next http.Handler) http.Handler {
 		start := time.Now()
 		sw := &statusWriter{ResponseWriter: w, statusCode: http.StatusOK}
 		next.ServeHTTP(sw, r)
-		logger.Request(r.Method, r.URL.Path, sw.statusCode, time.Since(start))
+		logger.Request(r.Method, logger.RedactQuery(r.URL.RequestURI()), sw.statusCode, time.Since(start))
 	})
 }
 
@@ -0,0 +1,57 @@
+package middleware
+
+import (
+	"net/http"
+	"strings"
+)
+
+// API Key 可限定的接口族（见 API_KEYS）。
+const (
+	ScopeAll      = "*"
+	ScopeOpenAI   = "openai"
+	ScopeClaude   = "claude"
+	ScopeGemini   = "gemini"
+	ScopeModels   = "models"
+	ScopeSessions = "sessions"
+)
+
+// endpointFamily 返回请求所属的接口族；模型列表 / 详情属于只读的 models 族，未知路径返回空字符串（仅不限范围的 key 可访问）。
+func endpointFamily(r *http.Request) string {
+	path := r.URL.Path
+	switch {
+	case path == "/v1/models" || strings.HasPrefix(path, "/v1/models/"):
+		return ScopeModels
+	case path == "/v1beta/models" || strings.HasPrefix(path, "/v1beta/models/"):
+		// Gemini 的生成类接口形如 /v1beta/models/{model}:generateContent，不带 ":" 的是模型列表 / 详情。
+		if (r.Method == http.MethodGet || r.Method == http.MethodHead) && !strings.Contains(path, ":") {
+			return ScopeModels
+		}
+		return ScopeGemini
+	case strings.HasPrefix(path, "/v1beta/"):
+		return ScopeGemini
+	case path == "/v1/chat/completions" || strings.HasPrefix(path, "/v1/chat/completions/"), path == "/v1/moderations":
+		return ScopeOpenAI
+	case path == "/v1/messages" || strings.HasPrefix(path, "/v1/messages/"):
+		return ScopeClaude
+	case path == "/v1/sessions" || strings.HasPrefix(path, "/v1/sessions/"):
+		return ScopeSessions
+	}
+	return ""
+}
+
+// scopeAllows 判断 scopes 是否允许访问 family。生成类接口族隐含 models，便于客户端先拉取模型列表。
+func scopeAllows(scopes []string, family string) bool {
+	for _, s := range scopes {
+		switch {
+		case s == ScopeAll:
+			return true
+		case family == "":
+			continue
+		case s == family:
+			return true
+		case family == ScopeModels && (s == ScopeOpenAI || s == ScopeClaude || s == ScopeGemini):
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,44 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestEndpointFamily(t *testing.T) {
+	cases := []struct {
+		method, path, want string
+	}{
+		{http.MethodGet, "/v1/models", ScopeModels},
+		{http.MethodGet, "/v1/models/gemini-2.5-flash", ScopeModels},
+		{http.MethodGet, "/v1beta/models", ScopeModels},
+		{http.MethodGet, "/v1beta/models/gemini-2.5-flash", ScopeModels},
+		{http.MethodPost, "/v1beta/models/gemini-2.5-flash:generateContent", ScopeGemini},
+		{http.MethodPost, "/v1/chat/completions", ScopeOpenAI},
+		{http.MethodPost, "/v1/moderations", ScopeOpenAI},
+		{http.MethodPost, "/v1/messages/count_tokens", ScopeClaude},
+		{http.MethodDelete, "/v1/sessions/abc", ScopeSessions},
+		{http.MethodGet, "/v1/unknown", ""},
+	}
+	for _, c := range cases {
+		if got := endpointFamily(httptest.NewRequest(c.method, c.path, nil)); got != c.want {
+			t.Fatalf("%s %s: want %q, got %q", c.method, c.path, c.want, got)
+		}
+	}
+}
+
+func TestScopeAllows(t *testing.T) {
+	if !scopeAllows([]string{ScopeOpenAI}, ScopeModels) {
+		t.Fatalf("generation scope should allow listing models")
+	}
+	if scopeAllows([]string{ScopeModels}, ScopeOpenAI) {
+		t.Fatalf("models scope must be read-only")
+	}
+	if scopeAllows([]string{ScopeOpenAI}, ScopeClaude) || scopeAllows([]string{ScopeOpenAI}, "") {
+		t.Fatalf("openai scope must not reach other families")
+	}
+	if !scopeAllows([]string{ScopeAll}, "") {
+		t.Fatalf("* should allow everything")
+	}
+}
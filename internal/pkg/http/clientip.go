@@ -0,0 +1,31 @@
+package http
+
+import (
+	"net"
+	"net/http"
+	"strings"
+
+	"anti2api-golang/refactor/internal/config"
+)
+
+// ClientIP 返回请求方 IP。仅在 TRUST_PROXY_HEADERS=true 时采信代理请求头：取 X-Forwarded-For 最右侧的地址
+// （由紧邻的可信代理追加，左侧的条目可能是客户端自行填写的），没有 X-Forwarded-For 时取 X-Real-IP；
+// 否则使用连接的远端地址，避免客户端伪造请求头绕过按 IP 的限制。
+func ClientIP(r *http.Request) string {
+	if config.Get().TrustProxyHeaders {
+		if values := r.Header.Values("X-Forwarded-For"); len(values) > 0 {
+			hops := strings.Split(values[len(values)-1], ",")
+			if ip := strings.TrimSpace(hops[len(hops)-1]); ip != "" {
+				return ip
+			}
+		}
+		if ip := strings.TrimSpace(r.Header.Get("X-Real-IP")); ip != "" {
+			return ip
+		}
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
@@ -0,0 +1,49 @@
+package http
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"anti2api-golang/refactor/internal/config"
+)
+
+func TestClientIP(t *testing.T) {
+	cfg := config.Get()
+	old := cfg.TrustProxyHeaders
+	t.Cleanup(func() { cfg.TrustProxyHeaders = old })
+
+	req := func(headers map[string][]string) *http.Request {
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		r.RemoteAddr = "10.0.0.1:4321"
+		for k, vs := range headers {
+			for _, v := range vs {
+				r.Header.Add(k, v)
+			}
+		}
+		return r
+	}
+
+	cfg.TrustProxyHeaders = false
+	if got := ClientIP(req(map[string][]string{"X-Forwarded-For": {"1.1.1.1"}})); got != "10.0.0.1" {
+		t.Fatalf("proxy headers must be ignored unless trusted, got %q", got)
+	}
+
+	cfg.TrustProxyHeaders = true
+	cases := []struct {
+		headers map[string][]string
+		want    string
+	}{
+		// 客户端伪造的 X-Forwarded-For 位于左侧，可信代理追加真实地址。
+		{map[string][]string{"X-Forwarded-For": {"6.6.6.6, 7.7.7.7, 203.0.113.9"}}, "203.0.113.9"},
+		{map[string][]string{"X-Forwarded-For": {"6.6.6.6", "203.0.113.9"}}, "203.0.113.9"},
+		{map[string][]string{"X-Real-IP": {"198.51.100.2"}}, "198.51.100.2"},
+		{map[string][]string{"X-Forwarded-For": {"6.6.6.6,"}}, "10.0.0.1"},
+		{nil, "10.0.0.1"},
+	}
+	for _, c := range cases {
+		if got := ClientIP(req(c.headers)); got != c.want {
+			t.Fatalf("%v: got %q, want %q", c.headers, got, c.want)
+		}
+	}
+}
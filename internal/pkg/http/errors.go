@@ -17,6 +17,25 @@ func WriteOpenAIError(w http.ResponseWriter, status int, msg string) {
 	_, _ = w.Write([]byte(`,"type":"server_error"}}`))
 }
 
+// WriteOpenAIErrorWithType 写入指定 error.type 的 OpenAI 兼容错误（例如 rate_limit_error）。
+func WriteOpenAIErrorWithType(w http.ResponseWriter, status int, msg, errType string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	encodedMsg, _ := jsonpkg.MarshalString(msg)
+	encodedType, _ := jsonpkg.MarshalString(errType)
+	_, _ = w.Write([]byte(`{"error":{"message":` + encodedMsg + `,"type":` + encodedType + `}}`))
+}
+
+// WriteOpenAIErrorWithCode 写入带 type 与 code 的 OpenAI 兼容错误（例如 content_filter）。
+func WriteOpenAIErrorWithCode(w http.ResponseWriter, status int, msg, errType, code string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	encodedMsg, _ := jsonpkg.MarshalString(msg)
+	encodedType, _ := jsonpkg.MarshalString(errType)
+	encodedCode, _ := jsonpkg.MarshalString(code)
+	_, _ = w.Write([]byte(`{"error":{"message":` + encodedMsg + `,"type":` + encodedType + `,"code":` + encodedCode + `}}`))
+}
+
 // WriteClaudeError 以 Claude/Anthropic 兼容的错误结构写入 JSON 响应。
 // 注意：为保证兼容性，错误结构与当前实现保持一致。
 func WriteClaudeError(w http.ResponseWriter, status int, msg string) {
@@ -25,3 +44,12 @@ func WriteClaudeError(w http.ResponseWriter, status int, msg string) {
 	encoded, _ := jsonpkg.MarshalString(msg)
 	_, _ = w.Write([]byte(`{"type":"error","error":{"type":"api_error","message":` + encoded + `}}`))
 }
+
+// WriteClaudeErrorWithType 写入指定 error.type 的 Claude/Anthropic 兼容错误（例如 invalid_request_error）。
+func WriteClaudeErrorWithType(w http.ResponseWriter, status int, errType, msg string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	encodedType, _ := jsonpkg.MarshalString(errType)
+	encoded, _ := jsonpkg.MarshalString(msg)
+	_, _ = w.Write([]byte(`{"type":"error","error":{"type":` + encodedType + `,"message":` + encoded + `}}`))
+}
@@ -0,0 +1,100 @@
+package http
+
+import (
+	"net/http"
+	"sync"
+	"time"
+
+	"anti2api-golang/refactor/internal/config"
+)
+
+// FlushBatcher 包装流式响应的 http.ResponseWriter，把高频的 Flush 合并为每 interval 最多一次：
+// 距上次实际刷新不足 interval 时只记录待刷新，并在间隔到达时由定时器补刷，保证数据不会滞留。
+// 写入与刷新都加锁，定时器与处理器协程不会并发访问底层 ResponseWriter。处理器返回前必须调用 Close。
+type FlushBatcher struct {
+	http.ResponseWriter
+
+	mu       sync.Mutex
+	interval time.Duration
+	last     time.Time
+	pending  bool
+	timer    *time.Timer
+	closed   bool
+}
+
+// NewFlushBatcher 创建按 interval 合并刷新的包装器；interval <= 0 时每次 Flush 都直接刷新。
+func NewFlushBatcher(w http.ResponseWriter, interval time.Duration) *FlushBatcher {
+	return &FlushBatcher{ResponseWriter: w, interval: interval}
+}
+
+// BatchSSEFlushes 按 SSE_FLUSH_INTERVAL_MS 包装流式响应；未配置时原样返回 w。
+// 返回的函数须在处理器返回前调用（通常 defer），用于补刷尚未发送的数据。
+func BatchSSEFlushes(w http.ResponseWriter) (http.ResponseWriter, func()) {
+	ms := config.Get().SSEFlushIntervalMs
+	if ms <= 0 {
+		return w, func() {}
+	}
+	b := NewFlushBatcher(w, time.Duration(ms)*time.Millisecond)
+	return b, b.Close
+}
+
+func (b *FlushBatcher) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.ResponseWriter.Write(p)
+}
+
+func (b *FlushBatcher) Flush() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.closed {
+		return
+	}
+	now := time.Now()
+	if b.interval <= 0 || now.Sub(b.last) >= b.interval {
+		b.flushLocked(now)
+		return
+	}
+	b.pending = true
+	if b.timer == nil {
+		b.timer = time.AfterFunc(b.interval-now.Sub(b.last), b.flushPending)
+	}
+}
+
+// Close 停止定时器并刷新尚未发送的数据；之后的 Flush 不再生效。
+func (b *FlushBatcher) Close() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.closed {
+		return
+	}
+	if b.pending {
+		b.flushLocked(time.Now())
+	}
+	if b.timer != nil {
+		b.timer.Stop()
+		b.timer = nil
+	}
+	b.closed = true
+}
+
+// Unwrap 供 http.ResponseController 访问底层 ResponseWriter。
+func (b *FlushBatcher) Unwrap() http.ResponseWriter { return b.ResponseWriter }
+
+func (b *FlushBatcher) flushPending() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.timer = nil
+	if b.closed || !b.pending {
+		return
+	}
+	b.flushLocked(time.Now())
+}
+
+func (b *FlushBatcher) flushLocked(now time.Time) {
+	if f, ok := b.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+	b.last = now
+	b.pending = false
+}
@@ -0,0 +1,141 @@
+package http
+
+import (
+	"bufio"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+type countingFlusher struct {
+	*httptest.ResponseRecorder
+	mu      sync.Mutex
+	flushes int
+}
+
+func (c *countingFlusher) Flush() {
+	c.mu.Lock()
+	c.flushes++
+	c.mu.Unlock()
+	c.ResponseRecorder.Flush()
+}
+
+func (c *countingFlusher) count() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.flushes
+}
+
+func TestFlushBatcher_CoalescesFlushes(t *testing.T) {
+	rec := &countingFlusher{ResponseRecorder: httptest.NewRecorder()}
+	b := NewFlushBatcher(rec, 50*time.Millisecond)
+
+	for i := 0; i < 10; i++ {
+		_, _ = fmt.Fprintf(b, "data: %d\n\n", i)
+		b.Flush()
+	}
+	if n := rec.count(); n != 1 {
+		t.Fatalf("burst should flush once immediately, got %d", n)
+	}
+
+	// 定时器在间隔到达时补刷，数据不会滞留到下一次写入。
+	deadline := time.Now().Add(time.Second)
+	for rec.count() < 2 && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+	if n := rec.count(); n != 2 {
+		t.Fatalf("pending data should be flushed by the timer, got %d flushes", n)
+	}
+
+	_, _ = b.Write([]byte("data: tail\n\n"))
+	b.Flush()
+	b.Close()
+	if n := rec.count(); n != 3 {
+		t.Fatalf("close should flush pending data, got %d flushes", n)
+	}
+	b.Flush()
+	if n := rec.count(); n != 3 {
+		t.Fatalf("flush after close must be ignored, got %d flushes", n)
+	}
+	if !strings.HasSuffix(rec.Body.String(), "data: tail\n\n") {
+		t.Fatalf("unexpected body %q", rec.Body.String())
+	}
+}
+
+// sseHandler 逐个发送事件，每个事件之后等待客户端确认收到，用于验证分片确实被实时推送而非缓冲到响应结束。
+func sseHandler(interval time.Duration, events int, ack <-chan struct{}) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		SetSSEHeaders(w)
+		bw := NewFlushBatcher(w, interval)
+		defer bw.Close()
+		for i := 0; i < events; i++ {
+			_, _ = fmt.Fprintf(bw, "data: %d\n\n", i)
+			bw.Flush()
+			select {
+			case <-ack:
+			case <-time.After(2 * time.Second):
+				return
+			}
+		}
+	})
+}
+
+func readEvents(t *testing.T, resp *http.Response, events int, ack chan<- struct{}) {
+	t.Helper()
+	sc := bufio.NewScanner(resp.Body)
+	for i := 0; i < events; i++ {
+		var line string
+		for sc.Scan() {
+			if line = sc.Text(); line != "" {
+				break
+			}
+		}
+		if want := fmt.Sprintf("data: %d", i); line != want {
+			t.Fatalf("event %d: got %q want %q (err=%v)", i, line, want, sc.Err())
+		}
+		ack <- struct{}{}
+	}
+}
+
+func TestSSEStreaming_HTTP1Chunked(t *testing.T) {
+	for _, interval := range []time.Duration{0, 20 * time.Millisecond} {
+		ack := make(chan struct{})
+		srv := httptest.NewServer(sseHandler(interval, 3, ack))
+		resp, err := srv.Client().Get(srv.URL)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if resp.ProtoMajor != 1 || len(resp.TransferEncoding) != 1 || resp.TransferEncoding[0] != "chunked" {
+			t.Fatalf("interval %v: want HTTP/1.1 chunked, got %s %v", interval, resp.Proto, resp.TransferEncoding)
+		}
+		readEvents(t, resp, 3, ack)
+		resp.Body.Close()
+		srv.Close()
+	}
+}
+
+func TestSSEStreaming_HTTP2(t *testing.T) {
+	for _, interval := range []time.Duration{0, 20 * time.Millisecond} {
+		ack := make(chan struct{})
+		srv := httptest.NewUnstartedServer(sseHandler(interval, 3, ack))
+		srv.EnableHTTP2 = true
+		srv.StartTLS()
+		resp, err := srv.Client().Get(srv.URL)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if resp.ProtoMajor != 2 {
+			t.Fatalf("interval %v: want HTTP/2, got %s", interval, resp.Proto)
+		}
+		if got := resp.Header.Get("Content-Type"); got != "text/event-stream" {
+			t.Fatalf("content-type = %q", got)
+		}
+		readEvents(t, resp, 3, ack)
+		resp.Body.Close()
+		srv.Close()
+	}
+}
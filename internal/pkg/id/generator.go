@@ -35,6 +35,8 @@ func ToolCallID() string {
 
 func ChatCompletionID() string { return fmt.Sprintf("chatcmpl-%s", uuid.New().String()[:8]) }
 
+func ModerationID() string { return fmt.Sprintf("modr-%s", uuid.New().String()[:8]) }
+
 func randIndex(list []string) string {
 	n, _ := rand.Int(rand.Reader, big.NewInt(int64(len(list))))
 	return list[int(n.Int64())]
@@ -0,0 +1,125 @@
+// Package imagescale 缩小并重新压缩请求中的图片（见 IMAGE_DOWNSCALE）：客户端（尤其是 agent 截图）发来的大图
+// 会按尺寸消耗大量 token 并触发上游的请求大小限制，转发前将最长边限制在给定像素内，不透明的图片改为 JPEG 编码。
+// 只依赖标准库：缩小使用面积平均（box filter），对截图中的文字比最近邻采样清晰得多。
+package imagescale
+
+import (
+	"bytes"
+	"image"
+	"image/draw"
+	"image/jpeg"
+	"image/png"
+	"strings"
+)
+
+// RecompressMinBytes 为未超过尺寸上限的图片重新压缩的最小体积：小图重新编码收益很小，保持原样。
+const RecompressMinBytes = 1 << 20
+
+// Options 为处理参数。
+type Options struct {
+	// MaxDimension 为最长边的像素上限，<= 0 表示不缩小。
+	MaxDimension int
+	// JPEGQuality 为 JPEG 编码质量（1-100），<= 0 时使用 jpeg.DefaultQuality。
+	JPEGQuality int
+}
+
+// Process 按 opts 处理一张图片：超过尺寸上限时等比缩小，缩小后或体积超过 RecompressMinBytes 时重新编码
+// （不透明的图片编码为 JPEG，否则为 PNG）。返回处理后的数据与 MIME 类型；不支持的格式、无需处理或
+// 重新编码后反而更大（且未缩小）时 changed 为 false，调用方应保留原图。
+func Process(data []byte, mimeType string, opts Options) (out []byte, outMime string, changed bool, err error) {
+	switch strings.ToLower(mimeType) {
+	case "image/png", "image/jpeg", "image/jpg":
+	default:
+		return nil, "", false, nil
+	}
+	cfg, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, "", false, err
+	}
+	w, h := fitWithin(cfg.Width, cfg.Height, opts.MaxDimension)
+	resize := w != cfg.Width || h != cfg.Height
+	if !resize && len(data) < RecompressMinBytes {
+		return nil, "", false, nil
+	}
+
+	src, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, "", false, err
+	}
+	img := toRGBA(src)
+	if resize {
+		img = boxDownscale(img, w, h)
+	}
+
+	var buf bytes.Buffer
+	if img.Opaque() {
+		quality := opts.JPEGQuality
+		if quality <= 0 || quality > 100 {
+			quality = jpeg.DefaultQuality
+		}
+		outMime = "image/jpeg"
+		err = jpeg.Encode(&buf, img, &jpeg.Options{Quality: quality})
+	} else {
+		outMime = "image/png"
+		err = (&png.Encoder{CompressionLevel: png.BestCompression}).Encode(&buf, img)
+	}
+	if err != nil {
+		return nil, "", false, err
+	}
+	if !resize && buf.Len() >= len(data) {
+		return nil, "", false, nil
+	}
+	return buf.Bytes(), outMime, true, nil
+}
+
+// fitWithin 返回将 w×h 等比缩小到最长边不超过 limit 后的尺寸（limit <= 0 或未超过时原样返回）。
+func fitWithin(w, h, limit int) (int, int) {
+	if limit <= 0 || (w <= limit && h <= limit) {
+		return w, h
+	}
+	if w >= h {
+		return limit, max(1, h*limit/w)
+	}
+	return max(1, w*limit/h), limit
+}
+
+func toRGBA(src image.Image) *image.RGBA {
+	if rgba, ok := src.(*image.RGBA); ok && rgba.Rect.Min == (image.Point{}) {
+		return rgba
+	}
+	b := src.Bounds()
+	dst := image.NewRGBA(image.Rect(0, 0, b.Dx(), b.Dy()))
+	draw.Draw(dst, dst.Rect, src, b.Min, draw.Src)
+	return dst
+}
+
+// boxDownscale 将 src 缩小到 w×h：每个目标像素取其覆盖的源像素区域的平均值（预乘 alpha，透明边缘不发黑）。
+func boxDownscale(src *image.RGBA, w, h int) *image.RGBA {
+	sw, sh := src.Rect.Dx(), src.Rect.Dy()
+	dst := image.NewRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		sy0 := y * sh / h
+		sy1 := max((y+1)*sh/h, sy0+1)
+		for x := 0; x < w; x++ {
+			sx0 := x * sw / w
+			sx1 := max((x+1)*sw/w, sx0+1)
+			var r, g, b, a, n uint32
+			for sy := sy0; sy < sy1; sy++ {
+				row := src.Pix[sy*src.Stride+sx0*4 : sy*src.Stride+sx1*4]
+				for i := 0; i < len(row); i += 4 {
+					r += uint32(row[i])
+					g += uint32(row[i+1])
+					b += uint32(row[i+2])
+					a += uint32(row[i+3])
+					n++
+				}
+			}
+			o := y*dst.Stride + x*4
+			dst.Pix[o] = uint8(r / n)
+			dst.Pix[o+1] = uint8(g / n)
+			dst.Pix[o+2] = uint8(b / n)
+			dst.Pix[o+3] = uint8(a / n)
+		}
+	}
+	return dst
+}
@@ -0,0 +1,60 @@
+package imagescale
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/png"
+	"testing"
+)
+
+func encodePNG(t *testing.T, w, h int, alpha uint8) []byte {
+	t.Helper()
+	img := image.NewNRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			img.SetNRGBA(x, y, color.NRGBA{R: uint8(x), G: uint8(y), B: 128, A: alpha})
+		}
+	}
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestProcess_DownscalesOpaqueImageToJPEG(t *testing.T) {
+	data := encodePNG(t, 2000, 500, 255)
+	out, mimeType, changed, err := Process(data, "image/png", Options{MaxDimension: 800, JPEGQuality: 80})
+	if err != nil || !changed {
+		t.Fatalf("expected image to be processed, changed=%v err=%v", changed, err)
+	}
+	if mimeType != "image/jpeg" {
+		t.Fatalf("opaque image should be re-encoded as JPEG, got %s", mimeType)
+	}
+	cfg, format, err := image.DecodeConfig(bytes.NewReader(out))
+	if err != nil || format != "jpeg" || cfg.Width != 800 || cfg.Height != 200 {
+		t.Fatalf("unexpected output %s %dx%d: %v", format, cfg.Width, cfg.Height, err)
+	}
+}
+
+func TestProcess_KeepsTransparencyAsPNG(t *testing.T) {
+	data := encodePNG(t, 300, 600, 100)
+	out, mimeType, changed, err := Process(data, "image/png", Options{MaxDimension: 200})
+	if err != nil || !changed || mimeType != "image/png" {
+		t.Fatalf("changed=%v mime=%s err=%v", changed, mimeType, err)
+	}
+	cfg, _, _ := image.DecodeConfig(bytes.NewReader(out))
+	if cfg.Width != 100 || cfg.Height != 200 {
+		t.Fatalf("unexpected size %dx%d", cfg.Width, cfg.Height)
+	}
+}
+
+func TestProcess_LeavesSmallAndUnsupportedImages(t *testing.T) {
+	if _, _, changed, err := Process(encodePNG(t, 100, 100, 255), "image/png", Options{MaxDimension: 800}); changed || err != nil {
+		t.Fatalf("small image should be left alone, changed=%v err=%v", changed, err)
+	}
+	if _, _, changed, err := Process([]byte("GIF89a"), "image/gif", Options{MaxDimension: 1}); changed || err != nil {
+		t.Fatalf("unsupported format should be left alone, changed=%v err=%v", changed, err)
+	}
+}
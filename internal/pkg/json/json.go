@@ -1,6 +1,9 @@
 package json
 
-import "github.com/bytedance/sonic"
+import (
+	"github.com/bytedance/sonic"
+	"github.com/bytedance/sonic/ast"
+)
 
 var api = sonic.Config{
 	EscapeHTML:  false,
@@ -20,3 +23,22 @@ func UnmarshalString(data string, v any) error { return api.UnmarshalFromString(
 func MarshalIndent(v any, prefix, indent string) ([]byte, error) {
 	return api.MarshalIndent(v, prefix, indent)
 }
+
+func Valid(data []byte) bool { return api.Valid(data) }
+
+func ValidString(data string) bool { return api.Valid([]byte(data)) }
+
+// GetBool 读取 data 顶层对象中 key 对应的布尔值（不完整解析整个文档）；不存在或不是布尔值时 ok 为 false。
+func GetBool(data []byte, key string) (value bool, ok bool) {
+	node, err := sonic.Get(data, key)
+	if err != nil {
+		return false, false
+	}
+	switch node.Type() {
+	case ast.V_TRUE:
+		return true, true
+	case ast.V_FALSE:
+		return false, true
+	}
+	return false, false
+}
@@ -0,0 +1,226 @@
+// Package jsonrepair 修复上游偶发返回的非法 JSON（主要是 functionCall 的参数），
+// 例如 NaN/Infinity、多余的尾部内容、缺失的右括号等，避免工具调用参数被静默丢弃为 "{}"。
+//
+// 修复是尽力而为的：只做不改变已有合法内容的文本级修补，修补后仍需通过 sonic 校验才会采用。
+// 每次修复成功/失败都会计入计数器，可通过 Stats 查看。
+package jsonrepair
+
+import (
+	"math"
+	"strings"
+	"sync/atomic"
+
+	jsonpkg "anti2api-golang/refactor/internal/pkg/json"
+)
+
+// Counters 是修复计数的快照。
+type Counters struct {
+	// Repaired 为修复后成功解析的次数（原始 JSON 文本与参数值两类都计入）。
+	Repaired int64 `json:"repaired"`
+	// Failed 为无法修复、只能丢弃的次数。
+	Failed int64 `json:"failed"`
+}
+
+var (
+	repaired atomic.Int64
+	failed   atomic.Int64
+)
+
+// Stats 返回进程启动以来的修复计数。
+func Stats() Counters {
+	return Counters{Repaired: repaired.Load(), Failed: failed.Load()}
+}
+
+// Repair 尝试修复 JSON 文本 s。s 本身合法时原样返回；修复后合法时返回修复结果；
+// 否则返回原文与 false。
+func Repair(s string) (string, bool) {
+	if jsonpkg.ValidString(s) {
+		return s, true
+	}
+	out := fix(s)
+	if out != s && jsonpkg.ValidString(out) {
+		repaired.Add(1)
+		return out, true
+	}
+	failed.Add(1)
+	return s, false
+}
+
+// ToolArguments 将工具调用参数序列化为 OpenAI 的 arguments 字符串。
+// 参数中包含 NaN/±Inf 等无法序列化的数值时替换为 null 后重试；仍失败时返回 "{}"。
+func ToolArguments(args map[string]any) string {
+	if args == nil {
+		return "{}"
+	}
+	if s, err := jsonpkg.MarshalString(args); err == nil {
+		return s
+	}
+	if s, err := jsonpkg.MarshalString(sanitize(args)); err == nil {
+		repaired.Add(1)
+		return s
+	}
+	failed.Add(1)
+	return "{}"
+}
+
+// sanitize 返回将非有限浮点数替换为 nil 后的副本。
+func sanitize(v any) any {
+	switch t := v.(type) {
+	case map[string]any:
+		out := make(map[string]any, len(t))
+		for k, e := range t {
+			out[k] = sanitize(e)
+		}
+		return out
+	case []any:
+		out := make([]any, len(t))
+		for i, e := range t {
+			out[i] = sanitize(e)
+		}
+		return out
+	case float64:
+		if math.IsNaN(t) || math.IsInf(t, 0) {
+			return nil
+		}
+		return t
+	case float32:
+		if math.IsNaN(float64(t)) || math.IsInf(float64(t), 0) {
+			return nil
+		}
+		return t
+	default:
+		return v
+	}
+}
+
+// fix 对 s 做一遍文本级修补：
+//   - 字符串外的 NaN / Infinity / -Infinity / undefined 替换为 null，去掉数字前的 '+'；
+//   - 补全 ".5" / "1." 这类不完整的小数；
+//   - 删除 '}' / ']' 前多余的逗号，跳过不匹配的右括号；
+//   - 顶层对象/数组结束后的内容视为垃圾丢弃；
+//   - 结尾处补全未闭合的字符串与括号（悬空的键补 null）。
+func fix(s string) string {
+	var b strings.Builder
+	b.Grow(len(s) + 8)
+
+	var stack []byte
+	inString, escaped, started := false, false, false
+
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if inString {
+			b.WriteByte(c)
+			switch {
+			case escaped:
+				escaped = false
+			case c == '\\':
+				escaped = true
+			case c == '"':
+				inString = false
+			}
+			continue
+		}
+
+		switch {
+		case c == '"':
+			inString = true
+			b.WriteByte(c)
+		case c == '{' || c == '[':
+			stack = append(stack, c)
+			started = true
+			b.WriteByte(c)
+		case c == '}' || c == ']':
+			if len(stack) == 0 || !matches(stack[len(stack)-1], c) {
+				continue
+			}
+			closeValue(&b)
+			stack = stack[:len(stack)-1]
+			b.WriteByte(c)
+			if len(stack) == 0 {
+				// 顶层值已结束，其后的内容全部丢弃。
+				return b.String()
+			}
+		case c == '+' || c == '-':
+			if w := word(s, i+1); w == "Infinity" || w == "NaN" {
+				b.WriteString("null")
+				i += len(w)
+				continue
+			}
+			if c == '-' {
+				b.WriteByte(c)
+			}
+		case c == '.':
+			if out := b.String(); out == "" || !isDigit(out[len(out)-1]) {
+				b.WriteByte('0')
+			}
+			b.WriteByte(c)
+			if i+1 >= len(s) || !isDigit(s[i+1]) {
+				b.WriteByte('0')
+			}
+		case isLetter(c):
+			w := word(s, i)
+			switch w {
+			case "NaN", "Infinity", "undefined":
+				b.WriteString("null")
+			default:
+				b.WriteString(w)
+			}
+			i += len(w) - 1
+		default:
+			b.WriteByte(c)
+		}
+	}
+
+	if !started {
+		return b.String()
+	}
+	if inString {
+		if escaped {
+			// 丢弃末尾孤立的反斜杠。
+			out := b.String()
+			b.Reset()
+			b.WriteString(out[:len(out)-1])
+		}
+		b.WriteByte('"')
+	}
+	for i := len(stack) - 1; i >= 0; i-- {
+		closeValue(&b)
+		if stack[i] == '{' {
+			b.WriteByte('}')
+		} else {
+			b.WriteByte(']')
+		}
+	}
+	return b.String()
+}
+
+func matches(open, closing byte) bool {
+	return (open == '{' && closing == '}') || (open == '[' && closing == ']')
+}
+
+// closeValue 在写入右括号前整理 b 的末尾（忽略空白）：删除多余的逗号，悬空的键补 null。
+func closeValue(b *strings.Builder) {
+	trimmed := strings.TrimRight(b.String(), " \t\r\n")
+	switch {
+	case strings.HasSuffix(trimmed, ","):
+		trimmed = trimmed[:len(trimmed)-1]
+	case strings.HasSuffix(trimmed, ":"):
+		trimmed += "null"
+	default:
+		return
+	}
+	b.Reset()
+	b.WriteString(trimmed)
+}
+
+func word(s string, i int) string {
+	j := i
+	for j < len(s) && isLetter(s[j]) {
+		j++
+	}
+	return s[i:j]
+}
+
+func isLetter(c byte) bool { return (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') }
+
+func isDigit(c byte) bool { return c >= '0' && c <= '9' }
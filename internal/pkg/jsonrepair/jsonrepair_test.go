@@ -0,0 +1,61 @@
+package jsonrepair
+
+import (
+	"math"
+	"testing"
+)
+
+func TestRepair(t *testing.T) {
+	cases := []struct {
+		in, want string
+	}{
+		{`{"a":1}`, `{"a":1}`},
+		{`{"a":NaN,"b":-Infinity,"c":+Infinity}`, `{"a":null,"b":null,"c":null}`},
+		{`{"a":"NaN"}`, `{"a":"NaN"}`},
+		{`{"a":+1,"b":.5,"c":-.5,"d":2.}`, `{"a":1,"b":0.5,"c":-0.5,"d":2.0}`},
+		{`{"a":1}garbage}`, `{"a":1}`},
+		{`{"a":[1,2,],}`, `{"a":[1,2]}`},
+		{`{"a":{"b":[1,2`, `{"a":{"b":[1,2]}}`},
+		{`{"a":"unterminated`, `{"a":"unterminated"}`},
+		{`{"a":`, `{"a":null}`},
+		{`{"a":1]}`, `{"a":1}`},
+		{`{"a":"x}y","b":undefined}`, `{"a":"x}y","b":null}`},
+	}
+	for _, tc := range cases {
+		got, ok := Repair(tc.in)
+		if !ok || got != tc.want {
+			t.Errorf("Repair(%q) = %q, %v; want %q", tc.in, got, ok, tc.want)
+		}
+	}
+}
+
+func TestRepairCounts(t *testing.T) {
+	before := Stats()
+	if _, ok := Repair(`{"a":1}`); !ok {
+		t.Fatal("valid JSON should pass")
+	}
+	if _, ok := Repair(`{"a":NaN}`); !ok {
+		t.Fatal("NaN should be repaired")
+	}
+	if _, ok := Repair(`not json`); ok {
+		t.Fatal("non-JSON should not be repaired")
+	}
+	after := Stats()
+	if after.Repaired-before.Repaired != 1 || after.Failed-before.Failed != 1 {
+		t.Fatalf("counters: before=%+v after=%+v", before, after)
+	}
+}
+
+func TestToolArguments(t *testing.T) {
+	if got := ToolArguments(nil); got != "{}" {
+		t.Fatalf("nil args = %q", got)
+	}
+	before := Stats()
+	got := ToolArguments(map[string]any{"x": math.NaN(), "y": []any{math.Inf(1), 1.5}})
+	if got != `{"x":null,"y":[null,1.5]}` && got != `{"y":[null,1.5],"x":null}` {
+		t.Fatalf("ToolArguments = %q", got)
+	}
+	if Stats().Repaired-before.Repaired != 1 {
+		t.Fatal("expected repair to be counted")
+	}
+}
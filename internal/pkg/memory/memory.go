@@ -0,0 +1,43 @@
+// Package memory 在处理大请求/大响应（例如图片生成返回的多 MB base64）后尽快把空闲内存归还给操作系统，
+// 降低图片生成突发时的峰值 RSS。
+package memory
+
+import (
+	"runtime/debug"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	// LargeRequestBytes 为触发内存归还的请求+响应字节数阈值。
+	LargeRequestBytes = 4 << 20
+	// minReleaseInterval 限制归还频率，避免并发图片请求时反复执行 FreeOSMemory。
+	minReleaseInterval = 2 * time.Second
+)
+
+var (
+	releasing   atomic.Bool
+	lastRelease atomic.Int64
+	// freeOSMemory 可在测试中替换。
+	freeOSMemory = debug.FreeOSMemory
+)
+
+// AfterLargeRequest 在请求处理完成后调用，size 为请求体与响应体的大致字节数。
+// 超过 LargeRequestBytes 时在后台执行一次 FreeOSMemory；同一时间最多执行一次，且两次之间至少间隔 minReleaseInterval。
+func AfterLargeRequest(size int) {
+	if size < LargeRequestBytes {
+		return
+	}
+	now := time.Now().UnixNano()
+	if now-lastRelease.Load() < int64(minReleaseInterval) {
+		return
+	}
+	if !releasing.CompareAndSwap(false, true) {
+		return
+	}
+	lastRelease.Store(now)
+	go func() {
+		defer releasing.Store(false)
+		freeOSMemory()
+	}()
+}
@@ -0,0 +1,30 @@
+package memory
+
+import (
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestAfterLargeRequest(t *testing.T) {
+	var calls atomic.Int32
+	done := make(chan struct{}, 4)
+	prev := freeOSMemory
+	freeOSMemory = func() { calls.Add(1); done <- struct{}{} }
+	t.Cleanup(func() { freeOSMemory = prev; lastRelease.Store(0) })
+	lastRelease.Store(0)
+
+	AfterLargeRequest(LargeRequestBytes - 1)
+	AfterLargeRequest(LargeRequestBytes)
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatalf("expected FreeOSMemory to run for a large request")
+	}
+	// 间隔内的再次调用被合并。
+	AfterLargeRequest(LargeRequestBytes * 2)
+	time.Sleep(20 * time.Millisecond)
+	if got := calls.Load(); got != 1 {
+		t.Fatalf("expected 1 release, got %d", got)
+	}
+}
@@ -0,0 +1,157 @@
+package modelutil
+
+import (
+	"strconv"
+	"strings"
+
+	"anti2api-golang/refactor/internal/vertex"
+)
+
+// Capabilities 描述对外暴露的模型元数据，供按模型元数据自动配置的客户端使用。
+// ContextWindow / MaxOutputTokens 为 0 表示未知。
+type Capabilities struct {
+	ContextWindow    int
+	MaxOutputTokens  int
+	InputModalities  []string
+	OutputModalities []string
+	SupportsThinking bool
+}
+
+type capabilityLimits struct {
+	ContextWindow   int
+	MaxOutputTokens int
+}
+
+type capabilityRule struct {
+	match  func(lower string) bool
+	limits capabilityLimits
+}
+
+// capabilityTable 按模型族维护的静态元数据，按顺序匹配第一条规则。
+// 上游 fetchAvailableModels 返回了对应字段时以上游为准（见 CapabilitiesFor）。
+var capabilityTable = []capabilityRule{
+	{
+		match:  func(m string) bool { return strings.HasPrefix(m, "gemini-") && strings.Contains(m, "image") },
+		limits: capabilityLimits{ContextWindow: 65536, MaxOutputTokens: 32768},
+	},
+	{
+		match:  func(m string) bool { return strings.HasPrefix(m, "gemini-") },
+		limits: capabilityLimits{ContextWindow: 1048576, MaxOutputTokens: GeminiMaxOutputTokens},
+	},
+	{
+		match:  func(m string) bool { return strings.HasPrefix(m, "claude-") },
+		limits: capabilityLimits{ContextWindow: 200000, MaxOutputTokens: ClaudeMaxOutputTokens},
+	},
+	{
+		match:  func(m string) bool { return strings.HasPrefix(m, "gpt-oss-") },
+		limits: capabilityLimits{ContextWindow: 131072, MaxOutputTokens: 32768},
+	},
+}
+
+// CapabilitiesFor 返回 model 的元数据：token 上限先取静态表，再用上游模型信息 upstream
+// （fetchAvailableModels 中该模型对应的对象，可为 nil）里的 maxTokens / maxOutputTokens 覆盖；
+// 模态与 thinking 支持按模型族判断。
+func CapabilitiesFor(model string, upstream any) Capabilities {
+	lower := canonicalLower(model)
+	caps := Capabilities{
+		InputModalities:  []string{"text"},
+		OutputModalities: []string{"text"},
+		SupportsThinking: SupportsThinking(model),
+	}
+	for _, rule := range capabilityTable {
+		if rule.match(lower) {
+			caps.ContextWindow = rule.limits.ContextWindow
+			caps.MaxOutputTokens = rule.limits.MaxOutputTokens
+			break
+		}
+	}
+	if IsGemini(model) || IsClaude(model) {
+		caps.InputModalities = []string{"text", "image"}
+	}
+	if IsImageModel(model) {
+		caps.OutputModalities = []string{"text", "image"}
+	}
+
+	if m, ok := upstream.(map[string]any); ok {
+		if v, ok := anyToInt(m["maxTokens"]); ok && v > 0 {
+			caps.ContextWindow = v
+		}
+		if v, ok := anyToInt(m["maxOutputTokens"]); ok && v > 0 {
+			caps.MaxOutputTokens = v
+		}
+	}
+	return caps
+}
+
+// SupportsThinking 判断模型是否会输出思考内容：
+// 名称强制决定 ThinkingConfig 的模型以强制配置为准；Claude 仅 "-thinking" 变体；
+// Gemini 2.5 / 3（图像模型除外）与 gpt-oss 支持。
+func SupportsThinking(model string) bool {
+	if cfg, ok := ForcedThinkingConfig(model); ok {
+		return cfg.ThinkingLevel != "" || cfg.ThinkingBudget != 0
+	}
+	if IsClaude(model) {
+		return IsClaudeThinking(model)
+	}
+	if IsImageModel(model) {
+		return false
+	}
+	if IsGemini25(model) || IsGemini3(model) {
+		return true
+	}
+	return strings.HasPrefix(canonicalLower(model), "gpt-oss-")
+}
+
+// RejectsThinkingConfig 判断上游是否会以 400 拒绝带 thinkingConfig 的请求：
+// 图像模型、Claude 非 "-thinking" 变体、Gemini 2.5 之前的模型。名称强制决定 ThinkingConfig 的模型除外；
+// 其他未知模型族不做判断（返回 false），保持透传。
+func RejectsThinkingConfig(model string) bool {
+	if _, ok := ForcedThinkingConfig(model); ok {
+		return false
+	}
+	switch {
+	case IsImageModel(model):
+		return true
+	case IsClaude(model):
+		return !IsClaudeThinking(model)
+	case IsGemini(model):
+		return !IsGemini25(model) && !IsGemini3(model)
+	}
+	return false
+}
+
+// DowngradeThinking 对 RejectsThinkingConfig 的模型移除 cfg.ThinkingConfig，返回是否发生了移除。
+func DowngradeThinking(model string, cfg *vertex.GenerationConfig) bool {
+	if cfg == nil || cfg.ThinkingConfig == nil || !RejectsThinkingConfig(model) {
+		return false
+	}
+	cfg.ThinkingConfig = nil
+	return true
+}
+
+// UpstreamModelInfo 返回 fetchAvailableModels 中 model（含虚拟模型，按后端 ID 查找）对应的模型信息。
+func UpstreamModelInfo(models map[string]any, model string) any {
+	if models == nil {
+		return nil
+	}
+	if v, ok := models[CanonicalModelID(model)]; ok {
+		return v
+	}
+	return models[BackendModelID(model)]
+}
+
+func anyToInt(v any) (int, bool) {
+	switch n := v.(type) {
+	case float64:
+		return int(n), true
+	case int:
+		return n, true
+	case int64:
+		return int(n), true
+	case string:
+		i, err := strconv.Atoi(strings.TrimSpace(n))
+		return i, err == nil
+	default:
+		return 0, false
+	}
+}
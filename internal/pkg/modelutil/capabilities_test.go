@@ -0,0 +1,116 @@
+package modelutil
+
+import (
+	"reflect"
+	"testing"
+
+	"anti2api-golang/refactor/internal/vertex"
+)
+
+func TestCapabilitiesFor_StaticTable(t *testing.T) {
+	cases := []struct {
+		model string
+		want  Capabilities
+	}{
+		{"gemini-3-pro-high", Capabilities{1048576, GeminiMaxOutputTokens, []string{"text", "image"}, []string{"text"}, true}},
+		{"models/gemini-3-pro-image-4k", Capabilities{65536, 32768, []string{"text", "image"}, []string{"text", "image"}, false}},
+		{"claude-sonnet-4-5-thinking", Capabilities{200000, ClaudeMaxOutputTokens, []string{"text", "image"}, []string{"text"}, true}},
+		{"claude-opus-4-5", Capabilities{200000, ClaudeMaxOutputTokens, []string{"text", "image"}, []string{"text"}, false}},
+		{"gpt-oss-120b-medium", Capabilities{131072, 32768, []string{"text"}, []string{"text"}, true}},
+		{"unknown-model", Capabilities{0, 0, []string{"text"}, []string{"text"}, false}},
+	}
+	for _, tc := range cases {
+		if got := CapabilitiesFor(tc.model, nil); !reflect.DeepEqual(got, tc.want) {
+			t.Fatalf("CapabilitiesFor(%q) = %+v; want %+v", tc.model, got, tc.want)
+		}
+	}
+}
+
+func TestCapabilitiesFor_UpstreamOverrides(t *testing.T) {
+	models := map[string]any{
+		"claude-opus-4-5-thinking": map[string]any{"maxTokens": float64(180000), "maxOutputTokens": "32000"},
+	}
+	// 虚拟模型按后端 ID 读取上游信息。
+	got := CapabilitiesFor("claude-opus-4-5", UpstreamModelInfo(models, "claude-opus-4-5"))
+	if got.ContextWindow != 180000 || got.MaxOutputTokens != 32000 {
+		t.Fatalf("unexpected capabilities %+v", got)
+	}
+
+	got = CapabilitiesFor("gemini-2.5-flash", map[string]any{"maxTokens": 0})
+	if got.ContextWindow != 1048576 {
+		t.Fatalf("expected zero upstream value to keep the static limit, got %+v", got)
+	}
+}
+
+func TestSupportsThinking(t *testing.T) {
+	cases := map[string]bool{
+		"gemini-3-flash":           false,
+		"gemini-3-flash-thinking":  true,
+		"gemini-2.5-flash":         true,
+		"claude-sonnet-4-5":        false,
+		"claude-opus-4-5-thinking": true,
+		"gemini-2.5-flash-image":   false,
+	}
+	for model, want := range cases {
+		if got := SupportsThinking(model); got != want {
+			t.Fatalf("SupportsThinking(%q) = %v; want %v", model, got, want)
+		}
+	}
+}
+
+func TestRejectsThinkingConfig(t *testing.T) {
+	cases := map[string]bool{
+		"gemini-3-pro-image":         true,
+		"gemini-2.5-flash-image":     true,
+		"gemini-2.0-flash":           true,
+		"claude-sonnet-4":            true,
+		"claude-sonnet-4-thinking":   false,
+		"claude-sonnet-4-5":          false, // 强制配置
+		"gemini-2.5-pro":             false,
+		"gemini-3-pro-high":          false,
+		"gemini-3-flash":             false,
+		"gpt-oss-120b-medium":        false,
+		"some-unknown-upstream-name": false,
+	}
+	for model, want := range cases {
+		if got := RejectsThinkingConfig(model); got != want {
+			t.Errorf("RejectsThinkingConfig(%q) = %v; want %v", model, got, want)
+		}
+	}
+
+	cfg := &vertex.GenerationConfig{ThinkingConfig: &vertex.ThinkingConfig{IncludeThoughts: true, ThinkingLevel: "high"}}
+	if !DowngradeThinking("gemini-3-pro-image", cfg) || cfg.ThinkingConfig != nil {
+		t.Fatalf("expected thinkingConfig to be dropped: %+v", cfg)
+	}
+	cfg.ThinkingConfig = &vertex.ThinkingConfig{IncludeThoughts: true, ThinkingBudget: 1024}
+	if DowngradeThinking("gemini-2.5-pro", cfg) || cfg.ThinkingConfig == nil {
+		t.Fatal("thinking-capable model should keep thinkingConfig")
+	}
+}
+
+func TestOverrideThinking(t *testing.T) {
+	cfg := &vertex.GenerationConfig{MaxOutputTokens: ClaudeMaxOutputTokens}
+	OverrideThinking("claude-opus-4-5-thinking", cfg, -1, "medium")
+	if cfg.ThinkingConfig == nil || cfg.ThinkingConfig.ThinkingBudget != ClaudeThinkingEffortMediumTokens || cfg.ThinkingConfig.ThinkingLevel != "" {
+		t.Fatalf("claude level should map to budget: %+v", cfg.ThinkingConfig)
+	}
+
+	OverrideThinking("claude-opus-4-5-thinking", cfg, 100000, "")
+	if want := ClaudeMaxOutputTokens - ThinkingBudgetHeadroomTokens; cfg.ThinkingConfig.ThinkingBudget != want {
+		t.Fatalf("budget should be clamped to %d, got %d", want, cfg.ThinkingConfig.ThinkingBudget)
+	}
+
+	cfg = &vertex.GenerationConfig{}
+	OverrideThinking("gemini-3-pro-high", cfg, 4096, "low")
+	if cfg.ThinkingConfig.ThinkingLevel != "low" || cfg.ThinkingConfig.ThinkingBudget != 0 {
+		t.Fatalf("gemini 3 should prefer level: %+v", cfg.ThinkingConfig)
+	}
+	OverrideThinking("gemini-2.5-flash", cfg, 4096, "low")
+	if cfg.ThinkingConfig.ThinkingBudget != 4096 || cfg.ThinkingConfig.ThinkingLevel != "" {
+		t.Fatalf("gemini 2.5 should prefer budget: %+v", cfg.ThinkingConfig)
+	}
+	OverrideThinking("gemini-2.5-flash", cfg, -1, "off")
+	if cfg.ThinkingConfig != nil {
+		t.Fatal("level off should drop thinkingConfig")
+	}
+}
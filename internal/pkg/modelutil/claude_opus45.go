@@ -12,9 +12,7 @@ import "strings"
 // - claude-opus-4-5-thinking* => thinkingBudget=32000, backend model unchanged
 // - claude-opus-4-5*         => thinkingBudget=0, backend model is mapped to "-thinking" (+ same suffix)
 func ClaudeOpus45ThinkingConfig(model string) (budget int, backendModel string, ok bool) {
-	m := strings.TrimSpace(model)
-	m = strings.TrimPrefix(m, "models/")
-	m = strings.ToLower(strings.TrimSpace(m))
+	m := canonicalLower(model)
 	if m == "" {
 		return 0, "", false
 	}
@@ -11,9 +11,7 @@ import "strings"
 // - claude-sonnet-4-5-thinking* => thinkingBudget=32000
 // - claude-sonnet-4-5*         => thinkingBudget=0
 func ClaudeSonnet45ThinkingBudget(model string) (budget int, ok bool) {
-	m := strings.TrimSpace(model)
-	m = strings.TrimPrefix(m, "models/")
-	m = strings.ToLower(strings.TrimSpace(m))
+	m := canonicalLower(model)
 	if m == "" {
 		return 0, false
 	}
@@ -21,4 +21,7 @@ const (
 	ClaudeThinkingEffortLowTokens    = 1024
 	ClaudeThinkingEffortMediumTokens = 4096
 	ClaudeThinkingEffortHighTokens   = DefaultClaudeThinkingBudgetTokens
+
+	// Gemini25ProMinThinkingBudget 是 Gemini 2.5 Pro 允许的最小 thinkingBudget（该模型无法关闭 thinking）。
+	Gemini25ProMinThinkingBudget = 128
 )
@@ -12,9 +12,7 @@ import "strings"
 // - gemini-3-flash-thinking* => thinkingLevel="high", backend model strips "-thinking"
 // - gemini-3-flash*          => non-thinking model, backend model unchanged
 func Gemini3FlashThinkingConfig(model string) (thinkingLevel string, backendModel string, ok bool) {
-	m := strings.TrimSpace(model)
-	m = strings.TrimPrefix(m, "models/")
-	m = strings.ToLower(strings.TrimSpace(m))
+	m := canonicalLower(model)
 	if m == "" {
 		return "", "", false
 	}
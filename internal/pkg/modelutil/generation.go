@@ -0,0 +1,120 @@
+package modelutil
+
+import (
+	"strings"
+
+	"anti2api-golang/refactor/internal/config"
+	"anti2api-golang/refactor/internal/vertex"
+)
+
+// GenerationParams 是各网关从请求中提取、归一化后的生成参数，交由 BuildGenerationConfig 统一生成 Vertex generationConfig。
+// 零值字段表示客户端未指定。
+type GenerationParams struct {
+	CandidateCount  int
+	MaxOutputTokens int
+	Temperature     *float64
+	TopP            *float64
+	TopK            int
+	StopSequences   []string
+
+	// Thinking 为按各接口语义解析出的思考配置（见 ThinkingConfigFromOpenAI / FromClaude / FromGemini），nil 表示未开启。
+	// 模型强制的思考配置（ForcedThinkingConfig）始终优先。
+	Thinking *vertex.ThinkingConfig
+	// ExactThinkingBudget 表示预算已按接口规则校验过：只要小于 maxOutputTokens 就原样透传，不再预留余量。
+	ExactThinkingBudget bool
+
+	// ImageAspectRatio / ImageSize 仅对 gemini-3-pro-image 生效；虚拟尺寸模型强制的 imageSize 优先。
+	ImageAspectRatio string
+	ImageSize        string
+	// MediaResolution 为客户端指定的 mediaResolution（仅 Gemini 3 非图像模型生效）：
+	// nil 时使用全局 GEMINI3_MEDIA_RESOLUTION，显式空值 / 非法值表示不写出该字段。
+	MediaResolution *string
+}
+
+// BuildGenerationConfig 根据模型与归一化参数生成 Vertex generationConfig，是三个网关共用的单一实现：
+//   - maxOutputTokens：Claude / Gemini 固定为各自上限，其他模型使用客户端值；
+//   - thinkingBudget：按 maxOutputTokens 预留余量截断（见 clampThinkingBudget）；
+//   - imageConfig / mediaResolution：按模型能力写出。
+func BuildGenerationConfig(model string, p GenerationParams) *vertex.GenerationConfig {
+	model = strings.TrimSpace(model)
+
+	cfg := &vertex.GenerationConfig{
+		CandidateCount:  max(p.CandidateCount, 1),
+		MaxOutputTokens: p.MaxOutputTokens,
+		Temperature:     p.Temperature,
+		TopP:            p.TopP,
+		TopK:            p.TopK,
+	}
+	if len(p.StopSequences) > 0 {
+		cfg.StopSequences = append([]string(nil), p.StopSequences...)
+	}
+
+	fixedMax := 0
+	switch {
+	case IsClaude(model):
+		fixedMax = ClaudeMaxOutputTokens
+	case IsGemini(model):
+		fixedMax = GeminiMaxOutputTokens
+	}
+	if fixedMax > 0 {
+		cfg.MaxOutputTokens = fixedMax
+	}
+
+	exact := p.ExactThinkingBudget
+	if tc, ok := ForcedThinkingConfig(model); ok {
+		cfg.ThinkingConfig, exact = tc, false
+	} else if p.Thinking != nil {
+		tc := *p.Thinking
+		cfg.ThinkingConfig = &tc
+	}
+	clampThinkingBudget(cfg, fixedMax > 0, exact)
+
+	if IsGeminiProImage(model) {
+		aspectRatio := strings.TrimSpace(p.ImageAspectRatio)
+		imageSize := strings.TrimSpace(p.ImageSize)
+		if forcedSize, _, ok := GeminiProImageSizeConfig(model); ok {
+			imageSize = forcedSize
+		}
+		if aspectRatio != "" || imageSize != "" {
+			cfg.ImageConfig = &vertex.ImageConfig{AspectRatio: aspectRatio, ImageSize: imageSize}
+		}
+	}
+
+	if IsGemini3(model) && !IsImageModel(model) {
+		resolution := config.Get().Gemini3MediaResolution
+		if p.MediaResolution != nil {
+			resolution = *p.MediaResolution
+		}
+		if v, ok := ToAPIMediaResolution(resolution); ok && v != "" {
+			cfg.MediaResolution = v
+		}
+	}
+	return cfg
+}
+
+// clampThinkingBudget 保证 thinkingBudget 与 maxOutputTokens 兼容：
+//   - 未给出 maxOutputTokens 时按预算加 ThinkingMaxOutputTokensOverheadTokens 补齐；
+//   - 上限固定的模型（Claude / Gemini）将预算截断到上限减去 ThinkingBudgetHeadroomTokens（不低于 ThinkingBudgetMinTokens），
+//     exact 且预算小于上限时原样保留；
+//   - 其他模型在预算不小于 maxOutputTokens 时调高 maxOutputTokens。
+func clampThinkingBudget(cfg *vertex.GenerationConfig, fixedMax, exact bool) {
+	tc := cfg.ThinkingConfig
+	if tc == nil || tc.ThinkingBudget <= 0 {
+		return
+	}
+	if cfg.MaxOutputTokens <= 0 {
+		cfg.MaxOutputTokens = tc.ThinkingBudget + ThinkingMaxOutputTokensOverheadTokens
+		return
+	}
+	if exact && tc.ThinkingBudget < cfg.MaxOutputTokens {
+		return
+	}
+	if fixedMax {
+		maxBudget := max(cfg.MaxOutputTokens-ThinkingBudgetHeadroomTokens, ThinkingBudgetMinTokens)
+		tc.ThinkingBudget = min(tc.ThinkingBudget, maxBudget)
+		return
+	}
+	if cfg.MaxOutputTokens <= tc.ThinkingBudget {
+		cfg.MaxOutputTokens = tc.ThinkingBudget + ThinkingMaxOutputTokensOverheadTokens
+	}
+}
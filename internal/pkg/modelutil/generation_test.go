@@ -0,0 +1,129 @@
+package modelutil
+
+import (
+	"reflect"
+	"testing"
+
+	"anti2api-golang/refactor/internal/config"
+	"anti2api-golang/refactor/internal/vertex"
+)
+
+func TestBuildGenerationConfig(t *testing.T) {
+	c := config.Get()
+	old := c.Gemini3MediaResolution
+	c.Gemini3MediaResolution = "low"
+	t.Cleanup(func() { c.Gemini3MediaResolution = old })
+
+	temp, topP := 0.5, 0.9
+	budget := func(n int) *vertex.ThinkingConfig {
+		return &vertex.ThinkingConfig{IncludeThoughts: true, ThinkingBudget: n}
+	}
+	str := func(s string) *string { return &s }
+
+	cases := []struct {
+		name  string
+		model string
+		p     GenerationParams
+		want  vertex.GenerationConfig
+	}{
+		{
+			name:  "claude fixed max and sampling params",
+			model: "claude-sonnet-4",
+			p:     GenerationParams{MaxOutputTokens: 1000, Temperature: &temp, TopP: &topP, TopK: 40, StopSequences: []string{"END"}},
+			want:  vertex.GenerationConfig{CandidateCount: 1, MaxOutputTokens: ClaudeMaxOutputTokens, Temperature: &temp, TopP: &topP, TopK: 40, StopSequences: []string{"END"}},
+		},
+		{
+			name:  "gemini fixed max",
+			model: "gemini-2.5-flash",
+			p:     GenerationParams{CandidateCount: 2, MaxOutputTokens: 1000},
+			want:  vertex.GenerationConfig{CandidateCount: 2, MaxOutputTokens: GeminiMaxOutputTokens},
+		},
+		{
+			name:  "other model uses client max",
+			model: "gpt-oss-120b-medium",
+			p:     GenerationParams{MaxOutputTokens: 2048},
+			want:  vertex.GenerationConfig{CandidateCount: 1, MaxOutputTokens: 2048},
+		},
+		{
+			name:  "other model derives max from budget",
+			model: "gpt-oss-120b-medium",
+			p:     GenerationParams{Thinking: budget(8000)},
+			want:  vertex.GenerationConfig{CandidateCount: 1, MaxOutputTokens: 8000 + ThinkingMaxOutputTokensOverheadTokens, ThinkingConfig: budget(8000)},
+		},
+		{
+			name:  "other model raises max above budget",
+			model: "gpt-oss-120b-medium",
+			p:     GenerationParams{MaxOutputTokens: 4000, Thinking: budget(8000)},
+			want:  vertex.GenerationConfig{CandidateCount: 1, MaxOutputTokens: 8000 + ThinkingMaxOutputTokensOverheadTokens, ThinkingConfig: budget(8000)},
+		},
+		{
+			name:  "claude budget keeps headroom",
+			model: "claude-opus-4-1-thinking",
+			p:     GenerationParams{Thinking: budget(70000)},
+			want:  vertex.GenerationConfig{CandidateCount: 1, MaxOutputTokens: ClaudeMaxOutputTokens, ThinkingConfig: budget(ClaudeMaxOutputTokens - ThinkingBudgetHeadroomTokens)},
+		},
+		{
+			name:  "claude exact budget below max",
+			model: "claude-opus-4-1-thinking",
+			p:     GenerationParams{Thinking: budget(63500), ExactThinkingBudget: true},
+			want:  vertex.GenerationConfig{CandidateCount: 1, MaxOutputTokens: ClaudeMaxOutputTokens, ThinkingConfig: budget(63500)},
+		},
+		{
+			name:  "claude exact budget at max is clamped",
+			model: "claude-opus-4-1-thinking",
+			p:     GenerationParams{Thinking: budget(ClaudeMaxOutputTokens), ExactThinkingBudget: true},
+			want:  vertex.GenerationConfig{CandidateCount: 1, MaxOutputTokens: ClaudeMaxOutputTokens, ThinkingConfig: budget(ClaudeMaxOutputTokens - ThinkingBudgetHeadroomTokens)},
+		},
+		{
+			name:  "gemini budget keeps headroom",
+			model: "gemini-2.5-pro",
+			p:     GenerationParams{Thinking: budget(70000)},
+			want:  vertex.GenerationConfig{CandidateCount: 1, MaxOutputTokens: GeminiMaxOutputTokens, ThinkingConfig: budget(GeminiMaxOutputTokens - ThinkingBudgetHeadroomTokens)},
+		},
+		{
+			name:  "forced thinking overrides client",
+			model: "gemini-3-flash",
+			p:     GenerationParams{Thinking: budget(8000), ExactThinkingBudget: true, MediaResolution: str("high")},
+			want:  vertex.GenerationConfig{CandidateCount: 1, MaxOutputTokens: GeminiMaxOutputTokens, ThinkingConfig: &vertex.ThinkingConfig{IncludeThoughts: true}, MediaResolution: "MEDIA_RESOLUTION_HIGH"},
+		},
+		{
+			name:  "gemini 3 global media resolution",
+			model: "gemini-3-pro",
+			want:  vertex.GenerationConfig{CandidateCount: 1, MaxOutputTokens: GeminiMaxOutputTokens, MediaResolution: "MEDIA_RESOLUTION_LOW"},
+		},
+		{
+			name:  "gemini 3 explicit empty media resolution",
+			model: "gemini-3-pro",
+			p:     GenerationParams{MediaResolution: str("")},
+			want:  vertex.GenerationConfig{CandidateCount: 1, MaxOutputTokens: GeminiMaxOutputTokens},
+		},
+		{
+			name:  "pro image forced size wins",
+			model: "gemini-3-pro-image-2k",
+			p:     GenerationParams{ImageAspectRatio: " 16:9 ", ImageSize: "4K", MediaResolution: str("high")},
+			want:  vertex.GenerationConfig{CandidateCount: 1, MaxOutputTokens: GeminiMaxOutputTokens, ImageConfig: &vertex.ImageConfig{AspectRatio: "16:9", ImageSize: "2K"}},
+		},
+		{
+			name:  "non image model ignores image config",
+			model: "gemini-2.5-flash",
+			p:     GenerationParams{ImageAspectRatio: "1:1", ImageSize: "1K"},
+			want:  vertex.GenerationConfig{CandidateCount: 1, MaxOutputTokens: GeminiMaxOutputTokens},
+		},
+	}
+	for _, tc := range cases {
+		got := BuildGenerationConfig(tc.model, tc.p)
+		if !reflect.DeepEqual(*got, tc.want) {
+			t.Errorf("%s:\n got  %+v (thinking %+v)\n want %+v (thinking %+v)", tc.name, *got, got.ThinkingConfig, tc.want, tc.want.ThinkingConfig)
+		}
+	}
+}
+
+func TestBuildGenerationConfig_DoesNotMutateParams(t *testing.T) {
+	tc := &vertex.ThinkingConfig{IncludeThoughts: true, ThinkingBudget: 70000}
+	stop := []string{"a"}
+	cfg := BuildGenerationConfig("claude-opus-4-1-thinking", GenerationParams{Thinking: tc, StopSequences: stop})
+	cfg.StopSequences[0] = "b"
+	if tc.ThinkingBudget != 70000 || stop[0] != "a" {
+		t.Fatalf("params mutated: thinking %+v, stop %v", tc, stop)
+	}
+}
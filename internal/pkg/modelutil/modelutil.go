@@ -5,6 +5,7 @@ import (
 	"strconv"
 	"strings"
 
+	"anti2api-golang/refactor/internal/config"
 	"anti2api-golang/refactor/internal/vertex"
 )
 
@@ -18,13 +19,21 @@ func CanonicalModelID(model string) string {
 	return strings.TrimSpace(m)
 }
 
+// canonicalLower 返回用于模型族判断的小写模型 ID；自定义虚拟模型（VIRTUAL_MODELS）按其后端模型判断。
 func canonicalLower(model string) string {
+	if vm, ok := CustomVirtualModel(model); ok {
+		model = vm.Backend
+	}
 	return strings.ToLower(CanonicalModelID(model))
 }
 
 // BackendModelID 将对外暴露的（可能包含虚拟前缀/别名的）model 映射为发送到 Vertex 的后端 model id。
 // 若无需映射，则返回规范化后的模型 ID 本身。
 func BackendModelID(model string) string {
+	// 自定义虚拟模型：按其后端模型继续映射（后端可以是内置虚拟模型）。
+	if vm, ok := CustomVirtualModel(model); ok {
+		model = vm.Backend
+	}
 	// 先处理已知的虚拟模型映射（可能会返回不同的后端 id）。
 	if _, backendModel, ok := Gemini3FlashThinkingConfig(model); ok {
 		return backendModel
@@ -145,15 +154,18 @@ func ThinkingConfigFromOpenAI(model, reasoningEffort string) *vertex.ThinkingCon
 	}
 
 	effort := strings.ToLower(strings.TrimSpace(reasoningEffort))
+	if effort == "none" {
+		return disabledThinkingConfig(model)
+	}
 
 	// 如果调用方显式选择 Claude “-thinking” 模型且未传 reasoning_effort，则默认开启 thinking。
 	if effort == "" && IsClaudeThinking(model) {
 		return &vertex.ThinkingConfig{IncludeThoughts: true, ThinkingBudget: DefaultClaudeThinkingBudgetTokens}
 	}
 
-	// Gemini 3（非 Flash）在 OpenAI 兼容语义下默认开启 thinking_level=high。
+	// Gemini 3（非 Flash）在 OpenAI 兼容语义下默认开启 thinking_level=high，reasoning_effort 映射为后端支持的等级。
 	if IsGemini3(model) && !IsGemini3Flash(model) {
-		return &vertex.ThinkingConfig{IncludeThoughts: true, ThinkingLevel: "high", ThinkingBudget: 0}
+		return &vertex.ThinkingConfig{IncludeThoughts: true, ThinkingLevel: Gemini3ThinkingLevel(effort), ThinkingBudget: 0}
 	}
 
 	if effort == "" {
@@ -174,6 +186,40 @@ func ThinkingConfigFromOpenAI(model, reasoningEffort string) *vertex.ThinkingCon
 	return &vertex.ThinkingConfig{IncludeThoughts: true, ThinkingLevel: effort}
 }
 
+// thinkingLevelRank 为 reasoning_effort / thinkingLevel 的强度顺序。
+var thinkingLevelRank = map[string]int{"minimal": 0, "low": 1, "medium": 2, "high": 3}
+
+// Gemini3ThinkingLevel 将 reasoning_effort 映射为 Gemini 3（非 Flash）后端支持的 thinkingLevel（GEMINI3_THINKING_LEVELS）：
+// 取不低于所请求强度的最低支持等级（例如只支持 low / high 时 medium 映射为 high）；为空、无法识别或超过所有支持等级时使用 high。
+func Gemini3ThinkingLevel(effort string) string {
+	rank, ok := thinkingLevelRank[strings.ToLower(strings.TrimSpace(effort))]
+	if !ok {
+		return "high"
+	}
+	best, bestRank := "high", len(thinkingLevelRank)
+	for _, level := range config.Get().Gemini3ThinkingLevels {
+		r, known := thinkingLevelRank[level]
+		if known && r >= rank && r < bestRank {
+			best, bestRank = level, r
+		}
+	}
+	return best
+}
+
+// disabledThinkingConfig 返回 reasoning_effort=none 对应的配置：尽可能关闭 thinking 且不返回思考内容。
+// Gemini 3 与 Gemini 2.5 Pro 无法完全关闭，使用最低的等级 / 预算。
+func disabledThinkingConfig(model string) *vertex.ThinkingConfig {
+	switch {
+	case IsGemini3(model):
+		return &vertex.ThinkingConfig{ThinkingLevel: Gemini3ThinkingLevel("minimal")}
+	case IsGemini25(model) && strings.Contains(canonicalLower(model), "pro"):
+		return &vertex.ThinkingConfig{ThinkingBudget: Gemini25ProMinThinkingBudget}
+	case IsGemini25(model):
+		return &vertex.ThinkingConfig{ThinkingBudget: 0}
+	}
+	return nil
+}
+
 // ThinkingConfigFromClaude 根据 Claude/Anthropic 兼容入参（thinking 对象）生成 Vertex ThinkingConfig。
 // thinkingType 需为 "enabled" 才会生效。
 func ThinkingConfigFromClaude(model, thinkingType string, budget, budgetTokens int) *vertex.ThinkingConfig {
@@ -245,6 +291,39 @@ func ThinkingConfigFromGemini(model string, includeThoughts bool, thinkingBudget
 	return tc
 }
 
+// OverrideThinking 用请求级覆盖（X-Thinking-Budget / X-Thinking-Level）替换 cfg 中已计算的 ThinkingConfig：
+// budget < 0 表示未指定预算，level 为空表示未指定等级；budget == 0 或 level 为 "off" / "none" 时关闭 thinking。
+// Gemini 3 优先使用等级，其他模型优先使用预算（只给出等级时按 reasoning_effort 的历史映射换算）；
+// 预算会按 maxOutputTokens 预留余量后截断。
+func OverrideThinking(model string, cfg *vertex.GenerationConfig, budget int, level string) {
+	if cfg == nil || (budget < 0 && level == "") {
+		return
+	}
+	level = strings.ToLower(strings.TrimSpace(level))
+	if budget == 0 || level == "off" || level == "none" {
+		cfg.ThinkingConfig = nil
+		return
+	}
+
+	tc := &vertex.ThinkingConfig{IncludeThoughts: true}
+	switch {
+	case level != "" && (IsGemini3(model) || budget < 0) && !IsClaude(model) && !IsGemini25(model):
+		tc.ThinkingLevel = level
+	case budget > 0:
+		tc.ThinkingBudget = budget
+	case IsClaude(model):
+		tc.ThinkingBudget = mapEffortToBudget(level)
+	default:
+		tc.ThinkingBudget = mapGemini25EffortToBudget(level)
+	}
+
+	if tc.ThinkingBudget > 0 && cfg.MaxOutputTokens > 0 {
+		maxBudget := max(cfg.MaxOutputTokens-ThinkingBudgetHeadroomTokens, ThinkingBudgetMinTokens)
+		tc.ThinkingBudget = min(tc.ThinkingBudget, maxBudget)
+	}
+	cfg.ThinkingConfig = tc
+}
+
 // BuildSortedModelIDs 将 Vertex 返回的 models map key 规范化、去重、注入虚拟模型，并按字典序排序返回。
 func BuildSortedModelIDs(models map[string]any) []string {
 	ids := make([]string, 0, len(models)+5)
@@ -303,6 +382,21 @@ func BuildSortedModelIDs(models map[string]any) []string {
 		}
 	}
 
+	// 自定义虚拟模型：后端模型（或其对应的内置虚拟模型）存在时注入。
+	for _, vm := range config.Get().VirtualModels {
+		if _, ok := seen[vm.Name]; ok {
+			continue
+		}
+		backend := BackendModelID(vm.Name)
+		for _, idv := range ids {
+			if strings.EqualFold(idv, backend) {
+				seen[vm.Name] = struct{}{}
+				ids = append(ids, vm.Name)
+				break
+			}
+		}
+	}
+
 	sort.Strings(ids)
 	return ids
 }
@@ -0,0 +1,42 @@
+package modelutil
+
+import (
+	"testing"
+
+	"anti2api-golang/refactor/internal/config"
+)
+
+func TestThinkingConfigFromOpenAI_Gemini3Levels(t *testing.T) {
+	c := config.Get()
+	old := c.Gemini3ThinkingLevels
+	t.Cleanup(func() { c.Gemini3ThinkingLevels = old })
+
+	c.Gemini3ThinkingLevels = []string{"low", "high"}
+	cases := map[string]string{"": "high", "minimal": "low", "low": "low", "medium": "high", "high": "high", "xhigh": "high"}
+	for effort, want := range cases {
+		tc := ThinkingConfigFromOpenAI("gemini-3-pro-preview", effort)
+		if tc == nil || !tc.IncludeThoughts || tc.ThinkingLevel != want {
+			t.Errorf("effort %q: got %+v, want level %s", effort, tc, want)
+		}
+	}
+
+	c.Gemini3ThinkingLevels = []string{"low", "medium", "high"}
+	if tc := ThinkingConfigFromOpenAI("gemini-3-pro-preview", "medium"); tc.ThinkingLevel != "medium" {
+		t.Errorf("medium should be used when supported, got %q", tc.ThinkingLevel)
+	}
+}
+
+func TestThinkingConfigFromOpenAI_None(t *testing.T) {
+	if tc := ThinkingConfigFromOpenAI("gemini-3-pro-preview", "none"); tc == nil || tc.IncludeThoughts || tc.ThinkingLevel != "low" {
+		t.Errorf("gemini 3: got %+v, want lowest level without thoughts", tc)
+	}
+	if tc := ThinkingConfigFromOpenAI("gemini-2.5-flash", "none"); tc == nil || tc.IncludeThoughts || tc.ThinkingBudget != 0 {
+		t.Errorf("gemini 2.5 flash: got %+v, want budget 0", tc)
+	}
+	if tc := ThinkingConfigFromOpenAI("gemini-2.5-pro", "none"); tc == nil || tc.IncludeThoughts || tc.ThinkingBudget != Gemini25ProMinThinkingBudget {
+		t.Errorf("gemini 2.5 pro: got %+v, want minimum budget", tc)
+	}
+	if tc := ThinkingConfigFromOpenAI("claude-sonnet-4-thinking", "none"); tc != nil {
+		t.Errorf("claude: got %+v, want thinking disabled", tc)
+	}
+}
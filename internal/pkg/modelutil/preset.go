@@ -0,0 +1,45 @@
+package modelutil
+
+import (
+	"sort"
+	"strings"
+
+	"anti2api-golang/refactor/internal/config"
+	"anti2api-golang/refactor/internal/vertex"
+)
+
+// PresetModel 返回应用 API Key 预设后的模型：覆盖模式下总是使用预设模型，否则仅在请求未指定模型时使用。
+func PresetModel(p config.APIKeyPreset, model string) string {
+	if p.Model == "" {
+		return model
+	}
+	if p.Override || strings.TrimSpace(model) == "" {
+		return p.Model
+	}
+	return model
+}
+
+// ApplyPreset 将 API Key 预设的 generationConfig 字段应用到 cfg（在虚拟模型覆盖之后调用）：
+// 覆盖模式下总是覆盖，否则只填充请求未设置的字段。非法的值会被忽略（启动时由 ValidateAPIKeyPresets 报告）。
+func ApplyPreset(p config.APIKeyPreset, cfg *vertex.GenerationConfig) *vertex.GenerationConfig {
+	return applyOverrides(p.Overrides, cfg, !p.Override)
+}
+
+// ValidateAPIKeyPresets 检查 API_KEY_PRESETS 中的定义，返回问题描述（为空表示全部有效）。
+// 问题描述中的 key 只保留前 4 个字符，避免在日志中泄露完整密钥。
+func ValidateAPIKeyPresets() []string {
+	var problems []string
+	for key, p := range config.Get().APIKeyPresets {
+		owner := "API Key " + maskKey(key) + " 的预设"
+		problems = append(problems, overrideProblems(owner, p.Overrides)...)
+	}
+	sort.Strings(problems)
+	return problems
+}
+
+func maskKey(key string) string {
+	if len(key) <= 4 {
+		return "****"
+	}
+	return key[:4] + "****"
+}
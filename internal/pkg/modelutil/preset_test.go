@@ -0,0 +1,67 @@
+package modelutil
+
+import (
+	"reflect"
+	"testing"
+
+	"anti2api-golang/refactor/internal/config"
+	"anti2api-golang/refactor/internal/vertex"
+)
+
+func TestPresetModel(t *testing.T) {
+	fill := config.APIKeyPreset{Model: "gemini-3-flash"}
+	if got := PresetModel(fill, ""); got != "gemini-3-flash" {
+		t.Fatalf("missing model should use preset, got %q", got)
+	}
+	if got := PresetModel(fill, "claude-sonnet-4-5"); got != "claude-sonnet-4-5" {
+		t.Fatalf("explicit model should win in default mode, got %q", got)
+	}
+	if got := PresetModel(config.APIKeyPreset{Model: "gemini-3-flash", Override: true}, "claude-sonnet-4-5"); got != "gemini-3-flash" {
+		t.Fatalf("override mode should replace model, got %q", got)
+	}
+	if got := PresetModel(config.APIKeyPreset{Override: true}, "claude-sonnet-4-5"); got != "claude-sonnet-4-5" {
+		t.Fatalf("preset without model must keep request model, got %q", got)
+	}
+}
+
+func TestApplyPreset(t *testing.T) {
+	overrides := map[string]string{"temperature": "0.3", "topk": "20", "thinkinglevel": "low", "thinkingbudget": "2048"}
+	reqTemp := 1.0
+
+	// 默认模式：只填充请求未设置的字段；thinking 字段以应用前是否存在 thinkingConfig 判断。
+	cfg := ApplyPreset(config.APIKeyPreset{Overrides: overrides}, &vertex.GenerationConfig{Temperature: &reqTemp})
+	if *cfg.Temperature != 1.0 || cfg.TopK != 20 {
+		t.Fatalf("fill mode mismatch: temperature=%v topK=%d", *cfg.Temperature, cfg.TopK)
+	}
+	if cfg.ThinkingConfig == nil || cfg.ThinkingConfig.ThinkingBudget != 2048 {
+		t.Fatalf("thinking preset should apply when request has none: %+v", cfg.ThinkingConfig)
+	}
+	cfg = ApplyPreset(config.APIKeyPreset{Overrides: overrides}, &vertex.GenerationConfig{ThinkingConfig: &vertex.ThinkingConfig{ThinkingLevel: "high"}})
+	if cfg.ThinkingConfig.ThinkingLevel != "high" || cfg.ThinkingConfig.ThinkingBudget != 0 {
+		t.Fatalf("request thinking config must be kept in fill mode: %+v", cfg.ThinkingConfig)
+	}
+
+	// 覆盖模式：总是覆盖。
+	cfg = ApplyPreset(config.APIKeyPreset{Override: true, Overrides: map[string]string{"temperature": "0.3"}}, &vertex.GenerationConfig{Temperature: &reqTemp})
+	if *cfg.Temperature != 0.3 {
+		t.Fatalf("override mode should replace temperature, got %v", *cfg.Temperature)
+	}
+	if cfg := ApplyPreset(config.APIKeyPreset{Model: "gemini-3-flash"}, nil); cfg != nil {
+		t.Fatal("preset without overrides must leave config alone")
+	}
+}
+
+func TestValidateAPIKeyPresets(t *testing.T) {
+	c := config.Get()
+	old := c.APIKeyPresets
+	c.APIKeyPresets = map[string]config.APIKeyPreset{
+		"sk-secret-key": {Overrides: map[string]string{"topk": "many", "temperature": "0.2"}},
+		"sk":            {Model: "gemini-3-flash", Overrides: map[string]string{"colour": "blue"}},
+	}
+	t.Cleanup(func() { c.APIKeyPresets = old })
+
+	got := ValidateAPIKeyPresets()
+	if !reflect.DeepEqual(got, []string{"API Key **** 的预设：未知字段 colour", `API Key sk-s**** 的预设：topk="many" 无效（strconv.Atoi: parsing "many": invalid syntax）`}) {
+		t.Fatalf("problems = %q", got)
+	}
+}
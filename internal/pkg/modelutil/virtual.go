@@ -0,0 +1,231 @@
+package modelutil
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"anti2api-golang/refactor/internal/config"
+	"anti2api-golang/refactor/internal/vertex"
+)
+
+// CustomVirtualModel 返回 VIRTUAL_MODELS 中名为 model 的自定义虚拟模型（忽略大小写与 "models/" 前缀）。
+//
+// 自定义虚拟模型在模型族判断（IsGemini / IsClaude / ForcedThinkingConfig 等）中等同于其后端模型，
+// 后端模型本身也可以是内置虚拟模型（例如 gemini-3-pro-image-4k），但不能再指向另一个自定义虚拟模型。
+func CustomVirtualModel(model string) (config.VirtualModel, bool) {
+	m := CanonicalModelID(model)
+	if m == "" {
+		return config.VirtualModel{}, false
+	}
+	for _, vm := range config.Get().VirtualModels {
+		if strings.EqualFold(vm.Name, m) {
+			return vm, true
+		}
+	}
+	return config.VirtualModel{}, false
+}
+
+// virtualOverride 解析并应用单个覆盖字段；值非法时返回错误且不修改 cfg。
+type virtualOverride func(cfg *vertex.GenerationConfig, value string) error
+
+// virtualOverrideOrder 为覆盖字段的应用顺序（thinking=off 最后应用，避免被同一定义中的其他 thinking 字段覆盖）。
+var virtualOverrideOrder = []string{
+	"temperature", "topp", "topk", "maxoutputtokens",
+	"thinkinglevel", "thinkingbudget", "includethoughts",
+	"imagesize", "aspectratio", "mediaresolution", "thinking",
+}
+
+var virtualOverrides = map[string]virtualOverride{
+	"temperature": func(cfg *vertex.GenerationConfig, v string) error {
+		f, err := strconv.ParseFloat(v, 64)
+		if err != nil {
+			return err
+		}
+		cfg.Temperature = &f
+		return nil
+	},
+	"topp": func(cfg *vertex.GenerationConfig, v string) error {
+		f, err := strconv.ParseFloat(v, 64)
+		if err != nil {
+			return err
+		}
+		cfg.TopP = &f
+		return nil
+	},
+	"topk": func(cfg *vertex.GenerationConfig, v string) error {
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			return err
+		}
+		cfg.TopK = n
+		return nil
+	},
+	"maxoutputtokens": func(cfg *vertex.GenerationConfig, v string) error {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 {
+			return fmt.Errorf("需要正整数")
+		}
+		cfg.MaxOutputTokens = n
+		return nil
+	},
+	"thinking": func(cfg *vertex.GenerationConfig, v string) error {
+		if !strings.EqualFold(v, "off") {
+			return fmt.Errorf("仅支持 off")
+		}
+		cfg.ThinkingConfig = nil
+		return nil
+	},
+	"thinkinglevel": func(cfg *vertex.GenerationConfig, v string) error {
+		if v == "" {
+			return fmt.Errorf("不能为空")
+		}
+		if cfg.ThinkingConfig == nil {
+			cfg.ThinkingConfig = &vertex.ThinkingConfig{}
+		}
+		cfg.ThinkingConfig.IncludeThoughts = true
+		cfg.ThinkingConfig.ThinkingLevel = strings.ToLower(v)
+		cfg.ThinkingConfig.ThinkingBudget = 0
+		return nil
+	},
+	"thinkingbudget": func(cfg *vertex.GenerationConfig, v string) error {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			return fmt.Errorf("需要非负整数")
+		}
+		if cfg.ThinkingConfig == nil {
+			cfg.ThinkingConfig = &vertex.ThinkingConfig{}
+		}
+		cfg.ThinkingConfig.IncludeThoughts = n > 0
+		cfg.ThinkingConfig.ThinkingBudget = n
+		cfg.ThinkingConfig.ThinkingLevel = ""
+		return nil
+	},
+	"includethoughts": func(cfg *vertex.GenerationConfig, v string) error {
+		b, err := strconv.ParseBool(v)
+		if err != nil {
+			return err
+		}
+		if cfg.ThinkingConfig == nil {
+			cfg.ThinkingConfig = &vertex.ThinkingConfig{}
+		}
+		cfg.ThinkingConfig.IncludeThoughts = b
+		return nil
+	},
+	"imagesize": func(cfg *vertex.GenerationConfig, v string) error {
+		switch strings.ToUpper(v) {
+		case "1K", "2K", "4K":
+		default:
+			return fmt.Errorf("仅支持 1K / 2K / 4K")
+		}
+		if cfg.ImageConfig == nil {
+			cfg.ImageConfig = &vertex.ImageConfig{}
+		}
+		cfg.ImageConfig.ImageSize = strings.ToUpper(v)
+		return nil
+	},
+	"aspectratio": func(cfg *vertex.GenerationConfig, v string) error {
+		if v == "" {
+			return fmt.Errorf("不能为空")
+		}
+		if cfg.ImageConfig == nil {
+			cfg.ImageConfig = &vertex.ImageConfig{}
+		}
+		cfg.ImageConfig.AspectRatio = v
+		return nil
+	},
+	"mediaresolution": func(cfg *vertex.GenerationConfig, v string) error {
+		apiValue, ok := ToAPIMediaResolution(v)
+		if !ok {
+			return fmt.Errorf("仅支持 low / medium / high")
+		}
+		cfg.MediaResolution = apiValue
+		return nil
+	},
+}
+
+// ApplyVirtualModel 对自定义虚拟模型强制应用其 generationConfig 覆盖（在各接口构建完 generationConfig 之后调用），
+// 返回应用后的配置；cfg 为 nil 且存在覆盖时会新建。非自定义虚拟模型原样返回 cfg。非法的覆盖值会被忽略（启动时由 ValidateVirtualModels 报告）。
+func ApplyVirtualModel(model string, cfg *vertex.GenerationConfig) *vertex.GenerationConfig {
+	vm, ok := CustomVirtualModel(model)
+	if !ok {
+		return cfg
+	}
+	return applyOverrides(vm.Overrides, cfg, false)
+}
+
+// overrideIsSet 判断 cfg 中某个覆盖字段是否已有值（用于只填充缺省值的场景）；thinking 相关字段以 thinkingConfig 是否存在为准。
+func overrideIsSet(key string, cfg *vertex.GenerationConfig) bool {
+	switch key {
+	case "temperature":
+		return cfg.Temperature != nil
+	case "topp":
+		return cfg.TopP != nil
+	case "topk":
+		return cfg.TopK != 0
+	case "maxoutputtokens":
+		return cfg.MaxOutputTokens > 0
+	case "thinking", "thinkinglevel", "thinkingbudget", "includethoughts":
+		return cfg.ThinkingConfig != nil
+	case "imagesize":
+		return cfg.ImageConfig != nil && cfg.ImageConfig.ImageSize != ""
+	case "aspectratio":
+		return cfg.ImageConfig != nil && cfg.ImageConfig.AspectRatio != ""
+	case "mediaresolution":
+		return cfg.MediaResolution != ""
+	}
+	return false
+}
+
+// applyOverrides 按 virtualOverrideOrder 应用 overrides；fillOnly 为 true 时跳过 cfg 中已有值的字段（以应用前的状态判断）。
+func applyOverrides(overrides map[string]string, cfg *vertex.GenerationConfig, fillOnly bool) *vertex.GenerationConfig {
+	if len(overrides) == 0 {
+		return cfg
+	}
+	if cfg == nil {
+		cfg = &vertex.GenerationConfig{}
+	}
+	var skip map[string]bool
+	if fillOnly {
+		skip = make(map[string]bool, len(overrides))
+		for key := range overrides {
+			skip[key] = overrideIsSet(key, cfg)
+		}
+	}
+	for _, key := range virtualOverrideOrder {
+		if value, ok := overrides[key]; ok && !skip[key] {
+			_ = virtualOverrides[key](cfg, value)
+		}
+	}
+	return cfg
+}
+
+// overrideProblems 检查一组覆盖字段，owner 用于问题描述的前缀。
+func overrideProblems(owner string, overrides map[string]string) []string {
+	var problems []string
+	for key, value := range overrides {
+		apply, ok := virtualOverrides[key]
+		if !ok {
+			problems = append(problems, fmt.Sprintf("%s：未知字段 %s", owner, key))
+			continue
+		}
+		if err := apply(&vertex.GenerationConfig{}, value); err != nil {
+			problems = append(problems, fmt.Sprintf("%s：%s=%q 无效（%v）", owner, key, value, err))
+		}
+	}
+	return problems
+}
+
+// ValidateVirtualModels 检查 VIRTUAL_MODELS 中的定义，返回问题描述（为空表示全部有效）。
+func ValidateVirtualModels() []string {
+	var problems []string
+	for _, vm := range config.Get().VirtualModels {
+		if _, ok := CustomVirtualModel(vm.Backend); ok {
+			problems = append(problems, fmt.Sprintf("虚拟模型 %s 的后端 %s 不能是另一个自定义虚拟模型", vm.Name, vm.Backend))
+		}
+		problems = append(problems, overrideProblems("虚拟模型 "+vm.Name, vm.Overrides)...)
+	}
+	sort.Strings(problems)
+	return problems
+}
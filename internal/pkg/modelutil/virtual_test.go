@@ -0,0 +1,65 @@
+package modelutil
+
+import (
+	"reflect"
+	"testing"
+
+	"anti2api-golang/refactor/internal/config"
+	"anti2api-golang/refactor/internal/vertex"
+)
+
+func withVirtualModels(t *testing.T, vms ...config.VirtualModel) {
+	t.Helper()
+	c := config.Get()
+	old := c.VirtualModels
+	c.VirtualModels = vms
+	t.Cleanup(func() { c.VirtualModels = old })
+}
+
+func TestCustomVirtualModel_ResolvesToBackend(t *testing.T) {
+	withVirtualModels(t,
+		config.VirtualModel{Name: "gemini-3-pro-creative", Backend: "gemini-3-pro-high", Overrides: map[string]string{"temperature": "1.4", "thinkinglevel": "low"}},
+		config.VirtualModel{Name: "banana-wide", Backend: "gemini-3-pro-image-4k", Overrides: map[string]string{"aspectratio": "16:9"}},
+		config.VirtualModel{Name: "fast-sonnet", Backend: "claude-sonnet-4-5", Overrides: map[string]string{"thinking": "off"}},
+	)
+
+	if got := BackendModelID("models/Gemini-3-Pro-Creative"); got != "gemini-3-pro-high" {
+		t.Fatalf("BackendModelID = %q", got)
+	}
+	if got := BackendModelID("banana-wide"); got != "gemini-3-pro-image" {
+		t.Fatalf("BackendModelID(banana-wide) = %q; want built-in virtual mapping", got)
+	}
+	if !IsGemini3("gemini-3-pro-creative") || !IsImageModel("banana-wide") || !IsClaude("fast-sonnet") {
+		t.Fatal("custom virtual models should be classified by their backend model")
+	}
+	if size, _, ok := GeminiProImageSizeConfig("banana-wide"); !ok || size != "4K" {
+		t.Fatalf("imageSize should follow the backend virtual model, got %q %v", size, ok)
+	}
+
+	cfg := ApplyVirtualModel("gemini-3-pro-creative", &vertex.GenerationConfig{ThinkingConfig: &vertex.ThinkingConfig{IncludeThoughts: true, ThinkingLevel: "high"}})
+	if cfg.Temperature == nil || *cfg.Temperature != 1.4 || cfg.ThinkingConfig.ThinkingLevel != "low" {
+		t.Fatalf("overrides not applied: %+v %+v", cfg, cfg.ThinkingConfig)
+	}
+	if cfg := ApplyVirtualModel("fast-sonnet", &vertex.GenerationConfig{ThinkingConfig: &vertex.ThinkingConfig{IncludeThoughts: true}}); cfg.ThinkingConfig != nil {
+		t.Fatal("thinking=off should drop thinkingConfig")
+	}
+	if cfg := ApplyVirtualModel("gemini-2.5-pro", nil); cfg != nil {
+		t.Fatal("non-virtual models must be left alone")
+	}
+
+	ids := BuildSortedModelIDs(map[string]any{"gemini-3-pro-high": nil, "gemini-3-pro-image": nil})
+	want := []string{"banana-wide", "gemini-3-pro-creative", "gemini-3-pro-high", "gemini-3-pro-image", "gemini-3-pro-image-1k", "gemini-3-pro-image-2k", "gemini-3-pro-image-4k"}
+	if !reflect.DeepEqual(ids, want) {
+		t.Fatalf("model ids = %v; want %v", ids, want)
+	}
+}
+
+func TestValidateVirtualModels(t *testing.T) {
+	withVirtualModels(t,
+		config.VirtualModel{Name: "a", Backend: "gemini-2.5-pro", Overrides: map[string]string{"temperature": "hot", "colour": "blue"}},
+		config.VirtualModel{Name: "b", Backend: "a", Overrides: map[string]string{}},
+	)
+	if got := ValidateVirtualModels(); len(got) != 3 {
+		t.Fatalf("expected 3 problems, got %v", got)
+	}
+}
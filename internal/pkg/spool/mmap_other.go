@@ -0,0 +1,17 @@
+//go:build !unix
+
+package spool
+
+import (
+	"io"
+	"os"
+)
+
+// mapFile 在不支持 mmap 的平台上退化为整体读入内存（仍只保留一份请求体，不再额外持有读取缓冲）。
+func mapFile(f *os.File, size int64) ([]byte, func() error, error) {
+	data := make([]byte, size)
+	if _, err := f.ReadAt(data, 0); err != nil && err != io.EOF {
+		return nil, nil, err
+	}
+	return data, func() error { return nil }, nil
+}
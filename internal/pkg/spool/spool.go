@@ -0,0 +1,159 @@
+// Package spool 读取请求体：超过 REQUEST_SPOOL_BYTES 的请求体（例如携带大量图片的多 MB base64）先写入临时文件，
+// 再以只读 mmap 的方式交给 JSON 解码器，原始请求体不占用 Go 堆，由内核按需换入 / 回收页缓存，
+// 从而限制小内存容器中单个大请求的峰值内存。
+package spool
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+
+	"anti2api-golang/refactor/internal/config"
+)
+
+// mapPadding 为映射区域末尾追加的零字节数：部分 SIMD JSON 解码实现会越过输入末尾少量读取，
+// 不留余量时恰好结束在页边界的文件可能触发 SIGBUS / SIGSEGV。
+const mapPadding = 64
+
+// Body 为读取完毕的请求体，使用完后必须调用 Close 释放映射。
+type Body struct {
+	data    []byte
+	release func() error
+	spooled bool
+}
+
+// Bytes 返回请求体内容；落盘的请求体在 Close 之后不可再访问（解码出的字符串已复制，见 pkg/json 的 CopyString）。
+func (b *Body) Bytes() []byte { return b.data }
+
+// Spooled 表示请求体是否经过临时文件。
+func (b *Body) Spooled() bool { return b.spooled }
+
+// Close 释放落盘请求体的映射；内存中的请求体无需释放。
+func (b *Body) Close() error {
+	if b == nil || b.release == nil {
+		return nil
+	}
+	release := b.release
+	b.release, b.data = nil, nil
+	return release()
+}
+
+// Reader 返回从头读取 b 的 ReadCloser，Close 时释放 b。ReadRequest 遇到尚未读取的 Reader 时直接复用 b，
+// 因此中间件（例如 HMAC 签名校验）读取过的请求体不会被再次复制或落盘。
+func (b *Body) Reader() io.ReadCloser {
+	return &bodyReader{body: b}
+}
+
+type bodyReader struct {
+	body *Body
+	off  int
+}
+
+func (r *bodyReader) Read(p []byte) (int, error) {
+	// Close 之后 data 为 nil（映射已释放），此时视为读取结束。
+	data := r.body.data
+	if r.off >= len(data) {
+		return 0, io.EOF
+	}
+	n := copy(p, data[r.off:])
+	r.off += n
+	return n, nil
+}
+
+func (r *bodyReader) Close() error {
+	return r.body.Close()
+}
+
+// Unread 在 rc 为尚未读取的 Body.Reader 时返回其内容（不复制），供中间件在不消耗请求体的情况下查看。
+func Unread(rc io.ReadCloser) ([]byte, bool) {
+	if br, ok := rc.(*bodyReader); ok && br.off == 0 {
+		return br.body.data, true
+	}
+	return nil, false
+}
+
+// ReadRequest 按配置读取 r 的请求体；r.Body 为尚未读取的 Body.Reader 时直接返回对应的 Body。
+func ReadRequest(r *http.Request) (*Body, error) {
+	if br, ok := r.Body.(*bodyReader); ok && br.off == 0 {
+		return br.body, nil
+	}
+	return readRequest(r, r.Body)
+}
+
+// ReadRequestTee 与 ReadRequest 相同，读取的同时把请求体写入 w（例如计算哈希），不需要在内存中保留完整的请求体。
+func ReadRequestTee(r *http.Request, w io.Writer) (*Body, error) {
+	return readRequest(r, io.TeeReader(r.Body, w))
+}
+
+func readRequest(r *http.Request, src io.Reader) (*Body, error) {
+	cfg := config.Get()
+	dir := cfg.SpoolDir
+	if dir == "" {
+		dir = filepath.Join(cfg.DataDir, "spool")
+		if config.DataDirReadOnly() {
+			dir = os.TempDir()
+		}
+	}
+	return Read(src, r.ContentLength, int64(cfg.SpoolBodyBytes), dir)
+}
+
+// Read 读取 src：threshold <= 0 或内容不超过 threshold 时保存在内存中，否则写入 dir 下的临时文件并映射。
+// size 为已知的内容长度（Content-Length，未知时为 -1），超过阈值时直接落盘，不在内存中缓冲前 threshold 字节。
+func Read(src io.Reader, size, threshold int64, dir string) (*Body, error) {
+	if threshold <= 0 {
+		data, err := io.ReadAll(src)
+		return &Body{data: data}, err
+	}
+
+	var head []byte
+	if size < 0 || size <= threshold {
+		var buf bytes.Buffer
+		if size > 0 {
+			buf.Grow(int(size))
+		}
+		if _, err := io.CopyN(&buf, src, threshold+1); err != nil {
+			if err == io.EOF {
+				return &Body{data: buf.Bytes()}, nil
+			}
+			return nil, err
+		}
+		head = buf.Bytes()
+	}
+	return spoolToFile(head, src, dir)
+}
+
+func spoolToFile(head []byte, src io.Reader, dir string) (*Body, error) {
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, err
+	}
+	f, err := os.CreateTemp(dir, "body-*")
+	if err != nil {
+		return nil, err
+	}
+	// 映射建立后即可删除文件（Unix 下映射在 munmap 前保持有效），进程异常退出也不会遗留临时文件。
+	defer func() {
+		_ = f.Close()
+		_ = os.Remove(f.Name())
+	}()
+
+	n, err := f.Write(head)
+	if err != nil {
+		return nil, err
+	}
+	rest, err := io.Copy(f, src)
+	if err != nil {
+		return nil, err
+	}
+	size := int64(n) + rest
+	if err := f.Truncate(size + mapPadding); err != nil {
+		return nil, err
+	}
+
+	data, release, err := mapFile(f, size+mapPadding)
+	if err != nil {
+		return nil, err
+	}
+	return &Body{data: data[:size], release: release, spooled: true}, nil
+}
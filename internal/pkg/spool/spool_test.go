@@ -0,0 +1,99 @@
+package spool
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"anti2api-golang/refactor/internal/config"
+	jsonpkg "anti2api-golang/refactor/internal/pkg/json"
+)
+
+func TestRead_SmallBodyStaysInMemory(t *testing.T) {
+	dir := t.TempDir()
+	b, err := Read(strings.NewReader(`{"a":1}`), -1, 64, dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer b.Close()
+	if b.Spooled() || string(b.Bytes()) != `{"a":1}` {
+		t.Fatalf("spooled=%v body=%q", b.Spooled(), b.Bytes())
+	}
+}
+
+func TestRead_LargeBodySpoolsToFile(t *testing.T) {
+	payload := `{"text":"` + strings.Repeat("x", 4096) + `"}`
+	for _, size := range []int64{-1, int64(len(payload))} {
+		dir := t.TempDir()
+		b, err := Read(strings.NewReader(payload), size, 1024, dir)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !b.Spooled() || !bytes.Equal(b.Bytes(), []byte(payload)) {
+			t.Fatalf("size=%d: spooled=%v len=%d", size, b.Spooled(), len(b.Bytes()))
+		}
+		// 临时文件在映射建立后即删除。
+		if entries, _ := os.ReadDir(dir); len(entries) != 0 {
+			t.Fatalf("size=%d: temp files left behind: %v", size, entries)
+		}
+
+		var v struct{ Text string }
+		if err := jsonpkg.Unmarshal(b.Bytes(), &v); err != nil {
+			t.Fatal(err)
+		}
+		if err := b.Close(); err != nil {
+			t.Fatal(err)
+		}
+		// 解码出的字符串不引用映射区域，Close 之后仍可访问。
+		if len(v.Text) != 4096 || strings.Trim(v.Text, "x") != "" {
+			t.Fatalf("decoded text corrupted after Close")
+		}
+	}
+}
+
+func TestRead_ThresholdDisabled(t *testing.T) {
+	b, err := Read(strings.NewReader(strings.Repeat("y", 2048)), -1, 0, t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b.Spooled() || len(b.Bytes()) != 2048 {
+		t.Fatalf("spooled=%v len=%d", b.Spooled(), len(b.Bytes()))
+	}
+}
+
+func TestReadRequestTee_ReusedByReadRequest(t *testing.T) {
+	cfg := config.Get()
+	oldBytes, oldDir := cfg.SpoolBodyBytes, cfg.SpoolDir
+	t.Cleanup(func() { cfg.SpoolBodyBytes, cfg.SpoolDir = oldBytes, oldDir })
+	cfg.SpoolBodyBytes, cfg.SpoolDir = 16, t.TempDir()
+
+	payload := strings.Repeat("z", 100)
+	r := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(payload))
+	var tee bytes.Buffer
+	b, err := ReadRequestTee(r, &tee)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !b.Spooled() || tee.String() != payload {
+		t.Fatalf("spooled=%v tee=%d bytes", b.Spooled(), tee.Len())
+	}
+
+	r.Body = b.Reader()
+	again, err := ReadRequest(r)
+	if err != nil || again != b {
+		t.Fatalf("an unread Body.Reader should be reused, got %p (%v)", again, err)
+	}
+	if err := again.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if n, err := r.Body.Read(make([]byte, 8)); n != 0 || err != io.EOF {
+		t.Fatalf("reading after Close should report EOF, got %d, %v", n, err)
+	}
+	if err := r.Body.Close(); err != nil {
+		t.Fatalf("closing twice should be harmless: %v", err)
+	}
+}
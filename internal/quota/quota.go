@@ -0,0 +1,111 @@
+// Package quota 保存各账号最近一次获取的配额快照（由管理面板与后台定时刷新写入），
+// 供生成接口按服务账号与模型返回剩余配额响应头。
+package quota
+
+import (
+	"strings"
+	"sync"
+	"time"
+)
+
+// Group 为一个配额组（共享配额的一组模型）。
+type Group struct {
+	GroupName         string   `json:"groupName"`
+	RemainingFraction *float64 `json:"remainingFraction,omitempty"`
+	ResetTime         string   `json:"resetTime,omitempty"`
+	ModelList         []string `json:"modelList,omitempty"`
+}
+
+type snapshot struct {
+	groups    []Group
+	fetchedAt time.Time
+}
+
+var (
+	mu        sync.RWMutex
+	snapshots = make(map[string]snapshot)
+)
+
+// Put 记录账号（按 SessionID）的配额快照。
+func Put(sessionID string, groups []Group, fetchedAt time.Time) {
+	if sessionID == "" {
+		return
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	snapshots[sessionID] = snapshot{groups: groups, fetchedAt: fetchedAt}
+}
+
+// Lookup 返回账号快照中包含 model 的配额组（model 为后端模型 ID，忽略大小写与 "models/" 前缀）及快照时间。
+func Lookup(sessionID, model string) (Group, time.Time, bool) {
+	model = normalizeModel(model)
+	mu.RLock()
+	defer mu.RUnlock()
+	snap, ok := snapshots[sessionID]
+	if !ok || model == "" {
+		return Group{}, time.Time{}, false
+	}
+	for _, g := range snap.groups {
+		for _, m := range g.ModelList {
+			if strings.EqualFold(m, model) {
+				return g, snap.fetchedAt, true
+			}
+		}
+	}
+	return Group{}, time.Time{}, false
+}
+
+// Available 按账号快照判断 model 是否在该账号可用的模型中。known 为 false 表示没有不超过 maxAge 的快照
+// （未获取、获取结果为空或已过期），调用方不应据此跳过账号。
+func Available(sessionID, model string, maxAge time.Duration) (ok, known bool) {
+	model = normalizeModel(model)
+	mu.RLock()
+	defer mu.RUnlock()
+	snap, exists := snapshots[sessionID]
+	if !exists || !snap.fresh(maxAge) {
+		return false, false
+	}
+	return snap.has(model), true
+}
+
+// Listed 报告是否有任一账号不超过 maxAge 的快照列出了 model。没有账号列出的模型（新模型、别名等）不应按可用性过滤。
+func Listed(model string, maxAge time.Duration) bool {
+	model = normalizeModel(model)
+	mu.RLock()
+	defer mu.RUnlock()
+	for _, snap := range snapshots {
+		if snap.fresh(maxAge) && snap.has(model) {
+			return true
+		}
+	}
+	return false
+}
+
+func normalizeModel(model string) string {
+	return strings.ToLower(strings.TrimPrefix(strings.TrimSpace(model), "models/"))
+}
+
+func (s snapshot) fresh(maxAge time.Duration) bool {
+	return len(s.groups) > 0 && time.Since(s.fetchedAt) <= maxAge
+}
+
+func (s snapshot) has(model string) bool {
+	if model == "" {
+		return false
+	}
+	for _, g := range s.groups {
+		for _, m := range g.ModelList {
+			if strings.EqualFold(m, model) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Reset 清空所有快照（仅用于测试）。
+func Reset() {
+	mu.Lock()
+	defer mu.Unlock()
+	snapshots = make(map[string]snapshot)
+}
@@ -0,0 +1,100 @@
+// Package reaper 定期回收长时间运行后会缓慢累积的进程内资源（已过期的会话、不可达的签名热条目、
+// 长时间未使用的租户签名管理器等），并按资源类型统计回收数量（见 /manager/api/metrics）。
+// 各模块的回收函数在启动时通过 Register 注册，间隔为 REAPER_INTERVAL_SECONDS，0 表示关闭。
+package reaper
+
+import (
+	"sync"
+	"time"
+
+	"anti2api-golang/refactor/internal/logger"
+)
+
+// Func 回收一类资源，返回本次回收的数量。
+type Func func(now time.Time) int
+
+// Counter 为一类资源的回收统计。
+type Counter struct {
+	Runs          int64     `json:"runs"`
+	Reclaimed     int64     `json:"reclaimed"`
+	LastReclaimed int       `json:"lastReclaimed"`
+	LastRun       time.Time `json:"lastRun"`
+}
+
+type task struct {
+	name string
+	fn   Func
+}
+
+var (
+	mu       sync.Mutex
+	tasks    []task
+	counters = make(map[string]*Counter)
+	started  bool
+)
+
+// Register 注册名为 name 的回收函数（同名重复注册时替换）。
+func Register(name string, fn Func) {
+	mu.Lock()
+	defer mu.Unlock()
+	for i := range tasks {
+		if tasks[i].name == name {
+			tasks[i].fn = fn
+			return
+		}
+	}
+	tasks = append(tasks, task{name: name, fn: fn})
+	counters[name] = &Counter{}
+}
+
+// Start 启动后台回收任务，每 interval 执行一次所有回收函数；interval <= 0 或已启动时不做任何事。
+func Start(interval time.Duration) {
+	mu.Lock()
+	defer mu.Unlock()
+	if interval <= 0 || started {
+		return
+	}
+	started = true
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for now := range ticker.C {
+			RunOnce(now)
+		}
+	}()
+}
+
+// RunOnce 依次执行所有回收函数并更新统计，返回本次回收的总数。
+func RunOnce(now time.Time) int {
+	mu.Lock()
+	pending := append([]task(nil), tasks...)
+	mu.Unlock()
+
+	total := 0
+	for _, t := range pending {
+		n := t.fn(now)
+		total += n
+		mu.Lock()
+		c := counters[t.name]
+		c.Runs++
+		c.Reclaimed += int64(n)
+		c.LastReclaimed = n
+		c.LastRun = now
+		mu.Unlock()
+		if n > 0 {
+			logger.Debug("资源回收 %s: %d", t.name, n)
+		}
+	}
+	return total
+}
+
+// Stats 返回各类资源的回收统计快照。
+func Stats() map[string]Counter {
+	mu.Lock()
+	defer mu.Unlock()
+	out := make(map[string]Counter, len(counters))
+	for name, c := range counters {
+		out[name] = *c
+	}
+	return out
+}
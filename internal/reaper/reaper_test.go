@@ -0,0 +1,26 @@
+package reaper
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRunOnce(t *testing.T) {
+	calls := 0
+	Register("test", func(time.Time) int {
+		calls++
+		return 3
+	})
+	Register("test", func(time.Time) int { return 2 })
+
+	now := time.Now()
+	RunOnce(now)
+	RunOnce(now)
+	if calls != 0 {
+		t.Fatal("re-registering a name should replace the previous function")
+	}
+	c := Stats()["test"]
+	if c.Runs != 2 || c.Reclaimed != 4 || c.LastReclaimed != 2 || !c.LastRun.Equal(now) {
+		t.Fatalf("unexpected counter %+v", c)
+	}
+}
@@ -0,0 +1,242 @@
+package secondary
+
+import (
+	"fmt"
+	"strings"
+
+	jsonpkg "anti2api-golang/refactor/internal/pkg/json"
+	"anti2api-golang/refactor/internal/pkg/jsonrepair"
+	"anti2api-golang/refactor/internal/vertex"
+)
+
+type chatRequest struct {
+	Model       string        `json:"model"`
+	Messages    []chatMessage `json:"messages"`
+	Tools       []chatTool    `json:"tools,omitempty"`
+	ToolChoice  any           `json:"tool_choice,omitempty"`
+	MaxTokens   int           `json:"max_tokens,omitempty"`
+	Temperature *float64      `json:"temperature,omitempty"`
+	TopP        *float64      `json:"top_p,omitempty"`
+	Stop        []string      `json:"stop,omitempty"`
+	Stream      bool          `json:"stream"`
+}
+
+type chatMessage struct {
+	Role       string         `json:"role"`
+	Content    any            `json:"content"`
+	ToolCalls  []chatToolCall `json:"tool_calls,omitempty"`
+	ToolCallID string         `json:"tool_call_id,omitempty"`
+}
+
+type chatContentPart struct {
+	Type     string        `json:"type"`
+	Text     string        `json:"text,omitempty"`
+	ImageURL *chatImageURL `json:"image_url,omitempty"`
+}
+
+type chatImageURL struct {
+	URL string `json:"url"`
+}
+
+type chatTool struct {
+	Type     string       `json:"type"`
+	Function chatFunction `json:"function"`
+}
+
+type chatFunction struct {
+	Name        string         `json:"name"`
+	Description string         `json:"description,omitempty"`
+	Parameters  map[string]any `json:"parameters,omitempty"`
+}
+
+type chatToolCall struct {
+	ID       string           `json:"id"`
+	Type     string           `json:"type"`
+	Function chatFunctionCall `json:"function"`
+}
+
+type chatFunctionCall struct {
+	Name      string `json:"name"`
+	Arguments string `json:"arguments"`
+}
+
+type chatResponse struct {
+	Choices []struct {
+		Message struct {
+			Content          *string        `json:"content"`
+			ReasoningContent string         `json:"reasoning_content,omitempty"`
+			ToolCalls        []chatToolCall `json:"tool_calls,omitempty"`
+		} `json:"message"`
+		FinishReason string `json:"finish_reason"`
+	} `json:"choices"`
+	Usage *struct {
+		PromptTokens     int `json:"prompt_tokens"`
+		CompletionTokens int `json:"completion_tokens"`
+		TotalTokens      int `json:"total_tokens"`
+	} `json:"usage,omitempty"`
+}
+
+// toChatRequest 将 vertex 请求转换为 OpenAI Chat Completions 请求。
+// thought 部分与 Antigravity agent 提示词只对 Cloud Code 有意义，转换时丢弃。
+func toChatRequest(model string, req *vertex.Request) *chatRequest {
+	out := &chatRequest{Model: model}
+	inner := req.Request
+
+	if si := inner.SystemInstruction; si != nil {
+		var texts []string
+		for _, p := range si.Parts {
+			if p.Text == "" {
+				continue
+			}
+			text := strings.TrimPrefix(p.Text, vertex.AgentSystemPrompt)
+			if text = strings.TrimSpace(text); text != "" {
+				texts = append(texts, text)
+			}
+		}
+		if len(texts) > 0 {
+			out.Messages = append(out.Messages, chatMessage{Role: "system", Content: strings.Join(texts, "\n\n")})
+		}
+	}
+
+	// Vertex 的 functionCall / functionResponse 不一定带 id，按名称依次配对生成 tool_call_id。
+	pending := make(map[string][]string)
+	callSeq := 0
+	for _, c := range inner.Contents {
+		if c.Role == "model" {
+			msg := chatMessage{Role: "assistant"}
+			var text strings.Builder
+			for _, p := range c.Parts {
+				switch {
+				case p.Thought:
+				case p.FunctionCall != nil:
+					callSeq++
+					id := p.FunctionCall.ID
+					if id == "" {
+						id = fmt.Sprintf("call_%d", callSeq)
+					}
+					pending[p.FunctionCall.Name] = append(pending[p.FunctionCall.Name], id)
+					args := jsonrepair.ToolArguments(p.FunctionCall.Args)
+					msg.ToolCalls = append(msg.ToolCalls, chatToolCall{ID: id, Type: "function", Function: chatFunctionCall{Name: p.FunctionCall.Name, Arguments: args}})
+				default:
+					text.WriteString(p.Text)
+				}
+			}
+			if text.Len() > 0 || len(msg.ToolCalls) == 0 {
+				msg.Content = text.String()
+			}
+			out.Messages = append(out.Messages, msg)
+			continue
+		}
+
+		var parts []chatContentPart
+		hasImage := false
+		flush := func() {
+			if len(parts) == 0 {
+				return
+			}
+			if hasImage {
+				out.Messages = append(out.Messages, chatMessage{Role: "user", Content: parts})
+			} else {
+				var text strings.Builder
+				for _, p := range parts {
+					text.WriteString(p.Text)
+				}
+				out.Messages = append(out.Messages, chatMessage{Role: "user", Content: text.String()})
+			}
+			parts, hasImage = nil, false
+		}
+		for _, p := range c.Parts {
+			switch {
+			case p.Thought:
+			case p.FunctionResponse != nil:
+				flush()
+				id := p.FunctionResponse.ID
+				if queue := pending[p.FunctionResponse.Name]; len(queue) > 0 {
+					if id == "" {
+						id = queue[0]
+					}
+					pending[p.FunctionResponse.Name] = queue[1:]
+				}
+				result, _ := jsonpkg.MarshalString(p.FunctionResponse.Response)
+				out.Messages = append(out.Messages, chatMessage{Role: "tool", ToolCallID: id, Content: result})
+			case p.InlineData != nil:
+				hasImage = true
+				parts = append(parts, chatContentPart{Type: "image_url", ImageURL: &chatImageURL{URL: "data:" + p.InlineData.MimeType + ";base64," + p.InlineData.Data}})
+			case p.Text != "":
+				parts = append(parts, chatContentPart{Type: "text", Text: p.Text})
+			}
+		}
+		flush()
+	}
+
+	for _, t := range inner.Tools {
+		for _, fd := range t.FunctionDeclarations {
+			out.Tools = append(out.Tools, chatTool{Type: "function", Function: chatFunction{Name: fd.Name, Description: fd.Description, Parameters: fd.Parameters}})
+		}
+	}
+	if len(out.Tools) > 0 && inner.ToolConfig != nil && inner.ToolConfig.FunctionCallingConfig != nil {
+		switch fc := inner.ToolConfig.FunctionCallingConfig; fc.Mode {
+		case "NONE":
+			out.ToolChoice = "none"
+		case "ANY":
+			if len(fc.AllowedFunctionNames) == 1 {
+				out.ToolChoice = map[string]any{"type": "function", "function": map[string]any{"name": fc.AllowedFunctionNames[0]}}
+			} else {
+				out.ToolChoice = "required"
+			}
+		}
+	}
+
+	if gc := inner.GenerationConfig; gc != nil {
+		out.MaxTokens = gc.MaxOutputTokens
+		out.Temperature = gc.Temperature
+		out.TopP = gc.TopP
+		out.Stop = gc.StopSequences
+	}
+	return out
+}
+
+// fromChatResponse 将 OpenAI Chat Completions 响应转换为 vertex 响应。
+func fromChatResponse(resp *chatResponse) *vertex.Response {
+	out := &vertex.Response{}
+	if len(resp.Choices) > 0 {
+		choice := resp.Choices[0]
+		var parts []vertex.Part
+		if choice.Message.ReasoningContent != "" {
+			parts = append(parts, vertex.Part{Text: choice.Message.ReasoningContent, Thought: true})
+		}
+		if choice.Message.Content != nil && *choice.Message.Content != "" {
+			parts = append(parts, vertex.Part{Text: *choice.Message.Content})
+		}
+		for _, tc := range choice.Message.ToolCalls {
+			args := map[string]any{}
+			if strings.TrimSpace(tc.Function.Arguments) != "" {
+				_ = jsonpkg.UnmarshalString(tc.Function.Arguments, &args)
+			}
+			parts = append(parts, vertex.Part{FunctionCall: &vertex.FunctionCall{ID: tc.ID, Name: tc.Function.Name, Args: args}})
+		}
+		out.Response.Candidates = []vertex.Candidate{{
+			Content:      vertex.Content{Role: "model", Parts: parts},
+			FinishReason: finishReason(choice.FinishReason),
+		}}
+	}
+	if u := resp.Usage; u != nil {
+		out.Response.UsageMetadata = &vertex.UsageMetadata{
+			PromptTokenCount:     u.PromptTokens,
+			CandidatesTokenCount: u.CompletionTokens,
+			TotalTokenCount:      u.TotalTokens,
+		}
+	}
+	return out
+}
+
+func finishReason(reason string) string {
+	switch reason {
+	case "length":
+		return "MAX_TOKENS"
+	case "content_filter":
+		return "SAFETY"
+	default:
+		return "STOP"
+	}
+}
@@ -0,0 +1,164 @@
+// Package secondary 实现 Cloud Code 不可用时的降级后端：把已转换的 vertex 请求镜像为
+// OpenAI Chat Completions 请求发往自建的 OpenAI 兼容服务（例如 vLLM），再把结果转换回 vertex 响应，
+// 这样各网关的响应转换、PII 还原、钩子与会话记录逻辑都可以原样复用。
+package secondary
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"anti2api-golang/refactor/internal/config"
+	"anti2api-golang/refactor/internal/logger"
+	jsonpkg "anti2api-golang/refactor/internal/pkg/json"
+	"anti2api-golang/refactor/internal/pkg/modelutil"
+	"anti2api-golang/refactor/internal/vertex"
+)
+
+var (
+	clientOnce sync.Once
+	httpClient *http.Client
+)
+
+func getHTTPClient() *http.Client {
+	clientOnce.Do(func() {
+		timeout := time.Duration(config.Get().TimeoutMs) * time.Millisecond
+		if timeout < 0 {
+			timeout = 0
+		}
+		httpClient = &http.Client{Timeout: timeout}
+	})
+	return httpClient
+}
+
+// Match 按 SECONDARY_BACKEND_MODELS 的最长前缀为 model 选择备用后端模型名；未配置或不匹配时 ok 为 false。
+func Match(model string) (target string, ok bool) {
+	cfg := config.Get()
+	if cfg.SecondaryBackendURL == "" || len(cfg.SecondaryBackendModels) == 0 {
+		return "", false
+	}
+	canonical := modelutil.CanonicalModelID(model)
+	lower := strings.ToLower(canonical)
+	best := -1
+	for prefix, t := range cfg.SecondaryBackendModels {
+		matched := prefix == "*" || strings.HasPrefix(lower, prefix)
+		n := len(prefix)
+		if prefix == "*" {
+			n = 0
+		}
+		if matched && n > best {
+			best, target = n, t
+		}
+	}
+	if best < 0 {
+		return "", false
+	}
+	if target == "" {
+		target = canonical
+	}
+	return target, true
+}
+
+// ShouldUse 判断 Cloud Code 的失败是否属于“后端不可用”：网络错误、无可用账号、429 或 5xx。
+// 客户端已断开、请求本身无效（4xx）等情况不降级。
+func ShouldUse(ctx context.Context, err error) bool {
+	if err == nil || ctx.Err() != nil {
+		return false
+	}
+	var apiErr *vertex.APIError
+	if !errors.As(err, &apiErr) {
+		return true
+	}
+	return apiErr.Status == http.StatusTooManyRequests || apiErr.Status >= http.StatusInternalServerError
+}
+
+// GenerateContent 将 req 以 model 发往备用后端（非流式），返回转换后的 vertex 响应。
+func GenerateContent(ctx context.Context, model string, req *vertex.Request) (*vertex.Response, error) {
+	cfg := config.Get()
+	reqURL := cfg.SecondaryBackendURL + "/chat/completions"
+
+	body, err := jsonpkg.Marshal(toChatRequest(model, req))
+	if err != nil {
+		return nil, err
+	}
+	if logger.IsBackendLogEnabled() {
+		logger.BackendRequest(http.MethodPost, reqURL, body)
+	}
+
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, reqURL, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+	if cfg.SecondaryBackendAPIKey != "" {
+		httpReq.Header.Set("Authorization", "Bearer "+cfg.SecondaryBackendAPIKey)
+	}
+
+	startTime := time.Now()
+	resp, err := getHTTPClient().Do(httpReq)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if logger.IsBackendLogEnabled() {
+		logger.BackendResponse(resp.StatusCode, time.Since(startTime), string(respBody))
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, &vertex.APIError{Status: resp.StatusCode, Message: "备用后端返回错误: " + errorMessage(respBody)}
+	}
+
+	var out chatResponse
+	if err := jsonpkg.Unmarshal(respBody, &out); err != nil {
+		return nil, err
+	}
+	return fromChatResponse(&out), nil
+}
+
+// GenerateContentStream 以非流式方式请求备用后端，并把结果包装成只有一个分片的 vertex SSE 响应，
+// 使各网关的流式处理逻辑无需区分后端（降级模式下不追求逐字输出）。
+func GenerateContentStream(ctx context.Context, model string, req *vertex.Request) (*http.Response, error) {
+	vresp, err := GenerateContent(ctx, model, req)
+	if err != nil {
+		return nil, err
+	}
+	b, err := jsonpkg.Marshal(vresp)
+	if err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	buf.WriteString("data: ")
+	buf.Write(b)
+	buf.WriteString("\n\n")
+	return &http.Response{
+		StatusCode: http.StatusOK,
+		Header:     http.Header{"Content-Type": {"text/event-stream"}},
+		Body:       io.NopCloser(&buf),
+	}, nil
+}
+
+func errorMessage(body []byte) string {
+	var e struct {
+		Error struct {
+			Message string `json:"message"`
+		} `json:"error"`
+	}
+	if jsonpkg.Unmarshal(body, &e) == nil && e.Error.Message != "" {
+		return e.Error.Message
+	}
+	msg := strings.TrimSpace(string(body))
+	if len(msg) > 512 {
+		msg = msg[:512]
+	}
+	return msg
+}
@@ -0,0 +1,147 @@
+package secondary
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"anti2api-golang/refactor/internal/config"
+	jsonpkg "anti2api-golang/refactor/internal/pkg/json"
+	"anti2api-golang/refactor/internal/vertex"
+)
+
+func setSecondaryConfig(t *testing.T, url string, models map[string]string) {
+	t.Helper()
+	cfg := config.Get()
+	prevURL, prevModels := cfg.SecondaryBackendURL, cfg.SecondaryBackendModels
+	cfg.SecondaryBackendURL, cfg.SecondaryBackendModels = url, models
+	t.Cleanup(func() { cfg.SecondaryBackendURL, cfg.SecondaryBackendModels = prevURL, prevModels })
+}
+
+func TestMatch(t *testing.T) {
+	setSecondaryConfig(t, "http://127.0.0.1:8000/v1", map[string]string{
+		"gemini-":     "qwen",
+		"gemini-2.5-": "qwen-small",
+		"claude-":     "",
+	})
+
+	cases := []struct {
+		model, want string
+		ok          bool
+	}{
+		{"gemini-3-pro-high", "qwen", true},
+		{"gemini-2.5-flash", "qwen-small", true},
+		{"claude-sonnet-4-5", "claude-sonnet-4-5", true},
+		{"gpt-oss-120b", "", false},
+	}
+	for _, tc := range cases {
+		got, ok := Match(tc.model)
+		if got != tc.want || ok != tc.ok {
+			t.Fatalf("Match(%q) = %q, %v; want %q, %v", tc.model, got, ok, tc.want, tc.ok)
+		}
+	}
+
+	setSecondaryConfig(t, "", map[string]string{"*": "qwen"})
+	if _, ok := Match("gemini-3-pro-high"); ok {
+		t.Fatalf("expected no match without SECONDARY_BACKEND_URL")
+	}
+}
+
+func TestShouldUse(t *testing.T) {
+	ctx := context.Background()
+	if !ShouldUse(ctx, errors.New("dial tcp: connection refused")) {
+		t.Fatalf("expected network errors to use the secondary backend")
+	}
+	if !ShouldUse(ctx, &vertex.APIError{Status: http.StatusServiceUnavailable}) {
+		t.Fatalf("expected 503 to use the secondary backend")
+	}
+	if ShouldUse(ctx, &vertex.APIError{Status: http.StatusBadRequest}) {
+		t.Fatalf("expected 400 not to use the secondary backend")
+	}
+	cancelled, cancel := context.WithCancel(ctx)
+	cancel()
+	if ShouldUse(cancelled, errors.New("context canceled")) {
+		t.Fatalf("expected cancelled requests not to use the secondary backend")
+	}
+}
+
+func TestToChatRequest(t *testing.T) {
+	temp := 0.2
+	req := &vertex.Request{Request: vertex.InnerReq{
+		SystemInstruction: &vertex.SystemInstruction{Parts: []vertex.Part{{Text: vertex.AgentSystemPrompt + "\n\nbe brief"}}},
+		Contents: []vertex.Content{
+			{Role: "user", Parts: []vertex.Part{{Text: "look "}, {InlineData: &vertex.InlineData{MimeType: "image/png", Data: "AAAA"}}}},
+			{Role: "model", Parts: []vertex.Part{{Text: "hmm", Thought: true}, {FunctionCall: &vertex.FunctionCall{Name: "lookup", Args: map[string]any{"q": "x"}}}}},
+			{Role: "user", Parts: []vertex.Part{{FunctionResponse: &vertex.FunctionResponse{Name: "lookup", Response: map[string]any{"output": "ok"}}}}},
+		},
+		Tools:            []vertex.Tool{{FunctionDeclarations: []vertex.FunctionDeclaration{{Name: "lookup", Parameters: map[string]any{"type": "object"}}}}},
+		GenerationConfig: &vertex.GenerationConfig{MaxOutputTokens: 256, Temperature: &temp},
+	}}
+
+	out := toChatRequest("qwen", req)
+	if len(out.Messages) != 4 {
+		t.Fatalf("expected 4 messages, got %d: %+v", len(out.Messages), out.Messages)
+	}
+	if out.Messages[0].Role != "system" || out.Messages[0].Content != "be brief" {
+		t.Fatalf("unexpected system message %+v", out.Messages[0])
+	}
+	if parts, ok := out.Messages[1].Content.([]chatContentPart); !ok || len(parts) != 2 || parts[1].ImageURL == nil {
+		t.Fatalf("unexpected user message %+v", out.Messages[1])
+	}
+	call := out.Messages[2].ToolCalls
+	if len(call) != 1 || call[0].Function.Arguments != `{"q":"x"}` || out.Messages[2].Content != nil {
+		t.Fatalf("unexpected assistant message %+v", out.Messages[2])
+	}
+	if out.Messages[3].Role != "tool" || out.Messages[3].ToolCallID != call[0].ID {
+		t.Fatalf("unexpected tool message %+v", out.Messages[3])
+	}
+	if len(out.Tools) != 1 || out.MaxTokens != 256 || out.Temperature == nil || *out.Temperature != temp {
+		t.Fatalf("unexpected tools / generation config %+v", out)
+	}
+}
+
+func TestGenerateContentStream(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/chat/completions" {
+			http.NotFound(w, r)
+			return
+		}
+		var body chatRequest
+		b, _ := io.ReadAll(r.Body)
+		if err := jsonpkg.Unmarshal(b, &body); err != nil || body.Model != "qwen" {
+			http.Error(w, "bad request", http.StatusBadRequest)
+			return
+		}
+		_, _ = io.WriteString(w, `{"choices":[{"message":{"content":"hello","tool_calls":[{"id":"c1","type":"function","function":{"name":"f","arguments":"{\"a\":1}"}}]},"finish_reason":"tool_calls"}],"usage":{"prompt_tokens":3,"completion_tokens":2,"total_tokens":5}}`)
+	}))
+	defer srv.Close()
+	setSecondaryConfig(t, srv.URL+"/v1", map[string]string{"*": "qwen"})
+
+	resp, err := GenerateContentStream(context.Background(), "qwen", &vertex.Request{})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	var parts []string
+	result, err := vertex.ParseStreamWithResult(resp, func(data *vertex.StreamData) error {
+		for _, p := range data.Response.Candidates[0].Content.Parts {
+			parts = append(parts, p.Text)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("unexpected parse error: %v", err)
+	}
+	if result.Text != "hello" || len(result.ToolCalls) != 1 || result.ToolCalls[0].Args["a"] != float64(1) {
+		t.Fatalf("unexpected stream result %+v", result)
+	}
+	if result.FinishReason != "STOP" || result.Usage == nil || result.Usage.TotalTokenCount != 5 {
+		t.Fatalf("unexpected finish / usage %+v", result)
+	}
+	if strings.Join(parts, "") != "hello" {
+		t.Fatalf("unexpected parts %q", parts)
+	}
+}
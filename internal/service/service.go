@@ -0,0 +1,32 @@
+// Package service 将代理安装为系统服务：Linux 下生成 systemd unit，Windows 下注册到服务控制管理器（SCM）。
+//
+// 服务以 "<可执行文件> -service run" 启动，工作目录为可执行文件所在目录，
+// 因此与手动运行时一样读取同目录下的 .env 与 ./data。
+package service
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+)
+
+const (
+	Name        = "ant2api"
+	DisplayName = "Antigravity 2 API"
+	Description = "Antigravity 2 API 代理服务（OpenAI / Claude / Gemini 兼容接口）"
+)
+
+// RunFunc 是服务主体，ctx 结束时应优雅退出。
+type RunFunc func(ctx context.Context)
+
+// executablePath 返回当前可执行文件的绝对路径（解析符号链接）。
+func executablePath() (string, error) {
+	exe, err := os.Executable()
+	if err != nil {
+		return "", err
+	}
+	if resolved, err := filepath.EvalSymlinks(exe); err == nil {
+		exe = resolved
+	}
+	return filepath.Abs(exe)
+}
@@ -0,0 +1,88 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"os/signal"
+	"path/filepath"
+	"syscall"
+)
+
+const unitPath = "/etc/systemd/system/" + Name + ".service"
+
+// DataDir 是 systemd 服务的默认数据目录（由 StateDirectory 创建；.env 中的 DATA_DIR 优先）。
+const DataDir = "/var/lib/" + Name
+
+// LogHint 说明服务日志的位置。
+const LogHint = "journalctl -u " + Name + " -f"
+
+// systemdUnit 生成服务的 unit 文件内容；日志输出到 stdout，由 journald 收集。
+func systemdUnit(exe string) string {
+	return fmt.Sprintf(`[Unit]
+Description=%s
+After=network-online.target
+Wants=network-online.target
+
+[Service]
+Type=simple
+ExecStart=%s -service run
+WorkingDirectory=%s
+Environment=DATA_DIR=%s
+StateDirectory=%s
+Restart=on-failure
+RestartSec=5
+
+[Install]
+WantedBy=multi-user.target
+`, Description, exe, filepath.Dir(exe), DataDir, Name)
+}
+
+// Install 写入 systemd unit 并设置开机自启、立即启动（需要 root 权限）。
+func Install() error {
+	exe, err := executablePath()
+	if err != nil {
+		return err
+	}
+	if _, err := os.Stat(unitPath); err == nil {
+		return fmt.Errorf("服务 %s 已存在（%s），请先卸载", Name, unitPath)
+	}
+	if err := os.WriteFile(unitPath, []byte(systemdUnit(exe)), 0o644); err != nil {
+		return fmt.Errorf("写入 %s 失败（需要 root 权限）: %w", unitPath, err)
+	}
+	if err := systemctl("daemon-reload"); err != nil {
+		return err
+	}
+	return systemctl("enable", "--now", Name)
+}
+
+// Uninstall 停止并移除 systemd 服务（数据目录保留）。
+func Uninstall() error {
+	if _, err := os.Stat(unitPath); err != nil {
+		return fmt.Errorf("服务 %s 未安装", Name)
+	}
+	_ = systemctl("disable", "--now", Name)
+	if err := os.Remove(unitPath); err != nil {
+		return err
+	}
+	return systemctl("daemon-reload")
+}
+
+// Run 以服务方式运行：systemd 已设置工作目录，并通过 SIGTERM 通知停止。
+func Run(run RunFunc) error {
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+	run(ctx)
+	return nil
+}
+
+func systemctl(args ...string) error {
+	cmd := exec.Command("systemctl", args...)
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("systemctl %v 失败: %w", args, err)
+	}
+	return nil
+}
@@ -0,0 +1,21 @@
+package service
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestSystemdUnit(t *testing.T) {
+	unit := systemdUnit("/opt/ant2api/server")
+	for _, want := range []string{
+		"ExecStart=/opt/ant2api/server -service run",
+		"WorkingDirectory=/opt/ant2api",
+		"Environment=DATA_DIR=/var/lib/ant2api",
+		"StateDirectory=ant2api",
+		"WantedBy=multi-user.target",
+	} {
+		if !strings.Contains(unit, want) {
+			t.Fatalf("unit missing %q:\n%s", want, unit)
+		}
+	}
+}
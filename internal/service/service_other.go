@@ -0,0 +1,30 @@
+//go:build !linux && !windows
+
+package service
+
+import (
+	"context"
+	"errors"
+	"os/signal"
+	"syscall"
+)
+
+// DataDir 为空表示使用默认的 ./data。
+const DataDir = ""
+
+// LogHint 说明服务日志的位置。
+const LogHint = "标准输出"
+
+var errUnsupported = errors.New("当前系统不支持自动安装服务，请使用系统自带的服务管理工具运行 \"server -service run\"")
+
+func Install() error { return errUnsupported }
+
+func Uninstall() error { return errUnsupported }
+
+// Run 按前台方式运行，收到 SIGINT / SIGTERM 时退出。
+func Run(run RunFunc) error {
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+	run(ctx)
+	return nil
+}
@@ -0,0 +1,143 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"time"
+
+	"golang.org/x/sys/windows/svc"
+	"golang.org/x/sys/windows/svc/mgr"
+)
+
+// DataDir 为空表示使用默认的 ./data（即可执行文件所在目录下的 data）。
+const DataDir = ""
+
+// LogHint 说明服务日志的位置。
+const LogHint = `logs\server.log（可执行文件所在目录）`
+
+// Install 注册为自动启动的 Windows 服务并立即启动（需要管理员权限）；异常退出后 5 秒自动重启。
+func Install() error {
+	exe, err := executablePath()
+	if err != nil {
+		return err
+	}
+	m, err := mgr.Connect()
+	if err != nil {
+		return fmt.Errorf("连接服务管理器失败（需要管理员权限）: %w", err)
+	}
+	defer m.Disconnect()
+
+	if s, err := m.OpenService(Name); err == nil {
+		s.Close()
+		return fmt.Errorf("服务 %s 已存在，请先卸载", Name)
+	}
+	s, err := m.CreateService(Name, exe, mgr.Config{
+		DisplayName: DisplayName,
+		Description: Description,
+		StartType:   mgr.StartAutomatic,
+	}, "-service", "run")
+	if err != nil {
+		return fmt.Errorf("创建服务失败: %w", err)
+	}
+	defer s.Close()
+
+	_ = s.SetRecoveryActions([]mgr.RecoveryAction{{Type: mgr.ServiceRestart, Delay: 5 * time.Second}}, uint32((24 * time.Hour).Seconds()))
+	return s.Start()
+}
+
+// Uninstall 停止并删除 Windows 服务（数据目录保留）。
+func Uninstall() error {
+	m, err := mgr.Connect()
+	if err != nil {
+		return fmt.Errorf("连接服务管理器失败（需要管理员权限）: %w", err)
+	}
+	defer m.Disconnect()
+
+	s, err := m.OpenService(Name)
+	if err != nil {
+		return fmt.Errorf("服务 %s 未安装", Name)
+	}
+	defer s.Close()
+
+	_, _ = s.Control(svc.Stop)
+	return s.Delete()
+}
+
+// Run 以服务方式运行：工作目录切换到可执行文件所在目录，stdout/stderr 重定向到 logs\server.log。
+// 不是由 SCM 启动时（例如在命令行中直接执行 -service run）按前台方式运行。
+func Run(run RunFunc) error {
+	isService, err := svc.IsWindowsService()
+	if err != nil {
+		return err
+	}
+	if isService {
+		if err := prepareServiceEnv(); err != nil {
+			return err
+		}
+		return svc.Run(Name, &handler{run: run})
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	run(ctx)
+	return nil
+}
+
+func prepareServiceEnv() error {
+	exe, err := executablePath()
+	if err != nil {
+		return err
+	}
+	dir := filepath.Dir(exe)
+	if err := os.Chdir(dir); err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Join(dir, "logs"), 0o755); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(filepath.Join(dir, "logs", "server.log"), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return err
+	}
+	os.Stdout = f
+	os.Stderr = f
+	return nil
+}
+
+type handler struct {
+	run RunFunc
+}
+
+func (h *handler) Execute(_ []string, requests <-chan svc.ChangeRequest, status chan<- svc.Status) (bool, uint32) {
+	status <- svc.Status{State: svc.StartPending}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	done := make(chan struct{})
+	go func() {
+		h.run(ctx)
+		close(done)
+	}()
+
+	status <- svc.Status{State: svc.Running, Accepts: svc.AcceptStop | svc.AcceptShutdown}
+	for {
+		select {
+		case req := <-requests:
+			switch req.Cmd {
+			case svc.Interrogate:
+				status <- req.CurrentStatus
+			case svc.Stop, svc.Shutdown:
+				status <- svc.Status{State: svc.StopPending}
+				cancel()
+				<-done
+				return false, 0
+			}
+		case <-done:
+			// 服务主体意外退出，返回非零退出码以触发恢复策略。
+			return false, 1
+		}
+	}
+}
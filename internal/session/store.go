@@ -0,0 +1,185 @@
+// Package session 管理客户端显式创建的 Vertex sessionId。
+//
+// 默认情况下 sessionId 跟随账号；客户端可以通过 /v1/sessions 创建一个会话，并在后续请求中
+// 以 X-Session-ID 请求头携带，让长时间运行的 agent 在上游保持同一个会话（上下文亲和）。
+// 会话仅保存在内存中，过期时间在每次使用时顺延（SESSION_TTL_SECONDS）。
+// 会话归属创建它的租户（TENANTS），列出、查询、失效与 X-Session-ID 解析都只作用于本租户的会话。
+package session
+
+import (
+	"errors"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"anti2api-golang/refactor/internal/config"
+	"anti2api-golang/refactor/internal/pkg/id"
+)
+
+// ErrUnknownSession 表示 SESSION_STRICT 开启时请求携带了未创建或已过期的会话 ID。
+var ErrUnknownSession = errors.New("X-Session-ID 无效或已过期，请通过 /v1/sessions 重新创建会话。")
+
+type Session struct {
+	ID         string        `json:"id"`
+	Label      string        `json:"label,omitempty"`
+	CreatedAt  time.Time     `json:"created_at"`
+	LastUsedAt time.Time     `json:"last_used_at"`
+	ExpiresAt  time.Time     `json:"expires_at"`
+	TTL        time.Duration `json:"-"`
+	// Tenant 为创建会话的租户，未配置 TENANTS 时为空。
+	Tenant string `json:"-"`
+}
+
+type Store struct {
+	mu       sync.Mutex
+	sessions map[string]*Session
+	ttl      time.Duration
+	strict   bool
+	now      func() time.Time
+}
+
+var (
+	storeOnce sync.Once
+	storeInst *Store
+)
+
+func GetStore() *Store {
+	storeOnce.Do(func() {
+		cfg := config.Get()
+		storeInst = NewStore(time.Duration(cfg.SessionTTLSeconds)*time.Second, cfg.SessionStrict)
+	})
+	return storeInst
+}
+
+func NewStore(ttl time.Duration, strict bool) *Store {
+	if ttl <= 0 {
+		ttl = 24 * time.Hour
+	}
+	return &Store{sessions: make(map[string]*Session), ttl: ttl, strict: strict, now: time.Now}
+}
+
+// Create 为 tenant 创建新会话；ttl <= 0 时使用默认 TTL。
+func (s *Store) Create(tenant, label string, ttl time.Duration) Session {
+	if ttl <= 0 {
+		ttl = s.ttl
+	}
+	now := s.now()
+	sess := &Session{
+		ID:         id.SessionID(),
+		Label:      strings.TrimSpace(label),
+		CreatedAt:  now,
+		LastUsedAt: now,
+		ExpiresAt:  now.Add(ttl),
+		TTL:        ttl,
+		Tenant:     tenant,
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.pruneLocked(now)
+	s.sessions[sess.ID] = sess
+	return *sess
+}
+
+// Get 返回 tenant 名下未过期的会话。
+func (s *Store) Get(tenant, sessionID string) (Session, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	sess, ok := s.ownedLocked(tenant, sessionID, s.now())
+	if !ok {
+		return Session{}, false
+	}
+	return *sess, true
+}
+
+// List 返回 tenant 名下所有未过期的会话（按创建时间升序）。
+func (s *Store) List(tenant string) []Session {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.pruneLocked(s.now())
+	out := make([]Session, 0, len(s.sessions))
+	for _, sess := range s.sessions {
+		if sess.Tenant == tenant {
+			out = append(out, *sess)
+		}
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].CreatedAt.Before(out[j].CreatedAt) })
+	return out
+}
+
+// Expire 立即使 tenant 名下的会话失效，会话不存在或属于其他租户时返回 false。
+func (s *Store) Expire(tenant, sessionID string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.ownedLocked(tenant, sessionID, s.now()); !ok {
+		return false
+	}
+	delete(s.sessions, sessionID)
+	return true
+}
+
+// Resolve 解析请求携带的 X-Session-ID：
+// 已创建的会话会顺延过期时间；未知的 ID 默认原样透传（兼容直接指定 sessionId 的客户端），
+// SESSION_STRICT 开启时返回 ErrUnknownSession。header 为空时返回空串，表示使用账号自身的 sessionId。
+// 属于其他租户的会话始终返回 ErrUnknownSession，避免借用别的租户的上游会话上下文。
+func (s *Store) Resolve(tenant, header string) (string, error) {
+	sessionID := strings.TrimSpace(header)
+	if sessionID == "" {
+		return "", nil
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := s.now()
+	if sess, ok := s.activeLocked(sessionID, now); ok {
+		if sess.Tenant != tenant {
+			return "", ErrUnknownSession
+		}
+		sess.LastUsedAt = now
+		sess.ExpiresAt = now.Add(sess.TTL)
+		return sessionID, nil
+	}
+	if s.strict {
+		return "", ErrUnknownSession
+	}
+	return sessionID, nil
+}
+
+func (s *Store) activeLocked(sessionID string, now time.Time) (*Session, bool) {
+	sess, ok := s.sessions[sessionID]
+	if !ok {
+		return nil, false
+	}
+	if !now.Before(sess.ExpiresAt) {
+		delete(s.sessions, sessionID)
+		return nil, false
+	}
+	return sess, true
+}
+
+func (s *Store) ownedLocked(tenant, sessionID string, now time.Time) (*Session, bool) {
+	sess, ok := s.activeLocked(sessionID, now)
+	if !ok || sess.Tenant != tenant {
+		return nil, false
+	}
+	return sess, true
+}
+
+// Prune 删除在 now 时已过期的会话，返回删除的数量（供 reaper 定期调用；其余情况下只在创建、列出时顺带清理）。
+func (s *Store) Prune(now time.Time) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.pruneLocked(now)
+}
+
+func (s *Store) pruneLocked(now time.Time) int {
+	n := 0
+	for sid, sess := range s.sessions {
+		if !now.Before(sess.ExpiresAt) {
+			delete(s.sessions, sid)
+			n++
+		}
+	}
+	return n
+}
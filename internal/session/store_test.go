@@ -0,0 +1,100 @@
+package session
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func newTestStore(strict bool) (*Store, *time.Time) {
+	now := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	s := NewStore(time.Hour, strict)
+	s.now = func() time.Time { return now }
+	return s, &now
+}
+
+func TestStore_ResolveExtendsAndExpires(t *testing.T) {
+	s, now := newTestStore(false)
+	sess := s.Create("", "agent", 0)
+	if sess.ID == "" || !sess.ExpiresAt.Equal(now.Add(time.Hour)) {
+		t.Fatalf("unexpected session %+v", sess)
+	}
+
+	*now = now.Add(50 * time.Minute)
+	if got, err := s.Resolve("", " "+sess.ID+" "); err != nil || got != sess.ID {
+		t.Fatalf("Resolve = %q, %v", got, err)
+	}
+	*now = now.Add(50 * time.Minute)
+	if _, ok := s.Get("", sess.ID); !ok {
+		t.Fatalf("expected sliding expiration to keep the session alive")
+	}
+
+	*now = now.Add(2 * time.Hour)
+	if _, ok := s.Get("", sess.ID); ok {
+		t.Fatalf("expected session to expire")
+	}
+	if len(s.List("")) != 0 {
+		t.Fatalf("expected no active sessions")
+	}
+}
+
+func TestStore_ResolveUnknown(t *testing.T) {
+	s, _ := newTestStore(false)
+	if got, err := s.Resolve("", ""); got != "" || err != nil {
+		t.Fatalf("empty header: got %q, %v", got, err)
+	}
+	if got, err := s.Resolve("", "-123"); got != "-123" || err != nil {
+		t.Fatalf("expected unknown ids to pass through, got %q, %v", got, err)
+	}
+
+	strict, _ := newTestStore(true)
+	if _, err := strict.Resolve("", "-123"); !errors.Is(err, ErrUnknownSession) {
+		t.Fatalf("expected ErrUnknownSession, got %v", err)
+	}
+	sess := strict.Create("", "", 10*time.Minute)
+	if !strict.Expire("", sess.ID) || strict.Expire("", sess.ID) {
+		t.Fatalf("expected Expire to succeed exactly once")
+	}
+	if _, err := strict.Resolve("", sess.ID); !errors.Is(err, ErrUnknownSession) {
+		t.Fatalf("expected expired session to be rejected, got %v", err)
+	}
+}
+
+func TestStore_Prune(t *testing.T) {
+	s, now := newTestStore(false)
+	s.Create("", "short", time.Minute)
+	s.Create("", "long", 0)
+
+	*now = now.Add(2 * time.Minute)
+	if n := s.Prune(*now); n != 1 {
+		t.Fatalf("expected 1 expired session to be pruned, got %d", n)
+	}
+	if n := s.Prune(*now); n != 0 {
+		t.Fatalf("nothing left to prune, got %d", n)
+	}
+}
+
+func TestStore_TenantIsolation(t *testing.T) {
+	s, _ := newTestStore(false)
+	alice := s.Create("alice", "agent", 0)
+	s.Create("bob", "agent", 0)
+
+	if list := s.List("alice"); len(list) != 1 || list[0].ID != alice.ID {
+		t.Fatalf("expected only alice's session, got %+v", list)
+	}
+	if _, ok := s.Get("bob", alice.ID); ok {
+		t.Fatalf("bob should not see alice's session")
+	}
+	if _, err := s.Resolve("bob", alice.ID); !errors.Is(err, ErrUnknownSession) {
+		t.Fatalf("bob should not be able to use alice's session, got %v", err)
+	}
+	if s.Expire("bob", alice.ID) {
+		t.Fatalf("bob should not be able to expire alice's session")
+	}
+	if got, err := s.Resolve("alice", alice.ID); err != nil || got != alice.ID {
+		t.Fatalf("Resolve = %q, %v", got, err)
+	}
+	if !s.Expire("alice", alice.ID) {
+		t.Fatalf("alice should be able to expire its own session")
+	}
+}
@@ -9,6 +9,7 @@ import (
 type lruItem struct {
 	key      string
 	toolCall string
+	callKey  string
 	index    EntryIndex
 }
 
@@ -18,6 +19,10 @@ type LRU struct {
 	ll       *list.List
 	byKey    map[string]*list.Element
 	byToolID map[string]*list.Element
+	// byCall 按 CallKey 索引最近一次的工具调用（同一调用重复出现时指向最新的条目）。
+	byCall map[string]*list.Element
+	// onEvict 非空时在条目因容量淘汰后调用（持有锁，不得回调 LRU）。
+	onEvict func(EntryIndex)
 }
 
 func NewLRU(capacity int) *LRU {
@@ -29,6 +34,7 @@ func NewLRU(capacity int) *LRU {
 		ll:       list.New(),
 		byKey:    make(map[string]*list.Element, capacity),
 		byToolID: make(map[string]*list.Element, capacity),
+		byCall:   make(map[string]*list.Element),
 	}
 }
 
@@ -46,13 +52,20 @@ func (c *LRU) Put(idx EntryIndex) {
 		it.index = idx
 		c.ll.MoveToFront(el)
 		c.byToolID[idx.ToolCallID] = el
+		if idx.CallKey != "" {
+			it.callKey = idx.CallKey
+			c.byCall[idx.CallKey] = el
+		}
 		return
 	}
 
-	item := &lruItem{key: key, toolCall: idx.ToolCallID, index: idx}
+	item := &lruItem{key: key, toolCall: idx.ToolCallID, callKey: idx.CallKey, index: idx}
 	el := c.ll.PushFront(item)
 	c.byKey[key] = el
 	c.byToolID[idx.ToolCallID] = el
+	if idx.CallKey != "" {
+		c.byCall[idx.CallKey] = el
+	}
 
 	for c.ll.Len() > c.capacity {
 		back := c.ll.Back()
@@ -64,7 +77,13 @@ func (c *LRU) Put(idx EntryIndex) {
 		if old.toolCall != "" {
 			delete(c.byToolID, old.toolCall)
 		}
+		if old.callKey != "" && c.byCall[old.callKey] == back {
+			delete(c.byCall, old.callKey)
+		}
 		c.ll.Remove(back)
+		if c.onEvict != nil {
+			c.onEvict(old.index)
+		}
 	}
 }
 
@@ -104,3 +123,29 @@ func (c *LRU) GetByToolCallID(toolCallID string) (EntryIndex, bool) {
 	c.ll.MoveToFront(el)
 	return it.index, true
 }
+
+func (c *LRU) GetByCallKey(callKey string) (EntryIndex, bool) {
+	if callKey == "" {
+		return EntryIndex{}, false
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	el, ok := c.byCall[callKey]
+	if !ok {
+		return EntryIndex{}, false
+	}
+	it := el.Value.(*lruItem)
+	it.index.LastAccess = time.Now()
+	c.ll.MoveToFront(el)
+	return it.index, true
+}
+
+// contains 报告 key（RequestID:ToolCallID）是否仍在缓存中，不更新访问顺序。
+func (c *LRU) contains(key string) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	_, ok := c.byKey[key]
+	return ok
+}
@@ -2,14 +2,18 @@ package signature
 
 import (
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"anti2api-golang/refactor/internal/config"
+	"anti2api-golang/refactor/internal/storage"
 )
 
 type Manager struct {
 	cache *LRU
 	store *Store
+	// lastUsed 为租户管理器最近一次被 GetManagerFor 取用的时间（UnixNano），供 ReapIdleTenants 判断空闲。
+	lastUsed atomic.Int64
 }
 
 const defaultSignatureLRUCapacity = 50_000 // 默认签名索引缓存容量（LRU 条目数）。
@@ -21,17 +25,65 @@ var (
 
 func GetManager() *Manager {
 	managerOnce.Do(func() {
-		cfg := config.Get()
-		cache := NewLRU(defaultSignatureLRUCapacity)
-		store := NewStore(cfg.DataDir, cache)
-		store.LoadRecent(3)
-		store.Start()
-		managerInst = &Manager{cache: cache, store: store}
+		managerInst = newManager(config.Get().DataDir)
 	})
 	return managerInst
 }
 
+func newManager(dataDir string) *Manager {
+	cache := NewLRU(defaultSignatureLRUCapacity)
+	store := NewStore(dataDir, cache)
+	if config.DataDirReadOnly() {
+		// 数据目录只读：签名只保存在内存中，热条目随索引一起按 LRU 淘汰。
+		store.memoryOnly = true
+		cache.onEvict = store.dropHot
+	} else {
+		store.db = storage.For(dataDir)
+	}
+	store.LoadRecent(3)
+	store.Start()
+	return &Manager{cache: cache, store: store}
+}
+
+var (
+	tenantMu       sync.Mutex
+	tenantManagers = make(map[string]*Manager)
+)
+
+// GetManagerFor 返回租户的签名管理器（见 TENANTS）：默认租户（空字符串）即 GetManager，
+// 其他租户的签名保存在各自的数据目录中，不同租户之间互相查不到。
+func GetManagerFor(tenant string) *Manager {
+	if tenant == "" {
+		return GetManager()
+	}
+	tenantMu.Lock()
+	defer tenantMu.Unlock()
+	m := tenantManagers[tenant]
+	if m == nil {
+		m = newManager(config.TenantDataDir(tenant))
+		tenantManagers[tenant] = m
+	}
+	m.lastUsed.Store(time.Now().UnixNano())
+	return m
+}
+
+// DropTenant 关闭并移除租户的签名管理器（等待未落盘的签名写完），用于清理租户数据前调用；之后的请求会重新加载。
+func DropTenant(tenant string) {
+	tenantMu.Lock()
+	m := tenantManagers[tenant]
+	delete(tenantManagers, tenant)
+	tenantMu.Unlock()
+	if m != nil {
+		m.store.Close()
+	}
+}
+
 func (m *Manager) Save(requestID, toolCallID, signature, reasoning, model string) {
+	m.SaveToolCall(requestID, toolCallID, "", signature, reasoning, model)
+}
+
+// SaveToolCall 与 Save 相同，并按 callKey（见 CallKey）建立模糊索引，供 LookupByCallKey 在客户端改写 tool_call ID 后找回签名。
+func (m *Manager) SaveToolCall(requestID, toolCallID, callKey, signature, reasoning, model string) {
 	if requestID == "" || toolCallID == "" || signature == "" {
 		return
 	}
@@ -42,6 +94,7 @@ func (m *Manager) Save(requestID, toolCallID, signature, reasoning, model string
 		Reasoning:  reasoning,
 		RequestID:  requestID,
 		ToolCallID: toolCallID,
+		CallKey:    callKey,
 		Model:      model,
 		CreatedAt:  now,
 		LastAccess: now,
@@ -51,6 +104,7 @@ func (m *Manager) Save(requestID, toolCallID, signature, reasoning, model string
 	m.cache.Put(EntryIndex{
 		RequestID:  requestID,
 		ToolCallID: toolCallID,
+		CallKey:    callKey,
 		Model:      model,
 		CreatedAt:  now,
 		LastAccess: now,
@@ -84,3 +138,17 @@ func (m *Manager) LookupByToolCallID(toolCallID string) (Entry, bool) {
 	e.LastAccess = idx.LastAccess
 	return e, true
 }
+
+// LookupByCallKey 按工具调用的模糊匹配键查找最近一次保存的签名，返回条目的 ToolCallID 即规范 ID。
+func (m *Manager) LookupByCallKey(callKey string) (Entry, bool) {
+	idx, ok := m.cache.GetByCallKey(callKey)
+	if !ok {
+		return Entry{}, false
+	}
+	e, ok := m.store.LoadByIndex(idx)
+	if !ok || e.Signature == "" {
+		return Entry{}, false
+	}
+	e.LastAccess = idx.LastAccess
+	return e, true
+}
@@ -0,0 +1,101 @@
+package signature
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"anti2api-golang/refactor/internal/config"
+	"anti2api-golang/refactor/internal/storage"
+)
+
+func TestGetManagerFor_IsolatesTenants(t *testing.T) {
+	c := config.Get()
+	old := c.DataDir
+	c.DataDir = t.TempDir()
+	t.Cleanup(func() {
+		DropTenant("alice")
+		DropTenant("bob")
+		c.DataDir = old
+	})
+
+	alice, bob := GetManagerFor("alice"), GetManagerFor("bob")
+	if alice == bob || GetManagerFor("alice") != alice {
+		t.Fatal("each tenant should have exactly one manager")
+	}
+	alice.Save("req", "call_1", "sig-alice", "", "gemini-2.5-pro")
+	if e, ok := alice.LookupByToolCallID("call_1"); !ok || e.Signature != "sig-alice" {
+		t.Fatalf("alice should see her signature, got %+v %v", e, ok)
+	}
+	if _, ok := bob.LookupByToolCallID("call_1"); ok {
+		t.Fatal("bob must not see alice's signature")
+	}
+
+	// DropTenant 等待写入完成，签名落在租户自己的数据目录中。
+	DropTenant("alice")
+	files, _ := filepath.Glob(filepath.Join(c.DataDir, "tenants", "alice", "signatures", "*.jsonl"))
+	if len(files) != 1 {
+		t.Fatalf("expected alice's signatures in her data dir, got %v", files)
+	}
+	if _, err := os.Stat(filepath.Join(c.DataDir, "signatures")); !os.IsNotExist(err) {
+		t.Fatalf("default tenant dir should be untouched, stat err = %v", err)
+	}
+}
+
+func TestManager_MemoryOnlyEvictsHotEntries(t *testing.T) {
+	dir := t.TempDir()
+	cache := NewLRU(2)
+	store := NewStore(dir, cache)
+	store.memoryOnly = true
+	cache.onEvict = store.dropHot
+	store.Start()
+	m := &Manager{cache: cache, store: store}
+
+	m.Save("req", "call_1", "sig-1", "", "gemini-2.5-pro")
+	m.Save("req", "call_2", "sig-2", "", "gemini-2.5-pro")
+	m.Save("req", "call_3", "sig-3", "", "gemini-2.5-pro")
+	store.Close()
+
+	if _, ok := m.LookupByToolCallID("call_1"); ok {
+		t.Fatal("evicted signature should be gone")
+	}
+	if e, ok := m.LookupByToolCallID("call_3"); !ok || e.Signature != "sig-3" {
+		t.Fatalf("expected in-memory signature, got %+v %v", e, ok)
+	}
+	if len(store.hotByKey) != 2 {
+		t.Fatalf("hot entries should follow LRU capacity, got %d", len(store.hotByKey))
+	}
+	if _, err := os.Stat(filepath.Join(dir, "signatures")); !os.IsNotExist(err) {
+		t.Fatalf("memory-only store must not write to disk, stat err = %v", err)
+	}
+}
+
+func TestManager_SQLiteBackend(t *testing.T) {
+	if !storage.Available() {
+		t.Skip("SQLite 驱动未编译（需要 -tags sqlite）")
+	}
+	c := config.Get()
+	old := c.StorageBackend
+	c.StorageBackend = "sqlite"
+	dir := t.TempDir()
+	t.Cleanup(func() {
+		_ = storage.Close(dir)
+		c.StorageBackend = old
+	})
+
+	m := newManager(dir)
+	m.SaveToolCall("req", "call_1", "read:abc", "sig-db", "why", "gemini-2.5-pro")
+	m.store.Close()
+	if files, _ := filepath.Glob(filepath.Join(dir, "signatures", "*.jsonl")); len(files) != 0 {
+		t.Fatalf("sqlite backend must not write JSONL files, got %v", files)
+	}
+
+	reloaded := newManager(dir)
+	defer reloaded.store.Close()
+	if e, ok := reloaded.LookupByToolCallID("call_1"); !ok || e.Signature != "sig-db" || e.Reasoning != "why" {
+		t.Fatalf("expected signature from sqlite, got %+v %v", e, ok)
+	}
+	if e, ok := reloaded.LookupByCallKey("read:abc"); !ok || e.ToolCallID != "call_1" {
+		t.Fatalf("expected call key index from sqlite, got %+v %v", e, ok)
+	}
+}
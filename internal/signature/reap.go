@@ -0,0 +1,78 @@
+package signature
+
+import "time"
+
+const (
+	// hotReapGrace 为热条目的最短保留时间：刚保存的条目可能尚未放入 LRU（见 SaveToolCall）。
+	hotReapGrace = time.Minute
+	// tenantIdleTTL 为租户签名管理器的空闲时长上限，超过后关闭并释放其索引，下次请求时重新加载。
+	tenantIdleTTL = time.Hour
+)
+
+// ReapStale 回收所有签名管理器中不可达的热条目，返回回收数量（见 Store.reapHot）。
+func ReapStale(now time.Time) int {
+	n := GetManager().store.reapHot(now)
+	tenantMu.Lock()
+	managers := make([]*Manager, 0, len(tenantManagers))
+	for _, m := range tenantManagers {
+		managers = append(managers, m)
+	}
+	tenantMu.Unlock()
+	for _, m := range managers {
+		n += m.store.reapHot(now)
+	}
+	return n
+}
+
+// ReapIdleTenants 关闭超过 tenantIdleTTL 未使用的租户签名管理器（等待未落盘的签名写完），返回关闭的数量。
+func ReapIdleTenants(now time.Time) int {
+	cutoff := now.Add(-tenantIdleTTL).UnixNano()
+	var idle []*Manager
+	tenantMu.Lock()
+	for tenant, m := range tenantManagers {
+		if m.lastUsed.Load() < cutoff {
+			delete(tenantManagers, tenant)
+			idle = append(idle, m)
+		}
+	}
+	tenantMu.Unlock()
+	for _, m := range idle {
+		m.store.Close()
+	}
+	return len(idle)
+}
+
+// reapHot 删除 LRU 中已没有对应索引的热条目（索引被淘汰后这些条目再也查不到，但落盘失败或只读模式下
+// 不会被 markPersisted / dropHot 移除），以及指向已删除条目的 tool call 映射，返回删除的热条目数量。
+func (s *Store) reapHot(now time.Time) int {
+	// 先在 hotMu 下找出候选，再逐个查询 LRU：LRU 淘汰回调（dropHot）持有 LRU 锁再取 hotMu，不能反向嵌套。
+	s.hotMu.RLock()
+	candidates := make(map[string]time.Time)
+	for key, e := range s.hotByKey {
+		if now.Sub(e.CreatedAt) >= hotReapGrace {
+			candidates[key] = e.CreatedAt
+		}
+	}
+	s.hotMu.RUnlock()
+	for key := range candidates {
+		if s.cache.contains(key) {
+			delete(candidates, key)
+		}
+	}
+
+	s.hotMu.Lock()
+	defer s.hotMu.Unlock()
+	n := 0
+	for key, createdAt := range candidates {
+		if cur, ok := s.hotByKey[key]; ok && cur.CreatedAt.Equal(createdAt) {
+			delete(s.hotByKey, key)
+			n++
+		}
+	}
+	for toolCallID, key := range s.hotByToolCall {
+		if _, ok := s.hotByKey[key]; !ok {
+			delete(s.hotByToolCall, toolCallID)
+		}
+	}
+	return n
+}
@@ -0,0 +1,51 @@
+package signature
+
+import (
+	"testing"
+	"time"
+
+	"anti2api-golang/refactor/internal/config"
+)
+
+func TestStore_ReapHotDropsUnreachableEntries(t *testing.T) {
+	// 不启动写入协程：模拟落盘一直未完成时，索引被 LRU 淘汰后留下的热条目。
+	cache := NewLRU(1)
+	store := NewStore(t.TempDir(), cache)
+	m := &Manager{cache: cache, store: store}
+	m.Save("req", "call_1", "sig-1", "", "gemini-2.5-pro")
+	m.Save("req", "call_2", "sig-2", "", "gemini-2.5-pro")
+
+	if n := store.reapHot(time.Now()); n != 0 {
+		t.Fatalf("entries younger than the grace period must be kept, reaped %d", n)
+	}
+	if n := store.reapHot(time.Now().Add(2 * hotReapGrace)); n != 1 {
+		t.Fatalf("expected 1 unreachable entry to be reaped, got %d", n)
+	}
+	if _, ok := store.hotByToolCall["call_1"]; ok || len(store.hotByKey) != 1 {
+		t.Fatalf("unexpected hot entries after reaping: %v %v", store.hotByKey, store.hotByToolCall)
+	}
+	if e, ok := m.LookupByToolCallID("call_2"); !ok || e.Signature != "sig-2" {
+		t.Fatalf("reachable entry must survive, got %+v %v", e, ok)
+	}
+}
+
+func TestReapIdleTenants(t *testing.T) {
+	c := config.Get()
+	old := c.DataDir
+	c.DataDir = t.TempDir()
+	t.Cleanup(func() {
+		DropTenant("carol")
+		c.DataDir = old
+	})
+
+	m := GetManagerFor("carol")
+	if n := ReapIdleTenants(time.Now()); n != 0 {
+		t.Fatalf("recently used tenant must be kept, reaped %d", n)
+	}
+	if n := ReapIdleTenants(time.Now().Add(2 * tenantIdleTTL)); n != 1 {
+		t.Fatalf("expected idle tenant manager to be closed, got %d", n)
+	}
+	if GetManagerFor("carol") == m {
+		t.Fatal("a new manager should be created after reaping")
+	}
+}
@@ -14,7 +14,9 @@ import (
 	"sync"
 	"time"
 
+	"anti2api-golang/refactor/internal/logger"
 	jsonpkg "anti2api-golang/refactor/internal/pkg/json"
+	"anti2api-golang/refactor/internal/storage"
 )
 
 type Store struct {
@@ -24,7 +26,13 @@ type Store struct {
 	mu      sync.Mutex
 	queue   chan Entry
 	stopCh  chan struct{}
+	doneCh  chan struct{}
+	started bool
 	stopped bool
+	// memoryOnly 为 true 时不写入磁盘（数据目录只读），条目只保留在 hotByKey 中。
+	memoryOnly bool
+	// db 非空时新条目写入 SQLite（见 storage.For），索引的 FilePath 为数据库路径、Offset 为行号；已有的 JSONL 文件仍可读取。
+	db *storage.DB
 
 	hotMu         sync.RWMutex
 	hotByKey      map[string]Entry
@@ -37,6 +45,7 @@ func NewStore(dataDir string, cache *LRU) *Store {
 		cache:         cache,
 		queue:         make(chan Entry, 1024),
 		stopCh:        make(chan struct{}),
+		doneCh:        make(chan struct{}),
 		hotByKey:      make(map[string]Entry, 1024),
 		hotByToolCall: make(map[string]string, 1024),
 	}
@@ -45,9 +54,10 @@ func NewStore(dataDir string, cache *LRU) *Store {
 func (s *Store) Start() {
 	s.mu.Lock()
 	defer s.mu.Unlock()
-	if s.stopped {
+	if s.stopped || s.started || s.memoryOnly {
 		return
 	}
+	s.started = true
 	go s.loop()
 }
 
@@ -61,7 +71,21 @@ func (s *Store) Stop() {
 	close(s.stopCh)
 }
 
+// Close 停止写入协程并等待队列中剩余的条目落盘。
+func (s *Store) Close() {
+	s.Stop()
+	s.mu.Lock()
+	started := s.started
+	s.mu.Unlock()
+	if started {
+		<-s.doneCh
+	}
+}
+
 func (s *Store) Enqueue(e Entry) {
+	if s.memoryOnly {
+		return
+	}
 	select {
 	case <-s.stopCh:
 		return
@@ -81,7 +105,21 @@ func (s *Store) PutHot(e Entry) {
 	s.hotMu.Unlock()
 }
 
+// dropHot 移除 idx 对应的热条目（仅当仍是同一次保存的条目时）。
+func (s *Store) dropHot(idx EntryIndex) {
+	key := idx.Key()
+	s.hotMu.Lock()
+	defer s.hotMu.Unlock()
+	if cur, ok := s.hotByKey[key]; ok && cur.CreatedAt.Equal(idx.CreatedAt) {
+		delete(s.hotByKey, key)
+		if mappedKey, ok := s.hotByToolCall[idx.ToolCallID]; ok && mappedKey == key {
+			delete(s.hotByToolCall, idx.ToolCallID)
+		}
+	}
+}
+
 func (s *Store) loop() {
+	defer close(s.doneCh)
 	ticker := time.NewTicker(1 * time.Second)
 	defer ticker.Stop()
 
@@ -93,7 +131,7 @@ func (s *Store) loop() {
 			return
 		}
 
-		persisted, err := s.appendJSONL(batch)
+		persisted, err := s.persist(batch)
 		if persisted > 0 {
 			clear(batch[:persisted])
 			batch = batch[persisted:]
@@ -122,7 +160,7 @@ func (s *Store) loop() {
 					batch = append(batch, e)
 				default:
 					if len(batch) > 0 {
-						_, _ = s.appendJSONL(batch)
+						_, _ = s.persist(batch)
 						clear(batch)
 						batch = nil
 					}
@@ -140,6 +178,14 @@ func (s *Store) loop() {
 	}
 }
 
+// persist 将 entries 写入 SQLite（已启用时）或当天的 JSONL 文件，返回成功写入的条数。
+func (s *Store) persist(entries []Entry) (int, error) {
+	if s.db != nil {
+		return s.insertDB(entries)
+	}
+	return s.appendJSONL(entries)
+}
+
 func marshalEntryJSON(e Entry) ([]byte, error) {
 	b, err := jsonpkg.Marshal(e)
 	if err == nil {
@@ -203,6 +249,7 @@ func (s *Store) appendJSONL(entries []Entry) (int, error) {
 		persisted = append(persisted, EntryIndex{
 			RequestID:  e.RequestID,
 			ToolCallID: e.ToolCallID,
+			CallKey:    e.CallKey,
 			Model:      e.Model,
 			CreatedAt:  e.CreatedAt,
 			LastAccess: e.LastAccess,
@@ -211,6 +258,58 @@ func (s *Store) appendJSONL(entries []Entry) (int, error) {
 		})
 	}
 
+	s.markPersisted(persisted)
+
+	if writeErr != nil {
+		return len(persisted), writeErr
+	}
+	return len(persisted), nil
+}
+
+// insertDB 在一个事务中将 entries 写入 SQLite，失败时整批保留在队列中重试。
+func (s *Store) insertDB(entries []Entry) (int, error) {
+	if len(entries) == 0 {
+		return 0, nil
+	}
+	rows := make([]storage.Signature, 0, len(entries))
+	for _, e := range entries {
+		b, err := marshalEntryJSON(e)
+		if err != nil {
+			return 0, err
+		}
+		rows = append(rows, storage.Signature{
+			RequestID:  e.RequestID,
+			ToolCallID: e.ToolCallID,
+			CallKey:    e.CallKey,
+			Model:      e.Model,
+			CreatedAt:  e.CreatedAt,
+			Data:       b,
+		})
+	}
+	ids, err := s.db.InsertSignatures(rows)
+	if err != nil {
+		return 0, err
+	}
+
+	persisted := make([]EntryIndex, 0, len(entries))
+	for i, e := range entries {
+		persisted = append(persisted, EntryIndex{
+			RequestID:  e.RequestID,
+			ToolCallID: e.ToolCallID,
+			CallKey:    e.CallKey,
+			Model:      e.Model,
+			CreatedAt:  e.CreatedAt,
+			LastAccess: e.LastAccess,
+			FilePath:   s.db.Path(),
+			Offset:     ids[i],
+		})
+	}
+	s.markPersisted(persisted)
+	return len(persisted), nil
+}
+
+// markPersisted 将已落盘的索引放入 LRU，并移除仍是同一次保存的热条目。
+func (s *Store) markPersisted(persisted []EntryIndex) {
 	for _, idx := range persisted {
 		s.cache.Put(idx)
 		key := idx.Key()
@@ -228,11 +327,6 @@ func (s *Store) appendJSONL(entries []Entry) (int, error) {
 		}
 		s.hotMu.Unlock()
 	}
-
-	if writeErr != nil {
-		return len(persisted), writeErr
-	}
-	return len(persisted), nil
 }
 
 func (s *Store) LoadRecent(days int) {
@@ -240,6 +334,13 @@ func (s *Store) LoadRecent(days int) {
 		days = 1
 	}
 
+	// 启用 SQLite 时仍先加载切换前遗留的 JSONL 文件。
+	defer func() {
+		if s.db != nil {
+			s.loadDB(time.Now().AddDate(0, 0, -days))
+		}
+	}()
+
 	dir := filepath.Join(s.dataDir, "signatures")
 	entries, err := os.ReadDir(dir)
 	if err != nil {
@@ -267,6 +368,26 @@ func (s *Store) LoadRecent(days int) {
 	}
 }
 
+// loadDB 将 since 之后写入 SQLite 的签名索引放入 LRU（晚于 JSONL 文件加载，同一键以数据库中的为准）。
+func (s *Store) loadDB(since time.Time) {
+	path := s.db.Path()
+	err := s.db.RecentSignatures(since, func(id int64, row storage.Signature) {
+		s.cache.Put(EntryIndex{
+			RequestID:  row.RequestID,
+			ToolCallID: row.ToolCallID,
+			CallKey:    row.CallKey,
+			Model:      row.Model,
+			CreatedAt:  row.CreatedAt,
+			LastAccess: row.CreatedAt,
+			FilePath:   path,
+			Offset:     id,
+		})
+	})
+	if err != nil {
+		logger.Warn("从 SQLite 加载签名索引失败: %v", err)
+	}
+}
+
 func (s *Store) loadFile(path string) {
 	f, err := os.Open(path)
 	if err != nil {
@@ -343,9 +464,27 @@ func (s *Store) LoadByIndex(idx EntryIndex) (Entry, bool) {
 		return e, true
 	}
 
+	if s.db != nil && idx.FilePath == s.db.Path() {
+		return s.loadDBEntry(idx.Offset)
+	}
 	return s.LoadEntryAt(idx.FilePath, idx.Offset)
 }
 
+func (s *Store) loadDBEntry(id int64) (Entry, bool) {
+	data, ok, err := s.db.SignatureData(id)
+	if err != nil || !ok {
+		return Entry{}, false
+	}
+	var e Entry
+	if err := jsonpkg.Unmarshal(data, &e); err != nil {
+		return Entry{}, false
+	}
+	if e.Signature == "" || e.RequestID == "" || e.ToolCallID == "" {
+		return Entry{}, false
+	}
+	return e, true
+}
+
 func parseEntryIndexFromJSONLine(line []byte, filePath string, offset int64) (EntryIndex, bool) {
 	requestID, ok := extractJSONStringField(line, "requestID")
 	if !ok || requestID == "" {
@@ -366,6 +505,10 @@ func parseEntryIndexFromJSONLine(line []byte, filePath string, offset int64) (En
 		idx.Model = model
 	}
 
+	if callKey, ok := extractJSONStringField(line, "callKey"); ok {
+		idx.CallKey = callKey
+	}
+
 	if createdAt, ok := extractJSONStringField(line, "createdAt"); ok {
 		if t, err := time.Parse(time.RFC3339Nano, createdAt); err == nil {
 			idx.CreatedAt = t
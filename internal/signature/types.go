@@ -1,12 +1,18 @@
 package signature
 
-import "time"
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"time"
+)
 
 type Entry struct {
 	Signature  string    `json:"signature"`
 	Reasoning  string    `json:"reasoning,omitempty"`
 	RequestID  string    `json:"requestID"`
 	ToolCallID string    `json:"toolCallID"`
+	CallKey    string    `json:"callKey,omitempty"` // 工具调用的模糊匹配键（见 CallKey），其他条目为空
 	Model      string    `json:"model"`
 	CreatedAt  time.Time `json:"createdAt"`
 	LastAccess time.Time `json:"lastAccess"`
@@ -24,6 +30,7 @@ func (e Entry) Key() string {
 type EntryIndex struct {
 	RequestID  string    `json:"requestID"`
 	ToolCallID string    `json:"toolCallID"`
+	CallKey    string    `json:"callKey,omitempty"`
 	Model      string    `json:"model,omitempty"`
 	CreatedAt  time.Time `json:"createdAt,omitempty"`
 	LastAccess time.Time `json:"lastAccess,omitempty"`
@@ -41,3 +48,18 @@ func (i EntryIndex) Key() string {
 	}
 	return i.RequestID + ":" + i.ToolCallID
 }
+
+// CallKey 返回工具调用的模糊匹配键：函数名 + 参数规范化 JSON（键排序）的哈希。
+// 部分客户端在多轮之间会重新生成或截断 tool_call ID，此时仍可按函数名与参数找回首次下发时的规范 ID 与签名。
+func CallKey(name string, args map[string]any) string {
+	if name == "" {
+		return ""
+	}
+	// encoding/json 对 map 键排序，保证同一参数得到相同的序列化结果。
+	b, err := json.Marshal(args)
+	if err != nil {
+		return ""
+	}
+	sum := sha256.Sum256(b)
+	return name + ":" + hex.EncodeToString(sum[:12])
+}
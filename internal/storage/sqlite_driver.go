@@ -0,0 +1,13 @@
+//go:build sqlite
+
+package storage
+
+import _ "github.com/mattn/go-sqlite3"
+
+func init() {
+	driverName = "sqlite3"
+	dsnFor = func(path string) string {
+		// busy_timeout 让并发写入排队等待而不是立即返回 SQLITE_BUSY；_txlock=immediate 避免读事务升级为写事务时死锁。
+		return "file:" + path + "?_busy_timeout=5000&_synchronous=NORMAL&_txlock=immediate"
+	}
+}
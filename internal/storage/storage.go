@@ -0,0 +1,247 @@
+// Package storage 提供可选的 SQLite 存储后端（STORAGE_BACKEND=sqlite）：账号、签名、用量记录与会话记录
+// 保存在每个数据目录（默认租户为 DATA_DIR，其他租户为各自的数据目录）下的 data.db 中，以 WAL 模式打开，
+// 表结构按 migrations 顺序升级（版本号记录在 PRAGMA user_version）。
+//
+// SQLite 驱动依赖 cgo，只在以 -tags sqlite 构建时注册（见 sqlite_driver.go）；未注册时 For 返回 nil，
+// 各模块继续使用 JSON / JSONL 文件。
+package storage
+
+import (
+	"database/sql"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"anti2api-golang/refactor/internal/config"
+	"anti2api-golang/refactor/internal/logger"
+)
+
+// FileName 为数据目录中 SQLite 数据库的文件名。
+const FileName = "data.db"
+
+// driverName 为已注册的 database/sql 驱动名，为空表示构建时未包含 SQLite 驱动；dsnFor 返回打开 path 的连接串。
+var (
+	driverName string
+	dsnFor     func(path string) string
+)
+
+// migrations 依次升级表结构，下标 + 1 即升级后的 user_version；只能追加，不能修改已发布的条目。
+var migrations = []string{
+	`CREATE TABLE documents (
+		name       TEXT PRIMARY KEY,
+		data       BLOB NOT NULL,
+		updated_at INTEGER NOT NULL
+	);
+	CREATE TABLE signatures (
+		id           INTEGER PRIMARY KEY,
+		request_id   TEXT NOT NULL,
+		tool_call_id TEXT NOT NULL,
+		call_key     TEXT NOT NULL DEFAULT '',
+		model        TEXT NOT NULL DEFAULT '',
+		created_at   INTEGER NOT NULL,
+		data         BLOB NOT NULL
+	);
+	CREATE INDEX signatures_created_at ON signatures(created_at);
+	CREATE TABLE usage_records (
+		id                INTEGER PRIMARY KEY,
+		created_at        INTEGER NOT NULL,
+		tenant            TEXT NOT NULL DEFAULT '',
+		endpoint          TEXT NOT NULL DEFAULT '',
+		model             TEXT NOT NULL DEFAULT '',
+		prompt_tokens     INTEGER NOT NULL DEFAULT 0,
+		completion_tokens INTEGER NOT NULL DEFAULT 0,
+		estimated         INTEGER NOT NULL DEFAULT 0,
+		aborted           INTEGER NOT NULL DEFAULT 0
+	);
+	CREATE INDEX usage_records_created_at ON usage_records(created_at);
+	CREATE INDEX usage_records_model ON usage_records(model, created_at);
+	CREATE TABLE transcripts (
+		id          TEXT PRIMARY KEY,
+		session_key TEXT NOT NULL DEFAULT '',
+		created_at  INTEGER NOT NULL,
+		data        BLOB NOT NULL
+	);
+	CREATE INDEX transcripts_created_at ON transcripts(created_at);
+	CREATE INDEX transcripts_session ON transcripts(session_key, created_at);`,
+}
+
+// DB 为一个数据目录的 SQLite 数据库。
+type DB struct {
+	path string
+	sql  *sql.DB
+}
+
+var (
+	dbMu sync.Mutex
+	// dbs 按文件路径缓存已打开的数据库；打开失败的路径缓存为 nil，不再重试。
+	dbs = make(map[string]*DB)
+)
+
+// Available 报告构建时是否包含 SQLite 驱动。
+func Available() bool {
+	return driverName != ""
+}
+
+// Enabled 报告是否使用 SQLite 后端：STORAGE_BACKEND=sqlite 且构建时包含驱动。
+func Enabled() bool {
+	return Available() && config.Get().StorageBackend == "sqlite"
+}
+
+// ConfigProblem 检查 STORAGE_BACKEND，配置无法生效时返回说明（此时使用文件存储），否则返回空字符串。
+func ConfigProblem() string {
+	switch backend := config.Get().StorageBackend; backend {
+	case "", "file":
+		return ""
+	case "sqlite":
+		if !Available() {
+			return "STORAGE_BACKEND=sqlite 需要以 CGO_ENABLED=1 go build -tags sqlite 构建，当前构建不含 SQLite 驱动，继续使用文件存储"
+		}
+		return ""
+	default:
+		return fmt.Sprintf("STORAGE_BACKEND=%s 无效（可选 file / sqlite），使用文件存储", backend)
+	}
+}
+
+// For 返回数据目录 dataDir 的数据库（同一目录只打开一次）；未启用 SQLite 后端时返回 nil。
+// 打开或迁移失败时告警一次并返回 nil，调用方继续使用文件存储。
+func For(dataDir string) *DB {
+	if !Enabled() {
+		return nil
+	}
+	path := filepath.Join(dataDir, FileName)
+	dbMu.Lock()
+	defer dbMu.Unlock()
+	if db, ok := dbs[path]; ok {
+		return db
+	}
+	db, err := open(path)
+	if err != nil {
+		logger.Warn("打开 SQLite 数据库 %s 失败，继续使用文件存储: %v", path, err)
+		db = nil
+	}
+	dbs[path] = db
+	return db
+}
+
+// Close 关闭数据目录 dataDir 的数据库（清理租户数据前调用）；之后的 For 会重新打开。
+func Close(dataDir string) error {
+	path := filepath.Join(dataDir, FileName)
+	dbMu.Lock()
+	db := dbs[path]
+	delete(dbs, path)
+	dbMu.Unlock()
+	if db == nil {
+		return nil
+	}
+	return db.sql.Close()
+}
+
+// Path 返回数据库文件路径。
+func (db *DB) Path() string {
+	return db.path
+}
+
+// RestoreSuffix 为待恢复数据库的文件名后缀：data.db.restore 存在时，下次打开 data.db 前先用它替换 data.db
+// （数据库打开期间无法安全地覆盖文件，从备份恢复时先写到这里，重启后生效）。
+const RestoreSuffix = ".restore"
+
+// Snapshot 将数据库的一致性快照写入 dst（VACUUM INTO，不阻塞写入），并从快照中删除 dropDocuments 列出的文档。
+func (db *DB) Snapshot(dst string, dropDocuments ...string) error {
+	if _, err := db.sql.Exec(`VACUUM INTO ?`, dst); err != nil {
+		return err
+	}
+	if len(dropDocuments) == 0 {
+		return nil
+	}
+	snap, err := sql.Open(driverName, dsnFor(dst))
+	if err != nil {
+		return err
+	}
+	defer snap.Close()
+	for _, name := range dropDocuments {
+		if _, err := snap.Exec(`DELETE FROM documents WHERE name = ?`, name); err != nil {
+			return err
+		}
+	}
+	_, err = snap.Exec(`VACUUM`)
+	return err
+}
+
+// applyPendingRestore 在打开 path 前调用：存在 path+RestoreSuffix 时用它替换数据库（连同旧的 WAL 文件一起清理）。
+func applyPendingRestore(path string) error {
+	pending := path + RestoreSuffix
+	if _, err := os.Stat(pending); err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	for _, suffix := range []string{"-wal", "-shm"} {
+		if err := os.Remove(path + suffix); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	if err := os.Rename(pending, path); err != nil {
+		return err
+	}
+	logger.Info("已从备份恢复 SQLite 数据库 %s", path)
+	return nil
+}
+
+func open(path string) (*DB, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return nil, err
+	}
+	if err := applyPendingRestore(path); err != nil {
+		return nil, err
+	}
+	sqlDB, err := sql.Open(driverName, dsnFor(path))
+	if err != nil {
+		return nil, err
+	}
+	var mode string
+	if err := sqlDB.QueryRow("PRAGMA journal_mode=WAL").Scan(&mode); err != nil {
+		_ = sqlDB.Close()
+		return nil, err
+	}
+	if !strings.EqualFold(mode, "wal") {
+		_ = sqlDB.Close()
+		return nil, fmt.Errorf("无法启用 WAL 模式（当前为 %s）", mode)
+	}
+	if err := migrate(sqlDB); err != nil {
+		_ = sqlDB.Close()
+		return nil, err
+	}
+	return &DB{path: path, sql: sqlDB}, nil
+}
+
+// migrate 将表结构从 user_version 升级到 len(migrations)，每一步在独立事务中执行。
+func migrate(sqlDB *sql.DB) error {
+	var version int
+	if err := sqlDB.QueryRow("PRAGMA user_version").Scan(&version); err != nil {
+		return err
+	}
+	if version > len(migrations) {
+		return fmt.Errorf("数据库版本 %d 高于本程序支持的版本 %d，请升级程序", version, len(migrations))
+	}
+	for i := version; i < len(migrations); i++ {
+		tx, err := sqlDB.Begin()
+		if err != nil {
+			return err
+		}
+		if _, err := tx.Exec(migrations[i]); err != nil {
+			_ = tx.Rollback()
+			return fmt.Errorf("迁移到版本 %d 失败: %w", i+1, err)
+		}
+		if _, err := tx.Exec(fmt.Sprintf("PRAGMA user_version = %d", i+1)); err != nil {
+			_ = tx.Rollback()
+			return err
+		}
+		if err := tx.Commit(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,170 @@
+package storage
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"anti2api-golang/refactor/internal/config"
+)
+
+// useSQLite 启用 SQLite 后端；构建时未包含驱动（未使用 -tags sqlite）时跳过测试。
+func useSQLite(t *testing.T) string {
+	t.Helper()
+	if !Available() {
+		t.Skip("SQLite 驱动未编译（需要 -tags sqlite）")
+	}
+	c := config.Get()
+	old := c.StorageBackend
+	c.StorageBackend = "sqlite"
+	dir := t.TempDir()
+	t.Cleanup(func() {
+		_ = Close(dir)
+		c.StorageBackend = old
+	})
+	return dir
+}
+
+func TestFor_DisabledByDefault(t *testing.T) {
+	c := config.Get()
+	old := c.StorageBackend
+	t.Cleanup(func() { c.StorageBackend = old })
+
+	c.StorageBackend = "file"
+	if db := For(t.TempDir()); db != nil {
+		t.Fatal("file backend must not open a database")
+	}
+	c.StorageBackend = "bogus"
+	if ConfigProblem() == "" {
+		t.Fatal("expected a problem for an unknown backend")
+	}
+}
+
+func TestDB_MigratesAndReopens(t *testing.T) {
+	dir := useSQLite(t)
+	db := For(dir)
+	if db == nil {
+		t.Fatal("expected a database")
+	}
+	if For(dir) != db {
+		t.Fatal("the same data dir should share one database")
+	}
+	var mode string
+	var version int
+	_ = db.sql.QueryRow("PRAGMA journal_mode").Scan(&mode)
+	_ = db.sql.QueryRow("PRAGMA user_version").Scan(&version)
+	if mode != "wal" || version != len(migrations) {
+		t.Fatalf("journal_mode=%s user_version=%d", mode, version)
+	}
+
+	if err := db.SaveDocument("accounts.json", []byte(`[1]`)); err != nil {
+		t.Fatal(err)
+	}
+	if err := Close(dir); err != nil {
+		t.Fatal(err)
+	}
+	db = For(dir)
+	if data, ok, err := db.LoadDocument("accounts.json"); err != nil || !ok || string(data) != `[1]` {
+		t.Fatalf("document lost after reopen: %q %v %v", data, ok, err)
+	}
+}
+
+func TestDB_SignaturesAndTranscripts(t *testing.T) {
+	db := For(useSQLite(t))
+
+	now := time.Now()
+	ids, err := db.InsertSignatures([]Signature{
+		{RequestID: "r1", ToolCallID: "c1", CreatedAt: now.Add(-72 * time.Hour), Data: []byte(`{"old":true}`)},
+		{RequestID: "r2", ToolCallID: "c2", CallKey: "k", CreatedAt: now, Data: []byte(`{"new":true}`)},
+	})
+	if err != nil || len(ids) != 2 {
+		t.Fatalf("insert: %v %v", ids, err)
+	}
+	if data, ok, _ := db.SignatureData(ids[1]); !ok || string(data) != `{"new":true}` {
+		t.Fatalf("unexpected data %q", data)
+	}
+	var recent []string
+	_ = db.RecentSignatures(now.Add(-time.Hour), func(id int64, s Signature) { recent = append(recent, s.ToolCallID+"/"+s.CallKey) })
+	if strings.Join(recent, ",") != "c2/k" {
+		t.Fatalf("recent signatures %v", recent)
+	}
+
+	day := time.Date(2026, 1, 2, 10, 0, 0, 0, time.Local)
+	for i, id := range []string{"t1", "t2", "t3"} {
+		session := "s1"
+		if id == "t3" {
+			session = "s2"
+		}
+		if err := db.InsertTranscript(Transcript{ID: id, SessionKey: session, CreatedAt: day.Add(time.Duration(i) * time.Hour), Data: []byte(`"` + id + `"`)}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if rows, _ := db.ListTranscripts("s1", 10); len(rows) != 2 || string(rows[0]) != `"t2"` {
+		t.Fatalf("list newest first per session, got %q", rows)
+	}
+	var exported []string
+	_ = db.ExportTranscripts("", "2026-01-02", func(data []byte) error {
+		exported = append(exported, string(data))
+		return nil
+	})
+	if strings.Join(exported, ",") != `"t1","t2","t3"` {
+		t.Fatalf("export by date, got %v", exported)
+	}
+	if n, err := db.PruneTranscripts(day.Add(30*time.Minute), 0); err != nil || n != 1 {
+		t.Fatalf("prune by age: n=%d err=%v", n, err)
+	}
+	if n, err := db.PruneTranscripts(time.Time{}, 4); err != nil || n != 1 {
+		t.Fatalf("prune by size: n=%d err=%v", n, err)
+	}
+	if _, ok, _ := db.FindTranscript("t3"); !ok {
+		t.Fatal("prune should keep the newest transcript")
+	}
+	if err := db.PurgeTranscripts(); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok, _ := db.FindTranscript("t1"); ok {
+		t.Fatal("purge should remove transcripts")
+	}
+}
+
+func TestDB_SnapshotAndPendingRestore(t *testing.T) {
+	dir := useSQLite(t)
+	db := For(dir)
+	if db == nil {
+		t.Fatal("expected a database")
+	}
+	_ = db.SaveDocument("accounts.json", []byte(`[1]`))
+	_ = db.SaveDocument("other.json", []byte(`{}`))
+
+	snap := filepath.Join(t.TempDir(), FileName)
+	if err := db.Snapshot(snap, "accounts.json"); err != nil {
+		t.Fatalf("Snapshot: %v", err)
+	}
+	if err := os.Rename(snap, db.Path()+RestoreSuffix); err != nil {
+		t.Fatal(err)
+	}
+	_ = db.SaveDocument("later.json", []byte(`{}`))
+
+	// 重新打开时用待恢复的快照替换数据库。
+	if err := Close(dir); err != nil {
+		t.Fatal(err)
+	}
+	db = For(dir)
+	if db == nil {
+		t.Fatal("expected the restored database to open")
+	}
+	if _, ok, _ := db.LoadDocument("accounts.json"); ok {
+		t.Fatal("dropped document should not be in the snapshot")
+	}
+	if _, ok, _ := db.LoadDocument("other.json"); !ok {
+		t.Fatal("snapshot should keep other documents")
+	}
+	if _, ok, _ := db.LoadDocument("later.json"); ok {
+		t.Fatal("writes after the snapshot should be replaced")
+	}
+	if _, err := os.Stat(db.Path() + RestoreSuffix); !os.IsNotExist(err) {
+		t.Fatal("pending restore file should be consumed")
+	}
+}
@@ -0,0 +1,224 @@
+package storage
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+)
+
+// LoadDocument 读取名为 name 的整体文档（如账号列表），不存在时返回 ok=false。
+func (db *DB) LoadDocument(name string) (data []byte, ok bool, err error) {
+	err = db.sql.QueryRow(`SELECT data FROM documents WHERE name = ?`, name).Scan(&data)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, err
+	}
+	return data, true, nil
+}
+
+// SaveDocument 写入（覆盖）名为 name 的整体文档。
+func (db *DB) SaveDocument(name string, data []byte) error {
+	_, err := db.sql.Exec(`INSERT INTO documents (name, data, updated_at) VALUES (?, ?, ?)
+		ON CONFLICT(name) DO UPDATE SET data = excluded.data, updated_at = excluded.updated_at`,
+		name, data, time.Now().UnixMilli())
+	return err
+}
+
+// Signature 为一条签名记录；Data 为完整条目的 JSON。
+type Signature struct {
+	RequestID  string
+	ToolCallID string
+	CallKey    string
+	Model      string
+	CreatedAt  time.Time
+	Data       []byte
+}
+
+// InsertSignatures 在一个事务中写入 rows，返回各行的 rowid（与 rows 一一对应）。
+func (db *DB) InsertSignatures(rows []Signature) ([]int64, error) {
+	tx, err := db.sql.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = tx.Rollback() }()
+	stmt, err := tx.Prepare(`INSERT INTO signatures (request_id, tool_call_id, call_key, model, created_at, data) VALUES (?, ?, ?, ?, ?, ?)`)
+	if err != nil {
+		return nil, err
+	}
+	defer stmt.Close()
+
+	ids := make([]int64, 0, len(rows))
+	for _, r := range rows {
+		res, err := stmt.Exec(r.RequestID, r.ToolCallID, r.CallKey, r.Model, r.CreatedAt.UnixNano(), r.Data)
+		if err != nil {
+			return nil, err
+		}
+		id, err := res.LastInsertId()
+		if err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return ids, nil
+}
+
+// SignatureData 返回 rowid 为 id 的签名条目 JSON。
+func (db *DB) SignatureData(id int64) ([]byte, bool, error) {
+	var data []byte
+	err := db.sql.QueryRow(`SELECT data FROM signatures WHERE id = ?`, id).Scan(&data)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, err
+	}
+	return data, true, nil
+}
+
+// RecentSignatures 按写入顺序回调 since 之后的签名索引（不含 Data）。
+func (db *DB) RecentSignatures(since time.Time, fn func(id int64, s Signature)) error {
+	rows, err := db.sql.Query(`SELECT id, request_id, tool_call_id, call_key, model, created_at FROM signatures WHERE created_at >= ? ORDER BY id`, since.UnixNano())
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var (
+			id        int64
+			s         Signature
+			createdAt int64
+		)
+		if err := rows.Scan(&id, &s.RequestID, &s.ToolCallID, &s.CallKey, &s.Model, &createdAt); err != nil {
+			return err
+		}
+		s.CreatedAt = time.Unix(0, createdAt)
+		fn(id, s)
+	}
+	return rows.Err()
+}
+
+// UsageRecord 为一次生成请求的用量（见 usage.Record）。
+type UsageRecord struct {
+	CreatedAt        time.Time
+	Tenant           string
+	Endpoint         string
+	Model            string
+	PromptTokens     int
+	CompletionTokens int
+	Estimated        bool
+	Aborted          bool
+}
+
+// InsertUsage 追加一条用量记录。
+func (db *DB) InsertUsage(r UsageRecord) error {
+	_, err := db.sql.Exec(`INSERT INTO usage_records (created_at, tenant, endpoint, model, prompt_tokens, completion_tokens, estimated, aborted) VALUES (?, ?, ?, ?, ?, ?, ?, ?)`,
+		r.CreatedAt.UnixNano(), r.Tenant, r.Endpoint, r.Model, r.PromptTokens, r.CompletionTokens, r.Estimated, r.Aborted)
+	return err
+}
+
+// Transcript 为一条会话记录；Data 为完整记录的 JSON。
+type Transcript struct {
+	ID         string
+	SessionKey string
+	CreatedAt  time.Time
+	Data       []byte
+}
+
+// InsertTranscript 写入一条会话记录（ID 相同时覆盖）。
+func (db *DB) InsertTranscript(t Transcript) error {
+	_, err := db.sql.Exec(`INSERT OR REPLACE INTO transcripts (id, session_key, created_at, data) VALUES (?, ?, ?, ?)`,
+		t.ID, t.SessionKey, t.CreatedAt.UnixNano(), t.Data)
+	return err
+}
+
+// ListTranscripts 返回最近的 limit 条会话记录 JSON（新的在前），session 非空时只返回该会话的记录。
+func (db *DB) ListTranscripts(session string, limit int) ([][]byte, error) {
+	var out [][]byte
+	err := db.eachTranscript(`SELECT data FROM transcripts WHERE (? = '' OR session_key = ?) ORDER BY created_at DESC, rowid DESC LIMIT ?`,
+		func(data []byte) error {
+			out = append(out, data)
+			return nil
+		}, session, session, limit)
+	return out, err
+}
+
+// FindTranscript 按 ID 查找会话记录 JSON。
+func (db *DB) FindTranscript(id string) ([]byte, bool, error) {
+	var data []byte
+	err := db.sql.QueryRow(`SELECT data FROM transcripts WHERE id = ?`, id).Scan(&data)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, err
+	}
+	return data, true, nil
+}
+
+// ExportTranscripts 按时间顺序回调会话记录 JSON；session 为空表示不过滤，date（YYYY-MM-DD，本地时间）非空时只返回当天的记录。
+func (db *DB) ExportTranscripts(session, date string, fn func(data []byte) error) error {
+	from, to := int64(0), int64(1<<63-1)
+	if date != "" {
+		day, err := time.ParseInLocation(time.DateOnly, date, time.Local)
+		if err != nil {
+			return err
+		}
+		from, to = day.UnixNano(), day.AddDate(0, 0, 1).UnixNano()
+	}
+	return db.eachTranscript(`SELECT data FROM transcripts WHERE (? = '' OR session_key = ?) AND created_at >= ? AND created_at < ? ORDER BY created_at, rowid`,
+		fn, session, session, from, to)
+}
+
+// PruneTranscripts 删除 before 之前的会话记录（before 为零值时不按时间删除），maxBytes > 0 时再从最旧的记录开始删除，
+// 直到剩余记录的总大小不超过 maxBytes。返回删除的条数。
+func (db *DB) PruneTranscripts(before time.Time, maxBytes int64) (int64, error) {
+	var n int64
+	if !before.IsZero() {
+		res, err := db.sql.Exec(`DELETE FROM transcripts WHERE created_at < ?`, before.UnixNano())
+		if err != nil {
+			return 0, err
+		}
+		deleted, _ := res.RowsAffected()
+		n += deleted
+	}
+	if maxBytes > 0 {
+		res, err := db.sql.Exec(`DELETE FROM transcripts WHERE rowid IN (
+			SELECT rowid FROM (SELECT rowid, SUM(LENGTH(data)) OVER (ORDER BY created_at DESC, rowid DESC) AS total FROM transcripts)
+			WHERE total > ?)`, maxBytes)
+		if err != nil {
+			return n, err
+		}
+		deleted, _ := res.RowsAffected()
+		n += deleted
+	}
+	return n, nil
+}
+
+// PurgeTranscripts 删除全部会话记录。
+func (db *DB) PurgeTranscripts() error {
+	_, err := db.sql.Exec(`DELETE FROM transcripts`)
+	return err
+}
+
+func (db *DB) eachTranscript(query string, fn func(data []byte) error, args ...any) error {
+	rows, err := db.sql.Query(query, args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var data []byte
+		if err := rows.Scan(&data); err != nil {
+			return err
+		}
+		if err := fn(data); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
@@ -0,0 +1,83 @@
+package transcript
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"time"
+
+	"anti2api-golang/refactor/internal/journal"
+	"anti2api-golang/refactor/internal/middleware"
+	"anti2api-golang/refactor/internal/pkg/id"
+)
+
+// Recorder 收集单个请求的会话记录，并在开启请求日志时写入 journal；
+// 会话记录与请求日志都未开启时 Begin 返回 nil，所有方法对 nil 安全。
+type Recorder struct {
+	rec   Record
+	start time.Time
+	save  bool
+}
+
+// Begin 在请求体解析成功后调用。会话键优先取 X-Session-ID 请求头，否则使用记录 ID；记录保存到请求所属租户的存储中。
+func Begin(r *http.Request, endpoint string, body []byte, model string, stream bool) *Recorder {
+	save := Enabled()
+	if !save && !journal.Enabled() {
+		return nil
+	}
+	now := time.Now()
+	recID := id.RequestID()
+	sessionKey := strings.TrimSpace(r.Header.Get("X-Session-ID"))
+	if sessionKey == "" {
+		sessionKey = recID
+	}
+	journal.Start(recID, endpoint, model, stream)
+	var clientReq json.RawMessage
+	if save && json.Valid(body) {
+		clientReq = append(json.RawMessage(nil), body...)
+	}
+	return &Recorder{
+		rec: Record{
+			ID:            recID,
+			SessionKey:    sessionKey,
+			Tenant:        middleware.TenantFromContext(r.Context()),
+			Endpoint:      endpoint,
+			Model:         model,
+			Stream:        stream,
+			CreatedAt:     now,
+			ClientRequest: clientReq,
+		},
+		start: now,
+		save:  save,
+	}
+}
+
+// SetAccount 记录本次请求选用的账号（仅写入请求日志）。
+func (rc *Recorder) SetAccount(account string) {
+	if rc == nil {
+		return
+	}
+	journal.Account(rc.rec.ID, account)
+}
+
+// Finish 填充结果并异步写入存储。
+func (rc *Recorder) Finish(res Result) {
+	if rc == nil {
+		return
+	}
+	rec := rc.rec
+	rec.Status = res.Status
+	if res.Model != "" {
+		rec.Model = res.Model
+	}
+	rec.VertexRequest = res.VertexRequest
+	rec.VertexResponse = res.VertexResponse
+	rec.ClientResponse = res.ClientResponse
+	rec.Error = res.Error
+	duration := time.Since(rc.start)
+	rec.DurationMs = duration.Milliseconds()
+	journal.End(rec.ID, rec.Model, rec.Status, rec.Error, duration)
+	if rc.save {
+		GetStoreFor(rec.Tenant).Save(rec)
+	}
+}
@@ -0,0 +1,362 @@
+package transcript
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"anti2api-golang/refactor/internal/config"
+	"anti2api-golang/refactor/internal/logger"
+	jsonpkg "anti2api-golang/refactor/internal/pkg/json"
+	"anti2api-golang/refactor/internal/storage"
+)
+
+const (
+	queueSize        = 256
+	DefaultListLimit = 100
+	// pruneInterval 为两次按 TRANSCRIPT_RETENTION_DAYS / TRANSCRIPT_MAX_BYTES 清理旧记录的最短间隔。
+	pruneInterval = time.Minute
+)
+
+// Store 以按天分片的 JSONL 文件保存会话记录（data/transcripts/YYYY-MM-DD.jsonl），写入在后台协程中完成。
+// 写入后定期删除超过保留天数或总大小上限的最旧记录。
+type Store struct {
+	dir       string
+	queue     chan Record
+	mu        sync.Mutex
+	lastPrune time.Time
+	// dataDir 非空时按 storage.For(dataDir) 选择 SQLite 后端（每次操作重新获取，租户数据清理后会重新打开）。
+	dataDir string
+}
+
+var (
+	storeOnce sync.Once
+	storeInst *Store
+)
+
+// Enabled 报告是否开启了会话记录（TRANSCRIPT_ENABLED）。
+func Enabled() bool {
+	return config.Get().TranscriptEnabled
+}
+
+func GetStore() *Store {
+	storeOnce.Do(func() {
+		storeInst = NewStore(filepath.Join(config.Get().DataDir, "transcripts"))
+		storeInst.dataDir = config.Get().DataDir
+		go storeInst.loop()
+	})
+	return storeInst
+}
+
+var (
+	tenantMu     sync.Mutex
+	tenantStores = make(map[string]*Store)
+)
+
+// GetStoreFor 返回租户的会话记录存储（DATA_DIR/tenants/<租户名>/transcripts）；默认租户（空字符串）即 GetStore。
+func GetStoreFor(tenant string) *Store {
+	if tenant == "" {
+		return GetStore()
+	}
+	tenantMu.Lock()
+	defer tenantMu.Unlock()
+	s := tenantStores[tenant]
+	if s == nil {
+		s = NewStore(filepath.Join(config.TenantDataDir(tenant), "transcripts"))
+		s.dataDir = config.TenantDataDir(tenant)
+		go s.loop()
+		tenantStores[tenant] = s
+	}
+	return s
+}
+
+// Purge 删除存储中的全部记录文件（与写入互斥，之后的记录写入新文件）。
+func (s *Store) Purge() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if db := s.database(); db != nil {
+		if err := db.PurgeTranscripts(); err != nil {
+			return err
+		}
+	}
+	return os.RemoveAll(s.dir)
+}
+
+// database 返回 SQLite 后端，未启用时返回 nil（使用 JSONL 文件）。
+func (s *Store) database() *storage.DB {
+	if s.dataDir == "" {
+		return nil
+	}
+	return storage.For(s.dataDir)
+}
+
+func NewStore(dir string) *Store {
+	return &Store{dir: dir, queue: make(chan Record, queueSize)}
+}
+
+// Save 将记录放入写入队列；队列已满时丢弃并告警，避免阻塞请求处理。数据目录只读时不保存。
+func (s *Store) Save(rec Record) {
+	if config.DataDirReadOnly() {
+		return
+	}
+	select {
+	case s.queue <- rec:
+	default:
+		logger.Warn("会话记录写入队列已满，丢弃记录 %s", rec.ID)
+	}
+}
+
+func (s *Store) loop() {
+	for rec := range s.queue {
+		if err := s.append(rec); err != nil {
+			logger.Warn("写入会话记录失败: %v", err)
+		}
+	}
+}
+
+func (s *Store) append(rec Record) error {
+	b, err := jsonpkg.Marshal(rec)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if db := s.database(); db != nil {
+		if err := db.InsertTranscript(storage.Transcript{ID: rec.ID, SessionKey: rec.SessionKey, CreatedAt: rec.CreatedAt, Data: b}); err != nil {
+			return err
+		}
+		s.pruneLocked(time.Now())
+		return nil
+	}
+	b = append(b, '\n')
+
+	if err := os.MkdirAll(s.dir, 0o755); err != nil {
+		return err
+	}
+	day := rec.CreatedAt
+	if day.IsZero() {
+		day = time.Now()
+	}
+	f, err := os.OpenFile(filepath.Join(s.dir, day.Format("2006-01-02")+".jsonl"), os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o644)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	if _, err := f.Write(b); err != nil {
+		return err
+	}
+	s.pruneLocked(time.Now())
+	return nil
+}
+
+// pruneLocked 按 TRANSCRIPT_RETENTION_DAYS / TRANSCRIPT_MAX_BYTES 删除最旧的记录（间隔至少 pruneInterval）；调用方需持有 s.mu。
+func (s *Store) pruneLocked(now time.Time) {
+	cfg := config.Get()
+	if (cfg.TranscriptRetentionDays <= 0 && cfg.TranscriptMaxBytes <= 0) || now.Sub(s.lastPrune) < pruneInterval {
+		return
+	}
+	s.lastPrune = now
+
+	var before time.Time
+	if cfg.TranscriptRetentionDays > 0 {
+		y, m, d := now.AddDate(0, 0, -cfg.TranscriptRetentionDays).Date()
+		before = time.Date(y, m, d, 0, 0, 0, 0, now.Location())
+	}
+	maxBytes := int64(max(cfg.TranscriptMaxBytes, 0))
+	if db := s.database(); db != nil {
+		if n, err := db.PruneTranscripts(before, maxBytes); err != nil {
+			logger.Warn("清理会话记录失败: %v", err)
+		} else if n > 0 {
+			logger.Info("已清理 %d 条过期或超出大小上限的会话记录", n)
+		}
+	}
+	s.pruneFiles(before, maxBytes)
+}
+
+// pruneFiles 删除日期早于 before 的记录文件，maxBytes > 0 时再从最旧的文件开始删除，直到总大小不超过 maxBytes
+// （至少保留最新的一个文件）。
+func (s *Store) pruneFiles(before time.Time, maxBytes int64) {
+	files := s.files("")
+	if len(files) == 0 {
+		return
+	}
+	sizes := make([]int64, len(files))
+	var total int64
+	for i, path := range files {
+		if fi, err := os.Stat(path); err == nil {
+			sizes[i] = fi.Size()
+			total += sizes[i]
+		}
+	}
+	cutoff := ""
+	if !before.IsZero() {
+		cutoff = before.Format("2006-01-02") + ".jsonl"
+	}
+	for i, path := range files[:len(files)-1] {
+		expired := cutoff != "" && filepath.Base(path) < cutoff
+		if !expired && (maxBytes <= 0 || total <= maxBytes) {
+			break
+		}
+		if err := os.Remove(path); err != nil {
+			logger.Warn("删除会话记录文件失败: %v", err)
+			continue
+		}
+		total -= sizes[i]
+		logger.Info("已删除会话记录文件 %s", filepath.Base(path))
+	}
+}
+
+// files 返回所有记录文件（按日期升序）；date 非空时只返回该日期的文件。
+func (s *Store) files(date string) []string {
+	entries, err := os.ReadDir(s.dir)
+	if err != nil {
+		return nil
+	}
+	var out []string
+	for _, de := range entries {
+		name := de.Name()
+		if de.IsDir() || !strings.HasSuffix(name, ".jsonl") {
+			continue
+		}
+		if date != "" && name != date+".jsonl" {
+			continue
+		}
+		out = append(out, filepath.Join(s.dir, name))
+	}
+	sort.Strings(out)
+	return out
+}
+
+// eachLine 依次回调文件中的每一行（不含换行符）；回调返回 false 时停止。
+func eachLine(path string, fn func(line []byte) bool) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	r := bufio.NewReaderSize(f, 64*1024)
+	for {
+		line, err := r.ReadBytes('\n')
+		if trimmed := bytes.TrimSpace(line); len(trimmed) > 0 {
+			if !fn(trimmed) {
+				return nil
+			}
+		}
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				return nil
+			}
+			return err
+		}
+	}
+}
+
+// List 返回最近的记录摘要（新的在前），session 非空时只返回该会话的记录。
+func (s *Store) List(session string, limit int) []Summary {
+	if limit <= 0 {
+		limit = DefaultListLimit
+	}
+	if db := s.database(); db != nil {
+		rows, err := db.ListTranscripts(session, limit)
+		if err != nil {
+			logger.Warn("读取会话记录失败: %v", err)
+		}
+		out := make([]Summary, 0, len(rows))
+		for _, row := range rows {
+			var sum Summary
+			if err := jsonpkg.Unmarshal(row, &sum); err == nil {
+				out = append(out, sum)
+			}
+		}
+		return out
+	}
+
+	files := s.files("")
+	var out []Summary
+	for i := len(files) - 1; i >= 0 && len(out) < limit; i-- {
+		var day []Summary
+		_ = eachLine(files[i], func(line []byte) bool {
+			var sum Summary
+			if err := jsonpkg.Unmarshal(line, &sum); err != nil {
+				return true
+			}
+			if session != "" && sum.SessionKey != session {
+				return true
+			}
+			day = append(day, sum)
+			return true
+		})
+		for j := len(day) - 1; j >= 0 && len(out) < limit; j-- {
+			out = append(out, day[j])
+		}
+	}
+	return out
+}
+
+// Find 按 ID 查找完整记录，返回原始 JSON。
+func (s *Store) Find(id string) ([]byte, bool) {
+	if id == "" {
+		return nil, false
+	}
+	if db := s.database(); db != nil {
+		if data, ok, err := db.FindTranscript(id); err == nil && ok {
+			return data, true
+		}
+	}
+	files := s.files("")
+	var found []byte
+	for i := len(files) - 1; i >= 0 && found == nil; i-- {
+		_ = eachLine(files[i], func(line []byte) bool {
+			var sum Summary
+			if err := jsonpkg.Unmarshal(line, &sum); err != nil || sum.ID != id {
+				return true
+			}
+			found = append([]byte(nil), line...)
+			return false
+		})
+	}
+	return found, found != nil
+}
+
+// Export 将记录以 JSONL 写入 w；session / date 为空表示不过滤。
+// 启用 SQLite 时先输出切换前遗留的 JSONL 文件，再输出数据库中的记录。
+func (s *Store) Export(w io.Writer, session, date string) error {
+	for _, path := range s.files(date) {
+		var writeErr error
+		err := eachLine(path, func(line []byte) bool {
+			if session != "" {
+				var sum Summary
+				if err := jsonpkg.Unmarshal(line, &sum); err != nil || sum.SessionKey != session {
+					return true
+				}
+			}
+			if _, writeErr = w.Write(append(line, '\n')); writeErr != nil {
+				return false
+			}
+			return true
+		})
+		if writeErr != nil {
+			return writeErr
+		}
+		if err != nil {
+			return err
+		}
+	}
+	if db := s.database(); db != nil {
+		return db.ExportTranscripts(session, date, func(data []byte) error {
+			_, err := w.Write(append(data, '\n'))
+			return err
+		})
+	}
+	return nil
+}
@@ -0,0 +1,122 @@
+package transcript
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"anti2api-golang/refactor/internal/config"
+)
+
+func withTranscriptLimits(t *testing.T, days, maxBytes int) {
+	cfg := config.Get()
+	oldDays, oldBytes := cfg.TranscriptRetentionDays, cfg.TranscriptMaxBytes
+	t.Cleanup(func() { cfg.TranscriptRetentionDays, cfg.TranscriptMaxBytes = oldDays, oldBytes })
+	cfg.TranscriptRetentionDays, cfg.TranscriptMaxBytes = days, maxBytes
+}
+
+func TestStore_ListFindExport(t *testing.T) {
+	withTranscriptLimits(t, 0, 0)
+	s := NewStore(t.TempDir())
+	day1 := time.Date(2025, 1, 1, 10, 0, 0, 0, time.Local)
+	day2 := day1.Add(24 * time.Hour)
+
+	for _, rec := range []Record{
+		{ID: "a", SessionKey: "s1", Endpoint: "openai", Status: 200, CreatedAt: day1},
+		{ID: "b", SessionKey: "s2", Endpoint: "claude", Status: 200, CreatedAt: day1.Add(time.Minute)},
+		{ID: "c", SessionKey: "s1", Endpoint: "openai", Status: 429, CreatedAt: day2, ClientRequest: []byte(`{"model":"m"}`)},
+	} {
+		if err := s.append(rec); err != nil {
+			t.Fatalf("append: %v", err)
+		}
+	}
+
+	all := s.List("", 0)
+	if len(all) != 3 || all[0].ID != "c" || all[1].ID != "b" || all[2].ID != "a" {
+		t.Fatalf("expected newest-first order c,b,a; got %#v", all)
+	}
+	if got := s.List("s1", 1); len(got) != 1 || got[0].ID != "c" {
+		t.Fatalf("session filter/limit mismatch: %#v", got)
+	}
+
+	raw, ok := s.Find("c")
+	if !ok || !strings.Contains(string(raw), `"clientRequest":{"model":"m"}`) {
+		t.Fatalf("find mismatch: ok=%v raw=%s", ok, raw)
+	}
+	if _, ok := s.Find("missing"); ok {
+		t.Fatalf("expected missing record not to be found")
+	}
+
+	var buf bytes.Buffer
+	if err := s.Export(&buf, "s1", ""); err != nil {
+		t.Fatalf("export: %v", err)
+	}
+	if lines := strings.Split(strings.TrimSpace(buf.String()), "\n"); len(lines) != 2 {
+		t.Fatalf("expected 2 exported lines, got %d: %s", len(lines), buf.String())
+	}
+
+	buf.Reset()
+	if err := s.Export(&buf, "", "2025-01-01"); err != nil {
+		t.Fatalf("export: %v", err)
+	}
+	if lines := strings.Split(strings.TrimSpace(buf.String()), "\n"); len(lines) != 2 {
+		t.Fatalf("expected 2 exported lines for date filter, got %d", len(lines))
+	}
+}
+
+func TestStore_Purge(t *testing.T) {
+	s := NewStore(t.TempDir())
+	if err := s.append(Record{ID: "a", CreatedAt: time.Now()}); err != nil {
+		t.Fatalf("append: %v", err)
+	}
+	if err := s.Purge(); err != nil {
+		t.Fatalf("purge: %v", err)
+	}
+	if got := s.List("", 0); len(got) != 0 {
+		t.Fatalf("expected no records after purge, got %#v", got)
+	}
+	if err := s.append(Record{ID: "b", CreatedAt: time.Now()}); err != nil {
+		t.Fatalf("append after purge: %v", err)
+	}
+	if got := s.List("", 0); len(got) != 1 || got[0].ID != "b" {
+		t.Fatalf("expected new record after purge, got %#v", got)
+	}
+}
+
+func TestStore_PruneByAgeAndSize(t *testing.T) {
+	withTranscriptLimits(t, 7, 0)
+	dir := t.TempDir()
+	s := NewStore(dir)
+	now := time.Now()
+	for _, days := range []int{30, 8, 6, 1} {
+		name := now.AddDate(0, 0, -days).Format("2006-01-02") + ".jsonl"
+		if err := os.WriteFile(filepath.Join(dir, name), bytes.Repeat([]byte("x"), 100), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := s.append(Record{ID: "today", CreatedAt: now}); err != nil {
+		t.Fatalf("append: %v", err)
+	}
+	if files := s.files(""); len(files) != 3 {
+		t.Fatalf("expected files older than 7 days to be removed, got %v", files)
+	}
+
+	// 同一间隔内不重复清理。
+	withTranscriptLimits(t, 0, 150)
+	if err := s.append(Record{ID: "again", CreatedAt: now}); err != nil {
+		t.Fatalf("append: %v", err)
+	}
+	if files := s.files(""); len(files) != 3 {
+		t.Fatalf("prune should be rate limited, got %v", files)
+	}
+
+	s.lastPrune = time.Time{}
+	s.pruneLocked(now)
+	files := s.files("")
+	if len(files) != 1 || filepath.Base(files[0]) != now.Format("2006-01-02")+".jsonl" {
+		t.Fatalf("expected only the newest file under TRANSCRIPT_MAX_BYTES, got %v", files)
+	}
+}
@@ -0,0 +1,48 @@
+package transcript
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// Record 是一次完整的请求记录：客户端原始请求、解析后的 Vertex 请求/响应以及返回给客户端的响应。
+type Record struct {
+	ID             string          `json:"id"`
+	SessionKey     string          `json:"sessionKey"`
+	Tenant         string          `json:"tenant,omitempty"`
+	Endpoint       string          `json:"endpoint"`
+	Model          string          `json:"model,omitempty"`
+	Stream         bool            `json:"stream"`
+	Status         int             `json:"status"`
+	Error          string          `json:"error,omitempty"`
+	CreatedAt      time.Time       `json:"createdAt"`
+	DurationMs     int64           `json:"durationMs"`
+	ClientRequest  json.RawMessage `json:"clientRequest,omitempty"`
+	VertexRequest  any             `json:"vertexRequest,omitempty"`
+	VertexResponse any             `json:"vertexResponse,omitempty"`
+	ClientResponse any             `json:"clientResponse,omitempty"`
+}
+
+// Summary 是 Record 的轻量视图，用于管理面板列表（不含请求/响应正文）。
+type Summary struct {
+	ID         string    `json:"id"`
+	SessionKey string    `json:"sessionKey"`
+	Tenant     string    `json:"tenant,omitempty"`
+	Endpoint   string    `json:"endpoint"`
+	Model      string    `json:"model,omitempty"`
+	Stream     bool      `json:"stream"`
+	Status     int       `json:"status"`
+	Error      string    `json:"error,omitempty"`
+	CreatedAt  time.Time `json:"createdAt"`
+	DurationMs int64     `json:"durationMs"`
+}
+
+// Result 是请求结束时交给 Recorder 的结果。
+type Result struct {
+	Status         int
+	Model          string
+	VertexRequest  any
+	VertexResponse any
+	ClientResponse any
+	Error          string
+}
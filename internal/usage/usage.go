@@ -0,0 +1,157 @@
+// Package usage 按模型统计进程启动以来的 token 用量。上游没有返回 usageMetadata 或客户端中途断开流式请求时，
+// 记录的是按已输出内容估算的用量（Estimated / Aborted 计数分别说明有多少请求属于这类情况）。
+// 配置了多租户（TENANTS）时还会按租户分别统计。启用 SQLite 存储后端时每条记录还会写入 usage_records 表，便于按时间查询。
+package usage
+
+import (
+	"sync"
+	"time"
+
+	"anti2api-golang/refactor/internal/config"
+	"anti2api-golang/refactor/internal/logger"
+	"anti2api-golang/refactor/internal/storage"
+)
+
+// Record 为一次生成请求的用量。
+type Record struct {
+	Endpoint         string
+	Model            string
+	PromptTokens     int
+	CompletionTokens int
+	// Estimated 表示用量（全部或部分）为估算值。
+	Estimated bool
+	// Aborted 表示客户端在流式响应结束前断开。
+	Aborted bool
+	// Tenant 为请求所属的租户，空字符串表示默认租户（不单独统计）。
+	Tenant string
+}
+
+// ModelUsage 为单个模型的累计用量。
+type ModelUsage struct {
+	Requests         int64 `json:"requests"`
+	PromptTokens     int64 `json:"promptTokens"`
+	CompletionTokens int64 `json:"completionTokens"`
+	Estimated        int64 `json:"estimated"`
+	Aborted          int64 `json:"aborted"`
+}
+
+var (
+	mu       sync.Mutex
+	byModel  = make(map[string]*ModelUsage)
+	byTenant = make(map[string]map[string]*ModelUsage)
+)
+
+// Add 累加一条用量记录。
+func Add(r Record) {
+	persist(r)
+	mu.Lock()
+	defer mu.Unlock()
+	add(byModel, r)
+	if r.Tenant != "" {
+		models := byTenant[r.Tenant]
+		if models == nil {
+			models = make(map[string]*ModelUsage)
+			byTenant[r.Tenant] = models
+		}
+		add(models, r)
+	}
+}
+
+func add(models map[string]*ModelUsage, r Record) {
+	u := models[r.Model]
+	if u == nil {
+		u = &ModelUsage{}
+		models[r.Model] = u
+	}
+	u.Requests++
+	u.PromptTokens += int64(r.PromptTokens)
+	u.CompletionTokens += int64(r.CompletionTokens)
+	if r.Estimated {
+		u.Estimated++
+	}
+	if r.Aborted {
+		u.Aborted++
+	}
+}
+
+var (
+	persistOnce sync.Once
+	persistCh   chan storage.UsageRecord
+)
+
+// persist 将记录放入 SQLite 写入队列（未启用时忽略）；队列已满时丢弃，只影响历史记录，不影响内存中的统计。
+func persist(r Record) {
+	if !storage.Enabled() {
+		return
+	}
+	persistOnce.Do(func() {
+		persistCh = make(chan storage.UsageRecord, 256)
+		go persistLoop()
+	})
+	select {
+	case persistCh <- storage.UsageRecord{
+		CreatedAt:        time.Now(),
+		Tenant:           r.Tenant,
+		Endpoint:         r.Endpoint,
+		Model:            r.Model,
+		PromptTokens:     r.PromptTokens,
+		CompletionTokens: r.CompletionTokens,
+		Estimated:        r.Estimated,
+		Aborted:          r.Aborted,
+	}:
+	default:
+	}
+}
+
+func persistLoop() {
+	for rec := range persistCh {
+		db := storage.For(config.Get().DataDir)
+		if db == nil || config.DataDirReadOnly() {
+			continue
+		}
+		if err := db.InsertUsage(rec); err != nil {
+			logger.Warn("写入用量记录失败: %v", err)
+		}
+	}
+}
+
+// Snapshot 返回按模型的累计用量副本。
+func Snapshot() map[string]ModelUsage {
+	mu.Lock()
+	defer mu.Unlock()
+	return copyModels(byModel)
+}
+
+// TenantSnapshot 返回按租户、模型的累计用量副本（不含默认租户）。
+func TenantSnapshot() map[string]map[string]ModelUsage {
+	mu.Lock()
+	defer mu.Unlock()
+	out := make(map[string]map[string]ModelUsage, len(byTenant))
+	for tenant, models := range byTenant {
+		out[tenant] = copyModels(models)
+	}
+	return out
+}
+
+// ResetTenant 清空租户的用量统计（清理租户数据时调用；全局统计保持不变）。
+func ResetTenant(tenant string) {
+	mu.Lock()
+	defer mu.Unlock()
+	delete(byTenant, tenant)
+}
+
+func copyModels(models map[string]*ModelUsage) map[string]ModelUsage {
+	out := make(map[string]ModelUsage, len(models))
+	for model, u := range models {
+		out[model] = *u
+	}
+	return out
+}
+
+// Reset 清空统计（仅用于测试）。
+func Reset() {
+	mu.Lock()
+	defer mu.Unlock()
+	byModel = make(map[string]*ModelUsage)
+	byTenant = make(map[string]map[string]*ModelUsage)
+}
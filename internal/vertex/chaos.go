@@ -0,0 +1,108 @@
+package vertex
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"net/http"
+	"time"
+
+	"anti2api-golang/refactor/internal/config"
+	"anti2api-golang/refactor/internal/logger"
+)
+
+// chaosTruncateMaxBytes 为流式响应被截断前最多转发的字节数（在 [1, chaosTruncateMaxBytes) 中随机选取）。
+const chaosTruncateMaxBytes = 16 << 10
+
+// chaosEnabled 报告是否配置了任一 CHAOS_* 故障注入概率。
+func chaosEnabled(cfg *config.Config) bool {
+	return cfg.ChaosErrorPercent > 0 || cfg.ChaosLatencyPercent > 0 || cfg.ChaosTruncatePercent > 0
+}
+
+func chaosHit(percent int) bool {
+	return percent > 0 && rand.IntN(100) < percent
+}
+
+// do 发送生成请求；配置了 CHAOS_* 时按概率注入故障，供下游应用测试重试逻辑：
+//   - 先等待 0~CHAOS_LATENCY_MS 毫秒（可被 ctx 取消）；
+//   - 不发送请求，直接返回与上游格式一致的 429（带 1s RetryInfo）或 500；
+//   - 流式响应（stream 为 true）转发随机字节数后以 io.ErrUnexpectedEOF 中断。
+func (c *Client) do(req *http.Request, stream bool) (*http.Response, error) {
+	cfg := c.config
+	if cfg == nil || !chaosEnabled(cfg) {
+		return c.httpClient.Do(req)
+	}
+	if cfg.ChaosLatencyMs > 0 && chaosHit(cfg.ChaosLatencyPercent) {
+		delay := time.Duration(rand.IntN(cfg.ChaosLatencyMs)+1) * time.Millisecond
+		logger.Debug("故障注入：延迟 %v", delay)
+		if err := sleepContext(req.Context(), delay); err != nil {
+			return nil, err
+		}
+	}
+	if chaosHit(cfg.ChaosErrorPercent) {
+		status := http.StatusTooManyRequests
+		if rand.IntN(2) == 0 {
+			status = http.StatusInternalServerError
+		}
+		logger.Debug("故障注入：返回 %d", status)
+		return chaosErrorResponse(req, status), nil
+	}
+	resp, err := c.httpClient.Do(req)
+	if err == nil && stream && resp.StatusCode == http.StatusOK && chaosHit(cfg.ChaosTruncatePercent) {
+		limit := rand.Int64N(chaosTruncateMaxBytes-1) + 1
+		logger.Debug("故障注入：流式响应将在 %d 字节后中断", limit)
+		resp.Body = &chaosTruncatedBody{ReadCloser: resp.Body, remaining: limit}
+	}
+	return resp, err
+}
+
+func sleepContext(ctx context.Context, d time.Duration) error {
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-t.C:
+		return nil
+	}
+}
+
+func chaosErrorResponse(req *http.Request, status int) *http.Response {
+	var body string
+	if status == http.StatusTooManyRequests {
+		body = `{"error":{"code":429,"message":"Resource has been exhausted (injected by CHAOS_ERROR_PERCENT).","status":"RESOURCE_EXHAUSTED",` +
+			`"details":[{"@type":"type.googleapis.com/google.rpc.RetryInfo","retryDelay":"1s"}]}}`
+	} else {
+		body = fmt.Sprintf(`{"error":{"code":%d,"message":"Internal error encountered (injected by CHAOS_ERROR_PERCENT).","status":"INTERNAL"}}`, status)
+	}
+	return &http.Response{
+		Status:     fmt.Sprintf("%d %s", status, http.StatusText(status)),
+		StatusCode: status,
+		Proto:      "HTTP/1.1",
+		ProtoMajor: 1,
+		ProtoMinor: 1,
+		Header:     http.Header{"Content-Type": {"application/json; charset=UTF-8"}},
+		Body:       io.NopCloser(bytes.NewReader([]byte(body))),
+		Request:    req,
+	}
+}
+
+// chaosTruncatedBody 在读取 remaining 字节后返回 io.ErrUnexpectedEOF，模拟上游连接中途断开。
+type chaosTruncatedBody struct {
+	io.ReadCloser
+	remaining int64
+}
+
+func (b *chaosTruncatedBody) Read(p []byte) (int, error) {
+	if b.remaining <= 0 {
+		return 0, io.ErrUnexpectedEOF
+	}
+	if int64(len(p)) > b.remaining {
+		p = p[:b.remaining]
+	}
+	n, err := b.ReadCloser.Read(p)
+	b.remaining -= int64(n)
+	return n, err
+}
@@ -0,0 +1,58 @@
+package vertex
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"anti2api-golang/refactor/internal/config"
+)
+
+func TestClientDo_ChaosInjection(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.WriteString(w, strings.Repeat("data: {}\n\n", 4096))
+	}))
+	defer upstream.Close()
+
+	cfg := &config.Config{}
+	c := &Client{httpClient: upstream.Client(), config: cfg}
+	newReq := func() *http.Request {
+		req, _ := http.NewRequest(http.MethodPost, upstream.URL, nil)
+		return req
+	}
+
+	cfg.ChaosErrorPercent = 100
+	resp, err := c.do(newReq(), false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	apiErr := ExtractErrorDetails(resp, body)
+	if apiErr.Status != http.StatusTooManyRequests && apiErr.Status != http.StatusInternalServerError {
+		t.Fatalf("expected injected 429/500, got %d", apiErr.Status)
+	}
+
+	cfg.ChaosErrorPercent, cfg.ChaosTruncatePercent = 0, 100
+	resp, err = c.do(newReq(), true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, err = io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if !errors.Is(err, io.ErrUnexpectedEOF) || len(body) >= chaosTruncateMaxBytes {
+		t.Fatalf("expected truncated stream, got %d bytes, err=%v", len(body), err)
+	}
+
+	// 非流式请求不截断。
+	resp, err = c.do(newReq(), false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if body, err = io.ReadAll(resp.Body); err != nil || len(body) != len("data: {}\n\n")*4096 {
+		t.Fatalf("non-stream response should be complete, got %d bytes, err=%v", len(body), err)
+	}
+	resp.Body.Close()
+}
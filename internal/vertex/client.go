@@ -11,6 +11,7 @@ import (
 	"regexp"
 	"strconv"
 	"strings"
+	"sync/atomic"
 	"time"
 
 	"anti2api-golang/refactor/internal/config"
@@ -28,6 +29,8 @@ type APIError struct {
 	Message      string
 	RetryDelay   time.Duration
 	DisableToken bool
+	// UpstreamHeader 为 UPSTREAM_HEADERS 选中的上游响应头。
+	UpstreamHeader http.Header
 }
 
 func (e *APIError) Error() string {
@@ -56,6 +59,15 @@ func NewClient() *Client {
 			transport.Proxy = http.ProxyURL(proxyURL)
 		}
 	}
+	if resolver := newHostResolver(cfg.HostOverrides, cfg.DNSOverHTTPS); resolver != nil {
+		transport.DialContext = resolver.DialContext
+	}
+	if err := applyTLSProfile(transport, cfg.UpstreamTLSProfile); err != nil {
+		logger.Warn("%v，使用默认 TLS 配置", err)
+	}
+	if chaosEnabled(cfg) {
+		logger.Warn("已开启故障注入：错误 %d%%，延迟 %d%%（≤%dms），流截断 %d%%", cfg.ChaosErrorPercent, cfg.ChaosLatencyPercent, cfg.ChaosLatencyMs, cfg.ChaosTruncatePercent)
+	}
 
 	return &Client{
 		httpClient: &http.Client{
@@ -86,10 +98,11 @@ func (c *Client) BuildStreamHeaders(accessToken string, endpoint config.Endpoint
 }
 
 func (c *Client) SendRequest(ctx context.Context, req *Request, accessToken string) (*Response, error) {
-	endpoint := config.GetEndpointManager().GetActiveEndpoint()
-	reqURL := endpoint.NoStreamURL()
+	endpoint := endpointFor(ctx)
+	format := ActiveWireFormat()
+	reqURL := format.URL(endpoint.Host, MethodGenerateContent)
 
-	body, err := jsonpkg.Marshal(req)
+	body, err := format.EncodeRequest(req)
 	if err != nil {
 		return nil, err
 	}
@@ -110,11 +123,15 @@ func (c *Client) SendRequest(ctx context.Context, req *Request, accessToken stri
 	}
 
 	startTime := time.Now()
-	resp, err := c.httpClient.Do(httpReq)
+	resp, err := c.do(httpReq, false)
 	if err != nil {
+		recordEndpointUse(endpoint.Key, MethodGenerateContent, req.Model, req.RequestID, 0, startTime)
 		return nil, err
 	}
+	recordEndpointUse(endpoint.Key, MethodGenerateContent, req.Model, req.RequestID, resp.StatusCode, startTime)
 	defer resp.Body.Close()
+	upstreamHeader := SelectUpstreamHeaders(resp.Header)
+	logUpstreamHeaders(resp.StatusCode, upstreamHeader)
 
 	var reader io.Reader = resp.Body
 	if resp.Header.Get("Content-Encoding") == "gzip" {
@@ -138,26 +155,35 @@ func (c *Client) SendRequest(ctx context.Context, req *Request, accessToken stri
 		return nil, ExtractErrorDetails(resp, respBody)
 	}
 
+	if respBody, err = format.DecodeResponse(respBody); err != nil {
+		return nil, err
+	}
+
 	var out Response
 	if err := jsonpkg.Unmarshal(respBody, &out); err != nil {
-		if logger.IsBackendLogEnabled() {
-			logger.BackendResponse(resp.StatusCode, time.Since(startTime), string(respBody))
+		fixed, ok := repairFunctionCallJSON(string(respBody))
+		if !ok || jsonpkg.UnmarshalString(fixed, &out) != nil {
+			if logger.IsBackendLogEnabled() {
+				logger.BackendResponse(resp.StatusCode, time.Since(startTime), string(respBody))
+			}
+			return nil, err
 		}
-		return nil, err
 	}
 
 	if logger.IsBackendLogEnabled() {
 		logger.BackendResponse(resp.StatusCode, time.Since(startTime), &out)
 	}
 
+	out.upstreamHeader = upstreamHeader
 	return &out, nil
 }
 
 func (c *Client) SendStreamRequest(ctx context.Context, req *Request, accessToken string) (*http.Response, error) {
-	endpoint := config.GetEndpointManager().GetActiveEndpoint()
-	reqURL := endpoint.StreamURL()
+	endpoint := endpointFor(ctx)
+	format := ActiveWireFormat()
+	reqURL := format.URL(endpoint.Host, MethodStreamGenerateContent)
 
-	body, err := jsonpkg.Marshal(req)
+	body, err := format.EncodeRequest(req)
 	if err != nil {
 		return nil, err
 	}
@@ -166,7 +192,7 @@ func (c *Client) SendStreamRequest(ctx context.Context, req *Request, accessToke
 		logger.BackendRequest(http.MethodPost, reqURL, body)
 	}
 
-	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, reqURL, bytes.NewReader(body))
+	httpReq, err := http.NewRequestWithContext(withEndpointKey(ctx, endpoint.Key), http.MethodPost, reqURL, bytes.NewReader(body))
 	if err != nil {
 		return nil, err
 	}
@@ -177,10 +203,13 @@ func (c *Client) SendStreamRequest(ctx context.Context, req *Request, accessToke
 		}
 	}
 	startTime := time.Now()
-	resp, err := c.httpClient.Do(httpReq)
+	resp, err := c.do(httpReq, true)
 	if err != nil {
+		recordEndpointUse(endpoint.Key, MethodStreamGenerateContent, req.Model, req.RequestID, 0, startTime)
 		return nil, err
 	}
+	recordEndpointUse(endpoint.Key, MethodStreamGenerateContent, req.Model, req.RequestID, resp.StatusCode, startTime)
+	logUpstreamHeaders(resp.StatusCode, SelectUpstreamHeaders(resp.Header))
 
 	if resp.StatusCode != http.StatusOK {
 		defer resp.Body.Close()
@@ -201,11 +230,16 @@ func (c *Client) SendStreamRequest(ctx context.Context, req *Request, accessToke
 		return nil, ExtractErrorDetails(resp, respBody)
 	}
 
+	resp.Body = logger.TeeStreamBody(resp.Body, req.RequestID)
+	if err := decodeStreamBody(format, resp); err != nil {
+		resp.Body.Close()
+		return nil, err
+	}
 	return resp, nil
 }
 
 func ExtractErrorDetails(resp *http.Response, body []byte) *APIError {
-	apiErr := &APIError{Status: resp.StatusCode, Message: "Unknown error"}
+	apiErr := &APIError{Status: resp.StatusCode, Message: "Unknown error", UpstreamHeader: SelectUpstreamHeaders(resp.Header)}
 
 	var errorResp struct {
 		Error struct {
@@ -236,6 +270,10 @@ func ExtractErrorDetails(resp *http.Response, body []byte) *APIError {
 		case float64:
 			apiErr.Status = int(v)
 		}
+		// 数字 code 的错误体以 status 字段标明 UNAUTHENTICATED（凭据被吊销或失效），与临时性的 401 区分。
+		if strings.EqualFold(errorResp.Error.Status, "UNAUTHENTICATED") {
+			apiErr.DisableToken = true
+		}
 
 		for _, detail := range errorResp.Error.Details {
 			if strings.Contains(detail.Type, "RetryInfo") {
@@ -308,44 +346,79 @@ func GetClient() *Client {
 	return apiClient
 }
 
+// SetTransport 替换上游 HTTP 传输层（压测 / 测试用，需在处理请求前调用）。
+func SetTransport(rt http.RoundTripper) {
+	if rt == nil {
+		return
+	}
+	GetClient().httpClient.Transport = rt
+}
+
+// GenerateContent 发送非流式请求（按 RETRY_* 重试），并代为执行模型对代执行函数（见 ProxyFunction）的调用。
 func GenerateContent(ctx context.Context, req *Request, accessToken string) (*Response, error) {
-	client := GetClient()
-	var result *Response
-	var err error
+	send := func(req *Request) (*Response, error) {
+		client := GetClient()
+		var result *Response
+		var err error
 
-	retryErr := client.WithRetry(ctx, func() error {
-		result, err = client.SendRequest(ctx, req, accessToken)
-		return err
-	})
-	if retryErr != nil {
-		return nil, retryErr
+		retryErr := client.WithRetry(ctx, func() error {
+			result, err = client.SendRequest(ctx, req, accessToken)
+			return err
+		})
+		if retryErr != nil {
+			return nil, retryErr
+		}
+		return result, nil
 	}
-	return result, nil
+	result, err := send(req)
+	if err != nil || !req.hasProxyFunctions() {
+		return result, err
+	}
+	return withProxyCalls(ctx, req, result, accessToken, send)
 }
 
+// GenerateContentStream 发送流式请求（按 RETRY_* 重试），并代为执行模型对代执行函数（见 ProxyFunction）的调用。
 func GenerateContentStream(ctx context.Context, req *Request, accessToken string) (*http.Response, error) {
-	client := GetClient()
-	var result *http.Response
-	var err error
+	send := func(req *Request) (*http.Response, error) {
+		client := GetClient()
+		var result *http.Response
+		var err error
 
-	retryErr := client.WithRetry(ctx, func() error {
-		result, err = client.SendStreamRequest(ctx, req, accessToken)
-		return err
-	})
-	if retryErr != nil {
-		return nil, retryErr
+		retryErr := client.WithRetry(ctx, func() error {
+			result, err = client.SendStreamRequest(ctx, req, accessToken)
+			return err
+		})
+		if retryErr != nil {
+			return nil, retryErr
+		}
+		return result, nil
 	}
-	return result, nil
+	result, err := send(req)
+	if err != nil || !req.hasProxyFunctions() {
+		return result, err
+	}
+	return withProxyCallsStream(ctx, req, result, accessToken, send), nil
 }
 
 type AvailableModelsResponse struct {
 	Models map[string]any `json:"models"`
 }
 
+// modelsFetchedAt 为最近一次成功获取上游模型列表的时间（UnixNano，0 表示尚未成功获取）。
+var modelsFetchedAt atomic.Int64
+
+// ModelsFetchedAt 返回最近一次成功获取上游模型列表的时间，尚未成功获取时返回零值。
+func ModelsFetchedAt() time.Time {
+	if n := modelsFetchedAt.Load(); n != 0 {
+		return time.Unix(0, n)
+	}
+	return time.Time{}
+}
+
 func FetchAvailableModels(ctx context.Context, project, accessToken string) (*AvailableModelsResponse, error) {
 	client := GetClient()
-	endpoint := config.GetEndpointManager().GetActiveEndpoint()
-	urlStr := endpoint.FetchAvailableModelsURL()
+	endpoint := endpointFor(ctx)
+	urlStr := ActiveWireFormat().URL(endpoint.Host, MethodFetchAvailableModels)
 
 	body, err := jsonpkg.Marshal(map[string]string{"project": project})
 	if err != nil {
@@ -369,8 +442,10 @@ func FetchAvailableModels(ctx context.Context, project, accessToken string) (*Av
 	startTime := time.Now()
 	resp, err := client.httpClient.Do(httpReq)
 	if err != nil {
+		recordEndpointUse(endpoint.Key, MethodFetchAvailableModels, "", "", 0, startTime)
 		return nil, err
 	}
+	recordEndpointUse(endpoint.Key, MethodFetchAvailableModels, "", "", resp.StatusCode, startTime)
 	defer resp.Body.Close()
 
 	var reader io.Reader = resp.Body
@@ -405,5 +480,6 @@ func FetchAvailableModels(ctx context.Context, project, accessToken string) (*Av
 	if logger.IsBackendLogEnabled() {
 		logger.BackendResponse(resp.StatusCode, time.Since(startTime), &out)
 	}
+	modelsFetchedAt.Store(time.Now().UnixNano())
 	return &out, nil
 }
@@ -0,0 +1,150 @@
+package vertex
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"time"
+
+	"anti2api-golang/refactor/internal/config"
+)
+
+// recentEndpointUsesCap 为保留的最近上游请求条数。
+const recentEndpointUsesCap = 200
+
+// EndpointUse 记录一次上游请求实际使用的端点，供管理面板判断 daily / autopush / production 哪个更稳定。
+type EndpointUse struct {
+	Time      time.Time `json:"time"`
+	RequestID string    `json:"requestId,omitempty"`
+	Model     string    `json:"model,omitempty"`
+	Endpoint  string    `json:"endpoint"`
+	Method    string    `json:"method"`
+	// Status 为上游 HTTP 状态码，0 表示请求未得到响应（网络错误、超时、客户端取消）。
+	Status    int   `json:"status"`
+	LatencyMs int64 `json:"latencyMs"`
+}
+
+// EndpointCounters 是单个端点的累计计数；流式请求以响应头的状态码计成功与否。
+type EndpointCounters struct {
+	Requests     int64     `json:"requests"`
+	Succeeded    int64     `json:"succeeded"`
+	Failed       int64     `json:"failed"`
+	AvgLatencyMs int64     `json:"avgLatencyMs"`
+	LastStatus   int       `json:"lastStatus"`
+	LastUsedAt   time.Time `json:"lastUsedAt"`
+
+	totalLatencyMs int64
+}
+
+var endpointStats = struct {
+	sync.Mutex
+	byKey  map[string]*EndpointCounters
+	recent []EndpointUse // 环形缓冲，next 为下一个写入位置
+	next   int
+}{byKey: make(map[string]*EndpointCounters)}
+
+func recordEndpointUse(endpoint, method, model, requestID string, status int, start time.Time) {
+	now := time.Now()
+	use := EndpointUse{
+		Time:      now,
+		RequestID: requestID,
+		Model:     model,
+		Endpoint:  endpoint,
+		Method:    method,
+		Status:    status,
+		LatencyMs: now.Sub(start).Milliseconds(),
+	}
+
+	endpointStats.Lock()
+	defer endpointStats.Unlock()
+
+	c := endpointStats.byKey[endpoint]
+	if c == nil {
+		c = &EndpointCounters{}
+		endpointStats.byKey[endpoint] = c
+	}
+	c.Requests++
+	if status == 200 {
+		c.Succeeded++
+	} else {
+		c.Failed++
+	}
+	c.totalLatencyMs += use.LatencyMs
+	c.AvgLatencyMs = c.totalLatencyMs / c.Requests
+	c.LastStatus = status
+	c.LastUsedAt = now
+
+	if len(endpointStats.recent) < recentEndpointUsesCap {
+		endpointStats.recent = append(endpointStats.recent, use)
+	} else {
+		endpointStats.recent[endpointStats.next] = use
+	}
+	endpointStats.next = (endpointStats.next + 1) % recentEndpointUsesCap
+}
+
+// EndpointStats 返回进程启动以来按端点 key 汇总的计数。
+func EndpointStats() map[string]EndpointCounters {
+	endpointStats.Lock()
+	defer endpointStats.Unlock()
+
+	out := make(map[string]EndpointCounters, len(endpointStats.byKey))
+	for k, c := range endpointStats.byKey {
+		out[k] = *c
+	}
+	return out
+}
+
+// RecentEndpointUses 返回最近的上游请求记录（新的在前），limit <= 0 时返回全部保留的记录。
+func RecentEndpointUses(limit int) []EndpointUse {
+	endpointStats.Lock()
+	defer endpointStats.Unlock()
+
+	n := len(endpointStats.recent)
+	if limit <= 0 || limit > n {
+		limit = n
+	}
+	out := make([]EndpointUse, 0, limit)
+	for i := 1; i <= limit; i++ {
+		out = append(out, endpointStats.recent[(endpointStats.next-i+n)%n])
+	}
+	return out
+}
+
+type endpointKeyCtx struct{}
+
+type endpointOverrideCtx struct{}
+
+// WithEndpoint 返回固定使用端点 key（见 config.APIEndpoints）的 context，供管理面板的端点探测等场景
+// 指定端点；不影响 ENDPOINT_MODE 的轮询位置。key 未知时忽略。
+func WithEndpoint(ctx context.Context, key string) context.Context {
+	return context.WithValue(ctx, endpointOverrideCtx{}, key)
+}
+
+// endpointFor 返回本次请求使用的端点：context 中指定了端点（见 WithEndpoint）时使用它，否则按 ENDPOINT_MODE 选择。
+func endpointFor(ctx context.Context) config.Endpoint {
+	if key, ok := ctx.Value(endpointOverrideCtx{}).(string); ok {
+		if ep, ok := config.APIEndpoints[key]; ok {
+			return ep
+		}
+	}
+	return config.GetEndpointManager().GetActiveEndpoint()
+}
+
+// withEndpointKey 在上游请求的 context 中记录所用端点的 key（daily / autopush 共用同一 Host，无法按 URL 区分）。
+func withEndpointKey(ctx context.Context, key string) context.Context {
+	return context.WithValue(ctx, endpointKeyCtx{}, key)
+}
+
+// EndpointKeyOf 返回上游流式响应 resp 实际使用的端点 key；不是经由 Cloud Code 端点发出的请求（例如备用后端）时返回其 Host。
+func EndpointKeyOf(resp *http.Response) string {
+	if resp == nil || resp.Request == nil {
+		return ""
+	}
+	if key, ok := resp.Request.Context().Value(endpointKeyCtx{}).(string); ok {
+		return key
+	}
+	if resp.Request.URL != nil {
+		return resp.Request.URL.Host
+	}
+	return ""
+}
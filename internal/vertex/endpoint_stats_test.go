@@ -0,0 +1,69 @@
+package vertex
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestRecordEndpointUse_CountersAndRecentOrder(t *testing.T) {
+	endpointStats.Lock()
+	endpointStats.byKey = make(map[string]*EndpointCounters)
+	endpointStats.recent, endpointStats.next = nil, 0
+	endpointStats.Unlock()
+
+	start := time.Now()
+	recordEndpointUse("daily", MethodGenerateContent, "m", "r1", 200, start)
+	recordEndpointUse("daily", MethodStreamGenerateContent, "m", "r2", 429, start)
+	recordEndpointUse("production", MethodGenerateContent, "m", "r3", 0, start)
+
+	stats := EndpointStats()
+	if d := stats["daily"]; d.Requests != 2 || d.Succeeded != 1 || d.Failed != 1 || d.LastStatus != 429 {
+		t.Fatalf("daily counters = %+v", d)
+	}
+	if p := stats["production"]; p.Requests != 1 || p.Failed != 1 || p.LastStatus != 0 {
+		t.Fatalf("production counters = %+v", p)
+	}
+	if recent := RecentEndpointUses(2); len(recent) != 2 || recent[0].RequestID != "r3" || recent[1].RequestID != "r2" {
+		t.Fatalf("recent = %+v", recent)
+	}
+
+	for i := 0; i < recentEndpointUsesCap+5; i++ {
+		recordEndpointUse("autopush", MethodGenerateContent, "m", fmt.Sprint("w", i), 200, start)
+	}
+	recent := RecentEndpointUses(0)
+	if len(recent) != recentEndpointUsesCap {
+		t.Fatalf("recent len = %d, want %d", len(recent), recentEndpointUsesCap)
+	}
+	if want := fmt.Sprint("w", recentEndpointUsesCap+4); recent[0].RequestID != want {
+		t.Fatalf("newest = %s, want %s", recent[0].RequestID, want)
+	}
+	if want := "w5"; recent[len(recent)-1].RequestID != want {
+		t.Fatalf("oldest = %s, want %s", recent[len(recent)-1].RequestID, want)
+	}
+}
+
+func TestEndpointKeyOf(t *testing.T) {
+	req, _ := http.NewRequestWithContext(withEndpointKey(context.Background(), "autopush"), http.MethodPost, "https://example.com/v1internal:streamGenerateContent", nil)
+	if got := EndpointKeyOf(&http.Response{Request: req}); got != "autopush" {
+		t.Fatalf("EndpointKeyOf = %q, want autopush", got)
+	}
+	other, _ := http.NewRequest(http.MethodPost, "https://backup.example.com/v1/x", nil)
+	if got := EndpointKeyOf(&http.Response{Request: other}); got != "backup.example.com" {
+		t.Fatalf("EndpointKeyOf = %q, want host", got)
+	}
+	if EndpointKeyOf(nil) != "" {
+		t.Fatal("nil response should have no endpoint")
+	}
+}
+
+func TestEndpointFor_Override(t *testing.T) {
+	if got := endpointFor(WithEndpoint(context.Background(), "production")); got.Key != "production" {
+		t.Fatalf("endpointFor = %q, want production", got.Key)
+	}
+	if got := endpointFor(WithEndpoint(context.Background(), "unknown")); got.Key == "unknown" || got.Key == "" {
+		t.Fatalf("unknown endpoint should fall back to ENDPOINT_MODE, got %q", got.Key)
+	}
+}
@@ -0,0 +1,50 @@
+package vertex
+
+import (
+	"fmt"
+
+	"anti2api-golang/refactor/internal/config"
+)
+
+// defaultMergedLogBytes 为未设置 MAX_STREAM_OUTPUT_BYTES 时合并响应最多累积的分片字节数。
+const defaultMergedLogBytes = 64 << 20
+
+// MergedLogLimit 返回合并响应（日志、会话记录、hooks）最多累积的分片字节数。
+func MergedLogLimit() int {
+	if n := config.Get().MaxStreamOutputBytes; n > 0 {
+		return n
+	}
+	return defaultMergedLogBytes
+}
+
+// PartsCollector 累积流式分片中的 parts 用于构建合并响应。累积的分片字节数超过 MergedLogLimit 后不再追加，
+// 避免异常的超长输出耗尽内存；被丢弃的部分在合并结果末尾以一段说明文本标出。
+type PartsCollector struct {
+	parts     []any
+	bytes     int
+	limit     int
+	truncated int
+}
+
+func NewPartsCollector() *PartsCollector {
+	return &PartsCollector{limit: MergedLogLimit()}
+}
+
+// Add 追加一个分片的 parts，size 为该分片的字节数。
+func (c *PartsCollector) Add(parts []any, size int) {
+	if c.truncated > 0 || c.bytes+size > c.limit {
+		c.truncated += size
+		return
+	}
+	c.bytes += size
+	c.parts = append(c.parts, parts...)
+}
+
+// Merged 返回合并后的 parts（见 MergeParts）。
+func (c *PartsCollector) Merged() []any {
+	merged := mergeParts(c.parts)
+	if c.truncated > 0 {
+		merged = append(merged, map[string]any{"text": fmt.Sprintf("[合并响应超过 %d 字节，其余 %d 字节未记录]", c.limit, c.truncated)})
+	}
+	return merged
+}
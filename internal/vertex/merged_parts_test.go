@@ -0,0 +1,33 @@
+package vertex
+
+import (
+	"strings"
+	"testing"
+
+	"anti2api-golang/refactor/internal/config"
+)
+
+func TestPartsCollector_BoundsMergedParts(t *testing.T) {
+	c := config.Get()
+	old := c.MaxStreamOutputBytes
+	c.MaxStreamOutputBytes = 100
+	t.Cleanup(func() { c.MaxStreamOutputBytes = old })
+
+	pc := NewPartsCollector()
+	pc.Add([]any{map[string]any{"text": "a"}}, 60)
+	pc.Add([]any{map[string]any{"text": "b"}}, 30)
+	pc.Add([]any{map[string]any{"text": "c"}}, 30)
+	pc.Add([]any{map[string]any{"text": "d"}}, 5)
+
+	merged := pc.Merged()
+	if len(merged) != 2 {
+		t.Fatalf("expected merged text plus truncation note, got %#v", merged)
+	}
+	if got := merged[0].(map[string]any)["text"]; got != "ab" {
+		t.Fatalf("merged text = %q, want %q", got, "ab")
+	}
+	note, _ := merged[1].(map[string]any)["text"].(string)
+	if !strings.Contains(note, "35") {
+		t.Fatalf("truncation note should report dropped bytes: %q", note)
+	}
+}
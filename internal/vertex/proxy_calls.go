@@ -0,0 +1,410 @@
+package vertex
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"io"
+	"net/http"
+	"slices"
+	"sync"
+
+	"anti2api-golang/refactor/internal/logger"
+	jsonpkg "anti2api-golang/refactor/internal/pkg/json"
+)
+
+// maxProxyCallRounds 限制一次请求中代为执行函数调用的轮数，超过后不再继续请求。
+const maxProxyCallRounds = 8
+
+// ProxyFunction 为由代理代为执行的函数：模型调用它时不交给客户端执行，而是由 GenerateContent / GenerateContentStream
+// 执行后把调用与结果追加到对话中继续请求。
+type ProxyFunction struct {
+	// Call 执行一次调用并返回 functionResponse.response；req 为发起调用的请求，accessToken 为本次请求使用的账号令牌。
+	Call func(ctx context.Context, req *Request, accessToken string, args map[string]any) map[string]any
+	// Visible 为 true 时调用照常返回给客户端，执行结果以 functionResponse 分片紧随其后（网关据此输出服务端工具块），
+	// 即使本轮不再继续请求也会执行；否则调用与结果对客户端不可见（如 fetch_tool_result）。
+	Visible bool
+}
+
+// proxyFunction 返回名为 name 的代执行函数；ToolResultRefs 非空时包含 fetch_tool_result。
+func (r *Request) proxyFunction(name string) (ProxyFunction, bool) {
+	if name == ToolResultFetchName && len(r.ToolResultRefs) > 0 {
+		return ProxyFunction{Call: func(_ context.Context, req *Request, _ string, args map[string]any) map[string]any {
+			return req.fetchToolResult(args)
+		}}, true
+	}
+	fn, ok := r.ProxyFunctions[name]
+	return fn, ok && fn.Call != nil
+}
+
+func (r *Request) hasProxyFunctions() bool {
+	return len(r.ToolResultRefs) > 0 || len(r.ProxyFunctions) > 0
+}
+
+// isHiddenProxyCall 判断分片是否为对客户端不可见的代执行函数调用。
+func (r *Request) isHiddenProxyCall(p Part) bool {
+	if p.FunctionCall == nil {
+		return false
+	}
+	fn, ok := r.proxyFunction(p.FunctionCall.Name)
+	return ok && !fn.Visible
+}
+
+// splitProxyCalls 返回 parts 中需要代为执行的调用，并报告其中是否有客户端工具调用。
+func (r *Request) splitProxyCalls(parts []Part) (calls []FunctionCall, clientCall bool) {
+	for _, p := range parts {
+		if p.FunctionCall == nil {
+			continue
+		}
+		if _, ok := r.proxyFunction(p.FunctionCall.Name); ok {
+			calls = append(calls, *p.FunctionCall)
+		} else {
+			clientCall = true
+		}
+	}
+	return calls, clientCall
+}
+
+// runProxyCalls 执行 calls 并返回与之一一对应的 functionResponse 分片；all 为 false 时只执行可见的函数，
+// 其余位置为空分片。
+func (r *Request) runProxyCalls(ctx context.Context, accessToken string, calls []FunctionCall, all bool) []Part {
+	parts := make([]Part, len(calls))
+	for i, call := range calls {
+		fn, _ := r.proxyFunction(call.Name)
+		if !all && !fn.Visible {
+			continue
+		}
+		parts[i] = Part{FunctionResponse: &FunctionResponse{ID: call.ID, Name: call.Name, Response: fn.Call(ctx, r, accessToken, call.Args)}}
+	}
+	return parts
+}
+
+// shownParts 返回一轮模型输出中客户端可见的分片：去掉不可见的代执行调用，可见调用之后紧跟其执行结果
+// （responses 与 parts 中的代执行调用按顺序对应）。
+func (r *Request) shownParts(parts, responses []Part) []Part {
+	var out []Part
+	k := 0
+	for _, p := range parts {
+		if p.FunctionCall != nil {
+			if fn, ok := r.proxyFunction(p.FunctionCall.Name); ok {
+				resp := responses[k]
+				k++
+				if fn.Visible {
+					out = append(out, p)
+					if resp.FunctionResponse != nil {
+						out = append(out, resp)
+					}
+				}
+				continue
+			}
+		}
+		out = append(out, p)
+	}
+	return out
+}
+
+// visibleResponses 返回 responses 中可见函数的执行结果。
+func (r *Request) visibleResponses(responses []Part) []Part {
+	var out []Part
+	for _, p := range responses {
+		if p.FunctionResponse == nil {
+			continue
+		}
+		if fn, _ := r.proxyFunction(p.FunctionResponse.Name); fn.Visible {
+			out = append(out, p)
+		}
+	}
+	return out
+}
+
+// withProxyCalls 代为执行非流式响应中的代执行函数调用：模型只调用了这些函数时，把调用与结果追加到对话中重新请求
+// （最多 maxProxyCallRounds 轮）；与客户端工具调用混在一起或超过轮数时只执行可见的函数后返回。
+// 返回的候选包含此前各轮客户端可见的分片，usageMetadata 为各轮用量之和；追加的对话只作用于 req 的副本。
+func withProxyCalls(ctx context.Context, req *Request, resp *Response, accessToken string, send func(*Request) (*Response, error)) (*Response, error) {
+	next := *req
+	next.Request.Contents = slices.Clip(req.Request.Contents)
+	var shown []Part
+	var held UsageMetadata
+	for round := 1; ; round++ {
+		if len(resp.Response.Candidates) == 0 {
+			return withHeldUsage(resp, held), nil
+		}
+		cand := &resp.Response.Candidates[0]
+		calls, clientCall := next.splitProxyCalls(cand.Content.Parts)
+		if len(calls) == 0 {
+			if len(shown) > 0 {
+				cand.Content.Parts = append(shown, cand.Content.Parts...)
+			}
+			return withHeldUsage(resp, held), nil
+		}
+		final := clientCall || round >= maxProxyCallRounds
+		responses := next.runProxyCalls(ctx, accessToken, calls, !final)
+		shown = append(shown, next.shownParts(cand.Content.Parts, responses)...)
+		if final {
+			cand.Content.Parts = shown
+			return withHeldUsage(resp, held), nil
+		}
+		held.add(resp.Response.UsageMetadata)
+		logger.Debug("代为执行 %d 个函数调用（第 %d 轮）", len(calls), round)
+		next.Request.Contents = append(next.Request.Contents,
+			Content{Role: "model", Parts: cand.Content.Parts},
+			Content{Role: "user", Parts: responses})
+		var err error
+		if resp, err = send(&next); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// withProxyCallsStream 为流式响应做与 withProxyCalls 相同的处理：转发时去掉不可见的代执行调用，可见函数的结果
+// 在本轮结束后作为单独的分片输出；需要继续请求时去掉结束分片中的 finishReason / usageMetadata，并把下一轮请求的流
+// 接在后面，客户端看到的是一条连续的流。去掉的用量累加到之后各轮分片的 usageMetadata 中。
+func withProxyCallsStream(ctx context.Context, req *Request, resp *http.Response, accessToken string, send func(*Request) (*http.Response, error)) *http.Response {
+	pr, pw := io.Pipe()
+	body := &proxyCallBody{PipeReader: pr, body: resp.Body}
+	upstream, gzipped := resp.Body, resp.Header.Get("Content-Encoding") == "gzip"
+	go func() {
+		next := *req
+		next.Request.Contents = slices.Clip(req.Request.Contents)
+		var held UsageMetadata
+		for round := 1; ; round++ {
+			canContinue := round < maxProxyCallRounds
+			calls, history, clientCall, err := forwardProxyRound(&next, upstream, gzipped, pw, canContinue, &held)
+			upstream.Close()
+			if err != nil || len(calls) == 0 {
+				pw.CloseWithError(err)
+				return
+			}
+			final := clientCall || !canContinue
+			responses := next.runProxyCalls(ctx, accessToken, calls, !final)
+			if visible := next.visibleResponses(responses); len(visible) > 0 {
+				if err := writeProxyResponses(pw, visible); err != nil {
+					pw.CloseWithError(err)
+					return
+				}
+			}
+			if final {
+				pw.Close()
+				return
+			}
+			logger.Debug("代为执行 %d 个函数调用（第 %d 轮）", len(calls), round)
+			next.Request.Contents = append(next.Request.Contents,
+				Content{Role: "model", Parts: history},
+				Content{Role: "user", Parts: responses})
+			cur, err := send(&next)
+			if err != nil {
+				pw.CloseWithError(err)
+				return
+			}
+			upstream, gzipped = cur.Body, cur.Header.Get("Content-Encoding") == "gzip"
+			if !body.swap(upstream) {
+				upstream.Close()
+				return
+			}
+		}
+	}()
+	resp.Header.Del("Content-Encoding")
+	resp.Body = body
+	return resp
+}
+
+// proxyCallBody 为拼接后的流；Close 同时关闭当前轮次的上游响应体。
+type proxyCallBody struct {
+	*io.PipeReader
+	mu     sync.Mutex
+	body   io.ReadCloser
+	closed bool
+}
+
+func (b *proxyCallBody) Close() error {
+	_ = b.PipeReader.Close()
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.closed = true
+	return b.body.Close()
+}
+
+// swap 切换到下一轮的上游响应体；流已被关闭时返回 false。
+func (b *proxyCallBody) swap(body io.ReadCloser) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.closed {
+		return false
+	}
+	b.body = body
+	return true
+}
+
+// proxyCallChunk 为流式分片中与代执行调用有关的部分。
+type proxyCallChunk struct {
+	Response struct {
+		Candidates []struct {
+			Content struct {
+				Parts []Part `json:"parts"`
+			} `json:"content"`
+			FinishReason string `json:"finishReason,omitempty"`
+		} `json:"candidates"`
+		UsageMetadata *UsageMetadata `json:"usageMetadata,omitempty"`
+	} `json:"response"`
+}
+
+// forwardProxyRound 把一轮上游流 body 转发到 w（去掉不可见的代执行调用），返回本轮的代执行调用、模型输出
+// （作为下一轮的 model 内容）以及是否有客户端工具调用；canContinue 为 true 且没有客户端工具调用时去掉结束分片中的
+// finishReason / usageMetadata（对话还将继续），去掉的用量累加到 held，并加到之后分片的 usageMetadata 中。
+func forwardProxyRound(req *Request, body io.Reader, gzipped bool, w io.Writer, canContinue bool, held *UsageMetadata) (calls []FunctionCall, history []Part, clientCall bool, err error) {
+	src := body
+	if gzipped {
+		gzReader, err := gzip.NewReader(body)
+		if err != nil {
+			return nil, nil, false, err
+		}
+		defer gzReader.Close()
+		src = gzReader
+	}
+	reader := bufio.NewReaderSize(src, 64*1024)
+	for {
+		line, rerr := reader.ReadBytes('\n')
+		if len(line) > 0 {
+			if data, ok := bytes.CutPrefix(line, []byte("data: ")); ok {
+				var chunk proxyCallChunk
+				if jsonpkg.Unmarshal(bytes.TrimRight(data, "\r\n"), &chunk) == nil && len(chunk.Response.Candidates) > 0 {
+					cand := chunk.Response.Candidates[0]
+					found, client := req.splitProxyCalls(cand.Content.Parts)
+					calls = append(calls, found...)
+					clientCall = clientCall || client
+					hidden := false
+					for _, p := range cand.Content.Parts {
+						history = appendHistoryPart(history, p)
+						hidden = hidden || req.isHiddenProxyCall(p)
+					}
+					hold := cand.FinishReason != "" && canContinue && len(calls) > 0 && !clientCall
+					usage := chunk.Response.UsageMetadata
+					if hold {
+						held.add(usage)
+					}
+					if hidden || hold || (usage != nil && *held != (UsageMetadata{})) {
+						line = req.rewriteProxyChunk(data, hold, held)
+					}
+				}
+			}
+			if len(line) > 0 {
+				if _, werr := w.Write(line); werr != nil {
+					return nil, nil, false, werr
+				}
+			}
+		}
+		if rerr != nil {
+			if rerr != io.EOF {
+				return nil, nil, false, rerr
+			}
+			break
+		}
+	}
+	return calls, history, clientCall, nil
+}
+
+// rewriteProxyChunk 去掉分片中不可见的代执行调用；hold 为 true 时同时去掉 finishReason 与 usageMetadata，
+// 否则把此前各轮的用量 held 加到分片的 usageMetadata 上。去掉后没有剩余内容时返回 nil（不转发该分片）。
+func (r *Request) rewriteProxyChunk(data []byte, hold bool, held *UsageMetadata) []byte {
+	var raw map[string]any
+	if jsonpkg.Unmarshal(bytes.TrimRight(data, "\r\n"), &raw) != nil {
+		return append([]byte("data: "), data...)
+	}
+	resp, _ := raw["response"].(map[string]any)
+	cands, _ := resp["candidates"].([]any)
+	if len(cands) == 0 {
+		return append([]byte("data: "), data...)
+	}
+	cand, _ := cands[0].(map[string]any)
+	content, _ := cand["content"].(map[string]any)
+	parts, _ := content["parts"].([]any)
+	kept := parts[:0]
+	for _, p := range parts {
+		if pm, ok := p.(map[string]any); ok {
+			if fc, ok := pm["functionCall"].(map[string]any); ok {
+				name, _ := fc["name"].(string)
+				if fn, ok := r.proxyFunction(name); ok && !fn.Visible {
+					continue
+				}
+			}
+		}
+		kept = append(kept, p)
+	}
+	if content != nil {
+		content["parts"] = kept
+	}
+	if hold {
+		delete(cand, "finishReason")
+		delete(resp, "usageMetadata")
+	} else if um, ok := resp["usageMetadata"].(map[string]any); ok && held != nil {
+		for k, v := range map[string]int{
+			"promptTokenCount":     held.PromptTokenCount,
+			"candidatesTokenCount": held.CandidatesTokenCount,
+			"totalTokenCount":      held.TotalTokenCount,
+			"thoughtsTokenCount":   held.ThoughtsTokenCount,
+		} {
+			if v != 0 {
+				n, _ := um[k].(float64)
+				um[k] = int(n) + v
+			}
+		}
+	}
+	if len(kept) == 0 && cand["finishReason"] == nil && (hold || len(parts) > 0) {
+		return nil
+	}
+	out, err := jsonpkg.Marshal(raw)
+	if err != nil {
+		return nil
+	}
+	return append(append([]byte("data: "), out...), '\n')
+}
+
+// add 将 o 的各项用量累加到 u；o 为 nil 时不变。
+func (u *UsageMetadata) add(o *UsageMetadata) {
+	if o == nil {
+		return
+	}
+	u.PromptTokenCount += o.PromptTokenCount
+	u.CandidatesTokenCount += o.CandidatesTokenCount
+	u.TotalTokenCount += o.TotalTokenCount
+	u.ThoughtsTokenCount += o.ThoughtsTokenCount
+}
+
+// withHeldUsage 把此前各轮的用量 held 加到最后一轮响应的 usageMetadata 上。
+func withHeldUsage(resp *Response, held UsageMetadata) *Response {
+	if held == (UsageMetadata{}) {
+		return resp
+	}
+	if u := resp.Response.UsageMetadata; u != nil {
+		u.add(&held)
+	} else {
+		resp.Response.UsageMetadata = &held
+	}
+	return resp
+}
+
+// writeProxyResponses 以单独的 SSE 分片输出可见函数的执行结果。
+func writeProxyResponses(w io.Writer, parts []Part) error {
+	var chunk Response
+	chunk.Response.Candidates = []Candidate{{Content: Content{Role: "model", Parts: parts}}}
+	b, err := jsonpkg.Marshal(chunk)
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(append(append([]byte("data: "), b...), '\n', '\n'))
+	return err
+}
+
+// appendHistoryPart 将流式分片累积为完整的 model 内容：相邻的同类文本（正文 / 思考）合并为一个分片。
+func appendHistoryPart(parts []Part, p Part) []Part {
+	if p.FunctionCall == nil && p.InlineData == nil && p.FunctionResponse == nil && len(parts) > 0 {
+		last := &parts[len(parts)-1]
+		if last.FunctionCall == nil && last.InlineData == nil && last.FunctionResponse == nil && last.Thought == p.Thought && last.ThoughtSignature == "" {
+			last.Text += p.Text
+			last.ThoughtSignature = p.ThoughtSignature
+			return parts
+		}
+	}
+	return append(parts, p)
+}
@@ -0,0 +1,82 @@
+package vertex
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func searchRequest(calls *int) *Request {
+	return &Request{ProxyFunctions: map[string]ProxyFunction{"web_search": {Visible: true, Call: func(_ context.Context, _ *Request, token string, args map[string]any) map[string]any {
+		*calls++
+		return map[string]any{"query": args["query"], "token": token}
+	}}}}
+}
+
+func TestWithProxyCalls_Visible(t *testing.T) {
+	var calls int
+	req := searchRequest(&calls)
+	first := &Response{}
+	first.Response.Candidates = []Candidate{{Content: Content{Role: "model", Parts: []Part{
+		{Text: "searching "},
+		{FunctionCall: &FunctionCall{Name: "web_search", Args: map[string]any{"query": "q"}}},
+	}}}}
+	first.Response.UsageMetadata = &UsageMetadata{PromptTokenCount: 2, TotalTokenCount: 4}
+	final := &Response{}
+	final.Response.Candidates = []Candidate{{Content: Content{Role: "model", Parts: []Part{{Text: "answer"}}}, FinishReason: "STOP"}}
+	final.Response.UsageMetadata = &UsageMetadata{PromptTokenCount: 5, TotalTokenCount: 8}
+
+	var sent *Request
+	resp, err := withProxyCalls(context.Background(), req, first, "tok", func(r *Request) (*Response, error) {
+		sent = r
+		return final, nil
+	})
+	if err != nil || calls != 1 {
+		t.Fatalf("expected one executed call, got %d %v", calls, err)
+	}
+	if fr := sent.Request.Contents[1].Parts[0].FunctionResponse; fr == nil || fr.Response["token"] != "tok" {
+		t.Fatalf("unexpected follow-up contents: %+v", sent.Request.Contents)
+	}
+	parts := resp.Response.Candidates[0].Content.Parts
+	if len(parts) != 4 || parts[0].Text != "searching " || parts[1].FunctionCall == nil || parts[2].FunctionResponse == nil || parts[3].Text != "answer" {
+		t.Fatalf("expected earlier rounds to be kept with the result, got %+v", parts)
+	}
+	if u := resp.Response.UsageMetadata; u == nil || u.PromptTokenCount != 7 || u.TotalTokenCount != 12 {
+		t.Fatalf("expected usage summed across rounds, got %+v", u)
+	}
+
+	// 与客户端工具调用混在一起时仍执行可见的调用，但不再继续请求。
+	mixed := &Response{}
+	mixed.Response.Candidates = []Candidate{{Content: Content{Role: "model", Parts: []Part{
+		{FunctionCall: &FunctionCall{Name: "web_search", Args: map[string]any{"query": "q"}}},
+		{FunctionCall: &FunctionCall{Name: "read_file"}},
+	}}}}
+	resp, _ = withProxyCalls(context.Background(), req, mixed, "tok", func(*Request) (*Response, error) {
+		t.Fatal("should not resend when client calls are present")
+		return nil, nil
+	})
+	if parts := resp.Response.Candidates[0].Content.Parts; len(parts) != 3 || parts[1].FunctionResponse == nil || parts[2].FunctionCall.Name != "read_file" || calls != 2 {
+		t.Fatalf("unexpected parts: %+v", parts)
+	}
+}
+
+func TestWithProxyCallsStream_Visible(t *testing.T) {
+	var calls int
+	req := searchRequest(&calls)
+	first := sseResponse(`data: {"response":{"candidates":[{"content":{"role":"model","parts":[{"functionCall":{"name":"web_search","args":{"query":"q"}}}]},"finishReason":"STOP"}]}}`)
+	resp := withProxyCallsStream(context.Background(), req, first, "tok", func(r *Request) (*http.Response, error) {
+		return sseResponse(`data: {"response":{"candidates":[{"content":{"role":"model","parts":[{"text":"done"}]},"finishReason":"STOP"}]}}`), nil
+	})
+	out, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := string(out)
+	call, result, done := strings.Index(s, `"functionCall"`), strings.Index(s, `"functionResponse"`), strings.Index(s, `"done"`)
+	if call < 0 || result < call || done < result || strings.Count(s, "finishReason") != 1 || calls != 1 {
+		t.Fatalf("unexpected stream:\n%s", s)
+	}
+}
@@ -0,0 +1,23 @@
+package vertex
+
+import (
+	"strings"
+
+	"anti2api-golang/refactor/internal/logger"
+	"anti2api-golang/refactor/internal/pkg/jsonrepair"
+)
+
+// repairFunctionCallJSON 修复包含 functionCall 的非法响应 JSON（见 jsonrepair.Repair）。
+// 不含 functionCall 的内容不做修复，保持原有的解析失败处理。
+func repairFunctionCallJSON(s string) (string, bool) {
+	if !strings.Contains(s, `"functionCall"`) {
+		return s, false
+	}
+	fixed, ok := jsonrepair.Repair(s)
+	if ok {
+		logger.Warn("上游返回的工具调用 JSON 不合法，已自动修复")
+	} else {
+		logger.Warn("上游返回的工具调用 JSON 不合法且无法修复，已丢弃")
+	}
+	return fixed, ok
+}
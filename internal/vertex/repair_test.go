@@ -0,0 +1,29 @@
+package vertex
+
+import (
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestParseStreamRepairsFunctionCallArgs(t *testing.T) {
+	body := `data: {"response":{"candidates":[{"content":{"parts":[{"functionCall":{"name":"f","args":{"x":NaN,"y":1}}}]}}]}}` + "\n" +
+		`data: {"response":{"candidates":[{"content":{"parts":[{"text":"broken"` + "\n"
+	resp := &http.Response{StatusCode: http.StatusOK, Header: http.Header{}, Body: io.NopCloser(strings.NewReader(body))}
+
+	result, err := ParseStreamWithResult(resp, func(*StreamData) error { return nil })
+	if err != nil {
+		t.Fatalf("ParseStreamWithResult: %v", err)
+	}
+	if len(result.ToolCalls) != 1 {
+		t.Fatalf("tool calls = %d, want 1", len(result.ToolCalls))
+	}
+	args := result.ToolCalls[0].Args
+	if v, ok := args["x"]; !ok || v != nil {
+		t.Fatalf("x = %#v, want null", v)
+	}
+	if result.Text != "" {
+		t.Fatalf("non-functionCall chunk should not be repaired, got text %q", result.Text)
+	}
+}
@@ -0,0 +1,164 @@
+package vertex
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"anti2api-golang/refactor/internal/logger"
+	jsonpkg "anti2api-golang/refactor/internal/pkg/json"
+)
+
+// dohMinTTL 为 DoH 解析结果的最短缓存时间，避免 TTL 很小的记录导致每个连接都查询一次。
+const dohMinTTL = 30 * time.Second
+
+// hostResolver 为上游连接提供 DNS 覆盖：先查 HOST_OVERRIDES 静态映射，再查 DNS_OVER_HTTPS，
+// 都没有结果时回退到系统 DNS。仅作用于直连；配置了 PROXY 时由代理解析目标主机名。
+type hostResolver struct {
+	static map[string][]string
+	dohURL string
+	client *http.Client
+	dialer *net.Dialer
+
+	mu    sync.Mutex
+	cache map[string]dohEntry
+}
+
+type dohEntry struct {
+	ips     []string
+	expires time.Time
+}
+
+// newHostResolver 在两项配置都为空时返回 nil（保持标准库默认拨号）。
+func newHostResolver(static map[string][]string, dohURL string) *hostResolver {
+	if len(static) == 0 && dohURL == "" {
+		return nil
+	}
+	dialer := &net.Dialer{Timeout: 30 * time.Second, KeepAlive: 30 * time.Second}
+	return &hostResolver{
+		static: static,
+		dohURL: dohURL,
+		// DoH 服务器本身走系统 DNS，建议使用 IP 形式的地址（如 https://1.1.1.1/dns-query）。
+		client: &http.Client{Timeout: 10 * time.Second, Transport: &http.Transport{DialContext: dialer.DialContext}},
+		dialer: dialer,
+		cache:  make(map[string]dohEntry),
+	}
+}
+
+// DialContext 替代 http.Transport 的默认拨号：按解析出的 IP 依次尝试，TLS 的 SNI 仍使用原主机名。
+func (r *hostResolver) DialContext(ctx context.Context, network, addr string) (net.Conn, error) {
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil || net.ParseIP(host) != nil {
+		return r.dialer.DialContext(ctx, network, addr)
+	}
+	ips := r.lookup(ctx, host)
+	if len(ips) == 0 {
+		return r.dialer.DialContext(ctx, network, addr)
+	}
+	var lastErr error
+	for _, ip := range ips {
+		conn, err := r.dialer.DialContext(ctx, network, net.JoinHostPort(ip, port))
+		if err == nil {
+			return conn, nil
+		}
+		lastErr = err
+	}
+	return nil, fmt.Errorf("连接 %s 失败（已尝试 %s）：%w", host, strings.Join(ips, ", "), lastErr)
+}
+
+func (r *hostResolver) lookup(ctx context.Context, host string) []string {
+	host = strings.ToLower(strings.TrimSuffix(host, "."))
+	if ips, ok := r.static[host]; ok {
+		return ips
+	}
+	if r.dohURL == "" {
+		return nil
+	}
+
+	r.mu.Lock()
+	entry, ok := r.cache[host]
+	r.mu.Unlock()
+	if ok && time.Now().Before(entry.expires) {
+		return entry.ips
+	}
+
+	ips, ttl, err := r.queryDoH(ctx, host)
+	if err != nil {
+		logger.Warn("DoH 解析 %s 失败，回退到系统 DNS：%v", host, err)
+		return nil
+	}
+	r.mu.Lock()
+	r.cache[host] = dohEntry{ips: ips, expires: time.Now().Add(max(ttl, dohMinTTL))}
+	r.mu.Unlock()
+	return ips
+}
+
+// dohResponse 为 DoH JSON 格式（application/dns-json，Google / Cloudflare 均支持）中用到的字段。
+type dohResponse struct {
+	Status int `json:"Status"`
+	Answer []struct {
+		Type int    `json:"type"`
+		TTL  int    `json:"TTL"`
+		Data string `json:"data"`
+	} `json:"Answer"`
+}
+
+// queryDoH 查询 host 的 A 记录，返回 IP 列表与其中最小的 TTL。
+func (r *hostResolver) queryDoH(ctx context.Context, host string) ([]string, time.Duration, error) {
+	u, err := url.Parse(r.dohURL)
+	if err != nil {
+		return nil, 0, err
+	}
+	q := u.Query()
+	q.Set("name", host)
+	q.Set("type", "A")
+	u.RawQuery = q.Encode()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return nil, 0, err
+	}
+	req.Header.Set("Accept", "application/dns-json")
+	resp, err := r.client.Do(req)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 64*1024))
+	if err != nil {
+		return nil, 0, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, 0, fmt.Errorf("HTTP %d", resp.StatusCode)
+	}
+
+	var parsed dohResponse
+	if err := jsonpkg.Unmarshal(body, &parsed); err != nil {
+		return nil, 0, err
+	}
+	if parsed.Status != 0 {
+		return nil, 0, fmt.Errorf("DNS 状态码 %d", parsed.Status)
+	}
+	var ips []string
+	ttl := time.Duration(0)
+	for _, a := range parsed.Answer {
+		// 只取 A 记录（type 1），CNAME 等中间记录由 DoH 服务器展开。
+		if a.Type != 1 || net.ParseIP(a.Data) == nil {
+			continue
+		}
+		ips = append(ips, a.Data)
+		if d := time.Duration(a.TTL) * time.Second; ttl == 0 || d < ttl {
+			ttl = d
+		}
+	}
+	if len(ips) == 0 {
+		return nil, 0, fmt.Errorf("没有 A 记录")
+	}
+	return ips, ttl, nil
+}
@@ -0,0 +1,58 @@
+package vertex
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+)
+
+func TestHostResolverStaticOverride(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, r.Host)
+	}))
+	defer srv.Close()
+	_, port, _ := net.SplitHostPort(srv.Listener.Addr().String())
+
+	r := newHostResolver(map[string][]string{"upstream.invalid": {"127.0.0.2", "127.0.0.1"}}, "")
+	// 127.0.0.2 上没有监听，应回退到下一个 IP。
+	conn, err := r.DialContext(context.Background(), "tcp", net.JoinHostPort("Upstream.Invalid", port))
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	conn.Close()
+
+	if newHostResolver(nil, "") != nil {
+		t.Fatalf("expected nil resolver without config")
+	}
+}
+
+func TestHostResolverDoH(t *testing.T) {
+	var queries atomic.Int32
+	doh := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		queries.Add(1)
+		if r.URL.Query().Get("name") != "upstream.invalid" || r.Header.Get("Accept") != "application/dns-json" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		fmt.Fprint(w, `{"Status":0,"Answer":[{"type":5,"TTL":60,"data":"alias.invalid."},{"type":1,"TTL":60,"data":"127.0.0.1"}]}`)
+	}))
+	defer doh.Close()
+
+	r := newHostResolver(nil, doh.URL+"/dns-query")
+	for i := 0; i < 2; i++ {
+		ips := r.lookup(context.Background(), "upstream.invalid")
+		if len(ips) != 1 || ips[0] != "127.0.0.1" {
+			t.Fatalf("lookup = %v", ips)
+		}
+	}
+	if n := queries.Load(); n != 1 {
+		t.Fatalf("expected cached result, got %d queries", n)
+	}
+	if ips := r.lookup(context.Background(), "other.invalid"); ips != nil {
+		t.Fatalf("failed lookup should fall back to system DNS, got %v", ips)
+	}
+}
@@ -1,6 +1,12 @@
 package vertex
 
-// SanitizeContents drops invalid/empty contents/parts before sending to Vertex.
+import "strings"
+
+// EmptyTurnPlaceholder 替换清理后没有任何有效 part 的轮次。直接删除整轮会让相邻的同角色轮次连在一起，
+// 并使 functionCall / functionResponse 的配对错位，因此保留轮次并写入占位文本。
+const EmptyTurnPlaceholder = "..."
+
+// SanitizeContents drops invalid/empty parts before sending to Vertex.
 //
 // Vertex Content.Parts elements must set at least one of:
 // - text (non-empty)
@@ -9,6 +15,7 @@ package vertex
 // - inlineData
 //
 // Additionally, `thought=true` parts must also include a non-empty text field.
+// Turns left without parts are normalized by NormalizeEmptyTurns.
 func SanitizeContents(contents []Content) []Content {
 	if len(contents) == 0 {
 		return contents
@@ -16,9 +23,6 @@ func SanitizeContents(contents []Content) []Content {
 
 	out := make([]Content, 0, len(contents))
 	for _, c := range contents {
-		if len(c.Parts) == 0 {
-			continue
-		}
 		parts := make([]Part, 0, len(c.Parts))
 		for _, p := range c.Parts {
 			if p.FunctionCall != nil || p.FunctionResponse != nil || p.InlineData != nil {
@@ -32,11 +36,41 @@ func SanitizeContents(contents []Content) []Content {
 			}
 			parts = append(parts, p)
 		}
-		if len(parts) == 0 {
-			continue
-		}
 		c.Parts = parts
 		out = append(out, c)
 	}
+	return NormalizeEmptyTurns(out)
+}
+
+// NormalizeEmptyTurns 规整空轮次与空白结尾的 model 轮次（原地修改并返回 contents）：
+//   - 非末尾的 model 轮次去掉末尾只含空白的文本 part（上游拒绝以空白结尾的 assistant 内容）；
+//   - 没有 part 的轮次写入 EmptyTurnPlaceholder，保持轮次结构；
+//   - 末尾的 model 轮次是续写前缀（prefill），为空时直接删除，末尾空白交给 TrimPrefill 处理。
+func NormalizeEmptyTurns(contents []Content) []Content {
+	out := contents[:0]
+	for i, c := range contents {
+		last := i == len(contents)-1
+		if c.Role == "model" && !last {
+			c.Parts = trimTrailingBlankParts(c.Parts)
+		}
+		if len(c.Parts) == 0 {
+			if last && c.Role == "model" {
+				continue
+			}
+			c.Parts = []Part{{Text: EmptyTurnPlaceholder}}
+		}
+		out = append(out, c)
+	}
 	return out
 }
+
+func trimTrailingBlankParts(parts []Part) []Part {
+	for len(parts) > 0 {
+		p := parts[len(parts)-1]
+		if p.Thought || p.FunctionCall != nil || p.FunctionResponse != nil || p.InlineData != nil || strings.TrimSpace(p.Text) != "" {
+			break
+		}
+		parts = parts[:len(parts)-1]
+	}
+	return parts
+}
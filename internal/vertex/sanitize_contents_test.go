@@ -0,0 +1,44 @@
+package vertex
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestSanitizeContents_KeepsTurnStructure(t *testing.T) {
+	call := &FunctionCall{ID: "call_1", Name: "lookup"}
+	resp := &FunctionResponse{ID: "call_1", Name: "lookup", Response: map[string]any{"output": "ok"}}
+	in := []Content{
+		{Role: "user", Parts: []Part{{Text: "hi"}}},
+		{Role: "model", Parts: []Part{{Text: "", Thought: true, ThoughtSignature: "sig"}}},
+		{Role: "user", Parts: []Part{{Text: "again"}}},
+		{Role: "model", Parts: []Part{{FunctionCall: call}, {Text: " \n"}}},
+		{Role: "user", Parts: []Part{{FunctionResponse: resp}}},
+		{Role: "model", Parts: []Part{{Text: "\n\n"}}},
+		{Role: "user", Parts: nil},
+		{Role: "model", Parts: []Part{{Text: ""}}},
+	}
+	want := []Content{
+		{Role: "user", Parts: []Part{{Text: "hi"}}},
+		{Role: "model", Parts: []Part{{Text: EmptyTurnPlaceholder}}},
+		{Role: "user", Parts: []Part{{Text: "again"}}},
+		{Role: "model", Parts: []Part{{FunctionCall: call}}},
+		{Role: "user", Parts: []Part{{FunctionResponse: resp}}},
+		{Role: "model", Parts: []Part{{Text: EmptyTurnPlaceholder}}},
+		{Role: "user", Parts: []Part{{Text: EmptyTurnPlaceholder}}},
+	}
+	if got := SanitizeContents(in); !reflect.DeepEqual(got, want) {
+		t.Fatalf("got  %+v\nwant %+v", got, want)
+	}
+}
+
+func TestNormalizeEmptyTurns_LeavesPrefillWhitespace(t *testing.T) {
+	in := []Content{
+		{Role: "user", Parts: []Part{{Text: "hi"}}},
+		{Role: "model", Parts: []Part{{Text: "Sure: "}, {Text: " "}}},
+	}
+	got := NormalizeEmptyTurns(in)
+	if len(got) != 2 || len(got[1].Parts) != 2 {
+		t.Fatalf("trailing prefill should be left to TrimPrefill: %+v", got)
+	}
+}
@@ -0,0 +1,123 @@
+package vertex
+
+import (
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// lossyKeywords 为 Vertex Schema 不支持、会被 SanitizeFunctionParametersSchema 删除的校验关键字
+// （description、examples 等注释类关键字不影响参数是否合法，不在此列）。
+var lossyKeywords = []string{
+	"additionalProperties", "patternProperties", "propertyNames", "unevaluatedProperties",
+	"minProperties", "maxProperties", "dependentRequired", "dependentSchemas", "dependencies",
+	"pattern", "format", "minLength", "maxLength", "const",
+	"minItems", "maxItems", "uniqueItems", "prefixItems", "contains", "unevaluatedItems",
+	"multipleOf", "not", "if", "then", "else",
+}
+
+// LostSchemaConstraints 比较原始参数 schema 与 SanitizeFunctionParametersSchema 的结果，
+// 返回因 Vertex 不支持而被删除或放宽的校验约束（按路径排序，例如 "properties.name.pattern"）。
+// 用于 strict 函数声明：这些约束无法再由上游保证。
+func LostSchemaConstraints(original, sanitized map[string]any) []string {
+	var lost []string
+	collectLostConstraints("", original, sanitized, &lost)
+	sort.Strings(lost)
+	return lost
+}
+
+func collectLostConstraints(path string, orig, san map[string]any, lost *[]string) {
+	if orig == nil {
+		return
+	}
+	at := func(key string) string {
+		if path == "" {
+			return key
+		}
+		return path + "." + key
+	}
+
+	for _, k := range lossyKeywords {
+		if _, ok := orig[k]; ok {
+			*lost = append(*lost, at(k))
+		}
+	}
+	sanType, _ := san["type"].(string)
+	for _, k := range []string{"exclusiveMinimum", "exclusiveMaximum"} {
+		// 整数类型的开区间会转换为等价的闭区间，其余类型只能放宽为闭区间。
+		if _, ok := orig[k]; ok && sanType != "INTEGER" {
+			*lost = append(*lost, at(k))
+		}
+	}
+	if arr, ok := orig["allOf"].([]any); ok && len(arr) > 1 {
+		*lost = append(*lost, at("allOf"))
+	}
+	if origReq := stringSet(orig["required"]); len(origReq) > 0 && !slices.Equal(origReq, stringSet(san["required"])) {
+		*lost = append(*lost, at("required"))
+	}
+	if _, ok := orig["enum"]; ok {
+		if _, kept := san["enum"]; !kept {
+			*lost = append(*lost, at("enum"))
+		}
+	}
+
+	for _, key := range []string{"properties", "defs", "$defs", "definitions"} {
+		children, ok := orig[key].(map[string]any)
+		if !ok {
+			continue
+		}
+		sanKey := key
+		if key != "properties" {
+			sanKey = "defs"
+		}
+		sanChildren, _ := san[sanKey].(map[string]any)
+		for name, child := range children {
+			m, _ := child.(map[string]any)
+			sm, _ := sanChildren[name].(map[string]any)
+			collectLostConstraints(at(key+"."+name), m, sm, lost)
+		}
+	}
+	if items, ok := orig["items"].(map[string]any); ok {
+		sanItems, _ := san["items"].(map[string]any)
+		collectLostConstraints(at("items"), items, sanItems, lost)
+	}
+	// anyOf 分支按位置对应（oneOf 会并入 anyOf，仅在只有其中一种时对应）。
+	for _, key := range []string{"anyOf", "oneOf"} {
+		branches, ok := orig[key].([]any)
+		if !ok {
+			continue
+		}
+		if key == "oneOf" {
+			if _, both := orig["anyOf"]; both {
+				continue
+			}
+		}
+		sanBranches, _ := san["anyOf"].([]any)
+		for i, b := range branches {
+			m, _ := b.(map[string]any)
+			var sm map[string]any
+			if i < len(sanBranches) {
+				sm, _ = sanBranches[i].(map[string]any)
+			}
+			collectLostConstraints(at(key+"."+strconv.Itoa(i)), m, sm, lost)
+		}
+	}
+}
+
+// stringSet 返回排序后的字符串数组，非数组时返回 nil。
+func stringSet(v any) []string {
+	var out []string
+	switch t := v.(type) {
+	case []string:
+		out = append(out, t...)
+	case []any:
+		for _, it := range t {
+			if s, ok := it.(string); ok && strings.TrimSpace(s) != "" {
+				out = append(out, s)
+			}
+		}
+	}
+	sort.Strings(out)
+	return out
+}
@@ -0,0 +1,45 @@
+package vertex
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestLostSchemaConstraints(t *testing.T) {
+	schema := map[string]any{
+		"type":                 "object",
+		"additionalProperties": false,
+		"required":             []any{"id", "count", "tags"},
+		"properties": map[string]any{
+			"id":    map[string]any{"type": "string", "pattern": "^[a-z]+$", "description": "ID"},
+			"count": map[string]any{"type": "integer", "exclusiveMinimum": 0},
+			"ratio": map[string]any{"type": "number", "exclusiveMaximum": 1},
+			"tags":  map[string]any{"type": "array", "items": map[string]any{"type": "string", "format": "uuid"}, "maxItems": 3},
+		},
+	}
+	got := LostSchemaConstraints(schema, SanitizeFunctionParametersSchema(schema))
+	want := []string{
+		"additionalProperties",
+		"properties.id.pattern",
+		"properties.ratio.exclusiveMaximum",
+		"properties.tags.items.format",
+		"properties.tags.maxItems",
+	}
+	if !slices.Equal(got, want) {
+		t.Fatalf("LostSchemaConstraints = %v, want %v", got, want)
+	}
+}
+
+func TestLostSchemaConstraints_NoLoss(t *testing.T) {
+	schema := map[string]any{
+		"type":     "object",
+		"required": []any{"q"},
+		"properties": map[string]any{
+			"q":    map[string]any{"type": "string", "enum": []any{"a", "b"}},
+			"opts": map[string]any{"anyOf": []any{map[string]any{"type": "string"}, map[string]any{"type": "null"}}},
+		},
+	}
+	if got := LostSchemaConstraints(schema, SanitizeFunctionParametersSchema(schema)); len(got) != 0 {
+		t.Fatalf("unexpected lost constraints: %v", got)
+	}
+}
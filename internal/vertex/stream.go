@@ -8,6 +8,7 @@ import (
 	"net/http"
 	"strings"
 
+	"anti2api-golang/refactor/internal/config"
 	"anti2api-golang/refactor/internal/logger"
 	httppkg "anti2api-golang/refactor/internal/pkg/http"
 	jsonpkg "anti2api-golang/refactor/internal/pkg/json"
@@ -18,16 +19,19 @@ type StreamData struct {
 		Candidates []struct {
 			Content struct {
 				Parts []struct {
-					Text             string        `json:"text,omitempty"`
-					FunctionCall     *FunctionCall `json:"functionCall,omitempty"`
-					InlineData       *InlineData   `json:"inlineData,omitempty"`
-					Thought          bool          `json:"thought,omitempty"`
-					ThoughtSignature string        `json:"thoughtSignature,omitempty"`
+					Text         string        `json:"text,omitempty"`
+					FunctionCall *FunctionCall `json:"functionCall,omitempty"`
+					// FunctionResponse 只出现在代理插入的分片中（可见的代执行函数的结果，见 ProxyFunction）。
+					FunctionResponse *FunctionResponse `json:"functionResponse,omitempty"`
+					InlineData       *InlineData       `json:"inlineData,omitempty"`
+					Thought          bool              `json:"thought,omitempty"`
+					ThoughtSignature string            `json:"thoughtSignature,omitempty"`
 				} `json:"parts"`
 			} `json:"content"`
 			FinishReason string `json:"finishReason,omitempty"`
 		} `json:"candidates"`
-		UsageMetadata *UsageMetadata `json:"usageMetadata,omitempty"`
+		UsageMetadata  *UsageMetadata  `json:"usageMetadata,omitempty"`
+		PromptFeedback *PromptFeedback `json:"promptFeedback,omitempty"`
 	} `json:"response"`
 }
 
@@ -40,6 +44,9 @@ type StreamResult struct {
 	Usage            *UsageMetadata   `json:"-"`
 	ToolCalls        []ToolCallInfo   `json:"-"`
 	ThoughtSignature string           `json:"-"`
+	PromptFeedback   *PromptFeedback  `json:"-"`
+	// Bytes 为读取的上游流字节数（用于大响应后的内存归还）。
+	Bytes int `json:"-"`
 }
 
 type ToolCallInfo struct {
@@ -68,21 +75,25 @@ func ParseStreamWithResult(resp *http.Response, receiver func(data *StreamData)
 	var textBuilder strings.Builder
 	var thinkingBuilder strings.Builder
 
-	buildMerged := logger.IsBackendLogEnabled()
+	// 合并后的响应用于高等级日志与会话记录。
+	buildMerged := logger.IsBackendLogEnabled() || config.Get().TranscriptEnabled
 
-	var mergedParts []any
+	var mergedParts *PartsCollector
+	if buildMerged {
+		mergedParts = NewPartsCollector()
+	}
 	var lastFinishReason string
 	var lastUsage any
+	var streamErr error
 
 	for {
 		line, err := bufReader.ReadString('\n')
+		result.Bytes += len(line)
 		if err != nil {
-			if err == io.EOF {
-				break
+			if err != io.EOF {
+				streamErr = err
 			}
-			result.Text = textBuilder.String()
-			result.Thinking = thinkingBuilder.String()
-			return result, err
+			break
 		}
 
 		line = strings.TrimSuffix(line, "\n")
@@ -104,7 +115,16 @@ func ParseStreamWithResult(resp *http.Response, receiver func(data *StreamData)
 
 		var data StreamData
 		if err := jsonpkg.UnmarshalString(jsonData, &data); err != nil {
-			continue
+			// 上游偶尔在 functionCall 参数中输出 NaN、多余内容或缺失括号，尝试修复后再解析，
+			// 避免整个工具调用被丢弃。
+			fixed, ok := repairFunctionCallJSON(jsonData)
+			if !ok || jsonpkg.UnmarshalString(fixed, &data) != nil {
+				continue
+			}
+			jsonData = fixed
+			if buildMerged {
+				_ = jsonpkg.UnmarshalString(jsonData, &rawChunk)
+			}
 		}
 
 		if data.Response.UsageMetadata != nil {
@@ -118,6 +138,10 @@ func ParseStreamWithResult(resp *http.Response, receiver func(data *StreamData)
 			}
 		}
 
+		if data.Response.PromptFeedback != nil && data.Response.PromptFeedback.BlockReason != "" {
+			result.PromptFeedback = data.Response.PromptFeedback
+		}
+
 		if len(data.Response.Candidates) > 0 {
 			candidate := data.Response.Candidates[0]
 			if candidate.FinishReason != "" {
@@ -131,7 +155,7 @@ func ParseStreamWithResult(resp *http.Response, receiver func(data *StreamData)
 						if cand, ok := candidates[0].(map[string]any); ok {
 							if content, ok := cand["content"].(map[string]any); ok {
 								if parts, ok := content["parts"].([]any); ok {
-									mergedParts = append(mergedParts, parts...)
+									mergedParts.Add(parts, len(jsonData))
 								}
 							}
 						}
@@ -159,9 +183,8 @@ func ParseStreamWithResult(resp *http.Response, receiver func(data *StreamData)
 		}
 
 		if err := receiver(&data); err != nil {
-			result.Text = textBuilder.String()
-			result.Thinking = thinkingBuilder.String()
-			return result, err
+			streamErr = err
+			break
 		}
 	}
 
@@ -174,7 +197,7 @@ func ParseStreamWithResult(resp *http.Response, receiver func(data *StreamData)
 					map[string]any{
 						"content": map[string]any{
 							"role":  "model",
-							"parts": mergeParts(mergedParts),
+							"parts": mergedParts.Merged(),
 						},
 						"finishReason": lastFinishReason,
 					},
@@ -184,7 +207,7 @@ func ParseStreamWithResult(resp *http.Response, receiver func(data *StreamData)
 		}
 	}
 
-	return result, nil
+	return result, streamErr
 }
 
 func mergeParts(parts []any) []any {
@@ -225,7 +248,8 @@ func mergeParts(parts []any) []any {
 	}
 
 	buildPart := func(text string, thought bool, extra map[string]any) map[string]any {
-		result := map[string]any{"text": text}
+		// 多字节字符可能被拆在相邻分片中，拼接后即恢复完整；仍不合法的字节（例如流被截断）替换为 U+FFFD。
+		result := map[string]any{"text": strings.ToValidUTF8(text, "\uFFFD")}
 		if thought {
 			result["thought"] = true
 		}
@@ -1,45 +1,62 @@
 package vertex
 
+import (
+	"strings"
+
+	"anti2api-golang/refactor/internal/config"
+)
+
 const AgentSystemPrompt = `You are Antigravity, a powerful agentic AI coding assistant designed by the Google Deepmind team working on Advanced Agentic Coding.
 You are pair programming with a USER to solve their coding task. The task may require creating a new codebase, modifying or debugging an existing codebase, or simply answering a question.
 - **Proactiveness**`
 
+// InjectAgentSystemPrompt 将 Antigravity agent 提示词放在 systemInstruction 最前面。
+// 若首个 part 是纯文本则合并到该 part，否则作为新的文本 part 插入；其余 part（包括 inlineData）保持原样与顺序。
 func InjectAgentSystemPrompt(sysInstr *SystemInstruction) *SystemInstruction {
-	if sysInstr == nil {
+	if sysInstr == nil || len(sysInstr.Parts) == 0 {
+		clientRole := ""
+		if sysInstr != nil {
+			clientRole = sysInstr.Role
+		}
 		return &SystemInstruction{
-			Role:  "user",
+			Role:  SystemInstructionRole(clientRole),
 			Parts: []Part{{Text: AgentSystemPrompt}},
 		}
 	}
 
-	var existingText string
-	if len(sysInstr.Parts) > 0 {
-		existingText = sysInstr.Parts[0].Text
-	}
-
-	combinedText := AgentSystemPrompt
-	if existingText != "" {
-		combinedText = AgentSystemPrompt + "\n\n" + existingText
-	}
-
-	newCap := 1
-	if len(sysInstr.Parts) > 1 {
-		newCap += len(sysInstr.Parts) - 1
-	}
-	newParts := make([]Part, 0, newCap)
-	if len(sysInstr.Parts) > 0 {
-		first := sysInstr.Parts[0]
-		first.Text = combinedText
+	newParts := make([]Part, 0, len(sysInstr.Parts)+1)
+	if first := sysInstr.Parts[0]; isPlainTextPart(first) {
+		if first.Text != "" {
+			first.Text = AgentSystemPrompt + "\n\n" + first.Text
+		} else {
+			first.Text = AgentSystemPrompt
+		}
 		newParts = append(newParts, first)
-	} else {
-		newParts = append(newParts, Part{Text: combinedText})
-	}
-	if len(sysInstr.Parts) > 1 {
 		newParts = append(newParts, sysInstr.Parts[1:]...)
+	} else {
+		newParts = append(newParts, Part{Text: AgentSystemPrompt})
+		newParts = append(newParts, sysInstr.Parts...)
 	}
 
 	return &SystemInstruction{
-		Role:  "user",
+		Role:  SystemInstructionRole(sysInstr.Role),
 		Parts: newParts,
 	}
 }
+
+// SystemInstructionRole 根据 SYSTEM_INSTRUCTION_ROLE 决定发往上游的 systemInstruction.role：
+// user（默认，统一改为 user）、keep（保留客户端传入的 role，未传则不写出）、none（不写出 role）。
+func SystemInstructionRole(clientRole string) string {
+	switch strings.ToLower(strings.TrimSpace(config.Get().SystemInstructionRole)) {
+	case "keep":
+		return clientRole
+	case "none":
+		return ""
+	default:
+		return "user"
+	}
+}
+
+func isPlainTextPart(p Part) bool {
+	return p.InlineData == nil && p.FunctionCall == nil && p.FunctionResponse == nil && !p.Thought
+}
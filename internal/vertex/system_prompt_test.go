@@ -0,0 +1,87 @@
+package vertex
+
+import (
+	"testing"
+
+	"anti2api-golang/refactor/internal/config"
+)
+
+func setSystemInstructionRole(t *testing.T, role string) {
+	t.Helper()
+	cfg := config.Get()
+	prev := cfg.SystemInstructionRole
+	cfg.SystemInstructionRole = role
+	t.Cleanup(func() { cfg.SystemInstructionRole = prev })
+}
+
+func TestInjectAgentSystemPrompt_PreservesAllParts(t *testing.T) {
+	setSystemInstructionRole(t, "user")
+	in := &SystemInstruction{Role: "system", Parts: []Part{
+		{Text: "be brief"},
+		{InlineData: &InlineData{MimeType: "image/png", Data: "AAAA"}},
+		{Text: "second"},
+	}}
+
+	out := InjectAgentSystemPrompt(in)
+	if len(out.Parts) != 3 {
+		t.Fatalf("expected 3 parts, got %d", len(out.Parts))
+	}
+	if out.Parts[0].Text != AgentSystemPrompt+"\n\nbe brief" {
+		t.Fatalf("unexpected first part %q", out.Parts[0].Text)
+	}
+	if out.Parts[1].InlineData == nil || out.Parts[1].InlineData.Data != "AAAA" {
+		t.Fatalf("expected inlineData part to be kept, got %+v", out.Parts[1])
+	}
+	if out.Parts[2].Text != "second" {
+		t.Fatalf("unexpected third part %q", out.Parts[2].Text)
+	}
+	if out.Role != "user" {
+		t.Fatalf("expected role user, got %q", out.Role)
+	}
+	if in.Parts[0].Text != "be brief" {
+		t.Fatalf("input should not be modified, got %q", in.Parts[0].Text)
+	}
+}
+
+func TestInjectAgentSystemPrompt_InlineDataFirst(t *testing.T) {
+	setSystemInstructionRole(t, "user")
+	in := &SystemInstruction{Parts: []Part{
+		{InlineData: &InlineData{MimeType: "application/pdf", Data: "BBBB"}},
+		{Text: "summarize"},
+	}}
+
+	out := InjectAgentSystemPrompt(in)
+	if len(out.Parts) != 3 {
+		t.Fatalf("expected 3 parts, got %d", len(out.Parts))
+	}
+	if out.Parts[0].Text != AgentSystemPrompt || out.Parts[0].InlineData != nil {
+		t.Fatalf("expected a new prompt part first, got %+v", out.Parts[0])
+	}
+	if out.Parts[1].InlineData == nil || out.Parts[2].Text != "summarize" {
+		t.Fatalf("unexpected remaining parts %+v", out.Parts[1:])
+	}
+}
+
+func TestSystemInstructionRole(t *testing.T) {
+	cases := []struct {
+		mode, client, want string
+	}{
+		{"user", "", "user"},
+		{"user", "system", "user"},
+		{"", "system", "user"},
+		{"keep", "system", "system"},
+		{"keep", "", ""},
+		{"none", "user", ""},
+	}
+	for _, tc := range cases {
+		setSystemInstructionRole(t, tc.mode)
+		if got := SystemInstructionRole(tc.client); got != tc.want {
+			t.Fatalf("mode %q client %q: got %q, want %q", tc.mode, tc.client, got, tc.want)
+		}
+	}
+
+	setSystemInstructionRole(t, "none")
+	if out := InjectAgentSystemPrompt(nil); out.Role != "" || len(out.Parts) != 1 {
+		t.Fatalf("unexpected injected instruction %+v", out)
+	}
+}
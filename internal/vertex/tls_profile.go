@@ -0,0 +1,81 @@
+package vertex
+
+import (
+	"crypto/tls"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// tlsProfile 为上游连接的 TLS 参数预设（UPSTREAM_TLS_PROFILE）。
+//
+// 预设基于标准库 crypto/tls，只能调整 ALPN、TLS 版本范围、椭圆曲线与 TLS 1.2 套件集合：
+// 标准库不遵循 CipherSuites 的顺序、TLS 1.3 套件固定，也无法控制扩展顺序或 GREASE，
+// 因此预设不模拟任何浏览器的 ClientHello 指纹，只在默认参数被区别对待时提供可选的组合。
+type tlsProfile struct {
+	http2  bool
+	config func() *tls.Config
+}
+
+// tls12CipherSuites 为 h2 预设在 TLS 1.2 下提供的 ECDHE / RSA 套件（TLS 1.3 套件由标准库固定）。
+var tls12CipherSuites = []uint16{
+	tls.TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256,
+	tls.TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256,
+	tls.TLS_ECDHE_ECDSA_WITH_AES_256_GCM_SHA384,
+	tls.TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384,
+	tls.TLS_ECDHE_ECDSA_WITH_CHACHA20_POLY1305_SHA256,
+	tls.TLS_ECDHE_RSA_WITH_CHACHA20_POLY1305_SHA256,
+	tls.TLS_ECDHE_RSA_WITH_AES_128_CBC_SHA,
+	tls.TLS_ECDHE_RSA_WITH_AES_256_CBC_SHA,
+	tls.TLS_RSA_WITH_AES_128_GCM_SHA256,
+	tls.TLS_RSA_WITH_AES_256_GCM_SHA384,
+	tls.TLS_RSA_WITH_AES_128_CBC_SHA,
+	tls.TLS_RSA_WITH_AES_256_CBC_SHA,
+}
+
+var tlsProfiles = map[string]tlsProfile{
+	// h2：ALPN 为 h2 + http/1.1（启用 HTTP/2），曲线为 X25519/P-256/P-384，并额外提供 CBC / RSA 密钥交换的 TLS 1.2 套件。
+	"h2": {http2: true, config: func() *tls.Config {
+		return &tls.Config{
+			MinVersion:       tls.VersionTLS12,
+			NextProtos:       []string{"h2", "http/1.1"},
+			CurvePreferences: []tls.CurveID{tls.X25519, tls.CurveP256, tls.CurveP384},
+			CipherSuites:     tls12CipherSuites,
+		}
+	}},
+	// h2-p521：与 h2 相同，额外提供 P-521 曲线。
+	"h2-p521": {http2: true, config: func() *tls.Config {
+		return &tls.Config{
+			MinVersion:       tls.VersionTLS12,
+			NextProtos:       []string{"h2", "http/1.1"},
+			CurvePreferences: []tls.CurveID{tls.X25519, tls.CurveP256, tls.CurveP384, tls.CurveP521},
+			CipherSuites:     tls12CipherSuites,
+		}
+	}},
+	// tls13：只协商 TLS 1.3（保持 HTTP/1.1），ClientHello 中不再携带 TLS 1.2 套件。
+	"tls13": {config: func() *tls.Config {
+		return &tls.Config{MinVersion: tls.VersionTLS13, NextProtos: []string{"http/1.1"}}
+	}},
+}
+
+// renamedTLSProfiles 为旧版本中的预设名（它们从未模拟对应浏览器的指纹，已按实际行为改名）。
+var renamedTLSProfiles = map[string]string{"chrome": "h2", "firefox": "h2-p521"}
+
+// applyTLSProfile 按预设名配置 transport；空字符串或 "go" 保持标准库默认，未知预设返回错误且不修改 transport。
+func applyTLSProfile(transport *http.Transport, name string) error {
+	name = strings.ToLower(strings.TrimSpace(name))
+	if name == "" || name == "go" {
+		return nil
+	}
+	p, ok := tlsProfiles[name]
+	if !ok {
+		if renamed, ok := renamedTLSProfiles[name]; ok {
+			return fmt.Errorf("UPSTREAM_TLS_PROFILE=%s 已改名为 %s（该预设并不模拟浏览器指纹）", name, renamed)
+		}
+		return fmt.Errorf("未知的 UPSTREAM_TLS_PROFILE %q（可选：go / h2 / h2-p521 / tls13）", name)
+	}
+	transport.TLSClientConfig = p.config()
+	// 自定义 TLSClientConfig 后标准库默认不再启用 HTTP/2，需显式开启以匹配 ALPN。
+	transport.ForceAttemptHTTP2 = p.http2
+	return nil
+}
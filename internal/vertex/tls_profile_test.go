@@ -0,0 +1,39 @@
+package vertex
+
+import (
+	"crypto/tls"
+	"net/http"
+	"testing"
+)
+
+func TestApplyTLSProfile(t *testing.T) {
+	for _, name := range []string{"", "go", " GO "} {
+		tr := &http.Transport{}
+		if err := applyTLSProfile(tr, name); err != nil || tr.TLSClientConfig != nil || tr.ForceAttemptHTTP2 {
+			t.Fatalf("%q: err=%v cfg=%v h2=%v", name, err, tr.TLSClientConfig, tr.ForceAttemptHTTP2)
+		}
+	}
+
+	tr := &http.Transport{}
+	if err := applyTLSProfile(tr, "H2"); err != nil {
+		t.Fatal(err)
+	}
+	if !tr.ForceAttemptHTTP2 || tr.TLSClientConfig == nil || tr.TLSClientConfig.NextProtos[0] != "h2" {
+		t.Fatalf("h2: h2=%v cfg=%+v", tr.ForceAttemptHTTP2, tr.TLSClientConfig)
+	}
+
+	tr = &http.Transport{}
+	if err := applyTLSProfile(tr, "tls13"); err != nil {
+		t.Fatal(err)
+	}
+	if tr.ForceAttemptHTTP2 || tr.TLSClientConfig.MinVersion != tls.VersionTLS13 {
+		t.Fatalf("tls13: h2=%v min=%x", tr.ForceAttemptHTTP2, tr.TLSClientConfig.MinVersion)
+	}
+
+	for _, name := range []string{"safari", "chrome", "firefox"} {
+		tr = &http.Transport{}
+		if err := applyTLSProfile(tr, name); err == nil || tr.TLSClientConfig != nil {
+			t.Fatalf("%s: err=%v cfg=%v", name, err, tr.TLSClientConfig)
+		}
+	}
+}
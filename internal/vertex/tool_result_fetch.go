@@ -0,0 +1,107 @@
+package vertex
+
+import (
+	"fmt"
+	"strings"
+	"unicode/utf8"
+)
+
+// ToolResultFetchName 为自动注入的工具结果读取工具名，该工具的调用由代理执行（见 Request.proxyFunction），不会返回给客户端。
+const ToolResultFetchName = "fetch_tool_result"
+
+const (
+	// defaultToolResultFetchLines / maxToolResultFetchLines 为单次读取的默认行数与上限。
+	defaultToolResultFetchLines = 200
+	maxToolResultFetchLines     = 1000
+	// maxToolResultFetchBytes 限制单次读取返回的字节数（避免一次读回整个大结果）。
+	maxToolResultFetchBytes = 32 << 10
+)
+
+// ToolResultFetchDeclaration 返回 fetch_tool_result 的函数声明。
+func ToolResultFetchDeclaration() FunctionDeclaration {
+	return FunctionDeclaration{
+		Name: ToolResultFetchName,
+		Description: "Read part of a large tool result that was replaced by a reference (a functionResponse containing \"ref\" and \"summary\"). " +
+			"Returns the requested lines of the original output. Call it only when the summary is not enough. " +
+			"If a line is too long to return at once, the result contains next_offset; call again with start_line set to end_line and start_offset set to next_offset to continue that line.",
+		Parameters: map[string]any{
+			"type": "OBJECT",
+			"properties": map[string]any{
+				"ref":          map[string]any{"type": "STRING", "description": "The ref value of the referenced tool result."},
+				"start_line":   map[string]any{"type": "INTEGER", "description": "1-based line to start reading from (default 1)."},
+				"start_offset": map[string]any{"type": "INTEGER", "description": "Byte offset within start_line to resume a long line from (default 0)."},
+				"max_lines":    map[string]any{"type": "INTEGER", "description": fmt.Sprintf("Maximum number of lines to return (default %d, at most %d).", defaultToolResultFetchLines, maxToolResultFetchLines)},
+			},
+			"required": []any{"ref"},
+		},
+	}
+}
+
+// fetchToolResult 执行一次 fetch_tool_result 调用，返回 functionResponse.response。
+// 单行超过 maxToolResultFetchBytes 时只返回该行的一段，并以 next_offset 给出下次从该行继续读取的字节偏移。
+func (r *Request) fetchToolResult(args map[string]any) map[string]any {
+	ref, _ := args["ref"].(string)
+	text, ok := r.ToolResultRefs[ref]
+	if !ok {
+		return map[string]any{"error": fmt.Sprintf("unknown ref %q", ref)}
+	}
+	lines := strings.SplitAfter(text, "\n")
+	if lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	start := max(intArg(args["start_line"], 1), 1)
+	limit := min(max(intArg(args["max_lines"], defaultToolResultFetchLines), 1), maxToolResultFetchLines)
+
+	offset := max(intArg(args["start_offset"], 0), 0)
+
+	var sb strings.Builder
+	end, next := start-1, 0
+	for i := start - 1; i < len(lines) && i < start-1+limit; i++ {
+		line, base := lines[i], 0
+		if i == start-1 {
+			base = min(offset, len(line))
+			line = line[base:]
+		}
+		if sb.Len()+len(line) > maxToolResultFetchBytes {
+			if sb.Len() == 0 {
+				// 单行超过上限时返回该行的一段，下次从 next_offset 继续。
+				cut := maxToolResultFetchBytes
+				for cut > 0 && !utf8.RuneStart(line[cut]) {
+					cut--
+				}
+				if cut == 0 {
+					cut = maxToolResultFetchBytes
+				}
+				sb.WriteString(line[:cut])
+				end, next = i+1, base+cut
+			}
+			break
+		}
+		sb.WriteString(line)
+		end = i + 1
+	}
+	out := map[string]any{
+		"ref":         ref,
+		"start_line":  start,
+		"end_line":    end,
+		"total_lines": len(lines),
+		"content":     sb.String(),
+		"has_more":    end < len(lines) || next > 0,
+	}
+	if next > 0 {
+		out["next_offset"] = next
+	}
+	return out
+}
+
+func intArg(v any, def int) int {
+	switch n := v.(type) {
+	case float64:
+		return int(n)
+	case int:
+		return n
+	case int64:
+		return int(n)
+	}
+	return def
+}
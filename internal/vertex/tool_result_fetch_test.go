@@ -0,0 +1,126 @@
+package vertex
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+func TestFetchToolResult(t *testing.T) {
+	req := &Request{ToolResultRefs: map[string]string{"tr_1": "a\nb\nc\nd\n"}}
+	got := req.fetchToolResult(map[string]any{"ref": "tr_1", "start_line": float64(2), "max_lines": float64(2)})
+	if got["content"] != "b\nc\n" || got["end_line"] != 3 || got["total_lines"] != 4 || got["has_more"] != true {
+		t.Fatalf("unexpected fetch result: %v", got)
+	}
+	if got := req.fetchToolResult(map[string]any{"ref": "tr_x"}); got["error"] == nil {
+		t.Fatalf("unknown ref should return an error, got %v", got)
+	}
+}
+
+func TestFetchToolResult_LongLine(t *testing.T) {
+	long := "x" + strings.Repeat("é", maxToolResultFetchBytes) + "\n"
+	req := &Request{ToolResultRefs: map[string]string{"tr_1": "a\n" + long + "b\n"}}
+
+	// 长行之前的内容先返回，长行留到下一次读取。
+	got := req.fetchToolResult(map[string]any{"ref": "tr_1"})
+	if got["content"] != "a\n" || got["end_line"] != 1 || got["has_more"] != true || got["next_offset"] != nil {
+		t.Fatalf("unexpected first page: %v", got)
+	}
+
+	var sb strings.Builder
+	args := map[string]any{"ref": "tr_1", "start_line": float64(2)}
+	for range 4 {
+		got = req.fetchToolResult(args)
+		content := got["content"].(string)
+		if len(content) > maxToolResultFetchBytes || !utf8.ValidString(content) {
+			t.Fatalf("page must be bounded and valid UTF-8, got %d bytes", len(content))
+		}
+		sb.WriteString(content)
+		next, ok := got["next_offset"].(int)
+		if !ok {
+			break
+		}
+		if got["end_line"] != 2 || got["has_more"] != true {
+			t.Fatalf("unexpected partial page: %v", got)
+		}
+		args["start_offset"] = float64(next)
+	}
+	if sb.String() != long+"b\n" || got["end_line"] != 3 || got["has_more"] != false {
+		t.Fatalf("long line not fully readable: got %d bytes, last page %v", sb.Len(), got["end_line"])
+	}
+}
+
+func fetchCallResponse(name string) *Response {
+	var r Response
+	r.Response.Candidates = []Candidate{{Content: Content{Role: "model", Parts: []Part{{FunctionCall: &FunctionCall{ID: "f1", Name: name, Args: map[string]any{"ref": "tr_1"}}}}}}}
+	return &r
+}
+
+func TestWithProxyCalls_ToolResultFetch(t *testing.T) {
+	req := &Request{ToolResultRefs: map[string]string{"tr_1": "full output"}}
+	req.Request.Contents = []Content{{Role: "user", Parts: []Part{{Text: "hi"}}}}
+
+	var sent *Request
+	final := &Response{}
+	final.Response.Candidates = []Candidate{{Content: Content{Role: "model", Parts: []Part{{Text: "done"}}}, FinishReason: "STOP"}}
+	resp, err := withProxyCalls(context.Background(), req, fetchCallResponse(ToolResultFetchName), "", func(r *Request) (*Response, error) {
+		sent = r
+		return final, nil
+	})
+	if err != nil || resp != final {
+		t.Fatalf("expected follow-up response, got %v %v", resp, err)
+	}
+	if len(sent.Request.Contents) != 3 || sent.Request.Contents[2].Parts[0].FunctionResponse.Response["content"] != "full output" {
+		t.Fatalf("unexpected follow-up contents: %+v", sent.Request.Contents)
+	}
+	if len(req.Request.Contents) != 1 {
+		t.Fatalf("original request must not be modified")
+	}
+
+	// 与客户端工具调用混在一起时只去掉 fetch 调用。
+	mixed := fetchCallResponse(ToolResultFetchName)
+	mixed.Response.Candidates[0].Content.Parts = append(mixed.Response.Candidates[0].Content.Parts, Part{FunctionCall: &FunctionCall{Name: "read_file"}})
+	resp, _ = withProxyCalls(context.Background(), req, mixed, "", func(*Request) (*Response, error) {
+		t.Fatal("should not resend when client calls are present")
+		return nil, nil
+	})
+	if parts := resp.Response.Candidates[0].Content.Parts; len(parts) != 1 || parts[0].FunctionCall.Name != "read_file" {
+		t.Fatalf("expected only the client call to remain, got %+v", parts)
+	}
+}
+
+func sseResponse(lines ...string) *http.Response {
+	return &http.Response{StatusCode: http.StatusOK, Header: http.Header{}, Body: io.NopCloser(strings.NewReader(strings.Join(lines, "\n\n") + "\n\n"))}
+}
+
+func TestWithProxyCallsStream_ToolResultFetch(t *testing.T) {
+	req := &Request{ToolResultRefs: map[string]string{"tr_1": "full output"}}
+	first := sseResponse(
+		`data: {"response":{"candidates":[{"content":{"role":"model","parts":[{"text":"checking "}]}}]}}`,
+		`data: {"response":{"candidates":[{"content":{"role":"model","parts":[{"functionCall":{"name":"fetch_tool_result","args":{"ref":"tr_1"}}}]},"finishReason":"STOP"}],"usageMetadata":{"totalTokenCount":5}}}`,
+	)
+	var sent *Request
+	resp := withProxyCallsStream(context.Background(), req, first, "", func(r *Request) (*http.Response, error) {
+		sent = r
+		return sseResponse(`data: {"response":{"candidates":[{"content":{"role":"model","parts":[{"text":"done"}]},"finishReason":"STOP"}],"usageMetadata":{"promptTokenCount":3,"totalTokenCount":7}}}`), nil
+	})
+	out, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := string(out)
+	if strings.Contains(s, ToolResultFetchName) || strings.Count(s, "finishReason") != 1 || !strings.Contains(s, "checking ") || !strings.Contains(s, "done") {
+		t.Fatalf("unexpected stream:\n%s", s)
+	}
+	// 被去掉的第一轮用量累加到最后一轮的 usageMetadata 中。
+	if strings.Count(s, "usageMetadata") != 1 || !strings.Contains(s, `"totalTokenCount":12`) {
+		t.Fatalf("expected accumulated usage, got:\n%s", s)
+	}
+	if sent == nil || len(sent.Request.Contents) != 2 || sent.Request.Contents[0].Parts[0].Text != "checking " {
+		t.Fatalf("unexpected follow-up contents: %+v", sent)
+	}
+}
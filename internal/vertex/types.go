@@ -1,6 +1,9 @@
 package vertex
 
-import "encoding/json"
+import (
+	"encoding/json"
+	"net/http"
+)
 
 // Request is the Vertex AI Cloud Code API wrapper request.
 // It matches the format used by antigravity Cloud Code endpoints.
@@ -11,6 +14,17 @@ type Request struct {
 	RequestType string   `json:"requestType,omitempty"`
 	UserAgent   string   `json:"userAgent,omitempty"`
 	Request     InnerReq `json:"request"`
+
+	// PrefillWhitespace 为末尾 assistant 预填充被去掉的尾部空白，不发送给上游（见 gwcommon.TrimPrefill）。
+	PrefillWhitespace string `json:"-"`
+	// ToolResultRefs 为被替换成引用的工具结果（引用 ID → 原文），不发送给上游；非空时由 GenerateContent /
+	// GenerateContentStream 代为执行模型发起的 fetch_tool_result 调用（见 gwcommon.ReferenceToolResults）。
+	ToolResultRefs map[string]string `json:"-"`
+	// ProxyFunctions 为由代理代为执行的函数（函数名 → 实现），不发送给上游；模型调用这些函数时由 GenerateContent /
+	// GenerateContentStream 执行并继续请求（见 ProxyFunction）。
+	ProxyFunctions map[string]ProxyFunction `json:"-"`
+	// Account 为成功完成请求的账号 SessionID，不发送给上游；记录用量时据此累计账号的每日用量（见 credential.Store.RecordUsage）。
+	Account string `json:"-"`
 }
 
 type InnerReq struct {
@@ -60,12 +74,19 @@ type SystemInstruction struct {
 
 type Tool struct {
 	FunctionDeclarations []FunctionDeclaration `json:"functionDeclarations,omitempty"`
+	// GoogleSearch 启用 Google 搜索 grounding（不能与函数声明放在同一个请求中）。
+	GoogleSearch *GoogleSearch `json:"googleSearch,omitempty"`
 }
 
+type GoogleSearch struct{}
+
 type FunctionDeclaration struct {
 	Name        string         `json:"name"`
 	Description string         `json:"description"`
 	Parameters  map[string]any `json:"parameters,omitempty"`
+
+	// Strict 表示客户端要求严格遵循参数 schema（OpenAI strict: true），不发送给上游。
+	Strict bool `json:"-"`
 }
 
 type ToolConfig struct {
@@ -87,6 +108,8 @@ type GenerationConfig struct {
 	ThinkingConfig  *ThinkingConfig `json:"thinkingConfig,omitempty"`
 	ImageConfig     *ImageConfig    `json:"imageConfig,omitempty"`
 	MediaResolution string          `json:"mediaResolution,omitempty"`
+	// ResponseMimeType 为 application/json 时要求模型只输出 JSON。
+	ResponseMimeType string `json:"responseMimeType,omitempty"`
 }
 
 type ThinkingConfig struct {
@@ -121,15 +144,81 @@ func (t ThinkingConfig) MarshalJSON() ([]byte, error) {
 
 type Response struct {
 	Response struct {
-		Candidates    []Candidate    `json:"candidates"`
-		UsageMetadata *UsageMetadata `json:"usageMetadata,omitempty"`
+		Candidates     []Candidate     `json:"candidates"`
+		UsageMetadata  *UsageMetadata  `json:"usageMetadata,omitempty"`
+		PromptFeedback *PromptFeedback `json:"promptFeedback,omitempty"`
 	} `json:"response"`
+
+	// upstreamHeader 为 UPSTREAM_HEADERS 选中的上游响应头（见 UpstreamHeader）。
+	upstreamHeader http.Header
+}
+
+// UpstreamHeader 返回该响应对应的上游响应头子集（见 SelectUpstreamHeaders），r 为 nil 时返回 nil。
+func (r *Response) UpstreamHeader() http.Header {
+	if r == nil {
+		return nil
+	}
+	return r.upstreamHeader
+}
+
+// InlineDataBytes 返回响应中 inlineData（base64）的总字节数。
+func (r *Response) InlineDataBytes() int {
+	if r == nil {
+		return 0
+	}
+	n := 0
+	for _, c := range r.Response.Candidates {
+		for _, p := range c.Content.Parts {
+			if p.InlineData != nil {
+				n += len(p.InlineData.Data)
+			}
+		}
+	}
+	return n
+}
+
+// PromptFeedback 在上游拦截提示词时返回（此时通常没有 candidates）。
+type PromptFeedback struct {
+	BlockReason        string         `json:"blockReason,omitempty"`
+	BlockReasonMessage string         `json:"blockReasonMessage,omitempty"`
+	SafetyRatings      []SafetyRating `json:"safetyRatings,omitempty"`
+}
+
+type SafetyRating struct {
+	Category         string  `json:"category"`
+	Probability      string  `json:"probability,omitempty"`
+	ProbabilityScore float64 `json:"probabilityScore,omitempty"`
+	Blocked          bool    `json:"blocked,omitempty"`
 }
 
 type Candidate struct {
-	Content      Content `json:"content"`
-	FinishReason string  `json:"finishReason,omitempty"`
-	Index        int     `json:"index"`
+	Content           Content            `json:"content"`
+	FinishReason      string             `json:"finishReason,omitempty"`
+	Index             int                `json:"index"`
+	GroundingMetadata *GroundingMetadata `json:"groundingMetadata,omitempty"`
+	SafetyRatings     []SafetyRating     `json:"safetyRatings,omitempty"`
+}
+
+// GroundingMetadata 为启用 googleSearch 时候选中附带的检索来源。
+type GroundingMetadata struct {
+	WebSearchQueries  []string           `json:"webSearchQueries,omitempty"`
+	GroundingChunks   []GroundingChunk   `json:"groundingChunks,omitempty"`
+	GroundingSupports []GroundingSupport `json:"groundingSupports,omitempty"`
+}
+
+type GroundingChunk struct {
+	Web *struct {
+		URI   string `json:"uri"`
+		Title string `json:"title"`
+	} `json:"web,omitempty"`
+}
+
+// GroundingSupport 将正文片段关联到支撑它的 GroundingChunks 下标。
+type GroundingSupport struct {
+	Segment struct {
+		Text string `json:"text"`
+	} `json:"segment"`
+	GroundingChunkIndices []int `json:"groundingChunkIndices"`
 }
 
 type UsageMetadata struct {
@@ -0,0 +1,51 @@
+package vertex
+
+import (
+	"net/http"
+	"sort"
+	"strings"
+
+	"anti2api-golang/refactor/internal/config"
+	"anti2api-golang/refactor/internal/logger"
+)
+
+// SelectUpstreamHeaders 返回 h 中 UPSTREAM_HEADERS 配置的响应头子集；未配置或都不存在时返回 nil。
+func SelectUpstreamHeaders(h http.Header) http.Header {
+	names := config.Get().UpstreamHeaders
+	if len(names) == 0 || len(h) == 0 {
+		return nil
+	}
+	var out http.Header
+	for _, name := range names {
+		values := h.Values(name)
+		if len(values) == 0 {
+			continue
+		}
+		if out == nil {
+			out = make(http.Header, len(names))
+		}
+		out[http.CanonicalHeaderKey(name)] = values
+	}
+	return out
+}
+
+// logUpstreamHeaders 将选中的上游响应头写入日志：非 200 响应为告警，其余为调试级别。
+func logUpstreamHeaders(status int, h http.Header) {
+	if len(h) == 0 {
+		return
+	}
+	keys := make([]string, 0, len(h))
+	for k := range h {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	pairs := make([]string, 0, len(keys))
+	for _, k := range keys {
+		pairs = append(pairs, k+"="+strings.Join(h[k], ","))
+	}
+	if status != http.StatusOK {
+		logger.Warn("上游响应 %d，响应头：%s", status, strings.Join(pairs, " "))
+		return
+	}
+	logger.Debug("上游响应头：%s", strings.Join(pairs, " "))
+}
@@ -0,0 +1,36 @@
+package vertex
+
+import (
+	"net/http"
+	"reflect"
+	"testing"
+
+	"anti2api-golang/refactor/internal/config"
+)
+
+func TestSelectUpstreamHeaders(t *testing.T) {
+	c := config.Get()
+	old := c.UpstreamHeaders
+	t.Cleanup(func() { c.UpstreamHeaders = old })
+
+	h := http.Header{}
+	h.Set("X-Cloudaicompanion-Trace-Id", "abc123")
+	h.Add("Server-Timing", "gfet4t7; dur=812")
+	h.Set("Set-Cookie", "secret")
+
+	c.UpstreamHeaders = nil
+	if got := SelectUpstreamHeaders(h); got != nil {
+		t.Fatalf("no headers should pass through when unconfigured, got %v", got)
+	}
+
+	c.UpstreamHeaders = []string{"x-cloudaicompanion-trace-id", "server-timing", "x-missing"}
+	want := http.Header{"X-Cloudaicompanion-Trace-Id": {"abc123"}, "Server-Timing": {"gfet4t7; dur=812"}}
+	if got := SelectUpstreamHeaders(h); !reflect.DeepEqual(got, want) {
+		t.Fatalf("selected headers = %v; want %v", got, want)
+	}
+
+	apiErr := ExtractErrorDetails(&http.Response{StatusCode: http.StatusTooManyRequests, Header: h}, []byte(`{"error":{"message":"quota"}}`))
+	if !reflect.DeepEqual(apiErr.UpstreamHeader, want) {
+		t.Fatalf("error headers = %v; want %v", apiErr.UpstreamHeader, want)
+	}
+}
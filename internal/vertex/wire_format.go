@@ -0,0 +1,166 @@
+package vertex
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+
+	"anti2api-golang/refactor/internal/config"
+	"anti2api-golang/refactor/internal/logger"
+	jsonpkg "anti2api-golang/refactor/internal/pkg/json"
+)
+
+// DefaultWireFormat 为当前 Cloud Code 使用的外层格式。
+const DefaultWireFormat = "v1internal"
+
+// 上游方法名（URL 中冒号后的部分）。
+const (
+	MethodGenerateContent       = "generateContent"
+	MethodStreamGenerateContent = "streamGenerateContent"
+	MethodFetchAvailableModels  = "fetchAvailableModels"
+)
+
+// WireFormat 描述 Cloud Code 请求/响应的外层格式（URL 版本段、请求包装与响应包装）。
+// 各接口的转换器只构建 Request、只解析 v1internal 形式的响应（{"response": {...}}），
+// 上游更换包装字段时新增一个 WireFormat 并通过 VERTEX_WIRE_FORMAT 切换即可，不需要改动转换器。
+type WireFormat interface {
+	Name() string
+	// URL 返回 method 在 host 上的完整地址（流式方法需带上 SSE 参数）。
+	URL(host, method string) string
+	// EncodeRequest 将 Request 序列化为上游请求体。
+	EncodeRequest(req *Request) ([]byte, error)
+	// DecodeResponse 将上游响应体（非流式响应或一个流式分片）转换为 v1internal 形式。
+	DecodeResponse(body []byte) ([]byte, error)
+}
+
+// v1InternalFormat 为 v1internal 格式：请求为 {project, model, request: {...}}，响应为 {"response": {...}}，与内部类型一致。
+type v1InternalFormat struct{}
+
+func (v1InternalFormat) Name() string { return DefaultWireFormat }
+
+func (v1InternalFormat) URL(host, method string) string {
+	u := "https://" + host + "/v1internal:" + method
+	if method == MethodStreamGenerateContent {
+		u += "?alt=sse"
+	}
+	return u
+}
+
+func (v1InternalFormat) EncodeRequest(req *Request) ([]byte, error) { return jsonpkg.Marshal(req) }
+
+func (v1InternalFormat) DecodeResponse(body []byte) ([]byte, error) { return body, nil }
+
+var (
+	wireFormatsMu sync.RWMutex
+	wireFormats   = map[string]WireFormat{DefaultWireFormat: v1InternalFormat{}}
+)
+
+// RegisterWireFormat 注册一种外层格式（名称不区分大小写），同名时覆盖。
+func RegisterWireFormat(f WireFormat) {
+	wireFormatsMu.Lock()
+	defer wireFormatsMu.Unlock()
+	wireFormats[strings.ToLower(f.Name())] = f
+}
+
+// WireFormats 返回已注册的格式名称（已排序）。
+func WireFormats() []string {
+	wireFormatsMu.RLock()
+	defer wireFormatsMu.RUnlock()
+	return wireFormatNamesLocked()
+}
+
+func lookupWireFormat(name string) (WireFormat, error) {
+	name = strings.ToLower(strings.TrimSpace(name))
+	if name == "" {
+		name = DefaultWireFormat
+	}
+	wireFormatsMu.RLock()
+	defer wireFormatsMu.RUnlock()
+	if f, ok := wireFormats[name]; ok {
+		return f, nil
+	}
+	return wireFormats[DefaultWireFormat], fmt.Errorf("未知的 VERTEX_WIRE_FORMAT %q（可选：%s）", name, strings.Join(wireFormatNamesLocked(), " / "))
+}
+
+func wireFormatNamesLocked() []string {
+	names := make([]string, 0, len(wireFormats))
+	for name := range wireFormats {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+var unknownWireFormatOnce sync.Once
+
+// ActiveWireFormat 返回 VERTEX_WIRE_FORMAT 选择的格式；未知名称时告警一次并使用 v1internal。
+func ActiveWireFormat() WireFormat {
+	f, err := lookupWireFormat(config.Get().VertexWireFormat)
+	if err != nil {
+		unknownWireFormatOnce.Do(func() { logger.Warn("%v，使用 %s", err, DefaultWireFormat) })
+	}
+	return f
+}
+
+// decodeStreamBody 按 f 转换流式响应中每个 "data: " 分片（gzip 响应先解压）；v1internal 格式不做任何处理。
+func decodeStreamBody(f WireFormat, resp *http.Response) error {
+	if _, ok := f.(v1InternalFormat); ok {
+		return nil
+	}
+	body := resp.Body
+	var src io.Reader = body
+	if resp.Header.Get("Content-Encoding") == "gzip" {
+		gzReader, err := gzip.NewReader(body)
+		if err != nil {
+			return err
+		}
+		src = gzReader
+		resp.Header.Del("Content-Encoding")
+	}
+	pr, pw := io.Pipe()
+	go func() {
+		reader := bufio.NewReaderSize(src, 64*1024)
+		for {
+			line, err := reader.ReadBytes('\n')
+			if len(line) > 0 {
+				if data, ok := bytes.CutPrefix(line, []byte("data: ")); ok {
+					trimmed := bytes.TrimRight(data, "\r\n")
+					if len(trimmed) > 0 && !bytes.Equal(trimmed, []byte("[DONE]")) {
+						if decoded, derr := f.DecodeResponse(trimmed); derr == nil {
+							line = append(append([]byte("data: "), decoded...), '\n')
+						}
+					}
+				}
+				if _, werr := pw.Write(line); werr != nil {
+					return
+				}
+			}
+			if err != nil {
+				if err == io.EOF {
+					err = nil
+				}
+				pw.CloseWithError(err)
+				return
+			}
+		}
+	}()
+	resp.Body = &decodedStreamBody{Reader: pr, pipe: pr, body: body}
+	return nil
+}
+
+type decodedStreamBody struct {
+	io.Reader
+	pipe *io.PipeReader
+	body io.ReadCloser
+}
+
+func (d *decodedStreamBody) Close() error {
+	_ = d.pipe.Close()
+	return d.body.Close()
+}
@@ -0,0 +1,111 @@
+package vertex
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+
+	"anti2api-golang/refactor/internal/config"
+	jsonpkg "anti2api-golang/refactor/internal/pkg/json"
+)
+
+// flatWireFormat 模拟一种不带 response 包装、请求字段改名的新格式。
+type flatWireFormat struct{}
+
+func (flatWireFormat) Name() string { return "test-flat" }
+
+func (flatWireFormat) URL(host, method string) string {
+	return "https://" + host + "/v2test:" + method
+}
+
+func (flatWireFormat) EncodeRequest(req *Request) ([]byte, error) {
+	return jsonpkg.Marshal(map[string]any{"projectId": req.Project, "model": req.Model, "payload": req.Request})
+}
+
+func (flatWireFormat) DecodeResponse(body []byte) ([]byte, error) {
+	return append(append([]byte(`{"response":`), body...), '}'), nil
+}
+
+type wireRoundTripper struct {
+	url  string
+	body string
+	resp string
+}
+
+func (rt *wireRoundTripper) RoundTrip(r *http.Request) (*http.Response, error) {
+	rt.url = r.URL.String()
+	b, _ := io.ReadAll(r.Body)
+	rt.body = string(b)
+	return &http.Response{StatusCode: http.StatusOK, Header: http.Header{}, Body: io.NopCloser(strings.NewReader(rt.resp)), Request: r}, nil
+}
+
+func useWireFormat(t *testing.T, name string) {
+	t.Helper()
+	c := config.Get()
+	old := c.VertexWireFormat
+	c.VertexWireFormat = name
+	t.Cleanup(func() { c.VertexWireFormat = old })
+}
+
+func TestV1InternalWireFormat(t *testing.T) {
+	f := v1InternalFormat{}
+	if got := f.URL("example.com", MethodStreamGenerateContent); got != "https://example.com/v1internal:streamGenerateContent?alt=sse" {
+		t.Fatalf("stream URL = %s", got)
+	}
+	if got := f.URL("example.com", MethodGenerateContent); got != "https://example.com/v1internal:generateContent" {
+		t.Fatalf("URL = %s", got)
+	}
+	useWireFormat(t, "")
+	if ActiveWireFormat().Name() != DefaultWireFormat {
+		t.Fatalf("empty VERTEX_WIRE_FORMAT should select %s", DefaultWireFormat)
+	}
+}
+
+func TestWireFormat_CustomFormatRoundTrip(t *testing.T) {
+	RegisterWireFormat(flatWireFormat{})
+	useWireFormat(t, "TEST-FLAT")
+
+	c := NewClient()
+	rt := &wireRoundTripper{resp: `{"candidates":[{"content":{"role":"model","parts":[{"text":"hi"}]}}]}`}
+	c.httpClient.Transport = rt
+
+	req := &Request{Project: "p", Model: "m"}
+	resp, err := c.SendRequest(context.Background(), req, "token")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(rt.url, "/v2test:generateContent") || !strings.Contains(rt.body, `"projectId":"p"`) {
+		t.Fatalf("request not encoded with custom format: %s %s", rt.url, rt.body)
+	}
+	if len(resp.Response.Candidates) != 1 || resp.Response.Candidates[0].Content.Parts[0].Text != "hi" {
+		t.Fatalf("response not decoded: %+v", resp.Response)
+	}
+
+	rt.resp = "data: {\"candidates\":[{\"content\":{\"parts\":[{\"text\":\"a\"}]}}]}\n\ndata: {\"candidates\":[{\"content\":{\"parts\":[{\"text\":\"b\"}]},\"finishReason\":\"STOP\"}]}\n\n"
+	stream, err := c.SendStreamRequest(context.Background(), req, "token")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(rt.url, "/v2test:streamGenerateContent") {
+		t.Fatalf("stream URL = %s", rt.url)
+	}
+	result, err := ParseStreamWithResult(stream, func(*StreamData) error { return nil })
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Text != "ab" || result.FinishReason != "STOP" {
+		t.Fatalf("stream not decoded: text=%q finish=%q", result.Text, result.FinishReason)
+	}
+}
+
+func TestWireFormat_UnknownFallsBack(t *testing.T) {
+	if _, err := lookupWireFormat("v9"); err == nil {
+		t.Fatal("unknown format should return an error")
+	}
+	useWireFormat(t, "v9")
+	if ActiveWireFormat().Name() != DefaultWireFormat {
+		t.Fatalf("unknown format should fall back to %s", DefaultWireFormat)
+	}
+}
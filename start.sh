@@ -194,7 +194,7 @@ setup_missing_vars() {
 # 计算源代码哈希
 calculate_source_hash() {
     # 计算 Go 源文件和 templ 文件的哈希
-    find "$SCRIPT_DIR" -type f \( -name "*.go" -o -name "*.templ" \) \
+    find "$SCRIPT_DIR" -type f \( -name "*.go" -o -name "*.templ" -o -path "*/manager/static/assets/*" \) \
         -not -path "*/.git/*" \
         -not -path "*/vendor/*" \
         -not -name "*_templ.go" \
@@ -259,6 +259,13 @@ build_frontend() {
         log_error "前端模板构建失败"
         exit 1
     fi
+
+    # 下载并内嵌 htmx / Tailwind；失败时管理面板回退到 CDN
+    if sh "$SCRIPT_DIR/internal/gateway/manager/static/fetch.sh" 2>&1; then
+        log_success "前端资源已就绪"
+    else
+        log_warn "前端资源下载失败，管理面板将从 CDN 加载"
+    fi
 }
 
 # 构建后端